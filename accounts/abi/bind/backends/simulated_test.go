@@ -0,0 +1,114 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package backends
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(10000000000)
+)
+
+func newTestTransfer(t *testing.T, sim *SimulatedBackend, to common.Address, amount *big.Int) *types.Transaction {
+	nonce, err := sim.PendingNonceAt(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("failed to retrieve pending nonce: %v", err)
+	}
+	tx, err := types.SignTx(types.NewTransaction(nonce, to, amount, 21000, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// Tests that committed transactions become visible in the canonical state and
+// that rolled back ones are dropped without a trace.
+func TestSimulatedBackendCommitRollback(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		sim  = NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+		dest = common.HexToAddress("0x0000000000000000000000000000000000000a11")
+	)
+	// Send a transfer and discard it again
+	if err := sim.SendTransaction(ctx, newTestTransfer(t, sim, dest, big.NewInt(1))); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	sim.Rollback()
+
+	if balance, _ := sim.BalanceAt(ctx, dest, nil); balance.Sign() != 0 {
+		t.Fatalf("rolled back transfer credited: have %v, want 0", balance)
+	}
+	sim.Commit()
+	if balance, _ := sim.BalanceAt(ctx, dest, nil); balance.Sign() != 0 {
+		t.Fatalf("rolled back transfer committed: have %v, want 0", balance)
+	}
+	// Send a transfer and mine it
+	tx := newTestTransfer(t, sim, dest, big.NewInt(2))
+	if err := sim.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	sim.Commit()
+
+	if balance, _ := sim.BalanceAt(ctx, dest, nil); balance.Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("committed transfer balance mismatch: have %v, want 2", balance)
+	}
+	receipt, _ := sim.TransactionReceipt(ctx, tx.Hash())
+	if receipt == nil {
+		t.Fatalf("no receipt for committed transaction")
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("committed transaction failed")
+	}
+}
+
+// Tests that adjusting the clock shifts the timestamp of the pending block and
+// keeps the pending transactions.
+func TestSimulatedBackendAdjustTime(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		sim  = NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+		dest = common.HexToAddress("0x0000000000000000000000000000000000000a11")
+	)
+	if err := sim.SendTransaction(ctx, newTestTransfer(t, sim, dest, big.NewInt(1))); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	prevTime := sim.pendingBlock.Time().Uint64()
+	if err := sim.AdjustTime(time.Hour); err != nil {
+		t.Fatalf("failed to adjust time: %v", err)
+	}
+	if have, want := sim.pendingBlock.Time().Uint64(), prevTime+uint64(time.Hour.Seconds()); have != want {
+		t.Fatalf("pending block time mismatch: have %d, want %d", have, want)
+	}
+	if txs := sim.pendingBlock.Transactions().Len(); txs != 1 {
+		t.Fatalf("pending transaction count mismatch: have %d, want 1", txs)
+	}
+	sim.Commit()
+	if balance, _ := sim.BalanceAt(ctx, dest, nil); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("transfer balance mismatch after time shift: have %v, want 1", balance)
+	}
+}
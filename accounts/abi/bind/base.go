@@ -53,6 +53,10 @@ type TransactOpts struct {
 	GasPrice *big.Int // Gas price to use for the transaction execution (nil = gas price oracle)
 	GasLimit uint64   // Gas limit to set for the transaction execution (0 = estimate)
 
+	TxType     byte                // MATRIX transaction type of method invocations (0 = normal)
+	LockHeight uint64              // Block height the transaction is locked until (0 = unlocked)
+	ExtraTo    []*types.ExtraTo_tr // Additional recipients executed along the method invocation
+
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
 }
 
@@ -223,13 +227,29 @@ func (c *BoundContract) transact(opts *TransactOpts, contract *common.Address, i
 		if err != nil {
 			return nil, fmt.Errorf("failed to estimate gas needed: %v", err)
 		}
+		// Additional recipients are charged on top of the invocation itself
+		if contract != nil {
+			for _, extra := range opts.ExtraTo {
+				msg := matrix.CallMsg{From: opts.From, To: extra.To_tr, Value: (*big.Int)(extra.Value_tr)}
+				if extra.Input_tr != nil {
+					msg.Data = *extra.Input_tr
+				}
+				gas, err := c.transactor.EstimateGas(ensureContext(opts.Context), msg)
+				if err != nil {
+					return nil, fmt.Errorf("failed to estimate gas needed by extra recipient: %v", err)
+				}
+				gasLimit += gas
+			}
+		}
 	}
 	// Create the transaction, sign it and schedule it for execution
 	var rawTx *types.Transaction
 	if contract == nil {
 		rawTx = types.NewContractCreation(nonce, value, gasLimit, gasPrice, input)
-	} else {
+	} else if opts.TxType == 0 && opts.LockHeight == 0 && opts.ExtraTo == nil {
 		rawTx = types.NewTransaction(nonce, c.address, value, gasLimit, gasPrice, input)
+	} else {
+		rawTx = types.NewTransactions(nonce, c.address, value, gasLimit, gasPrice, input, opts.ExtraTo, opts.LockHeight, opts.TxType)
 	}
 	if opts.Signer == nil {
 		return nil, errors.New("no signer to authorize the transaction with")
@@ -0,0 +1,105 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package bind_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix"
+	"github.com/matrix/go-matrix/accounts/abi"
+	"github.com/matrix/go-matrix/accounts/abi/bind"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/types"
+)
+
+// mockTransactor is a bind.ContractTransactor estimating a fixed amount of gas
+// for every call and recording the transactions sent through it.
+type mockTransactor struct {
+	gas  uint64
+	sent []*types.Transaction
+}
+
+func (mt *mockTransactor) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return []byte{0x1}, nil
+}
+func (mt *mockTransactor) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 0, nil
+}
+func (mt *mockTransactor) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+func (mt *mockTransactor) EstimateGas(ctx context.Context, call matrix.CallMsg) (uint64, error) {
+	return mt.gas, nil
+}
+func (mt *mockTransactor) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	mt.sent = append(mt.sent, tx)
+	return nil
+}
+
+// Tests that the MATRIX specific transaction fields of the transact options end
+// up in the sent transaction and that extra recipients are accounted for in the
+// gas estimate.
+func TestTransactExtraFields(t *testing.T) {
+	var (
+		transactor = &mockTransactor{gas: 30000}
+		contract   = bind.NewBoundContract(common.HexToAddress("0x01"), abi.ABI{}, nil, transactor, nil)
+		recipient  = common.HexToAddress("0x02")
+		input      = hexutil.Bytes{0xca, 0xfe}
+	)
+	signer := func(signer types.Signer, from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		return tx, nil
+	}
+	opts := &bind.TransactOpts{
+		Signer:     signer,
+		TxType:     1,
+		LockHeight: 100,
+		ExtraTo:    []*types.ExtraTo_tr{{To_tr: &recipient, Value_tr: (*hexutil.Big)(big.NewInt(5)), Input_tr: &input}},
+	}
+	tx, err := contract.Transfer(opts)
+	if err != nil {
+		t.Fatalf("failed to transact: %v", err)
+	}
+	if len(transactor.sent) != 1 || transactor.sent[0] != tx {
+		t.Fatalf("transaction not sent to the transactor")
+	}
+	if tx.Gas() != 2*transactor.gas {
+		t.Errorf("gas limit mismatch: have %d, want %d", tx.Gas(), 2*transactor.gas)
+	}
+	extra := tx.GetMatrix_EX()
+	if len(extra) != 1 {
+		t.Fatalf("extra field count mismatch: have %d, want 1", len(extra))
+	}
+	if extra[0].TxType != 1 || extra[0].LockHeight != 100 {
+		t.Errorf("extra type or lock height mismatch: have %d/%d, want 1/100", extra[0].TxType, extra[0].LockHeight)
+	}
+	if len(extra[0].ExtraTo) != 1 || *extra[0].ExtraTo[0].Recipient != recipient || extra[0].ExtraTo[0].Amount.Int64() != 5 {
+		t.Errorf("extra recipient mismatch: have %+v", extra[0].ExtraTo)
+	}
+	// Plain options must keep producing plain transactions
+	if tx, err = contract.Transfer(&bind.TransactOpts{Signer: signer}); err != nil {
+		t.Fatalf("failed to transact: %v", err)
+	}
+	if extra := tx.GetMatrix_EX(); len(extra) != 0 {
+		t.Errorf("plain transaction carries extra fields: %+v", extra)
+	}
+	if tx.Gas() != transactor.gas {
+		t.Errorf("gas limit mismatch: have %d, want %d", tx.Gas(), transactor.gas)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package accounts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+)
+
+// Tests that audit entries are appended to the log file and that a nil audit
+// log is safe to use.
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	for i, method := range []string{"man_sign", "personal_sendTransaction"} {
+		audit, err := NewAuditLog(path)
+		if err != nil {
+			t.Fatalf("failed to open audit log: %v", err)
+		}
+		audit.Record("http://127.0.0.1:1234", method, common.Address{0x01}, "hash", common.Hash{byte(i + 1)})
+		if err := audit.Close(); err != nil {
+			t.Fatalf("failed to close audit log: %v", err)
+		}
+		audit.Record("late", "man_sign", common.Address{}) // must not panic or write
+	}
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit entry count mismatch: have %d, want 2:\n%s", len(lines), blob)
+	}
+	for i, want := range []string{"man_sign", "personal_sendTransaction"} {
+		if !strings.Contains(lines[i], want) || !strings.Contains(lines[i], "caller=http://127.0.0.1:1234") {
+			t.Errorf("entry %d: missing method or caller: %s", i, lines[i])
+		}
+	}
+	var nilLog *AuditLog
+	nilLog.Record("caller", "man_sign", common.Address{})
+	if err := nilLog.Close(); err != nil {
+		t.Errorf("failed to close nil audit log: %v", err)
+	}
+}
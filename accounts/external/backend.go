@@ -0,0 +1,257 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package external
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	matrix "github.com/matrix/go-matrix"
+	"github.com/matrix/go-matrix/accounts"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/event"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// ExternalScheme is the protocol scheme prefixing account and wallet URLs of
+// accounts managed by an external signer.
+const ExternalScheme = "extapi"
+
+// errExtendedTx is returned if a MATRIX extended transaction is handed to the
+// external signer. The signer API only carries the standard transaction fields,
+// so it would approve and sign something different from what gets broadcast.
+var errExtendedTx = errors.New("external signer: extended transactions not supported")
+
+// ExternalBackend is an accounts.Backend exposing the accounts of a single
+// external signer (such as clef) reachable over IPC or HTTP.
+type ExternalBackend struct {
+	signers []accounts.Wallet
+}
+
+// NewExternalBackend connects to the external signer at the given endpoint and
+// returns a backend wrapping it.
+func NewExternalBackend(endpoint string) (*ExternalBackend, error) {
+	signer, err := NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalBackend{signers: []accounts.Wallet{signer}}, nil
+}
+
+// Wallets implements accounts.Backend, returning the external signer.
+func (eb *ExternalBackend) Wallets() []accounts.Wallet {
+	return eb.signers
+}
+
+// Subscribe implements accounts.Backend. The external signer does not announce
+// account changes, so the subscription never fires any events.
+func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// ExternalSigner is an accounts.Wallet delegating all signing requests to an
+// external signer process, which approves or rejects them based on its own
+// rules. No key material ever passes through the node.
+type ExternalSigner struct {
+	client   *rpc.Client
+	endpoint string
+
+	cache  []accounts.Account // Accounts last reported by the signer, nil if not yet listed
+	cacheM sync.RWMutex
+}
+
+// NewExternalSigner dials the external signer at the given IPC path or HTTP URL.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalSigner{client: client, endpoint: endpoint}, nil
+}
+
+// URL implements accounts.Wallet, returning the endpoint of the signer.
+func (api *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: ExternalScheme, Path: api.endpoint}
+}
+
+// Status implements accounts.Wallet, reporting whether the signer answered the
+// last account listing.
+func (api *ExternalSigner) Status() (string, error) {
+	if _, err := api.listAccounts(); err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+// Open implements accounts.Wallet. Unlocking is done within the external signer,
+// so this is a no-op.
+func (api *ExternalSigner) Open(passphrase string) error {
+	return nil
+}
+
+// Close implements accounts.Wallet, tearing down the connection to the signer.
+func (api *ExternalSigner) Close() error {
+	api.client.Close()
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the accounts the signer agreed
+// to expose. The listing is cached after the first successful request, as each
+// listing may require user approval on the signer side.
+func (api *ExternalSigner) Accounts() []accounts.Account {
+	api.cacheM.RLock()
+	cache := api.cache
+	api.cacheM.RUnlock()
+	if cache != nil {
+		return cache
+	}
+	accs, err := api.listAccounts()
+	if err != nil {
+		log.Warn("Failed to list external signer accounts", "endpoint", api.endpoint, "err", err)
+		return nil
+	}
+	return accs
+}
+
+// Contains implements accounts.Wallet, checking whether the signer exposes the
+// given account.
+func (api *ExternalSigner) Contains(account accounts.Account) bool {
+	for _, acc := range api.Accounts() {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == api.URL()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is not supported by external signers.
+func (api *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a no-op for external signers.
+func (api *ExternalSigner) SelfDerive(base accounts.DerivationPath, chain matrix.ChainStateReader) {
+	log.Error("Operation not supported on external signers")
+}
+
+// SignHash implements accounts.Wallet. The signer only signs data it can show
+// to the user, never opaque hashes, so this always fails.
+func (api *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTx implements accounts.Wallet, sending the transaction to the external
+// signer for approval and returning the signed version.
+func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if len(tx.GetMatrix_EX()) > 0 {
+		return nil, errExtendedTx
+	}
+	args := &sendTxArgs{
+		From:     account.Address,
+		To:       tx.To(),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     hexutil.Bytes(tx.Data()),
+	}
+	var res signTransactionResult
+	if err := api.client.Call(&res, "account_signTransaction", args, nil); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := rlp.DecodeBytes(res.Raw, signed); err != nil {
+		return nil, err
+	}
+	// Make sure the signer didn't sign with a different chain or account
+	if chainID != nil && signed.ChainId().Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("external signer: chain ID mismatch: have %v, want %v", signed.ChainId(), chainID)
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(signed.ChainId()), signed)
+	if err != nil {
+		return nil, err
+	}
+	if sender != account.Address {
+		return nil, fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), sender.Hex())
+	}
+	return signed, nil
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but is not supported as
+// passphrases never leave the external signer.
+func (api *ExternalSigner) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet. The passphrase is ignored,
+// the external signer asks its user for it if needed.
+func (api *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return api.SignTx(account, tx, chainID)
+}
+
+func (api *ExternalSigner) SignHashValidate(account accounts.Account, hash []byte, validate bool) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+func (api *ExternalSigner) SignHashValidateWithPass(account accounts.Account, passphrase string, hash []byte, validate bool) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// listAccounts retrieves the accounts exposed by the signer and refreshes the
+// local cache.
+func (api *ExternalSigner) listAccounts() ([]accounts.Account, error) {
+	var res []struct {
+		Address common.Address `json:"address"`
+	}
+	if err := api.client.Call(&res, "account_list"); err != nil {
+		return nil, err
+	}
+	accs := make([]accounts.Account, 0, len(res))
+	for _, acc := range res {
+		accs = append(accs, accounts.Account{Address: acc.Address, URL: api.URL()})
+	}
+	api.cacheM.Lock()
+	api.cache = accs
+	api.cacheM.Unlock()
+	return accs, nil
+}
+
+// sendTxArgs mirrors the transaction arguments accepted by the signer API.
+type sendTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice hexutil.Big     `json:"gasPrice"`
+	Value    hexutil.Big     `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+// signTransactionResult is the reply of the signer to a transaction signing
+// request, of which only the RLP encoded form is used.
+type signTransactionResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package external
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/accounts"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// SignerService is a minimal stand-in for the signer's account API. It needs to
+// be exported to be registrable on an RPC server.
+type SignerService struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+}
+
+func (api *SignerService) List(ctx context.Context) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{{"type": "Account", "address": crypto.PubkeyToAddress(api.key.PublicKey)}}, nil
+}
+
+func (api *SignerService) SignTransaction(ctx context.Context, args SendTxArgs, methodSelector *string) (map[string]interface{}, error) {
+	tx := types.NewTransaction(uint64(args.Nonce), *args.To, (*big.Int)(&args.Value), uint64(args.Gas), (*big.Int)(&args.GasPrice), args.Data)
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(api.chainID), api.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": hexutil.Bytes(raw)}, nil
+}
+
+// SendTxArgs are the transaction arguments as decoded by the signer.
+type SendTxArgs struct {
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice hexutil.Big     `json:"gasPrice"`
+	Value    hexutil.Big     `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+func newTestSigner(t *testing.T, chainID *big.Int) (*ExternalSigner, common.Address) {
+	key, _ := crypto.GenerateKey()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &SignerService{key: key, chainID: chainID}); err != nil {
+		t.Fatalf("failed to register signer API: %v", err)
+	}
+	return &ExternalSigner{client: rpc.DialInProc(server), endpoint: "inproc"}, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// Tests that transactions are signed remotely and the result is validated
+// against the requested account and chain.
+func TestExternalSignTx(t *testing.T) {
+	signer, addr := newTestSigner(t, big.NewInt(1))
+	defer signer.Close()
+
+	accs := signer.Accounts()
+	if len(accs) != 1 || accs[0].Address != addr {
+		t.Fatalf("account listing mismatch: have %v, want %x", accs, addr)
+	}
+	if !signer.Contains(accounts.Account{Address: addr}) {
+		t.Fatalf("listed account not contained")
+	}
+	tx := types.NewTransaction(1, common.Address{0x01}, big.NewInt(10), 21000, big.NewInt(1), nil)
+
+	signed, err := signer.SignTx(accs[0], tx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if signed.Nonce() != tx.Nonce() || *signed.To() != *tx.To() || signed.Value().Cmp(tx.Value()) != 0 {
+		t.Errorf("signed transaction content mismatch")
+	}
+	if _, err := signer.SignTx(accs[0], tx, big.NewInt(2)); err == nil {
+		t.Errorf("signature for wrong chain accepted")
+	}
+	if _, err := signer.SignTx(accounts.Account{Address: common.Address{0xff}}, tx, big.NewInt(1)); err == nil {
+		t.Errorf("signature by wrong account accepted")
+	}
+}
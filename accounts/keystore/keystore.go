@@ -63,6 +63,8 @@ type KeyStore struct {
 	changes  chan struct{}                // Channel receiving change notifications from the cache
 	unlocked map[common.Address]*unlocked // Currently unlocked account (decrypted private keys)
 
+	unlockLimit time.Duration // Maximum duration of API requested unlocks (0 = unlimited)
+
 	wallets     []accounts.Wallet       // Wallet wrappers around the individual key files
 	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
 	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
@@ -82,8 +84,14 @@ type unlocked struct {
 
 // NewKeyStore creates a keystore for the given directory.
 func NewKeyStore(keydir string, scryptN, scryptP int) *KeyStore {
+	return NewKeyStoreWithConfig(keydir, ScryptConfig(scryptN, scryptP))
+}
+
+// NewKeyStoreWithConfig creates a keystore for the given directory, encrypting
+// new keys with the given key derivation config.
+func NewKeyStoreWithConfig(keydir string, kdf KDFConfig) *KeyStore {
 	keydir, _ = filepath.Abs(keydir)
-	ks := &KeyStore{storage: &keyStorePassphrase{keydir, scryptN, scryptP}}
+	ks := &KeyStore{storage: &keyStorePassphrase{keydir, kdf}}
 	ks.init(keydir)
 	return ks
 }
@@ -427,6 +435,26 @@ func (ks *KeyStore) TimedUnlock(a accounts.Account, passphrase string, timeout t
 	return nil
 }
 
+// SetUnlockLimit sets the maximum duration accounts may be unlocked for through
+// the RPC APIs. Longer or indefinite unlock requests are capped to the limit,
+// after which the accounts are locked again automatically. A limit of 0 allows
+// any duration.
+func (ks *KeyStore) SetUnlockLimit(limit time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.unlockLimit = limit
+}
+
+// UnlockLimit returns the maximum duration accounts may be unlocked for through
+// the RPC APIs, or 0 if unlimited.
+func (ks *KeyStore) UnlockLimit() time.Duration {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.unlockLimit
+}
+
 // Find resolves the given account into a unique entry in the keystore.
 func (ks *KeyStore) Find(a accounts.Account) (accounts.Account, error) {
 	ks.cache.maybeReload()
@@ -485,13 +513,11 @@ func (ks *KeyStore) Export(a accounts.Account, passphrase, newPassphrase string)
 	if err != nil {
 		return nil, err
 	}
-	var N, P int
+	kdf := ScryptConfig(StandardScryptN, StandardScryptP)
 	if store, ok := ks.storage.(*keyStorePassphrase); ok {
-		N, P = store.scryptN, store.scryptP
-	} else {
-		N, P = StandardScryptN, StandardScryptP
+		kdf = store.kdf
 	}
-	return EncryptKey(key, newPassphrase, N, P)
+	return EncryptKeyWithConfig(key, newPassphrase, kdf)
 }
 
 // Import stores the given encrypted JSON key into the key directory.
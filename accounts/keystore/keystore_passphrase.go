@@ -41,12 +41,20 @@ import (
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/crypto/randentropy"
 	"github.com/pborman/uuid"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 )
 
 const (
-	keyHeaderKDF = "scrypt"
+	// KDFScrypt selects scrypt as the key derivation function of new key files.
+	KDFScrypt = "scrypt"
+
+	// KDFArgon2id selects Argon2id as the key derivation function of new key files.
+	KDFArgon2id = "argon2id"
+
+	keyHeaderKDF         = KDFScrypt
+	keyHeaderKDFArgon2id = KDFArgon2id
 
 	// StandardScryptN is the N parameter of Scrypt encryption algorithm, using 256MB
 	// memory and taking approximately 1s CPU time on a modern processor.
@@ -66,12 +74,91 @@ const (
 
 	scryptR     = 8
 	scryptDKLen = 32
+
+	// StandardArgon2Time, StandardArgon2Memory and StandardArgon2Threads are the
+	// Argon2id parameters recommended by RFC 9106 for memory constrained
+	// environments, using 64MB memory.
+	StandardArgon2Time    = 3
+	StandardArgon2Memory  = 64 * 1024
+	StandardArgon2Threads = 4
+
+	// LightArgon2Time, LightArgon2Memory and LightArgon2Threads are the Argon2id
+	// parameters using 4MB memory and a single pass.
+	LightArgon2Time    = 1
+	LightArgon2Memory  = 4 * 1024
+	LightArgon2Threads = 1
+
+	// maxArgon2Time, maxArgon2Memory and maxArgon2Threads bound the cost of
+	// decrypting a key file, which may come from an untrusted source. The
+	// memory limit is 4GB.
+	maxArgon2Time    = 32
+	maxArgon2Memory  = 4 * 1024 * 1024
+	maxArgon2Threads = 64
+
+	argon2DKLen    = 32
+	maxArgon2DKLen = 1024
 )
 
+// KDFConfig selects the key derivation function and its cost parameters used
+// to encrypt new key files. Key files of either kind can always be decrypted.
+type KDFConfig struct {
+	KDF string // Key derivation function, KDFScrypt (default if empty) or KDFArgon2id
+
+	ScryptN int // CPU/memory cost parameter of scrypt
+	ScryptP int // Parallelization parameter of scrypt
+
+	Argon2Time    uint32 // Number of passes over the memory
+	Argon2Memory  uint32 // Memory size in KiB
+	Argon2Threads uint8  // Degree of parallelism
+}
+
+// ScryptConfig returns a key derivation config using scrypt with the given
+// cost parameters.
+func ScryptConfig(scryptN, scryptP int) KDFConfig {
+	return KDFConfig{KDF: KDFScrypt, ScryptN: scryptN, ScryptP: scryptP}
+}
+
+// Argon2idConfig returns a key derivation config using Argon2id with the given
+// cost parameters.
+func Argon2idConfig(time, memory uint32, threads uint8) KDFConfig {
+	return KDFConfig{KDF: KDFArgon2id, Argon2Time: time, Argon2Memory: memory, Argon2Threads: threads}
+}
+
+// Validate checks that the config names a supported key derivation function
+// with sane cost parameters.
+func (c KDFConfig) Validate() error {
+	switch c.KDF {
+	case "", KDFScrypt:
+		if c.ScryptN <= 1 || c.ScryptN&(c.ScryptN-1) != 0 {
+			return fmt.Errorf("scrypt N must be a power of two larger than 1, got %d", c.ScryptN)
+		}
+		if c.ScryptP < 1 {
+			return fmt.Errorf("scrypt P must be positive, got %d", c.ScryptP)
+		}
+	case KDFArgon2id:
+		return validateArgon2(int(c.Argon2Time), int(c.Argon2Memory), int(c.Argon2Threads))
+	default:
+		return fmt.Errorf("unsupported KDF: %s", c.KDF)
+	}
+	return nil
+}
+
+func validateArgon2(time, memory, threads int) error {
+	if time < 1 || time > maxArgon2Time {
+		return fmt.Errorf("argon2 time must be between 1 and %d, got %d", maxArgon2Time, time)
+	}
+	if threads < 1 || threads > maxArgon2Threads {
+		return fmt.Errorf("argon2 threads must be between 1 and %d, got %d", maxArgon2Threads, threads)
+	}
+	if memory < 8*threads || memory > maxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be between %d and %d KiB, got %d", 8*threads, maxArgon2Memory, memory)
+	}
+	return nil
+}
+
 type keyStorePassphrase struct {
 	keysDirPath string
-	scryptN     int
-	scryptP     int
+	kdf         KDFConfig
 }
 
 func (ks keyStorePassphrase) GetKey(addr common.Address, filename, auth string) (*Key, error) {
@@ -93,12 +180,18 @@ func (ks keyStorePassphrase) GetKey(addr common.Address, filename, auth string)
 
 // StoreKey generates a key, encrypts with 'auth' and stores in the given directory
 func StoreKey(dir, auth string, scryptN, scryptP int) (common.Address, error) {
-	_, a, err := storeNewKey(&keyStorePassphrase{dir, scryptN, scryptP}, crand.Reader, auth)
+	return StoreKeyWithConfig(dir, auth, ScryptConfig(scryptN, scryptP))
+}
+
+// StoreKeyWithConfig generates a key, encrypts it with 'auth' using the given
+// key derivation config and stores it in the given directory.
+func StoreKeyWithConfig(dir, auth string, kdf KDFConfig) (common.Address, error) {
+	_, a, err := storeNewKey(&keyStorePassphrase{dir, kdf}, crand.Reader, auth)
 	return a.Address, err
 }
 
 func (ks keyStorePassphrase) StoreKey(filename string, key *Key, auth string) error {
-	keyjson, err := EncryptKey(key, auth, ks.scryptN, ks.scryptP)
+	keyjson, err := EncryptKeyWithConfig(key, auth, ks.kdf)
 	if err != nil {
 		return err
 	}
@@ -115,12 +208,43 @@ func (ks keyStorePassphrase) JoinPath(filename string) string {
 // EncryptKey encrypts a key using the specified scrypt parameters into a json
 // blob that can be decrypted later on.
 func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
+	return EncryptKeyWithConfig(key, auth, ScryptConfig(scryptN, scryptP))
+}
+
+// EncryptKeyWithConfig encrypts a key using the specified key derivation config
+// into a json blob that can be decrypted later on.
+func EncryptKeyWithConfig(key *Key, auth string, kdf KDFConfig) ([]byte, error) {
+	if err := kdf.Validate(); err != nil {
+		return nil, err
+	}
 	authArray := []byte(auth)
 	salt := randentropy.GetEntropyCSPRNG(32)
-	derivedKey, err := scrypt.Key(authArray, salt, scryptN, scryptR, scryptP, scryptDKLen)
-	if err != nil {
-		return nil, err
+
+	var (
+		derivedKey []byte
+		kdfName    string
+		kdfParams  = make(map[string]interface{}, 5)
+	)
+	if kdf.KDF == KDFArgon2id {
+		derivedKey = argon2.IDKey(authArray, salt, kdf.Argon2Time, kdf.Argon2Memory, kdf.Argon2Threads, argon2DKLen)
+		kdfName = keyHeaderKDFArgon2id
+		kdfParams["t"] = kdf.Argon2Time
+		kdfParams["m"] = kdf.Argon2Memory
+		kdfParams["p"] = kdf.Argon2Threads
+		kdfParams["dklen"] = argon2DKLen
+	} else {
+		var err error
+		if derivedKey, err = scrypt.Key(authArray, salt, kdf.ScryptN, scryptR, kdf.ScryptP, scryptDKLen); err != nil {
+			return nil, err
+		}
+		kdfName = keyHeaderKDF
+		kdfParams["n"] = kdf.ScryptN
+		kdfParams["r"] = scryptR
+		kdfParams["p"] = kdf.ScryptP
+		kdfParams["dklen"] = scryptDKLen
 	}
+	kdfParams["salt"] = hex.EncodeToString(salt)
+
 	encryptKey := derivedKey[:16]
 	keyBytes := math.PaddedBigBytes(key.PrivateKey.D, 32)
 
@@ -131,13 +255,6 @@ func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
 	}
 	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
 
-	scryptParamsJSON := make(map[string]interface{}, 5)
-	scryptParamsJSON["n"] = scryptN
-	scryptParamsJSON["r"] = scryptR
-	scryptParamsJSON["p"] = scryptP
-	scryptParamsJSON["dklen"] = scryptDKLen
-	scryptParamsJSON["salt"] = hex.EncodeToString(salt)
-
 	cipherParamsJSON := cipherparamsJSON{
 		IV: hex.EncodeToString(iv),
 	}
@@ -146,8 +263,8 @@ func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
 		Cipher:       "aes-128-ctr",
 		CipherText:   hex.EncodeToString(cipherText),
 		CipherParams: cipherParamsJSON,
-		KDF:          keyHeaderKDF,
-		KDFParams:    scryptParamsJSON,
+		KDF:          kdfName,
+		KDFParams:    kdfParams,
 		MAC:          hex.EncodeToString(mac),
 	}
 	encryptedKeyJSONV3 := encryptedKeyJSONV3{
@@ -287,6 +404,18 @@ func getKDFKey(cryptoJSON cryptoJSON, auth string) ([]byte, error) {
 		p := ensureInt(cryptoJSON.KDFParams["p"])
 		return scrypt.Key(authArray, salt, n, r, p, dkLen)
 
+	} else if cryptoJSON.KDF == keyHeaderKDFArgon2id {
+		t := ensureInt(cryptoJSON.KDFParams["t"])
+		m := ensureInt(cryptoJSON.KDFParams["m"])
+		p := ensureInt(cryptoJSON.KDFParams["p"])
+		if err := validateArgon2(t, m, p); err != nil {
+			return nil, err
+		}
+		if dkLen < argon2DKLen || dkLen > maxArgon2DKLen {
+			return nil, fmt.Errorf("argon2 dklen must be between %d and %d, got %d", argon2DKLen, maxArgon2DKLen, dkLen)
+		}
+		return argon2.IDKey(authArray, salt, uint32(t), uint32(m), uint8(p), uint32(dkLen)), nil
+
 	} else if cryptoJSON.KDF == "pbkdf2" {
 		c := ensureInt(cryptoJSON.KDFParams["c"])
 		prf := cryptoJSON.KDFParams["prf"].(string)
@@ -17,6 +17,7 @@
 package keystore
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"testing"
 
@@ -58,3 +59,51 @@ func TestKeyEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that keys can be moved between scrypt and Argon2id encryption, with
+// both formats being decrypted transparently.
+func TestKeyEncryptDecryptArgon2id(t *testing.T) {
+	keyjson, err := ioutil.ReadFile("testdata/very-light-scrypt.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecryptKey(keyjson, "")
+	if err != nil {
+		t.Fatalf("json key failed to decrypt: %v", err)
+	}
+	if keyjson, err = EncryptKeyWithConfig(key, "argon", Argon2idConfig(1, 64, 2)); err != nil {
+		t.Fatalf("failed to encrypt key with argon2id: %v", err)
+	}
+	if _, err := DecryptKey(keyjson, "bad"); err != ErrDecrypt {
+		t.Errorf("argon2id key decrypted with bad password: %v", err)
+	}
+	decrypted, err := DecryptKey(keyjson, "argon")
+	if err != nil {
+		t.Fatalf("argon2id key failed to decrypt: %v", err)
+	}
+	if decrypted.Address != key.Address {
+		t.Errorf("key address mismatch: have %x, want %x", decrypted.Address, key.Address)
+	}
+	for _, config := range []KDFConfig{
+		Argon2idConfig(0, 64, 1),
+		Argon2idConfig(maxArgon2Time+1, 64, 1),
+		Argon2idConfig(1, maxArgon2Memory+1, 1),
+		Argon2idConfig(1, 64*1024, maxArgon2Threads+1),
+	} {
+		if _, err := EncryptKeyWithConfig(key, "", config); err == nil {
+			t.Errorf("encrypted key with invalid argon2id parameters %+v", config)
+		}
+	}
+	// Key files with a short derived key must be rejected rather than sliced
+	var k encryptedKeyJSONV3
+	if err := json.Unmarshal(keyjson, &k); err != nil {
+		t.Fatal(err)
+	}
+	k.Crypto.KDFParams["dklen"] = 16
+	if _, err := getKDFKey(k.Crypto, "argon"); err == nil {
+		t.Errorf("derived argon2id key with a short dklen")
+	}
+	if _, err := EncryptKeyWithConfig(key, "", KDFConfig{KDF: "pbkdf2"}); err == nil {
+		t.Errorf("encrypted key with unsupported KDF")
+	}
+}
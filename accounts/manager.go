@@ -34,6 +34,8 @@ type Manager struct {
 
 	feed event.Feed // Wallet feed notifying of arrivals/departures
 
+	audit *AuditLog // Optional audit log of unlocks and signing requests
+
 	quit chan chan error
 	lock sync.RWMutex
 }
@@ -74,7 +76,33 @@ func NewManager(backends ...Backend) *Manager {
 func (am *Manager) Close() error {
 	errc := make(chan error)
 	am.quit <- errc
-	return <-errc
+	err := <-errc
+
+	am.lock.Lock()
+	if cerr := am.audit.Close(); err == nil {
+		err = cerr
+	}
+	am.audit = nil
+	am.lock.Unlock()
+	return err
+}
+
+// SetAuditLog sets the log that unlocks and signing requests made through the
+// manager's users are recorded in.
+func (am *Manager) SetAuditLog(audit *AuditLog) {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	am.audit = audit
+}
+
+// AuditLog returns the audit log of the manager, or nil if auditing is not
+// enabled. Recording into a nil audit log is a no-op.
+func (am *Manager) AuditLog() *AuditLog {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
+	return am.audit
 }
 
 // update is the wallet event loop listening for notifications from the backends
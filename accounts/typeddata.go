@@ -0,0 +1,423 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package accounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/common/math"
+	"github.com/matrix/go-matrix/crypto"
+)
+
+// TypedData is a type to encapsulate EIP-712 typed messages.
+type TypedData struct {
+	Types       Types            `json:"types"`
+	PrimaryType string           `json:"primaryType"`
+	Domain      TypedDataDomain  `json:"domain"`
+	Message     TypedDataMessage `json:"message"`
+}
+
+// Type is the inner type of an EIP-712 message.
+type Type struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types maps struct names to their ordered member definitions.
+type Types map[string][]Type
+
+// TypedDataMessage is the decoded content of a typed struct.
+type TypedDataMessage = map[string]interface{}
+
+// TypedDataDomain represents the domain part of an EIP-712 message, used to
+// separate signatures of different DApps, contract versions and chains.
+type TypedDataDomain struct {
+	Name              string                `json:"name"`
+	Version           string                `json:"version"`
+	ChainId           *math.HexOrDecimal256 `json:"chainId"`
+	VerifyingContract string                `json:"verifyingContract"`
+	Salt              string                `json:"salt"`
+}
+
+var typedDataTypeNameRegexp = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// typedDataDomainType is the name of the struct type describing the domain.
+const typedDataDomainType = "EIP712Domain"
+
+// TypedDataAndHash returns the digest to sign for the given typed data, along
+// with the raw bytes it was derived from:
+//
+//	keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+func TypedDataAndHash(typedData TypedData) ([]byte, string, error) {
+	if err := typedData.validate(); err != nil {
+		return nil, "", err
+	}
+	domainSeparator, err := typedData.HashStruct(typedDataDomainType, typedData.Domain.Map())
+	if err != nil {
+		return nil, "", err
+	}
+	typedDataHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, "", err
+	}
+	rawData := fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(typedDataHash))
+	return crypto.Keccak256([]byte(rawData)), rawData, nil
+}
+
+// RecoverTypedData returns the address of the account that produced the given
+// signature over the typed data. The V value of the signature may be 0/1 or the
+// legacy 27/28.
+func RecoverTypedData(typedData TypedData, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, errors.New("signature must be 65 bytes long")
+	}
+	sighash, _, err := TypedDataAndHash(typedData)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sig = common.CopyBytes(sig)
+	if sig[64] >= 27 {
+		sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	}
+	if sig[64] > 1 {
+		return common.Address{}, errors.New("invalid signature recovery id")
+	}
+	pubkey, err := crypto.SigToPub(sighash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// VerifyTypedData checks that the signature over the typed data was produced
+// by the given address.
+func VerifyTypedData(typedData TypedData, sig []byte, addr common.Address) error {
+	signer, err := RecoverTypedData(typedData, sig)
+	if err != nil {
+		return err
+	}
+	if signer != addr {
+		return fmt.Errorf("signer mismatch: expected %s, got %s", addr.Hex(), signer.Hex())
+	}
+	return nil
+}
+
+// HashStruct generates a keccak256 hash of the encoding of the provided data.
+func (typedData *TypedData) HashStruct(primaryType string, data TypedDataMessage) (hexutil.Bytes, error) {
+	encodedData, err := typedData.EncodeData(primaryType, data, 1)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(encodedData), nil
+}
+
+// Dependencies returns an array of custom types ordered by their hierarchical
+// reference tree, starting with the requested type itself.
+func (typedData *TypedData) Dependencies(primaryType string, found []string) []string {
+	primaryType = strings.TrimSuffix(primaryType, "[]")
+	if i := strings.Index(primaryType, "["); i >= 0 {
+		primaryType = primaryType[:i]
+	}
+	for _, name := range found {
+		if name == primaryType {
+			return found
+		}
+	}
+	if typedData.Types[primaryType] == nil {
+		return found
+	}
+	found = append(found, primaryType)
+	for _, field := range typedData.Types[primaryType] {
+		found = typedData.Dependencies(field.Type, found)
+	}
+	return found
+}
+
+// EncodeType generates the following encoding:
+// `name ‖ "(" ‖ member₁ ‖ "," ‖ member₂ ‖ "," ‖ … ‖ memberₙ ")"`, with the
+// referenced struct types appended in alphabetical order.
+func (typedData *TypedData) EncodeType(primaryType string) hexutil.Bytes {
+	deps := typedData.Dependencies(primaryType, nil)
+	if len(deps) > 0 {
+		sort.Strings(deps[1:])
+	}
+	var buffer bytes.Buffer
+	for _, dep := range deps {
+		buffer.WriteString(dep)
+		buffer.WriteString("(")
+		for i, field := range typedData.Types[dep] {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(field.Type)
+			buffer.WriteString(" ")
+			buffer.WriteString(field.Name)
+		}
+		buffer.WriteString(")")
+	}
+	return buffer.Bytes()
+}
+
+// TypeHash creates the keccak256 hash of the type encoding of the given type.
+func (typedData *TypedData) TypeHash(primaryType string) hexutil.Bytes {
+	return crypto.Keccak256(typedData.EncodeType(primaryType))
+}
+
+// EncodeData generates the following encoding:
+// `enc(value₁) ‖ enc(value₂) ‖ … ‖ enc(valueₙ)`, prefixed with the type hash.
+// Each encoded member is 32 bytes long.
+func (typedData *TypedData) EncodeData(primaryType string, data TypedDataMessage, depth int) (hexutil.Bytes, error) {
+	fields, ok := typedData.Types[primaryType]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", primaryType)
+	}
+	if len(fields) < len(data) {
+		return nil, fmt.Errorf("there is extra data provided in the message (%d < %d)", len(fields), len(data))
+	}
+	buffer := bytes.Buffer{}
+	buffer.Write(typedData.TypeHash(primaryType))
+
+	for _, field := range fields {
+		encValue, err := typedData.encodeValue(field.Type, data[field.Name], depth)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", field.Name, err)
+		}
+		buffer.Write(encValue)
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodeValue encodes a single struct member of the given type into 32 bytes.
+func (typedData *TypedData) encodeValue(encType string, value interface{}, depth int) ([]byte, error) {
+	if depth > 32 {
+		return nil, errors.New("typed data nested too deeply")
+	}
+	// Arrays are encoded as the hash of their concatenated encoded items
+	if strings.HasSuffix(encType, "]") {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected array, got %T", value)
+		}
+		itemType := encType[:strings.LastIndex(encType, "[")]
+		var buffer bytes.Buffer
+		for _, item := range items {
+			encItem, err := typedData.encodeValue(itemType, item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			buffer.Write(encItem)
+		}
+		return crypto.Keccak256(buffer.Bytes()), nil
+	}
+	// Referenced structs are encoded as their struct hash
+	if typedData.Types[encType] != nil {
+		mapValue, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected struct %s, got %T", encType, value)
+		}
+		encData, err := typedData.EncodeData(encType, mapValue, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(encData), nil
+	}
+	return encodePrimitiveValue(encType, value)
+}
+
+// encodePrimitiveValue encodes an atomic or dynamic primitive value.
+func encodePrimitiveValue(encType string, value interface{}) ([]byte, error) {
+	switch encType {
+	case "address":
+		str, ok := value.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return nil, fmt.Errorf("invalid address %v", value)
+		}
+		return common.LeftPadBytes(common.HexToAddress(str).Bytes(), 32), nil
+
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid bool %v", value)
+		}
+		if b {
+			return math.PaddedBigBytes(common.Big1, 32), nil
+		}
+		return math.PaddedBigBytes(common.Big0, 32), nil
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid string %v", value)
+		}
+		return crypto.Keccak256([]byte(str)), nil
+
+	case "bytes":
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(blob), nil
+	}
+	if strings.HasPrefix(encType, "bytes") {
+		size, err := strconv.Atoi(encType[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("invalid type %q", encType)
+		}
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(blob) != size {
+			return nil, fmt.Errorf("invalid %s length %d", encType, len(blob))
+		}
+		return common.RightPadBytes(blob, 32), nil
+	}
+	if strings.HasPrefix(encType, "int") || strings.HasPrefix(encType, "uint") {
+		signed := strings.HasPrefix(encType, "int")
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(encType, "u"), "int"))
+		if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+			return nil, fmt.Errorf("invalid type %q", encType)
+		}
+		num, err := parseInteger(value)
+		if err != nil {
+			return nil, err
+		}
+		if !signed && (num.Sign() < 0 || num.BitLen() > bits) {
+			return nil, fmt.Errorf("integer %v overflows %s", num, encType)
+		}
+		if signed {
+			bound := num
+			if num.Sign() < 0 {
+				bound = new(big.Int).Not(num) // -num-1, the magnitude the bits must hold
+			}
+			if bound.BitLen() > bits-1 {
+				return nil, fmt.Errorf("integer %v overflows %s", num, encType)
+			}
+		}
+		return math.PaddedBigBytes(math.U256(num), 32), nil
+	}
+	return nil, fmt.Errorf("unrecognized type %q", encType)
+}
+
+// parseBytes converts a hex string or byte slice message field into bytes.
+func parseBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case hexutil.Bytes:
+		return v, nil
+	case string:
+		return hexutil.Decode(v)
+	}
+	return nil, fmt.Errorf("invalid bytes %v", value)
+}
+
+// parseInteger converts a decimal or hex string, or a JSON number, message field
+// into an integer.
+func parseInteger(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		return new(big.Int).Set(v), nil
+	case string:
+		if num, ok := new(big.Int).SetString(v, 0); ok {
+			return num, nil
+		}
+	case float64:
+		if num, acc := big.NewFloat(v).Int(nil); acc == big.Exact {
+			return num, nil
+		}
+	case int64:
+		return big.NewInt(v), nil
+	}
+	return nil, fmt.Errorf("invalid integer %v", value)
+}
+
+// validate checks that the types are well formed and the domain and primary
+// types are defined.
+func (typedData *TypedData) validate() error {
+	if _, ok := typedData.Types[typedDataDomainType]; !ok {
+		return fmt.Errorf("missing %s type", typedDataDomainType)
+	}
+	if _, ok := typedData.Types[typedData.PrimaryType]; !ok {
+		return fmt.Errorf("primary type %q not defined", typedData.PrimaryType)
+	}
+	for name, fields := range typedData.Types {
+		if !typedDataTypeNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid type name %q", name)
+		}
+		for _, field := range fields {
+			if field.Name == "" || field.Type == "" {
+				return fmt.Errorf("type %q has unnamed or untyped member", name)
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the domain, accepting the chain ID both as a JSON number
+// and as a decimal or hex string.
+func (domain *TypedDataDomain) UnmarshalJSON(input []byte) error {
+	type typedDataDomain TypedDataDomain
+	var dec struct {
+		typedDataDomain
+		ChainId json.RawMessage `json:"chainId"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*domain = TypedDataDomain(dec.typedDataDomain)
+	if len(dec.ChainId) > 0 && string(dec.ChainId) != "null" {
+		chainID := new(math.HexOrDecimal256)
+		if err := chainID.UnmarshalText(bytes.Trim(dec.ChainId, `"`)); err != nil {
+			return fmt.Errorf("invalid chainId: %v", err)
+		}
+		domain.ChainId = chainID
+	}
+	return nil
+}
+
+// Map converts the domain into the message form used for hashing, including
+// only the fields that are set.
+func (domain *TypedDataDomain) Map() TypedDataMessage {
+	data := TypedDataMessage{}
+	if domain.ChainId != nil {
+		data["chainId"] = (*big.Int)(domain.ChainId)
+	}
+	if domain.Name != "" {
+		data["name"] = domain.Name
+	}
+	if domain.Version != "" {
+		data["version"] = domain.Version
+	}
+	if domain.VerifyingContract != "" {
+		data["verifyingContract"] = domain.VerifyingContract
+	}
+	if domain.Salt != "" {
+		data["salt"] = domain.Salt
+	}
+	return data
+}
@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 
 	"github.com/matrix/go-matrix/accounts"
@@ -46,6 +47,15 @@ var ErrTrezorPINNeeded = errors.New("trezor: pin needed")
 // is in browser mode.
 var errTrezorReplyInvalidHeader = errors.New("trezor: invalid reply header")
 
+// errTrezorExtraUnsupported is returned if a MATRIX extended transaction is sent
+// to a Trezor for signing. The firmware only streams the standard fields, so it
+// would sign a hash different from the one the network verifies.
+var errTrezorExtraUnsupported = errors.New("trezor: extended transactions not supported")
+
+// errTrezorChainIDTooLarge is returned if the requested chain ID does not fit
+// into the 32 bit field of the Trezor signing protocol.
+var errTrezorChainIDTooLarge = errors.New("trezor: chain ID exceeds 32 bits")
+
 // trezorDriver implements the communication with a Trezor hardware wallet.
 type trezorDriver struct {
 	device  io.ReadWriter // USB device connection to communicate through
@@ -172,6 +182,15 @@ func (w *trezorDriver) trezorDerive(derivationPath []uint32) (common.Address, er
 // trezorSign sends the transaction to the Trezor wallet, and waits for the user
 // to confirm or deny the transaction.
 func (w *trezorDriver) trezorSign(derivationPath []uint32, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error) {
+	// Reject anything the device cannot faithfully sign
+	if chainID != nil {
+		if len(tx.GetMatrix_EX()) > 0 {
+			return common.Address{}, nil, errTrezorExtraUnsupported
+		}
+		if !chainID.IsUint64() || chainID.Uint64() > math.MaxUint32 {
+			return common.Address{}, nil, errTrezorChainIDTooLarge
+		}
+	}
 	// Create the transaction initiation message
 	data := tx.Data()
 	length := uint32(len(data))
@@ -192,8 +211,8 @@ func (w *trezorDriver) trezorSign(derivationPath []uint32, tx *types.Transaction
 	} else {
 		request.DataInitialChunk, data = data, nil
 	}
-	if chainID != nil { // EIP-155 transaction, set chain ID explicitly (only 32 bit is supported!?)
-		id := uint32(chainID.Int64())
+	if chainID != nil { // EIP-155 transaction, set chain ID explicitly (only 32 bit is supported)
+		id := uint32(chainID.Uint64())
 		request.ChainId = &id
 	}
 	// Send the initiation message and stream content until a signature is returned
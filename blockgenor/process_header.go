@@ -69,7 +69,7 @@ func (p *Process) processHeaderGen() error {
 		ParentHash:  parent.Hash(),
 		Leader:      ca.GetAddress(),
 		Number:      new(big.Int).SetUint64(p.number),
-		GasLimit:    core.CalcGasLimit(parent),
+		GasLimit:    p.calcGasLimit(parent),
 		Extra:       make([]byte, 0),
 		Time:        big.NewInt(tstamp),
 		Elect:       Elect,
@@ -168,6 +168,7 @@ func (p *Process) processHeaderGen() error {
 		}*/
 		log.INFO(p.logExtraInfo(), "区块验证请求生成，交易部分", "完成创建work, 开始执行交易")
 
+		work.SetOrdering(p.backend().MinerTxOrdering())
 		txsCode, Txs := work.ProcessTransactions(p.pm.matrix.EventMux(), p.pm.txPool, p.pm.bc)
 		log.INFO(p.logExtraInfo(), "区块验证请求生成，交易部分", "完成执行交易, 开始finalize")
 		log.INFO("processHeaderGen", "问题定位", "step7")
@@ -194,6 +195,15 @@ func (p *Process) processHeaderGen() error {
 	return nil
 }
 
+// calcGasLimit computes the gas limit of the block to generate on top of
+// parent, honing in on the configured target if the operator set one.
+func (p *Process) calcGasLimit(parent *types.Block) uint64 {
+	if target := p.backend().MinerGasLimit(); target > 0 {
+		return core.CalcGasLimitTarget(parent, target)
+	}
+	return core.CalcGasLimit(parent)
+}
+
 func (p *Process) getParentBlock() (*types.Block, error) {
 	if p.number == 1 { // 第一个块直接返回创世区块作为父区块
 		return p.blockChain().Genesis(), nil
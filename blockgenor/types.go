@@ -24,6 +24,7 @@ import (
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/hd"
+	"github.com/matrix/go-matrix/matrixwork"
 	"github.com/matrix/go-matrix/reelection"
 	"math/big"
 )
@@ -69,4 +70,6 @@ type Backend interface {
 	HD() *hd.HD
 	ReElection() *reelection.ReElection
 	FetcherNotify(hash common.Hash, number uint64)
+	MinerGasLimit() uint64
+	MinerTxOrdering() matrixwork.OrderingPolicy
 }
@@ -186,9 +186,9 @@ func doInstall(cmdline []string) {
 		var minor int
 		fmt.Sscanf(strings.TrimPrefix(runtime.Version(), "go1."), "%d", &minor)
 
-		if minor < 9 {
+		if minor < 18 {
 			log.Println("You have Go version", runtime.Version())
-			log.Println("go-matrix requires at least Go version 1.9 and cannot")
+			log.Println("go-matrix requires at least Go version 1.18 and cannot")
 			log.Println("be compiled with an earlier version. Please upgrade your Go installation.")
 			os.Exit(1)
 		}
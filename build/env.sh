@@ -22,6 +22,10 @@ fi
 GOPATH="$workspace"
 export GOPATH
 
+# The workspace is a GOPATH tree, keep module mode off on Go 1.16 and later.
+GO111MODULE=off
+export GO111MODULE
+
 # Run the command inside the workspace.
 cd "$ethdir/go-matrix"
 PWD="$ethdir/go-matrix"
@@ -93,6 +93,10 @@ type Identity struct {
 
 var ide = newIde()
 
+// errNoDatabase is returned by the topology queries if Start was never called,
+// as happens for chains run in-process without a node.
+var errNoDatabase = errors.New("identity database not opened")
+
 func newIde() *Identity {
 	return &Identity{
 		quit:        make(chan struct{}),
@@ -571,6 +575,9 @@ func GetSelfLevel() int {
 
 // GetTopologyByNumber
 func GetTopologyByNumber(reqTypes common.RoleType, number uint64) (*mc.TopologyGraph, error) {
+	if ide.ldb == nil {
+		return nil, errNoDatabase
+	}
 	tgBytes := append(big.NewInt(int64(number)).Bytes(), []byte(LevelDBTopologyGraph)...)
 	val, err := ide.ldb.Get(tgBytes, nil)
 	if err != nil {
@@ -606,6 +613,9 @@ func GetTopologyByNumber(reqTypes common.RoleType, number uint64) (*mc.TopologyG
 
 // GetAccountTopologyInfo
 func GetAccountTopologyInfo(account common.Address, number uint64) (*mc.TopologyNodeInfo, error) {
+	if ide.ldb == nil {
+		return nil, errNoDatabase
+	}
 	tgBytes := append(big.NewInt(int64(number)).Bytes(), []byte(LevelDBTopologyGraph)...)
 	val, err := ide.ldb.Get(tgBytes, nil)
 	if err != nil {
@@ -633,6 +643,9 @@ func GetAccountOriginalRole(account common.Address, number uint64) (common.RoleT
 			return common.RoleBroadcast, nil
 		}
 	}
+	if ide.ldb == nil {
+		return common.RoleNil, errNoDatabase
+	}
 	orBytes := append(big.NewInt(int64(number)).Bytes(), []byte(LevelDBOriginalRole)...)
 	val, err := ide.ldb.Get(orBytes, nil)
 	if err != nil {
@@ -54,6 +54,12 @@ passwordfile as argument containing the wallet password in plaintext.`,
 					utils.KeyStoreDirFlag,
 					utils.PasswordFileFlag,
 					utils.LightKDFFlag,
+					utils.KeyStoreKDFFlag,
+					utils.KeyStoreScryptNFlag,
+					utils.KeyStoreScryptPFlag,
+					utils.KeyStoreArgon2TimeFlag,
+					utils.KeyStoreArgon2MemoryFlag,
+					utils.KeyStoreArgon2ThreadsFlag,
 				},
 				Description: `
 	gman wallet [options] /path/to/my/presale.wallet
@@ -110,6 +116,12 @@ Print a short summary of all accounts`,
 					utils.KeyStoreDirFlag,
 					utils.PasswordFileFlag,
 					utils.LightKDFFlag,
+					utils.KeyStoreKDFFlag,
+					utils.KeyStoreScryptNFlag,
+					utils.KeyStoreScryptPFlag,
+					utils.KeyStoreArgon2TimeFlag,
+					utils.KeyStoreArgon2MemoryFlag,
+					utils.KeyStoreArgon2ThreadsFlag,
 				},
 				Description: `
     gman account new
@@ -135,6 +147,12 @@ password to file or expose in any other way.
 					utils.DataDirFlag,
 					utils.KeyStoreDirFlag,
 					utils.LightKDFFlag,
+					utils.KeyStoreKDFFlag,
+					utils.KeyStoreScryptNFlag,
+					utils.KeyStoreScryptPFlag,
+					utils.KeyStoreArgon2TimeFlag,
+					utils.KeyStoreArgon2MemoryFlag,
+					utils.KeyStoreArgon2ThreadsFlag,
 				},
 				Description: `
     gman account update <address>
@@ -164,6 +182,12 @@ changing your password is only possible interactively.
 					utils.KeyStoreDirFlag,
 					utils.PasswordFileFlag,
 					utils.LightKDFFlag,
+					utils.KeyStoreKDFFlag,
+					utils.KeyStoreScryptNFlag,
+					utils.KeyStoreScryptPFlag,
+					utils.KeyStoreArgon2TimeFlag,
+					utils.KeyStoreArgon2MemoryFlag,
+					utils.KeyStoreArgon2ThreadsFlag,
 				},
 				ArgsUsage: "<keyFile>",
 				Description: `
@@ -299,15 +323,18 @@ func accountCreate(ctx *cli.Context) error {
 		}
 	}
 	utils.SetNodeConfig(ctx, &cfg.Node)
-	scryptN, scryptP, keydir, err := cfg.Node.AccountConfig()
-
+	_, _, keydir, err := cfg.Node.AccountConfig()
+	if err != nil {
+		utils.Fatalf("Failed to read configuration: %v", err)
+	}
+	kdf, err := cfg.Node.KDFConfig()
 	if err != nil {
 		utils.Fatalf("Failed to read configuration: %v", err)
 	}
 
 	password := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
 
-	address, err := keystore.StoreKey(keydir, password, scryptN, scryptP)
+	address, err := keystore.StoreKeyWithConfig(keydir, password, kdf)
 
 	if err != nil {
 		utils.Fatalf("Failed to create account: %v", err)
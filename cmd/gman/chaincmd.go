@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync/atomic"
@@ -27,19 +28,53 @@ import (
 
 	"github.com/matrix/go-matrix/cmd/utils"
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/console"
 	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/rpc"
 	"github.com/matrix/go-matrix/trie"
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
 )
 
+var (
+	exportFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to export",
+	}
+	exportToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to export (default = head block)",
+	}
+	reindexFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to rebuild the transaction lookup entries of",
+	}
+	reindexToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to rebuild the transaction lookup entries of (default = head block)",
+	}
+	dumpFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: `State dump format ("json", "jsonl" streaming one account per line, or "csv")`,
+		Value: "json",
+	}
+	dumpNoCodeFlag = cli.BoolFlag{
+		Name:  "nocode",
+		Usage: "Exclude contract code from streamed state dumps",
+	}
+	dumpNoStorageFlag = cli.BoolFlag{
+		Name:  "nostorage",
+		Usage: "Exclude contract storage from streamed state dumps",
+	}
+)
+
 var (
 	initCommand = cli.Command{
 		Action:    utils.MigrateFlags(initGenesis),
@@ -56,7 +91,25 @@ The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
 
-It expects the genesis file as argument.`,
+It expects the genesis file as argument. The MATRIX election fields (elected
+nodes, network topology and leader) or, for proof-of-authority networks, the
+signer list are validated before anything is written.`,
+	}
+	dumpGenesisCommand = cli.Command{
+		Action:    utils.MigrateFlags(dumpGenesis),
+		Name:      "dumpgenesis",
+		Usage:     "Dumps genesis block JSON configuration to stdout",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.TestnetFlag,
+			utils.RinkebyFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The dumpgenesis command dumps the genesis specification of the selected built-in
+network, or the one the local database was initialised with, in JSON format.
+The output can be fed back to "gman init".`,
 	}
 	importCommand = cli.Command{
 		Action:    utils.MigrateFlags(importChain),
@@ -70,6 +123,18 @@ It expects the genesis file as argument.`,
 			utils.GCModeFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
+			utils.CacheNoPreimagesFlag,
+			utils.CacheNoPrefetchFlag,
+			utils.SnapshotFlag,
+			utils.SenderTxIndexFlag,
+			utils.ReceiptExtrasFlag,
+			utils.OverrideHomesteadFlag,
+			utils.OverrideEIP150Flag,
+			utils.OverrideEIP155Flag,
+			utils.OverrideEIP158Flag,
+			utils.OverrideByzantiumFlag,
+			utils.OverrideConstantinopleFlag,
+			utils.OverrideVMUpgradesFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -88,13 +153,17 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 			utils.DataDirFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
+			exportFromFlag,
+			exportToFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 Requires a first argument of the file to write to.
-Optional second and third arguments control the first and
-last block to write. In this mode, the file will be appended
-if already existing.`,
+Optional second and third arguments, or the --from and --to
+flags, control the first and last block to write. In this mode,
+the file will be appended if already existing, and an interrupted
+export resumes from its last checkpoint when rerun with the same
+range. If the file ends with .gz, the output will be gzipped.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -163,11 +232,95 @@ Remove blockchain and state databases`,
 			utils.DataDirFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
+			dumpFormatFlag,
+			dumpNoCodeFlag,
+			dumpNoStorageFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 The arguments are interpreted as block numbers or hashes.
-Use "matrix dump 0" to dump the genesis block.`,
+Use "matrix dump 0" to dump the genesis block.
+
+The jsonl and csv formats stream the accounts in state trie order with sorted
+storage, so dumps taken on different nodes can be compared with diff.`,
+	}
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "verify-state",
+				Usage:     "Verify the integrity of the state trie of a block",
+				ArgsUsage: "[<blockHash> | <blockNum>]",
+				Action:    utils.MigrateFlags(verifyState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+The verify-state command walks the entire state of the given block (or the head
+block if none is specified), including all contract storage tries and codes, and
+reports every missing or corrupted trie node.`,
+			},
+			{
+				Name:      "compact",
+				Usage:     "Compact the chain database",
+				ArgsUsage: "[<start> <limit>]",
+				Action:    utils.MigrateFlags(compactDB),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+The compact command flattens the chain database, discarding the space held by
+deleted and overwritten entries. Without arguments the entire key space is
+compacted, otherwise only the range between the hex encoded start (inclusive)
+and limit (exclusive) keys.`,
+			},
+			{
+				Name:      "backup",
+				Usage:     "Take a point-in-time copy of the chain database",
+				ArgsUsage: "<dir>",
+				Action:    utils.MigrateFlags(backupDB),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+					utils.IPCPathFlag,
+					utils.FreezerFlag,
+					utils.AncientFlag,
+				},
+				Description: `
+The backup command writes a consistent copy of the chain database (and of the
+ancient store, if any) into the given directory, which must be empty or not
+exist yet. If a node is running on the data directory, the backup is taken by
+it through the IPC endpoint without interrupting it, otherwise the database is
+opened read-only. The backup can be used as a replacement chaindata folder.`,
+			},
+			{
+				Name:      "reindex",
+				Usage:     "Rebuild the transaction lookup index",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(reindexTxs),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.TxLookupLimitFlag,
+					reindexFromFlag,
+					reindexToFlag,
+				},
+				Description: `
+The reindex command rewrites the transaction hash to block lookup entries of the
+canonical blocks between --from and --to (inclusive, defaulting to the entire
+chain), repairing corrupted or missing entries without a resync. If --txlookuplimit
+is given, only the entries of the most recent blocks are kept and the entries of
+all older blocks are removed.`,
+			},
+		},
 	}
 )
 
@@ -189,10 +342,13 @@ func initGenesis(ctx *cli.Context) error {
 	if err := json.NewDecoder(file).Decode(genesis); err != nil {
 		utils.Fatalf("invalid genesis file: %v", err)
 	}
+	if err := genesis.Validate(); err != nil {
+		utils.Fatalf("invalid genesis file: %v", err)
+	}
 	// Open an initialise both full and light databases
 	stack := makeFullNode(ctx)
 	for _, name := range []string{"chaindata", "lightchaindata"} {
-		chaindb, err := stack.OpenDatabase(name, 0, 0)
+		chaindb, err := stack.OpenDatabase(name, 0, 0, false)
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
@@ -205,12 +361,32 @@ func initGenesis(ctx *cli.Context) error {
 	return nil
 }
 
+func dumpGenesis(ctx *cli.Context) error {
+	genesis := utils.MakeGenesis(ctx)
+	if genesis == nil {
+		stack := makeFullNode(ctx)
+		db := utils.MakeChainDatabase(ctx, stack, true)
+		defer db.Close()
+
+		var err error
+		if genesis, err = core.ReadGenesis(db); err != nil {
+			utils.Fatalf("Failed to read genesis: %v", err)
+		}
+	}
+	out, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode genesis: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
 func importChain(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	chain, chainDb := utils.MakeChain(ctx, stack)
+	chain, chainDb := utils.MakeChain(ctx, stack, false)
 	defer chainDb.Close()
 
 	// Start periodically gathering memory profiles
@@ -246,19 +422,7 @@ func importChain(ctx *cli.Context) error {
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
-	db := chainDb.(*mandb.LDBDatabase)
-
-	stats, err := db.LDB().GetProperty("leveldb.stats")
-	if err != nil {
-		utils.Fatalf("Failed to read database stats: %v", err)
-	}
-	fmt.Println(stats)
-
-	ioStats, err := db.LDB().GetProperty("leveldb.iostats")
-	if err != nil {
-		utils.Fatalf("Failed to read database iostats: %v", err)
-	}
-	fmt.Println(ioStats)
+	showLeveldbStats(chainDb)
 
 	fmt.Printf("Trie cache misses:  %d\n", trie.CacheMisses())
 	fmt.Printf("Trie cache unloads: %d\n\n", trie.CacheUnloads())
@@ -279,24 +443,34 @@ func importChain(ctx *cli.Context) error {
 	// Compact the entire database to more accurately measure disk io and print the stats
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = db.LDB().CompactRange(util.Range{}); err != nil {
+	if err := chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
 
-	stats, err = db.LDB().GetProperty("leveldb.stats")
+	showLeveldbStats(chainDb)
+	return nil
+}
+
+// showLeveldbStats prints the internal statistics of a LevelDB backed chain
+// database. Other database engines don't expose them and are skipped.
+func showLeveldbStats(chainDb mandb.Database) {
+	db, ok := chainDb.(*mandb.LDBDatabase)
+	if !ok {
+		fmt.Printf("Database statistics unavailable for %T\n\n", chainDb)
+		return
+	}
+	stats, err := db.LDB().GetProperty("leveldb.stats")
 	if err != nil {
 		utils.Fatalf("Failed to read database stats: %v", err)
 	}
 	fmt.Println(stats)
 
-	ioStats, err = db.LDB().GetProperty("leveldb.iostats")
+	ioStats, err := db.LDB().GetProperty("leveldb.iostats")
 	if err != nil {
 		utils.Fatalf("Failed to read database iostats: %v", err)
 	}
 	fmt.Println(ioStats)
-
-	return nil
 }
 
 func exportChain(ctx *cli.Context) error {
@@ -304,12 +478,18 @@ func exportChain(ctx *cli.Context) error {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	chain, _ := utils.MakeChain(ctx, stack)
+	chain, _ := utils.MakeChain(ctx, stack, true)
 	start := time.Now()
 
 	var err error
 	fp := ctx.Args().First()
-	if len(ctx.Args()) < 3 {
+	if ctx.IsSet(exportFromFlag.Name) || ctx.IsSet(exportToFlag.Name) {
+		last := chain.CurrentBlock().NumberU64()
+		if ctx.IsSet(exportToFlag.Name) {
+			last = ctx.Uint64(exportToFlag.Name)
+		}
+		err = utils.ExportAppendChain(chain, fp, ctx.Uint64(exportFromFlag.Name), last)
+	} else if len(ctx.Args()) < 3 {
 		err = utils.ExportChain(chain, fp)
 	} else {
 		// This can be improved to allow for numbers larger than 9223372036854775807
@@ -337,7 +517,7 @@ func importPreimages(ctx *cli.Context) error {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	diskdb := utils.MakeChainDatabase(ctx, stack).(*mandb.LDBDatabase)
+	diskdb := utils.MakeChainDatabase(ctx, stack, false)
 
 	start := time.Now()
 	if err := utils.ImportPreimages(diskdb, ctx.Args().First()); err != nil {
@@ -353,7 +533,10 @@ func exportPreimages(ctx *cli.Context) error {
 		utils.Fatalf("This command requires an argument.")
 	}
 	stack := makeFullNode(ctx)
-	diskdb := utils.MakeChainDatabase(ctx, stack).(*mandb.LDBDatabase)
+	diskdb, ok := utils.MakeChainDatabase(ctx, stack, true).(mandb.Iteratee)
+	if !ok {
+		utils.Fatalf("Chain database does not support iteration")
+	}
 
 	start := time.Now()
 	if err := utils.ExportPreimages(diskdb, ctx.Args().First()); err != nil {
@@ -370,7 +553,7 @@ func copyDb(ctx *cli.Context) error {
 	}
 	// Initialize a new chain for the running node to sync into
 	stack := makeFullNode(ctx)
-	chain, chainDb := utils.MakeChain(ctx, stack)
+	chain, chainDb := utils.MakeChain(ctx, stack, false)
 
 	syncmode := *utils.GlobalTextMarshaler(ctx, utils.SyncModeFlag.Name).(*downloader.SyncMode)
 	dl := downloader.New(syncmode, chainDb, new(event.TypeMux), chain, nil, nil)
@@ -403,7 +586,7 @@ func copyDb(ctx *cli.Context) error {
 	// Compact the entire database to remove any sync overhead
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = chainDb.(*mandb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
+	if err = chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
@@ -441,8 +624,16 @@ func removeDB(ctx *cli.Context) error {
 }
 
 func dump(ctx *cli.Context) error {
+	var (
+		format    = ctx.String(dumpFormatFlag.Name)
+		nocode    = ctx.Bool(dumpNoCodeFlag.Name)
+		nostorage = ctx.Bool(dumpNoStorageFlag.Name)
+	)
+	if format != "json" && format != "jsonl" && format != "csv" {
+		utils.Fatalf("unknown dump format %q", format)
+	}
 	stack := makeFullNode(ctx)
-	chain, chainDb := utils.MakeChain(ctx, stack)
+	chain, chainDb := utils.MakeChain(ctx, stack, true)
 	for _, arg := range ctx.Args() {
 		var block *types.Block
 		if hashish(arg) {
@@ -455,17 +646,165 @@ func dump(ctx *cli.Context) error {
 			fmt.Println("{}")
 			utils.Fatalf("block not found")
 		} else {
-			state, err := state.New(block.Root(), state.NewDatabase(chainDb))
+			state, err := state.New(block.Root(), chain.StateCache())
 			if err != nil {
 				utils.Fatalf("could not create new state: %v", err)
 			}
-			fmt.Printf("%s\n", state.Dump())
+			switch format {
+			case "jsonl":
+				err = state.IterativeDump(nocode, nostorage, false, os.Stdout)
+			case "csv":
+				err = state.CSVDump(nocode, nostorage, false, os.Stdout)
+			default:
+				fmt.Printf("%s\n", state.Dump())
+			}
+			if err != nil {
+				utils.Fatalf("could not dump state: %v", err)
+			}
 		}
 	}
 	chainDb.Close()
 	return nil
 }
 
+// verifyState checks the consistency of the state trie of the requested block,
+// reporting all the damaged nodes found.
+func verifyState(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack, true)
+	defer chainDb.Close()
+
+	block := chain.CurrentBlock()
+	if arg := ctx.Args().First(); arg != "" {
+		if hashish(arg) {
+			block = chain.GetBlockByHash(common.HexToHash(arg))
+		} else {
+			num, _ := strconv.Atoi(arg)
+			block = chain.GetBlockByNumber(uint64(num))
+		}
+	}
+	if block == nil {
+		utils.Fatalf("block not found")
+	}
+	log.Info("Verifying state trie", "number", block.Number(), "hash", block.Hash(), "root", block.Root())
+
+	start := time.Now()
+	damaged := state.CheckConsistency(chain.StateCache(), block.Root())
+	for _, err := range damaged {
+		log.Error("Damaged state entry", "hash", err.Hash, "path", fmt.Sprintf("%x", err.Path), "err", err.Err)
+	}
+	if len(damaged) > 0 {
+		return fmt.Errorf("state of block #%d is damaged: %d bad entries", block.NumberU64(), len(damaged))
+	}
+	log.Info("State trie is consistent", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func compactDB(ctx *cli.Context) error {
+	var start, limit []byte
+	switch ctx.NArg() {
+	case 0:
+	case 2:
+		var err error
+		if start, err = hexutil.Decode(ctx.Args().Get(0)); err != nil {
+			utils.Fatalf("Invalid start key: %v", err)
+		}
+		if limit, err = hexutil.Decode(ctx.Args().Get(1)); err != nil {
+			utils.Fatalf("Invalid limit key: %v", err)
+		}
+	default:
+		utils.Fatalf("This command requires either no arguments or a start and limit key.")
+	}
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chainDb.Close()
+
+	log.Info("Compacting chain database", "start", hexutil.Bytes(start), "limit", hexutil.Bytes(limit))
+	begin := time.Now()
+	if err := chainDb.Compact(start, limit); err != nil {
+		utils.Fatalf("Compaction failed: %v", err)
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+func backupDB(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		utils.Fatalf("This command requires a backup directory argument.")
+	}
+	// The directory is passed to the running node, so it can't stay relative
+	dir, err := filepath.Abs(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Invalid backup directory: %v", err)
+	}
+	stack := makeFullNode(ctx)
+	begin := time.Now()
+
+	if client, err := rpc.Dial(stack.IPCEndpoint()); err == nil {
+		defer client.Close()
+
+		log.Info("Backing up chain database of running node", "dir", dir)
+		if err := client.Call(nil, "debug_chaindbBackup", dir); err != nil {
+			utils.Fatalf("Backup failed: %v", err)
+		}
+	} else {
+		chainDb := utils.MakeChainDatabase(ctx, stack, true)
+		defer chainDb.Close()
+
+		log.Info("Backing up chain database", "dir", dir)
+		if err := rawdb.Backup(chainDb, dir); err != nil {
+			utils.Fatalf("Backup failed: %v", err)
+		}
+	}
+	log.Info("Database backup finished", "dir", dir, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+// reindexTxs rebuilds the transaction lookup entries of a range of blocks.
+func reindexTxs(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chainDb.Close()
+
+	head := rawdb.ReadHeaderNumber(chainDb, rawdb.ReadHeadBlockHash(chainDb))
+	if head == nil {
+		utils.Fatalf("Head block not found")
+	}
+	from, to := uint64(0), *head
+	if ctx.IsSet(reindexFromFlag.Name) {
+		from = ctx.Uint64(reindexFromFlag.Name)
+	}
+	if ctx.IsSet(reindexToFlag.Name) && ctx.Uint64(reindexToFlag.Name) < to {
+		to = ctx.Uint64(reindexToFlag.Name)
+	}
+	if from > to {
+		utils.Fatalf("Invalid block range %d-%d, head block is #%d", from, to, *head)
+	}
+	// Drop the entries of the blocks outside of the lookup limit, if any
+	if limit := ctx.GlobalUint64(utils.TxLookupLimitFlag.Name); limit > 0 && *head+1 > limit {
+		oldest := *head + 1 - limit
+
+		tail := uint64(0)
+		if t := rawdb.ReadTxIndexTail(chainDb); t != nil {
+			tail = *t
+		}
+		if tail < oldest {
+			if err := rawdb.UnindexTransactions(chainDb, tail, oldest, nil); err != nil {
+				utils.Fatalf("Failed to unindex transactions: %v", err)
+			}
+		}
+		if from < oldest {
+			from = oldest
+		}
+	}
+	if from <= to {
+		if err := rawdb.IndexTransactions(chainDb, from, to+1, nil); err != nil {
+			utils.Fatalf("Failed to index transactions: %v", err)
+		}
+	}
+	return nil
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
@@ -31,8 +31,10 @@ import (
 	"github.com/matrix/go-matrix/accounts/keystore"
 	"github.com/matrix/go-matrix/boot"
 	"github.com/matrix/go-matrix/cmd/utils"
+	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/console"
 	"github.com/matrix/go-matrix/man"
+	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/manclient"
 	"github.com/matrix/go-matrix/internal/debug"
 	"github.com/matrix/go-matrix/log"
@@ -54,13 +56,21 @@ var (
 	nodeFlags = []cli.Flag{
 		utils.IdentityFlag,
 		utils.UnlockedAccountFlag,
+		utils.UnlockMaxDurationFlag,
+		utils.SignAuditLogFlag,
 		utils.PasswordFileFlag,
 		utils.BootnodesFlag,
 		utils.BootnodesV4Flag,
 		utils.BootnodesV5Flag,
+		utils.DNSDiscoveryFlag,
 		utils.DataDirFlag,
+		utils.DBEngineFlag,
+		utils.AncientFlag,
+		utils.FreezerFlag,
+		utils.FreezerThresholdFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
+		utils.ExternalSignerFlag,
 		utils.DashboardEnabledFlag,
 		utils.DashboardAddrFlag,
 		utils.DashboardPortFlag,
@@ -84,14 +94,38 @@ var (
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
+		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
+		utils.OverrideHomesteadFlag,
+		utils.OverrideEIP150Flag,
+		utils.OverrideEIP155Flag,
+		utils.OverrideEIP158Flag,
+		utils.OverrideByzantiumFlag,
+		utils.OverrideConstantinopleFlag,
+		utils.OverrideVMUpgradesFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
+		utils.CheckpointFlag,
 		utils.LightKDFFlag,
+		utils.KeyStoreKDFFlag,
+		utils.KeyStoreScryptNFlag,
+		utils.KeyStoreScryptPFlag,
+		utils.KeyStoreArgon2TimeFlag,
+		utils.KeyStoreArgon2MemoryFlag,
+		utils.KeyStoreArgon2ThreadsFlag,
 		utils.CacheFlag,
 		utils.CacheDatabaseFlag,
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
+		utils.CacheNoPreimagesFlag,
+		utils.CacheNoPrefetchFlag,
+		utils.SnapshotFlag,
+		utils.StateDiffsFlag,
+		utils.SenderTxIndexFlag,
+		utils.ReceiptExtrasFlag,
+		utils.SlowBlockFlag,
+		utils.PropagationTraceFlag,
+		utils.TxLookupLimitFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -100,6 +134,8 @@ var (
 		utils.MinerThreadsFlag,
 		utils.MiningEnabledFlag,
 		utils.TargetGasLimitFlag,
+		utils.MinerGasLimitFlag,
+		utils.MinerTxOrderingFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -108,6 +144,7 @@ var (
 		utils.NodeKeyHexFlag,
 		utils.DeveloperFlag,
 		utils.DeveloperPeriodFlag,
+		utils.DeveloperPrefundFlag,
 		utils.TestnetFlag,
 		utils.RinkebyFlag,
 		utils.VMEnableDebugFlag,
@@ -116,6 +153,14 @@ var (
 		utils.RPCVirtualHostsFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
+		utils.MetricsHTTPFlag,
+		utils.MetricsPortFlag,
+		utils.MetricsEnableInfluxDBFlag,
+		utils.MetricsInfluxDBEndpointFlag,
+		utils.MetricsInfluxDBDatabaseFlag,
+		utils.MetricsInfluxDBUsernameFlag,
+		utils.MetricsInfluxDBPasswordFlag,
+		utils.MetricsInfluxDBTagsFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
@@ -132,6 +177,27 @@ var (
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.RPCBatchRequestLimitFlag,
+		utils.RPCBatchResponseMaxSizeFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
+		utils.RPCMaxConnsPerIPFlag,
+		utils.RPCResponseMaxSizeFlag,
+		utils.RPCFilterTimeoutFlag,
+		utils.RPCFilterLimitFlag,
+		utils.RPCStateRegenFlag,
+		utils.RPCGasCapFlag,
+		utils.RPCAccessListFlag,
+		utils.AuthRPCEnabledFlag,
+		utils.AuthRPCListenAddrFlag,
+		utils.AuthRPCPortFlag,
+		utils.AuthRPCVirtualHostsFlag,
+		utils.AuthRPCJWTSecretFlag,
+		utils.GraphQLEnabledFlag,
+		utils.GraphQLListenAddrFlag,
+		utils.GraphQLPortFlag,
+		utils.GraphQLCORSDomainFlag,
+		utils.GraphQLVirtualHostsFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
@@ -156,6 +222,7 @@ func init() {
 	app.Commands = []cli.Command{
 		// See chaincmd.go:
 		initCommand,
+		dumpGenesisCommand,
 		importCommand,
 		exportCommand,
 		importPreimagesCommand,
@@ -163,6 +230,9 @@ func init() {
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		dbCommand,
+		// See snapshotcmd.go:
+		snapshotCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
@@ -204,6 +274,7 @@ func init() {
 		go metrics.CollectProcessMetrics(3 * time.Second)
 
 		utils.SetupNetwork(ctx)
+		utils.SetupMetrics(ctx)
 		return nil
 	}
 
@@ -314,6 +385,25 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		log.INFO("矿工参选信息", "data", mindep, "err", err)
 	}()*/
 
+	// Shut the node down once it caught up with the network if requested
+	if ctx.GlobalBool(utils.ExitWhenSyncedFlag.Name) {
+		go func() {
+			sub := stack.EventMux().Subscribe(downloader.DoneEvent{})
+			defer sub.Unsubscribe()
+
+			for event := range sub.Chan() {
+				done, ok := event.Data.(downloader.DoneEvent)
+				if !ok || done.Latest == nil {
+					continue
+				}
+				if age := time.Since(time.Unix(done.Latest.Time.Int64(), 0)); age < 10*time.Minute {
+					log.Info("Synchronisation completed, exiting", "number", done.Latest.Number, "hash", done.Latest.Hash(), "age", common.PrettyDuration(age))
+					stack.Stop()
+					return
+				}
+			}
+		}()
+	}
 	// Start auxiliary services if enabled
 	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) || ctx.GlobalBool(utils.DeveloperFlag.Name) {
 		// Mining only makes sense if a full Matrix node is running
@@ -0,0 +1,123 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"time"
+
+	"github.com/matrix/go-matrix/cmd/utils"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/state/pruner"
+	"github.com/matrix/go-matrix/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// pruneRecentBlocks is the number of recent canonical blocks whose state roots
+// are accepted as a pruning target.
+const pruneRecentBlocks = 128
+
+var (
+	snapshotCommand = cli.Command{
+		Name:      "snapshot",
+		Usage:     "Offline state maintenance operations",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Delete all stale trie nodes from the database",
+				ArgsUsage: "[<root>]",
+				Action:    utils.MigrateFlags(pruneState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.BloomFilterSizeFlag,
+				},
+				Description: `
+The prune-state command deletes every trie node and contract code that is not
+part of the state of the head block, or of the given state root, which must be
+the root of one of the most recent 128 canonical blocks. The retained states are
+marked in a bloom filter of --bloomfilter.size megabytes first; a larger filter
+lets fewer stale entries survive. The node must not be running, and the states
+of all blocks other than the retained ones are lost afterwards.`,
+			},
+		},
+	}
+)
+
+func pruneState(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chainDb.Close()
+
+	head := rawdb.ReadHeadBlockHash(chainDb)
+	number := rawdb.ReadHeaderNumber(chainDb, head)
+	if number == nil {
+		utils.Fatalf("Head block not found")
+	}
+	header := rawdb.ReadHeader(chainDb, head, *number)
+	if header == nil {
+		utils.Fatalf("Head header #%d [%x] not found", *number, head)
+	}
+	roots := []common.Hash{header.Root}
+	if arg := ctx.Args().First(); arg != "" {
+		if len(common.FromHex(arg)) != common.HashLength {
+			utils.Fatalf("Invalid state root: %s", arg)
+		}
+		root := common.HexToHash(arg)
+
+		// Only accept recent states, anything older is likely incomplete
+		var found bool
+		for i := uint64(0); i < pruneRecentBlocks && i <= *number; i++ {
+			canon := rawdb.ReadHeader(chainDb, rawdb.ReadCanonicalHash(chainDb, *number-i), *number-i)
+			if canon != nil && canon.Root == root {
+				log.Info("Selected pruning target", "number", canon.Number, "hash", canon.Hash(), "root", root)
+				found = true
+				break
+			}
+		}
+		if !found {
+			utils.Fatalf("State root %x is not among the last %d canonical blocks", root, pruneRecentBlocks)
+		}
+		roots = []common.Hash{root}
+	}
+	// The head state is retained too if it was flushed to disk, so the node can
+	// resume from it without rewinding
+	if roots[0] != header.Root {
+		if ok, _ := chainDb.Has(header.Root[:]); ok {
+			roots = append(roots, header.Root)
+		}
+	}
+	for _, root := range roots {
+		if ok, _ := chainDb.Has(root[:]); !ok {
+			utils.Fatalf("State %x is missing from the database", root)
+		}
+	}
+	log.Warn("Pruning stale state, the database must not be interrupted", "roots", len(roots))
+
+	p, err := pruner.NewPruner(chainDb, ctx.Uint64(utils.BloomFilterSizeFlag.Name)*1024*1024)
+	if err != nil {
+		utils.Fatalf("Failed to create pruner: %v", err)
+	}
+	start := time.Now()
+	if err := p.Prune(roots...); err != nil {
+		utils.Fatalf("Pruning failed: %v", err)
+	}
+	log.Info("State pruning complete", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -69,24 +69,45 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			configFileFlag,
 			utils.DataDirFlag,
+			utils.DBEngineFlag,
+			utils.AncientFlag,
+			utils.FreezerFlag,
+			utils.FreezerThresholdFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
+			utils.ExternalSignerFlag,
 			utils.NetworkIdFlag,
 			utils.TestnetFlag,
 			utils.RinkebyFlag,
 			utils.SyncModeFlag,
+			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
+			utils.OverrideHomesteadFlag,
+			utils.OverrideEIP150Flag,
+			utils.OverrideEIP155Flag,
+			utils.OverrideEIP158Flag,
+			utils.OverrideByzantiumFlag,
+			utils.OverrideConstantinopleFlag,
+			utils.OverrideVMUpgradesFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
+			utils.CheckpointFlag,
 			utils.LightKDFFlag,
+			utils.KeyStoreKDFFlag,
+			utils.KeyStoreScryptNFlag,
+			utils.KeyStoreScryptPFlag,
+			utils.KeyStoreArgon2TimeFlag,
+			utils.KeyStoreArgon2MemoryFlag,
+			utils.KeyStoreArgon2ThreadsFlag,
 		},
 	},
 	{Name: "DEVELOPER CHAIN",
 		Flags: []cli.Flag{
 			utils.DeveloperFlag,
 			utils.DeveloperPeriodFlag,
+			utils.DeveloperPrefundFlag,
 		},
 	},
 	{
@@ -132,12 +153,23 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
 			utils.TrieCacheGenFlag,
+			utils.CacheNoPreimagesFlag,
+			utils.CacheNoPrefetchFlag,
+			utils.SnapshotFlag,
+			utils.StateDiffsFlag,
+			utils.SenderTxIndexFlag,
+			utils.ReceiptExtrasFlag,
+			utils.SlowBlockFlag,
+			utils.PropagationTraceFlag,
+			utils.TxLookupLimitFlag,
 		},
 	},
 	{
 		Name: "ACCOUNT",
 		Flags: []cli.Flag{
 			utils.UnlockedAccountFlag,
+			utils.UnlockMaxDurationFlag,
+			utils.SignAuditLogFlag,
 			utils.PasswordFileFlag,
 		},
 	},
@@ -148,6 +180,27 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCListenAddrFlag,
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
+			utils.RPCBatchRequestLimitFlag,
+			utils.RPCBatchResponseMaxSizeFlag,
+			utils.RPCRateLimitFlag,
+			utils.RPCRateBurstFlag,
+			utils.RPCMaxConnsPerIPFlag,
+			utils.RPCResponseMaxSizeFlag,
+			utils.RPCFilterTimeoutFlag,
+			utils.RPCFilterLimitFlag,
+			utils.RPCStateRegenFlag,
+			utils.RPCGasCapFlag,
+			utils.RPCAccessListFlag,
+			utils.AuthRPCEnabledFlag,
+			utils.AuthRPCListenAddrFlag,
+			utils.AuthRPCPortFlag,
+			utils.AuthRPCVirtualHostsFlag,
+			utils.AuthRPCJWTSecretFlag,
+			utils.GraphQLEnabledFlag,
+			utils.GraphQLListenAddrFlag,
+			utils.GraphQLPortFlag,
+			utils.GraphQLCORSDomainFlag,
+			utils.GraphQLVirtualHostsFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
@@ -168,6 +221,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.BootnodesFlag,
 			utils.BootnodesV4Flag,
 			utils.BootnodesV5Flag,
+			utils.DNSDiscoveryFlag,
 			utils.ListenPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
@@ -186,6 +240,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.MinerThreadsFlag,
 			utils.EtherbaseFlag,
 			utils.TargetGasLimitFlag,
+			utils.MinerGasLimitFlag,
+			utils.MinerTxOrderingFlag,
 			utils.GasPriceFlag,
 			utils.ExtraDataFlag,
 			utils.TestLocalMiningFlag,
@@ -206,10 +262,23 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.VMEnableDebugFlag,
 		},
 	},
+	{
+		Name: "METRICS AND STATS",
+		Flags: []cli.Flag{
+			utils.MetricsEnabledFlag,
+			utils.MetricsHTTPFlag,
+			utils.MetricsPortFlag,
+			utils.MetricsEnableInfluxDBFlag,
+			utils.MetricsInfluxDBEndpointFlag,
+			utils.MetricsInfluxDBDatabaseFlag,
+			utils.MetricsInfluxDBUsernameFlag,
+			utils.MetricsInfluxDBPasswordFlag,
+			utils.MetricsInfluxDBTagsFlag,
+		},
+	},
 	{
 		Name: "LOGGING AND DEBUGGING",
 		Flags: append([]cli.Flag{
-			utils.MetricsEnabledFlag,
 			utils.FakePoWFlag,
 			utils.NoCompactionFlag,
 		}, debug.Flags...),
@@ -21,11 +21,14 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core"
@@ -41,6 +44,14 @@ import (
 
 const (
 	importBatchSize = 2500
+
+	// exportCheckpointSize is the number of blocks written between two resume
+	// checkpoints of a ranged export.
+	exportCheckpointSize = 2500
+
+	// progressReportInterval is the time between two progress log lines of
+	// long running imports and exports.
+	progressReportInterval = 8 * time.Second
 )
 
 // Fatalf formats a message to standard error and exits the program.
@@ -85,21 +96,20 @@ func StartNode(stack *node.Node) {
 	}()
 }
 
-func ImportChain(chain *core.BlockChain, fn string) error {
-	// Watch for Ctrl-C while the import is running.
-	// If a signal is received, the import will stop at the next batch.
+// watchInterrupt catches Ctrl-C while a long running operation is in progress.
+// The returned check reports whether a signal was received, release must be
+// called once the operation is done to restore the default signal handling.
+func watchInterrupt(op string) (check func() bool, release func()) {
 	interrupt := make(chan os.Signal, 1)
 	stop := make(chan struct{})
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(interrupt)
-	defer close(interrupt)
 	go func() {
 		if _, ok := <-interrupt; ok {
-			log.Info("Interrupted during import, stopping at next batch")
+			log.Info("Interrupted during " + op + ", stopping at next batch")
 		}
 		close(stop)
 	}()
-	checkInterrupt := func() bool {
+	check = func() bool {
 		select {
 		case <-stop:
 			return true
@@ -107,6 +117,21 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 			return false
 		}
 	}
+	release = func() {
+		signal.Stop(interrupt)
+		close(interrupt)
+	}
+	return check, release
+}
+
+// ImportChain imports the RLP encoded blocks of the specified file. Blocks
+// already present in the chain are skipped, so an interrupted import resumes
+// where it left off when rerun with the same file.
+func ImportChain(chain *core.BlockChain, fn string) error {
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next batch.
+	checkInterrupt, release := watchInterrupt("import")
+	defer release()
 
 	log.Info("Importing blockchain", "file", fn)
 
@@ -126,12 +151,16 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	stream := rlp.NewStream(reader, 0)
 
 	// Run actual the import.
-	blocks := make(types.Blocks, importBatchSize)
-	n := 0
+	var (
+		blocks   = make(types.Blocks, importBatchSize)
+		n        = 0
+		start    = time.Now()
+		reported = time.Now()
+	)
 	for batch := 0; ; batch++ {
 		// Load a batch of RLP blocks.
 		if checkInterrupt() {
-			return fmt.Errorf("interrupted")
+			return fmt.Errorf("interrupted at block %d, rerun to resume", n)
 		}
 		i := 0
 		for ; i < importBatchSize; i++ {
@@ -154,7 +183,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		}
 		// Import the batch.
 		if checkInterrupt() {
-			return fmt.Errorf("interrupted")
+			return fmt.Errorf("interrupted at block %d, rerun to resume", n)
 		}
 		missing := missingBlocks(chain, blocks[:i])
 		if len(missing) == 0 {
@@ -164,7 +193,12 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		if _, err := chain.InsertChain(missing); err != nil {
 			return fmt.Errorf("invalid block %d: %v", n, err)
 		}
+		if time.Since(reported) >= progressReportInterval {
+			log.Info("Importing blockchain", "file", fn, "blocks", n, "number", blocks[i-1].NumberU64(), "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
 	}
+	log.Info("Imported blockchain", "file", fn, "blocks", n, "elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
 
@@ -212,33 +246,147 @@ func ExportChain(blockchain *core.BlockChain, fn string) error {
 	return nil
 }
 
-// ExportAppendChain exports a blockchain into the specified file, appending to
-// the file if data already exists in it.
+// ExportAppendChain exports a range of the blockchain into the specified file,
+// appending to the file if data already exists in it. Progress is checkpointed
+// next to the file, so an interrupted export resumes where it left off when
+// rerun with the same range.
 func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
-	log.Info("Exporting blockchain", "file", fn)
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	checkInterrupt, release := watchInterrupt("export")
+	defer release()
 
-	// Open the file handle and potentially wrap with a gzip stream
-	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	log.Info("Exporting blockchain", "file", fn, "first", first, "last", last)
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_RDWR, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
-	var writer io.Writer = fh
-	if strings.HasSuffix(fn, ".gz") {
-		writer = gzip.NewWriter(writer)
-		defer writer.(*gzip.Writer).Close()
+	// Drop anything written after the last checkpoint of an interrupted run
+	progress := fn + ".progress"
+	offset, err := fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
 	}
-	// Iterate over the blocks and export them
-	if err := blockchain.ExportN(writer, first, last); err != nil {
+	next := first
+	if cp, ok := readExportProgress(progress); ok {
+		if cp.first != first || cp.last != last {
+			return fmt.Errorf("interrupted export of blocks %d-%d pending, rerun with the same range or remove %s", cp.first, cp.last, progress)
+		}
+		if cp.number >= first && cp.number < last && cp.offset <= offset {
+			log.Info("Resuming interrupted export", "file", fn, "number", cp.number+1)
+			if err := fh.Truncate(cp.offset); err != nil {
+				return err
+			}
+			next, offset = cp.number+1, cp.offset
+		}
+	}
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
 		return err
 	}
-	log.Info("Exported blockchain to", "file", fn)
+	// Gzip streams are closed at every checkpoint, making the file a valid
+	// multi-member archive up to each of them
+	var (
+		gz     *gzip.Writer
+		writer io.Writer = fh
+	)
+	if strings.HasSuffix(fn, ".gz") {
+		gz = gzip.NewWriter(fh)
+		writer = gz
+	}
+	checkpoint := func(number uint64) error {
+		cp := exportProgress{first: first, last: last, number: number}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				return err
+			}
+			gz.Reset(fh)
+		}
+		if cp.offset, err = fh.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		return writeExportProgress(progress, cp)
+	}
+	var (
+		start    = time.Now()
+		reported = time.Now()
+	)
+	for nr := next; nr <= last; nr++ {
+		block := blockchain.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		if err := block.EncodeRLP(writer); err != nil {
+			return err
+		}
+		if nr == last {
+			break
+		}
+		if interrupted := checkInterrupt(); interrupted || (nr-next+1)%exportCheckpointSize == 0 {
+			if err := checkpoint(nr); err != nil {
+				return err
+			}
+			if interrupted {
+				return fmt.Errorf("interrupted at block %d, rerun to resume", nr)
+			}
+		}
+		if time.Since(reported) >= progressReportInterval {
+			log.Info("Exporting blockchain", "file", fn, "number", nr, "last", last, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	os.Remove(progress)
+	log.Info("Exported blockchain", "file", fn, "elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
 
+// exportProgress is a checkpoint of an interrupted export.
+type exportProgress struct {
+	first, last uint64 // Range of blocks requested by the export
+	number      uint64 // Number of the last block fully written
+	offset      int64  // File offset following the last written block
+}
+
+// readExportProgress loads the last checkpoint of an interrupted export.
+func readExportProgress(fn string) (exportProgress, bool) {
+	var cp exportProgress
+
+	blob, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return cp, false
+	}
+	fields := strings.Fields(string(blob))
+	if len(fields) != 4 {
+		return cp, false
+	}
+	numbers := make([]uint64, 3)
+	for i := range numbers {
+		if numbers[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+			return cp, false
+		}
+	}
+	if cp.offset, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return cp, false
+	}
+	cp.first, cp.last, cp.number = numbers[0], numbers[1], numbers[2]
+	return cp, true
+}
+
+// writeExportProgress stores an export checkpoint.
+func writeExportProgress(fn string, cp exportProgress) error {
+	return ioutil.WriteFile(fn, []byte(fmt.Sprintf("%d %d %d %d\n", cp.first, cp.last, cp.number, cp.offset)), 0644)
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
-func ImportPreimages(db *mandb.LDBDatabase, fn string) error {
+func ImportPreimages(db mandb.Database, fn string) error {
 	log.Info("Importing preimages", "file", fn)
 
 	// Open the file handle and potentially unwrap the gzip stream
@@ -285,7 +433,7 @@ func ImportPreimages(db *mandb.LDBDatabase, fn string) error {
 
 // ExportPreimages exports all known hash preimages into the specified file,
 // truncating any data already present in the file.
-func ExportPreimages(db *mandb.LDBDatabase, fn string) error {
+func ExportPreimages(db mandb.Iteratee, fn string) error {
 	log.Info("Exporting preimages", "file", fn)
 
 	// Open the file handle and potentially wrap with a gzip stream
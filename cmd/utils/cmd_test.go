@@ -0,0 +1,124 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrix/go-matrix/consensus/manash"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+func TestExportProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "chain.rlp.progress")
+	if _, ok := readExportProgress(fn); ok {
+		t.Fatalf("progress found without checkpoint")
+	}
+	want := exportProgress{first: 100, last: 9000, number: 2599, offset: 1234567}
+	if err := writeExportProgress(fn, want); err != nil {
+		t.Fatalf("failed to write checkpoint: %v", err)
+	}
+	if cp, ok := readExportProgress(fn); !ok || cp != want {
+		t.Fatalf("checkpoint mismatch: have %+v/%v, want %+v/true", cp, ok, want)
+	}
+	for _, blob := range []string{"garbage", "2599 1234567\n", "100 9000 x 1234567\n"} {
+		if err := ioutil.WriteFile(fn, []byte(blob), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := readExportProgress(fn); ok {
+			t.Fatalf("corrupt checkpoint %q accepted", blob)
+		}
+	}
+}
+
+// Tests that an interrupted export only resumes when rerun with the range it
+// was started with.
+func TestExportAppendChainResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		db      = mandb.NewMemDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, 4, nil)
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, manash.NewFaker(), vm.Config{})
+	defer chain.Stop()
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// Export the full range in one go as the reference
+	full := filepath.Join(dir, "full.rlp")
+	if err := ExportAppendChain(chain, full, 1, 4); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	want, err := ioutil.ReadFile(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate an export interrupted after block 2 with a torn write behind it
+	var partial bytes.Buffer
+	for _, block := range blocks[:2] {
+		if err := block.EncodeRLP(&partial); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offset := int64(partial.Len())
+	partial.Write([]byte{0xde, 0xad})
+
+	fn := filepath.Join(dir, "chain.rlp")
+	if err := ioutil.WriteFile(fn, partial.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeExportProgress(fn+".progress", exportProgress{first: 1, last: 4, number: 2, offset: offset}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportAppendChain(chain, fn, 1, 3); err == nil || !strings.Contains(err.Error(), "same range") {
+		t.Fatalf("resume with different range error mismatch: have %v", err)
+	}
+	if err := ExportAppendChain(chain, fn, 1, 4); err != nil {
+		t.Fatalf("failed to resume export: %v", err)
+	}
+	have, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("resumed export mismatch: have %d bytes, want %d", len(have), len(want))
+	}
+	if _, err := os.Stat(fn + ".progress"); !os.IsNotExist(err) {
+		t.Errorf("checkpoint not removed after export: %v", err)
+	}
+}
@@ -19,14 +19,17 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/matrix/go-matrix/accounts"
 	"github.com/matrix/go-matrix/accounts/keystore"
@@ -36,10 +39,12 @@ import (
 	"github.com/matrix/go-matrix/consensus/clique"
 	"github.com/matrix/go-matrix/consensus/manash"
 	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/vm"
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/dashboard"
+	"github.com/matrix/go-matrix/graphql"
 	"github.com/matrix/go-matrix/man"
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/man/gasprice"
@@ -48,6 +53,8 @@ import (
 	"github.com/matrix/go-matrix/les"
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/metrics"
+	"github.com/matrix/go-matrix/metrics/exp"
+	"github.com/matrix/go-matrix/metrics/influxdb"
 	"github.com/matrix/go-matrix/node"
 	"github.com/matrix/go-matrix/p2p"
 	"github.com/matrix/go-matrix/p2p/discover"
@@ -122,10 +129,33 @@ var (
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
 	}
+	AncientFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+	}
+	FreezerFlag = cli.BoolFlag{
+		Name:  "freezer",
+		Usage: "Move ancient chain segments from the database into append-only flat files",
+	}
+	FreezerThresholdFlag = cli.Uint64Flag{
+		Name:  "freezer.threshold",
+		Usage: "Number of recent blocks to keep in the database when the freezer is enabled",
+		Value: rawdb.DefaultFreezerThreshold,
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: fmt.Sprintf("Backing database implementation to use (%s)", strings.Join(mandb.Engines(), "|")),
+		Value: mandb.DefaultEngine,
+	}
 	NoUSBFlag = cli.BoolFlag{
 		Name:  "nousb",
 		Usage: "Disables monitoring for and managing USB hardware wallets",
 	}
+	ExternalSignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "External signer (url or path to ipc file) to delegate transaction signing to",
+		Value: "",
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby)",
@@ -147,6 +177,10 @@ var (
 		Name:  "dev.period",
 		Usage: "Block period to use in developer mode (0 = mine only if transaction pending)",
 	}
+	DeveloperPrefundFlag = cli.StringFlag{
+		Name:  "dev.prefund",
+		Usage: "Comma separated accounts to pre-fund in the developer genesis block",
+	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
 		Usage: "Custom node name",
@@ -167,9 +201,41 @@ var (
 	defaultSyncMode = man.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "snap" or "light")`,
 		Value: &defaultSyncMode,
 	}
+	ExitWhenSyncedFlag = cli.BoolFlag{
+		Name:  "exitwhensynced",
+		Usage: "Exit after the block synchronisation completes",
+	}
+	OverrideHomesteadFlag = cli.Uint64Flag{
+		Name:  "override.homestead",
+		Usage: "Manually specify the Homestead fork block, overriding the chain configuration",
+	}
+	OverrideEIP150Flag = cli.Uint64Flag{
+		Name:  "override.eip150",
+		Usage: "Manually specify the EIP-150 fork block, overriding the chain configuration",
+	}
+	OverrideEIP155Flag = cli.Uint64Flag{
+		Name:  "override.eip155",
+		Usage: "Manually specify the EIP-155 fork block, overriding the chain configuration",
+	}
+	OverrideEIP158Flag = cli.Uint64Flag{
+		Name:  "override.eip158",
+		Usage: "Manually specify the EIP-158 fork block, overriding the chain configuration",
+	}
+	OverrideByzantiumFlag = cli.Uint64Flag{
+		Name:  "override.byzantium",
+		Usage: "Manually specify the Byzantium fork block, overriding the chain configuration",
+	}
+	OverrideConstantinopleFlag = cli.Uint64Flag{
+		Name:  "override.constantinople",
+		Usage: "Manually specify the Constantinople fork block, overriding the chain configuration",
+	}
+	OverrideVMUpgradesFlag = cli.StringFlag{
+		Name:  "override.vmupgrades",
+		Usage: "Comma separated VM upgrade activations overriding the chain configuration (name=block)",
+	}
 	GCModeFlag = cli.StringFlag{
 		Name:  "gcmode",
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
@@ -185,10 +251,39 @@ var (
 		Usage: "Maximum number of LES client peers",
 		Value: man.DefaultConfig.LightPeers,
 	}
+	CheckpointFlag = cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "Trusted checkpoint to start light syncing from (<section>,<sectionhead>,<chtroot>,<bloomroot>)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
 	}
+	KeyStoreKDFFlag = cli.StringFlag{
+		Name:  "keystore.kdf",
+		Usage: `Key derivation function for new key files ("scrypt" or "argon2id")`,
+		Value: keystore.KDFScrypt,
+	}
+	KeyStoreScryptNFlag = cli.IntFlag{
+		Name:  "keystore.scrypt.n",
+		Usage: "Scrypt CPU/memory cost parameter N for new key files (power of two)",
+	}
+	KeyStoreScryptPFlag = cli.IntFlag{
+		Name:  "keystore.scrypt.p",
+		Usage: "Scrypt parallelization parameter P for new key files",
+	}
+	KeyStoreArgon2TimeFlag = cli.UintFlag{
+		Name:  "keystore.argon2.time",
+		Usage: "Argon2id number of passes for new key files",
+	}
+	KeyStoreArgon2MemoryFlag = cli.UintFlag{
+		Name:  "keystore.argon2.memory",
+		Usage: "Argon2id memory size in KiB for new key files",
+	}
+	KeyStoreArgon2ThreadsFlag = cli.UintFlag{
+		Name:  "keystore.argon2.threads",
+		Usage: "Argon2id degree of parallelism for new key files",
+	}
 	// Dashboard settings
 	DashboardEnabledFlag = cli.BoolFlag{
 		Name:  "dashboard",
@@ -305,11 +400,53 @@ var (
 		Usage: "Percentage of cache memory allowance to use for trie pruning",
 		Value: 25,
 	}
+	BloomFilterSizeFlag = cli.Uint64Flag{
+		Name:  "bloomfilter.size",
+		Usage: "Megabytes of memory allocated to the bloom filter for state pruning",
+		Value: 2048,
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
 		Value: int(state.MaxTrieCacheGen),
 	}
+	CacheNoPreimagesFlag = cli.BoolFlag{
+		Name:  "cache.nopreimages",
+		Usage: "Disable recording the preimages of secure trie keys",
+	}
+	CacheNoPrefetchFlag = cli.BoolFlag{
+		Name:  "cache.noprefetch",
+		Usage: "Disable heuristic state prefetch during block import (less CPU and disk IO, more time waiting for data)",
+	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat state snapshot for accelerated account and storage reads",
+	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "statediffs",
+		Usage: "Index the accounts and storage slots modified by each block",
+	}
+	SenderTxIndexFlag = cli.BoolFlag{
+		Name:  "txindex.sender",
+		Usage: "Index transactions by sender to serve man_getTransactionsBySender",
+	}
+	ReceiptExtrasFlag = cli.BoolFlag{
+		Name:  "receipts.extras",
+		Usage: "Store revert reasons and internal value transfers to extend man_getTransactionReceipt",
+	}
+	SlowBlockFlag = cli.DurationFlag{
+		Name:  "debug.slowblock",
+		Usage: "Log the timing breakdown of blocks taking longer than this to import (0 = disabled)",
+	}
+	PropagationTraceFlag = cli.BoolFlag{
+		Name:  "debug.propagation",
+		Usage: "Trace the delays with which peers propagate blocks and transactions to serve debug_propagationStats",
+	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to keep transaction lookup entries for (0 = entire chain)",
+		Value: man.DefaultConfig.TxLookupLimit,
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -325,6 +462,15 @@ var (
 		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine",
 		Value: params.GenesisGasLimit,
 	}
+	MinerGasLimitFlag = cli.Uint64Flag{
+		Name:  "miner.gaslimit",
+		Usage: "Gas limit mined blocks move towards within protocol bounds (0 = follow parent gas usage)",
+	}
+	MinerTxOrderingFlag = cli.StringFlag{
+		Name:  "miner.txordering",
+		Usage: `Order to pack pending transactions in ("price" or "arrival")`,
+		Value: "price",
+	}
 	EtherbaseFlag = cli.StringFlag{
 		Name:  "manbase",
 		Usage: "Public address for block mining rewards (default = first account created)",
@@ -357,6 +503,14 @@ var (
 		Usage: "Comma separated list of accounts to unlock",
 		Value: "",
 	}
+	UnlockMaxDurationFlag = cli.DurationFlag{
+		Name:  "unlock.maxduration",
+		Usage: "Maximum duration accounts can be unlocked for through the RPC APIs (0 = unlimited)",
+	}
+	SignAuditLogFlag = cli.StringFlag{
+		Name:  "auditlog",
+		Usage: "File to record account unlocks and signing requests made through the RPC APIs in",
+	}
 	PasswordFileFlag = cli.StringFlag{
 		Name:  "password",
 		Usage: "Password file to use for non-interactive password input",
@@ -376,6 +530,42 @@ var (
 		Name:  metrics.MetricsEnabledFlag,
 		Usage: "Enable metrics collection and reporting",
 	}
+	MetricsHTTPFlag = cli.StringFlag{
+		Name:  "metrics.addr",
+		Usage: "Enable stand-alone metrics HTTP server listening interface (default: disabled)",
+	}
+	MetricsPortFlag = cli.IntFlag{
+		Name:  "metrics.port",
+		Usage: "Metrics HTTP server listening port",
+		Value: 6060,
+	}
+	MetricsEnableInfluxDBFlag = cli.BoolFlag{
+		Name:  "metrics.influxdb",
+		Usage: "Enable metrics export/push to an external InfluxDB database",
+	}
+	MetricsInfluxDBEndpointFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.endpoint",
+		Usage: "InfluxDB API endpoint to report metrics to",
+		Value: "http://localhost:8086",
+	}
+	MetricsInfluxDBDatabaseFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.database",
+		Usage: "InfluxDB database name to push reported metrics to",
+		Value: "gman",
+	}
+	MetricsInfluxDBUsernameFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.username",
+		Usage: "Username to authorize access to the database",
+	}
+	MetricsInfluxDBPasswordFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.password",
+		Usage: "Password to authorize access to the database",
+	}
+	MetricsInfluxDBTagsFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.tags",
+		Usage: "Comma-separated InfluxDB tags (key/values) attached to all measurements",
+		Value: "host=localhost",
+	}
 	FakePoWFlag = cli.BoolFlag{
 		Name:  "fakepow",
 		Usage: "Disables proof-of-work verification",
@@ -414,6 +604,101 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCBatchRequestLimitFlag = cli.IntFlag{
+		Name:  "rpc.batch-request-limit",
+		Usage: "Maximum number of requests in a JSON-RPC batch (0 = unlimited)",
+		Value: node.DefaultConfig.BatchRequestLimit,
+	}
+	RPCBatchResponseMaxSizeFlag = cli.IntFlag{
+		Name:  "rpc.batch-response-max-size",
+		Usage: "Maximum number of bytes returned from a JSON-RPC batch (0 = unlimited)",
+		Value: node.DefaultConfig.BatchResponseMaxSize,
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Requests per second each client IP may issue over HTTP-RPC and WS-RPC (0 = unlimited)",
+	}
+	RPCRateBurstFlag = cli.IntFlag{
+		Name:  "rpc.rateburst",
+		Usage: "Requests each client IP may issue in excess of the rate limit after idling",
+	}
+	RPCMaxConnsPerIPFlag = cli.IntFlag{
+		Name:  "rpc.maxconns",
+		Usage: "Maximum concurrent HTTP-RPC requests or WS-RPC connections per client IP (0 = unlimited)",
+	}
+	RPCResponseMaxSizeFlag = cli.IntFlag{
+		Name:  "rpc.response-max-size",
+		Usage: "Maximum number of bytes of a single HTTP-RPC or WS-RPC response (0 = unlimited)",
+	}
+	RPCFilterTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.filtertimeout",
+		Usage: "Time after which installed filters and dropped log or head subscriptions not polled are removed",
+		Value: 5 * time.Minute,
+	}
+	RPCFilterLimitFlag = cli.IntFlag{
+		Name:  "rpc.filterlimit",
+		Usage: "Maximum number of filters installed by a single client IP (0 = unlimited)",
+	}
+	RPCStateRegenFlag = cli.Uint64Flag{
+		Name:  "rpc.stateregen",
+		Usage: "Maximum number of blocks re-executed to regenerate pruned historical state for RPC calls (0 = disabled)",
+	}
+	RPCGasCapFlag = cli.Uint64Flag{
+		Name:  "rpc.gascap",
+		Usage: "Maximum gas limit of the blocks simulated by man_callBundle (0 = no cap)",
+		Value: man.DefaultConfig.RPCGasCap,
+	}
+	RPCAccessListFlag = cli.StringFlag{
+		Name:  "rpc.acl",
+		Usage: "File listing the namespaces (man_*) and methods (admin_peers) callable over HTTP-RPC and WS-RPC, one per line; man_subscribe allows all man subscriptions, man_newHeads only that one",
+	}
+	AuthRPCEnabledFlag = cli.BoolFlag{
+		Name:  "authrpc",
+		Usage: "Enable the JWT authenticated HTTP-RPC server serving all APIs",
+	}
+	AuthRPCListenAddrFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Authenticated HTTP-RPC server listening interface",
+		Value: node.DefaultAuthHost,
+	}
+	AuthRPCPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Authenticated HTTP-RPC server listening port",
+		Value: node.DefaultAuthPort,
+	}
+	AuthRPCVirtualHostsFlag = cli.StringFlag{
+		Name:  "authrpc.vhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept authenticated requests (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.AuthVirtualHosts, ","),
+	}
+	AuthRPCJWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to the hex encoded JWT secret of the authenticated HTTP-RPC server (default = generated in the datadir)",
+	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable the GraphQL server",
+	}
+	GraphQLListenAddrFlag = cli.StringFlag{
+		Name:  "graphql.addr",
+		Usage: "GraphQL server listening interface",
+		Value: node.DefaultHTTPHost,
+	}
+	GraphQLPortFlag = cli.IntFlag{
+		Name:  "graphql.port",
+		Usage: "GraphQL server listening port",
+		Value: node.DefaultHTTPPort + 2,
+	}
+	GraphQLCORSDomainFlag = cli.StringFlag{
+		Name:  "graphql.corsdomain",
+		Usage: "Comma separated list of domains from which to accept cross origin requests (browser enforced)",
+		Value: "",
+	}
+	GraphQLVirtualHostsFlag = cli.StringFlag{
+		Name:  "graphql.vhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -486,6 +771,11 @@ var (
 		Usage: "Comma separated enode URLs for P2P v5 discovery bootstrap (light server, light nodes)",
 		Value: "",
 	}
+	DNSDiscoveryFlag = cli.StringFlag{
+		Name:  "discovery.dns",
+		Usage: "Comma separated enrtree:// URLs of DNS node lists used for discovery bootstrap",
+		Value: "",
+	}
 	NodeKeyFileFlag = cli.StringFlag{
 		Name:  "nodekey",
 		Usage: "P2P node key file",
@@ -611,6 +901,8 @@ func setBootstrapNodes(ctx *cli.Context, cfg *p2p.Config) {
 		urls = params.TestnetBootnodes
 	case ctx.GlobalBool(RinkebyFlag.Name):
 		urls = params.RinkebyBootnodes
+	case ctx.GlobalBool(DeveloperFlag.Name):
+		urls = nil // developer chains are single node
 	case cfg.BootstrapNodes != nil:
 		return // already set, don't apply defaults.
 	}
@@ -639,6 +931,8 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 		}
 	case ctx.GlobalBool(RinkebyFlag.Name):
 		urls = params.RinkebyBootnodes
+	case ctx.GlobalBool(DeveloperFlag.Name):
+		urls = nil
 	case cfg.BootstrapNodesV5 != nil:
 		return // already set, don't apply defaults.
 	}
@@ -654,6 +948,20 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setDNSDiscovery configures the DNS node lists used for bootstrapping from the
+// command line flags.
+func setDNSDiscovery(ctx *cli.Context, cfg *p2p.Config) {
+	if !ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
+		return
+	}
+	cfg.DNSDiscovery = nil
+	for _, url := range strings.Split(ctx.GlobalString(DNSDiscoveryFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.DNSDiscovery = append(cfg.DNSDiscovery, url)
+		}
+	}
+}
+
 // setListenAddress creates a TCP listening address string from set command
 // line flags.
 func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
@@ -728,6 +1036,23 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setAuth configures the JWT authenticated RPC endpoint from the set command
+// line flags, leaving it disabled unless explicitly requested.
+func setAuth(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalBool(AuthRPCEnabledFlag.Name) && cfg.AuthHost == "" {
+		cfg.AuthHost = ctx.GlobalString(AuthRPCListenAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthRPCPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthRPCPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthRPCVirtualHostsFlag.Name) {
+		cfg.AuthVirtualHosts = splitAndTrim(ctx.GlobalString(AuthRPCVirtualHostsFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthRPCJWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(AuthRPCJWTSecretFlag.Name)
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -819,6 +1144,7 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	setListenAddress(ctx, cfg)
 	setBootstrapNodes(ctx, cfg)
 	setBootstrapNodesV5(ctx, cfg)
+	setDNSDiscovery(ctx, cfg)
 
 	lightClient := ctx.GlobalBool(LightModeFlag.Name) || ctx.GlobalString(SyncModeFlag.Name) == "light"
 	lightServer := ctx.GlobalInt(LightServFlag.Name) != 0
@@ -886,8 +1212,31 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuth(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 
+	if ctx.GlobalIsSet(RPCAccessListFlag.Name) {
+		cfg.RPCAccessList = ctx.GlobalString(RPCAccessListFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCRateLimit = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateBurstFlag.Name) {
+		cfg.RPCRateBurst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMaxConnsPerIPFlag.Name) {
+		cfg.RPCMaxConnsPerIP = ctx.GlobalInt(RPCMaxConnsPerIPFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseMaxSizeFlag.Name) {
+		cfg.RPCResponseMaxSize = ctx.GlobalInt(RPCResponseMaxSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCBatchRequestLimitFlag.Name) {
+		cfg.BatchRequestLimit = ctx.GlobalInt(RPCBatchRequestLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCBatchResponseMaxSizeFlag.Name) {
+		cfg.BatchResponseMaxSize = ctx.GlobalInt(RPCBatchResponseMaxSizeFlag.Name)
+	}
+
 	switch {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
 		cfg.DataDir = ctx.GlobalString(DataDirFlag.Name)
@@ -899,15 +1248,63 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "rinkeby")
 	}
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		engine := ctx.GlobalString(DBEngineFlag.Name)
+		if !isRegisteredEngine(engine) {
+			Fatalf("Unknown database engine %q, available: %s", engine, strings.Join(mandb.Engines(), ", "))
+		}
+		cfg.DBEngine = engine
+	}
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
 	if ctx.GlobalIsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.GlobalBool(LightKDFFlag.Name)
 	}
+	if ctx.GlobalIsSet(KeyStoreKDFFlag.Name) {
+		cfg.KeyStoreKDF = ctx.GlobalString(KeyStoreKDFFlag.Name)
+	}
+	if ctx.GlobalIsSet(KeyStoreScryptNFlag.Name) {
+		cfg.KeyStoreScryptN = ctx.GlobalInt(KeyStoreScryptNFlag.Name)
+	}
+	if ctx.GlobalIsSet(KeyStoreScryptPFlag.Name) {
+		cfg.KeyStoreScryptP = ctx.GlobalInt(KeyStoreScryptPFlag.Name)
+	}
+	if ctx.GlobalIsSet(KeyStoreArgon2TimeFlag.Name) {
+		cfg.KeyStoreArgon2Time = uint32(ctx.GlobalUint(KeyStoreArgon2TimeFlag.Name))
+	}
+	if ctx.GlobalIsSet(KeyStoreArgon2MemoryFlag.Name) {
+		cfg.KeyStoreArgon2Memory = uint32(ctx.GlobalUint(KeyStoreArgon2MemoryFlag.Name))
+	}
+	if ctx.GlobalIsSet(KeyStoreArgon2ThreadsFlag.Name) {
+		threads := ctx.GlobalUint(KeyStoreArgon2ThreadsFlag.Name)
+		if threads > math.MaxUint8 {
+			Fatalf("Argon2id threads must be at most %d, got %d", math.MaxUint8, threads)
+		}
+		cfg.KeyStoreArgon2Threads = uint8(threads)
+	}
 	if ctx.GlobalIsSet(NoUSBFlag.Name) {
 		cfg.NoUSB = ctx.GlobalBool(NoUSBFlag.Name)
 	}
+	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
+		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
+	}
+	if ctx.GlobalIsSet(UnlockMaxDurationFlag.Name) {
+		cfg.UnlockMaxDuration = ctx.GlobalDuration(UnlockMaxDurationFlag.Name)
+	}
+	if ctx.GlobalIsSet(SignAuditLogFlag.Name) {
+		cfg.SignAuditLog = ctx.GlobalString(SignAuditLogFlag.Name)
+	}
+}
+
+// isRegisteredEngine reports whether the named database engine is available.
+func isRegisteredEngine(engine string) bool {
+	for _, name := range mandb.Engines() {
+		if name == engine {
+			return true
+		}
+	}
+	return false
 }
 
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
@@ -1021,6 +1418,10 @@ func SetShhConfig(ctx *cli.Context, stack *node.Node, cfg *whisper.Config) {
 	}
 }
 
+// developerKeySeed is hashed into the key of the account created by --dev when
+// the keystore is empty.
+const developerKeySeed = "gman developer"
+
 // SetEthConfig applies man-related command line flags to the config.
 func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 	// Avoid conflicting network flags
@@ -1049,6 +1450,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	setCheckpoint(ctx, cfg)
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1057,11 +1459,44 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
 	}
 	cfg.DatabaseHandles = makeDatabaseHandles()
+	cfg.Freezer = ctx.GlobalBool(FreezerFlag.Name)
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
+	}
+	if ctx.GlobalIsSet(FreezerThresholdFlag.Name) {
+		cfg.FreezerThreshold = ctx.GlobalUint64(FreezerThresholdFlag.Name)
+	}
 
 	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	cfg.NoPreimages = ctx.GlobalBool(CacheNoPreimagesFlag.Name)
+	cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
+	cfg.Snapshot = ctx.GlobalBool(SnapshotFlag.Name)
+	cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	cfg.SenderTxIndex = ctx.GlobalBool(SenderTxIndexFlag.Name)
+	cfg.ReceiptExtras = ctx.GlobalBool(ReceiptExtrasFlag.Name)
+	if ctx.GlobalIsSet(SlowBlockFlag.Name) {
+		cfg.SlowBlockThreshold = ctx.GlobalDuration(SlowBlockFlag.Name)
+	}
+	cfg.PropagationTrace = ctx.GlobalBool(PropagationTraceFlag.Name)
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCFilterTimeoutFlag.Name) {
+		cfg.FilterTimeout = ctx.GlobalDuration(RPCFilterTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCFilterLimitFlag.Name) {
+		cfg.FilterLimit = ctx.GlobalInt(RPCFilterLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCStateRegenFlag.Name) {
+		cfg.StateRegenLimit = ctx.GlobalUint64(RPCStateRegenFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCGasCapFlag.Name) {
+		cfg.RPCGasCap = ctx.GlobalUint64(RPCGasCapFlag.Name)
+	}
+	cfg.ChainOverrides = MakeChainOverrides(ctx)
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -1078,6 +1513,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 	if ctx.GlobalIsSet(GasPriceFlag.Name) {
 		cfg.GasPrice = GlobalBig(ctx, GasPriceFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerGasLimitFlag.Name) {
+		cfg.GasLimit = ctx.GlobalUint64(MinerGasLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerTxOrderingFlag.Name) {
+		cfg.TxOrdering = ctx.GlobalString(MinerTxOrderingFlag.Name)
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
@@ -1104,7 +1545,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 		if accs := ks.Accounts(); len(accs) > 0 {
 			developer = ks.Accounts()[0]
 		} else {
-			developer, err = ks.NewAccount("")
+			// Derive the account from a well known seed so developer chains are reproducible
+			key, _ := crypto.ToECDSA(crypto.Keccak256([]byte(developerKeySeed)))
+			developer, err = ks.ImportECDSA(key, "")
 			if err != nil {
 				Fatalf("Failed to create developer account: %v", err)
 			}
@@ -1114,7 +1557,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *man.Config) {
 		}
 		log.Info("Using developer account", "address", developer.Address)
 
-		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), developer.Address)
+		var prefund []common.Address
+		if list := ctx.GlobalString(DeveloperPrefundFlag.Name); list != "" {
+			for _, account := range strings.Split(list, ",") {
+				if account = strings.TrimSpace(account); !common.IsHexAddress(account) {
+					Fatalf("Invalid pre-funded developer account %q", account)
+				}
+				prefund = append(prefund, common.HexToAddress(account))
+			}
+		}
+		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), developer.Address, prefund...)
 		if !ctx.GlobalIsSet(GasPriceFlag.Name) {
 			cfg.GasPrice = big.NewInt(1)
 		}
@@ -1187,14 +1639,75 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	}
 }
 
+// RegisterGraphQLService configures the GraphQL query endpoint from the
+// command line flags and adds it to the given node.
+func RegisterGraphQLService(ctx *cli.Context, stack *node.Node) {
+	var (
+		endpoint = fmt.Sprintf("%s:%d", ctx.GlobalString(GraphQLListenAddrFlag.Name), ctx.GlobalInt(GraphQLPortFlag.Name))
+		cors     = splitAndTrim(ctx.GlobalString(GraphQLCORSDomainFlag.Name))
+		vhosts   = splitAndTrim(ctx.GlobalString(GraphQLVirtualHostsFlag.Name))
+	)
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Serve from the full node if running, falling back to the light client
+		var manServ *man.Matrix
+		if err := ctx.Service(&manServ); err == nil {
+			return graphql.New(manServ.APIBackend, endpoint, cors, vhosts)
+		}
+		var lesServ *les.LightMatrix
+		if err := ctx.Service(&lesServ); err == nil {
+			return graphql.New(lesServ.ApiBackend, endpoint, cors, vhosts)
+		}
+		return nil, errors.New("no Matrix service to serve GraphQL queries from")
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
 // SetupNetwork configures the system for either the main net or some test network.
 func SetupNetwork(ctx *cli.Context) {
 	// TODO(fjl): move target gas limit into config
 	params.TargetGasLimit = ctx.GlobalUint64(TargetGasLimitFlag.Name)
 }
 
+// SetupMetrics starts the configured metrics exporters if metrics collection is
+// enabled: a stand-alone HTTP server to be scraped by Prometheus and/or a pusher
+// reporting to InfluxDB.
+func SetupMetrics(ctx *cli.Context) {
+	if !metrics.Enabled {
+		return
+	}
+	log.Info("Enabling metrics collection")
+	if ctx.GlobalBool(MetricsEnableInfluxDBFlag.Name) {
+		var (
+			endpoint = ctx.GlobalString(MetricsInfluxDBEndpointFlag.Name)
+			database = ctx.GlobalString(MetricsInfluxDBDatabaseFlag.Name)
+			username = ctx.GlobalString(MetricsInfluxDBUsernameFlag.Name)
+			password = ctx.GlobalString(MetricsInfluxDBPasswordFlag.Name)
+			tags     = SplitTagsFlag(ctx.GlobalString(MetricsInfluxDBTagsFlag.Name))
+		)
+		log.Info("Enabling metrics export to InfluxDB", "endpoint", endpoint, "database", database)
+		go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, 10*time.Second, endpoint, database, username, password, "gman.", tags)
+	}
+	if ctx.GlobalIsSet(MetricsHTTPFlag.Name) {
+		exp.Setup(fmt.Sprintf("%s:%d", ctx.GlobalString(MetricsHTTPFlag.Name), ctx.GlobalInt(MetricsPortFlag.Name)))
+	}
+}
+
+// SplitTagsFlag parses a comma separated list of key=value tags, skipping the
+// malformed ones.
+func SplitTagsFlag(tagsFlag string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(tagsFlag, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(tag), "=", 2); len(kv) == 2 && kv[0] != "" {
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return tags
+}
+
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
-func MakeChainDatabase(ctx *cli.Context, stack *node.Node) mandb.Database {
+// A read-only database is never written to, not even by an attached freezer.
+func MakeChainDatabase(ctx *cli.Context, stack *node.Node, readonly bool) mandb.Database {
 	var (
 		cache   = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
 		handles = makeDatabaseHandles()
@@ -1203,7 +1716,15 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) mandb.Database {
 	if ctx.GlobalBool(LightModeFlag.Name) {
 		name = "lightchaindata"
 	}
-	chainDb, err := stack.OpenDatabase(name, cache, handles)
+	var (
+		chainDb mandb.Database
+		err     error
+	)
+	if ctx.GlobalBool(FreezerFlag.Name) {
+		chainDb, err = stack.OpenDatabaseWithFreezer(name, cache, handles, ctx.GlobalString(AncientFlag.Name), "", ctx.GlobalUint64(FreezerThresholdFlag.Name), readonly)
+	} else {
+		chainDb, err = stack.OpenDatabase(name, cache, handles, readonly)
+	}
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
@@ -1223,13 +1744,89 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 	return genesis
 }
 
-// MakeChain creates a chain manager from set command line flags.
-func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chainDb mandb.Database) {
-	var err error
-	chainDb = MakeChainDatabase(ctx, stack)
-
-	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx))
+// setCheckpoint parses the operator supplied trusted checkpoint, if any.
+func setCheckpoint(ctx *cli.Context, cfg *man.Config) {
+	if !ctx.GlobalIsSet(CheckpointFlag.Name) {
+		return
+	}
+	parts := strings.Split(ctx.GlobalString(CheckpointFlag.Name), ",")
+	if len(parts) != 4 {
+		Fatalf("Invalid --%s %q, want <section>,<sectionhead>,<chtroot>,<bloomroot>", CheckpointFlag.Name, ctx.GlobalString(CheckpointFlag.Name))
+	}
+	section, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
 	if err != nil {
+		Fatalf("Invalid --%s section index %q: %v", CheckpointFlag.Name, parts[0], err)
+	}
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: section,
+		SectionHead:  common.HexToHash(strings.TrimSpace(parts[1])),
+		CHTRoot:      common.HexToHash(strings.TrimSpace(parts[2])),
+		BloomRoot:    common.HexToHash(strings.TrimSpace(parts[3])),
+	}
+	if checkpoint.Empty() {
+		Fatalf("Invalid --%s, all roots must be non-zero", CheckpointFlag.Name)
+	}
+	cfg.Checkpoint = checkpoint
+}
+
+// MakeChainOverrides collects the fork activation overrides set on the command
+// line, returning nil if there are none.
+func MakeChainOverrides(ctx *cli.Context) *core.ChainOverrides {
+	var (
+		overrides core.ChainOverrides
+		set       bool
+	)
+	for _, override := range []struct {
+		flag  cli.Uint64Flag
+		field **big.Int
+	}{
+		{OverrideHomesteadFlag, &overrides.Homestead},
+		{OverrideEIP150Flag, &overrides.EIP150},
+		{OverrideEIP155Flag, &overrides.EIP155},
+		{OverrideEIP158Flag, &overrides.EIP158},
+		{OverrideByzantiumFlag, &overrides.Byzantium},
+		{OverrideConstantinopleFlag, &overrides.Constantinople},
+	} {
+		if ctx.GlobalIsSet(override.flag.Name) {
+			*override.field = new(big.Int).SetUint64(ctx.GlobalUint64(override.flag.Name))
+			set = true
+		}
+	}
+	if ctx.GlobalIsSet(OverrideVMUpgradesFlag.Name) {
+		overrides.VMUpgrades = make(map[string]*big.Int)
+		for _, entry := range strings.Split(ctx.GlobalString(OverrideVMUpgradesFlag.Name), ",") {
+			parts := strings.Split(strings.TrimSpace(entry), "=")
+			if len(parts) != 2 {
+				Fatalf("Invalid --%s entry %q, want name=block", OverrideVMUpgradesFlag.Name, entry)
+			}
+			block, ok := new(big.Int).SetString(parts[1], 10)
+			if !ok {
+				Fatalf("Invalid --%s block number %q", OverrideVMUpgradesFlag.Name, parts[1])
+			}
+			overrides.VMUpgrades[parts[0]] = block
+		}
+		set = true
+	}
+	if !set {
+		return nil
+	}
+	return &overrides
+}
+
+// MakeChain creates a chain manager from set command line flags. A read-only
+// chain can only be used for retrievals, its genesis must already be stored.
+func MakeChain(ctx *cli.Context, stack *node.Node, readonly bool) (chain *core.BlockChain, chainDb mandb.Database) {
+	var (
+		config *params.ChainConfig
+		err    error
+	)
+	chainDb = MakeChainDatabase(ctx, stack, readonly)
+
+	if readonly {
+		if config = rawdb.ReadChainConfig(chainDb, rawdb.ReadCanonicalHash(chainDb, 0)); config == nil {
+			Fatalf("No chain configuration found in database")
+		}
+	} else if config, _, err = core.SetupGenesisBlockWithOverride(chainDb, MakeGenesis(ctx), MakeChainOverrides(ctx)); err != nil {
 		Fatalf("%v", err)
 	}
 	var engine consensus.Engine
@@ -1253,6 +1850,14 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	}
 	cache := &core.CacheConfig{
 		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
+		NoPreimages:   ctx.GlobalBool(CacheNoPreimagesFlag.Name),
+		NoPrefetch:    ctx.GlobalBool(CacheNoPrefetchFlag.Name),
+		ReadOnly:      readonly,
+		Snapshot:      ctx.GlobalBool(SnapshotFlag.Name),
+		StateDiffs:    ctx.GlobalBool(StateDiffsFlag.Name),
+		SenderTxIndex: ctx.GlobalBool(SenderTxIndexFlag.Name),
+		ReceiptExtras: ctx.GlobalBool(ReceiptExtrasFlag.Name),
+		TxLookupLimit: ctx.GlobalUint64(TxLookupLimitFlag.Name),
 		TrieNodeLimit: man.DefaultConfig.TrieCache,
 		TrieTimeLimit: man.DefaultConfig.TrieTimeout,
 	}
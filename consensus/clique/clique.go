@@ -653,8 +653,13 @@ func (c *Clique) Seal(chain consensus.ChainReader, header *types.Header, stop <-
 	}
 	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
 
-	//return block.WithSeal(header), nil
-	//todo 在改为加入难度列表，返回header后，clique共识如何处理？
+	// The header is signed in place, report it to the caller if it asked for it
+	if foundMsgCh != nil {
+		select {
+		case foundMsgCh <- &consensus.FoundMsg{Header: header, Difficulty: header.Difficulty}:
+		case <-stop:
+		}
+	}
 	return nil
 }
 
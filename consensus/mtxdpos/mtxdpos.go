@@ -91,6 +91,30 @@ func (md *MtxDPOS) VerifyBlock(header *types.Header) error {
 	return err
 }
 
+// CertifiesBlock reports whether the signatures of a header form a quorum of the
+// validators elected for it, without logging the rejected signatures. An error
+// is only returned if the validators could not be looked up, in which case the
+// header can neither be accepted nor rejected yet.
+func (md *MtxDPOS) CertifiesBlock(header *types.Header) (bool, error) {
+	if common.IsBroadcastNumber(header.Number.Uint64()) {
+		return md.verifyBroadcastBlock(header) == nil, nil
+	}
+	stocks, err := md.getValidatorStocks(header.Number.Uint64())
+	if err != nil {
+		return false, err
+	}
+	target, err := md.calculateDPOSTarget(stocks)
+	if err != nil || len(header.Signatures) < target.targetCount {
+		return false, nil
+	}
+	verifiedSigns := md.verifySigns(header.HashNoSignsAndNonce(), header.Signatures, stocks, true)
+	if len(verifiedSigns) < target.targetCount {
+		return false, nil
+	}
+	_, err = md.verifyDPOS(verifiedSigns, target)
+	return err == nil, nil
+}
+
 func (md *MtxDPOS) VerifyHash(signHash common.Hash, signs []common.Signature) ([]common.Signature, error) {
 	return md.VerifyHashWithNumber(signHash, signs, md.chain.CurrentHeader().Number.Uint64())
 }
@@ -120,7 +144,7 @@ func (md *MtxDPOS) VerifyHashWithStocks(signHash common.Hash, signs []common.Sig
 		return nil, errSignCountErr
 	}
 
-	verifiedSigns := md.verifySigns(signHash, signs, stocks)
+	verifiedSigns := md.verifySigns(signHash, signs, stocks, false)
 	if len(verifiedSigns) < target.targetCount {
 		log.ERROR("共识引擎", "验证后的签名数量不足 size", len(signs), "target", target.targetCount)
 		return nil, errSignCountErr
@@ -211,26 +235,32 @@ func (md *MtxDPOS) parseVerifiedSigns(verifiedSigns []*common.VerifiedSign, stoc
 	return verifiedSign
 }
 
-func (md *MtxDPOS) verifySigns(signHash common.Hash, signs []common.Signature, stocks map[common.Address]uint16) map[common.Address]*common.VerifiedSign {
+func (md *MtxDPOS) verifySigns(signHash common.Hash, signs []common.Signature, stocks map[common.Address]uint16, quiet bool) map[common.Address]*common.VerifiedSign {
 	verifiedSign := make(map[common.Address]*common.VerifiedSign)
 	signCount := len(signs)
 	for i := 0; i < signCount; i++ {
 		sign := signs[i]
 		account, signValidate, err := crypto.VerifySignWithValidate(signHash.Bytes(), sign.Bytes())
 		if err != nil {
-			log.ERROR("共识引擎", "验证签名 错误", err)
+			if !quiet {
+				log.ERROR("共识引擎", "验证签名 错误", err)
+			}
 			continue
 		}
 
 		stock, findStock := stocks[account]
 		if findStock == false {
 			// can't find in stock, discard
-			log.ERROR("共识引擎", "验证签名 股权未找到 node", account.Hex(), "签名：", signHash)
+			if !quiet {
+				log.ERROR("共识引擎", "验证签名 股权未找到 node", account.Hex(), "签名：", signHash)
+			}
 			continue
 		}
 
 		if existData, exist := verifiedSign[account]; exist {
-			log.ERROR("共识引擎", "验证签名 重复签名 node", account.Hex())
+			if !quiet {
+				log.ERROR("共识引擎", "验证签名 重复签名 node", account.Hex())
+			}
 			//already exist, replace "disagree" sign with "agree" sign
 			if existData.Validate == false && signValidate == true {
 				existData.Sign = sign
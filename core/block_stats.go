@@ -0,0 +1,90 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/metrics"
+)
+
+var (
+	blockSendersTimer    = metrics.NewRegisteredTimer("chain/senders", nil)
+	blockExecutionTimer  = metrics.NewRegisteredTimer("chain/execution", nil)
+	blockHashingTimer    = metrics.NewRegisteredTimer("chain/hashing", nil)
+	blockValidationTimer = metrics.NewRegisteredTimer("chain/validation", nil)
+	blockCommitTimer     = metrics.NewRegisteredTimer("chain/commit", nil)
+	blockWriteTimer      = metrics.NewRegisteredTimer("chain/write", nil)
+)
+
+// blockStatsLimit is the number of recently imported blocks to keep the timing
+// breakdown for.
+const blockStatsLimit = 256
+
+// BlockStats is the timing breakdown of importing a single block. All durations
+// are reported in nanoseconds when marshalled to JSON.
+type BlockStats struct {
+	Number  uint64      `json:"number"`
+	Hash    common.Hash `json:"hash"`
+	Txs     int         `json:"txs"`
+	GasUsed uint64      `json:"gasUsed"`
+
+	Senders    time.Duration `json:"senders"`    // Waiting for the transaction senders to be recovered
+	Execution  time.Duration `json:"execution"`  // Running the transactions through the EVM
+	Hashing    time.Duration `json:"hashing"`    // Hashing the post state trie
+	Validation time.Duration `json:"validation"` // Checking gas, bloom, receipts and state root
+	Commit     time.Duration `json:"commit"`     // Committing the state into the trie database
+	Write      time.Duration `json:"write"`      // Writing the block data to disk, including reorgs
+	Total      time.Duration `json:"total"`      // Wall time from header verification to head update
+}
+
+// report updates the import timers with the block's breakdown and warns about
+// the block if its import took longer than the given threshold (0 = never).
+func (s *BlockStats) report(threshold time.Duration) {
+	blockSendersTimer.Update(s.Senders)
+	blockExecutionTimer.Update(s.Execution)
+	blockHashingTimer.Update(s.Hashing)
+	blockValidationTimer.Update(s.Validation)
+	blockCommitTimer.Update(s.Commit)
+	blockWriteTimer.Update(s.Write)
+
+	if threshold > 0 && s.Total > threshold {
+		log.Warn("Slow block imported", "number", s.Number, "hash", s.Hash, "txs", s.Txs, "gas", s.GasUsed,
+			"senders", common.PrettyDuration(s.Senders), "execution", common.PrettyDuration(s.Execution),
+			"hashing", common.PrettyDuration(s.Hashing), "validation", common.PrettyDuration(s.Validation),
+			"commit", common.PrettyDuration(s.Commit), "write", common.PrettyDuration(s.Write),
+			"total", common.PrettyDuration(s.Total))
+	}
+}
+
+// GetBlockStats returns the import timing breakdown of a recently processed
+// block, or nil if the block was not imported by this node recently.
+func (bc *BlockChain) GetBlockStats(hash common.Hash) *BlockStats {
+	if stats, ok := bc.blockStats.Get(hash); ok {
+		return stats.(*BlockStats)
+	}
+	return nil
+}
+
+// SetSlowBlockThreshold sets the import time above which a block's timing
+// breakdown is logged as a warning. Zero disables the warnings.
+func (bc *BlockChain) SetSlowBlockThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&bc.slowBlock, int64(threshold))
+}
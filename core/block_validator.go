@@ -131,3 +131,30 @@ func CalcGasLimit(parent *types.Block) uint64 {
 	}
 	return limit
 }
+
+// CalcGasLimitTarget computes the gas limit of the next block after parent,
+// moving it towards the desired limit by as much as the protocol allows for a
+// single block, regardless of the parent's gas usage.
+// This is miner strategy, not consensus protocol.
+func CalcGasLimitTarget(parent *types.Block, desired uint64) uint64 {
+	if desired < params.MinGasLimit {
+		desired = params.MinGasLimit
+	}
+	// delta = parentGasLimit / 1024 - 1, the largest change still accepted
+	delta := parent.GasLimit()/params.GasLimitBoundDivisor - 1
+
+	limit := parent.GasLimit()
+	switch {
+	case limit < desired:
+		limit += delta
+		if limit > desired {
+			limit = desired
+		}
+	case limit > desired:
+		limit -= delta
+		if limit < desired {
+			limit = desired
+		}
+	}
+	return limit
+}
@@ -197,3 +197,24 @@ func testHeaderConcurrentAbortion(t *testing.T, threads int) {
 		t.Errorf("verification count too large: have %d, want below %d", verified, 2*threads)
 	}
 }
+
+// Tests that the targeted gas limit moves towards the desired limit in both
+// directions, never by more than the protocol allows per block.
+func TestCalcGasLimitTarget(t *testing.T) {
+	tests := []struct {
+		parent, desired, want uint64
+	}{
+		{20000000, 20000000, 20000000},         // at target
+		{20000000, 30000000, 20000000 + 19530}, // capped increase
+		{20000000, 20010000, 20010000},         // reaches target
+		{20000000, 10000000, 20000000 - 19530}, // capped decrease
+		{20000000, 19990000, 19990000},         // reaches target
+		{params.MinGasLimit, 0, params.MinGasLimit},
+	}
+	for i, tt := range tests {
+		parent := types.NewBlockWithHeader(&types.Header{GasLimit: tt.parent})
+		if have := CalcGasLimitTarget(parent, tt.desired); have != tt.want {
+			t.Errorf("test %d: gas limit mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
@@ -33,11 +33,13 @@ import (
 
 	"github.com/matrix/go-matrix/ca"
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/common/mclock"
 	"github.com/matrix/go-matrix/consensus"
 	"github.com/matrix/go-matrix/consensus/mtxdpos"
 	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/core/state/snapshot"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/core/vm"
 	"github.com/matrix/go-matrix/crypto"
@@ -55,6 +57,15 @@ import (
 var (
 	blockInsertTimer = metrics.NewRegisteredTimer("chain/inserts", nil)
 
+	blockReorgMeter     = metrics.NewRegisteredMeter("chain/reorg/executes", nil)
+	blockReorgAddMeter  = metrics.NewRegisteredMeter("chain/reorg/add", nil)
+	blockReorgDropMeter = metrics.NewRegisteredMeter("chain/reorg/drop", nil)
+	blockReorgDepth     = metrics.NewRegisteredHistogram("chain/reorg/depth", nil, metrics.NewExpDecaySample(1028, 0.015))
+
+	blockUncleMeter = metrics.NewRegisteredMeter("chain/uncles", nil)
+	blockSideMeter  = metrics.NewRegisteredMeter("chain/side", nil)
+	blockBadMeter   = metrics.NewRegisteredMeter("chain/bad", nil)
+
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
 
@@ -63,8 +74,8 @@ const (
 	blockCacheLimit     = 256
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
-	badBlockLimit       = 10
 	triesInMemory       = 128
+	healStateNodes      = 4096 // Number of account trie nodes checked per head when healing after a crash
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
 	BlockChainVersion = 3
@@ -74,6 +85,14 @@ const (
 // that's resident in a blockchain.
 type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
+	NoPreimages   bool          // Whether to disable recording secure trie key preimages
+	NoPrefetch    bool          // Whether to disable heuristic state prefetching for followup blocks
+	ReadOnly      bool          // Whether the state tries must never be flushed to disk
+	Snapshot      bool          // Whether to maintain a flat state snapshot for fast state reads
+	StateDiffs    bool          // Whether to index the accounts and storage slots modified by each block
+	SenderTxIndex bool          // Whether to index the transactions of each block by sender
+	ReceiptExtras bool          // Whether to store the revert reason and internal transfers of each transaction
+	TxLookupLimit uint64        // Number of recent blocks to keep transaction lookup entries for (0 = all)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
 }
@@ -101,11 +120,12 @@ type BlockChain struct {
 	gcproc time.Duration  // Accumulates canonical block processing for trie dumping
 
 	hc            *HeaderChain
-	rmLogsFeed    event.Feed
-	chainFeed     event.Feed
-	chainSideFeed event.Feed
-	chainHeadFeed event.Feed
-	logsFeed      event.Feed
+	rmLogsFeed    event.FeedOf[RemovedLogsEvent]
+	chainFeed     event.FeedOf[ChainEvent]
+	chainSideFeed event.FeedOf[ChainSideEvent]
+	chainHeadFeed event.FeedOf[ChainHeadEvent]
+	reorgFeed     event.FeedOf[ChainReorgEvent]
+	logsFeed      event.FeedOf[[]*types.Log]
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -118,31 +138,37 @@ type BlockChain struct {
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
+	snaps        *snapshot.Tree // Flat state snapshot tree, nil if disabled
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks *lru.Cache     // future blocks are blocks added for later processing
+	blockStats   *lru.Cache     // Import timing breakdown of the most recent blocks
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
 	// procInterrupt must be atomically called
 	procInterrupt int32          // interrupt signaler for block processing
+	slowBlock     int64          // import time above which blocks are logged (atomic, nanoseconds)
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
 	engine     consensus.Engine
 	dposEngine consensus.DPOSEngine
-	processor  Processor // block processor interface
-	validator  Validator // block and state validator interface
+	prefetcher Prefetcher // block state prefetcher interface
+	processor  Processor  // block processor interface
+	validator  Validator  // block and state validator interface
 	vmConfig   vm.Config
 
-	badBlocks *lru.Cache // Bad block cache
-	msgceter  *mc.Center
+	msgceter *mc.Center
 }
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Matrix Validator and
 // Processor.
 func NewBlockChain(db mandb.Database, cacheConfig *CacheConfig, chainConfig *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config) (*BlockChain, error) {
+	if err := vm.ValidateUpgrades(chainConfig); err != nil {
+		return nil, err
+	}
 	if cacheConfig == nil {
 		cacheConfig = &CacheConfig{
 			TrieNodeLimit: 256 * 1024 * 1024,
@@ -153,25 +179,26 @@ func NewBlockChain(db mandb.Database, cacheConfig *CacheConfig, chainConfig *par
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
-	badBlocks, _ := lru.New(badBlockLimit)
+	blockStats, _ := lru.New(blockStatsLimit)
 
 	bc := &BlockChain{
 		chainConfig:  chainConfig,
 		cacheConfig:  cacheConfig,
 		db:           db,
 		triegc:       prque.New(),
-		stateCache:   state.NewDatabase(db),
+		stateCache:   state.NewDatabaseWithConfig(db, &trie.Config{Preimages: !cacheConfig.NoPreimages, ReadOnly: cacheConfig.ReadOnly}),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
 		blockCache:   blockCache,
 		futureBlocks: futureBlocks,
+		blockStats:   blockStats,
 		engine:       engine,
 		vmConfig:     vmConfig,
-		badBlocks:    badBlocks,
 	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
+	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 
 	bc.dposEngine = mtxdpos.NewMtxDPOS(bc)
 
@@ -184,9 +211,17 @@ func NewBlockChain(db mandb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if bc.genesisBlock == nil {
 		return nil, ErrNoGenesis
 	}
+	// Detect whether the previous session crashed before flushing its state
+	crashed := rawdb.ReadUncleanShutdownMarker(db)
+	if crashed != nil {
+		log.Warn("Unclean shutdown detected", "booted", time.Unix(int64(*crashed), 0))
+	}
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	if crashed != nil && !cacheConfig.ReadOnly {
+		bc.healState()
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -200,6 +235,41 @@ func NewBlockChain(db mandb.Database, cacheConfig *CacheConfig, chainConfig *par
 			}
 		}
 	}
+	// Load the flat state snapshot, regenerating it in the background if needed
+	if cacheConfig.Snapshot && !cacheConfig.ReadOnly {
+		if bc.snaps, err = snapshot.New(db, bc.stateCache.TrieDB(), bc.CurrentBlock().Root()); err != nil {
+			log.Warn("Failed to enable state snapshot", "err", err)
+		} else if crashed != nil {
+			// The persisted layer might be ahead of or half way into the head, redo it
+			bc.snaps.Rebuild(bc.CurrentBlock().Root())
+		}
+	}
+	// Drop the transaction lookup entries of old blocks if requested
+	if cacheConfig.TxLookupLimit > 0 && !cacheConfig.ReadOnly {
+		bc.wg.Add(1)
+		go bc.maintainTxIndex()
+	}
+	// Index new blocks by sender and backfill the older ones if requested
+	if !cacheConfig.ReadOnly {
+		tail := rawdb.ReadSenderTxIndexTail(db)
+		switch {
+		case cacheConfig.SenderTxIndex && tail == nil:
+			head := bc.CurrentBlock().NumberU64() + 1
+			rawdb.WriteSenderTxIndexTail(db, head)
+			tail = &head
+			fallthrough
+		case cacheConfig.SenderTxIndex && *tail > 0:
+			bc.wg.Add(1)
+			go bc.backfillSenderTxIndex(*tail)
+		case !cacheConfig.SenderTxIndex && tail != nil:
+			// Blocks imported from now on leave gaps, start over once re-enabled
+			rawdb.DeleteSenderTxIndexTail(db)
+		}
+	}
+	// Flag the database as in use until the state is flushed on shutdown
+	if !cacheConfig.ReadOnly {
+		rawdb.WriteUncleanShutdownMarker(db, uint64(time.Now().Unix()))
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
@@ -273,18 +343,70 @@ func (bc *BlockChain) loadLastState() error {
 // though, the head may be further rewound if block bodies are missing (non-archive
 // nodes after a fast sync).
 func (bc *BlockChain) SetHead(head uint64) error {
+	_, err := bc.Rewind(head)
+	return err
+}
+
+// Rewind rewinds the local chain to a new head like SetHead, returning the
+// transactions of the rewound canonical blocks so they can be reinjected into
+// the transaction pool. Their lookup, sender index and receipt entries are
+// deleted along with the blocks, and the cached tries of the rewound blocks are
+// released.
+func (bc *BlockChain) Rewind(head uint64) (types.Transactions, error) {
 	log.Warn("Rewinding blockchain", "target", head)
 
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Rewind the header chain, deleting all block bodies until then
+	// Rewind the header chain, deleting all block bodies and their indexes until then
+	var rewound types.Transactions
 	delFn := func(hash common.Hash, num uint64) {
+		if block := bc.GetBlock(hash, num); block != nil {
+			for _, tx := range block.Transactions() {
+				rawdb.DeleteTxLookupEntry(bc.db, tx.Hash())
+			}
+			if bc.cacheConfig.SenderTxIndex {
+				rawdb.DeleteSenderTxEntries(bc.db, types.MakeSigner(bc.chainConfig, block.Number()), block)
+			}
+			rewound = append(block.Transactions(), rewound...)
+		}
+		rawdb.DeleteReceipts(bc.db, hash, num)
+		rawdb.DeleteReceiptExtras(bc.db, hash, num)
+		rawdb.DeleteStateDiff(bc.db, hash, num)
 		rawdb.DeleteBody(bc.db, hash, num)
 	}
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Release the cached tries of the rewound blocks, they won't be gc'd otherwise
+	if !bc.cacheConfig.Disabled {
+		var (
+			triedb = bc.stateCache.TrieDB()
+			kept   []common.Hash
+			prios  []float32
+		)
+		for !bc.triegc.Empty() {
+			root, number := bc.triegc.Pop()
+			if uint64(-number) > head {
+				triedb.Dereference(root.(common.Hash))
+				continue
+			}
+			kept, prios = append(kept, root.(common.Hash)), append(prios, number)
+		}
+		for i, root := range kept {
+			bc.triegc.Push(root, prios[i])
+		}
+	}
+
+	// Frozen blocks can't be deleted one by one, drop all above the new head at once
+	if ancients, ok := bc.db.(mandb.AncientStore); ok {
+		if frozen, _ := ancients.Ancients(); frozen > head+1 {
+			if err := ancients.TruncateAncients(head + 1); err != nil {
+				log.Error("Failed to truncate ancient blocks", "target", head+1, "err", err)
+			}
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -318,7 +440,14 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	rawdb.WriteHeadBlockHash(bc.db, currentBlock.Hash())
 	rawdb.WriteHeadFastBlockHash(bc.db, currentFastBlock.Hash())
 
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return nil, err
+	}
+	// The snapshot can't be rewound, regenerate it for the new head
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(bc.CurrentBlock().Root())
+	}
+	return rewound, nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -358,6 +487,23 @@ func (bc *BlockChain) CurrentFastBlock() *types.Block {
 	return bc.currentFastBlock.Load().(*types.Block)
 }
 
+// CurrentSafeBlock retrieves the newest canonical block carrying a quorum of
+// validator signatures, or the genesis block if there is none. Proof-of-authority
+// chains report their head block.
+func (bc *BlockChain) CurrentSafeBlock() *types.Block {
+	header := bc.hc.SafeHeader(bc.CurrentBlock().Header())
+	return bc.GetBlock(header.Hash(), header.Number.Uint64())
+}
+
+// CurrentFinalizedBlock retrieves the newest canonical block carrying a quorum
+// of validator signatures that a later certified block builds upon, or the
+// genesis block if there is none. Proof-of-authority chains report their head
+// block.
+func (bc *BlockChain) CurrentFinalizedBlock() *types.Block {
+	header := bc.hc.FinalizedHeader(bc.CurrentBlock().Header())
+	return bc.GetBlock(header.Hash(), header.Number.Uint64())
+}
+
 // SetProcessor sets the processor required for making state modifications.
 func (bc *BlockChain) SetProcessor(processor Processor) {
 	bc.procmu.Lock()
@@ -391,9 +537,26 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 	return bc.StateAt(bc.CurrentBlock().Root())
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, bc.stateCache)
+	statedb, err := state.NewWithSnapshot(root, bc.stateCache, bc.snaps)
+	if err != nil {
+		return nil, err
+	}
+	if bc.cacheConfig.StateDiffs {
+		statedb.TrackModifications()
+	}
+	return statedb, nil
+}
+
+// Snapshots returns the flat state snapshot tree, or nil if it's disabled.
+func (bc *BlockChain) Snapshots() *snapshot.Tree {
+	return bc.snaps
 }
 
 // Reset purges the entire blockchain, restoring it to its genesis state.
@@ -445,6 +608,51 @@ func (bc *BlockChain) repair(head **types.Block) error {
 	}
 }
 
+// healState walks the account trie of the current head after an unclean shutdown,
+// rewinding the chain to the first block with a complete state if nodes are found
+// missing. Rewinding is limited to the states kept in memory, as older ones were
+// fully committed before the crash.
+func (bc *BlockChain) healState() {
+	head := bc.CurrentBlock()
+	for i := 0; i < triesInMemory && head.NumberU64() > 0; i++ {
+		err := bc.checkState(head.Root())
+		if err == nil {
+			break
+		}
+		log.Warn("Head state incomplete, rewinding", "number", head.Number(), "hash", head.Hash(), "err", err)
+		head = bc.GetBlock(head.ParentHash(), head.NumberU64()-1)
+		if err := bc.repair(&head); err != nil {
+			log.Error("Failed to repair chain state", "err", err)
+			return
+		}
+	}
+	if head.Hash() == bc.CurrentBlock().Hash() {
+		return
+	}
+	rawdb.WriteHeadBlockHash(bc.db, head.Hash())
+	bc.currentBlock.Store(head)
+	if bc.CurrentFastBlock().NumberU64() > head.NumberU64() {
+		rawdb.WriteHeadFastBlockHash(bc.db, head.Hash())
+		bc.currentFastBlock.Store(head)
+	}
+	log.Info("Healed state after unclean shutdown", "number", head.Number(), "hash", head.Hash())
+}
+
+// checkState resolves the root and the first healStateNodes nodes of the account
+// trie with the given root, returning the first missing one. The walk is bounded
+// to keep startup fast on large states; deeper gaps are left to the snapshot
+// rebuild and the regular missing-node handling.
+func (bc *BlockChain) checkState(root common.Hash) error {
+	tr, err := bc.stateCache.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for i := 0; i < healStateNodes && it.Next(true); i++ {
+	}
+	return it.Error()
+}
+
 // Export writes the active chain to the given writer.
 func (bc *BlockChain) Export(w io.Writer) error {
 	return bc.ExportN(w, uint64(0), bc.CurrentBlock().NumberU64())
@@ -614,6 +822,12 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	return rawdb.ReadReceipts(bc.db, hash, *number)
 }
 
+// GetStateDiff retrieves the accounts and storage slots modified by a block
+// from the database, or nil if the block was not indexed.
+func (bc *BlockChain) GetStateDiff(hash common.Hash, number uint64) types.StateDiff {
+	return rawdb.ReadStateDiff(bc.db, hash, number)
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by man/62]
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
@@ -663,12 +877,19 @@ func (bc *BlockChain) Stop() {
 
 	bc.wg.Wait()
 
+	// Persist the snapshot at the head, matching the head state committed below
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to persist state snapshot", "err", err)
+		}
+		bc.snaps.Stop()
+	}
 	// Ensure the state of a recent block is also stored to disk before exiting.
 	// We're writing three different states to catch different restart scenarios:
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.Disabled {
+	if !bc.cacheConfig.Disabled && !bc.cacheConfig.ReadOnly {
 		triedb := bc.stateCache.TrieDB()
 
 		for _, offset := range []uint64{0, 1, triesInMemory - 1} {
@@ -682,12 +903,15 @@ func (bc *BlockChain) Stop() {
 			}
 		}
 		for !bc.triegc.Empty() {
-			triedb.Dereference(bc.triegc.PopItem().(common.Hash), common.Hash{})
+			triedb.Dereference(bc.triegc.PopItem().(common.Hash))
 		}
 		if size := triedb.Size(); size != 0 {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
 	}
+	if !bc.cacheConfig.ReadOnly {
+		rawdb.DeleteUncleanShutdownMarker(bc.db)
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -826,6 +1050,7 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 		rawdb.WriteBody(batch, block.Hash(), block.NumberU64(), block.Body())
 		rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
 		rawdb.WriteTxLookupEntries(batch, block)
+		bc.writeSenderTxEntries(batch, block)
 
 		stats.processed++
 
@@ -885,9 +1110,18 @@ func (bc *BlockChain) WriteBlockWithoutState(block *types.Block, td *big.Int) (e
 
 // WriteBlockWithState writes the block and all associated state to the database.
 func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
+	return bc.writeBlockWithState(block, receipts, state, nil)
+}
+
+// writeBlockWithState writes the block and all associated state to the database,
+// recording the time spent committing the state and writing to disk into stats
+// if it's non-nil.
+func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB, stats *BlockStats) (status WriteStatus, err error) {
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
+	start := time.Now()
+
 	// Calculate the total difficulty of the block
 	ptd := bc.GetTd(block.ParentHash(), block.NumberU64()-1)
 	if ptd == nil {
@@ -909,10 +1143,20 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	batch := bc.db.NewBatch()
 	rawdb.WriteBlock(batch, block)
 
+	commitStart := time.Now()
 	root, err := state.Commit(bc.chainConfig.IsEIP158(block.Number()))
 	if err != nil {
 		return NonStatTy, err
 	}
+	if diff := state.Modified(); diff != nil && bc.cacheConfig.StateDiffs {
+		rawdb.WriteStateDiff(batch, block.Hash(), block.NumberU64(), diff)
+	}
+	// Keep the snapshot diffs in line with the tries retained in memory
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(root, triesInMemory-1); err != nil {
+			log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+		}
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -926,33 +1170,29 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		bc.triegc.Push(root, -float32(block.NumberU64()))
 
 		if current := block.NumberU64(); current > triesInMemory {
-			// Find the next state trie we need to commit
-			header := bc.GetHeaderByNumber(current - triesInMemory)
-			chosen := header.Number.Uint64()
-
-			// Only write to disk if we exceeded our memory allowance *and* also have at
-			// least a given number of tries gapped.
+			// If we exceeded our memory allowance, flush matured singleton nodes to disk
 			var (
 				size  = triedb.Size()
 				limit = common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
 			)
-			if size > limit || bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+			if size > limit {
+				triedb.Cap(limit - mandb.IdealBatchSize)
+			}
+			// Find the next state trie we need to commit
+			header := bc.GetHeaderByNumber(current - triesInMemory)
+			chosen := header.Number.Uint64()
+
+			// If we exceeded out time allowance, flush an entire trie to disk
+			if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
 				// If we're exceeding limits but haven't reached a large enough memory gap,
 				// warn the user that the system is becoming unstable.
-				if chosen < lastWrite+triesInMemory {
-					switch {
-					case size >= 2*limit:
-						log.Warn("State memory usage too high, committing", "size", size, "limit", limit, "optimum", float64(chosen-lastWrite)/triesInMemory)
-					case bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit:
-						log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
-					}
-				}
-				// If optimum or critical limits reached, write to disk
-				if chosen >= lastWrite+triesInMemory || size >= 2*limit || bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
-					triedb.Commit(header.Root, true)
-					lastWrite = chosen
-					bc.gcproc = 0
+				if chosen < lastWrite+triesInMemory && bc.gcproc >= 2*bc.cacheConfig.TrieTimeLimit {
+					log.Info("State in memory for too long, committing", "time", bc.gcproc, "allowance", bc.cacheConfig.TrieTimeLimit, "optimum", float64(chosen-lastWrite)/triesInMemory)
 				}
+				// Flush an entire trie and restart the counters
+				triedb.Commit(header.Root, true)
+				lastWrite = chosen
+				bc.gcproc = 0
 			}
 			// Garbage collect anything below our required write retention
 			for !bc.triegc.Empty() {
@@ -961,11 +1201,17 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 					bc.triegc.Push(root, number)
 					break
 				}
-				triedb.Dereference(root.(common.Hash), common.Hash{})
+				triedb.Dereference(root.(common.Hash))
 			}
 		}
 	}
+	if stats != nil {
+		stats.Commit = time.Since(commitStart)
+	}
 	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+	if bc.cacheConfig.ReceiptExtras {
+		rawdb.WriteReceiptExtras(batch, block.Hash(), block.NumberU64(), receipts)
+	}
 
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
@@ -985,6 +1231,7 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		}
 		// Write the positional metadata for transaction/receipt lookups and preimages
 		rawdb.WriteTxLookupEntries(batch, block)
+		bc.writeSenderTxEntries(batch, block)
 		rawdb.WritePreimages(batch, block.NumberU64(), state.Preimages())
 
 		status = CanonStatTy
@@ -1000,6 +1247,10 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		bc.insert(block)
 	}
 	bc.futureBlocks.Remove(block.Hash())
+
+	if stats != nil {
+		stats.Write = time.Since(start) - stats.Commit
+	}
 	return status, nil
 }
 
@@ -1159,6 +1410,12 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
+	// Start recovering the transaction senders in the background, so the serial
+	// processing below finds them in the signature caches
+	if len(chain) > 0 {
+		senderCacher.recoverFromBlocks(types.MakeSigner(bc.chainConfig, chain[0].Number()), chain)
+	}
+
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 
@@ -1278,10 +1535,31 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		} else {
 			parent = chain[i-1]
 		}
-		state, err := state.New(parent.Root(), bc.stateCache)
+		state, err := bc.StateAt(parent.Root())
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		// If we have a followup block, run that against the current state to pre-cache
+		// the accounts and storage slots it touches while this block is processed
+		var followupInterrupt uint32
+		if !bc.cacheConfig.NoPrefetch && i+1 < len(chain) {
+			throwaway := state.Copy()
+			go bc.prefetcher.Prefetch(chain[i+1], throwaway, bc.vmConfig, &followupInterrupt)
+		}
+		bstats := &BlockStats{
+			Number:  block.NumberU64(),
+			Hash:    block.Hash(),
+			Txs:     len(block.Transactions()),
+			GasUsed: block.GasUsed(),
+		}
+		// Wait for the background sender recovery to reach this block's transactions
+		substart := time.Now()
+		signer := types.MakeSigner(bc.chainConfig, block.Number())
+		for _, tx := range block.Transactions() {
+			types.Sender(signer, tx)
+		}
+		bstats.Senders = time.Since(substart)
+
 		// Process block using the parent state as reference point.
 		//todo: add handleuptime
 		//header := block.Header()
@@ -1304,24 +1582,38 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 						return i, events, coalescedLogs, err
 					}
 				}*/
+		substart = time.Now()
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
+		atomic.StoreUint32(&followupInterrupt, 1)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
+		bstats.Execution = time.Since(substart)
+
+		// Hash the post state up front so validation doesn't hide the trie hashing cost
+		substart = time.Now()
+		state.IntermediateRoot(bc.chainConfig.IsEIP158(block.Number()))
+		bstats.Hashing = time.Since(substart)
+
 		// Validate the state using the default validator
+		substart = time.Now()
 		err = bc.Validator().ValidateState(block, parent, state, receipts, usedGas)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
+		bstats.Validation = time.Since(substart)
 		proctime := time.Since(bstart)
 
 		// Write the block to the chain and get the status.
-		status, err := bc.WriteBlockWithState(block, receipts, state)
+		status, err := bc.writeBlockWithState(block, receipts, state, bstats)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		bstats.Total = time.Since(bstart)
+		bstats.report(time.Duration(atomic.LoadInt64(&bc.slowBlock)))
+		bc.blockStats.Add(block.Hash(), bstats)
 		switch status {
 		case CanonStatTy:
 			log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(), "uncles", len(block.Uncles()),
@@ -1329,6 +1621,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 
 			coalescedLogs = append(coalescedLogs, logs...)
 			blockInsertTimer.UpdateSince(bstart)
+			blockUncleMeter.Mark(int64(len(block.Uncles())))
 			events = append(events, ChainEvent{block, block.Hash(), logs})
 			lastCanon = block
 
@@ -1340,6 +1633,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 				common.PrettyDuration(time.Since(bstart)), "txs", len(block.Transactions()), "gas", block.GasUsed(), "uncles", len(block.Uncles()))
 
 			blockInsertTimer.UpdateSince(bstart)
+			blockSideMeter.Mark(1)
 			events = append(events, ChainSideEvent{block})
 		}
 		stats.processed++
@@ -1408,6 +1702,8 @@ func countTransactions(chain []*types.Block) (c int) {
 // event about them
 func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	var (
+		oldHead     = oldBlock
+		newHead     = newBlock
 		newChain    types.Blocks
 		oldChain    types.Blocks
 		commonBlock *types.Block
@@ -1482,9 +1778,21 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		}
 		logFn("Chain split detected", "number", commonBlock.Number(), "hash", commonBlock.Hash(),
 			"drop", len(oldChain), "dropfrom", oldChain[0].Hash(), "add", len(newChain), "addfrom", newChain[0].Hash())
+
+		blockReorgMeter.Mark(1)
+		blockReorgAddMeter.Mark(int64(len(newChain)))
+		blockReorgDropMeter.Mark(int64(len(oldChain)))
+		blockReorgDepth.Update(int64(len(oldChain)))
 	} else {
 		log.Error("Impossible reorg, please file an issue", "oldnum", oldBlock.Number(), "oldhash", oldBlock.Hash(), "newnum", newBlock.Number(), "newhash", newBlock.Hash())
 	}
+	// Drop the sender index entries of the reorged out blocks, their positions
+	// are taken over by the new chain
+	if bc.cacheConfig.SenderTxIndex {
+		for _, block := range oldChain {
+			rawdb.DeleteSenderTxEntries(bc.db, types.MakeSigner(bc.chainConfig, block.Number()), block)
+		}
+	}
 	// Insert the new chain, taking care of the proper incremental order
 	var addedTxs types.Transactions
 	for i := len(newChain) - 1; i >= 0; i-- {
@@ -1492,6 +1800,7 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		bc.insert(newChain[i])
 		// write lookup entries for hash based transaction/receipt searches
 		rawdb.WriteTxLookupEntries(bc.db, newChain[i])
+		bc.writeSenderTxEntries(bc.db, newChain[i])
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
 	}
 	// calculate the difference between deleted and added transactions
@@ -1510,6 +1819,14 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 				bc.chainSideFeed.Send(ChainSideEvent{Block: block})
 			}
 		}()
+		go bc.reorgFeed.Send(ChainReorgEvent{
+			OldHead: oldHead,
+			NewHead: newHead,
+			Common:  commonBlock,
+			Depth:   len(oldChain),
+			Dropped: diff,
+			Added:   types.TxDifference(addedTxs, deletedTxs),
+		})
 	}
 
 	return nil
@@ -1597,32 +1914,106 @@ func (bc *BlockChain) update() {
 	}
 }
 
+// maintainTxIndex removes the transaction lookup entries of the blocks falling
+// out of the TxLookupLimit window of recent blocks as the chain progresses.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	var (
+		done   chan struct{} // Non-nil while an unindexing run is in progress
+		headCh = make(chan ChainHeadEvent, 1)
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	unindex := func(head uint64) {
+		limit := bc.cacheConfig.TxLookupLimit
+		if head+1 <= limit {
+			return
+		}
+		from, to := uint64(0), head+1-limit
+		if tail := rawdb.ReadTxIndexTail(bc.db); tail != nil {
+			from = *tail
+		}
+		if from >= to {
+			return
+		}
+		done = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			if err := rawdb.UnindexTransactions(bc.db, from, to, bc.quit); err != nil {
+				log.Debug("Transaction unindexing aborted", "err", err)
+			}
+		}(done)
+	}
+	unindex(bc.CurrentBlock().NumberU64())
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				unindex(head.Block.NumberU64())
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// backfillSenderTxIndex indexes the transactions of the blocks below the sender
+// index tail, the ones imported before the index was enabled.
+func (bc *BlockChain) backfillSenderTxIndex(tail uint64) {
+	defer bc.wg.Done()
+
+	if err := rawdb.IndexSenderTransactions(bc.db, bc.chainConfig, 0, tail, bc.quit); err != nil {
+		log.Debug("Sender transaction indexing aborted", "err", err)
+	}
+}
+
+// writeSenderTxEntries indexes the transactions of a block by sender if the
+// index is maintained.
+func (bc *BlockChain) writeSenderTxEntries(db rawdb.DatabaseWriter, block *types.Block) {
+	if bc.cacheConfig.SenderTxIndex {
+		rawdb.WriteSenderTxEntries(db, types.MakeSigner(bc.chainConfig, block.Number()), block)
+	}
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash   common.Hash   `json:"hash"`
 	Header *types.Header `json:"header"`
+	Reason string        `json:"reason"`
+	RLP    hexutil.Bytes `json:"rlp"`
 }
 
-// BadBlocks returns a list of the last 'bad blocks' that the client has seen on the network
+// BadBlocks returns a list of the last 'bad blocks' that the client has seen on
+// the network, persisted across restarts.
 func (bc *BlockChain) BadBlocks() ([]BadBlockArgs, error) {
-	headers := make([]BadBlockArgs, 0, bc.badBlocks.Len())
-	for _, hash := range bc.badBlocks.Keys() {
-		if hdr, exist := bc.badBlocks.Peek(hash); exist {
-			header := hdr.(*types.Header)
-			headers = append(headers, BadBlockArgs{header.Hash(), header})
+	bads := rawdb.ReadAllBadBlocks(bc.db)
+	blocks := make([]BadBlockArgs, 0, len(bads))
+	for _, bad := range bads {
+		blob, err := rlp.EncodeToBytes(bad.Block())
+		if err != nil {
+			return nil, err
 		}
+		blocks = append(blocks, BadBlockArgs{bad.Header.Hash(), bad.Header, bad.Reason, blob})
 	}
-	return headers, nil
+	return blocks, nil
 }
 
-// addBadBlock adds a bad block to the bad-block LRU cache
-func (bc *BlockChain) addBadBlock(block *types.Block) {
-	bc.badBlocks.Add(block.Header().Hash(), block.Header())
+// addBadBlock persists a bad block together with the reason it was rejected.
+func (bc *BlockChain) addBadBlock(block *types.Block, err error) {
+	blockBadMeter.Mark(1)
+	rawdb.WriteBadBlock(bc.db, block, err.Error())
 }
 
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
-	bc.addBadBlock(block)
+	bc.addBadBlock(block, err)
 
 	var receiptString string
 	for _, receipt := range receipts {
@@ -1754,6 +2145,11 @@ func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) even
 	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
 }
 
+// SubscribeChainReorgEvent registers a subscription of ChainReorgEvent.
+func (bc *BlockChain) SubscribeChainReorgEvent(ch chan<- ChainReorgEvent) event.Subscription {
+	return bc.scope.Track(bc.reorgFeed.Subscribe(ch))
+}
+
 // SubscribeChainEvent registers a subscription of ChainEvent.
 func (bc *BlockChain) SubscribeChainEvent(ch chan<- ChainEvent) event.Subscription {
 	return bc.scope.Track(bc.chainFeed.Subscribe(ch))
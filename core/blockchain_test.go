@@ -17,6 +17,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -179,6 +180,172 @@ func TestLastBlock(t *testing.T) {
 	}
 }
 
+// testCertifier accepts the signatures of a fixed set of headers only, failing
+// to reach a verdict on the ones marked unknown.
+type testCertifier struct {
+	certified map[common.Hash]bool
+	unknown   map[common.Hash]bool
+}
+
+func (c *testCertifier) CertifiesBlock(header *types.Header) (bool, error) {
+	if c.unknown[header.Hash()] {
+		return false, errors.New("validator topology unknown")
+	}
+	return c.certified[header.Hash()], nil
+}
+
+// Tests that the safe block is the newest one signed by a validator quorum and
+// the finalized block the newest such one with a certified child, sticking to
+// the genesis block while there is none.
+func TestSafeFinalizedBlocks(t *testing.T) {
+	_, blockchain, err := newCanonical(manash.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	engine := &testCertifier{certified: make(map[common.Hash]bool)}
+	blockchain.hc.finality.certifier = engine
+
+	if safe, final := blockchain.CurrentSafeBlock(), blockchain.CurrentFinalizedBlock(); safe.NumberU64() != 0 || final.NumberU64() != 0 {
+		t.Fatalf("pristine chain: have safe #%d, finalized #%d, want genesis", safe.NumberU64(), final.NumberU64())
+	}
+	blocks := makeBlockChain(blockchain.CurrentBlock(), 10, manash.NewFaker(), blockchain.db, 0)
+	for _, number := range []int{3, 4, 6, 8} {
+		engine.certified[blocks[number-1].Hash()] = true
+	}
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if have, want := blockchain.CurrentSafeBlock().NumberU64(), uint64(8); have != want {
+		t.Errorf("safe block mismatch: have #%d, want #%d", have, want)
+	}
+	if have, want := blockchain.CurrentFinalizedBlock().NumberU64(), uint64(3); have != want {
+		t.Errorf("finalized block mismatch: have #%d, want #%d", have, want)
+	}
+	// Extend the chain with two certified blocks and check both heads advance
+	blocks = makeBlockChain(blockchain.CurrentBlock(), 2, manash.NewFaker(), blockchain.db, 0)
+	for _, block := range blocks {
+		engine.certified[block.Hash()] = true
+	}
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if have, want := blockchain.CurrentSafeBlock().NumberU64(), uint64(12); have != want {
+		t.Errorf("safe block mismatch: have #%d, want #%d", have, want)
+	}
+	if have, want := blockchain.CurrentFinalizedBlock().NumberU64(), uint64(11); have != want {
+		t.Errorf("finalized block mismatch: have #%d, want #%d", have, want)
+	}
+	// Rewind below the certified blocks and check the heads drop back
+	blockchain.SetHead(5)
+	if have, want := blockchain.CurrentSafeBlock().NumberU64(), uint64(4); have != want {
+		t.Errorf("rewound safe block mismatch: have #%d, want #%d", have, want)
+	}
+	if have, want := blockchain.CurrentFinalizedBlock().NumberU64(), uint64(3); have != want {
+		t.Errorf("rewound finalized block mismatch: have #%d, want #%d", have, want)
+	}
+}
+
+// Tests that headers whose validators can't be looked up yet are not cached as
+// uncertified, but checked again once they are known.
+func TestSafeBlockUnknownValidators(t *testing.T) {
+	_, blockchain, err := newCanonical(manash.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	certifier := &testCertifier{certified: make(map[common.Hash]bool), unknown: make(map[common.Hash]bool)}
+	blockchain.hc.finality.certifier = certifier
+
+	blocks := makeBlockChain(blockchain.CurrentBlock(), 3, manash.NewFaker(), blockchain.db, 0)
+	for _, block := range blocks {
+		certifier.certified[block.Hash()] = true
+	}
+	certifier.unknown[blocks[2].Hash()] = true
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if have, want := blockchain.CurrentSafeBlock().NumberU64(), uint64(2); have != want {
+		t.Errorf("safe block mismatch: have #%d, want #%d", have, want)
+	}
+	delete(certifier.unknown, blocks[2].Hash())
+	if have, want := blockchain.CurrentSafeBlock().NumberU64(), uint64(3); have != want {
+		t.Errorf("retried safe block mismatch: have #%d, want #%d", have, want)
+	}
+	if have, want := blockchain.CurrentFinalizedBlock().NumberU64(), uint64(2); have != want {
+		t.Errorf("retried finalized block mismatch: have #%d, want #%d", have, want)
+	}
+}
+
+// Tests that proof-of-authority chains, carrying no validator signatures, report
+// their head as both safe and finalized.
+func TestSafeFinalizedBlocksClique(t *testing.T) {
+	var (
+		db      = mandb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.AllCliqueProtocolChanges}
+		genesis = gspec.MustCommit(db)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, manash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, 3, nil)
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if safe, final := blockchain.CurrentSafeBlock(), blockchain.CurrentFinalizedBlock(); safe.NumberU64() != 3 || final.NumberU64() != 3 {
+		t.Fatalf("safe/finalized mismatch: have #%d/#%d, want head #3", safe.NumberU64(), final.NumberU64())
+	}
+}
+
+// Tests that rewinding the chain drops the lookup and receipt entries of the
+// rewound blocks and hands back their transactions.
+func TestBlockChainRewind(t *testing.T) {
+	var (
+		db      = mandb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, 4, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, manash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	txs, err := blockchain.Rewind(2)
+	if err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock().NumberU64(); head != 2 {
+		t.Fatalf("head mismatch: have #%d, want #2", head)
+	}
+	if len(txs) != 2 || txs[0].Hash() != blocks[2].Transactions()[0].Hash() || txs[1].Hash() != blocks[3].Transactions()[0].Hash() {
+		t.Fatalf("rewound transactions mismatch: have %d", len(txs))
+	}
+	for i, block := range blocks {
+		tx, _, _, _ := rawdb.ReadTransaction(db, block.Transactions()[0].Hash())
+		receipts := rawdb.ReadReceipts(db, block.Hash(), block.NumberU64())
+
+		if kept := i < 2; kept != (tx != nil) || kept != (receipts != nil) {
+			t.Errorf("block #%d: lookup present %v, receipts present %v, want %v", block.NumberU64(), tx != nil, receipts != nil, kept)
+		}
+	}
+}
+
 // Tests that given a starting canonical chain of a given size, it can be extended
 // with various length chains.
 func TestExtendCanonicalHeaders(t *testing.T) { testExtendCanonical(t, false) }
@@ -932,6 +1099,10 @@ func TestReorgSideEvent(t *testing.T) {
 	if _, err := blockchain.InsertChain(replacementBlocks); err != nil {
 		t.Fatalf("failed to insert chain: %v", err)
 	}
+	// Reorged out blocks are valid, make sure they aren't reported as bad ones
+	if bads, _ := blockchain.BadBlocks(); len(bads) != 0 {
+		t.Errorf("reorged out blocks reported as bad: %d", len(bads))
+	}
 
 	// first two block of the secondary chain are for a brief moment considered
 	// side chains because up to that point the first one is considered the
@@ -1279,8 +1450,8 @@ func TestTrieForkGC(t *testing.T) {
 	}
 	// Dereference all the recent tries and ensure no past trie is left in
 	for i := 0; i < triesInMemory; i++ {
-		chain.stateCache.TrieDB().Dereference(blocks[len(blocks)-1-i].Root(), common.Hash{})
-		chain.stateCache.TrieDB().Dereference(forks[len(blocks)-1-i].Root(), common.Hash{})
+		chain.stateCache.TrieDB().Dereference(blocks[len(blocks)-1-i].Root())
+		chain.stateCache.TrieDB().Dereference(forks[len(blocks)-1-i].Root())
 	}
 	if len(chain.stateCache.TrieDB().Nodes()) > 0 {
 		t.Fatalf("stale tries still alive after garbase collection")
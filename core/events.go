@@ -24,6 +24,33 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// ReplacedTxEvent is posted when a pooled transaction is evicted in favour of a
+// transaction with the same sender and nonce paying a sufficiently higher gas
+// price.
+type ReplacedTxEvent struct {
+	Old *types.Transaction
+	New *types.Transaction
+}
+
+// TxLifecycle is the way a transaction left the transaction pool.
+type TxLifecycle string
+
+const (
+	TxDropped  TxLifecycle = "dropped"  // Discarded without being included in a block
+	TxReplaced TxLifecycle = "replaced" // Superseded by a same nonce transaction paying more
+	TxIncluded TxLifecycle = "included" // Included in a block of the canonical chain
+)
+
+// TxLifecycleEvent is posted when a batch of transactions leave the transaction
+// pool, either dropped, replaced or included in a block.
+type TxLifecycleEvent struct {
+	Txs         []*types.Transaction
+	Status      TxLifecycle
+	Reason      string      // Reason the transactions were dropped for
+	Replacement common.Hash // Transaction replacing the dropped one
+	Block       common.Hash // Block including the transactions
+}
+
 //type NewSNEvent struct{ SN map[*big.Int]uint32 } //by hezi
 
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
@@ -51,3 +78,14 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// ChainReorgEvent is posted when the canonical chain is reorganised and one or
+// more of its blocks are replaced by those of a competing fork.
+type ChainReorgEvent struct {
+	OldHead *types.Block       // Canonical head before the reorg
+	NewHead *types.Block       // Canonical head after the reorg
+	Common  *types.Block       // Last block shared by the old and the new chain
+	Depth   int                // Number of canonical blocks dropped
+	Dropped types.Transactions // Transactions of the old chain missing from the new one
+	Added   types.Transactions // Transactions of the new chain missing from the old one
+}
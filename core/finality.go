@@ -0,0 +1,150 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/consensus"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/params"
+)
+
+// finalityCacheLimit is the number of quorum verdicts kept for the most recent
+// headers, enough to cover a full scan below the head.
+const finalityCacheLimit = 2 * params.FinalityScanDepth
+
+// blockCertifier checks whether the signatures of a header form a quorum of the
+// validators elected for it. An error means no verdict can be reached yet, e.g.
+// because the validator topology of the header is not known.
+type blockCertifier interface {
+	CertifiesBlock(header *types.Header) (bool, error)
+}
+
+// finality tracks the safe and finalized heads of a header chain from the
+// validator signatures carried by the headers. A header is certified once its
+// signatures form a DPoS quorum of the validators elected for it. The safe head
+// is the newest certified header, the finalized head is the newest certified
+// header built upon by a certified child, so that a quorum of validators signed
+// both the block and a descendant of it. Chains without a certifier, such as
+// proof-of-authority ones, treat their head as both safe and finalized.
+type finality struct {
+	chain     consensus.ChainReader
+	certifier blockCertifier
+
+	certified *lru.Cache // Quorum verdicts of the most recent headers, keyed by hash
+
+	lock      sync.Mutex
+	head      common.Hash   // Head of the chain the safe and finalized headers belong to
+	safe      *types.Header // Newest certified header below the head
+	finalized *types.Header // Newest certified header with a certified child below the head
+}
+
+// newFinality creates a tracker of the safe and finalized heads of the chain,
+// checking the header signatures with the given certifier.
+func newFinality(chain consensus.ChainReader, certifier blockCertifier) *finality {
+	certified, _ := lru.New(int(finalityCacheLimit))
+	return &finality{
+		chain:     chain,
+		certifier: certifier,
+		certified: certified,
+	}
+}
+
+// heads returns the safe and finalized headers of the chain with the given head.
+// Headers no longer found within params.FinalityScanDepth blocks of the head are
+// carried over from the previous call while they remain canonical, otherwise
+// the genesis header is returned.
+func (f *finality) heads(head *types.Header) (*types.Header, *types.Header) {
+	if f.certifier == nil {
+		return head, head
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if head.Hash() == f.head {
+		return f.safe, f.finalized
+	}
+	var (
+		safe, finalized *types.Header
+		childCertified  bool
+		conclusive      = true
+	)
+	for header, depth := head, uint64(0); header != nil && depth <= params.FinalityScanDepth; depth++ {
+		number := header.Number.Uint64()
+		if number == 0 {
+			break
+		}
+		// Broadcast blocks are signed by a broadcast node rather than by the
+		// validators, so they neither certify nor break a run of certified blocks.
+		if !common.IsBroadcastNumber(number) {
+			certified, ok := f.isCertified(header)
+			conclusive = conclusive && ok
+			if certified && safe == nil {
+				safe = header
+			}
+			if certified && childCertified {
+				finalized = header
+				break
+			}
+			childCertified = certified
+		}
+		header = f.chain.GetHeader(header.ParentHash, number-1)
+	}
+	f.safe, f.finalized = f.newest(safe, f.safe), f.newest(finalized, f.finalized)
+
+	// Headers without a verdict are checked again on the next call
+	f.head = common.Hash{}
+	if conclusive {
+		f.head = head.Hash()
+	}
+	return f.safe, f.finalized
+}
+
+// newest returns the newer of the header found below the head and the one
+// previously reported, dropping the latter if it was reorged out of the chain.
+// The genesis header is returned if neither is available.
+func (f *finality) newest(found, prev *types.Header) *types.Header {
+	if prev != nil && (found == nil || prev.Number.Cmp(found.Number) > 0) {
+		if canon := f.chain.GetHeaderByNumber(prev.Number.Uint64()); canon != nil && canon.Hash() == prev.Hash() {
+			return prev
+		}
+	}
+	if found == nil {
+		return f.chain.GetHeaderByNumber(0)
+	}
+	return found
+}
+
+// isCertified reports whether the signatures of the header form a quorum of the
+// validators elected for it, and whether a verdict could be reached at all. Only
+// reached verdicts are cached, headers whose validators can't be looked up yet
+// are retried on the next scan.
+func (f *finality) isCertified(header *types.Header) (bool, bool) {
+	hash := header.Hash()
+	if verdict, ok := f.certified.Get(hash); ok {
+		return verdict.(bool), true
+	}
+	certified, err := f.certifier.CertifiesBlock(header)
+	if err != nil {
+		return false, false
+	}
+	f.certified.Add(hash, certified)
+	return certified, true
+}
@@ -157,6 +157,65 @@ func (e *GenesisMismatchError) Error() string {
 //
 // The returned chain configuration is never nil.
 func SetupGenesisBlock(db mandb.Database, genesis *Genesis) (*params.ChainConfig, common.Hash, error) {
+	return SetupGenesisBlockWithOverride(db, genesis, nil)
+}
+
+// ChainOverrides are fork activation blocks overlaid on the stored or genesis
+// chain configuration, allowing an upcoming fork to be rehearsed on a copy of
+// a database without editing the genesis specification. Nil fields leave the
+// configuration untouched.
+type ChainOverrides struct {
+	Homestead      *big.Int
+	EIP150         *big.Int
+	EIP155         *big.Int
+	EIP158         *big.Int
+	Byzantium      *big.Int
+	Constantinople *big.Int
+	VMUpgrades     map[string]*big.Int // Activation blocks of named VM upgrades
+}
+
+// apply returns a copy of the chain configuration with the overrides set. The
+// original is returned as is if there is nothing to override.
+func (o *ChainOverrides) apply(config *params.ChainConfig) *params.ChainConfig {
+	if o == nil {
+		return config
+	}
+	cpy := *config
+	for _, override := range []struct {
+		name  string
+		block *big.Int
+		field **big.Int
+	}{
+		{"homestead", o.Homestead, &cpy.HomesteadBlock},
+		{"eip150", o.EIP150, &cpy.EIP150Block},
+		{"eip155", o.EIP155, &cpy.EIP155Block},
+		{"eip158", o.EIP158, &cpy.EIP158Block},
+		{"byzantium", o.Byzantium, &cpy.ByzantiumBlock},
+		{"constantinople", o.Constantinople, &cpy.ConstantinopleBlock},
+	} {
+		if override.block != nil {
+			log.Warn("Overriding fork activation", "fork", override.name, "stored", *override.field, "new", override.block)
+			*override.field = new(big.Int).Set(override.block)
+		}
+	}
+	if len(o.VMUpgrades) > 0 {
+		cpy.VMUpgrades = make(map[string]*big.Int, len(config.VMUpgrades)+len(o.VMUpgrades))
+		for name, block := range config.VMUpgrades {
+			cpy.VMUpgrades[name] = block
+		}
+		for name, block := range o.VMUpgrades {
+			log.Warn("Overriding VM upgrade activation", "upgrade", name, "stored", config.VMUpgrades[name], "new", block)
+			cpy.VMUpgrades[name] = new(big.Int).Set(block)
+		}
+	}
+	return &cpy
+}
+
+// SetupGenesisBlockWithOverride is SetupGenesisBlock with the given fork
+// overrides applied to the resulting chain configuration. The overridden
+// configuration is checked against the local chain and stored like any other
+// configuration update.
+func SetupGenesisBlockWithOverride(db mandb.Database, genesis *Genesis, overrides *ChainOverrides) (*params.ChainConfig, common.Hash, error) {
 	if genesis != nil && genesis.Config == nil {
 		return params.AllEthashProtocolChanges, common.Hash{}, errGenesisNoConfig
 	}
@@ -170,6 +229,11 @@ func SetupGenesisBlock(db mandb.Database, genesis *Genesis) (*params.ChainConfig
 		} else {
 			log.Info("Writing custom genesis block")
 		}
+		if overrides != nil {
+			spec := *genesis
+			spec.Config = overrides.apply(genesis.Config)
+			genesis = &spec
+		}
 		block, err := genesis.Commit(db)
 		return genesis.Config, block.Hash(), err
 	}
@@ -183,7 +247,7 @@ func SetupGenesisBlock(db mandb.Database, genesis *Genesis) (*params.ChainConfig
 	}
 
 	// Get the existing chain configuration.
-	newcfg := genesis.configOrDefault(stored)
+	newcfg := overrides.apply(genesis.configOrDefault(stored))
 	storedcfg := rawdb.ReadChainConfig(db, stored)
 	if storedcfg == nil {
 		log.Warn("Found genesis block without chain config")
@@ -192,9 +256,12 @@ func SetupGenesisBlock(db mandb.Database, genesis *Genesis) (*params.ChainConfig
 	}
 	// Special case: don't change the existing config of a non-mainnet chain if no new
 	// config is supplied. These chains would get AllProtocolChanges (and a compat error)
-	// if we just continued here.
+	// if we just continued here. Overrides are still applied on top of the stored one.
 	if genesis == nil && stored != params.MainnetGenesisHash {
-		return storedcfg, stored, nil
+		if overrides == nil {
+			return storedcfg, stored, nil
+		}
+		newcfg = overrides.apply(storedcfg)
 	}
 
 	// Check config compatibility and write the config. Compatibility errors
@@ -224,6 +291,104 @@ func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 	}
 }
 
+// Validate checks a custom genesis specification for misconfigurations that
+// would otherwise only surface once the chain tries to build on top of it.
+func (g *Genesis) Validate() error {
+	if g.Config == nil {
+		return errGenesisNoConfig
+	}
+	if g.GasLimit != 0 && g.GasLimit < params.MinGasLimit {
+		return fmt.Errorf("genesis gas limit %d below minimum %d", g.GasLimit, params.MinGasLimit)
+	}
+	if g.Difficulty != nil && g.Difficulty.Sign() <= 0 {
+		return fmt.Errorf("genesis difficulty %v must be positive", g.Difficulty)
+	}
+	if g.Config.Clique != nil {
+		return g.validateSigners()
+	}
+	return g.validateElection()
+}
+
+// validateSigners checks that the extra data of a proof-of-authority genesis
+// carries the vanity, at least one signer and the seal placeholder.
+func (g *Genesis) validateSigners() error {
+	const vanity, seal = 32, 65
+
+	if len(g.ExtraData) < vanity+seal {
+		return fmt.Errorf("clique genesis extra data too short: have %d bytes, want at least %d", len(g.ExtraData), vanity+seal)
+	}
+	signers := len(g.ExtraData) - vanity - seal
+	if signers == 0 || signers%common.AddressLength != 0 {
+		return fmt.Errorf("clique genesis extra data holds %d signer bytes, want a non-zero multiple of %d", signers, common.AddressLength)
+	}
+	return nil
+}
+
+// validateElection checks the initial election results and network topology
+// the MATRIX consensus starts from.
+func (g *Genesis) validateElection() error {
+	if len(g.Elect) == 0 {
+		return errors.New("genesis has no elected nodes")
+	}
+	elected := make(map[common.Address]common.RoleType, len(g.Elect))
+	for i, e := range g.Elect {
+		if e.Account == (common.Address{}) {
+			return fmt.Errorf("elect #%d: missing account", i)
+		}
+		role := e.Type.Transfer2CommonRole()
+		if role == common.RoleNil {
+			return fmt.Errorf("elect #%d (%x): unknown role type %d", i, e.Account, e.Type)
+		}
+		if _, ok := elected[e.Account]; ok {
+			return fmt.Errorf("elect #%d: account %x elected twice", i, e.Account)
+		}
+		elected[e.Account] = role
+	}
+	if g.NetTopology.Type != common.NetTopoTypeAll {
+		return fmt.Errorf("genesis topology must be a full topology (type %d), have type %d", common.NetTopoTypeAll, g.NetTopology.Type)
+	}
+	var (
+		placed    = make(map[common.Address]bool)
+		positions = make(map[uint16]common.Address)
+		roles     = make(map[common.RoleType]int)
+	)
+	for i, node := range g.NetTopology.NetTopologyData {
+		role, ok := elected[node.Account]
+		if !ok {
+			return fmt.Errorf("topology node #%d (%x) was not elected", i, node.Account)
+		}
+		if have := common.GetRoleTypeFromPosition(node.Position); have != role {
+			return fmt.Errorf("topology node #%d (%x): position %d is a %v slot, but the account was elected as %v", i, node.Account, node.Position, have, role)
+		}
+		if placed[node.Account] {
+			return fmt.Errorf("topology node #%d: account %x placed twice", i, node.Account)
+		}
+		if other, ok := positions[node.Position]; ok {
+			return fmt.Errorf("topology node #%d (%x): position %d already taken by %x", i, node.Account, node.Position, other)
+		}
+		placed[node.Account], positions[node.Position] = true, node.Account
+		roles[role]++
+	}
+	for _, e := range g.Elect {
+		if role := elected[e.Account]; (role == common.RoleValidator || role == common.RoleMiner) && !placed[e.Account] {
+			return fmt.Errorf("elected %v %x missing from the genesis topology", role, e.Account)
+		}
+	}
+	if roles[common.RoleValidator] == 0 {
+		return errors.New("genesis topology has no validators")
+	}
+	if roles[common.RoleMiner] == 0 {
+		return errors.New("genesis topology has no miners")
+	}
+	if g.Leader == (common.Address{}) {
+		return errors.New("genesis has no leader")
+	}
+	if elected[g.Leader] != common.RoleValidator || !placed[g.Leader] {
+		return fmt.Errorf("genesis leader %x is not a validator in the topology", g.Leader)
+	}
+	return nil
+}
+
 // ToBlock creates the genesis block and writes state of a genesis specification
 // to the given database (or discards it if nil).
 func (g *Genesis) ToBlock(db mandb.Database) *types.Block {
@@ -289,9 +454,41 @@ func (g *Genesis) Commit(db mandb.Database) (*types.Block, error) {
 		config = params.AllEthashProtocolChanges
 	}
 	rawdb.WriteChainConfig(db, block.Hash(), config)
+
+	// Keep the specification around so the genesis can be exported again
+	spec, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	rawdb.WriteGenesisSpec(db, block.Hash(), spec)
 	return block, nil
 }
 
+// ReadGenesis retrieves the genesis specification the chain in db was
+// initialised from. Databases created before specifications were stored can
+// only be exported if they run one of the built-in networks.
+func ReadGenesis(db mandb.Database) (*Genesis, error) {
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	if (stored == common.Hash{}) {
+		return nil, errors.New("database has no genesis block")
+	}
+	spec := rawdb.ReadGenesisSpec(db, stored)
+	if len(spec) == 0 {
+		switch stored {
+		case params.MainnetGenesisHash:
+			return DefaultGenesisBlock(), nil
+		case params.TestnetGenesisHash:
+			return DefaultTestnetGenesisBlock(), nil
+		}
+		return nil, fmt.Errorf("genesis specification of %x not stored", stored)
+	}
+	genesis := new(Genesis)
+	if err := json.Unmarshal(spec, genesis); err != nil {
+		return nil, fmt.Errorf("invalid stored genesis specification: %v", err)
+	}
+	return genesis, nil
+}
+
 // MustCommit writes the genesis block and state to db, panicking on error.
 // The block is committed as the canonical head block.
 func (g *Genesis) MustCommit(db mandb.Database) *types.Block {
@@ -344,17 +541,23 @@ func DefaultRinkebyGenesisBlock() *Genesis {
 	}
 }
 
+// DeveloperPrefund is the balance granted to every extra account funded in the
+// 'gman --dev' genesis block.
+var DeveloperPrefund = new(big.Int).Mul(big.NewInt(1000000), big.NewInt(params.Ether))
+
 // DeveloperGenesisBlock returns the 'gman --dev' genesis block. Note, this must
-// be seeded with the
-func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
+// be seeded with the faucet, which is also the sole signer of the chain. Any
+// prefund accounts are allocated a DeveloperPrefund balance.
+func DeveloperGenesisBlock(period uint64, faucet common.Address, prefund ...common.Address) *Genesis {
 	// Override the default period to the user requested one
 	config := *params.AllCliqueProtocolChanges
-	//config.Clique.Period = period
-	//todo 把clique设为空，默认启动ethash引擎挖矿
-	config.Clique = nil
+	config.Clique = &params.CliqueConfig{
+		Period: period,
+		Epoch:  config.Clique.Epoch,
+	}
 
 	// Assemble and return the genesis with the precompiles and faucet pre-funded
-	return &Genesis{
+	genesis := &Genesis{
 		Config:     &config,
 		ExtraData:  append(append(make([]byte, 32), faucet[:]...), make([]byte, 65)...),
 		GasLimit:   6283185,
@@ -371,6 +574,12 @@ func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 			faucet: {Balance: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(9))},
 		},
 	}
+	for _, addr := range prefund {
+		if _, ok := genesis.Alloc[addr]; !ok {
+			genesis.Alloc[addr] = GenesisAccount{Balance: new(big.Int).Set(DeveloperPrefund)}
+		}
+	}
+	return genesis
 }
 
 func decodePrealloc(data string) GenesisAlloc {
@@ -162,3 +162,153 @@ func TestSetupGenesis(t *testing.T) {
 		}
 	}
 }
+
+// Tests that fork overrides are applied on top of both fresh and stored
+// configurations without modifying the shared defaults.
+func TestSetupGenesisOverride(t *testing.T) {
+	overrides := &ChainOverrides{
+		Byzantium:  big.NewInt(10),
+		VMUpgrades: map[string]*big.Int{"wasm": big.NewInt(20)},
+	}
+	want := &params.ChainConfig{
+		HomesteadBlock: big.NewInt(3),
+		ByzantiumBlock: big.NewInt(10),
+		VMUpgrades:     map[string]*big.Int{"wasm": big.NewInt(20)},
+	}
+	custom := func() *Genesis {
+		return &Genesis{Config: &params.ChainConfig{HomesteadBlock: big.NewInt(3)}}
+	}
+	// Overrides on an empty database end up in the written config
+	db := mandb.NewMemDatabase()
+	genesis := custom()
+	config, hash, err := SetupGenesisBlockWithOverride(db, genesis, overrides)
+	if err != nil {
+		t.Fatalf("failed to set up genesis: %v", err)
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("fresh config mismatch:\nhave %v\nwant %v", config, want)
+	}
+	if stored := rawdb.ReadChainConfig(db, hash); !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored config mismatch:\nhave %v\nwant %v", stored, want)
+	}
+	if genesis.Config.ByzantiumBlock != nil {
+		t.Errorf("genesis specification modified")
+	}
+	// Overrides on a stored custom chain apply without a genesis specification
+	db = mandb.NewMemDatabase()
+	custom().MustCommit(db)
+	if config, _, err = SetupGenesisBlockWithOverride(db, nil, overrides); err != nil {
+		t.Fatalf("failed to set up genesis: %v", err)
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("stored chain config mismatch:\nhave %v\nwant %v", config, want)
+	}
+	if config, _, _ = SetupGenesisBlock(db, nil); !reflect.DeepEqual(config, want) {
+		t.Errorf("override not persisted:\nhave %v\nwant %v", config, want)
+	}
+	// Overrides on the main network must leave the default config untouched
+	db = mandb.NewMemDatabase()
+	DefaultGenesisBlock().MustCommit(db)
+	byzantium := params.MainnetChainConfig.ByzantiumBlock
+	if config, _, err = SetupGenesisBlockWithOverride(db, nil, overrides); err != nil {
+		t.Fatalf("failed to set up genesis: %v", err)
+	}
+	if config.ByzantiumBlock.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("mainnet override mismatch: have %v, want 10", config.ByzantiumBlock)
+	}
+	if params.MainnetChainConfig.ByzantiumBlock != byzantium || params.MainnetChainConfig.VMUpgrades != nil {
+		t.Errorf("shared mainnet config modified")
+	}
+}
+
+func TestDeveloperGenesisBlock(t *testing.T) {
+	var (
+		faucet = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+		extra  = common.HexToAddress("0x703c4b2bd70c169f5717101caee543299fc946c7")
+	)
+	genesis := DeveloperGenesisBlock(3, faucet, extra, faucet)
+	if genesis.Config.Clique == nil || genesis.Config.Clique.Period != 3 {
+		t.Fatalf("clique config mismatch: have %v, want period 3", genesis.Config.Clique)
+	}
+	if params.AllCliqueProtocolChanges.Clique.Period != 0 {
+		t.Fatalf("shared clique config modified")
+	}
+	if balance := genesis.Alloc[extra].Balance; balance.Cmp(DeveloperPrefund) != 0 {
+		t.Errorf("prefund balance mismatch: have %v, want %v", balance, DeveloperPrefund)
+	}
+	// Listing the faucet again must not reduce its allowance
+	if balance := genesis.Alloc[faucet].Balance; balance.Cmp(DeveloperPrefund) <= 0 {
+		t.Errorf("faucet balance overwritten: have %v", balance)
+	}
+}
+
+func TestGenesisValidate(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x0ead6cdb8d214389909a535d4ccc21a393dddba9")
+		miner     = common.HexToAddress("0x0a3f28de9682df49f9f393931062c5204c2bc404")
+	)
+	matrixGenesis := func() *Genesis {
+		return &Genesis{
+			Config: params.TestChainConfig,
+			Leader: validator,
+			Elect: []common.Elect{
+				{Account: validator, Stock: 1, Type: common.ElectRoleValidator},
+				{Account: miner, Stock: 1, Type: common.ElectRoleMiner},
+			},
+			NetTopology: common.NetTopology{
+				Type: common.NetTopoTypeAll,
+				NetTopologyData: []common.NetTopologyData{
+					{Account: validator, Position: common.GeneratePosition(0, common.ElectRoleValidator)},
+					{Account: miner, Position: common.GeneratePosition(0, common.ElectRoleMiner)},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		tweak func(g *Genesis)
+		fail  bool
+	}{
+		{name: "valid", tweak: func(g *Genesis) {}},
+		{name: "no config", tweak: func(g *Genesis) { g.Config = nil }, fail: true},
+		{name: "low gas limit", tweak: func(g *Genesis) { g.GasLimit = 1 }, fail: true},
+		{name: "no elect", tweak: func(g *Genesis) { g.Elect = nil }, fail: true},
+		{name: "bad role", tweak: func(g *Genesis) { g.Elect[1].Type = 9 }, fail: true},
+		{name: "double elect", tweak: func(g *Genesis) { g.Elect[1].Account = validator }, fail: true},
+		{name: "topology change", tweak: func(g *Genesis) { g.NetTopology.Type = common.NetTopoTypeChange }, fail: true},
+		{name: "role mismatch", tweak: func(g *Genesis) { g.NetTopology.NetTopologyData[1].Position = 8193 }, fail: true},
+		{name: "not elected", tweak: func(g *Genesis) { g.NetTopology.NetTopologyData[1].Account = common.Address{0x01} }, fail: true},
+		{name: "missing miner", tweak: func(g *Genesis) { g.NetTopology.NetTopologyData = g.NetTopology.NetTopologyData[:1] }, fail: true},
+		{name: "no leader", tweak: func(g *Genesis) { g.Leader = common.Address{} }, fail: true},
+		{name: "miner leader", tweak: func(g *Genesis) { g.Leader = miner }, fail: true},
+		{name: "clique", tweak: func(g *Genesis) { *g = *DeveloperGenesisBlock(0, validator) }},
+		{name: "clique no signer", tweak: func(g *Genesis) {
+			*g = *DeveloperGenesisBlock(0, validator)
+			g.ExtraData = make([]byte, 32+65)
+		}, fail: true},
+	}
+	for _, tt := range tests {
+		g := matrixGenesis()
+		tt.tweak(g)
+		if err := g.Validate(); (err != nil) != tt.fail {
+			t.Errorf("%s: validation mismatch: err %v, want failure %v", tt.name, err, tt.fail)
+		}
+	}
+}
+
+func TestReadGenesis(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	if _, err := ReadGenesis(db); err == nil {
+		t.Fatal("genesis read from empty database")
+	}
+	genesis := DeveloperGenesisBlock(5, common.Address{0x01})
+	block := genesis.MustCommit(db)
+
+	stored, err := ReadGenesis(db)
+	if err != nil {
+		t.Fatalf("failed to read genesis: %v", err)
+	}
+	if hash := stored.ToBlock(nil).Hash(); hash != block.Hash() {
+		t.Errorf("genesis hash mismatch: have %x, want %x", hash, block.Hash())
+	}
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/consensus"
+	"github.com/matrix/go-matrix/consensus/mtxdpos"
 	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/mandb"
@@ -62,8 +63,9 @@ type HeaderChain struct {
 
 	procInterrupt func() bool
 
-	rand   *mrand.Rand
-	engine consensus.Engine
+	rand     *mrand.Rand
+	engine   consensus.Engine
+	finality *finality // Safe and finalized heads derived from the validator signatures
 }
 
 // NewHeaderChain creates a new HeaderChain structure.
@@ -104,6 +106,12 @@ func NewHeaderChain(chainDb mandb.Database, config *params.ChainConfig, engine c
 		}
 	}
 	hc.currentHeaderHash = hc.CurrentHeader().Hash()
+	// Proof-of-authority headers carry no validator signatures to certify
+	var certifier blockCertifier
+	if config.Clique == nil {
+		certifier = mtxdpos.NewMtxDPOS(hc)
+	}
+	hc.finality = newFinality(hc, certifier)
 
 	return hc, nil
 }
@@ -457,6 +465,20 @@ func (hc *HeaderChain) SetGenesis(head *types.Header) {
 // Config retrieves the header chain's chain configuration.
 func (hc *HeaderChain) Config() *params.ChainConfig { return hc.config }
 
+// SafeHeader retrieves the newest header of the chain with the given head that
+// carries a quorum of validator signatures.
+func (hc *HeaderChain) SafeHeader(head *types.Header) *types.Header {
+	safe, _ := hc.finality.heads(head)
+	return safe
+}
+
+// FinalizedHeader retrieves the newest header of the chain with the given head
+// that carries a quorum of validator signatures and whose child does too.
+func (hc *HeaderChain) FinalizedHeader(head *types.Header) *types.Header {
+	_, finalized := hc.finality.heads(head)
+	return finalized
+}
+
 // Engine retrieves the header chain's consensus engine.
 func (hc *HeaderChain) Engine() consensus.Engine { return hc.engine }
 
@@ -13,18 +13,22 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Copyright 2014 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
 
-// +build windows
-// +build go1.4
+package core
 
-package windows
+import (
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/mandb"
+)
 
-import "syscall"
+// databaseMigrations upgrades databases created by older clients to the schema
+// of BlockChainVersion, each entry moving it a single version forward. Storage
+// format changes should bump BlockChainVersion and register a migration here
+// rather than forcing nodes to resync.
+var databaseMigrations []rawdb.Migration
 
-func Unsetenv(key string) error {
-	// This was added in Go 1.4.
-	return syscall.Unsetenv(key)
+// UpgradeDatabase migrates the chain database to the schema version expected by
+// this client, rolling back on failure.
+func UpgradeDatabase(db mandb.Database) error {
+	return rawdb.MigrateDatabase(db, BlockChainVersion, databaseMigrations)
 }
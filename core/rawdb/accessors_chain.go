@@ -20,16 +20,44 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math/big"
+	"sort"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/rlp"
 )
 
+// readAncient retrieves the frozen item of the given kind belonging to the block
+// with the given hash and number, if db is backed by an ancient store holding it.
+func readAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	ancients, ok := db.(mandb.AncientReader)
+	if !ok {
+		return nil
+	}
+	// Only canonical blocks are frozen, make sure the requested one is
+	if frozen, _ := ancients.Ancient(freezerHashTable, number); common.BytesToHash(frozen) != hash {
+		return nil
+	}
+	data, _ := ancients.Ancient(kind, number)
+	return data
+}
+
+// hasAncient verifies the existence of the frozen block with the given hash and
+// number, if db is backed by an ancient store.
+func hasAncient(db DatabaseReader, hash common.Hash, number uint64) bool {
+	return len(readAncient(db, freezerHashTable, hash, number)) > 0
+}
+
 // ReadCanonicalHash retrieves the hash assigned to a canonical block number.
 func ReadCanonicalHash(db DatabaseReader, number uint64) common.Hash {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), headerHashSuffix...))
+	if len(data) == 0 {
+		if ancients, ok := db.(mandb.AncientReader); ok {
+			data, _ = ancients.Ancient(freezerHashTable, number)
+		}
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
@@ -130,6 +158,9 @@ func WriteFastTrieProgress(db DatabaseWriter, count uint64) {
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = readAncient(db, freezerHeaderTable, hash, number)
+	}
 	return data
 }
 
@@ -137,7 +168,7 @@ func ReadHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawVa
 func HasHeader(db DatabaseReader, hash common.Hash, number uint64) bool {
 	key := append(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
 	if has, err := db.Has(key); !has || err != nil {
-		return false
+		return hasAncient(db, hash, number)
 	}
 	return true
 }
@@ -193,6 +224,9 @@ func DeleteHeader(db DatabaseDeleter, hash common.Hash, number uint64) {
 // ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func ReadBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(blockBodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = readAncient(db, freezerBodiesTable, hash, number)
+	}
 	return data
 }
 
@@ -208,7 +242,7 @@ func WriteBodyRLP(db DatabaseWriter, hash common.Hash, number uint64, rlp rlp.Ra
 func HasBody(db DatabaseReader, hash common.Hash, number uint64) bool {
 	key := append(append(blockBodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 	if has, err := db.Has(key); !has || err != nil {
-		return false
+		return hasAncient(db, hash, number)
 	}
 	return true
 }
@@ -246,6 +280,9 @@ func DeleteBody(db DatabaseDeleter, hash common.Hash, number uint64) {
 // ReadTd retrieves a block's total difficulty corresponding to the hash.
 func ReadTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
 	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), headerTDSuffix...))
+	if len(data) == 0 {
+		data = readAncient(db, freezerDifficultyTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -280,6 +317,9 @@ func DeleteTd(db DatabaseDeleter, hash common.Hash, number uint64) {
 func ReadReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
 	// Retrieve the flattened receipt slice
 	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	if len(data) == 0 {
+		data = readAncient(db, freezerReceiptTable, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -321,6 +361,83 @@ func DeleteReceipts(db DatabaseDeleter, hash common.Hash, number uint64) {
 	}
 }
 
+// ReadStateDiff retrieves the accounts and storage slots modified by a block.
+// Nil is returned if the block was not indexed.
+func ReadStateDiff(db DatabaseReader, hash common.Hash, number uint64) types.StateDiff {
+	data, _ := db.Get(stateDiffKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	diff := types.StateDiff{}
+	if err := rlp.DecodeBytes(data, &diff); err != nil {
+		log.Error("Invalid state diff RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return diff
+}
+
+// WriteStateDiff stores the accounts and storage slots modified by a block.
+func WriteStateDiff(db DatabaseWriter, hash common.Hash, number uint64, diff types.StateDiff) {
+	if diff == nil {
+		diff = types.StateDiff{}
+	}
+	bytes, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		log.Crit("Failed to encode state diff", "err", err)
+	}
+	if err := db.Put(stateDiffKey(number, hash), bytes); err != nil {
+		log.Crit("Failed to store state diff", "err", err)
+	}
+}
+
+// DeleteStateDiff removes the state diff associated with a block hash.
+func DeleteStateDiff(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(stateDiffKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state diff", "err", err)
+	}
+}
+
+// ReadReceiptExtras retrieves the revert reasons and internal transfers of the
+// transactions of a block, in transaction order. Nil is returned if they were
+// not stored.
+func ReadReceiptExtras(db DatabaseReader, hash common.Hash, number uint64) []*types.ReceiptExtras {
+	data, _ := db.Get(receiptExtrasKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var extras []*types.ReceiptExtras
+	if err := rlp.DecodeBytes(data, &extras); err != nil {
+		log.Error("Invalid receipt extras RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return extras
+}
+
+// WriteReceiptExtras stores the revert reasons and internal transfers recorded
+// in the receipts of a block.
+func WriteReceiptExtras(db DatabaseWriter, hash common.Hash, number uint64, receipts types.Receipts) {
+	extras := make([]*types.ReceiptExtras, len(receipts))
+	for i, receipt := range receipts {
+		if extras[i] = receipt.Extras; extras[i] == nil {
+			extras[i] = new(types.ReceiptExtras)
+		}
+	}
+	bytes, err := rlp.EncodeToBytes(extras)
+	if err != nil {
+		log.Crit("Failed to encode receipt extras", "err", err)
+	}
+	if err := db.Put(receiptExtrasKey(number, hash), bytes); err != nil {
+		log.Crit("Failed to store receipt extras", "err", err)
+	}
+}
+
+// DeleteReceiptExtras removes the receipt extras associated with a block hash.
+func DeleteReceiptExtras(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(receiptExtrasKey(number, hash)); err != nil {
+		log.Crit("Failed to delete receipt extras", "err", err)
+	}
+}
+
 // ReadBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body. If either the header or body could not
 // be retrieved nil is returned.
@@ -348,6 +465,8 @@ func WriteBlock(db DatabaseWriter, block *types.Block) {
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db DatabaseDeleter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
+	DeleteStateDiff(db, hash, number)
+	DeleteReceiptExtras(db, hash, number)
 	DeleteHeader(db, hash, number)
 	DeleteBody(db, hash, number)
 	DeleteTd(db, hash, number)
@@ -379,3 +498,91 @@ func FindCommonAncestor(db DatabaseReader, a, b *types.Header) *types.Header {
 	}
 	return a
 }
+
+// badBlockLimit is the maximum number of bad blocks kept in the database.
+const badBlockLimit = 10
+
+// BadBlock is a block rejected by the local node along with the reason it
+// was rejected for.
+type BadBlock struct {
+	Header *types.Header
+	Body   *types.Body
+	Reason string
+}
+
+// Block reassembles the rejected block from its header and body.
+func (b *BadBlock) Block() *types.Block {
+	return types.NewBlockWithHeader(b.Header).WithBody(b.Body.Transactions, b.Body.Uncles)
+}
+
+// badBlockList implements sort.Interface, ordering bad blocks by number descending.
+type badBlockList []*BadBlock
+
+func (s badBlockList) Len() int { return len(s) }
+func (s badBlockList) Less(i, j int) bool {
+	return s[i].Header.Number.Cmp(s[j].Header.Number) > 0
+}
+func (s badBlockList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// ReadBadBlock retrieves the bad block with the corresponding block hash, or
+// nil if no such block was recorded.
+func ReadBadBlock(db DatabaseReader, hash common.Hash) *BadBlock {
+	for _, bad := range ReadAllBadBlocks(db) {
+		if bad.Header.Hash() == hash {
+			return bad
+		}
+	}
+	return nil
+}
+
+// ReadAllBadBlocks retrieves all the bad blocks in the database, the highest
+// first.
+func ReadAllBadBlocks(db DatabaseReader) []*BadBlock {
+	data, _ := db.Get(badBlockKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var bads badBlockList
+	if err := rlp.DecodeBytes(data, &bads); err != nil {
+		log.Error("Invalid bad block list RLP", "err", err)
+		return nil
+	}
+	return bads
+}
+
+// WriteBadBlock records a rejected block and the reason for it. Only the last
+// badBlockLimit blocks by number are kept, a block already present is ignored.
+func WriteBadBlock(db interface {
+	DatabaseReader
+	DatabaseWriter
+}, block *types.Block, reason string) {
+	bads := badBlockList(ReadAllBadBlocks(db))
+	for _, bad := range bads {
+		if bad.Header.Hash() == block.Hash() {
+			return
+		}
+	}
+	bads = append(bads, &BadBlock{
+		Header: block.Header(),
+		Body:   block.Body(),
+		Reason: reason,
+	})
+	sort.Sort(bads)
+	if len(bads) > badBlockLimit {
+		bads = bads[:badBlockLimit]
+	}
+	data, err := rlp.EncodeToBytes(bads)
+	if err != nil {
+		log.Crit("Failed to encode bad blocks", "err", err)
+	}
+	if err := db.Put(badBlockKey, data); err != nil {
+		log.Crit("Failed to store bad blocks", "err", err)
+	}
+}
+
+// DeleteBadBlocks removes all the recorded bad blocks.
+func DeleteBadBlocks(db DatabaseDeleter) {
+	if err := db.Delete(badBlockKey); err != nil {
+		log.Crit("Failed to delete bad blocks", "err", err)
+	}
+}
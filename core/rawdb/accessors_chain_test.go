@@ -317,3 +317,110 @@ func TestBlockReceiptStorage(t *testing.T) {
 		t.Fatalf("deleted receipts returned: %v", rs)
 	}
 }
+
+// Tests that state diffs associated with a block can be stored and retrieved.
+func TestStateDiffStorage(t *testing.T) {
+	db := mandb.NewMemDatabase()
+
+	diff := types.StateDiff{
+		{Address: common.BytesToAddress([]byte{0x11})},
+		{Address: common.BytesToAddress([]byte{0x22}), Storage: []common.Hash{{0x01}, {0x02}}},
+	}
+	hash := common.BytesToHash([]byte{0x03, 0x14})
+	if d := ReadStateDiff(db, hash, 0); d != nil {
+		t.Fatalf("non existent state diff returned: %v", d)
+	}
+	// An empty diff must be distinguishable from a missing one
+	WriteStateDiff(db, hash, 0, nil)
+	if d := ReadStateDiff(db, hash, 0); d == nil || len(d) != 0 {
+		t.Fatalf("empty state diff mismatch: have %v", d)
+	}
+	WriteStateDiff(db, hash, 0, diff)
+	if d := ReadStateDiff(db, hash, 0); len(d) != len(diff) {
+		t.Fatalf("state diff length mismatch: have %d, want %d", len(d), len(diff))
+	} else {
+		for i := range diff {
+			rlpHave, _ := rlp.EncodeToBytes(d[i])
+			rlpWant, _ := rlp.EncodeToBytes(diff[i])
+			if !bytes.Equal(rlpHave, rlpWant) {
+				t.Fatalf("account #%d: diff mismatch: have %v, want %v", i, d[i], diff[i])
+			}
+		}
+	}
+	DeleteStateDiff(db, hash, 0)
+	if d := ReadStateDiff(db, hash, 0); d != nil {
+		t.Fatalf("deleted state diff returned: %v", d)
+	}
+}
+
+// Tests that receipt extras are stored aligned with the receipts of a block.
+func TestReceiptExtrasStorage(t *testing.T) {
+	db := mandb.NewMemDatabase()
+
+	transfer := &types.InternalTransfer{From: common.Address{0x11}, To: common.Address{0x22}, Value: big.NewInt(1000)}
+	receipts := types.Receipts{
+		{Extras: &types.ReceiptExtras{RevertReason: []byte{0x08, 0xc3, 0x79, 0xa0}}},
+		{},
+		{Extras: &types.ReceiptExtras{Transfers: []*types.InternalTransfer{transfer}}},
+	}
+	hash := common.BytesToHash([]byte{0x03, 0x14})
+	if extras := ReadReceiptExtras(db, hash, 0); extras != nil {
+		t.Fatalf("non existent receipt extras returned: %v", extras)
+	}
+	WriteReceiptExtras(db, hash, 0, receipts)
+	extras := ReadReceiptExtras(db, hash, 0)
+	if len(extras) != len(receipts) {
+		t.Fatalf("receipt extras length mismatch: have %d, want %d", len(extras), len(receipts))
+	}
+	if !bytes.Equal(extras[0].RevertReason, receipts[0].Extras.RevertReason) || len(extras[0].Transfers) != 0 {
+		t.Errorf("receipt #0: extras mismatch: have %+v", extras[0])
+	}
+	if len(extras[1].RevertReason) != 0 || len(extras[1].Transfers) != 0 {
+		t.Errorf("receipt #1: extras mismatch: have %+v, want empty", extras[1])
+	}
+	if have := extras[2].Transfers; len(have) != 1 || have[0].From != transfer.From || have[0].To != transfer.To || have[0].Value.Cmp(transfer.Value) != 0 {
+		t.Errorf("receipt #2: transfers mismatch: have %v, want %v", have, transfer)
+	}
+	DeleteReceiptExtras(db, hash, 0)
+	if extras := ReadReceiptExtras(db, hash, 0); extras != nil {
+		t.Fatalf("deleted receipt extras returned: %v", extras)
+	}
+}
+
+// Tests that bad blocks are stored with their reason, deduplicated and capped.
+func TestBadBlockStorage(t *testing.T) {
+	db := mandb.NewMemDatabase()
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Extra: []byte("bad block")})
+	if bad := ReadBadBlock(db, block.Hash()); bad != nil {
+		t.Fatalf("non existent bad block returned: %v", bad)
+	}
+	WriteBadBlock(db, block, "invalid merkle root")
+	if bad := ReadBadBlock(db, block.Hash()); bad == nil {
+		t.Fatalf("stored bad block not found")
+	} else if bad.Block().Hash() != block.Hash() || bad.Reason != "invalid merkle root" {
+		t.Fatalf("bad block mismatch: have %x (%s), want %x", bad.Block().Hash(), bad.Reason, block.Hash())
+	}
+	// Writing the same block again must not duplicate it
+	WriteBadBlock(db, block, "invalid merkle root")
+	if bads := ReadAllBadBlocks(db); len(bads) != 1 {
+		t.Fatalf("bad block count mismatch: have %d, want 1", len(bads))
+	}
+	// Only the highest blocks must be retained
+	for i := 2; i <= badBlockLimit+5; i++ {
+		WriteBadBlock(db, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i))}), "invalid gas used")
+	}
+	bads := ReadAllBadBlocks(db)
+	if len(bads) != badBlockLimit {
+		t.Fatalf("bad block count mismatch: have %d, want %d", len(bads), badBlockLimit)
+	}
+	for i, bad := range bads {
+		if want := uint64(badBlockLimit + 5 - i); bad.Header.Number.Uint64() != want {
+			t.Fatalf("bad block #%d: number mismatch: have %d, want %d", i, bad.Header.Number, want)
+		}
+	}
+	DeleteBadBlocks(db)
+	if bads := ReadAllBadBlocks(db); len(bads) != 0 {
+		t.Fatalf("deleted bad blocks returned: %v", bads)
+	}
+}
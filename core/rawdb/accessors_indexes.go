@@ -22,6 +22,7 @@ import (
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/rlp"
 )
 
@@ -64,6 +65,99 @@ func DeleteTxLookupEntry(db DatabaseDeleter, hash common.Hash) {
 	db.Delete(append(txLookupPrefix, hash.Bytes()...))
 }
 
+// ReadTxIndexTail retrieves the number of the oldest block whose transactions
+// have lookup entries in the database, or nil if all blocks are indexed.
+func ReadTxIndexTail(db DatabaseReader) *uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteTxIndexTail stores the number of the oldest block whose transactions are
+// indexed.
+func WriteTxIndexTail(db DatabaseWriter, number uint64) {
+	if err := db.Put(txIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the transaction index tail", "err", err)
+	}
+}
+
+// WriteSenderTxEntries indexes every transaction of a block by its sender,
+// skipping the ones whose sender cannot be derived with the given signer.
+func WriteSenderTxEntries(db DatabaseWriter, signer types.Signer, block *types.Block) {
+	for i, tx := range block.Transactions() {
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		if err := db.Put(senderTxKey(sender, block.NumberU64(), uint64(i)), tx.Hash().Bytes()); err != nil {
+			log.Crit("Failed to store sender transaction entry", "err", err)
+		}
+	}
+}
+
+// DeleteSenderTxEntries removes the sender index entries of a block's transactions.
+func DeleteSenderTxEntries(db DatabaseDeleter, signer types.Signer, block *types.Block) {
+	for i, tx := range block.Transactions() {
+		if sender, err := types.Sender(signer, tx); err == nil {
+			db.Delete(senderTxKey(sender, block.NumberU64(), uint64(i)))
+		}
+	}
+}
+
+// ReadSenderTxEntries retrieves up to limit positions of transactions sent by
+// the given account, in chain order starting at the given block and index. The
+// entries are not checked against the canonical chain, which is up to the caller.
+func ReadSenderTxEntries(db mandb.Iteratee, sender common.Address, number uint64, index uint64, limit int) []SenderTxEntry {
+	it := db.NewIteratorWithPrefix(append(senderTxPrefix, sender.Bytes()...))
+	defer it.Release()
+
+	var (
+		entries []SenderTxEntry
+		offset  = len(senderTxPrefix) + common.AddressLength
+	)
+	for ok := it.Seek(senderTxKey(sender, number, index)); ok && len(entries) < limit; ok = it.Next() {
+		key := it.Key()
+		if len(key) != offset+16 || len(it.Value()) != common.HashLength {
+			continue
+		}
+		entries = append(entries, SenderTxEntry{
+			BlockNumber: binary.BigEndian.Uint64(key[offset:]),
+			Index:       binary.BigEndian.Uint64(key[offset+8:]),
+			Hash:        common.BytesToHash(it.Value()),
+		})
+	}
+	return entries
+}
+
+// ReadSenderTxIndexTail retrieves the number of the oldest block whose
+// transactions are indexed by sender, or nil if the index is not maintained.
+func ReadSenderTxIndexTail(db DatabaseReader) *uint64 {
+	data, _ := db.Get(senderTxIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteSenderTxIndexTail stores the number of the oldest block whose
+// transactions are indexed by sender.
+func WriteSenderTxIndexTail(db DatabaseWriter, number uint64) {
+	if err := db.Put(senderTxIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the sender transaction index tail", "err", err)
+	}
+}
+
+// DeleteSenderTxIndexTail marks the sender transaction index as not maintained.
+func DeleteSenderTxIndexTail(db DatabaseDeleter) {
+	if err := db.Delete(senderTxIndexTailKey); err != nil {
+		log.Crit("Failed to delete the sender transaction index tail", "err", err)
+	}
+}
+
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db DatabaseReader, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
@@ -17,6 +17,7 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"encoding/json"
 
 	"github.com/matrix/go-matrix/common"
@@ -27,22 +28,50 @@ import (
 
 // ReadDatabaseVersion retrieves the version number of the database.
 func ReadDatabaseVersion(db DatabaseReader) int {
-	var version int
+	var version uint64
 
 	enc, _ := db.Get(databaseVerisionKey)
 	rlp.DecodeBytes(enc, &version)
 
-	return version
+	return int(version)
 }
 
 // WriteDatabaseVersion stores the version number of the database
 func WriteDatabaseVersion(db DatabaseWriter, version int) {
-	enc, _ := rlp.EncodeToBytes(version)
+	enc, _ := rlp.EncodeToBytes(uint64(version))
 	if err := db.Put(databaseVerisionKey, enc); err != nil {
 		log.Crit("Failed to store the database version", "err", err)
 	}
 }
 
+// ReadUncleanShutdownMarker retrieves the unix time the last session of the node
+// was started at if it did not shut down cleanly, or nil otherwise.
+func ReadUncleanShutdownMarker(db DatabaseReader) *uint64 {
+	data, _ := db.Get(uncleanShutdownKey)
+	if len(data) != 8 {
+		return nil
+	}
+	started := binary.BigEndian.Uint64(data)
+	return &started
+}
+
+// WriteUncleanShutdownMarker flags the database as being in use since the given
+// unix time, until the marker is deleted on a clean shutdown.
+func WriteUncleanShutdownMarker(db DatabaseWriter, started uint64) {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, started)
+	if err := db.Put(uncleanShutdownKey, enc); err != nil {
+		log.Crit("Failed to store the unclean shutdown marker", "err", err)
+	}
+}
+
+// DeleteUncleanShutdownMarker marks the database as cleanly shut down.
+func DeleteUncleanShutdownMarker(db DatabaseDeleter) {
+	if err := db.Delete(uncleanShutdownKey); err != nil {
+		log.Crit("Failed to delete the unclean shutdown marker", "err", err)
+	}
+}
+
 // ReadChainConfig retrieves the consensus settings based on the given genesis hash.
 func ReadChainConfig(db DatabaseReader, hash common.Hash) *params.ChainConfig {
 	data, _ := db.Get(append(configPrefix, hash[:]...))
@@ -71,6 +100,20 @@ func WriteChainConfig(db DatabaseWriter, hash common.Hash, cfg *params.ChainConf
 	}
 }
 
+// ReadGenesisSpec retrieves the JSON genesis specification the chain with the
+// given genesis hash was initialised from.
+func ReadGenesisSpec(db DatabaseReader, hash common.Hash) []byte {
+	data, _ := db.Get(append(genesisPrefix, hash[:]...))
+	return data
+}
+
+// WriteGenesisSpec stores the JSON genesis specification of a chain.
+func WriteGenesisSpec(db DatabaseWriter, hash common.Hash, spec []byte) {
+	if err := db.Put(append(genesisPrefix, hash[:]...), spec); err != nil {
+		log.Crit("Failed to store genesis specification", "err", err)
+	}
+}
+
 // ReadPreimage retrieves a single preimage of the provided hash.
 func ReadPreimage(db DatabaseReader, hash common.Hash) []byte {
 	data, _ := db.Get(append(preimagePrefix, hash.Bytes()...))
@@ -13,41 +13,28 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Copyright 2013 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
 
-// +build !go1.2
+package rawdb
 
-package language
+import (
+	"testing"
 
-import "sort"
+	"github.com/matrix/go-matrix/mandb"
+)
 
-func sortStable(s sort.Interface) {
-	ss := stableSort{
-		s:   s,
-		pos: make([]int, s.Len()),
+// Tests that the unclean shutdown marker can be stored, retrieved and cleared.
+func TestUncleanShutdownMarker(t *testing.T) {
+	db := mandb.NewMemDatabase()
+
+	if started := ReadUncleanShutdownMarker(db); started != nil {
+		t.Fatalf("non existent marker returned: %v", *started)
 	}
-	for i := range ss.pos {
-		ss.pos[i] = i
+	WriteUncleanShutdownMarker(db, 1600000000)
+	if started := ReadUncleanShutdownMarker(db); started == nil || *started != 1600000000 {
+		t.Fatalf("marker mismatch: have %v, want %v", started, 1600000000)
+	}
+	DeleteUncleanShutdownMarker(db)
+	if started := ReadUncleanShutdownMarker(db); started != nil {
+		t.Fatalf("deleted marker returned: %v", *started)
 	}
-	sort.Sort(&ss)
-}
-
-type stableSort struct {
-	s   sort.Interface
-	pos []int
-}
-
-func (s *stableSort) Len() int {
-	return len(s.pos)
-}
-
-func (s *stableSort) Less(i, j int) bool {
-	return s.s.Less(i, j) || !s.s.Less(j, i) && s.pos[i] < s.pos[j]
-}
-
-func (s *stableSort) Swap(i, j int) {
-	s.s.Swap(i, j)
-	s.pos[i], s.pos[j] = s.pos[j], s.pos[i]
 }
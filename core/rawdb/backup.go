@@ -0,0 +1,133 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// errNoSnapshot is returned if a backup is requested of a database which can't
+// provide a consistent point-in-time view of its content.
+var errNoSnapshot = errors.New("database does not support snapshots")
+
+// Backup writes a point-in-time copy of the chain database into dir, which must
+// either not exist or be empty. The key-value store is copied from a snapshot,
+// so the database stays fully usable (and writable) during the backup.
+//
+// If the database has a freezer attached, the ancient blocks are copied into the
+// "ancient" folder of the backup, the default freezer location. The resulting
+// directory can thus be used as is in place of the original chain database.
+func Backup(db mandb.Database, dir string) error {
+	if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 {
+		return fmt.Errorf("backup destination %s not empty", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	snapshotter, ok := db.(mandb.Snapshotter)
+	if !ok {
+		return errNoSnapshot
+	}
+	// Blocks frozen while the snapshot is taken may have been deleted from the
+	// key-value store, so the ancients are only counted once it's done.
+	ancients, _ := db.(mandb.AncientReader)
+
+	var before uint64
+	if ancients != nil {
+		before, _ = ancients.Ancients()
+	}
+	snap, err := snapshotter.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	var frozen uint64
+	if ancients != nil {
+		frozen, _ = ancients.Ancients()
+	}
+	start := time.Now()
+
+	kvdb, err := mandb.NewLDBDatabase(dir, 16, 16)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	items, size, err := mandb.Backup(snap, kvdb)
+	if err != nil {
+		return err
+	}
+	log.Info("Backed up key-value store", "items", items, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	if frozen == 0 {
+		return nil
+	}
+	if err := backupAncients(ancients, filepath.Join(dir, "ancient"), frozen); err != nil {
+		return err
+	}
+	// Drop the blocks frozen during the snapshot from the copied key-value store,
+	// the same way the freezer would have done (the genesis is never deleted).
+	if before == 0 {
+		before = 1
+	}
+	for number := before; number < frozen; number++ {
+		if blob, err := ancients.Ancient(freezerHashTable, number); err == nil {
+			deleteFrozenBlock(kvdb, common.BytesToHash(blob), number)
+		}
+	}
+	log.Info("Backed up ancient store", "blocks", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// backupAncients copies the first items ancient blocks of a freezer into a new
+// one created at dir.
+func backupAncients(ancients mandb.AncientReader, dir string, items uint64) error {
+	freezer, err := mandb.NewFreezer(dir, "", freezerNoSnappy, false)
+	if err != nil {
+		return err
+	}
+	defer freezer.Close()
+
+	logged := time.Now()
+	for number := uint64(0); number < items; number++ {
+		blobs := make(map[string][]byte, len(freezerNoSnappy))
+		for kind := range freezerNoSnappy {
+			blob, err := ancients.Ancient(kind, number)
+			if err != nil {
+				return fmt.Errorf("ancient %s #%d: %v", kind, number, err)
+			}
+			blobs[kind] = blob
+		}
+		if err := freezer.AppendAncient(number, blobs); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Backing up ancient store", "blocks", number, "total", items)
+			logged = time.Now()
+		}
+	}
+	return freezer.Sync()
+}
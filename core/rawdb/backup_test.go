@@ -0,0 +1,94 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// Tests that a backup of a chain database with a freezer attached contains the
+// entire chain, readable once the backup is opened as a chain database itself.
+func TestBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvdb, err := mandb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	hashes := writeTestChain(kvdb, 20, "")
+
+	db, err := NewDatabaseWithFreezer(kvdb, filepath.Join(dir, "chaindata", "ancient"), "", 5, false)
+	if err != nil {
+		t.Fatalf("failed to open freezer database: %v", err)
+	}
+	defer db.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if frozen, _ := db.(mandb.AncientStore).Ancients(); frozen == 14 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("blocks not frozen in time")
+		}
+	}
+	backup := filepath.Join(dir, "backup")
+	if err := Backup(db, backup); err != nil {
+		t.Fatalf("failed to back up database: %v", err)
+	}
+	if err := Backup(db, backup); err == nil {
+		t.Fatalf("backup overwrote existing directory")
+	}
+	if err := Backup(mandb.NewTable(db, "x"), filepath.Join(dir, "other")); err != errNoSnapshot {
+		t.Fatalf("snapshotless backup error mismatch: have %v, want %v", err, errNoSnapshot)
+	}
+	// Open the backup as a chain database and check that the chain is complete
+	restored, err := mandb.NewReadOnlyLDBDatabase(backup, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+
+	rdb, err := NewDatabaseWithFreezer(restored, filepath.Join(backup, "ancient"), "", 5, true)
+	if err != nil {
+		restored.Close()
+		t.Fatalf("failed to open backup freezer: %v", err)
+	}
+	defer rdb.Close()
+	if frozen, _ := rdb.(mandb.AncientStore).Ancients(); frozen != 14 {
+		t.Errorf("backup frozen blocks mismatch: have %d, want 14", frozen)
+	}
+	for i, hash := range hashes {
+		if header := ReadHeader(rdb, hash, uint64(i)); header == nil || header.Hash() != hash {
+			t.Errorf("block #%d: backup header mismatch: have %v", i, header)
+		}
+		if !HasBody(rdb, hash, uint64(i)) {
+			t.Errorf("block #%d: backup body missing", i)
+		}
+	}
+	if head := ReadHeadBlockHash(rdb); head != hashes[len(hashes)-1] {
+		t.Errorf("backup head mismatch: have %x, want %x", head, hashes[len(hashes)-1])
+	}
+}
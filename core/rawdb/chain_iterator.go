@@ -0,0 +1,123 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// errInterrupted is returned if a transaction index operation is aborted.
+var errInterrupted = errors.New("transaction indexing interrupted")
+
+// IndexTransactions writes the transaction lookup entries of the canonical
+// blocks in the [from, to) range, overwriting any stale or corrupted entries.
+// If the range extends the indexed chain segment downwards, the index tail is
+// moved accordingly. The operation may be aborted by closing interrupt.
+func IndexTransactions(db mandb.Database, from uint64, to uint64, interrupt <-chan struct{}) error {
+	return iterateTransactions(db, from, to, interrupt, "Indexing transactions", func(batch mandb.Batch, number uint64, hash common.Hash) {
+		WriteTxLookupEntries(batch, ReadBlock(db, hash, number))
+	}, func(batch mandb.Batch) {
+		if tail := ReadTxIndexTail(db); tail != nil && from < *tail && to >= *tail {
+			WriteTxIndexTail(batch, from)
+		}
+	})
+}
+
+// UnindexTransactions removes the transaction lookup entries of the canonical
+// blocks in the [from, to) range. If the range covers the oldest indexed block,
+// the index tail is moved up to the end of the range. The operation may be
+// aborted by closing interrupt.
+func UnindexTransactions(db mandb.Database, from uint64, to uint64, interrupt <-chan struct{}) error {
+	return iterateTransactions(db, from, to, interrupt, "Unindexing transactions", func(batch mandb.Batch, number uint64, hash common.Hash) {
+		for _, tx := range ReadBody(db, hash, number).Transactions {
+			DeleteTxLookupEntry(batch, tx.Hash())
+		}
+	}, func(batch mandb.Batch) {
+		if tail := ReadTxIndexTail(db); (tail == nil && from == 0) || (tail != nil && from <= *tail && to > *tail) {
+			WriteTxIndexTail(batch, to)
+		}
+	})
+}
+
+// IndexSenderTransactions indexes the transactions of the canonical blocks in
+// the [from, to) range by sender. If the range extends the indexed chain segment
+// downwards, the sender index tail is moved accordingly. The operation may be
+// aborted by closing interrupt.
+func IndexSenderTransactions(db mandb.Database, config *params.ChainConfig, from uint64, to uint64, interrupt <-chan struct{}) error {
+	return iterateTransactions(db, from, to, interrupt, "Indexing transactions by sender", func(batch mandb.Batch, number uint64, hash common.Hash) {
+		WriteSenderTxEntries(batch, types.MakeSigner(config, new(big.Int).SetUint64(number)), ReadBlock(db, hash, number))
+	}, func(batch mandb.Batch) {
+		if tail := ReadSenderTxIndexTail(db); tail != nil && from < *tail && to >= *tail {
+			WriteSenderTxIndexTail(batch, from)
+		}
+	})
+}
+
+// iterateTransactions runs an index operation over all the canonical blocks
+// in the [from, to) range, flushing the changes in batches and finalizing the
+// index metadata once the entire range is processed.
+func iterateTransactions(db mandb.Database, from uint64, to uint64, interrupt <-chan struct{}, msg string, process func(mandb.Batch, uint64, common.Hash), finalize func(mandb.Batch)) error {
+	var (
+		batch  = db.NewBatch()
+		start  = time.Now()
+		logged = time.Now()
+		blocks uint64
+	)
+	for number := from; number < to; number++ {
+		select {
+		case <-interrupt:
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			log.Debug(msg+" interrupted", "from", from, "to", number, "elapsed", common.PrettyDuration(time.Since(start)))
+			return errInterrupted
+		default:
+		}
+		hash := ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) || !HasBody(db, hash, number) {
+			// Blocks may be missing in the middle of a sync, keep going
+			continue
+		}
+		process(batch, number, hash)
+		blocks++
+
+		if batch.ValueSize() >= mandb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info(msg, "from", from, "to", to, "current", number, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	finalize(batch)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info(msg+" finished", "from", from, "to", to, "blocks", blocks, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// Tests that the transaction lookup entries of a block range can be rebuilt and
+// removed, tracking the oldest indexed block.
+func TestIndexTransactions(t *testing.T) {
+	db := mandb.NewMemDatabase()
+
+	var blocks []*types.Block
+	for i := uint64(0); i < 10; i++ {
+		tx := types.NewTransaction(i, common.BytesToAddress([]byte{0x11}), big.NewInt(111), 1111, big.NewInt(11111), nil)
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(i)}, []*types.Transaction{tx}, nil, nil)
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), i)
+		blocks = append(blocks, block)
+	}
+	// verify checks that exactly the blocks in [from, to) are indexed
+	verify := func(from, to uint64, tail *uint64) {
+		t.Helper()
+		for i, block := range blocks {
+			tx := block.Transactions()[0]
+			hash, number, _ := ReadTxLookupEntry(db, tx.Hash())
+			if indexed := uint64(i) >= from && uint64(i) < to; indexed != (hash == block.Hash() && number == uint64(i)) {
+				t.Errorf("block #%d: index mismatch: have %x/%d, want indexed %v", i, hash, number, indexed)
+			}
+		}
+		if have := ReadTxIndexTail(db); (have == nil) != (tail == nil) || (have != nil && *have != *tail) {
+			t.Errorf("index tail mismatch: have %v, want %v", have, tail)
+		}
+	}
+	if err := IndexTransactions(db, 0, 10, nil); err != nil {
+		t.Fatalf("failed to index transactions: %v", err)
+	}
+	verify(0, 10, nil)
+
+	tail := uint64(4)
+	if err := UnindexTransactions(db, 0, 4, nil); err != nil {
+		t.Fatalf("failed to unindex transactions: %v", err)
+	}
+	verify(4, 10, &tail)
+
+	// Reindexing a range adjacent to the tail extends the index downwards
+	tail = 2
+	if err := IndexTransactions(db, 2, 4, nil); err != nil {
+		t.Fatalf("failed to index transactions: %v", err)
+	}
+	verify(2, 10, &tail)
+
+	// Interrupted operations leave the index tail untouched
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if err := UnindexTransactions(db, 2, 8, interrupt); err != errInterrupted {
+		t.Fatalf("interrupted unindexing error mismatch: have %v, want %v", err, errInterrupted)
+	}
+	verify(2, 10, &tail)
+}
+
+// Tests that transactions are indexed by sender in chain order and that the
+// listing can be resumed from any position.
+func TestIndexSenderTransactions(t *testing.T) {
+	var (
+		db     = mandb.NewMemDatabase()
+		config = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		signer = types.MakeSigner(config, big.NewInt(0))
+		key1   = crypto.ToECDSAUnsafe(common.FromHex("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"))
+		key2   = crypto.ToECDSAUnsafe(common.FromHex("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a"))
+		addr1  = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2  = crypto.PubkeyToAddress(key2.PublicKey)
+	)
+	// Block i contains i transactions of the first account followed by one of the second
+	var blocks []*types.Block
+	for i := uint64(0); i < 5; i++ {
+		var txs []*types.Transaction
+		for j := uint64(0); j <= i; j++ {
+			key := key1
+			if j == i {
+				key = key2
+			}
+			tx, _ := types.SignTx(types.NewTransaction(i*10+j, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+			txs = append(txs, tx)
+		}
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(i)}, txs, nil, nil)
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), i)
+		blocks = append(blocks, block)
+	}
+	// Index the last block live and backfill the rest, as the chain would
+	WriteSenderTxIndexTail(db, 4)
+	WriteSenderTxEntries(db, signer, blocks[4])
+	if err := IndexSenderTransactions(db, config, 0, 4, nil); err != nil {
+		t.Fatalf("failed to index transactions: %v", err)
+	}
+	if tail := ReadSenderTxIndexTail(db); tail == nil || *tail != 0 {
+		t.Fatalf("index tail mismatch: have %v, want 0", tail)
+	}
+	// Page through the transactions of the first account
+	var (
+		all           []SenderTxEntry
+		number, index uint64
+	)
+	for {
+		entries := ReadSenderTxEntries(db, addr1, number, index, 3)
+		all = append(all, entries...)
+		if len(entries) < 3 {
+			break
+		}
+		last := entries[len(entries)-1]
+		number, index = last.BlockNumber, last.Index+1
+	}
+	if len(all) != 10 {
+		t.Fatalf("entry count mismatch: have %d, want 10", len(all))
+	}
+	for i, entry := range all {
+		if i > 0 && (entry.BlockNumber < all[i-1].BlockNumber || (entry.BlockNumber == all[i-1].BlockNumber && entry.Index <= all[i-1].Index)) {
+			t.Errorf("entry %d out of order: %d/%d after %d/%d", i, entry.BlockNumber, entry.Index, all[i-1].BlockNumber, all[i-1].Index)
+		}
+		if tx := blocks[entry.BlockNumber].Transactions()[entry.Index]; tx.Hash() != entry.Hash {
+			t.Errorf("entry %d hash mismatch: have %x, want %x", i, entry.Hash, tx.Hash())
+		}
+	}
+	// The second account sent the last transaction of every block
+	entries := ReadSenderTxEntries(db, addr2, 2, 0, 10)
+	if len(entries) != 3 || entries[0].BlockNumber != 2 || entries[0].Index != 2 {
+		t.Fatalf("second account entries mismatch: %v", entries)
+	}
+	// Deleted blocks disappear from the index
+	DeleteSenderTxEntries(db, signer, blocks[4])
+	if entries := ReadSenderTxEntries(db, addr2, 0, 0, 10); len(entries) != 4 {
+		t.Errorf("entry count after deletion mismatch: have %d, want 4", len(entries))
+	}
+}
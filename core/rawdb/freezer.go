@@ -0,0 +1,277 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+const (
+	// DefaultFreezerThreshold is the number of recent blocks kept in the key-value
+	// store, everything older is moved into the freezer. It's deep enough for any
+	// chain reorganisation to be impossible.
+	DefaultFreezerThreshold = 90000
+
+	// freezerRecheckInterval is the frequency to check the key-value database for
+	// chain progression that might permit new blocks to be frozen into immutable
+	// storage.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting it from the key-value store.
+	freezerBatchLimit = 30000
+
+	// freezerCompactionThreshold is the amount of chain data wiped from the active
+	// key-value store after which it is compacted to reclaim the disk space.
+	freezerCompactionThreshold = 1024 * 1024 * 1024
+)
+
+var (
+	// errGenesisMismatch is returned if the ancient store was created for a
+	// different chain than the one in the key-value store.
+	errGenesisMismatch = errors.New("ancient chain genesis mismatch")
+
+	// errNoIterator is returned when iterating a key-value store which doesn't
+	// support it.
+	errNoIterator = errors.New("database does not support iteration")
+)
+
+// freezerdb is a database wrapper that enables freezer data retrievals. Ancient
+// blocks are moved in the background from the key-value store into the freezer,
+// keeping only the recent part of the chain in the active database.
+type freezerdb struct {
+	mandb.Database
+	*mandb.Freezer
+
+	threshold uint64                     // Number of recent blocks to keep in the key-value store
+	compactor *mandb.CompactionScheduler // Compacts the key-value store after large wipes
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDatabaseWithFreezer creates a high level database on top of a given key-
+// value data store with a freezer moving immutable chain segments older than
+// threshold blocks into cold storage at the given path.
+//
+// In read-only mode the existing freezer is only attached for retrievals, no
+// blocks are moved into it and it is never truncated.
+func NewDatabaseWithFreezer(db mandb.Database, freezer string, namespace string, threshold uint64, readonly bool) (mandb.Database, error) {
+	frdb, err := mandb.NewFreezer(freezer, namespace, freezerNoSnappy, readonly)
+	if err != nil {
+		return nil, err
+	}
+	// Since the freezer can be stored separately from the user's key-value database,
+	// there's a fairly high probability that the user requests invalid combinations
+	// of the freezer and database. Ensure that we don't shoot ourselves in the foot
+	// by serving up conflicting data, leading to both datastores getting corrupted.
+	if frozen, _ := frdb.Ancients(); frozen > 0 {
+		genesis, _ := frdb.Ancient(freezerHashTable, 0)
+		if kvgenesis := ReadCanonicalHash(db, 0); kvgenesis != common.BytesToHash(genesis) {
+			frdb.Close()
+			return nil, fmt.Errorf("%v: ancient %x, key-value %x", errGenesisMismatch, genesis, kvgenesis)
+		}
+		// If the key-value store was rewound below the freezer (e.g. crash during a
+		// SetHead), drop the ancient blocks not part of the chain any more.
+		if number := ReadHeaderNumber(db, ReadHeadHeaderHash(db)); number != nil && *number+1 < frozen {
+			if readonly {
+				log.Warn("Ancient blocks above the chain head", "head", *number, "frozen", frozen)
+			} else {
+				log.Warn("Truncating dangling ancient blocks", "head", *number, "frozen", frozen)
+				if err := frdb.TruncateAncients(*number + 1); err != nil {
+					frdb.Close()
+					return nil, err
+				}
+			}
+		}
+	}
+	fdb := &freezerdb{
+		Database:  db,
+		Freezer:   frdb,
+		threshold: threshold,
+		compactor: mandb.NewCompactionScheduler(db, freezerCompactionThreshold),
+		quit:      make(chan struct{}),
+	}
+	if !readonly {
+		fdb.wg.Add(1)
+		go fdb.freeze()
+	}
+
+	return fdb, nil
+}
+
+// Snapshot implements mandb.Snapshotter, returning a read view of the key-value
+// store. Ancient data is immutable and thus needs no snapshotting.
+func (db *freezerdb) Snapshot() (mandb.Snapshot, error) {
+	if snapshotter, ok := db.Database.(mandb.Snapshotter); ok {
+		return snapshotter.Snapshot()
+	}
+	return nil, errNoSnapshot
+}
+
+// NewIteratorWithPrefix implements mandb.Iteratee, iterating over the key-value
+// store. Ancient data is not included.
+func (db *freezerdb) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	if iteratee, ok := db.Database.(mandb.Iteratee); ok {
+		return iteratee.NewIteratorWithPrefix(prefix)
+	}
+	return iterator.NewEmptyIterator(errNoIterator)
+}
+
+// Close implements mandb.Database, stopping the background freezer before
+// closing both the freezer and the key-value store.
+func (db *freezerdb) Close() {
+	close(db.quit)
+	db.wg.Wait()
+	db.compactor.Wait()
+
+	if err := db.Freezer.Close(); err != nil {
+		log.Error("Failed to close ancient database", "err", err)
+	}
+	db.Database.Close()
+}
+
+// freeze is a background thread that periodically checks the blockchain for any
+// import progress and moves ancient data from the fast database into the freezer.
+func (db *freezerdb) freeze() {
+	defer db.wg.Done()
+
+	for {
+		// Keep freezing batches until there's nothing left to freeze or we fail
+		blocks, err := db.freezeBatch()
+		if err != nil {
+			log.Error("Failed to freeze ancient blocks", "err", err)
+		}
+		if blocks > 0 && err == nil {
+			select {
+			case <-db.quit:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-db.quit:
+			return
+		case <-time.After(freezerRecheckInterval):
+		}
+	}
+}
+
+// freezeBatch moves the next batch of canonical blocks older than the threshold
+// from the key-value store into the freezer, returning the number of blocks moved.
+func (db *freezerdb) freezeBatch() (int, error) {
+	nfdb := db.Database
+
+	// Retrieve the freezing threshold
+	hash := ReadHeadBlockHash(nfdb)
+	if hash == (common.Hash{}) {
+		log.Debug("Current full block hash unavailable") // new chain, empty database
+		return 0, nil
+	}
+	number := ReadHeaderNumber(nfdb, hash)
+	if number == nil {
+		return 0, fmt.Errorf("current full block number unavailable: %x", hash)
+	}
+	frozen, _ := db.Ancients()
+	if *number < db.threshold || *number-db.threshold <= frozen {
+		log.Debug("Ancient blocks frozen already", "number", *number, "frozen", frozen)
+		return 0, nil
+	}
+	limit := *number - db.threshold
+	if limit-frozen > freezerBatchLimit {
+		limit = frozen + freezerBatchLimit
+	}
+	// Move the canonical blocks into the freezer one by one
+	var (
+		start    = time.Now()
+		first    = frozen
+		ancients = make([]common.Hash, 0, limit-frozen)
+		size     uint64
+	)
+	for frozen < limit {
+		hash := ReadCanonicalHash(nfdb, frozen)
+		if hash == (common.Hash{}) {
+			return 0, fmt.Errorf("canonical hash missing for #%d", frozen)
+		}
+		items := map[string][]byte{
+			freezerHashTable:       hash.Bytes(),
+			freezerHeaderTable:     ReadHeaderRLP(nfdb, hash, frozen),
+			freezerBodiesTable:     ReadBodyRLP(nfdb, hash, frozen),
+			freezerReceiptTable:    readReceiptsRLP(nfdb, hash, frozen),
+			freezerDifficultyTable: readTdRLP(nfdb, hash, frozen),
+		}
+		for kind, data := range items {
+			if len(data) == 0 {
+				return 0, fmt.Errorf("block #%d [%x…] %s missing", frozen, hash[:4], kind)
+			}
+			size += uint64(len(data))
+		}
+		if err := db.AppendAncient(frozen, items); err != nil {
+			return 0, err
+		}
+		ancients = append(ancients, hash)
+		frozen++
+	}
+	// Batch of blocks have been frozen, flush them before wiping from the database
+	if err := db.Sync(); err != nil {
+		log.Crit("Failed to flush frozen tables", "err", err)
+	}
+	for i, hash := range ancients {
+		// Always keep the genesis block in the active database
+		if number := first + uint64(i); number != 0 {
+			deleteFrozenBlock(nfdb, hash, number)
+		}
+	}
+	db.compactor.Deleted(size)
+
+	log.Info("Deep froze chain segment", "blocks", len(ancients), "elapsed", common.PrettyDuration(time.Since(start)),
+		"number", frozen-1, "hash", ancients[len(ancients)-1], "size", common.StorageSize(size))
+	return len(ancients), nil
+}
+
+// readReceiptsRLP retrieves all the transaction receipts belonging to a block
+// in their raw RLP storage encoding.
+func readReceiptsRLP(db DatabaseReader, hash common.Hash, number uint64) []byte {
+	data, _ := db.Get(blockReceiptsKey(number, hash))
+	return data
+}
+
+// readTdRLP retrieves a block's total difficulty in its raw RLP encoding.
+func readTdRLP(db DatabaseReader, hash common.Hash, number uint64) []byte {
+	data, _ := db.Get(headerTDKey(number, hash))
+	return data
+}
+
+// deleteFrozenBlock removes all the data of a canonical block already moved into
+// the freezer from the key-value store. The hash to number mapping is retained as
+// that is not frozen.
+func deleteFrozenBlock(db DatabaseDeleter, hash common.Hash, number uint64) {
+	for _, key := range [][]byte{headerHashKey(number), headerKey(number, hash), headerTDKey(number, hash), blockBodyKey(number, hash), blockReceiptsKey(number, hash)} {
+		if err := db.Delete(key); err != nil {
+			log.Crit("Failed to delete frozen block data", "number", number, "hash", hash, "err", err)
+		}
+	}
+}
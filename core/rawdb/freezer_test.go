@@ -0,0 +1,140 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// writeTestChain stores a canonical chain of n empty blocks into db, returning
+// the block hashes.
+func writeTestChain(db mandb.Database, n int, extra string) []common.Hash {
+	var (
+		hashes = make([]common.Hash, n)
+		parent common.Hash
+	)
+	for i := 0; i < n; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Extra: []byte(extra)}
+		hash := header.Hash()
+
+		WriteHeader(db, header)
+		WriteBody(db, hash, uint64(i), &types.Body{})
+		WriteReceipts(db, hash, uint64(i), types.Receipts{})
+		WriteTd(db, hash, uint64(i), big.NewInt(int64(i+1)))
+		WriteCanonicalHash(db, hash, uint64(i))
+
+		hashes[i], parent = hash, hash
+	}
+	WriteHeadHeaderHash(db, parent)
+	WriteHeadBlockHash(db, parent)
+	return hashes
+}
+
+// Tests that the freezer moves ancient blocks out of the key-value store and that
+// the chain accessors transparently retrieve them from the ancient store.
+func TestFreezerMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvdb := mandb.NewMemDatabase()
+	hashes := writeTestChain(kvdb, 20, "")
+
+	db, err := NewDatabaseWithFreezer(kvdb, dir, "", 5, false)
+	if err != nil {
+		t.Fatalf("failed to open freezer database: %v", err)
+	}
+	ancients := db.(mandb.AncientStore)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if frozen, _ := ancients.Ancients(); frozen == 14 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			frozen, _ := ancients.Ancients()
+			t.Fatalf("frozen blocks mismatch: have %d, want 14", frozen)
+		}
+	}
+	for i, hash := range hashes {
+		number := uint64(i)
+
+		// Frozen blocks except the genesis must be gone from the key-value store
+		if has, _ := kvdb.Has(headerKey(number, hash)); has != (number == 0 || number >= 14) {
+			t.Errorf("block #%d: key-value presence mismatch: have %v", number, has)
+		}
+		// All of them must be transparently accessible
+		if have := ReadCanonicalHash(db, number); have != hash {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", number, have, hash)
+		}
+		if header := ReadHeader(db, hash, number); header == nil || header.Hash() != hash {
+			t.Errorf("block #%d: header mismatch: have %v", number, header)
+		}
+		if !HasHeader(db, hash, number) || !HasBody(db, hash, number) {
+			t.Errorf("block #%d: header or body reported missing", number)
+		}
+		if body := ReadBody(db, hash, number); body == nil {
+			t.Errorf("block #%d: body missing", number)
+		}
+		if td := ReadTd(db, hash, number); td == nil || td.Uint64() != number+1 {
+			t.Errorf("block #%d: total difficulty mismatch: have %v, want %d", number, td, number+1)
+		}
+		if receipts := ReadReceipts(db, hash, number); receipts == nil {
+			t.Errorf("block #%d: receipts missing", number)
+		}
+		// Non-canonical lookups must not be served from the freezer
+		if header := ReadHeader(db, common.Hash{0x01}, number); header != nil {
+			t.Errorf("block #%d: non-canonical header returned", number)
+		}
+	}
+	db.Close()
+
+	// Reopening the freezer must only work on top of the same chain
+	if db, err = NewDatabaseWithFreezer(kvdb, dir, "", 5, false); err != nil {
+		t.Fatalf("failed to reopen freezer database: %v", err)
+	}
+	db.Close()
+
+	// A read-only freezer must serve the ancient blocks without touching them
+	if db, err = NewDatabaseWithFreezer(kvdb, dir, "", 1, true); err != nil {
+		t.Fatalf("failed to reopen freezer database read-only: %v", err)
+	}
+	if header := ReadHeader(db, hashes[3], 3); header == nil || header.Hash() != hashes[3] {
+		t.Errorf("read-only header mismatch: have %v", header)
+	}
+	if frozen, _ := db.(mandb.AncientStore).Ancients(); frozen != 14 {
+		t.Errorf("read-only frozen blocks mismatch: have %d, want 14", frozen)
+	}
+	if err := db.(mandb.AncientStore).TruncateAncients(0); err == nil {
+		t.Errorf("read-only freezer truncated")
+	}
+	db.Close()
+
+	other := mandb.NewMemDatabase()
+	writeTestChain(other, 20, "other")
+	if _, err := NewDatabaseWithFreezer(other, dir, "", 5, false); err == nil {
+		t.Fatalf("freezer opened on top of a different chain")
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+// Migration upgrades the database schema from the previous version to Version,
+// rewriting the affected entries through the provided migrator.
+type Migration struct {
+	Version int    // Schema version the database is at after the migration
+	Name    string // Short description of the migration for the logs
+	Migrate func(m *Migrator) error
+}
+
+// migrationUndo is a journal entry recording the value of a database key before
+// a migration overwrote it.
+type migrationUndo struct {
+	Key     []byte
+	Value   []byte
+	Existed bool
+}
+
+// Migrator is handed to migrations to rewrite database entries. Every write is
+// journaled along with the value it replaces, so that a failed or interrupted
+// migration can be rolled back, leaving the database at the previous version.
+//
+// Writes are flushed in batches, reads through Database are only guaranteed to
+// observe them once Flush has been called.
+type Migrator struct {
+	db      mandb.Database
+	batch   mandb.Batch
+	version int
+	name    string
+	seq     uint64
+
+	start  time.Time
+	logged time.Time
+}
+
+// Database returns the database being migrated, for reading its entries.
+func (m *Migrator) Database() mandb.Database {
+	return m.db
+}
+
+// Put journals the current value of key and replaces it with value.
+func (m *Migrator) Put(key, value []byte) error {
+	if err := m.journal(key); err != nil {
+		return err
+	}
+	if err := m.batch.Put(key, value); err != nil {
+		return err
+	}
+	return m.maybeFlush()
+}
+
+// Delete journals the current value of key and removes it.
+func (m *Migrator) Delete(key []byte) error {
+	if err := m.journal(key); err != nil {
+		return err
+	}
+	if err := m.batch.Delete(key); err != nil {
+		return err
+	}
+	return m.maybeFlush()
+}
+
+// Flush writes all pending changes into the database.
+func (m *Migrator) Flush() error {
+	if err := m.batch.Write(); err != nil {
+		return err
+	}
+	m.batch.Reset()
+	return nil
+}
+
+// Progress reports the advancement of the migration, logging it periodically.
+func (m *Migrator) Progress(done, total uint64) {
+	if time.Since(m.logged) < 8*time.Second {
+		return
+	}
+	log.Info("Migrating database", "version", m.version, "migration", m.name, "done", done, "total", total, "elapsed", common.PrettyDuration(time.Since(m.start)))
+	m.logged = time.Now()
+}
+
+// journal records the value of key before it's modified. Keys modified more
+// than once are journaled each time, undoing the entries in reverse order thus
+// restores the original value.
+func (m *Migrator) journal(key []byte) error {
+	value, err := m.db.Get(key)
+	blob, err := rlp.EncodeToBytes(&migrationUndo{Key: key, Value: value, Existed: err == nil})
+	if err != nil {
+		return err
+	}
+	m.seq++
+	return m.batch.Put(migrationUndoKey(m.version, m.seq), blob)
+}
+
+func (m *Migrator) maybeFlush() error {
+	if m.batch.ValueSize() < mandb.IdealBatchSize {
+		return nil
+	}
+	return m.Flush()
+}
+
+// MigrateDatabase upgrades the database schema from its current version to the
+// given one, running the required migrations in order. Each migration is applied
+// atomically: on failure its changes are rolled back and the database is left at
+// the last successfully reached version. Migrations interrupted by a crash are
+// rolled back on the next invocation.
+//
+// Unversioned databases are stamped with the target version directly. Databases
+// newer than the target, or which lack a migration path to it, are rejected.
+func MigrateDatabase(db mandb.Database, target int, migrations []Migration) error {
+	version := ReadDatabaseVersion(db)
+	if err := recoverMigration(db, version); err != nil {
+		return err
+	}
+	switch {
+	case version == target:
+		return nil
+	case version == 0:
+		WriteDatabaseVersion(db, target)
+		return nil
+	case version > target:
+		return fmt.Errorf("database version %d is newer than the supported %d", version, target)
+	}
+	for version < target {
+		var migration *Migration
+		for i := range migrations {
+			if migrations[i].Version == version+1 {
+				migration = &migrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return fmt.Errorf("no migration from database version %d to %d, resync required", version, version+1)
+		}
+		if err := runMigration(db, migration); err != nil {
+			return err
+		}
+		version = migration.Version
+	}
+	return nil
+}
+
+// runMigration applies a single migration, rolling it back on failure.
+func runMigration(db mandb.Database, migration *Migration) error {
+	log.Warn("Upgrading database", "version", migration.Version, "migration", migration.Name)
+
+	m := &Migrator{
+		db:      db,
+		batch:   db.NewBatch(),
+		version: migration.Version,
+		name:    migration.Name,
+		start:   time.Now(),
+		logged:  time.Now(),
+	}
+	err := migration.Migrate(m)
+	if err == nil {
+		err = m.Flush()
+	}
+	if err != nil {
+		log.Error("Database migration failed, rolling back", "version", migration.Version, "migration", migration.Name, "err", err)
+		if rerr := rollbackMigration(db, migration.Version); rerr != nil {
+			return fmt.Errorf("migration to version %d failed (%v), rollback failed: %v", migration.Version, err, rerr)
+		}
+		return fmt.Errorf("migration to version %d failed: %v", migration.Version, err)
+	}
+	WriteDatabaseVersion(db, migration.Version)
+	if err := dropMigrationJournal(db); err != nil {
+		return err
+	}
+	log.Info("Upgraded database", "version", migration.Version, "migration", migration.Name, "elapsed", common.PrettyDuration(time.Since(m.start)))
+	return nil
+}
+
+// recoverMigration cleans up after a migration interrupted by a crash: journals
+// of migrations beyond the current version are rolled back, the ones of already
+// completed migrations are simply dropped.
+func recoverMigration(db mandb.Database, version int) error {
+	iteratee, ok := db.(mandb.Iteratee)
+	if !ok {
+		return nil
+	}
+	it := iteratee.NewIteratorWithPrefix(migrationJournalPrefix(version + 1))
+	pending := it.Next()
+	it.Release()
+
+	if pending {
+		log.Warn("Rolling back interrupted database migration", "version", version+1)
+		if err := rollbackMigration(db, version+1); err != nil {
+			return err
+		}
+	}
+	return dropMigrationJournal(db)
+}
+
+// rollbackMigration restores all the entries journaled by a migration to the
+// given version, latest changes first, and deletes the journal along the way.
+func rollbackMigration(db mandb.Database, version int) error {
+	iteratee, ok := db.(mandb.Iteratee)
+	if !ok {
+		return errNoIterator
+	}
+	it := iteratee.NewIteratorWithPrefix(migrationJournalPrefix(version))
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		var undo migrationUndo
+		if err := rlp.DecodeBytes(it.Value(), &undo); err != nil {
+			return fmt.Errorf("invalid migration journal entry: %v", err)
+		}
+		if undo.Existed {
+			batch.Put(undo.Key, undo.Value)
+		} else {
+			batch.Delete(undo.Key)
+		}
+		batch.Delete(common.CopyBytes(it.Key()))
+		if batch.ValueSize() >= mandb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// dropMigrationJournal deletes all the journal entries of completed migrations.
+func dropMigrationJournal(db mandb.Database) error {
+	iteratee, ok := db.(mandb.Iteratee)
+	if !ok {
+		return nil
+	}
+	it := iteratee.NewIteratorWithPrefix(migrationUndoPrefix)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		batch.Delete(common.CopyBytes(it.Key()))
+		if batch.ValueSize() >= mandb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
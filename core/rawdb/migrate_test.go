@@ -0,0 +1,157 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// rewriteMigration is a test migration upgrading to the given version, which
+// rewrites the value of "key", deletes "gone" and creates "new", optionally
+// failing afterwards.
+func rewriteMigration(version int, value []byte, fail error) Migration {
+	return Migration{
+		Version: version,
+		Name:    "rewrite",
+		Migrate: func(m *Migrator) error {
+			for i := 0; i < 3; i++ {
+				if err := m.Put([]byte("key"), append(value, byte(i))); err != nil {
+					return err
+				}
+			}
+			if err := m.Delete([]byte("gone")); err != nil {
+				return err
+			}
+			if err := m.Put([]byte("new"), value); err != nil {
+				return err
+			}
+			return fail
+		},
+	}
+}
+
+func newMigrationTestDB(version int) *mandb.MemDatabase {
+	db := mandb.NewMemDatabase()
+	db.Put([]byte("key"), []byte("original"))
+	db.Put([]byte("gone"), []byte("deleted"))
+	WriteDatabaseVersion(db, version)
+	return db
+}
+
+// checkPremigration verifies that a database holds the values written by
+// newMigrationTestDB and no migration journal.
+func checkPremigration(t *testing.T, db *mandb.MemDatabase, version int) {
+	t.Helper()
+
+	if v := ReadDatabaseVersion(db); v != version {
+		t.Errorf("version mismatch: have %d, want %d", v, version)
+	}
+	if value, _ := db.Get([]byte("key")); !bytes.Equal(value, []byte("original")) {
+		t.Errorf("rewritten value not restored: have %q", value)
+	}
+	if value, _ := db.Get([]byte("gone")); !bytes.Equal(value, []byte("deleted")) {
+		t.Errorf("deleted value not restored: have %q", value)
+	}
+	if ok, _ := db.Has([]byte("new")); ok {
+		t.Errorf("created value not removed")
+	}
+	if it := db.NewIteratorWithPrefix(migrationUndoPrefix); it.Next() {
+		t.Errorf("migration journal left behind: %x", it.Key())
+	}
+}
+
+// Tests that migrations are applied in order up to the target version.
+func TestMigrateDatabase(t *testing.T) {
+	db := newMigrationTestDB(1)
+	migrations := []Migration{
+		rewriteMigration(3, []byte("third"), nil),
+		rewriteMigration(2, []byte("second"), nil),
+	}
+	if err := MigrateDatabase(db, 3, migrations); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	if v := ReadDatabaseVersion(db); v != 3 {
+		t.Errorf("version mismatch: have %d, want %d", v, 3)
+	}
+	if value, _ := db.Get([]byte("key")); !bytes.Equal(value, []byte("third\x02")) {
+		t.Errorf("value mismatch: have %q, want %q", value, "third\x02")
+	}
+	if ok, _ := db.Has([]byte("gone")); ok {
+		t.Errorf("deleted value still present")
+	}
+	if it := db.NewIteratorWithPrefix(migrationUndoPrefix); it.Next() {
+		t.Errorf("migration journal left behind: %x", it.Key())
+	}
+	// Already migrated databases must be left alone, newer ones rejected
+	if err := MigrateDatabase(db, 3, nil); err != nil {
+		t.Errorf("failed to open migrated database: %v", err)
+	}
+	if err := MigrateDatabase(db, 2, migrations); err == nil {
+		t.Errorf("newer database accepted")
+	}
+}
+
+// Tests that a failing migration is rolled back, leaving the database at the
+// last version successfully reached.
+func TestMigrateDatabaseRollback(t *testing.T) {
+	db := newMigrationTestDB(1)
+	migrations := []Migration{
+		rewriteMigration(2, []byte("second"), errors.New("boom")),
+	}
+	if err := MigrateDatabase(db, 2, migrations); err == nil {
+		t.Fatalf("failing migration succeeded")
+	}
+	checkPremigration(t, db, 1)
+
+	// Missing migration steps must be reported instead of skipped
+	if err := MigrateDatabase(db, 3, migrations[:0]); err == nil {
+		t.Fatalf("migration without a path succeeded")
+	}
+	checkPremigration(t, db, 1)
+}
+
+// Tests that the journal of a migration interrupted by a crash is rolled back
+// before migrating again.
+func TestMigrateDatabaseRecovery(t *testing.T) {
+	db := newMigrationTestDB(1)
+
+	// Simulate a crash right after a flush in the middle of a migration
+	m := &Migrator{db: db, batch: db.NewBatch(), version: 2, name: "crash"}
+	m.Put([]byte("key"), []byte("partial"))
+	m.Delete([]byte("gone"))
+	m.Flush()
+
+	if err := MigrateDatabase(db, 1, nil); err != nil {
+		t.Fatalf("failed to recover database: %v", err)
+	}
+	checkPremigration(t, db, 1)
+}
+
+// Tests that unversioned databases are stamped with the target version.
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	if err := MigrateDatabase(db, 3, nil); err != nil {
+		t.Fatalf("failed to stamp database: %v", err)
+	}
+	if v := ReadDatabaseVersion(db); v != 3 {
+		t.Errorf("version mismatch: have %d, want %d", v, 3)
+	}
+}
@@ -19,6 +19,7 @@ package rawdb
 
 import (
 	"encoding/binary"
+	"math"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/metrics"
@@ -41,6 +42,24 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
+	txIndexTailKey = []byte("TransactionIndexTail")
+
+	// senderTxIndexTailKey tracks the oldest block whose transactions have been indexed by sender.
+	senderTxIndexTailKey = []byte("SenderTransactionIndexTail")
+
+	// snapshotRootKey tracks the state root the flat state snapshot is built for.
+	snapshotRootKey = []byte("SnapshotRoot")
+
+	// snapshotGeneratorKey tracks the progress of the flat state snapshot generation.
+	snapshotGeneratorKey = []byte("SnapshotGenerator")
+
+	// badBlockKey tracks the list of bad blocks seen by the local node.
+	badBlockKey = []byte("InvalidBlock")
+
+	// uncleanShutdownKey tracks the start time of a running node, removed on a clean shutdown.
+	uncleanShutdownKey = []byte("UncleanShutdown")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -49,12 +68,21 @@ var (
 
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+	stateDiffPrefix     = []byte("d") // stateDiffPrefix + num (uint64 big endian) + hash -> modified accounts and slots
+	receiptExtrasPrefix = []byte("e") // receiptExtrasPrefix + num (uint64 big endian) + hash -> revert reasons and internal transfers
 
 	txLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
+	senderTxPrefix  = []byte("x") // senderTxPrefix + sender + num (uint64 big endian) + index (uint64 big endian) -> transaction hash
 	bloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 
-	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
-	configPrefix   = []byte("matrix-config-") // config prefix for the db
+	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
+	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
+
+	preimagePrefix = []byte("secure-key-")     // preimagePrefix + hash -> preimage
+	configPrefix   = []byte("matrix-config-")  // config prefix for the db
+	genesisPrefix  = []byte("matrix-genesis-") // genesis specification prefix for the db
+
+	migrationUndoPrefix = []byte("migration-undo-") // migrationUndoPrefix + version (uint64 big endian) + reverse seq (uint64 big endian) -> overwritten entry
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
@@ -63,6 +91,33 @@ var (
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
 )
 
+const (
+	// freezerHeaderTable indicates the name of the freezer header table.
+	freezerHeaderTable = "headers"
+
+	// freezerHashTable indicates the name of the freezer canonical hash table.
+	freezerHashTable = "hashes"
+
+	// freezerBodiesTable indicates the name of the freezer block body table.
+	freezerBodiesTable = "bodies"
+
+	// freezerReceiptTable indicates the name of the freezer receipts table.
+	freezerReceiptTable = "receipts"
+
+	// freezerDifficultyTable indicates the name of the freezer total difficulty table.
+	freezerDifficultyTable = "diffs"
+)
+
+// freezerNoSnappy configures whether compression is disabled for the ancient
+// tables. Hashes and difficulties don't compress well.
+var freezerNoSnappy = map[string]bool{
+	freezerHeaderTable:     false,
+	freezerHashTable:       true,
+	freezerBodiesTable:     false,
+	freezerReceiptTable:    false,
+	freezerDifficultyTable: true,
+}
+
 // TxLookupEntry is a positional metadata to help looking up the data content of
 // a transaction or receipt given only its hash.
 type TxLookupEntry struct {
@@ -71,9 +126,86 @@ type TxLookupEntry struct {
 	Index      uint64
 }
 
+// SenderTxEntry is the position of a transaction in the chain, as listed by the
+// index of transactions by sender.
+type SenderTxEntry struct {
+	BlockNumber uint64
+	Index       uint64
+	Hash        common.Hash
+}
+
+// migrationUndoKey = migrationUndoPrefix + version (uint64 big endian) + reverse seq (uint64 big endian)
+//
+// The sequence number is stored inverted so that iterating the journal yields
+// the latest overwrites first, the order in which they must be undone.
+func migrationUndoKey(version int, seq uint64) []byte {
+	return append(migrationJournalPrefix(version), encodeBlockNumber(math.MaxUint64-seq)...)
+}
+
+// migrationJournalPrefix = migrationUndoPrefix + version (uint64 big endian)
+func migrationJournalPrefix(version int) []byte {
+	return append(append([]byte{}, migrationUndoPrefix...), encodeBlockNumber(uint64(version))...)
+}
+
 // encodeBlockNumber encodes a block number as big endian uint64
 func encodeBlockNumber(number uint64) []byte {
 	enc := make([]byte, 8)
 	binary.BigEndian.PutUint64(enc, number)
 	return enc
 }
+
+// headerKey = headerPrefix + num (uint64 big endian) + hash
+func headerKey(number uint64, hash common.Hash) []byte {
+	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// headerTDKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
+func headerTDKey(number uint64, hash common.Hash) []byte {
+	return append(headerKey(number, hash), headerTDSuffix...)
+}
+
+// headerHashKey = headerPrefix + num (uint64 big endian) + headerHashSuffix
+func headerHashKey(number uint64) []byte {
+	return append(append(headerPrefix, encodeBlockNumber(number)...), headerHashSuffix...)
+}
+
+// blockBodyKey = blockBodyPrefix + num (uint64 big endian) + hash
+func blockBodyKey(number uint64, hash common.Hash) []byte {
+	return append(append(blockBodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// blockReceiptsKey = blockReceiptsPrefix + num (uint64 big endian) + hash
+func blockReceiptsKey(number uint64, hash common.Hash) []byte {
+	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// stateDiffKey = stateDiffPrefix + num (uint64 big endian) + hash
+func stateDiffKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateDiffPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// receiptExtrasKey = receiptExtrasPrefix + num (uint64 big endian) + hash
+func receiptExtrasKey(number uint64, hash common.Hash) []byte {
+	return append(append(receiptExtrasPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// senderTxKey = senderTxPrefix + sender + num (uint64 big endian) + index (uint64 big endian)
+func senderTxKey(sender common.Address, number uint64, index uint64) []byte {
+	key := append(append(senderTxPrefix, sender.Bytes()...), encodeBlockNumber(number)...)
+	return append(key, encodeBlockNumber(index)...)
+}
+
+// accountSnapshotKey = SnapshotAccountPrefix + hash
+func accountSnapshotKey(hash common.Hash) []byte {
+	return append(append([]byte{}, SnapshotAccountPrefix...), hash.Bytes()...)
+}
+
+// storageSnapshotKey = SnapshotStoragePrefix + account hash + storage hash
+func storageSnapshotKey(accountHash, storageHash common.Hash) []byte {
+	return append(append(append([]byte{}, SnapshotStoragePrefix...), accountHash.Bytes()...), storageHash.Bytes()...)
+}
+
+// storageSnapshotsKey = SnapshotStoragePrefix + account hash
+func storageSnapshotsKey(accountHash common.Hash) []byte {
+	return append(append([]byte{}, SnapshotStoragePrefix...), accountHash.Bytes()...)
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+var (
+	errMissingCode      = errors.New("missing contract code")
+	errCodeHashMismatch = errors.New("contract code hash mismatch")
+)
+
+// CheckConsistency walks the account trie at root along with every storage trie
+// and contract code it references, reporting all missing or corrupted entries.
+func CheckConsistency(db Database, root common.Hash) []*trie.ConsistencyError {
+	return checkTrie(db, root, nil, true)
+}
+
+// CheckDamaged re-checks the entries previously reported by CheckConsistency,
+// along with everything below them, returning the ones still damaged. After
+// healing, this avoids walking the parts of the state already found complete.
+func CheckDamaged(db Database, damaged []*trie.ConsistencyError) []*trie.ConsistencyError {
+	var remaining []*trie.ConsistencyError
+	for _, item := range damaged {
+		if item.Err == errMissingCode || item.Err == errCodeHashMismatch {
+			if err := checkCode(db, item.Hash); err != nil {
+				remaining = append(remaining, &trie.ConsistencyError{Hash: item.Hash, Err: err})
+			}
+			continue
+		}
+		// The entry may belong to either an account or a storage trie, so leaves
+		// not decoding into accounts are storage slots rather than damage
+		remaining = append(remaining, checkTrie(db, item.Hash, item.Path, false)...)
+	}
+	return remaining
+}
+
+// checkTrie walks the trie rooted at the node with the given hash and path,
+// descending into the storage tries and contract codes of the accounts reached.
+// If strict is set, leaves must decode into accounts.
+func checkTrie(db Database, root common.Hash, path []byte, strict bool) []*trie.ConsistencyError {
+	var damaged []*trie.ConsistencyError
+	callback := func(leaf []byte, parent common.Hash) error {
+		var obj Account
+		if err := rlp.Decode(bytes.NewReader(leaf), &obj); err != nil {
+			if strict {
+				return err
+			}
+			return nil
+		}
+		damaged = append(damaged, trie.CheckConsistency(db.TrieDB(), obj.Root, nil)...)
+
+		if !bytes.Equal(obj.CodeHash, emptyCodeHash) {
+			hash := common.BytesToHash(obj.CodeHash)
+			if err := checkCode(db, hash); err != nil {
+				damaged = append(damaged, &trie.ConsistencyError{Hash: hash, Err: err})
+			}
+		}
+		return nil
+	}
+	errs := trie.CheckConsistency(db.TrieDB(), root, callback)
+	for _, err := range errs {
+		err.Path = append(common.CopyBytes(path), err.Path...)
+	}
+	return append(errs, damaged...)
+}
+
+// checkCode verifies that the contract code with the given hash is present and
+// uncorrupted.
+func checkCode(db Database, hash common.Hash) error {
+	code, err := db.ContractCode(common.Hash{}, hash)
+	switch {
+	case err != nil || len(code) == 0:
+		return errMissingCode
+	case crypto.Keccak256Hash(code) != hash:
+		return errCodeHashMismatch
+	}
+	return nil
+}
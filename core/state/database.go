@@ -76,9 +76,15 @@ type Trie interface {
 // intermediate trie-node memory pool between the low level storage layer and the
 // high level trie abstraction.
 func NewDatabase(db mandb.Database) Database {
+	return NewDatabaseWithConfig(db, &trie.Config{Preimages: true})
+}
+
+// NewDatabaseWithConfig creates a backing store for state, configuring the
+// underlying trie database with the given options.
+func NewDatabaseWithConfig(db mandb.Database, config *trie.Config) Database {
 	csc, _ := lru.New(codeSizeCacheSize)
 	return &cachingDB{
-		db:            trie.NewDatabase(db),
+		db:            trie.NewDatabaseWithConfig(db, config),
 		codeSizeCache: csc,
 	}
 }
@@ -17,10 +17,14 @@
 package state
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/rlp"
 	"github.com/matrix/go-matrix/trie"
 )
@@ -32,6 +36,13 @@ type DumpAccount struct {
 	CodeHash string            `json:"codeHash"`
 	Code     string            `json:"code"`
 	Storage  map[string]string `json:"storage"`
+
+	// SecureKey is the hashed key of the account in the state trie. It is only
+	// set in iterative dumps, where it doubles as the pagination cursor.
+	SecureKey hexutil.Bytes `json:"key,omitempty"`
+
+	// Address is only set in streamed dumps, where accounts aren't keyed by it.
+	Address string `json:"address,omitempty"`
 }
 
 type Dump struct {
@@ -39,35 +50,85 @@ type Dump struct {
 	Accounts map[string]DumpAccount `json:"accounts"`
 }
 
-func (self *StateDB) RawDump() Dump {
-	dump := Dump{
-		Root:     fmt.Sprintf("%x", self.trie.Hash()),
-		Accounts: make(map[string]DumpAccount),
-	}
+// IteratorDump is a single page of an iterative state dump. Accounts whose
+// address preimage is unknown are keyed by their secure trie key instead.
+type IteratorDump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+	Next     hexutil.Bytes          `json:"next,omitempty"` // Secure key to continue from, nil if done
+}
 
-	it := trie.NewIterator(self.trie.NodeIterator(nil))
-	for it.Next() {
+// dump walks the state trie starting at the given secure key, handing at most
+// maxResults (0 for unlimited) accounts to the callback. It returns the secure
+// key of the next account, or nil if the end of the trie was reached.
+//
+// Accounts are visited in secure trie key order, which only depends on the
+// state itself, so every node produces the same sequence for the same root.
+func (self *StateDB) dump(onAccount func(addr []byte, account DumpAccount), excludeCode, excludeStorage, excludeMissingPreimages bool, start []byte, maxResults int) []byte {
+	it := trie.NewIterator(self.trie.NodeIterator(start))
+	for count := 0; it.Next(); {
+		if maxResults > 0 && count >= maxResults {
+			return common.CopyBytes(it.Key)
+		}
 		addr := self.trie.GetKey(it.Key)
+		if addr == nil && excludeMissingPreimages {
+			continue
+		}
 		var data Account
 		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
 			panic(err)
 		}
-
 		obj := newObject(nil, common.BytesToAddress(addr), data)
 		account := DumpAccount{
-			Balance:  data.Balance.String(),
-			Nonce:    data.Nonce,
-			Root:     common.Bytes2Hex(data.Root[:]),
-			CodeHash: common.Bytes2Hex(data.CodeHash),
-			Code:     common.Bytes2Hex(obj.Code(self.db)),
-			Storage:  make(map[string]string),
+			Balance:   data.Balance.String(),
+			Nonce:     data.Nonce,
+			Root:      common.Bytes2Hex(data.Root[:]),
+			CodeHash:  common.Bytes2Hex(data.CodeHash),
+			SecureKey: common.CopyBytes(it.Key),
 		}
-		storageIt := trie.NewIterator(obj.getTrie(self.db).NodeIterator(nil))
-		for storageIt.Next() {
-			account.Storage[common.Bytes2Hex(self.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(storageIt.Value)
+		if !excludeCode {
+			account.Code = common.Bytes2Hex(obj.Code(self.db))
 		}
+		if !excludeStorage {
+			account.Storage = make(map[string]string)
+			storageIt := trie.NewIterator(obj.getTrie(self.db).NodeIterator(nil))
+			for storageIt.Next() {
+				account.Storage[common.Bytes2Hex(self.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(storageIt.Value)
+			}
+		}
+		onAccount(addr, account)
+		count++
+	}
+	return nil
+}
+
+func (self *StateDB) RawDump() Dump {
+	dump := Dump{
+		Root:     fmt.Sprintf("%x", self.trie.Hash()),
+		Accounts: make(map[string]DumpAccount),
+	}
+	self.dump(func(addr []byte, account DumpAccount) {
+		account.SecureKey = nil
 		dump.Accounts[common.Bytes2Hex(addr)] = account
+	}, false, false, false, nil, 0)
+	return dump
+}
+
+// IteratorDump dumps a page of at most maxResults accounts (0 for unlimited),
+// starting at the given secure trie key. Code, storage and accounts without a
+// known address preimage can be left out to keep pages small.
+func (self *StateDB) IteratorDump(excludeCode, excludeStorage, excludeMissingPreimages bool, start []byte, maxResults int) IteratorDump {
+	dump := IteratorDump{
+		Root:     fmt.Sprintf("%x", self.trie.Hash()),
+		Accounts: make(map[string]DumpAccount),
 	}
+	dump.Next = self.dump(func(addr []byte, account DumpAccount) {
+		key := common.Bytes2Hex(addr)
+		if addr == nil {
+			key = "0x" + common.Bytes2Hex(account.SecureKey)
+		}
+		dump.Accounts[key] = account
+	}, excludeCode, excludeStorage, excludeMissingPreimages, start, maxResults)
 	return dump
 }
 
@@ -79,3 +140,70 @@ func (self *StateDB) Dump() []byte {
 
 	return json
 }
+
+// IterativeDump streams the state to w as JSON lines: the state root first,
+// followed by one account per line in secure trie key order. Storage slots are
+// sorted by key within each account, making the output canonical.
+func (self *StateDB) IterativeDump(excludeCode, excludeStorage, excludeMissingPreimages bool, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(struct {
+		Root string `json:"root"`
+	}{fmt.Sprintf("%x", self.trie.Hash())}); err != nil {
+		return err
+	}
+	var err error
+	self.dump(func(addr []byte, account DumpAccount) {
+		if err != nil {
+			return
+		}
+		if addr != nil {
+			account.Address = common.Bytes2Hex(addr)
+		}
+		err = enc.Encode(account)
+	}, excludeCode, excludeStorage, excludeMissingPreimages, nil, 0)
+	return err
+}
+
+// CSVDump streams the state to w as CSV with one address,key,field,value record
+// per account field and storage slot, so two dumps can be compared line by line.
+// Accounts are written in secure trie key order and their storage slots sorted
+// by key, following the fixed balance, nonce, root, codeHash and code fields.
+func (self *StateDB) CSVDump(excludeCode, excludeStorage, excludeMissingPreimages bool, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"address", "key", "field", "value"}); err != nil {
+		return err
+	}
+	var err error
+	self.dump(func(addr []byte, account DumpAccount) {
+		if err != nil {
+			return
+		}
+		var (
+			address = common.Bytes2Hex(addr)
+			key     = common.Bytes2Hex(account.SecureKey)
+		)
+		records := [][]string{
+			{address, key, "balance", account.Balance},
+			{address, key, "nonce", fmt.Sprint(account.Nonce)},
+			{address, key, "root", account.Root},
+			{address, key, "codeHash", account.CodeHash},
+		}
+		if !excludeCode {
+			records = append(records, []string{address, key, "code", account.Code})
+		}
+		slots := make([]string, 0, len(account.Storage))
+		for slot := range account.Storage {
+			slots = append(slots, slot)
+		}
+		sort.Strings(slots)
+		for _, slot := range slots {
+			records = append(records, []string{address, key, "storage." + slot, account.Storage[slot]})
+		}
+		err = cw.WriteAll(records)
+	}, excludeCode, excludeStorage, excludeMissingPreimages, nil, 0)
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -17,7 +17,9 @@
 package state
 
 import (
+	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/matrix/go-matrix/common"
 )
@@ -32,12 +34,26 @@ type journalEntry interface {
 	dirtied() *common.Address
 }
 
+// revision is a snapshot of the journal, identified by a unique id and pointing
+// at the journal length when it was taken.
+type revision struct {
+	id           int
+	journalIndex int
+}
+
 // journal contains the list of state modifications applied since the last state
 // commit. These are tracked to be able to be reverted in case of an execution
 // exception or revertal request.
+//
+// Snapshots are cheap markers into the change list: taking one costs O(1) and
+// reverting to one costs O(changes since the snapshot), independent of how many
+// nested snapshots were taken in between.
 type journal struct {
 	entries []journalEntry         // Current changes tracked by the journal
 	dirties map[common.Address]int // Dirty accounts and the number of changes
+
+	validRevisions []revision // Stack of live snapshots, ordered by id
+	nextRevisionId int        // Id handed out to the next snapshot
 }
 
 // newJournal create a new initialized journal.
@@ -47,6 +63,47 @@ func newJournal() *journal {
 	}
 }
 
+// reset clears the journal so it can be reused for the next transaction. The
+// allocated change list and dirty map are kept to avoid reallocating them for
+// every transaction. Revision ids keep increasing so that stale ids taken
+// before the reset cannot accidentally match a new snapshot.
+func (j *journal) reset() {
+	for i := range j.entries {
+		j.entries[i] = nil
+	}
+	j.entries = j.entries[:0]
+	for addr := range j.dirties {
+		delete(j.dirties, addr)
+	}
+	j.validRevisions = j.validRevisions[:0]
+}
+
+// snapshot returns an identifier for the current revision of the journal.
+func (j *journal) snapshot() int {
+	id := j.nextRevisionId
+	j.nextRevisionId++
+	j.validRevisions = append(j.validRevisions, revision{id, len(j.entries)})
+	return id
+}
+
+// revertToSnapshot undoes all changes made since the given revision and drops
+// the revision along with every snapshot taken after it.
+func (j *journal) revertToSnapshot(revid int, statedb *StateDB) {
+	// The most recent snapshot is by far the most common target (a failing
+	// call frame), so check it before searching the stack.
+	idx := len(j.validRevisions) - 1
+	if idx < 0 || j.validRevisions[idx].id != revid {
+		idx = sort.Search(len(j.validRevisions), func(i int) bool {
+			return j.validRevisions[i].id >= revid
+		})
+		if idx == len(j.validRevisions) || j.validRevisions[idx].id != revid {
+			panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+		}
+	}
+	j.revert(statedb, j.validRevisions[idx].journalIndex)
+	j.validRevisions = j.validRevisions[:idx]
+}
+
 // append inserts a new modification entry to the end of the change journal.
 func (j *journal) append(entry journalEntry) {
 	j.entries = append(j.entries, entry)
@@ -68,6 +125,7 @@ func (j *journal) revert(statedb *StateDB, snapshot int) {
 				delete(j.dirties, *addr)
 			}
 		}
+		j.entries[i] = nil
 	}
 	j.entries = j.entries[:snapshot]
 }
@@ -91,6 +149,11 @@ type (
 	}
 	resetObjectChange struct {
 		prev *stateObject
+
+		// Snapshot modifications of the previous object, dropped on reset
+		prevDestruct bool
+		prevAccount  []byte
+		prevStorage  map[common.Hash][]byte
 	}
 	suicideChange struct {
 		account     *common.Address
@@ -144,6 +207,17 @@ func (ch createObjectChange) dirtied() *common.Address {
 
 func (ch resetObjectChange) revert(s *StateDB) {
 	s.setStateObject(ch.prev)
+	if s.snap != nil {
+		if !ch.prevDestruct {
+			delete(s.snapDestructs, ch.prev.addrHash)
+		}
+		if ch.prevAccount != nil {
+			s.snapAccounts[ch.prev.addrHash] = ch.prevAccount
+		}
+		if ch.prevStorage != nil {
+			s.snapStorage[ch.prev.addrHash] = ch.prevStorage
+		}
+	}
 }
 
 func (ch resetObjectChange) dirtied() *common.Address {
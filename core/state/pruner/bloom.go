@@ -13,44 +13,57 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Code generated by linux/mkall.go generatePtracePair(arm, arm64). DO NOT EDIT.
 
-// +build linux
-// +build arm arm64
+package pruner
 
-package unix
+import (
+	"encoding/binary"
 
-import "unsafe"
+	"github.com/matrix/go-matrix/common"
+)
 
-// PtraceRegsArm is the registers used by arm binaries.
-type PtraceRegsArm struct {
-	Uregs [18]uint32
-}
-
-// PtraceGetRegsArm fetches the registers used by arm binaries.
-func PtraceGetRegsArm(pid int, regsout *PtraceRegsArm) error {
-	return ptrace(PTRACE_GETREGS, pid, 0, uintptr(unsafe.Pointer(regsout)))
-}
+// bloomHashes is the number of bit positions each key sets in the filter.
+const bloomHashes = 4
 
-// PtraceSetRegsArm sets the registers used by arm binaries.
-func PtraceSetRegsArm(pid int, regs *PtraceRegsArm) error {
-	return ptrace(PTRACE_SETREGS, pid, 0, uintptr(unsafe.Pointer(regs)))
+// stateBloom is a bloom filter of trie node and contract code hashes. As those
+// keys are hashes already, the bit positions are taken straight from the key
+// bytes instead of hashing them again.
+//
+// False positives only cause some stale entries to survive pruning, so the
+// filter size trades memory for thoroughness.
+type stateBloom struct {
+	bits  []uint64
+	nbits uint64
 }
 
-// PtraceRegsArm64 is the registers used by arm64 binaries.
-type PtraceRegsArm64 struct {
-	Regs   [31]uint64
-	Sp     uint64
-	Pc     uint64
-	Pstate uint64
+// newStateBloom creates a bloom filter of the given size in bytes.
+func newStateBloom(size uint64) *stateBloom {
+	words := (size + 7) / 8
+	if words == 0 {
+		words = 1
+	}
+	return &stateBloom{
+		bits:  make([]uint64, words),
+		nbits: words * 64,
+	}
 }
 
-// PtraceGetRegsArm64 fetches the registers used by arm64 binaries.
-func PtraceGetRegsArm64(pid int, regsout *PtraceRegsArm64) error {
-	return ptrace(PTRACE_GETREGS, pid, 0, uintptr(unsafe.Pointer(regsout)))
+// add inserts a hash into the filter.
+func (b *stateBloom) add(hash common.Hash) {
+	for i := 0; i < bloomHashes; i++ {
+		pos := binary.BigEndian.Uint64(hash[i*8:]) % b.nbits
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
 }
 
-// PtraceSetRegsArm64 sets the registers used by arm64 binaries.
-func PtraceSetRegsArm64(pid int, regs *PtraceRegsArm64) error {
-	return ptrace(PTRACE_SETREGS, pid, 0, uintptr(unsafe.Pointer(regs)))
+// contains returns whether the given hash might have been inserted into the
+// filter.
+func (b *stateBloom) contains(hash []byte) bool {
+	for i := 0; i < bloomHashes; i++ {
+		pos := binary.BigEndian.Uint64(hash[i*8:]) % b.nbits
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
 }
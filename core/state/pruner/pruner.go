@@ -0,0 +1,194 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package pruner implements offline pruning of stale state from a database.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+
+	errNoIterator = errors.New("database does not support iteration")
+)
+
+// Pruner is an offline tool to delete stale state from a database. It marks
+// every trie node and contract code reachable from the retained state roots in
+// a bloom filter, then sweeps the database and deletes all other trie nodes
+// and codes.
+//
+// Trie nodes and codes are the only entries stored under bare 32 byte hash
+// keys, every other kind of data is prefixed and left untouched.
+type Pruner struct {
+	db    mandb.Database
+	bloom *stateBloom
+}
+
+// NewPruner creates a pruner for the given database, using a bloom filter of
+// the given size in bytes to track the retained state.
+func NewPruner(db mandb.Database, bloomSize uint64) (*Pruner, error) {
+	if _, ok := db.(mandb.Iteratee); !ok {
+		return nil, errNoIterator
+	}
+	return &Pruner{
+		db:    db,
+		bloom: newStateBloom(bloomSize),
+	}, nil
+}
+
+// Prune deletes all the trie nodes and codes from the database that are not
+// part of any of the given states. The states must be complete.
+func (p *Pruner) Prune(roots ...common.Hash) error {
+	start := time.Now()
+	for _, root := range roots {
+		if err := p.mark(root); err != nil {
+			return fmt.Errorf("state %x: %v", root, err)
+		}
+	}
+	log.Info("Marked retained state", "roots", len(roots), "elapsed", common.PrettyDuration(time.Since(start)))
+
+	if err := p.sweep(); err != nil {
+		return err
+	}
+	// Reclaim the disk space freed up by the deletions
+	if compacter, ok := p.db.(mandb.Compacter); ok {
+		cstart := time.Now()
+		log.Info("Compacting database")
+		if err := compacter.Compact(nil, nil); err != nil {
+			return err
+		}
+		log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	}
+	return nil
+}
+
+// mark walks the state with the given root, adding all its trie nodes and
+// codes to the bloom filter.
+func (p *Pruner) mark(root common.Hash) error {
+	var (
+		triedb  = trie.NewDatabase(p.db)
+		storage = make(map[common.Hash]struct{})
+		nodes   int
+		logged  = time.Now()
+	)
+	tr, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			p.bloom.add(hash)
+			nodes++
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Marking retained state", "root", root, "nodes", nodes, "storage", len(storage))
+			logged = time.Now()
+		}
+		if !it.Leaf() {
+			continue
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+			return err
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			p.bloom.add(common.BytesToHash(account.CodeHash))
+		}
+		// Storage tries are content addressed, walk each distinct one only once
+		if _, ok := storage[account.Root]; ok || account.Root == emptyRoot {
+			continue
+		}
+		storage[account.Root] = struct{}{}
+
+		st, err := trie.New(account.Root, triedb)
+		if err != nil {
+			return err
+		}
+		sit := st.NodeIterator(nil)
+		for sit.Next(true) {
+			if hash := sit.Hash(); hash != (common.Hash{}) {
+				p.bloom.add(hash)
+				nodes++
+			}
+		}
+		if err := sit.Error(); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// sweep deletes all trie nodes and codes not contained in the bloom filter.
+func (p *Pruner) sweep() error {
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		batch   = p.db.NewBatch()
+		deleted int
+		size    common.StorageSize
+	)
+	it := p.db.(mandb.Iteratee).NewIteratorWithPrefix(nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength || p.bloom.contains(key) {
+			continue
+		}
+		deleted++
+		size += common.StorageSize(len(key) + len(it.Value()))
+
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= mandb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning stale state", "deleted", deleted, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned stale state", "deleted", deleted, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
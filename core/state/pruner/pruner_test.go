@@ -0,0 +1,107 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// makeTestState creates a state on top of the given parent, with every account
+// balance, the storage and the code derived from the seed, and flushes it to
+// disk.
+func makeTestState(t *testing.T, db state.Database, parent common.Hash, seed byte) common.Hash {
+	statedb, err := state.New(parent, db)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", parent, err)
+	}
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		statedb.SetBalance(addr, big.NewInt(int64(seed)*int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%4 == 0 {
+			statedb.SetCode(addr, []byte{seed, i})
+		}
+		if i%2 == 0 {
+			statedb.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{seed, i}))
+		}
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return root
+}
+
+// Tests that pruning to a state retains all of it while deleting the stale
+// trie nodes and unrelated database entries survive.
+func TestPrune(t *testing.T) {
+	diskdb := mandb.NewMemDatabase()
+	db := state.NewDatabase(diskdb)
+
+	oldRoot := makeTestState(t, db, common.Hash{}, 1)
+	newRoot := makeTestState(t, db, oldRoot, 2)
+
+	diskdb.Put([]byte("unrelated"), []byte{0x01})
+	before := diskdb.Len()
+
+	pruner, err := NewPruner(diskdb, 1024*1024)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(newRoot); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if diskdb.Len() >= before {
+		t.Fatalf("nothing pruned: have %d entries, had %d", diskdb.Len(), before)
+	}
+	if ok, _ := diskdb.Has(oldRoot[:]); ok {
+		t.Errorf("stale state root %x still present", oldRoot)
+	}
+	if ok, _ := diskdb.Has([]byte("unrelated")); !ok {
+		t.Errorf("unrelated entry pruned")
+	}
+	// Iterate the whole retained state from a fresh cache, it must be complete
+	statedb, err := state.New(newRoot, state.NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("failed to open pruned state: %v", err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("pruned state incomplete: %v", it.Error)
+	}
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		if balance := statedb.GetBalance(addr); balance.Cmp(big.NewInt(2*int64(i+1))) != 0 {
+			t.Errorf("account %d: balance mismatch: have %v, want %v", i, balance, 2*int64(i+1))
+		}
+		if i%4 == 0 {
+			if code := statedb.GetCode(addr); len(code) != 2 || code[0] != 2 {
+				t.Errorf("account %d: code mismatch: have %x", i, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// diskLayer is a low level persistent snapshot built on top of a key-value store.
+type diskLayer struct {
+	diskdb mandb.Database // Key-value store containing the base snapshot
+	triedb *trie.Database // Trie node cache for reconstruction purposes
+	root   common.Hash    // Root hash of the base snapshot
+	stale  bool           // Signals that the layer became stale (state progressed)
+
+	genMarker []byte           // Marker for the state that's indexed during initial layer generation
+	genAbort  chan chan []byte // Notification channel to abort generating the snapshot in this layer
+
+	lock sync.RWMutex
+}
+
+// newDiskLayer creates a disk layer for the given root. If the generation
+// marker is non-nil, the background generator is resumed from it.
+func newDiskLayer(diskdb mandb.Database, triedb *trie.Database, root common.Hash, marker []byte) *diskLayer {
+	dl := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: marker,
+	}
+	if marker != nil {
+		dl.genAbort = make(chan chan []byte)
+		go dl.generate(dl.genAbort)
+	}
+	return dl
+}
+
+// Root returns  root hash for which this snapshot was made.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as superseded by a newer disk layer.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// Account directly retrieves the RLP encoded account associated with a
+// particular hash in the snapshot slim data format.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	// If the layer was flattened into, consider it invalid (any live reference to
+	// the original should be marked as unusable).
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	// If the layer is being generated, ensure the requested hash has already been
+	// covered by the generator.
+	if !accountCovered(hash, dl.genMarker) {
+		snapshotCleanAccountMissMeter.Mark(1)
+		return nil, ErrNotCoveredYet
+	}
+	snapshotCleanAccountHitMeter.Mark(1)
+	return rawdb.ReadAccountSnapshot(dl.diskdb, hash), nil
+}
+
+// Storage directly retrieves the RLP encoded storage slot associated with a
+// particular hash within a particular account.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !storageCovered(accountHash, storageHash, dl.genMarker) {
+		snapshotCleanStorageMissMeter.Mark(1)
+		return nil, ErrNotCoveredYet
+	}
+	snapshotCleanStorageHitMeter.Mark(1)
+	return rawdb.ReadStorageSnapshot(dl.diskdb, accountHash, storageHash), nil
+}
+
+// abortGeneration stops the background generator of the layer if it's running
+// and returns the marker it reached. A nil marker means the generation finished.
+func (dl *diskLayer) abortGeneration() []byte {
+	if dl.genAbort == nil {
+		return dl.genMarker
+	}
+	abort := make(chan []byte)
+	dl.genAbort <- abort
+	dl.genAbort = nil
+
+	return <-abort
+}
+
+// accountCovered returns whether the generator already processed the account
+// with the given hash. The marker is either an account hash, denoting all data
+// up to and including that account is generated, or an account hash followed by
+// a storage hash, denoting the account and its storage up to the slot is done.
+func accountCovered(hash common.Hash, marker []byte) bool {
+	if marker == nil {
+		return true
+	}
+	return len(marker) > 0 && bytes.Compare(hash[:], marker[:common.HashLength]) <= 0
+}
+
+// storageCovered returns whether the generator already processed the storage
+// slot of the given account. See accountCovered for the marker format.
+func storageCovered(accountHash, storageHash common.Hash, marker []byte) bool {
+	if marker == nil {
+		return true
+	}
+	if len(marker) == 0 {
+		return false
+	}
+	switch cmp := bytes.Compare(accountHash[:], marker[:common.HashLength]); {
+	case cmp < 0:
+		return true
+	case cmp > 0:
+		return false
+	}
+	return len(marker) == common.HashLength || bytes.Compare(storageHash[:], marker[common.HashLength:]) <= 0
+}
+
+// diffToDisk merges a diff layer into the persistent disk layer, returning a new
+// disk layer at the diff's root. Only the data already covered by a running
+// generator is written, the rest is picked up by the generator restarted at the
+// new root.
+func diffToDisk(base *diskLayer, diff *diffLayer) *diskLayer {
+	// Stop any generator running on the old layer, it would race with the flush
+	marker := base.abortGeneration()
+
+	base.lock.Lock()
+	defer base.lock.Unlock()
+
+	var (
+		batch    = base.diskdb.NewBatch()
+		accounts int
+		slots    int
+	)
+	// Invalidate the persisted root first, so an interrupted flush forces a rebuild
+	rawdb.DeleteSnapshotRoot(batch)
+
+	flush := func() {
+		if batch.ValueSize() > mandb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write state snapshot", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	for hash := range diff.destructSet {
+		if !accountCovered(hash, marker) {
+			continue
+		}
+		rawdb.DeleteAccountSnapshot(batch, hash)
+
+		it := rawdb.IterateStorageSnapshots(base.diskdb.(mandb.Iteratee), hash)
+		for it.Next() {
+			if key := it.Key(); len(key) == len(rawdb.SnapshotStoragePrefix)+2*common.HashLength {
+				batch.Delete(common.CopyBytes(key))
+				slots++
+			}
+		}
+		it.Release()
+		accounts++
+		flush()
+	}
+	for hash, data := range diff.accountData {
+		if !accountCovered(hash, marker) {
+			continue
+		}
+		if len(data) == 0 {
+			rawdb.DeleteAccountSnapshot(batch, hash)
+		} else {
+			rawdb.WriteAccountSnapshot(batch, hash, data)
+		}
+		accounts++
+		flush()
+	}
+	for accountHash, storage := range diff.storageData {
+		for storageHash, data := range storage {
+			if !storageCovered(accountHash, storageHash, marker) {
+				continue
+			}
+			if len(data) == 0 {
+				rawdb.DeleteStorageSnapshot(batch, accountHash, storageHash)
+			} else {
+				rawdb.WriteStorageSnapshot(batch, accountHash, storageHash, data)
+			}
+			slots++
+		}
+		flush()
+	}
+	rawdb.WriteSnapshotRoot(batch, diff.root)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	snapshotFlushAccountMeter.Mark(int64(accounts))
+	snapshotFlushStorageMeter.Mark(int64(slots))
+
+	log.Debug("Flattened snapshot layers", "root", diff.root, "accounts", accounts, "slots", slots)
+
+	base.stale = true
+	return newDiskLayer(base.diskdb, base.triedb, diff.root, marker)
+}
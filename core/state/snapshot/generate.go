@@ -0,0 +1,254 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+// Account is the consensus representation of accounts as stored in the account
+// trie. It mirrors state.Account, which can't be imported from here.
+type Account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// generatorStats is a collection of statistics gathered by the snapshot generator
+// for logging purposes.
+type generatorStats struct {
+	start    time.Time // Timestamp when generation started
+	accounts uint64    // Number of accounts indexed
+	slots    uint64    // Number of storage slots indexed
+}
+
+// log creates an contextual log with the given message and the context pulled
+// from the internally maintained statistics.
+func (gs *generatorStats) log(msg string, root common.Hash, marker []byte) {
+	ctx := []interface{}{"root", root, "accounts", gs.accounts, "slots", gs.slots, "elapsed", common.PrettyDuration(time.Since(gs.start))}
+	if len(marker) > 0 {
+		ctx = append(ctx, "at", common.BytesToHash(marker[:common.HashLength]))
+	}
+	log.Info(msg, ctx...)
+}
+
+// generateSnapshot regenerates a brand new snapshot based on an existing state
+// database and head block asynchronously. The snapshot is returned immediately
+// and generation is continued in the background until done.
+func generateSnapshot(diskdb mandb.Database, triedb *trie.Database, root common.Hash) *diskLayer {
+	batch := diskdb.NewBatch()
+	rawdb.WriteSnapshotRoot(batch, root)
+	rawdb.WriteSnapshotGenerator(batch, []byte{})
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write initialized state marker", "err", err)
+	}
+	return newDiskLayer(diskdb, triedb, root, []byte{})
+}
+
+// wipeSnapshot deletes all the flat account and storage entries from the
+// database in preparation of a fresh generation.
+func wipeSnapshot(db mandb.Database) {
+	batch := db.NewBatch()
+	for _, prefix := range []struct {
+		prefix []byte
+		keylen int
+	}{
+		{rawdb.SnapshotAccountPrefix, len(rawdb.SnapshotAccountPrefix) + common.HashLength},
+		{rawdb.SnapshotStoragePrefix, len(rawdb.SnapshotStoragePrefix) + 2*common.HashLength},
+	} {
+		it := db.(mandb.Iteratee).NewIteratorWithPrefix(prefix.prefix)
+		for it.Next() {
+			if key := it.Key(); len(key) == prefix.keylen {
+				batch.Delete(common.CopyBytes(key))
+				if batch.ValueSize() > mandb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Crit("Failed to wipe state snapshot", "err", err)
+					}
+					batch.Reset()
+				}
+			}
+		}
+		it.Release()
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to wipe state snapshot", "err", err)
+	}
+}
+
+// generate is a background thread that iterates over the state and storage tries
+// and constructs the state snapshot. All the arguments are purely for statistics
+// gathering and logging, since the method surfs the blocks as they arrive, often
+// being restarted.
+func (dl *diskLayer) generate(genAbort chan chan []byte) {
+	dl.lock.RLock()
+	marker := common.CopyBytes(dl.genMarker)
+	dl.lock.RUnlock()
+
+	if len(marker) == 0 {
+		wipeSnapshot(dl.diskdb)
+	}
+	var (
+		stats  = &generatorStats{start: time.Now()}
+		batch  = dl.diskdb.NewBatch()
+		logged = time.Now()
+		abort  chan []byte
+	)
+	stats.log("Resuming state snapshot generation", dl.root, marker)
+
+	// checkpoint persists the current progress if the batch grew large enough or
+	// an abort was requested, reporting whether the generator should stop.
+	checkpoint := func(current []byte, force bool) bool {
+		if abort == nil {
+			select {
+			case abort = <-genAbort:
+			default:
+			}
+		}
+		if !force && abort == nil && batch.ValueSize() <= mandb.IdealBatchSize {
+			return false
+		}
+		rawdb.WriteSnapshotGenerator(batch, current)
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+
+		dl.lock.Lock()
+		dl.genMarker = current
+		dl.lock.Unlock()
+
+		if time.Since(logged) > 8*time.Second {
+			stats.log("Generating state snapshot", dl.root, current)
+			logged = time.Now()
+		}
+		if abort != nil {
+			stats.log("Aborting state snapshot generation", dl.root, current)
+			abort <- current
+			return true
+		}
+		return false
+	}
+	// fail drops the progress made since the last checkpoint and idles until the
+	// generator is aborted, which happens when the next block is flattened into
+	// the disk.
+	fail := func(err error) {
+		log.Warn("State snapshot generation stalled", "root", dl.root, "err", err)
+		batch.Reset()
+
+		dl.lock.RLock()
+		current := dl.genMarker
+		dl.lock.RUnlock()
+
+		if abort == nil {
+			abort = <-genAbort
+		}
+		abort <- current
+	}
+	accTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		fail(err)
+		return
+	}
+	var accMarker []byte
+	if len(marker) > 0 {
+		accMarker = marker[:common.HashLength]
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(accMarker))
+	for accIt.Next() {
+		accountHash := common.BytesToHash(accIt.Key)
+
+		// Skip the account and any storage the marker says was already processed
+		storeMarker := []byte(nil)
+		if accMarker != nil && bytes.Equal(accountHash[:], accMarker) {
+			if len(marker) == common.HashLength {
+				continue
+			}
+			storeMarker = marker[common.HashLength:]
+		} else {
+			rawdb.WriteAccountSnapshot(batch, accountHash, accIt.Value)
+			stats.accounts++
+		}
+		var acc Account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			log.Crit("Invalid account encountered during snapshot creation", "err", err)
+		}
+		if acc.Root != emptyRoot {
+			storeTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				fail(err)
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(storeMarker))
+			for storeIt.Next() {
+				if storeMarker != nil && bytes.Equal(storeIt.Key, storeMarker) {
+					continue
+				}
+				rawdb.WriteStorageSnapshot(batch, accountHash, common.BytesToHash(storeIt.Key), storeIt.Value)
+				stats.slots++
+
+				marker = append(common.CopyBytes(accountHash[:]), storeIt.Key...)
+				if checkpoint(marker, false) {
+					return
+				}
+			}
+			if storeIt.Err != nil {
+				fail(storeIt.Err)
+				return
+			}
+		}
+		marker = common.CopyBytes(accountHash[:])
+		if checkpoint(marker, false) {
+			return
+		}
+	}
+	if accIt.Err != nil {
+		fail(accIt.Err)
+		return
+	}
+	// Snapshot fully generated, drop the marker and idle until aborted
+	rawdb.DeleteSnapshotGenerator(batch)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	stats.log("Generated state snapshot", dl.root, nil)
+
+	abort = <-genAbort
+	abort <- nil
+}
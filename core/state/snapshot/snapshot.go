@@ -0,0 +1,293 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package snapshot implements a journalled, dynamic state dump.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/metrics"
+	"github.com/matrix/go-matrix/trie"
+)
+
+var (
+	snapshotCleanAccountHitMeter  = metrics.NewRegisteredMeter("state/snapshot/clean/account/hit", nil)
+	snapshotCleanAccountMissMeter = metrics.NewRegisteredMeter("state/snapshot/clean/account/miss", nil)
+	snapshotCleanStorageHitMeter  = metrics.NewRegisteredMeter("state/snapshot/clean/storage/hit", nil)
+	snapshotCleanStorageMissMeter = metrics.NewRegisteredMeter("state/snapshot/clean/storage/miss", nil)
+
+	snapshotDirtyAccountHitMeter = metrics.NewRegisteredMeter("state/snapshot/dirty/account/hit", nil)
+	snapshotDirtyStorageHitMeter = metrics.NewRegisteredMeter("state/snapshot/dirty/storage/hit", nil)
+
+	snapshotFlushAccountMeter = metrics.NewRegisteredMeter("state/snapshot/flush/account", nil)
+	snapshotFlushStorageMeter = metrics.NewRegisteredMeter("state/snapshot/flush/storage", nil)
+
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying snapshot
+	// is being generated currently and the requested data item is not yet in the
+	// range of accounts covered.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errNoIterator is returned if the backing database can't be iterated, which
+	// is needed to wipe and regenerate the snapshot.
+	errNoIterator = errors.New("snapshot database does not support iteration")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() common.Hash
+
+	// Account directly retrieves the RLP encoded account associated with a
+	// particular hash in the snapshot slim data format. A nil result without
+	// an error means the account doesn't exist.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage directly retrieves the RLP encoded storage slot associated with
+	// a particular hash within a particular account. A nil result without an
+	// error means the slot is empty.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports
+// some additional methods compared to the public API.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() snapshot
+
+	// Stale return whether this layer has become stale (was flattened across)
+	// or if it's still live.
+	Stale() bool
+}
+
+// Tree is a Matrix state snapshot tree. It consists of one persistent base
+// layer backed by a key-value store, on top of which arbitrarily many in-memory
+// diff layers are topped. The memory diffs can form a tree with branching, but
+// the disk layer is singleton and common to all. If a reorg goes deeper than
+// the disk layer, everything needs to be deleted.
+//
+// The goal of a state snapshot is twofold: to allow direct access to account
+// and storage data to avoid expensive multi-level trie lookups; and to allow
+// sorted, cheap iteration of the account/storage tries for sync aid.
+type Tree struct {
+	diskdb mandb.Database           // Persistent database to store the snapshot
+	triedb *trie.Database           // In-memory cache to access the trie through
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store, ensuring that the head of the snapshot matches the expected one.
+//
+// If the snapshot is missing, inconsistent with the requested root or partially
+// generated, the generator is (re)started in the background. State accesses not
+// yet covered by the generator return ErrNotCoveredYet, so the caller should
+// fall back to the tries.
+func New(diskdb mandb.Database, triedb *trie.Database, root common.Hash) (*Tree, error) {
+	if _, ok := diskdb.(mandb.Iteratee); !ok {
+		return nil, errNoIterator
+	}
+	var base *diskLayer
+	if rawdb.ReadSnapshotRoot(diskdb) == root {
+		base = newDiskLayer(diskdb, triedb, root, rawdb.ReadSnapshotGenerator(diskdb))
+	} else {
+		log.Warn("Snapshot root mismatch, regenerating", "root", root)
+		base = generateSnapshot(diskdb, triedb, root)
+	}
+	return &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: map[common.Hash]snapshot{root: base},
+	}, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if snap, ok := t.layers[blockRoot]; ok {
+		return snap
+	}
+	return nil
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Empty blocks don't change the state, nothing to add
+	if blockRoot == parentRoot {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// The same state may be reached through multiple blocks, keep the first one
+	if _, ok := t.layers[blockRoot]; ok {
+		return nil
+	}
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	t.layers[blockRoot] = newDiffLayer(parent, blockRoot, destructs, accounts, storage)
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed layers are crossed. All layers beyond the permitted number
+// are flattened downwards into the disk layer. Layers not descending from the
+// new disk layer are dropped.
+//
+// A layer count of zero flattens every layer up to and including the given root
+// into the disk.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil // Already on disk, nothing to flatten
+	}
+	var bottom *diffLayer
+	if layers == 0 {
+		bottom = diff
+	} else {
+		// Walk down to the lowest layer that should stay in memory
+		for i := 0; i < layers-1; i++ {
+			parent, ok := diff.Parent().(*diffLayer)
+			if !ok {
+				return nil // Short chain, nothing to flatten
+			}
+			diff = parent
+		}
+		if bottom, ok = diff.Parent().(*diffLayer); !ok {
+			return nil
+		}
+	}
+	base := t.flatten(bottom)
+
+	// Re-link the retained layers onto the new disk layer, dropping the rest
+	children := make(map[common.Hash][]*diffLayer)
+	for _, snap := range t.layers {
+		if diff, ok := snap.(*diffLayer); ok && !diff.Stale() {
+			parent := diff.Parent()
+			children[parent.Root()] = append(children[parent.Root()], diff)
+		}
+	}
+	t.layers = map[common.Hash]snapshot{base.root: base}
+
+	queue := []common.Hash{base.root}
+	for len(queue) > 0 {
+		root := queue[0]
+		queue = queue[1:]
+
+		for _, child := range children[root] {
+			if root == base.root {
+				child.setParent(base)
+			}
+			t.layers[child.root] = child
+			queue = append(queue, child.root)
+		}
+	}
+	for _, diffs := range children {
+		for _, diff := range diffs {
+			if t.layers[diff.root] != snapshot(diff) {
+				diff.markStale()
+			}
+		}
+	}
+	return nil
+}
+
+// flatten merges the chain of diff layers from the given one down to the disk
+// layer, writes the result into the database and returns the new disk layer.
+// All the merged layers are marked stale.
+//
+// The method assumes the tree lock is held.
+func (t *Tree) flatten(top *diffLayer) *diskLayer {
+	var (
+		chain []*diffLayer
+		base  *diskLayer
+	)
+	for snap := snapshot(top); base == nil; {
+		switch layer := snap.(type) {
+		case *diffLayer:
+			chain = append(chain, layer)
+			snap = layer.Parent()
+		case *diskLayer:
+			base = layer
+		}
+	}
+	merged := newDiffLayer(base, top.root, make(map[common.Hash]struct{}), make(map[common.Hash][]byte), make(map[common.Hash]map[common.Hash][]byte))
+	for i := len(chain) - 1; i >= 0; i-- {
+		merged.absorb(chain[i])
+		chain[i].markStale()
+	}
+	return diffToDisk(base, merged)
+}
+
+// Rebuild wipes all available snapshot data from the persistent database and
+// discards all caches and diff layers. Afterwards, it starts a new snapshot
+// generator with the given root hash.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			layer.abortGeneration()
+			layer.markStale()
+		case *diffLayer:
+			layer.markStale()
+		}
+	}
+	log.Info("Rebuilding state snapshot", "root", root)
+	t.layers = map[common.Hash]snapshot{root: generateSnapshot(t.diskdb, t.triedb, root)}
+}
+
+// Stop terminates any background snapshot generation, persisting its progress
+// so it can be resumed on the next start.
+func (t *Tree) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if disk, ok := layer.(*diskLayer); ok {
+			disk.abortGeneration()
+		}
+	}
+}
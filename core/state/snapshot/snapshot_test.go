@@ -0,0 +1,255 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// makeTestState creates a small persisted state with a few accounts, one of
+// which has some storage slots. The trie keys are used as hashes directly.
+func makeTestState(t *testing.T) (*mandb.MemDatabase, *trie.Database, common.Hash) {
+	diskdb := mandb.NewMemDatabase()
+	triedb := trie.NewDatabase(diskdb)
+
+	storage, _ := trie.New(common.Hash{}, triedb)
+	for i := byte(1); i <= 10; i++ {
+		value, _ := rlp.EncodeToBytes([]byte{i})
+		storage.Update(crypto.Keccak256([]byte{i}), value)
+	}
+	storageRoot, err := storage.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit storage trie: %v", err)
+	}
+	accounts, _ := trie.New(common.Hash{}, triedb)
+	for i := byte(1); i <= 5; i++ {
+		acc := Account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), Root: emptyRoot, CodeHash: emptyCode[:]}
+		if i == 3 {
+			acc.Root = storageRoot
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accounts.Update(crypto.Keccak256([]byte{i}), blob)
+	}
+	root, err := accounts.Commit(func(leaf []byte, parent common.Hash) error {
+		var acc Account
+		if err := rlp.DecodeBytes(leaf, &acc); err == nil && acc.Root != emptyRoot {
+			triedb.Reference(acc.Root, parent)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to flush tries: %v", err)
+	}
+	return diskdb, triedb, root
+}
+
+// waitGeneration blocks until the disk layer of the tree finished generating.
+func waitGeneration(t *testing.T, snaps *Tree) *diskLayer {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		snaps.lock.RLock()
+		for _, layer := range snaps.layers {
+			if disk, ok := layer.(*diskLayer); ok {
+				disk.lock.RLock()
+				done := disk.genMarker == nil
+				disk.lock.RUnlock()
+
+				if done {
+					snaps.lock.RUnlock()
+					return disk
+				}
+			}
+		}
+		snaps.lock.RUnlock()
+	}
+	t.Fatalf("snapshot generation timed out")
+	return nil
+}
+
+// Tests that a freshly generated snapshot contains exactly the leaves of the
+// state tries, and that it's picked up without regeneration on reload.
+func TestGeneration(t *testing.T) {
+	diskdb, triedb, root := makeTestState(t)
+
+	snaps, err := New(diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, snaps)
+	snaps.Stop()
+
+	accTrie, _ := trie.New(root, triedb)
+	accounts, slots := 0, 0
+	for it := trie.NewIterator(accTrie.NodeIterator(nil)); it.Next(); accounts++ {
+		hash := common.BytesToHash(it.Key)
+		if blob := rawdb.ReadAccountSnapshot(diskdb, hash); !bytes.Equal(blob, it.Value) {
+			t.Errorf("account %x: snapshot mismatch: have %x, want %x", hash, blob, it.Value)
+		}
+		var acc Account
+		rlp.DecodeBytes(it.Value, &acc)
+		if acc.Root == emptyRoot {
+			continue
+		}
+		storeTrie, _ := trie.New(acc.Root, triedb)
+		for sit := trie.NewIterator(storeTrie.NodeIterator(nil)); sit.Next(); slots++ {
+			slot := common.BytesToHash(sit.Key)
+			if blob := rawdb.ReadStorageSnapshot(diskdb, hash, slot); !bytes.Equal(blob, sit.Value) {
+				t.Errorf("slot %x/%x: snapshot mismatch: have %x, want %x", hash, slot, blob, sit.Value)
+			}
+		}
+	}
+	if accounts != 5 || slots != 10 {
+		t.Fatalf("state item count mismatch: have %d/%d, want 5/10", accounts, slots)
+	}
+	if marker := rawdb.ReadSnapshotGenerator(diskdb); marker != nil {
+		t.Fatalf("generator marker not cleared: %x", marker)
+	}
+	// Reload the tree and ensure the existing data is used as is
+	snaps, err = New(diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to reload snapshot tree: %v", err)
+	}
+	defer snaps.Stop()
+
+	blob, err := snaps.Snapshot(root).Account(crypto.Keccak256Hash([]byte{1}))
+	if err != nil || len(blob) == 0 {
+		t.Fatalf("failed to read account from reloaded snapshot: %x, %v", blob, err)
+	}
+}
+
+// Tests that diff layers shadow their parents, and that capping the tree merges
+// the old layers into the disk, invalidating them.
+func TestDiffLayerCap(t *testing.T) {
+	diskdb, triedb, root := makeTestState(t)
+
+	snaps, err := New(diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	defer snaps.Stop()
+	waitGeneration(t, snaps)
+
+	var (
+		acc1, acc2, acc3 = crypto.Keccak256Hash([]byte{1}), crypto.Keccak256Hash([]byte{2}), crypto.Keccak256Hash([]byte{3})
+		slot1            = crypto.Keccak256Hash([]byte{1})
+		root2, root3     = common.HexToHash("0x02"), common.HexToHash("0x03")
+	)
+	// Layer 2 modifies account 1 and deletes account 2
+	err = snaps.Update(root2, root, nil, map[common.Hash][]byte{acc1: []byte("acc1-v2"), acc2: nil}, nil)
+	if err != nil {
+		t.Fatalf("failed to add layer 2: %v", err)
+	}
+	// Layer 3 destructs account 3 and recreates it with a single slot
+	destructs := map[common.Hash]struct{}{acc3: {}}
+	storage := map[common.Hash]map[common.Hash][]byte{acc3: {slot1: []byte("slot-v3")}}
+	if err := snaps.Update(root3, root2, destructs, map[common.Hash][]byte{acc3: []byte("acc3-v3")}, storage); err != nil {
+		t.Fatalf("failed to add layer 3: %v", err)
+	}
+	if err := snaps.Update(root3, common.HexToHash("0xff"), nil, nil, nil); err != nil {
+		t.Fatalf("known layer not ignored: %v", err)
+	}
+	if err := snaps.Update(common.HexToHash("0x04"), common.HexToHash("0xff"), nil, nil, nil); err == nil {
+		t.Fatalf("layer with missing parent accepted")
+	}
+	check := func(snap Snapshot) {
+		if blob, _ := snap.Account(acc1); string(blob) != "acc1-v2" {
+			t.Errorf("account 1 mismatch: have %q", blob)
+		}
+		if blob, err := snap.Account(acc2); blob != nil || err != nil {
+			t.Errorf("account 2 not deleted: %x, %v", blob, err)
+		}
+		if blob, _ := snap.Account(acc3); string(blob) != "acc3-v3" {
+			t.Errorf("account 3 mismatch: have %q", blob)
+		}
+		if blob, _ := snap.Storage(acc3, slot1); string(blob) != "slot-v3" {
+			t.Errorf("slot 1 mismatch: have %q", blob)
+		}
+		if blob, err := snap.Storage(acc3, crypto.Keccak256Hash([]byte{2})); blob != nil || err != nil {
+			t.Errorf("destructed slot not wiped: %x, %v", blob, err)
+		}
+		if blob, _ := snap.Account(crypto.Keccak256Hash([]byte{4})); len(blob) == 0 {
+			t.Errorf("untouched account missing")
+		}
+	}
+	check(snaps.Snapshot(root3))
+
+	// Flatten everything below layer 3 and check the reads are unchanged
+	diff2 := snaps.Snapshot(root2).(*diffLayer)
+	if err := snaps.Cap(root3, 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if !diff2.Stale() {
+		t.Fatalf("flattened layer not marked stale")
+	}
+	if _, err := diff2.Account(acc1); err != ErrSnapshotStale {
+		t.Fatalf("stale layer read error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, ok := snaps.Snapshot(root2).(*diskLayer); !ok {
+		t.Fatalf("layer 2 not flattened into disk")
+	}
+	if have := rawdb.ReadSnapshotRoot(diskdb); have != root2 {
+		t.Fatalf("persisted root mismatch: have %x, want %x", have, root2)
+	}
+	check(snaps.Snapshot(root3))
+
+	// Flatten the remaining layer and check the disk directly
+	if err := snaps.Cap(root3, 0); err != nil {
+		t.Fatalf("failed to flatten tree: %v", err)
+	}
+	check(snaps.Snapshot(root3))
+	if blob := rawdb.ReadStorageSnapshot(diskdb, acc3, crypto.Keccak256Hash([]byte{2})); blob != nil {
+		t.Fatalf("destructed slot left on disk: %x", blob)
+	}
+}
+
+// Tests that accessing data not yet covered by a running generation is refused.
+func TestCoverage(t *testing.T) {
+	hash := func(b byte) common.Hash { return common.BytesToHash([]byte{b}) }
+
+	if !accountCovered(hash(9), nil) || !storageCovered(hash(9), hash(9), nil) {
+		t.Errorf("finished generation doesn't cover everything")
+	}
+	if accountCovered(hash(0), []byte{}) || storageCovered(hash(0), hash(0), []byte{}) {
+		t.Errorf("pending generation covers data")
+	}
+	marker := hash(5).Bytes()
+	if !accountCovered(hash(5), marker) || accountCovered(hash(6), marker) {
+		t.Errorf("account marker coverage mismatch")
+	}
+	if !storageCovered(hash(5), hash(9), marker) || storageCovered(hash(6), hash(0), marker) {
+		t.Errorf("account marker storage coverage mismatch")
+	}
+	marker = append(hash(5).Bytes(), hash(3).Bytes()...)
+	if !accountCovered(hash(5), marker) || !storageCovered(hash(5), hash(3), marker) || storageCovered(hash(5), hash(4), marker) {
+		t.Errorf("storage marker coverage mismatch")
+	}
+	if !storageCovered(hash(4), hash(9), marker) {
+		t.Errorf("storage marker doesn't cover earlier accounts")
+	}
+}
@@ -18,7 +18,10 @@ package state
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
 	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/matrix/go-matrix/common"
@@ -86,6 +89,99 @@ func (s *StateSuite) TestDump(c *checker.C) {
 	}
 }
 
+func (s *StateSuite) TestIteratorDump(c *checker.C) {
+	for i := byte(1); i <= 5; i++ {
+		obj := s.state.GetOrNewStateObject(toAddr([]byte{i}))
+		obj.AddBalance(big.NewInt(int64(i)))
+		obj.SetCode(crypto.Keccak256Hash([]byte{i}), []byte{i})
+		s.state.updateStateObject(obj)
+	}
+	s.state.Commit(false)
+
+	// Page through the state and ensure every account is visited exactly once
+	var (
+		seen  = make(map[string]bool)
+		next  []byte
+		pages int
+	)
+	for {
+		dump := s.state.IteratorDump(true, true, false, next, 2)
+		if len(dump.Accounts) > 2 {
+			c.Fatalf("page %d: too many accounts: %d", pages, len(dump.Accounts))
+		}
+		for addr, account := range dump.Accounts {
+			if seen[addr] {
+				c.Errorf("account %s dumped twice", addr)
+			}
+			seen[addr] = true
+			if account.Code != "" || account.Storage != nil {
+				c.Errorf("account %s: code or storage not excluded", addr)
+			}
+		}
+		pages++
+		if next = dump.Next; next == nil {
+			break
+		}
+	}
+	if len(seen) != 5 || pages != 3 {
+		c.Errorf("dump mismatch: have %d accounts in %d pages, want 5 in 3", len(seen), pages)
+	}
+}
+
+func (s *StateSuite) TestStreamedDump(c *checker.C) {
+	// Build the same state twice, inserting the accounts in opposite order
+	build := func(order []byte) *StateDB {
+		state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+		for _, i := range order {
+			addr := toAddr([]byte{i})
+			state.AddBalance(addr, big.NewInt(int64(i)))
+			state.SetState(addr, common.Hash{i}, common.Hash{i})
+			state.SetState(addr, common.Hash{}, common.Hash{i})
+		}
+		state.Commit(false)
+		return state
+	}
+	forward, backward := build([]byte{1, 2, 3, 4}), build([]byte{4, 3, 2, 1})
+
+	for name, dump := range map[string]func(*StateDB, io.Writer) error{
+		"json": func(state *StateDB, w io.Writer) error { return state.IterativeDump(false, false, false, w) },
+		"csv":  func(state *StateDB, w io.Writer) error { return state.CSVDump(false, false, false, w) },
+	} {
+		var have, want bytes.Buffer
+		if err := dump(forward, &want); err != nil {
+			c.Fatalf("%s: dump failed: %v", name, err)
+		}
+		if err := dump(backward, &have); err != nil {
+			c.Fatalf("%s: dump failed: %v", name, err)
+		}
+		if have.String() != want.String() {
+			c.Errorf("%s: dump depends on insertion order:\nhave: %s\nwant: %s", name, have.String(), want.String())
+		}
+	}
+	// Ensure the accounts are streamed in secure key order
+	var buf bytes.Buffer
+	forward.IterativeDump(true, false, false, &buf)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		c.Fatalf("line count mismatch: have %d, want 5", len(lines))
+	}
+	var prev []byte
+	for _, line := range lines[1:] {
+		var account DumpAccount
+		if err := json.Unmarshal([]byte(line), &account); err != nil {
+			c.Fatalf("invalid account line %q: %v", line, err)
+		}
+		if bytes.Compare(prev, account.SecureKey) >= 0 {
+			c.Errorf("account %s out of order", account.Address)
+		}
+		if len(account.Storage) != 2 {
+			c.Errorf("account %s: storage mismatch: have %d slots, want 2", account.Address, len(account.Storage))
+		}
+		prev = account.SecureKey
+	}
+}
+
 func (s *StateSuite) SetUpTest(c *checker.C) {
 	s.db = mandb.NewMemDatabase()
 	s.state, _ = New(common.Hash{}, NewDatabase(s.db))
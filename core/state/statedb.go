@@ -18,12 +18,15 @@
 package state
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
 	"sync"
 
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state/snapshot"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/log"
@@ -32,11 +35,6 @@ import (
 	"github.com/matrix/go-matrix/trie"
 )
 
-type revision struct {
-	id           int
-	journalIndex int
-}
-
 var (
 	// emptyState is the known hash of an empty state trie entry.
 	emptyState = crypto.Keccak256Hash(nil)
@@ -54,6 +52,18 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Flat state snapshot used to shortcut trie reads and the modifications
+	// gathered for the next snapshot layer. All nil if snapshots are disabled.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
+	// Accounts and storage slots modified since tracking was enabled, nil if
+	// modification tracking is disabled.
+	modified map[common.Address]map[common.Hash]struct{}
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -77,28 +87,50 @@ type StateDB struct {
 
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
-	journal        *journal
-	validRevisions []revision
-	nextRevisionId int
+	journal *journal
 
 	lock sync.Mutex
 }
 
 // Create a new state from a given trie.
 func New(root common.Hash, db Database) (*StateDB, error) {
+	return NewWithSnapshot(root, db, nil)
+}
+
+// NewWithSnapshot creates a new state from a given trie, serving account and
+// storage reads from the flat snapshot tree when it covers the root. Committing
+// the state adds a new layer to the tree.
+func NewWithSnapshot(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	state := &StateDB{
 		db:                db,
 		trie:              tr,
+		snaps:             snaps,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
-	}, nil
+	}
+	state.resetSnapshot(root)
+	return state, nil
+}
+
+// resetSnapshot points the state to the snapshot layer of the given root and
+// drops any modifications gathered for the snapshot so far.
+func (self *StateDB) resetSnapshot(root common.Hash) {
+	self.snap, self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil, nil
+	if self.snaps == nil {
+		return
+	}
+	if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+		self.snapDestructs = make(map[common.Hash]struct{})
+		self.snapAccounts = make(map[common.Hash][]byte)
+		self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
 }
 
 // setError remembers the first non-nil error it is called with.
@@ -128,10 +160,62 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	self.resetSnapshot(root)
+	if self.modified != nil {
+		self.modified = make(map[common.Address]map[common.Hash]struct{})
+	}
 	self.clearJournalAndRefund()
 	return nil
 }
 
+// TrackModifications starts recording the accounts and storage slots modified
+// in the state, retrievable via Modified.
+func (self *StateDB) TrackModifications() {
+	if self.modified == nil {
+		self.modified = make(map[common.Address]map[common.Hash]struct{})
+	}
+}
+
+// markModified records an account, and optionally one of its storage slots,
+// as modified if tracking is enabled.
+func (self *StateDB) markModified(addr common.Address, key *common.Hash) {
+	if self.modified == nil {
+		return
+	}
+	slots := self.modified[addr]
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		self.modified[addr] = slots
+	}
+	if key != nil {
+		slots[*key] = struct{}{}
+	}
+}
+
+// Modified returns the accounts and storage slots finalised or committed since
+// modification tracking was enabled, sorted by address and slot. Nil is
+// returned if tracking is disabled.
+func (self *StateDB) Modified() types.StateDiff {
+	if self.modified == nil {
+		return nil
+	}
+	diff := make(types.StateDiff, 0, len(self.modified))
+	for addr, slots := range self.modified {
+		account := &types.AccountDiff{Address: addr}
+		for key := range slots {
+			account.Storage = append(account.Storage, key)
+		}
+		sort.Slice(account.Storage, func(i, j int) bool {
+			return bytes.Compare(account.Storage[i][:], account.Storage[j][:]) < 0
+		})
+		diff = append(diff, account)
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return bytes.Compare(diff[i].Address[:], diff[j].Address[:]) < 0
+	})
+	return diff
+}
+
 func (self *StateDB) AddLog(log *types.Log) {
 	self.journal.append(addLogChange{txhash: self.thash})
 
@@ -261,6 +345,33 @@ func (self *StateDB) StorageTrie(addr common.Address) Trie {
 	return cpy.updateTrie(self.db)
 }
 
+// proofList collects the trie nodes of a Merkle proof in order.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// GetProof returns the Merkle proof of an account in the state trie.
+func (self *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(crypto.Keccak256(addr.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// GetStorageProof returns the Merkle proof of a slot in the storage trie of an
+// account.
+func (self *StateDB) GetStorageProof(addr common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	tr := self.StorageTrie(addr)
+	if tr == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := tr.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -310,6 +421,16 @@ func (self *StateDB) SetCode(addr common.Address, code []byte) {
 	}
 }
 
+// SetStorage replaces the entire storage of an account with the given one for
+// the lifetime of this state, e.g. to simulate calls against hypothetical
+// contract storage. The replacement is never committed.
+func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
+	}
+}
+
 func (self *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	stateObject := self.GetOrNewStateObject(addr)
 	if stateObject != nil {
@@ -350,6 +471,10 @@ func (self *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.setError(self.trie.TryUpdate(addr[:], data))
+
+	if self.snap != nil {
+		self.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -357,6 +482,12 @@ func (self *StateDB) deleteStateObject(stateObject *stateObject) {
 	stateObject.deleted = true
 	addr := stateObject.Address()
 	self.setError(self.trie.TryDelete(addr[:]))
+
+	if self.snap != nil {
+		self.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(self.snapAccounts, stateObject.addrHash)
+		delete(self.snapStorage, stateObject.addrHash)
+	}
 }
 
 // Retrieve a state object given by the address. Returns nil if not found.
@@ -369,11 +500,23 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc, err := self.trie.TryGet(addr[:])
-	if len(enc) == 0 {
-		self.setError(err)
-		return nil
+	// Load the object from the snapshot if available, falling back to the trie
+	// if the snapshot doesn't cover the account.
+	var (
+		enc []byte
+		err error
+	)
+	if self.snap != nil {
+		if enc, err = self.snap.Account(crypto.Keccak256Hash(addr[:])); err == nil && enc == nil {
+			return nil
+		}
+	}
+	if self.snap == nil || err != nil {
+		enc, err = self.trie.TryGet(addr[:])
+		if len(enc) == 0 {
+			self.setError(err)
+			return nil
+		}
 	}
 	var data Account
 	if err := rlp.DecodeBytes(enc, &data); err != nil {
@@ -382,6 +525,7 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 	}
 	// Insert into the live set.
 	obj := newObject(self, addr, data)
+	obj.snapRoot = &data.Root
 	self.setStateObject(obj)
 	return obj
 }
@@ -408,7 +552,18 @@ func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObjec
 	if prev == nil {
 		self.journal.append(createObjectChange{account: &addr})
 	} else {
-		self.journal.append(resetObjectChange{prev: prev})
+		change := resetObjectChange{prev: prev}
+		if self.snap != nil {
+			// The new object starts with empty storage, wipe the old one from the
+			// snapshot too, remembering what's needed to undo it on revert.
+			_, change.prevDestruct = self.snapDestructs[prev.addrHash]
+			change.prevAccount, change.prevStorage = self.snapAccounts[prev.addrHash], self.snapStorage[prev.addrHash]
+
+			self.snapDestructs[prev.addrHash] = struct{}{}
+			delete(self.snapAccounts, prev.addrHash)
+			delete(self.snapStorage, prev.addrHash)
+		}
+		self.journal.append(change)
 	}
 	self.setStateObject(newobj)
 	return newobj, prev
@@ -498,31 +653,47 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	state.snaps = self.snaps
+	if self.snap != nil {
+		state.snap = self.snap
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for hash := range self.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for hash, data := range self.snapAccounts {
+			state.snapAccounts[hash] = data
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for hash, storage := range self.snapStorage {
+			cpy := make(map[common.Hash][]byte, len(storage))
+			for key, data := range storage {
+				cpy[key] = data
+			}
+			state.snapStorage[hash] = cpy
+		}
+	}
+	if self.modified != nil {
+		state.modified = make(map[common.Address]map[common.Hash]struct{}, len(self.modified))
+		for addr, slots := range self.modified {
+			cpy := make(map[common.Hash]struct{}, len(slots))
+			for key := range slots {
+				cpy[key] = struct{}{}
+			}
+			state.modified[addr] = cpy
+		}
+	}
 	return state
 }
 
 // Snapshot returns an identifier for the current revision of the state.
 func (self *StateDB) Snapshot() int {
-	id := self.nextRevisionId
-	self.nextRevisionId++
-	self.validRevisions = append(self.validRevisions, revision{id, self.journal.length()})
-	return id
+	return self.journal.snapshot()
 }
 
 // RevertToSnapshot reverts all state changes made since the given revision.
 func (self *StateDB) RevertToSnapshot(revid int) {
-	// Find the snapshot in the stack of valid snapshots.
-	idx := sort.Search(len(self.validRevisions), func(i int) bool {
-		return self.validRevisions[i].id >= revid
-	})
-	if idx == len(self.validRevisions) || self.validRevisions[idx].id != revid {
-		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
-	}
-	snapshot := self.validRevisions[idx].journalIndex
-
-	// Replay the journal to undo changes and remove invalidated snapshots
-	self.journal.revert(self, snapshot)
-	self.validRevisions = self.validRevisions[:idx]
+	self.journal.revertToSnapshot(revid, self)
 }
 
 // GetRefund returns the current value of the refund counter.
@@ -552,6 +723,7 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 			s.updateStateObject(stateObject)
 		}
 		s.stateObjectsDirty[addr] = struct{}{}
+		s.markModified(addr, nil)
 	}
 	// Invalidate journal because reverting across transactions is not allowed.
 	s.clearJournalAndRefund()
@@ -574,8 +746,7 @@ func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 }
 
 func (s *StateDB) clearJournalAndRefund() {
-	s.journal = newJournal()
-	s.validRevisions = s.validRevisions[:0]
+	s.journal.reset()
 	s.refund = 0
 }
 
@@ -589,6 +760,9 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 	// Commit objects to the trie.
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
+		if isDirty || stateObject.suicided {
+			s.markModified(addr, nil)
+		}
 		switch {
 		case stateObject.suicided || (isDirty && deleteEmptyObjects && stateObject.empty()):
 			// If the object has been removed, don't bother syncing it
@@ -625,5 +799,15 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		return nil
 	})
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
+
+	// Stack the modifications as a new snapshot layer onto the parent state
+	if err == nil && s.snap != nil {
+		if parent := s.snap.Root(); parent != root {
+			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			}
+		}
+		s.resetSnapshot(root)
+	}
 	return root, err
 }
@@ -27,12 +27,17 @@ import (
 	"strings"
 	"testing"
 	"testing/quick"
+	"time"
 
 	check "gopkg.in/check.v1"
 
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state/snapshot"
 	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -167,6 +172,81 @@ func TestCopy(t *testing.T) {
 	}
 }
 
+// Tests that state reads are served correctly through the flat snapshot and
+// that committing a snapshot backed state stacks a matching new layer.
+func TestSnapshotBackedState(t *testing.T) {
+	var (
+		diskdb = mandb.NewMemDatabase()
+		db     = NewDatabase(diskdb)
+		addr1  = common.BytesToAddress([]byte{1})
+		addr2  = common.BytesToAddress([]byte{2})
+		addr3  = common.BytesToAddress([]byte{3})
+		key1   = common.BytesToHash([]byte{1})
+		key2   = common.BytesToHash([]byte{2})
+	)
+	base, _ := New(common.Hash{}, db)
+	base.AddBalance(addr1, big.NewInt(1))
+	base.SetState(addr2, key1, common.BytesToHash([]byte{11}))
+	base.AddBalance(addr3, big.NewInt(3))
+	base.SetState(addr3, key1, common.BytesToHash([]byte{31}))
+	root, _ := base.Commit(false)
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	snaps, err := snapshot.New(diskdb, db.TrieDB(), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	defer snaps.Stop()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := snaps.Snapshot(root).Account(crypto.Keccak256Hash(addr3[:])); err == nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("snapshot generation timed out")
+		}
+	}
+	state, _ := NewWithSnapshot(root, db, snaps)
+	if balance := state.GetBalance(addr1); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("balance mismatch: have %v, want 1", balance)
+	}
+	if value := state.GetState(addr2, key1); value != common.BytesToHash([]byte{11}) {
+		t.Fatalf("storage mismatch: have %x, want 0x0b", value)
+	}
+	// Modify, delete and recreate a few items and commit a new layer
+	state.AddBalance(addr1, big.NewInt(1))
+	state.SetState(addr2, key1, common.Hash{})
+	state.SetState(addr2, key2, common.BytesToHash([]byte{22}))
+	state.Suicide(addr3)
+	state.Finalise(true)
+	state.CreateAccount(addr3)
+	state.SetState(addr3, key2, common.BytesToHash([]byte{32}))
+	root2, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if snaps.Snapshot(root2) == nil {
+		t.Fatalf("snapshot layer missing for new root")
+	}
+	// Reads through the snapshot must match reads through the tries
+	plain, _ := New(root2, db)
+	snapped, _ := NewWithSnapshot(root2, db, snaps)
+	for _, addr := range []common.Address{addr1, addr2, addr3} {
+		if have, want := snapped.GetBalance(addr), plain.GetBalance(addr); have.Cmp(want) != 0 {
+			t.Errorf("account %x: balance mismatch: have %v, want %v", addr, have, want)
+		}
+		for _, key := range []common.Hash{key1, key2} {
+			if have, want := snapped.GetState(addr, key), plain.GetState(addr, key); have != want {
+				t.Errorf("account %x, slot %x: storage mismatch: have %x, want %x", addr, key, have, want)
+			}
+		}
+	}
+	blob, err := snaps.Snapshot(root2).Storage(crypto.Keccak256Hash(addr3[:]), crypto.Keccak256Hash(key1[:]))
+	if err != nil || blob != nil {
+		t.Errorf("recreated account storage not wiped: %x, %v", blob, err)
+	}
+}
+
 func TestSnapshotRandom(t *testing.T) {
 	config := &quick.Config{MaxCount: 1000}
 	err := quick.Check((*snapshotTest).run, config)
@@ -435,3 +515,212 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that the accounts and storage slots modified across finalised
+// transactions and the final commit are all tracked, and reverted changes are
+// not.
+func TestTrackModifications(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	state.TrackModifications()
+
+	var (
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		addr3 = common.BytesToAddress([]byte{0x03})
+		slot1 = common.BytesToHash([]byte{0x01})
+		slot2 = common.BytesToHash([]byte{0x02})
+	)
+	state.SetBalance(addr1, big.NewInt(1))
+	state.SetState(addr2, slot2, common.Hash{0x01})
+	state.Finalise(false)
+
+	state.SetState(addr2, slot1, common.Hash{0x02})
+	revision := state.Snapshot()
+	state.SetBalance(addr3, big.NewInt(3))
+	state.RevertToSnapshot(revision)
+
+	if _, err := state.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	want := types.StateDiff{
+		{Address: addr1},
+		{Address: addr2, Storage: []common.Hash{slot1, slot2}},
+	}
+	if have := state.Modified(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("modifications mismatch: have %v, want %v", have, want)
+	}
+	if have := state.Copy().Modified(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("copied modifications mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestGetProof(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+
+	var (
+		addr    = common.BytesToAddress([]byte{0x01})
+		missing = common.BytesToAddress([]byte{0x02})
+		slot    = common.BytesToHash([]byte{0x01})
+	)
+	state.SetNonce(addr, 7)
+	state.SetState(addr, slot, common.BytesToHash([]byte{0x02}))
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// proofDb assembles the nodes of a proof into a verifiable database
+	proofDb := func(proof [][]byte) *mandb.MemDatabase {
+		db := mandb.NewMemDatabase()
+		for _, node := range proof {
+			db.Put(crypto.Keccak256(node), node)
+		}
+		return db
+	}
+	// Verify the account proof and the storage proof against its root
+	proof, err := state.GetProof(addr)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	blob, _, err := trie.VerifyProof(root, crypto.Keccak256(addr.Bytes()), proofDb(proof))
+	if err != nil {
+		t.Fatalf("failed to verify account proof: %v", err)
+	}
+	var account Account
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		t.Fatalf("failed to decode proven account: %v", err)
+	}
+	if want := state.GetNonce(addr); account.Nonce != want {
+		t.Errorf("proven nonce mismatch: have %d, want %d", account.Nonce, want)
+	}
+	proof, err = state.GetStorageProof(addr, slot)
+	if err != nil {
+		t.Fatalf("failed to prove storage: %v", err)
+	}
+	blob, _, err = trie.VerifyProof(account.Root, crypto.Keccak256(slot.Bytes()), proofDb(proof))
+	if err != nil {
+		t.Fatalf("failed to verify storage proof: %v", err)
+	}
+	if want, _ := rlp.EncodeToBytes([]byte{0x02}); !bytes.Equal(blob, want) {
+		t.Errorf("proven slot mismatch: have %x, want %x", blob, want)
+	}
+	// Verify that absent accounts are proven to be missing
+	proof, err = state.GetProof(missing)
+	if err != nil {
+		t.Fatalf("failed to prove missing account: %v", err)
+	}
+	if blob, _, err = trie.VerifyProof(root, crypto.Keccak256(missing.Bytes()), proofDb(proof)); err != nil || blob != nil {
+		t.Errorf("missing account proof mismatch: have %x, %v, want nil", blob, err)
+	}
+	if _, err := state.GetStorageProof(missing, slot); err == nil {
+		t.Errorf("storage proof of missing account succeeded")
+	}
+}
+
+// Tests that replacing the storage of an account hides all original slots,
+// takes subsequent writes and leaves the committed storage untouched.
+func TestSetStorage(t *testing.T) {
+	db := NewDatabase(mandb.NewMemDatabase())
+	state, _ := New(common.Hash{}, db)
+
+	var (
+		addr = common.BytesToAddress([]byte{0x01})
+		kept = common.BytesToHash([]byte{0x01})
+		fake = common.BytesToHash([]byte{0x02})
+		one  = common.BytesToHash([]byte{0x01})
+	)
+	state.SetState(addr, kept, one)
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, db)
+	state.SetStorage(addr, map[common.Hash]common.Hash{fake: one})
+	if value := state.GetState(addr, kept); value != (common.Hash{}) {
+		t.Errorf("original slot visible after override: have %x", value)
+	}
+	if value := state.GetState(addr, fake); value != one {
+		t.Errorf("overridden slot mismatch: have %x, want %x", value, one)
+	}
+	state.SetState(addr, kept, fake)
+	if value := state.GetState(addr, kept); value != fake {
+		t.Errorf("write to overridden storage lost: have %x, want %x", value, fake)
+	}
+	state.Commit(false)
+	if value, _ := New(root, db); value.GetState(addr, kept) != one {
+		t.Errorf("committed storage modified by override")
+	}
+}
+
+// Tests that reverting a nested snapshot only undoes the changes of the inner
+// frames and invalidates every snapshot taken after it.
+func TestNestedSnapshots(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	addr := common.BytesToAddress([]byte{0x01})
+
+	revs := make([]int, 8)
+	for i := range revs {
+		revs[i] = state.Snapshot()
+		state.SetBalance(addr, big.NewInt(int64(i+1)))
+	}
+	state.RevertToSnapshot(revs[5])
+	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("balance mismatch after inner revert: have %v, want 5", balance)
+	}
+	// Taking a new snapshot must not reuse the id of a reverted one
+	if rev := state.Snapshot(); rev == revs[5] || rev == revs[6] || rev == revs[7] {
+		t.Fatalf("reverted revision id %d handed out again", rev)
+	}
+	state.RevertToSnapshot(revs[2])
+	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("balance mismatch after outer revert: have %v, want 2", balance)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("reverting an invalidated revision did not panic")
+		}
+	}()
+	state.RevertToSnapshot(revs[6])
+}
+
+// benchmarkNestedCalls simulates a chain of nested call frames, each taking a
+// snapshot and touching storage, with every other frame reverting on return.
+func benchmarkNestedCalls(b *testing.B, depth int) {
+	state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	addr := common.BytesToAddress([]byte{0x01})
+	revs := make([]int, depth)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for d := 0; d < depth; d++ {
+			revs[d] = state.Snapshot()
+			state.SetState(addr, common.BigToHash(big.NewInt(int64(d))), common.Hash{0x01})
+		}
+		for d := depth - 1; d >= 0; d-- {
+			if d%2 == 0 {
+				state.RevertToSnapshot(revs[d])
+			}
+		}
+		state.Finalise(false)
+	}
+}
+
+func BenchmarkNestedCalls16(b *testing.B)   { benchmarkNestedCalls(b, 16) }
+func BenchmarkNestedCalls256(b *testing.B)  { benchmarkNestedCalls(b, 256) }
+func BenchmarkNestedCalls1024(b *testing.B) { benchmarkNestedCalls(b, 1024) }
+
+// BenchmarkSnapshotRevert measures the cost of a single snapshot and revert on
+// top of a long journal, which should not depend on the journal length.
+func BenchmarkSnapshotRevert(b *testing.B) {
+	state, _ := New(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	addr := common.BytesToAddress([]byte{0x01})
+	for i := 0; i < 10000; i++ {
+		state.Snapshot()
+		state.SetState(addr, common.BigToHash(big.NewInt(int64(i))), common.Hash{0x01})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rev := state.Snapshot()
+		state.SetBalance(addr, big.NewInt(int64(i)))
+		state.RevertToSnapshot(rev)
+	}
+}
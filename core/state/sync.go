@@ -24,6 +24,9 @@ import (
 	"github.com/matrix/go-matrix/trie"
 )
 
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
 // NewStateSync create a new state trie download scheduler.
 func NewStateSync(root common.Hash, database trie.DatabaseReader) *trie.TrieSync {
 	var syncer *trie.TrieSync
@@ -39,3 +42,29 @@ func NewStateSync(root common.Hash, database trie.DatabaseReader) *trie.TrieSync
 	syncer = trie.NewTrieSync(root, database, callback)
 	return syncer
 }
+
+// NewHealSync creates a state download scheduler re-fetching the damaged entries
+// reported by CheckConsistency, along with anything missing below them. Damaged
+// entries still present in the database must be deleted first, otherwise they
+// are considered complete.
+func NewHealSync(damaged []*trie.ConsistencyError, database trie.DatabaseReader) *trie.TrieSync {
+	var syncer *trie.TrieSync
+	callback := func(leaf []byte, parent common.Hash) error {
+		var obj Account
+		if err := rlp.Decode(bytes.NewReader(leaf), &obj); err != nil {
+			return nil // Storage trie leaf, nothing referenced
+		}
+		syncer.AddSubTrie(obj.Root, 64, parent, nil)
+		syncer.AddRawEntry(common.BytesToHash(obj.CodeHash), 64, parent)
+		return nil
+	}
+	syncer = trie.NewTrieSync(emptyRoot, database, callback)
+	for _, item := range damaged {
+		if item.Err == errMissingCode || item.Err == errCodeHashMismatch {
+			syncer.AddRawEntry(item.Hash, 64, common.Hash{})
+		} else {
+			syncer.AddSubTrie(item.Hash, len(item.Path), common.Hash{}, callback)
+		}
+	}
+	return syncer
+}
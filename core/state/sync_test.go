@@ -349,3 +349,69 @@ func TestIncompleteStateSync(t *testing.T) {
 		dstDb.Put(key, value)
 	}
 }
+
+// Tests that a state with entries missing from the database is detected and
+// restored by the heal scheduler.
+func TestHealStateSync(t *testing.T) {
+	// Create a random state to copy and a complete copy of it
+	srcDb, srcRoot, srcAccounts := makeTestState()
+
+	dstDb := mandb.NewMemDatabase()
+	for _, key := range srcDb.TrieDB().DiskDB().(*mandb.MemDatabase).Keys() {
+		value, _ := srcDb.TrieDB().DiskDB().Get(key)
+		dstDb.Put(key, value)
+	}
+	// Drop some trie nodes and contract codes, corrupt another one
+	keys := dstDb.Keys()
+	for i, key := range keys {
+		if len(key) != common.HashLength {
+			continue
+		}
+		switch i % 7 {
+		case 0:
+			dstDb.Delete(key)
+		case 3:
+			dstDb.Put(key, []byte{0x01, 0x02})
+		}
+	}
+	damaged := CheckConsistency(NewDatabase(dstDb), srcRoot)
+	if len(damaged) == 0 {
+		t.Fatalf("damaged state not detected")
+	}
+	for _, item := range damaged {
+		if _, missing := item.Err.(*trie.MissingNodeError); !missing {
+			dstDb.Delete(item.Hash[:])
+		}
+	}
+	if again := CheckDamaged(NewDatabase(dstDb), damaged); len(again) == 0 {
+		t.Fatalf("damaged entries not detected on recheck")
+	}
+	// Heal the state and ensure it's complete afterwards
+	sched := NewHealSync(damaged, dstDb)
+
+	queue := append([]common.Hash{}, sched.Missing(100)...)
+	for len(queue) > 0 {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := srcDb.TrieDB().Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x", hash)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dstDb); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		queue = append(queue[:0], sched.Missing(100)...)
+	}
+	if again := CheckDamaged(NewDatabase(dstDb), damaged); len(again) != 0 {
+		t.Fatalf("healed entries still damaged: %v", again[0])
+	}
+	if damaged := CheckConsistency(NewDatabase(dstDb), srcRoot); len(damaged) != 0 {
+		t.Fatalf("state still damaged after healing: %v", damaged[0])
+	}
+	checkStateAccounts(t, dstDb, srcRoot, srcAccounts)
+}
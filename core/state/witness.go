@@ -0,0 +1,163 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// Witness is the set of trie nodes and contract codes read while operating on top
+// of a particular state root. A stateless verifier holding nothing but the witness
+// is able to re-execute the same operations and arrive at the same results.
+type Witness struct {
+	Root common.Hash // State root the recording was started from
+
+	nodes map[common.Hash][]byte // Trie nodes and contract codes keyed by their hash
+	lock  sync.Mutex
+}
+
+// witnessRLP is the compact consensus-independent encoding of a witness. The node
+// hashes are not stored as the verifier can recompute them from the blobs.
+type witnessRLP struct {
+	Root  common.Hash
+	Nodes [][]byte
+}
+
+// NewWitnessDatabase creates a state database reading through to db, recording all
+// the trie nodes and contract codes accessed into the returned witness. Writes made
+// through the returned database are kept in memory and never reach db.
+func NewWitnessDatabase(db Database, root common.Hash) (Database, *Witness) {
+	witness := &Witness{Root: root, nodes: make(map[common.Hash][]byte)}
+	recorder := &witnessRecorder{
+		MemDatabase: mandb.NewMemDatabase(),
+		source:      db.TrieDB(),
+		witness:     witness,
+	}
+	return NewDatabase(recorder), witness
+}
+
+// Len returns the number of trie nodes and contract codes within the witness.
+func (w *Witness) Len() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return len(w.nodes)
+}
+
+// Database creates a state database backed solely by the content of the witness,
+// allowing stateless re-execution on top of the witness root.
+func (w *Witness) Database() Database {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	db := mandb.NewMemDatabase()
+	for hash, blob := range w.nodes {
+		db.Put(hash[:], blob)
+	}
+	return NewDatabase(db)
+}
+
+// EncodeRLP implements rlp.Encoder, flattening the witness into a list of blobs
+// sorted by hash so the encoding is deterministic.
+func (w *Witness) EncodeRLP(wr io.Writer) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	hashes := make([]common.Hash, 0, len(w.nodes))
+	for hash := range w.nodes {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	enc := witnessRLP{Root: w.Root, Nodes: make([][]byte, len(hashes))}
+	for i, hash := range hashes {
+		enc.Nodes[i] = w.nodes[hash]
+	}
+	return rlp.Encode(wr, &enc)
+}
+
+// DecodeRLP implements rlp.Decoder, rebuilding the hash index of the blobs.
+func (w *Witness) DecodeRLP(s *rlp.Stream) error {
+	var dec witnessRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.Root, w.nodes = dec.Root, make(map[common.Hash][]byte, len(dec.Nodes))
+	for _, blob := range dec.Nodes {
+		w.nodes[crypto.Keccak256Hash(blob)] = blob
+	}
+	return nil
+}
+
+// add inserts a trie node or contract code into the witness.
+func (w *Witness) add(hash common.Hash, blob []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.nodes[hash]; !ok {
+		w.nodes[hash] = common.CopyBytes(blob)
+	}
+}
+
+// witnessRecorder is a read-through database layer in front of a trie database,
+// recording every hash-keyed entry retrieved from it into a witness. Writes land in
+// the embedded memory database, which is also consulted first on reads.
+type witnessRecorder struct {
+	*mandb.MemDatabase
+
+	source  *trie.Database
+	witness *Witness
+}
+
+// Get retrieves the value of key, recording it into the witness if it was pulled
+// from the source database.
+func (r *witnessRecorder) Get(key []byte) ([]byte, error) {
+	if blob, err := r.MemDatabase.Get(key); err == nil {
+		return blob, nil
+	}
+	if len(key) != common.HashLength {
+		return r.source.DiskDB().Get(key)
+	}
+	hash := common.BytesToHash(key)
+	blob, err := r.source.Node(hash)
+	if err != nil {
+		return nil, err
+	}
+	r.witness.add(hash, blob)
+	return blob, nil
+}
+
+// Has retrieves whether key is present in either the overlay or the source.
+func (r *witnessRecorder) Has(key []byte) (bool, error) {
+	if ok, _ := r.MemDatabase.Has(key); ok {
+		return true, nil
+	}
+	blob, err := r.Get(key)
+	return err == nil && blob != nil, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+// Tests that a witness recorded while mutating a state is sufficient to replay
+// the same mutations statelessly and arrive at the same state root.
+func TestWitnessReplay(t *testing.T) {
+	// Create a persisted state with a bunch of accounts, storage and code
+	db := NewDatabase(mandb.NewMemDatabase())
+	state, _ := New(common.Hash{}, db)
+	for i := byte(0); i < 255; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)))
+		state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+		if i%16 == 0 {
+			state.SetCode(addr, []byte{i, i, i})
+		}
+	}
+	root, _ := state.Commit(false)
+	db.TrieDB().Commit(root, false)
+
+	// Mutate a few accounts through a recording database
+	mutate := func(state *StateDB) common.Hash {
+		for i := byte(0); i < 255; i += 17 {
+			addr := common.BytesToAddress([]byte{i})
+			state.AddBalance(addr, big.NewInt(1))
+			state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i, i}))
+			state.GetCode(addr)
+		}
+		return state.IntermediateRoot(false)
+	}
+	recdb, witness := NewWitnessDatabase(db, root)
+	recorded, _ := New(root, recdb)
+	want := mutate(recorded)
+
+	if witness.Len() == 0 {
+		t.Fatalf("no nodes recorded into witness")
+	}
+	// Round trip the witness and replay the mutations statelessly
+	blob, err := rlp.EncodeToBytes(witness)
+	if err != nil {
+		t.Fatalf("failed to encode witness: %v", err)
+	}
+	dec := new(Witness)
+	if err := rlp.DecodeBytes(blob, dec); err != nil {
+		t.Fatalf("failed to decode witness: %v", err)
+	}
+	if dec.Root != root || dec.Len() != witness.Len() {
+		t.Fatalf("witness mismatch: have root %x, %d nodes; want root %x, %d nodes", dec.Root, dec.Len(), root, witness.Len())
+	}
+	stateless, err := New(dec.Root, dec.Database())
+	if err != nil {
+		t.Fatalf("failed to open state from witness: %v", err)
+	}
+	if have := mutate(stateless); have != want {
+		t.Fatalf("stateless root mismatch: have %x, want %x", have, want)
+	}
+	if err := stateless.Error(); err != nil {
+		t.Fatalf("stateless execution hit missing state: %v", err)
+	}
+}
@@ -97,13 +97,14 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	vmenv := vm.NewEVM(context, statedb, config, cfg)
 	// Apply the transaction to the current state (included in the env)
 	//===============hezi====================
+	var ret []byte
 	var gas uint64
 	var failed bool
 	if msg.Extra().TxType == 1 {
 		gas = uint64(0)
 		failed = true
 	} else {
-		_, gas, failed, err = ApplyMessage(vmenv, msg, gp)
+		ret, gas, failed, err = ApplyMessage(vmenv, msg, gp)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -131,5 +132,12 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	receipt.Logs = statedb.GetLogs(tx.Hash())
 	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
 
+	// Keep the execution details around for nodes storing extended receipts
+	if transfers := vmenv.Transfers(); len(transfers) > 0 || (failed && len(ret) > 0) {
+		receipt.Extras = &types.ReceiptExtras{Transfers: transfers}
+		if failed {
+			receipt.Extras.RevertReason = ret
+		}
+	}
 	return receipt, gas, err
 }
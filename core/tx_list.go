@@ -277,6 +277,31 @@ func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Tran
 	return true, old
 }
 
+// NonceGap is an inclusive range of nonces missing from the transaction pool,
+// which blocks the queued transactions of the account above it from executing.
+type NonceGap struct {
+	From uint64
+	To   uint64
+}
+
+// NonceGaps returns the ranges of nonces missing between the next nonce expected
+// from an account and its queued transactions, which must be sorted by nonce.
+// Transactions below the expected nonce are ignored.
+func NonceGaps(next uint64, queued types.Transactions) []NonceGap {
+	var gaps []NonceGap
+	for _, tx := range queued {
+		nonce := tx.Nonce()
+		if nonce < next {
+			continue
+		}
+		if nonce > next {
+			gaps = append(gaps, NonceGap{From: next, To: nonce - 1})
+		}
+		next = nonce + 1
+	}
+	return gaps
+}
+
 // Forward removes all transactions from the list with a nonce lower than the
 // provided threshold. Every removed transaction is returned for any post-removal
 // maintenance.
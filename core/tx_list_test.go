@@ -18,6 +18,7 @@ package core
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/matrix/go-matrix/core/types"
@@ -49,3 +50,30 @@ func TestStrictTxListAdd(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the nonce gaps blocking queued transactions are correctly reported.
+func TestNonceGaps(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	queued := types.Transactions{
+		transaction(1, 0, key),
+		transaction(3, 0, key),
+		transaction(4, 0, key),
+		transaction(8, 0, key),
+	}
+	tests := []struct {
+		next uint64
+		gaps []NonceGap
+	}{
+		{0, []NonceGap{{0, 0}, {2, 2}, {5, 7}}},
+		{1, []NonceGap{{2, 2}, {5, 7}}},
+		{3, []NonceGap{{5, 7}}},
+		{6, []NonceGap{{6, 7}}},
+		{9, nil},
+	}
+	for i, tt := range tests {
+		if gaps := NonceGaps(tt.next, queued); !reflect.DeepEqual(gaps, tt.gaps) {
+			t.Errorf("test %d: gaps mismatch: have %v, want %v", i, gaps, tt.gaps)
+		}
+	}
+}
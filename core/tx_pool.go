@@ -104,6 +104,15 @@ var (
 	ErrTXWrongful      = errors.New("transaction is unlawful")
 )
 
+// Reasons reported to lifecycle subscribers for dropping a pooled transaction.
+const (
+	TxDropUnderpriced = "underpriced"   // Priced out by better paying transactions or the minimum gas price
+	TxDropNonceTooLow = "nonce too low" // Nonce used up by a different transaction of the sender
+	TxDropUnpayable   = "unpayable"     // Sender balance or block gas limit no longer covers the cost
+	TxDropEvicted     = "evicted"       // Removed to enforce the pool limits or lifetime
+	TxDropRejected    = "rejected"      // Reported erroneous by the consensus nodes
+)
+
 var (
 	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
 	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
@@ -286,7 +295,9 @@ type TxPool struct {
 	chainconfig  *params.ChainConfig
 	chain        blockChain
 	gasPrice     *big.Int
-	txFeed       event.Feed
+	txFeed       event.FeedOf[NewTxsEvent]
+	replaceFeed  event.FeedOf[ReplacedTxEvent]
+	statusFeed   event.FeedOf[TxLifecycleEvent]
 	scope        event.SubscriptionScope
 	chainHeadCh  chan ChainHeadEvent
 	chainHeadSub event.Subscription
@@ -304,6 +315,8 @@ type TxPool struct {
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
+
+	included map[common.Hash]common.Hash // Transactions of the blocks being reset to, mapped to their block
 	//=================by hezi==================//
 	SContainer map[common.Hash]*types.Transaction
 	NContainer map[uint32]*types.Transaction
@@ -349,17 +362,6 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 
 	//go pool.testList() //for test
 
-	// If local transactions and journaling is enabled, load from disk
-	//if !config.NoLocals && config.Journal != "" {
-	//	pool.journal = newTxJournal(config.Journal)
-	//
-	//	if err := pool.journal.load(pool.AddLocals); err != nil {
-	//		log.Warn("Failed to load transaction journal", "err", err)
-	//	}
-	//	if err := pool.journal.rotate(pool.local()); err != nil {
-	//		log.Warn("Failed to rotate transaction journal", "err", err)
-	//	}
-	//}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
@@ -375,10 +377,26 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	//udp 交易订阅
 	pool.udptxsSub, _ = mc.SubscribeEvent(mc.SendUdpTx, pool.udptxsCh)
 
-	go pool.loop()
 	go pool.checkList() //hezi
 	go pool.listenudp()
 
+	// If local transactions and journaling is enabled, load from disk. This is
+	// done only once the broadcast machinery above is running, as re-adding the
+	// transactions feeds into it, but before the event loop starts rotating it.
+	if !config.NoLocals && config.Journal != "" {
+		pool.journal = newTxJournal(config.Journal)
+
+		if err := pool.journal.load(pool.AddLocals); err != nil {
+			log.Warn("Failed to load transaction journal", "err", err)
+		}
+		pool.mu.Lock()
+		if err := pool.journal.rotate(pool.local()); err != nil {
+			log.Warn("Failed to rotate transaction journal", "err", err)
+		}
+		pool.mu.Unlock()
+	}
+	go pool.loop()
+
 	return pool
 }
 
@@ -518,9 +536,11 @@ func (pool *TxPool) loop() {
 				}
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
-					for _, tx := range pool.queue[addr].Flatten() {
+					txs := pool.queue[addr].Flatten()
+					for _, tx := range txs {
 						pool.removeTx(tx.Hash(), true)
 					}
+					pool.notifyDropped(txs, TxDropEvicted)
 				}
 			}
 			pool.mu.Unlock()
@@ -876,23 +896,28 @@ func (pool *TxPool) lockedReset(oldHead, newHead *types.Header) {
 // of the transaction pool is valid with regard to the chain state.
 func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// If we're reorging an old state, reinject all dropped transactions
-	var reinject types.Transactions
+	var (
+		reinject types.Transactions
+		added    []*types.Block // Blocks of the new chain, whose transactions got included
+	)
 
 	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
 		oldNum := oldHead.Number.Uint64()
 		newNum := newHead.Number.Uint64()
 
+		rem := pool.chain.GetBlock(oldHead.Hash(), oldHead.Number.Uint64())
+		add := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64())
+
 		if depth := uint64(math.Abs(float64(oldNum) - float64(newNum))); depth > 64 {
 			log.Debug("Skipping deep transaction reorg", "depth", depth)
+		} else if rem == nil || add == nil {
+			// The old head was rewound away, its transactions were reinjected by Rewind
+			log.Debug("Skipping transaction reorg of rewound chain", "old", oldHead.Hash(), "new", newHead.Hash())
 		} else {
 			// Reorg seems shallow enough to pull in all transactions into memory
 			var discarded, included types.Transactions
 
-			var (
-				rem = pool.chain.GetBlock(oldHead.Hash(), oldHead.Number.Uint64())
-				add = pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64())
-			)
 			for rem.NumberU64() > add.NumberU64() {
 				discarded = append(discarded, rem.Transactions()...)
 				if rem = pool.chain.GetBlock(rem.ParentHash(), rem.NumberU64()-1); rem == nil {
@@ -902,6 +927,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 			}
 			for add.NumberU64() > rem.NumberU64() {
 				included = append(included, add.Transactions()...)
+				added = append(added, add)
 				if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 					log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 					return
@@ -914,6 +940,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 					return
 				}
 				included = append(included, add.Transactions()...)
+				added = append(added, add)
 				if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 					log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 					return
@@ -935,6 +962,20 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.pendingState = state.ManageState(statedb)
 	pool.currentMaxGas = newHead.GasLimit
 
+	// Remember the newly included transactions to tell them apart from stale ones
+	if len(added) == 0 {
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			added = append(added, block)
+		}
+	}
+	pool.included = make(map[common.Hash]common.Hash)
+	for _, block := range added {
+		for _, tx := range block.Transactions() {
+			pool.included[tx.Hash()] = block.Hash()
+		}
+	}
+	defer func() { pool.included = nil }()
+
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	pool.addTxsLocked(reinject, false)
@@ -976,6 +1017,58 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeReplacedTxEvent registers a subscription of ReplacedTxEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeReplacedTxEvent(ch chan<- ReplacedTxEvent) event.Subscription {
+	return pool.scope.Track(pool.replaceFeed.Subscribe(ch))
+}
+
+// SubscribeTxLifecycleEvent registers a subscription of TxLifecycleEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeTxLifecycleEvent(ch chan<- TxLifecycleEvent) event.Subscription {
+	return pool.scope.Track(pool.statusFeed.Subscribe(ch))
+}
+
+// notifyDropped notifies lifecycle subscribers of transactions discarded from
+// the pool for the given reason.
+func (pool *TxPool) notifyDropped(txs types.Transactions, reason string) {
+	if len(txs) > 0 {
+		go pool.statusFeed.Send(TxLifecycleEvent{Txs: txs, Status: TxDropped, Reason: reason})
+	}
+}
+
+// notifyStale notifies lifecycle subscribers of transactions discarded from the
+// pool due to their nonce being used up, telling apart the ones included in the
+// blocks the pool is being reset to.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) notifyStale(txs types.Transactions) {
+	var (
+		stale    types.Transactions
+		included = make(map[common.Hash]types.Transactions)
+	)
+	for _, tx := range txs {
+		if block, ok := pool.included[tx.Hash()]; ok {
+			included[block] = append(included[block], tx)
+		} else {
+			stale = append(stale, tx)
+		}
+	}
+	for block, txs := range included {
+		go pool.statusFeed.Send(TxLifecycleEvent{Txs: txs, Status: TxIncluded, Block: block})
+	}
+	pool.notifyDropped(stale, TxDropNonceTooLow)
+}
+
+// dropTx removes a single transaction from the pool like removeTx, notifying
+// lifecycle subscribers of it being dropped for the given reason.
+func (pool *TxPool) dropTx(hash common.Hash, outofbound bool, reason string) {
+	if tx := pool.all.Get(hash); tx != nil {
+		pool.removeTx(hash, outofbound)
+		pool.notifyDropped(types.Transactions{tx}, reason)
+	}
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -984,6 +1077,16 @@ func (pool *TxPool) GasPrice() *big.Int {
 	return new(big.Int).Set(pool.gasPrice)
 }
 
+// Rewind resets the pool to the current head after the chain was rewound, and
+// reinjects the transactions of the rewound blocks.
+func (pool *TxPool) Rewind(txs types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.reset(nil, pool.chain.CurrentBlock().Header())
+	pool.addTxsLocked(txs, false)
+}
+
 // SetGasPrice updates the minimum price required by the transaction pool for a
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
@@ -991,9 +1094,11 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	defer pool.mu.Unlock()
 
 	pool.gasPrice = price
-	for _, tx := range pool.priced.Cap(price, pool.locals) {
+	drop := pool.priced.Cap(price, pool.locals)
+	for _, tx := range drop {
 		pool.removeTx(tx.Hash(), false)
 	}
+	pool.notifyDropped(drop, TxDropUnderpriced)
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
@@ -1048,6 +1153,22 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool, returning the
+// pending as well as queued transactions of this address, sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending, queued types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
 // Pending retrieves all currently processable transactions, groupped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -1417,7 +1538,7 @@ func (pool *TxPool) msg_RecvErrTx(addr common.Address, listS []*big.Int) {
 		pool.mu.Lock()
 		mapCaclErrtxs[hash] = append(mapCaclErrtxs[hash], addr)
 		if uint64(len(mapCaclErrtxs[hash])) >= params.ErrTxConsensus {
-			pool.removeTx(hash, true)
+			pool.dropTx(hash, true, TxDropRejected)
 		} else {
 			pool.addBlockTiming(hash)
 		}
@@ -1463,7 +1584,7 @@ func (pool *TxPool) blockTiming() {
 	if len(listHash) > 0 {
 		for _, hash := range listHash {
 			//delete(mapErrtxsTiming, hash)
-			pool.removeTx(hash, true)
+			pool.dropTx(hash, true, TxDropRejected)
 			delete(mapCaclErrtxs, hash)
 			delete(mapTxsTiming, hash)
 			if s, ok := mapDelErrtxs[hash]; ok {
@@ -1684,6 +1805,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			underpricedTxCounter.Inc(1)
 			pool.removeTx(tx.Hash(), false)
 		}
+		pool.notifyDropped(drop, TxDropUnderpriced)
 	}
 	// If the transaction is replacing an already pending one, do directly
 	from, _ := types.Sender(pool.signer, tx) // already validated
@@ -1696,8 +1818,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		}
 		// New transaction is better, replace old one
 		if old != nil {
-			pool.all.Remove(old.Hash())
-			pool.priced.Removed()
+			pool.evictReplaced(old, tx)
 			pendingReplaceCounter.Inc(1)
 		}
 		pool.all.Add(tx)
@@ -1761,8 +1882,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	}
 	// Discard any previous transaction and mark this
 	if old != nil {
-		pool.all.Remove(old.Hash())
-		pool.priced.Removed()
+		pool.evictReplaced(old, tx)
 		queuedReplaceCounter.Inc(1)
 	}
 	if pool.all.Get(hash) == nil {
@@ -1772,6 +1892,20 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	return old != nil, nil
 }
 
+// evictReplaced drops a transaction superseded by a same nonce replacement from
+// all the pool indexes and notifies any subscribers of the replacement.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) evictReplaced(old, tx *types.Transaction) {
+	pool.all.Remove(old.Hash())
+	pool.priced.Removed()
+	pool.deleteMap(old)
+
+	log.Trace("Replaced pooled transaction", "old", old.Hash(), "new", tx.Hash(), "oldprice", old.GasPrice(), "newprice", tx.GasPrice())
+	go pool.replaceFeed.Send(ReplacedTxEvent{Old: old, New: tx})
+	go pool.statusFeed.Send(TxLifecycleEvent{Txs: []*types.Transaction{old}, Status: TxReplaced, Replacement: tx.Hash()})
+}
+
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
@@ -1806,9 +1940,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
-		pool.all.Remove(old.Hash())
-		pool.priced.Removed()
-
+		pool.evictReplaced(old, tx)
 		pendingReplaceCounter.Inc(1)
 	}
 	// Failsafe to work around direct pending inserts (tests)
@@ -1981,8 +2113,13 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 // future queue to the set of pending transactions. During this process, all
 // invalidated transactions (low nonce, low balance) are deleted.
 func (pool *TxPool) promoteExecutables(accounts []common.Address) {
-	// Track the promoted transactions to broadcast them at once
-	var promoted []*types.Transaction
+	// Track the promoted and dropped transactions to broadcast them at once
+	var promoted, stale, unpayable, evicted []*types.Transaction
+	defer func() {
+		pool.notifyStale(stale)
+		pool.notifyDropped(unpayable, TxDropUnpayable)
+		pool.notifyDropped(evicted, TxDropEvicted)
+	}()
 
 	// Gather all the accounts potentially needing updates
 	if accounts == nil {
@@ -2003,6 +2140,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			log.Trace("Removed old queued transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			stale = append(stale, tx)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -2013,6 +2151,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			pool.priced.Removed()
 			queuedNofundsCounter.Inc(1)
 		}
+		unpayable = append(unpayable, drops...)
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
 			hash := tx.Hash()
@@ -2029,6 +2168,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 				pool.priced.Removed()
 				queuedRateLimitCounter.Inc(1)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
+				evicted = append(evicted, tx)
 			}
 		}
 		// Delete the entire queue entry if it became empty.
@@ -2102,6 +2242,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 								pool.pendingState.SetNonce(offenders[i], nonce)
 							}
 							log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
+							evicted = append(evicted, tx)
 						}
 						pending--
 					}
@@ -2124,6 +2265,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 							pool.pendingState.SetNonce(addr, nonce)
 						}
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
+						evicted = append(evicted, tx)
 					}
 					pending--
 				}
@@ -2157,6 +2299,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
 					pool.removeTx(tx.Hash(), true)
+					evicted = append(evicted, tx)
 				}
 				drop -= size
 				queuedRateLimitCounter.Inc(int64(size))
@@ -2166,6 +2309,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 				pool.removeTx(txs[i].Hash(), true)
+				evicted = append(evicted, txs[i])
 				drop--
 				queuedRateLimitCounter.Inc(1)
 			}
@@ -2178,6 +2322,13 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 // are moved back into the future queue.
 func (pool *TxPool) demoteUnexecutables() {
 	log.Info("========YY===1", "demoteUnexecutables():len(pool.pending)=", len(pool.pending))
+
+	// Track the dropped transactions to notify lifecycle subscribers at once
+	var stale, unpayable types.Transactions
+	defer func() {
+		pool.notifyStale(stale)
+		pool.notifyDropped(unpayable, TxDropUnpayable)
+	}()
 	// Iterate over all accounts and demote any non-executable transactions
 	for addr, list := range pool.pending {
 		nonce := pool.currentState.GetNonce(addr)
@@ -2192,6 +2343,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			//log.Trace("Removed old pending transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			stale = append(stale, tx)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
 		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -2206,6 +2358,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			pool.priced.Removed()
 			pendingNofundsCounter.Inc(1)
 		}
+		unpayable = append(unpayable, drops...)
 		for _, tx := range invalids {
 			hash := tx.Hash()
 			log.Trace("Demoting pending transaction", "hash", hash)
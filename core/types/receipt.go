@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/big"
 	"unsafe"
 
 	"github.com/matrix/go-matrix/common"
@@ -55,6 +56,24 @@ type Receipt struct {
 	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
 	ContractAddress common.Address `json:"contractAddress"`
 	GasUsed         uint64         `json:"gasUsed" gencodec:"required"`
+
+	// Execution details, only stored by nodes keeping extended receipts
+	Extras *ReceiptExtras `json:"-"`
+}
+
+// ReceiptExtras are the execution details of a transaction that are not part
+// of its receipt, but save having to trace it to find out what happened.
+type ReceiptExtras struct {
+	RevertReason []byte              // Return data of a reverted execution
+	Transfers    []*InternalTransfer // Value transfers made by contracts
+}
+
+// InternalTransfer is a value transfer made by a contract during the execution
+// of a transaction, through a message call, a creation or a self-destruct.
+type InternalTransfer struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
 }
 
 type receiptMarshaling struct {
@@ -13,19 +13,20 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// This file was generated by go generate; DO NOT EDIT
 
-package language
+package types
 
-// This file contains code common to the maketables.go and the package code.
-
-// langAliasType is the type of an alias in langAliasMap.
-type langAliasType int8
+import (
+	"github.com/matrix/go-matrix/common"
+)
 
-const (
-	langDeprecated langAliasType = iota
-	langMacro
-	langLegacy
+// AccountDiff is the set of storage slots of an account modified by a block.
+// The account itself is also considered modified if the slot list is empty,
+// its balance, nonce or code having been touched, or the account deleted.
+type AccountDiff struct {
+	Address common.Address `json:"address"`
+	Storage []common.Hash  `json:"storage"`
+}
 
-	langAliasTypeUnknown langAliasType = -1
-)
+// StateDiff is the list of accounts modified by a block, sorted by address.
+type StateDiff []*AccountDiff
@@ -0,0 +1,123 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+)
+
+// AccessTuple is an account and the storage slots of it accessed by a call.
+type AccessTuple struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+// AccessList is the sorted list of accounts and storage slots accessed by a call.
+type AccessList []AccessTuple
+
+// AccessListTracer is a Tracer collecting the accounts and storage slots
+// touched during the execution of a call. The sender, the recipient and the
+// precompiled contracts are only listed if any of their storage is accessed.
+type AccessListTracer struct {
+	excl map[common.Address]struct{}                 // Accounts not listed unless their storage is touched
+	list map[common.Address]map[common.Hash]struct{} // Accessed accounts and storage slots
+}
+
+// NewAccessListTracer creates a tracer collecting an access list.
+func NewAccessListTracer() *AccessListTracer {
+	return &AccessListTracer{
+		excl: make(map[common.Address]struct{}),
+		list: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// addAccount lists an account accessed by an opcode, skipping precompiles.
+func (a *AccessListTracer) addAccount(env *EVM, addr common.Address) {
+	if _, ok := a.excl[addr]; ok || env.precompiles[addr] != nil {
+		return
+	}
+	if _, ok := a.list[addr]; !ok {
+		a.list[addr] = make(map[common.Hash]struct{})
+	}
+}
+
+func (a *AccessListTracer) addSlot(addr common.Address, slot common.Hash) {
+	if _, ok := a.list[addr]; !ok {
+		a.list[addr] = make(map[common.Hash]struct{})
+	}
+	a.list[addr][slot] = struct{}{}
+}
+
+func (a *AccessListTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	a.excl[from] = struct{}{}
+	a.excl[to] = struct{}{}
+	return nil
+}
+
+// CaptureState records the accounts and storage slots the executed opcode accesses.
+func (a *AccessListTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	switch op {
+	case SLOAD, SSTORE:
+		if stack.len() >= 1 {
+			a.addSlot(contract.Address(), common.BigToHash(stack.Back(0)))
+		}
+	case EXTCODECOPY, EXTCODESIZE, BALANCE, SELFDESTRUCT:
+		if stack.len() >= 1 {
+			a.addAccount(env, common.BigToAddress(stack.Back(0)))
+		}
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		if stack.len() >= 2 {
+			a.addAccount(env, common.BigToAddress(stack.Back(1)))
+		}
+	}
+	return nil
+}
+
+func (a *AccessListTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (a *AccessListTracer) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+// AccessList returns the collected access list, sorted by address and slot.
+func (a *AccessListTracer) AccessList() AccessList {
+	list := make(AccessList, 0, len(a.list))
+	for addr, slots := range a.list {
+		tuple := AccessTuple{Address: addr, StorageKeys: make([]common.Hash, 0, len(slots))}
+		for slot := range slots {
+			tuple.StorageKeys = append(tuple.StorageKeys, slot)
+		}
+		sort.Slice(tuple.StorageKeys, func(i, j int) bool {
+			return bytes.Compare(tuple.StorageKeys[i][:], tuple.StorageKeys[j][:]) < 0
+		})
+		list = append(list, tuple)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0
+	})
+	return list
+}
@@ -50,6 +50,10 @@ var (
 	depositAbi, Abierr                                                                                  = abi.JSON(strings.NewReader(depositDef))
 	valiDepositArr, minerDepositIdArr, withdrawIdArr, refundIdArr, getDepositListArr, getDepositInfoArr [4]byte
 	emptyHash                                                                                           = common.Hash{}
+
+	// DepositAddress is the address of the deposit contract, whose storage holds
+	// the deposits of all the validator and miner candidates.
+	DepositAddress = common.BytesToAddress([]byte{10})
 )
 
 func init() {
@@ -364,6 +368,33 @@ func (md *MatrixDeposit) getAllDepositList(contract *Contract, stateDB StateDB,
 	return detailList
 }
 
+// DepositSlots returns the storage slots of the deposit contract describing the
+// deposit of addr: the deposited amount, both halves of the node ID, the withdraw
+// height and the online time, in that order.
+func DepositSlots(addr common.Address) []common.Hash {
+	return []common.Hash{
+		common.BytesToHash(append(addr[:], 'D')),
+		common.BytesToHash(append(addr[:], 'N', 'X')),
+		common.BytesToHash(append(addr[:], 'N', 'Y')),
+		common.BytesToHash(append(addr[:], 'W', 'H')),
+		common.BytesToHash(append(addr[:], 'O', 'T')),
+	}
+}
+
+// DepositListSlots returns the storage slots of the deposit contract holding the
+// list of depositors: the length of the list followed by its first count items.
+func DepositListSlots(count uint64) []common.Hash {
+	contractAddr := DepositAddress
+	slots := []common.Hash{common.BytesToHash(append(contractAddr[:], 'D', 'N', 'U', 'M'))}
+	for i := uint64(0); i < count; i++ {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, i)
+		depKey := append(contractAddr[:], 'D', 'I')
+		slots = append(slots, common.BytesToHash(append(depKey, key...)))
+	}
+	return slots
+}
+
 func (md *MatrixDeposit) getDepositDetail(addr common.Address, contract *Contract, stateDB StateDB) (*DepositDetail, error) {
 	detail := DepositDetail{Address: addr}
 	detail.Deposit = md.getDeposit(contract, stateDB, addr)
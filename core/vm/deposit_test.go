@@ -103,6 +103,28 @@ func TestContract_Address(t *testing.T) {
 	return
 }
 
+// Tests that the exported deposit slots point at the storage written by a deposit.
+func TestDepositSlots(t *testing.T) {
+	_, env, contract := tMatrixDeposit(t, p, "valiDeposit", validatorThreshold)
+
+	slots := DepositSlots(contract.CallerAddress)
+	if have := env.StateDB.GetState(DepositAddress, slots[0]).Big(); have.Cmp(validatorThreshold) != 0 {
+		t.Errorf("deposit mismatch: have %v, want %v", have, validatorThreshold)
+	}
+	var md MatrixDeposit
+	nodeID := md.getNodeID(contract, env.StateDB, contract.CallerAddress)
+	if have := env.StateDB.GetState(DepositAddress, slots[1]); have != common.BytesToHash(nodeID[:32]) {
+		t.Errorf("node id mismatch: have %x, want %x", have, nodeID[:32])
+	}
+	list := DepositListSlots(1)
+	if have := env.StateDB.GetState(DepositAddress, list[0]).Big(); have.Uint64() != 1 {
+		t.Errorf("deposit list length mismatch: have %v, want 1", have)
+	}
+	if have := common.BytesToAddress(env.StateDB.GetState(DepositAddress, list[1]).Bytes()); have != contract.CallerAddress {
+		t.Errorf("deposit list item mismatch: have %x, want %x", have, contract.CallerAddress)
+	}
+}
+
 //v退款
 func TestMarkMatrixValirefund(t *testing.T) {
 	in, env, contract := tMatrixDeposit(t, p, "valiDeposit", validatorThreshold)
@@ -0,0 +1,71 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// Tests that value transfers made by contracts are recorded and the ones of
+// reverted calls are dropped.
+func TestInternalTransfers(t *testing.T) {
+	var (
+		sender    = common.HexToAddress("0x01")
+		payer     = common.HexToAddress("0xaa")
+		reverter  = common.HexToAddress("0xbb")
+		recipient = common.HexToAddress("0xcc")
+	)
+	// CALL(gas, recipient, 5, 0, 0, 0, 0), followed by STOP or REVERT(0, 0)
+	send := append([]byte{0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x05, byte(PUSH20)}, recipient.Bytes()...)
+	send = append(send, byte(GAS), byte(CALL), byte(POP))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(mandb.NewMemDatabase()))
+	statedb.SetCode(payer, append(send, byte(STOP)))
+	statedb.SetCode(reverter, append(send, 0x60, 0x00, 0x60, 0x00, byte(REVERT)))
+
+	ctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(0),
+	}
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(0), ByzantiumBlock: big.NewInt(0)}
+
+	evm := NewEVM(ctx, statedb, config, Config{})
+	if _, _, err := evm.Call(AccountRef(sender), payer, nil, 100000, big.NewInt(1)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	transfers := evm.Transfers()
+	if len(transfers) != 1 {
+		t.Fatalf("transfer count mismatch: have %d, want 1", len(transfers))
+	}
+	if transfers[0].From != payer || transfers[0].To != recipient || transfers[0].Value.Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("transfer mismatch: have %+v", transfers[0])
+	}
+	evm = NewEVM(ctx, statedb, config, Config{})
+	if _, _, err := evm.Call(AccountRef(sender), reverter, nil, 100000, big.NewInt(1)); err != errExecutionReverted {
+		t.Fatalf("call error mismatch: have %v, want %v", err, errExecutionReverted)
+	}
+	if transfers := evm.Transfers(); len(transfers) != 0 {
+		t.Errorf("reverted transfers recorded: %v", transfers)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/params"
+)
+
+// precompileRegistration is a precompiled contract installed at an address once
+// the VM upgrade it belongs to activates.
+type precompileRegistration struct {
+	upgrade  string
+	address  common.Address
+	contract PrecompiledContract
+}
+
+// precompileRegistry holds the registered precompiled contracts in registration
+// order, which is also the order they are installed in within a single upgrade.
+var precompileRegistry []precompileRegistration
+
+// precompileCache holds the merged precompile sets, keyed by the ordered list of
+// active upgrades that register contracts.
+var precompileCache sync.Map // string -> map[common.Address]PrecompiledContract
+
+// RegisterPrecompile installs a precompiled contract at the given address from
+// the block the named VM upgrade activates at (see params.ChainConfig.VMUpgrades).
+// Registering at the address of an existing precompile replaces it, which also
+// allows repricing one. The upgrade is added to the known VM upgrades if needed.
+//
+// Registration is meant to happen during package initialisation and must not
+// run concurrently with EVM execution.
+func RegisterPrecompile(upgrade string, addr common.Address, p PrecompiledContract) {
+	for _, reg := range precompileRegistry {
+		if reg.upgrade == upgrade && reg.address == addr {
+			panic(fmt.Sprintf("precompile %x already registered for VM upgrade %q", addr, upgrade))
+		}
+	}
+	if _, ok := vmUpgrades[upgrade]; !ok {
+		vmUpgrades[upgrade] = vmUpgrade{}
+	}
+	precompileRegistry = append(precompileRegistry, precompileRegistration{upgrade, addr, p})
+	precompileCache = sync.Map{}
+}
+
+// MeteredPrecompile returns p with its gas metering replaced by the given
+// function, to be registered in place of the original when a fork reprices it.
+func MeteredPrecompile(p PrecompiledContract, gas func(input []byte) uint64) PrecompiledContract {
+	return &meteredPrecompile{p, gas}
+}
+
+// meteredPrecompile is a precompiled contract with overridden gas metering.
+type meteredPrecompile struct {
+	PrecompiledContract
+	gas func(input []byte) uint64
+}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (p *meteredPrecompile) RequiredGas(input []byte) uint64 {
+	return p.gas(input)
+}
+
+// ActivePrecompiles returns the precompiled contracts active at the given block:
+// the default set with the contracts of all active upgrades installed in order.
+// The returned map must not be modified.
+func ActivePrecompiles(config *params.ChainConfig, num *big.Int) map[common.Address]PrecompiledContract {
+	var names []string
+	for _, name := range config.ActiveVMUpgrades(num) {
+		for _, reg := range precompileRegistry {
+			if reg.upgrade == name {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return PrecompiledContractsByzantium
+	}
+	key := strings.Join(names, "+")
+	if cached, ok := precompileCache.Load(key); ok {
+		return cached.(map[common.Address]PrecompiledContract)
+	}
+	precompiles := make(map[common.Address]PrecompiledContract, len(PrecompiledContractsByzantium)+len(precompileRegistry))
+	for addr, p := range PrecompiledContractsByzantium {
+		precompiles[addr] = p
+	}
+	for _, name := range names {
+		for _, reg := range precompileRegistry {
+			if reg.upgrade == name {
+				precompiles[reg.address] = reg.contract
+			}
+		}
+	}
+	precompileCache.Store(key, precompiles)
+	return precompiles
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// sha512hash is a test precompile installed through the registry.
+type sha512hash struct{}
+
+func (c *sha512hash) RequiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*12 + 60
+}
+
+func (c *sha512hash) Run(input []byte, contract *Contract, evm *EVM) ([]byte, error) {
+	h := sha512.Sum512(input)
+	return h[:], nil
+}
+
+// resetPrecompileRegistry restores the registry state once a test is done.
+func resetPrecompileRegistry(t *testing.T, names ...string) {
+	registry := precompileRegistry
+	t.Cleanup(func() {
+		precompileRegistry = registry
+		for _, name := range names {
+			delete(vmUpgrades, name)
+		}
+		precompileCache = sync.Map{}
+	})
+}
+
+// Tests that registered precompiles become callable exactly at the activation
+// block of their upgrade, and that repricing replaces the gas metering only.
+func TestRegisterPrecompile(t *testing.T) {
+	resetPrecompileRegistry(t, "test-sha512", "test-reprice")
+
+	var (
+		sha512Addr = common.BytesToAddress([]byte{0x20})
+		sha256Addr = common.BytesToAddress([]byte{2})
+	)
+	RegisterPrecompile("test-sha512", sha512Addr, &sha512hash{})
+	RegisterPrecompile("test-reprice", sha256Addr, MeteredPrecompile(PrecompiledContractsByzantium[sha256Addr], func(input []byte) uint64 {
+		return 1000
+	}))
+	config := &params.ChainConfig{
+		HomesteadBlock: big.NewInt(0),
+		VMUpgrades: map[string]*big.Int{
+			"test-sha512":  big.NewInt(100),
+			"test-reprice": big.NewInt(200),
+		},
+	}
+	if err := ValidateUpgrades(config); err != nil {
+		t.Fatalf("registered upgrades rejected: %v", err)
+	}
+	if p := ActivePrecompiles(config, big.NewInt(99))[sha512Addr]; p != nil {
+		t.Fatalf("precompile active before its upgrade")
+	}
+	if p := ActivePrecompiles(config, big.NewInt(100))[sha512Addr]; p == nil {
+		t.Fatalf("precompile inactive at its upgrade block")
+	}
+	if PrecompiledContractsByzantium[sha512Addr] != nil {
+		t.Fatalf("registry leaked into the default precompile set")
+	}
+	// Call the contracts through the EVM on both sides of the repricing
+	input := []byte("matrix")
+	want := sha512.Sum512(input)
+
+	tests := []struct {
+		number int64
+		addr   common.Address
+		gas    uint64
+	}{
+		{100, sha512Addr, 72},
+		{199, sha256Addr, params.Sha256BaseGas + params.Sha256PerWordGas},
+		{200, sha256Addr, 1000},
+	}
+	for i, test := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(mandb.NewMemDatabase()))
+		ctx := Context{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: big.NewInt(test.number),
+		}
+		evm := NewEVM(ctx, statedb, config, Config{})
+
+		ret, left, err := evm.Call(AccountRef(common.Address{}), test.addr, input, 10000, new(big.Int))
+		if err != nil {
+			t.Fatalf("test %d: call failed: %v", i, err)
+		}
+		if used := 10000 - left; used != test.gas {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, used, test.gas)
+		}
+		if test.addr == sha512Addr && !bytes.Equal(ret, want[:]) {
+			t.Errorf("test %d: output mismatch: have %x, want %x", i, ret, want)
+		}
+	}
+}
+
+// Tests that registering the same precompile twice for an upgrade is refused.
+func TestRegisterPrecompileDuplicate(t *testing.T) {
+	resetPrecompileRegistry(t, "test-duplicate")
+
+	addr := common.BytesToAddress([]byte{0x21})
+	RegisterPrecompile("test-duplicate", addr, &sha512hash{})
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("duplicate registration accepted")
+		}
+	}()
+	RegisterPrecompile("test-duplicate", addr, &sha512hash{})
+}
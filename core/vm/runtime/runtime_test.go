@@ -18,6 +18,7 @@ package runtime
 
 import (
 	"math/big"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -93,6 +94,36 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+// Tests that the access list tracer collects the touched accounts and storage
+// slots, leaving out the call endpoints and precompiles unless their storage
+// is accessed.
+func TestAccessListTracer(t *testing.T) {
+	tracer := vm.NewAccessListTracer()
+	_, _, err := Execute([]byte{
+		byte(vm.PUSH1), 0x01,
+		byte(vm.SLOAD),
+		byte(vm.POP),
+		byte(vm.PUSH1), 0xbb,
+		byte(vm.BALANCE),
+		byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0x01, // ecrecover precompile
+		byte(vm.GAS),
+		byte(vm.CALL),
+		byte(vm.POP),
+	}, nil, &Config{EVMConfig: vm.Config{Debug: true, Tracer: tracer}})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	want := vm.AccessList{
+		{Address: common.HexToAddress("0xbb"), StorageKeys: []common.Hash{}},
+		{Address: common.BytesToAddress([]byte("contract")), StorageKeys: []common.Hash{common.BigToHash(big.NewInt(1))}},
+	}
+	if have := tracer.AccessList(); !reflect.DeepEqual(have, want) {
+		t.Errorf("access list mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
+
 func TestCall(t *testing.T) {
 	state, _ := state.New(common.Hash{}, state.NewDatabase(mandb.NewMemDatabase()))
 	address := common.HexToAddress("0x0a")
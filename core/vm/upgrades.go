@@ -0,0 +1,107 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/matrix/go-matrix/params"
+)
+
+// vmUpgrade is a named modification of the instruction set and gas table that a
+// chain can activate at a given block through params.ChainConfig.VMUpgrades.
+// Either modifier may be nil if the upgrade leaves that table untouched.
+type vmUpgrade struct {
+	jumpTable func(jt *[256]operation)  // Adds, removes or reprices opcodes
+	gasTable  func(gt *params.GasTable) // Reprices the dynamic gas parameters
+}
+
+// vmUpgrades is the registry of known EVM upgrades. Changing opcode costs or
+// adding opcodes for a hard fork amounts to registering an upgrade here and
+// scheduling it in the chain configuration, leaving the fork tables untouched.
+var vmUpgrades = map[string]vmUpgrade{
+	WASMUpgrade: {}, // Enables the WASM engine, see wasm_engine.go
+}
+
+// jumpTableCache holds the upgraded instruction sets, keyed by the base fork and
+// the ordered list of upgrades applied on top of it.
+var jumpTableCache sync.Map // string -> *[256]operation
+
+// ValidateUpgrades checks that every EVM upgrade scheduled by the chain config is
+// known to this version of the virtual machine.
+func ValidateUpgrades(config *params.ChainConfig) error {
+	for name := range config.VMUpgrades {
+		if _, ok := vmUpgrades[name]; !ok {
+			return fmt.Errorf("unknown VM upgrade %q", name)
+		}
+	}
+	return nil
+}
+
+// baseInstructionSet returns the name and instruction set of the hard fork
+// active at the given block.
+func baseInstructionSet(config *params.ChainConfig, num *big.Int) (string, *[256]operation) {
+	switch {
+	case config.IsConstantinople(num):
+		return "constantinople", &constantinopleInstructionSet
+	case config.IsByzantium(num):
+		return "byzantium", &byzantiumInstructionSet
+	case config.IsHomestead(num):
+		return "homestead", &homesteadInstructionSet
+	default:
+		return "frontier", &frontierInstructionSet
+	}
+}
+
+// activeInstructionSet returns the instruction set active at the given block:
+// the one of the current hard fork with all active upgrades applied in order.
+func activeInstructionSet(config *params.ChainConfig, num *big.Int) *[256]operation {
+	base, table := baseInstructionSet(config, num)
+
+	names := config.ActiveVMUpgrades(num)
+	if len(names) == 0 {
+		return table
+	}
+	key := base + "+" + strings.Join(names, "+")
+	if cached, ok := jumpTableCache.Load(key); ok {
+		return cached.(*[256]operation)
+	}
+	upgraded := *table
+	for _, name := range names {
+		// Unknown upgrades are rejected by ValidateUpgrades when the chain is set up
+		if upgrade, ok := vmUpgrades[name]; ok && upgrade.jumpTable != nil {
+			upgrade.jumpTable(&upgraded)
+		}
+	}
+	jumpTableCache.Store(key, &upgraded)
+	return &upgraded
+}
+
+// activeGasTable returns the gas table active at the given block: the one of the
+// current hard fork with all active upgrades applied in order.
+func activeGasTable(config *params.ChainConfig, num *big.Int) params.GasTable {
+	table := config.GasTable(num)
+	for _, name := range config.ActiveVMUpgrades(num) {
+		if upgrade, ok := vmUpgrades[name]; ok && upgrade.gasTable != nil {
+			upgrade.gasTable(&table)
+		}
+	}
+	return table
+}
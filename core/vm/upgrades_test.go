@@ -0,0 +1,129 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/matrix/go-matrix/params"
+)
+
+// registerTestUpgrade installs an EVM upgrade for the duration of a test.
+func registerTestUpgrade(t *testing.T, name string, upgrade vmUpgrade) {
+	vmUpgrades[name] = upgrade
+	t.Cleanup(func() {
+		delete(vmUpgrades, name)
+		jumpTableCache = sync.Map{}
+		precompileCache = sync.Map{}
+	})
+}
+
+// Tests that the hard fork instruction sets switch exactly at their activation
+// blocks.
+func TestInstructionSetForkBoundaries(t *testing.T) {
+	config := &params.ChainConfig{
+		HomesteadBlock:      big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(10),
+		ConstantinopleBlock: big.NewInt(20),
+	}
+	tests := []struct {
+		number   int64
+		op       OpCode
+		expected bool
+	}{
+		{9, REVERT, false},
+		{10, REVERT, true},
+		{19, SHL, false},
+		{20, SHL, true},
+		{21, SAR, true},
+	}
+	for i, test := range tests {
+		jt := activeInstructionSet(config, big.NewInt(test.number))
+		if valid := jt[test.op].valid; valid != test.expected {
+			t.Errorf("test %d: %v validity at block %d mismatch: have %v, want %v", i, test.op, test.number, valid, test.expected)
+		}
+	}
+}
+
+// Tests that scheduled upgrades modify the instruction set and gas table from
+// their activation block on, and are applied in activation order.
+func TestUpgradeActivation(t *testing.T) {
+	registerTestUpgrade(t, "test-sload", vmUpgrade{
+		gasTable: func(gt *params.GasTable) { gt.SLoad = 800 },
+	})
+	registerTestUpgrade(t, "test-sload-again", vmUpgrade{
+		gasTable: func(gt *params.GasTable) { gt.SLoad = 1200 },
+	})
+	registerTestUpgrade(t, "test-opcode", vmUpgrade{
+		jumpTable: func(jt *[256]operation) {
+			jt[0x0c] = operation{
+				execute:       opAdd,
+				gasCost:       constGasFunc(GasFastestStep),
+				validateStack: makeStackFunc(2, 1),
+				valid:         true,
+			}
+		},
+	})
+	config := &params.ChainConfig{
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(0),
+		VMUpgrades: map[string]*big.Int{
+			"test-opcode":      big.NewInt(100),
+			"test-sload":       big.NewInt(100),
+			"test-sload-again": big.NewInt(200),
+		},
+	}
+	if err := ValidateUpgrades(config); err != nil {
+		t.Fatalf("failed to validate upgrades: %v", err)
+	}
+	tests := []struct {
+		number int64
+		valid  bool
+		sload  uint64
+	}{
+		{99, false, params.GasTableEIP150.SLoad},
+		{100, true, 800},
+		{199, true, 800},
+		{200, true, 1200},
+	}
+	for i, test := range tests {
+		evm := NewEVM(Context{BlockNumber: big.NewInt(test.number)}, nil, config, Config{})
+		if valid := evm.interpreter.cfg.JumpTable[0x0c].valid; valid != test.valid {
+			t.Errorf("test %d: opcode validity at block %d mismatch: have %v, want %v", i, test.number, valid, test.valid)
+		}
+		if sload := evm.interpreter.gasTable.SLoad; sload != test.sload {
+			t.Errorf("test %d: SLOAD gas at block %d mismatch: have %d, want %d", i, test.number, sload, test.sload)
+		}
+	}
+	// The base fork tables must not be modified by upgrades
+	if homesteadInstructionSet[0x0c].valid {
+		t.Errorf("upgrade leaked into the base instruction set")
+	}
+	if params.GasTableEIP150.SLoad != 200 {
+		t.Errorf("upgrade leaked into the base gas table")
+	}
+}
+
+// Tests that chains scheduling unknown upgrades are rejected.
+func TestValidateUnknownUpgrade(t *testing.T) {
+	config := &params.ChainConfig{VMUpgrades: map[string]*big.Int{"no-such-upgrade": big.NewInt(1)}}
+	if err := ValidateUpgrades(config); err == nil {
+		t.Fatalf("unknown upgrade accepted")
+	}
+}
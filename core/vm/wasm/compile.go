@@ -0,0 +1,268 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxLocals caps the number of locals a function may declare, bounding the
+// memory allocated for each call frame.
+const maxLocals = 50000
+
+// Opcodes of the supported instruction subset.
+const (
+	opUnreachable = 0x00
+	opNop         = 0x01
+	opBlock       = 0x02
+	opLoop        = 0x03
+	opIf          = 0x04
+	opElse        = 0x05
+	opEnd         = 0x0b
+	opBr          = 0x0c
+	opBrIf        = 0x0d
+	opBrTable     = 0x0e
+	opReturn      = 0x0f
+	opCall        = 0x10
+
+	opDrop   = 0x1a
+	opSelect = 0x1b
+
+	opLocalGet  = 0x20
+	opLocalSet  = 0x21
+	opLocalTee  = 0x22
+	opGlobalGet = 0x23
+	opGlobalSet = 0x24
+
+	opI32Load    = 0x28
+	opI64Load    = 0x29
+	opI32Load8S  = 0x2c
+	opI32Load8U  = 0x2d
+	opI32Load16S = 0x2e
+	opI32Load16U = 0x2f
+	opI64Load8S  = 0x30
+	opI64Load8U  = 0x31
+	opI64Load16S = 0x32
+	opI64Load16U = 0x33
+	opI64Load32S = 0x34
+	opI64Load32U = 0x35
+	opI32Store   = 0x36
+	opI64Store   = 0x37
+	opI32Store8  = 0x3a
+	opI32Store16 = 0x3b
+	opI64Store8  = 0x3c
+	opI64Store16 = 0x3d
+	opI64Store32 = 0x3e
+	opMemorySize = 0x3f
+	opMemoryGrow = 0x40
+
+	opI32Const = 0x41
+	opI64Const = 0x42
+
+	opI32Eqz = 0x45
+	opI32GeU = 0x4f
+	opI64Eqz = 0x50
+	opI64GeU = 0x5a
+
+	opI32Clz  = 0x67
+	opI32Rotr = 0x78
+	opI64Clz  = 0x79
+	opI64Rotr = 0x8a
+
+	opI32WrapI64    = 0xa7
+	opI64ExtendI32S = 0xac
+	opI64ExtendI32U = 0xad
+
+	opI32Extend8S  = 0xc0
+	opI64Extend32S = 0xc4
+)
+
+// blockEmpty is the block type of blocks not producing a value.
+const blockEmpty = 0x40
+
+// instr is a decoded instruction with its immediates and resolved jump targets.
+type instr struct {
+	op    byte
+	imm   uint64   // Constant, index, memory offset or block arity
+	end   int      // Blocks: index of the matching end instruction
+	els   int      // If: index of the else instruction, equal to end if absent
+	table []uint32 // Br_table: label depths, the default one last
+}
+
+// compile decodes a function body into instructions, resolving the block
+// structure and checking every index against the module.
+func (m *Module) compile(r *reader, typ FuncType, locals int, funcs int) ([]instr, error) {
+	var (
+		code   []instr
+		blocks []int // Indices of the currently open block instructions
+	)
+	for {
+		op, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		in := instr{op: op}
+		switch {
+		case op == opUnreachable, op == opNop, op == opReturn, op == opDrop, op == opSelect:
+
+		case op == opBlock, op == opLoop, op == opIf:
+			bt, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			switch bt {
+			case blockEmpty:
+			case byte(I32), byte(I64):
+				in.imm = 1
+			default:
+				return nil, fmt.Errorf("unsupported block type 0x%x", bt)
+			}
+			blocks = append(blocks, len(code))
+
+		case op == opElse:
+			if len(blocks) == 0 || code[blocks[len(blocks)-1]].op != opIf || code[blocks[len(blocks)-1]].els != 0 {
+				return nil, errors.New("else without matching if")
+			}
+			code[blocks[len(blocks)-1]].els = len(code)
+
+		case op == opEnd:
+			if len(blocks) == 0 {
+				if !r.eof() {
+					return nil, errors.New("instructions after function end")
+				}
+				return append(code, in), nil
+			}
+			open := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+
+			code[open].end = len(code)
+			if code[open].op == opIf {
+				if code[open].els == 0 {
+					code[open].els = len(code)
+				} else {
+					code[code[open].els].end = len(code)
+				}
+			}
+
+		case op == opBr, op == opBrIf:
+			depth, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if depth > uint32(len(blocks)) {
+				return nil, fmt.Errorf("branch depth %d out of range", depth)
+			}
+			in.imm = uint64(depth)
+
+		case op == opBrTable:
+			n, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if n > uint32(len(r.buf)) {
+				return nil, errUnexpectedEOF
+			}
+			in.table = make([]uint32, n+1)
+			for i := range in.table {
+				if in.table[i], err = r.u32(); err != nil {
+					return nil, err
+				}
+				if in.table[i] > uint32(len(blocks)) {
+					return nil, fmt.Errorf("branch depth %d out of range", in.table[i])
+				}
+			}
+
+		case op == opCall:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint32(funcs) {
+				return nil, fmt.Errorf("call to unknown function %d", idx)
+			}
+			in.imm = uint64(idx)
+
+		case op >= opLocalGet && op <= opLocalTee:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint32(len(typ.Params)+locals) {
+				return nil, fmt.Errorf("unknown local %d", idx)
+			}
+			in.imm = uint64(idx)
+
+		case op == opGlobalGet, op == opGlobalSet:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint32(len(m.globals)) {
+				return nil, fmt.Errorf("unknown global %d", idx)
+			}
+			if op == opGlobalSet && !m.globals[idx].mutable {
+				return nil, fmt.Errorf("global %d is immutable", idx)
+			}
+			in.imm = uint64(idx)
+
+		case (op >= opI32Load && op <= opI64Store32 && op != 0x2a && op != 0x2b && op != 0x38 && op != 0x39):
+			if !m.hasMemory {
+				return nil, errors.New("memory access without memory")
+			}
+			if _, err := r.u32(); err != nil { // alignment hint, irrelevant for execution
+				return nil, err
+			}
+			offset, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(offset)
+
+		case op == opMemorySize, op == opMemoryGrow:
+			if !m.hasMemory {
+				return nil, errors.New("memory access without memory")
+			}
+			if b, err := r.byte(); err != nil || b != 0x00 {
+				return nil, errors.New("invalid memory index")
+			}
+
+		case op == opI32Const:
+			v, err := r.sleb(32)
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(uint32(v))
+
+		case op == opI64Const:
+			v, err := r.sleb(64)
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(v)
+
+		case op >= opI32Eqz && op <= opI64GeU,
+			op >= opI32Clz && op <= opI64Rotr,
+			op == opI32WrapI64, op == opI64ExtendI32S, op == opI64ExtendI32U,
+			op >= opI32Extend8S && op <= opI64Extend32S:
+
+		default:
+			return nil, fmt.Errorf("unsupported opcode 0x%x", op)
+		}
+		code = append(code, in)
+	}
+}
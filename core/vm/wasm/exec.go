@@ -0,0 +1,698 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+var (
+	// ErrOutOfGas is returned if execution runs out of gas.
+	ErrOutOfGas = errors.New("wasm: out of gas")
+
+	errUnreachable    = errors.New("wasm: unreachable executed")
+	errDivideByZero   = errors.New("wasm: integer divide by zero")
+	errIntOverflow    = errors.New("wasm: integer overflow")
+	errMemoryBounds   = errors.New("wasm: out of bounds memory access")
+	errCallDepth      = errors.New("wasm: call stack exhausted")
+	errStackUnderflow = errors.New("wasm: operand stack underflow")
+)
+
+// HostFunction is a function provided by the embedder and imported by modules.
+type HostFunction struct {
+	Type FuncType
+	Call func(inst *Instance, args []uint64) ([]uint64, error)
+}
+
+// Imports are the host functions available to modules, by module and name.
+type Imports map[string]map[string]HostFunction
+
+// Config are the resource limits and gas metering hooks of an instance.
+type Config struct {
+	MaxPages uint32 // Maximum number of linear memory pages
+	MaxDepth int    // Maximum function call depth
+
+	UseGas   func(amount uint64) bool // Charges gas, returning false if exhausted
+	InstrGas uint64                   // Gas charged for every executed instruction
+	PageGas  uint64                   // Gas charged for every allocated memory page
+}
+
+// Instance is an instantiated module ready for execution.
+type Instance struct {
+	module  *Module
+	config  Config
+	host    []HostFunction
+	memory  []byte
+	globals []uint64
+	depth   int
+}
+
+// trap is used to unwind execution on malformed stack usage.
+type trap struct{ err error }
+
+// Instantiate links a module against the host imports, allocates its memory and
+// initialises its globals and data segments.
+func Instantiate(m *Module, imports Imports, config Config) (*Instance, error) {
+	inst := &Instance{module: m, config: config}
+	for _, imp := range m.imports {
+		fn, ok := imports[imp.module][imp.name]
+		if !ok {
+			return nil, fmt.Errorf("wasm: unresolved import %s.%s", imp.module, imp.name)
+		}
+		if !fn.Type.equal(m.types[imp.typ]) {
+			return nil, fmt.Errorf("wasm: import %s.%s: signature mismatch", imp.module, imp.name)
+		}
+		inst.host = append(inst.host, fn)
+	}
+	if m.hasMemory {
+		if m.memMin > config.MaxPages {
+			return nil, fmt.Errorf("wasm: initial memory of %d pages exceeds limit %d", m.memMin, config.MaxPages)
+		}
+		if !inst.useGas(uint64(m.memMin) * config.PageGas) {
+			return nil, ErrOutOfGas
+		}
+		inst.memory = make([]byte, int(m.memMin)*PageSize)
+		for _, seg := range m.data {
+			copy(inst.memory[seg.offset:], seg.data)
+		}
+	}
+	for _, g := range m.globals {
+		inst.globals = append(inst.globals, g.init)
+	}
+	return inst, nil
+}
+
+// Memory returns the linear memory of the instance.
+func (inst *Instance) Memory() []byte {
+	return inst.memory
+}
+
+// Read returns a copy of size bytes of memory starting at ptr.
+func (inst *Instance) Read(ptr, size uint32) ([]byte, error) {
+	if uint64(ptr)+uint64(size) > uint64(len(inst.memory)) {
+		return nil, errMemoryBounds
+	}
+	return append([]byte(nil), inst.memory[ptr:ptr+size]...), nil
+}
+
+// Write copies data into memory starting at ptr.
+func (inst *Instance) Write(ptr uint32, data []byte) error {
+	if uint64(ptr)+uint64(len(data)) > uint64(len(inst.memory)) {
+		return errMemoryBounds
+	}
+	copy(inst.memory[ptr:], data)
+	return nil
+}
+
+// Call invokes the exported function with the given arguments.
+func (inst *Instance) Call(name string, args ...uint64) (results []uint64, err error) {
+	idx, ok := inst.module.exports[name]
+	if !ok {
+		return nil, fmt.Errorf("wasm: function %q not exported", name)
+	}
+	if typ := inst.module.funcType(idx); len(args) != len(typ.Params) {
+		return nil, fmt.Errorf("wasm: function %q expects %d arguments, got %d", name, len(typ.Params), len(args))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(trap)
+			if !ok {
+				panic(r)
+			}
+			results, err = nil, t.err
+		}
+	}()
+	return inst.invoke(idx, args)
+}
+
+func (inst *Instance) useGas(amount uint64) bool {
+	return inst.config.UseGas == nil || amount == 0 || inst.config.UseGas(amount)
+}
+
+// invoke calls the function with the given index in the joint import and
+// definition index space.
+func (inst *Instance) invoke(idx uint32, args []uint64) ([]uint64, error) {
+	if idx < uint32(len(inst.host)) {
+		return inst.host[idx].Call(inst, args)
+	}
+	if inst.depth >= inst.config.MaxDepth {
+		return nil, errCallDepth
+	}
+	inst.depth++
+	defer func() { inst.depth-- }()
+
+	fn := &inst.module.funcs[idx-uint32(len(inst.host))]
+	typ := inst.module.types[fn.typ]
+
+	// Charge for the frame's locals, they are allocated and zeroed on every call
+	if !inst.useGas(uint64(len(fn.locals)) * inst.config.InstrGas) {
+		return nil, ErrOutOfGas
+	}
+
+	locals := make([]uint64, len(typ.Params)+len(fn.locals))
+	copy(locals, args)
+	return inst.execute(fn.code, locals, len(typ.Results))
+}
+
+// label is a branch target of an open block.
+type label struct {
+	height int  // Operand stack height at block entry
+	arity  int  // Number of values carried over by a branch
+	cont   int  // Index of the block or loop instruction's continuation
+	loop   bool // Whether branches restart the block instead of leaving it
+}
+
+// operands is the operand stack of a single function invocation.
+type operands []uint64
+
+func (s *operands) push(v uint64) { *s = append(*s, v) }
+
+func (s *operands) pop() uint64 {
+	n := len(*s)
+	if n == 0 {
+		panic(trap{errStackUnderflow})
+	}
+	v := (*s)[n-1]
+	*s = (*s)[:n-1]
+	return v
+}
+
+func (s *operands) popN(n int) []uint64 {
+	if len(*s) < n {
+		panic(trap{errStackUnderflow})
+	}
+	vals := append([]uint64(nil), (*s)[len(*s)-n:]...)
+	*s = (*s)[:len(*s)-n]
+	return vals
+}
+
+// execute runs a compiled function body with the given locals, returning its
+// results.
+func (inst *Instance) execute(code []instr, locals []uint64, results int) ([]uint64, error) {
+	var (
+		stack  = make(operands, 0, 16)
+		labels []label
+	)
+	// branch unwinds to the label at the given depth, returning the index of the
+	// next instruction, or -1 if the branch leaves the function.
+	branch := func(depth int) int {
+		if depth >= len(labels) {
+			return -1
+		}
+		l := labels[len(labels)-1-depth]
+		if len(stack) < l.height+l.arity {
+			panic(trap{errStackUnderflow})
+		}
+		copy(stack[l.height:], stack[len(stack)-l.arity:])
+		stack = stack[:l.height+l.arity]
+
+		if l.loop {
+			labels = labels[:len(labels)-depth]
+		} else {
+			labels = labels[:len(labels)-1-depth]
+		}
+		return l.cont + 1
+	}
+	for pc := 0; pc < len(code); pc++ {
+		if !inst.useGas(inst.config.InstrGas) {
+			return nil, ErrOutOfGas
+		}
+		in := &code[pc]
+
+		switch op := in.op; {
+		case op == opUnreachable:
+			return nil, errUnreachable
+
+		case op == opNop:
+
+		case op == opBlock:
+			labels = append(labels, label{height: len(stack), arity: int(in.imm), cont: in.end})
+
+		case op == opLoop:
+			labels = append(labels, label{height: len(stack), cont: pc, loop: true})
+
+		case op == opIf:
+			lbl := label{height: len(stack) - 1, arity: int(in.imm), cont: in.end}
+			switch {
+			case stack.pop() != 0:
+				labels = append(labels, lbl)
+			case in.els != in.end:
+				labels = append(labels, lbl)
+				pc = in.els
+			default:
+				pc = in.end
+			}
+
+		case op == opElse:
+			// Reached at the end of the taken branch, skip the alternative
+			labels = labels[:len(labels)-1]
+			pc = in.end
+
+		case op == opEnd:
+			if len(labels) == 0 {
+				return stack.popN(results), nil
+			}
+			labels = labels[:len(labels)-1]
+
+		case op == opBr:
+			if pc = branch(int(in.imm)); pc < 0 {
+				return stack.popN(results), nil
+			}
+			pc--
+
+		case op == opBrIf:
+			if stack.pop() != 0 {
+				if pc = branch(int(in.imm)); pc < 0 {
+					return stack.popN(results), nil
+				}
+				pc--
+			}
+
+		case op == opBrTable:
+			idx := uint32(stack.pop())
+			if idx >= uint32(len(in.table)-1) {
+				idx = uint32(len(in.table) - 1)
+			}
+			if pc = branch(int(in.table[idx])); pc < 0 {
+				return stack.popN(results), nil
+			}
+			pc--
+
+		case op == opReturn:
+			return stack.popN(results), nil
+
+		case op == opCall:
+			typ := inst.module.funcType(uint32(in.imm))
+			rets, err := inst.invoke(uint32(in.imm), stack.popN(len(typ.Params)))
+			if err != nil {
+				return nil, err
+			}
+			if len(rets) != len(typ.Results) {
+				return nil, fmt.Errorf("wasm: function %d returned %d values, want %d", in.imm, len(rets), len(typ.Results))
+			}
+			stack = append(stack, rets...)
+
+		case op == opDrop:
+			stack.pop()
+
+		case op == opSelect:
+			cond, b, a := stack.pop(), stack.pop(), stack.pop()
+			if cond != 0 {
+				stack.push(a)
+			} else {
+				stack.push(b)
+			}
+
+		case op == opLocalGet:
+			stack.push(locals[in.imm])
+
+		case op == opLocalSet:
+			locals[in.imm] = stack.pop()
+
+		case op == opLocalTee:
+			v := stack.pop()
+			locals[in.imm] = v
+			stack.push(v)
+
+		case op == opGlobalGet:
+			stack.push(inst.globals[in.imm])
+
+		case op == opGlobalSet:
+			inst.globals[in.imm] = stack.pop()
+
+		case op >= opI32Load && op <= opI64Load32U:
+			v, err := inst.load(op, uint64(uint32(stack.pop()))+in.imm)
+			if err != nil {
+				return nil, err
+			}
+			stack.push(v)
+
+		case op >= opI32Store && op <= opI64Store32:
+			v := stack.pop()
+			if err := inst.store(op, uint64(uint32(stack.pop()))+in.imm, v); err != nil {
+				return nil, err
+			}
+
+		case op == opMemorySize:
+			stack.push(uint64(len(inst.memory) / PageSize))
+
+		case op == opMemoryGrow:
+			stack.push(inst.grow(uint32(stack.pop())))
+
+		case op == opI32Const, op == opI64Const:
+			stack.push(in.imm)
+
+		case op == opI32Eqz:
+			stack.push(b2u(uint32(stack.pop()) == 0))
+
+		case op > opI32Eqz && op <= opI32GeU:
+			y, x := uint32(stack.pop()), uint32(stack.pop())
+			stack.push(b2u(compare32(op, x, y)))
+
+		case op == opI64Eqz:
+			stack.push(b2u(stack.pop() == 0))
+
+		case op > opI64Eqz && op <= opI64GeU:
+			y, x := stack.pop(), stack.pop()
+			stack.push(b2u(compare64(op, x, y)))
+
+		case op >= opI32Clz && op <= 0x69:
+			stack.push(uint64(unary32(op, uint32(stack.pop()))))
+
+		case op > 0x69 && op <= opI32Rotr:
+			y, x := uint32(stack.pop()), uint32(stack.pop())
+			v, err := binary32(op, x, y)
+			if err != nil {
+				return nil, err
+			}
+			stack.push(uint64(v))
+
+		case op >= opI64Clz && op <= 0x7b:
+			stack.push(unary64(op, stack.pop()))
+
+		case op > 0x7b && op <= opI64Rotr:
+			y, x := stack.pop(), stack.pop()
+			v, err := binary64(op, x, y)
+			if err != nil {
+				return nil, err
+			}
+			stack.push(v)
+
+		case op == opI32WrapI64:
+			stack.push(uint64(uint32(stack.pop())))
+
+		case op == opI64ExtendI32S:
+			stack.push(uint64(int64(int32(stack.pop()))))
+
+		case op == opI64ExtendI32U:
+			stack.push(uint64(uint32(stack.pop())))
+
+		case op >= opI32Extend8S && op <= opI64Extend32S:
+			stack.push(extend(op, stack.pop()))
+		}
+	}
+	return stack.popN(results), nil
+}
+
+// grow extends memory by the given number of pages, returning the previous size
+// in pages, or -1 if the memory could not be grown.
+func (inst *Instance) grow(delta uint32) uint64 {
+	pages := uint32(len(inst.memory) / PageSize)
+	limit := inst.config.MaxPages
+	if max := inst.module.memMax; max != 0 && max < limit {
+		limit = max
+	}
+	if uint64(pages)+uint64(delta) > uint64(limit) || !inst.useGas(uint64(delta)*inst.config.PageGas) {
+		return uint64(uint32(0xffffffff))
+	}
+	inst.memory = append(inst.memory, make([]byte, int(delta)*PageSize)...)
+	return uint64(pages)
+}
+
+// load reads a value of the width and signedness of the load instruction.
+func (inst *Instance) load(op byte, addr uint64) (uint64, error) {
+	var size uint64
+	switch op {
+	case opI64Load:
+		size = 8
+	case opI32Load, opI64Load32S, opI64Load32U:
+		size = 4
+	case opI32Load16S, opI32Load16U, opI64Load16S, opI64Load16U:
+		size = 2
+	default:
+		size = 1
+	}
+	if addr+size > uint64(len(inst.memory)) {
+		return 0, errMemoryBounds
+	}
+	mem := inst.memory[addr:]
+	switch op {
+	case opI32Load, opI64Load32U:
+		return uint64(binary.LittleEndian.Uint32(mem)), nil
+	case opI64Load:
+		return binary.LittleEndian.Uint64(mem), nil
+	case opI32Load8S:
+		return uint64(uint32(int32(int8(mem[0])))), nil
+	case opI32Load8U, opI64Load8U:
+		return uint64(mem[0]), nil
+	case opI32Load16S:
+		return uint64(uint32(int32(int16(binary.LittleEndian.Uint16(mem))))), nil
+	case opI32Load16U, opI64Load16U:
+		return uint64(binary.LittleEndian.Uint16(mem)), nil
+	case opI64Load8S:
+		return uint64(int64(int8(mem[0]))), nil
+	case opI64Load16S:
+		return uint64(int64(int16(binary.LittleEndian.Uint16(mem)))), nil
+	case opI64Load32S:
+		return uint64(int64(int32(binary.LittleEndian.Uint32(mem)))), nil
+	}
+	return 0, fmt.Errorf("wasm: invalid load opcode 0x%x", op)
+}
+
+// store writes a value with the width of the store instruction.
+func (inst *Instance) store(op byte, addr uint64, v uint64) error {
+	var size uint64
+	switch op {
+	case opI64Store:
+		size = 8
+	case opI32Store, opI64Store32:
+		size = 4
+	case opI32Store16, opI64Store16:
+		size = 2
+	default:
+		size = 1
+	}
+	if addr+size > uint64(len(inst.memory)) {
+		return errMemoryBounds
+	}
+	mem := inst.memory[addr:]
+	switch size {
+	case 8:
+		binary.LittleEndian.PutUint64(mem, v)
+	case 4:
+		binary.LittleEndian.PutUint32(mem, uint32(v))
+	case 2:
+		binary.LittleEndian.PutUint16(mem, uint16(v))
+	default:
+		mem[0] = byte(v)
+	}
+	return nil
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compare32 evaluates the i32 comparison opcodes from i32.eq to i32.ge_u.
+func compare32(op byte, x, y uint32) bool {
+	switch op - opI32Eqz {
+	case 1:
+		return x == y
+	case 2:
+		return x != y
+	case 3:
+		return int32(x) < int32(y)
+	case 4:
+		return x < y
+	case 5:
+		return int32(x) > int32(y)
+	case 6:
+		return x > y
+	case 7:
+		return int32(x) <= int32(y)
+	case 8:
+		return x <= y
+	case 9:
+		return int32(x) >= int32(y)
+	default:
+		return x >= y
+	}
+}
+
+// compare64 evaluates the i64 comparison opcodes from i64.eq to i64.ge_u.
+func compare64(op byte, x, y uint64) bool {
+	switch op - opI64Eqz {
+	case 1:
+		return x == y
+	case 2:
+		return x != y
+	case 3:
+		return int64(x) < int64(y)
+	case 4:
+		return x < y
+	case 5:
+		return int64(x) > int64(y)
+	case 6:
+		return x > y
+	case 7:
+		return int64(x) <= int64(y)
+	case 8:
+		return x <= y
+	case 9:
+		return int64(x) >= int64(y)
+	default:
+		return x >= y
+	}
+}
+
+// unary32 evaluates i32.clz, i32.ctz and i32.popcnt.
+func unary32(op byte, x uint32) uint32 {
+	switch op - opI32Clz {
+	case 0:
+		return uint32(bits.LeadingZeros32(x))
+	case 1:
+		return uint32(bits.TrailingZeros32(x))
+	default:
+		return uint32(bits.OnesCount32(x))
+	}
+}
+
+// unary64 evaluates i64.clz, i64.ctz and i64.popcnt.
+func unary64(op byte, x uint64) uint64 {
+	switch op - opI64Clz {
+	case 0:
+		return uint64(bits.LeadingZeros64(x))
+	case 1:
+		return uint64(bits.TrailingZeros64(x))
+	default:
+		return uint64(bits.OnesCount64(x))
+	}
+}
+
+// binary32 evaluates the i32 arithmetic opcodes from i32.add to i32.rotr.
+func binary32(op byte, x, y uint32) (uint32, error) {
+	switch op - opI32Clz {
+	case 3:
+		return x + y, nil
+	case 4:
+		return x - y, nil
+	case 5:
+		return x * y, nil
+	case 6:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		if int32(x) == -1<<31 && int32(y) == -1 {
+			return 0, errIntOverflow
+		}
+		return uint32(int32(x) / int32(y)), nil
+	case 7:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return x / y, nil
+	case 8:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return uint32(int32(x) % int32(y)), nil
+	case 9:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return x % y, nil
+	case 10:
+		return x & y, nil
+	case 11:
+		return x | y, nil
+	case 12:
+		return x ^ y, nil
+	case 13:
+		return x << (y & 31), nil
+	case 14:
+		return uint32(int32(x) >> (y & 31)), nil
+	case 15:
+		return x >> (y & 31), nil
+	case 16:
+		return bits.RotateLeft32(x, int(y&31)), nil
+	default:
+		return bits.RotateLeft32(x, -int(y&31)), nil
+	}
+}
+
+// binary64 evaluates the i64 arithmetic opcodes from i64.add to i64.rotr.
+func binary64(op byte, x, y uint64) (uint64, error) {
+	switch op - opI64Clz {
+	case 3:
+		return x + y, nil
+	case 4:
+		return x - y, nil
+	case 5:
+		return x * y, nil
+	case 6:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		if int64(x) == -1<<63 && int64(y) == -1 {
+			return 0, errIntOverflow
+		}
+		return uint64(int64(x) / int64(y)), nil
+	case 7:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return x / y, nil
+	case 8:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return uint64(int64(x) % int64(y)), nil
+	case 9:
+		if y == 0 {
+			return 0, errDivideByZero
+		}
+		return x % y, nil
+	case 10:
+		return x & y, nil
+	case 11:
+		return x | y, nil
+	case 12:
+		return x ^ y, nil
+	case 13:
+		return x << (y & 63), nil
+	case 14:
+		return uint64(int64(x) >> (y & 63)), nil
+	case 15:
+		return x >> (y & 63), nil
+	case 16:
+		return bits.RotateLeft64(x, int(y&63)), nil
+	default:
+		return bits.RotateLeft64(x, -int(y&63)), nil
+	}
+}
+
+// extend evaluates the sign extension opcodes.
+func extend(op byte, x uint64) uint64 {
+	switch op {
+	case opI32Extend8S:
+		return uint64(uint32(int32(int8(x))))
+	case opI32Extend8S + 1:
+		return uint64(uint32(int32(int16(x))))
+	case opI32Extend8S + 2:
+		return uint64(int64(int8(x)))
+	case opI32Extend8S + 3:
+		return uint64(int64(int16(x)))
+	default:
+		return uint64(int64(int32(x)))
+	}
+}
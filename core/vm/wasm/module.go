@@ -0,0 +1,615 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package wasm implements a small, deterministic WebAssembly interpreter for the
+// experimental contract runtime. It supports the integer subset of the MVP
+// specification: floating point, tables, indirect calls and start functions are
+// rejected at decode time, so execution results never depend on the host.
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Magic is the prefix every binary WebAssembly module starts with.
+var Magic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// version is the only supported binary format version.
+var version = []byte{0x01, 0x00, 0x00, 0x00}
+
+// PageSize is the size of a linear memory page.
+const PageSize = 65536
+
+// Value types supported by the interpreter.
+const (
+	I32 ValueType = 0x7f
+	I64 ValueType = 0x7e
+)
+
+// ValueType is the type of a function parameter, result, local or global.
+type ValueType byte
+
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	}
+	return fmt.Sprintf("0x%x", byte(t))
+}
+
+// FuncType is the signature of a function.
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+func (ft FuncType) equal(other FuncType) bool {
+	return bytes.Equal(valueTypeBytes(ft.Params), valueTypeBytes(other.Params)) &&
+		bytes.Equal(valueTypeBytes(ft.Results), valueTypeBytes(other.Results))
+}
+
+func valueTypeBytes(types []ValueType) []byte {
+	blob := make([]byte, len(types))
+	for i, t := range types {
+		blob[i] = byte(t)
+	}
+	return blob
+}
+
+var (
+	errBadMagic      = errors.New("wasm: invalid magic number")
+	errBadVersion    = errors.New("wasm: unsupported binary version")
+	errUnexpectedEOF = errors.New("wasm: unexpected end of module")
+	errOverflow      = errors.New("wasm: integer encoding overflow")
+)
+
+// importedFunc is a function imported from the host.
+type importedFunc struct {
+	module, name string
+	typ          uint32
+}
+
+// function is a function defined by the module, compiled for execution.
+type function struct {
+	typ    uint32
+	locals []ValueType // Declared locals, excluding the parameters
+	code   []instr
+}
+
+// global is a module level variable.
+type global struct {
+	typ     ValueType
+	mutable bool
+	init    uint64
+}
+
+// dataSegment is a chunk of bytes copied into memory on instantiation.
+type dataSegment struct {
+	offset uint32
+	data   []byte
+}
+
+// Module is a decoded WebAssembly module.
+type Module struct {
+	types   []FuncType
+	imports []importedFunc
+	funcs   []function
+	globals []global
+	exports map[string]uint32 // Exported function indices
+	data    []dataSegment
+
+	hasMemory      bool
+	memMin, memMax uint32 // Memory limits in pages, memMax 0 if unbounded
+}
+
+// Export returns the type of an exported function, or false if not exported.
+func (m *Module) Export(name string) (FuncType, bool) {
+	idx, ok := m.exports[name]
+	if !ok {
+		return FuncType{}, false
+	}
+	return m.funcType(idx), true
+}
+
+// funcType returns the signature of the function with the given index in the
+// joint import and definition index space.
+func (m *Module) funcType(idx uint32) FuncType {
+	if idx < uint32(len(m.imports)) {
+		return m.types[m.imports[idx].typ]
+	}
+	return m.types[m.funcs[idx-uint32(len(m.imports))].typ]
+}
+
+// reader is a cursor over a byte slice decoding the binary format primitives.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) eof() bool { return r.pos >= len(r.buf) }
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errUnexpectedEOF
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n uint32) ([]byte, error) {
+	if uint64(len(r.buf)-r.pos) < uint64(n) {
+		return nil, errUnexpectedEOF
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// uleb decodes an unsigned LEB128 integer of at most the given bit width.
+func (r *reader) uleb(bits uint) (uint64, error) {
+	var (
+		result uint64
+		shift  uint
+	)
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits || (shift+7 > bits && uint64(b&0x7f)>>(bits-shift) != 0) {
+			return 0, errOverflow
+		}
+		result |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+}
+
+// sleb decodes a signed LEB128 integer of at most the given bit width.
+func (r *reader) sleb(bits uint) (int64, error) {
+	var (
+		result int64
+		shift  uint
+		b      byte
+		err    error
+	)
+	for {
+		if b, err = r.byte(); err != nil {
+			return 0, err
+		}
+		if shift >= bits {
+			return 0, errOverflow
+		}
+		result |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		result |= -1 << shift
+	}
+	if bits < 64 {
+		if min, max := int64(-1)<<(bits-1), int64(1)<<(bits-1)-1; result < min || result > max {
+			return 0, errOverflow
+		}
+	}
+	return result, nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	v, err := r.uleb(32)
+	return uint32(v), err
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *reader) valueType() (ValueType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValueType(b); t {
+	case I32, I64:
+		return t, nil
+	}
+	return 0, fmt.Errorf("wasm: unsupported value type 0x%x", b)
+}
+
+func (r *reader) limits() (min, max uint32, err error) {
+	flag, err := r.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	if min, err = r.u32(); err != nil {
+		return 0, 0, err
+	}
+	switch flag {
+	case 0x00:
+		return min, 0, nil
+	case 0x01:
+		if max, err = r.u32(); err != nil {
+			return 0, 0, err
+		}
+		if max < min {
+			return 0, 0, errors.New("wasm: memory maximum below minimum")
+		}
+		return min, max, nil
+	}
+	return 0, 0, fmt.Errorf("wasm: invalid limits flag 0x%x", flag)
+}
+
+// constExpr decodes a constant initializer expression of the given type.
+func (r *reader) constExpr(typ ValueType) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	switch {
+	case op == opI32Const && typ == I32:
+		v, err := r.sleb(32)
+		if err != nil {
+			return 0, err
+		}
+		value = uint64(uint32(v))
+	case op == opI64Const && typ == I64:
+		v, err := r.sleb(64)
+		if err != nil {
+			return 0, err
+		}
+		value = uint64(v)
+	default:
+		return 0, fmt.Errorf("wasm: unsupported constant expression opcode 0x%x", op)
+	}
+	if end, err := r.byte(); err != nil || end != opEnd {
+		return 0, errors.New("wasm: unterminated constant expression")
+	}
+	return value, nil
+}
+
+// Section identifiers of the binary format.
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionTable    = 4
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionStart    = 8
+	sectionElement  = 9
+	sectionCode     = 10
+	sectionData     = 11
+)
+
+// Decode parses and compiles a binary WebAssembly module.
+func Decode(code []byte) (*Module, error) {
+	if !bytes.HasPrefix(code, Magic) {
+		return nil, errBadMagic
+	}
+	if len(code) < 8 || !bytes.Equal(code[4:8], version) {
+		return nil, errBadVersion
+	}
+	var (
+		m        = &Module{exports: make(map[string]uint32)}
+		r        = &reader{buf: code, pos: 8}
+		funcs    []uint32 // Type indices of the defined functions
+		last     byte
+		compiled bool
+	)
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		if id != sectionCustom {
+			if id <= last {
+				return nil, fmt.Errorf("wasm: section %d out of order", id)
+			}
+			last = id
+		}
+		sr := &reader{buf: payload}
+		switch id {
+		case sectionCustom:
+			continue
+		case sectionType:
+			err = m.decodeTypes(sr)
+		case sectionImport:
+			err = m.decodeImports(sr)
+		case sectionFunction:
+			funcs, err = m.decodeFunctions(sr)
+		case sectionTable, sectionElement:
+			err = errors.New("wasm: tables are not supported")
+		case sectionMemory:
+			err = m.decodeMemory(sr)
+		case sectionGlobal:
+			err = m.decodeGlobals(sr)
+		case sectionExport:
+			err = m.decodeExports(sr, len(funcs))
+		case sectionStart:
+			err = errors.New("wasm: start functions are not supported")
+		case sectionCode:
+			err = m.decodeCode(sr, funcs)
+			compiled = true
+		case sectionData:
+			err = m.decodeData(sr)
+		default:
+			err = fmt.Errorf("wasm: unknown section %d", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !sr.eof() {
+			return nil, fmt.Errorf("wasm: trailing bytes in section %d", id)
+		}
+	}
+	if len(funcs) > 0 && !compiled {
+		return nil, errors.New("wasm: function bodies missing")
+	}
+	return m, nil
+}
+
+func (m *Module) decodeTypes(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if form, err := r.byte(); err != nil || form != 0x60 {
+			return errors.New("wasm: invalid function type")
+		}
+		var ft FuncType
+		for _, list := range []*[]ValueType{&ft.Params, &ft.Results} {
+			n, err := r.u32()
+			if err != nil {
+				return err
+			}
+			for j := uint32(0); j < n; j++ {
+				t, err := r.valueType()
+				if err != nil {
+					return err
+				}
+				*list = append(*list, t)
+			}
+		}
+		if len(ft.Results) > 1 {
+			return errors.New("wasm: multiple results are not supported")
+		}
+		m.types = append(m.types, ft)
+	}
+	return nil
+}
+
+func (m *Module) decodeImports(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		module, err := r.name()
+		if err != nil {
+			return err
+		}
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		if kind, err := r.byte(); err != nil || kind != 0x00 {
+			return fmt.Errorf("wasm: import %s.%s: only functions can be imported", module, name)
+		}
+		typ, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if typ >= uint32(len(m.types)) {
+			return fmt.Errorf("wasm: import %s.%s: unknown type %d", module, name, typ)
+		}
+		m.imports = append(m.imports, importedFunc{module, name, typ})
+	}
+	return nil
+}
+
+func (m *Module) decodeFunctions(r *reader) ([]uint32, error) {
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	funcs := make([]uint32, 0, count)
+	for i := uint32(0); i < count; i++ {
+		typ, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if typ >= uint32(len(m.types)) {
+			return nil, fmt.Errorf("wasm: function %d: unknown type %d", i, typ)
+		}
+		funcs = append(funcs, typ)
+	}
+	return funcs, nil
+}
+
+func (m *Module) decodeMemory(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return errors.New("wasm: multiple memories are not supported")
+	}
+	if count == 1 {
+		if m.memMin, m.memMax, err = r.limits(); err != nil {
+			return err
+		}
+		m.hasMemory = true
+	}
+	return nil
+}
+
+func (m *Module) decodeGlobals(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		typ, err := r.valueType()
+		if err != nil {
+			return err
+		}
+		mut, err := r.byte()
+		if err != nil || mut > 1 {
+			return errors.New("wasm: invalid global mutability")
+		}
+		init, err := r.constExpr(typ)
+		if err != nil {
+			return err
+		}
+		m.globals = append(m.globals, global{typ, mut == 1, init})
+	}
+	return nil
+}
+
+func (m *Module) decodeExports(r *reader, defined int) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if _, dup := m.exports[name]; dup {
+			return fmt.Errorf("wasm: duplicate export %q", name)
+		}
+		if kind != 0x00 {
+			continue // Only function exports are callable, ignore the rest
+		}
+		if idx >= uint32(len(m.imports)+defined) {
+			return fmt.Errorf("wasm: export %q: unknown function %d", name, idx)
+		}
+		m.exports[name] = idx
+	}
+	return nil
+}
+
+func (m *Module) decodeCode(r *reader, funcs []uint32) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if count != uint32(len(funcs)) {
+		return errors.New("wasm: function and code section size mismatch")
+	}
+	for i := uint32(0); i < count; i++ {
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		body, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		br := &reader{buf: body}
+		groups, err := br.u32()
+		if err != nil {
+			return err
+		}
+		var locals []ValueType
+		for j := uint32(0); j < groups; j++ {
+			n, err := br.u32()
+			if err != nil {
+				return err
+			}
+			t, err := br.valueType()
+			if err != nil {
+				return err
+			}
+			if uint64(len(locals))+uint64(n) > maxLocals {
+				return errors.New("wasm: too many locals")
+			}
+			for k := uint32(0); k < n; k++ {
+				locals = append(locals, t)
+			}
+		}
+		code, err := m.compile(br, m.types[funcs[i]], len(locals), len(m.imports)+len(funcs))
+		if err != nil {
+			return fmt.Errorf("wasm: function %d: %v", i, err)
+		}
+		m.funcs = append(m.funcs, function{typ: funcs[i], locals: locals, code: code})
+	}
+	return nil
+}
+
+func (m *Module) decodeData(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if mem, err := r.u32(); err != nil || mem != 0 {
+			return errors.New("wasm: invalid data segment memory")
+		}
+		offset, err := r.constExpr(I32)
+		if err != nil {
+			return err
+		}
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		data, err := r.bytes(n)
+		if err != nil {
+			return err
+		}
+		if !m.hasMemory || uint64(uint32(offset))+uint64(n) > uint64(m.memMin)*PageSize {
+			return errors.New("wasm: data segment out of memory bounds")
+		}
+		m.data = append(m.data, dataSegment{uint32(offset), data})
+	}
+	return nil
+}
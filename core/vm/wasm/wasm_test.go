@@ -0,0 +1,292 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package wasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The helpers below assemble binary modules for the tests.
+
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		if v >>= 7; v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func vec(items ...[]byte) []byte {
+	return concat(uleb(uint64(len(items))), concat(items...))
+}
+
+func str(s string) []byte {
+	return concat(uleb(uint64(len(s))), []byte(s))
+}
+
+func section(id byte, payload []byte) []byte {
+	return concat([]byte{id}, uleb(uint64(len(payload))), payload)
+}
+
+func module(sections ...[]byte) []byte {
+	return concat(Magic, version, concat(sections...))
+}
+
+func sig(params []ValueType, results []ValueType) []byte {
+	return concat([]byte{0x60}, types(params), types(results))
+}
+
+func types(vt []ValueType) []byte {
+	return concat(uleb(uint64(len(vt))), valueTypeBytes(vt))
+}
+
+func body(locals []byte, code ...byte) []byte {
+	fn := concat(locals, code)
+	return concat(uleb(uint64(len(fn))), fn)
+}
+
+// noLocals is the local declaration of a function without extra locals.
+var noLocals = []byte{0x00}
+
+// exportFunc builds an entry of the export section.
+func exportFunc(name string, idx byte) []byte {
+	return concat(str(name), []byte{0x00, idx})
+}
+
+// instantiate decodes and instantiates a module with generous limits.
+func instantiate(t *testing.T, code []byte, imports Imports, gas uint64) *Instance {
+	t.Helper()
+	m, err := Decode(code)
+	if err != nil {
+		t.Fatalf("failed to decode module: %v", err)
+	}
+	inst, err := Instantiate(m, imports, Config{
+		MaxPages: 16,
+		MaxDepth: 64,
+		UseGas: func(amount uint64) bool {
+			if amount > gas {
+				return false
+			}
+			gas -= amount
+			return true
+		},
+		InstrGas: 1,
+		PageGas:  1,
+	})
+	if err != nil {
+		t.Fatalf("failed to instantiate module: %v", err)
+	}
+	return inst
+}
+
+func TestRecursiveCall(t *testing.T) {
+	// (func $fac (param i64) (result i64)
+	//   (if (result i64) (i64.eqz (local.get 0))
+	//     (then (i64.const 1))
+	//     (else (i64.mul (local.get 0) (call $fac (i64.sub (local.get 0) (i64.const 1)))))))
+	code := module(
+		section(sectionType, vec(sig([]ValueType{I64}, []ValueType{I64}))),
+		section(sectionFunction, vec([]byte{0x00})),
+		section(sectionExport, vec(exportFunc("fac", 0))),
+		section(sectionCode, vec(body(noLocals,
+			0x20, 0x00, 0x50, 0x04, 0x7e, 0x42, 0x01, 0x05,
+			0x20, 0x00, 0x20, 0x00, 0x42, 0x01, 0x7d, 0x10, 0x00, 0x7e, 0x0b, 0x0b,
+		))),
+	)
+	inst := instantiate(t, code, nil, 1000000)
+	res, err := inst.Call("fac", 20)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if res[0] != 2432902008176640000 {
+		t.Errorf("result mismatch: have %d, want %d", res[0], uint64(2432902008176640000))
+	}
+}
+
+// sumModule sums the integers up to its parameter in a loop.
+var sumModule = module(
+	section(sectionType, vec(sig([]ValueType{I32}, []ValueType{I32}))),
+	section(sectionFunction, vec([]byte{0x00})),
+	section(sectionExport, vec(exportFunc("sum", 0))),
+	section(sectionCode, vec(body([]byte{0x01, 0x02, 0x7f},
+		0x02, 0x40, 0x03, 0x40,
+		0x20, 0x01, 0x20, 0x00, 0x4f, 0x0d, 0x01, // br_if 1 (i >= n)
+		0x20, 0x01, 0x41, 0x01, 0x6a, 0x22, 0x01, // i = i + 1
+		0x20, 0x02, 0x6a, 0x21, 0x02, // acc += i
+		0x0c, 0x00, 0x0b, 0x0b,
+		0x20, 0x02, 0x0b,
+	))),
+)
+
+func TestLoop(t *testing.T) {
+	inst := instantiate(t, sumModule, nil, 1000000)
+	res, err := inst.Call("sum", 100)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if res[0] != 5050 {
+		t.Errorf("result mismatch: have %d, want 5050", res[0])
+	}
+}
+
+func TestBranchTable(t *testing.T) {
+	code := module(
+		section(sectionType, vec(sig([]ValueType{I32}, []ValueType{I32}))),
+		section(sectionFunction, vec([]byte{0x00})),
+		section(sectionExport, vec(exportFunc("switch", 0))),
+		section(sectionCode, vec(body(noLocals,
+			0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+			0x20, 0x00, 0x0e, 0x02, 0x00, 0x01, 0x02, 0x0b,
+			0x41, 0x0a, 0x0f, 0x0b,
+			0x41, 0x14, 0x0f, 0x0b,
+			0x41, 0x1e, 0x0b,
+		))),
+	)
+	inst := instantiate(t, code, nil, 1000000)
+	for in, want := range map[uint64]uint64{0: 10, 1: 20, 2: 30, 100: 30} {
+		res, err := inst.Call("switch", in)
+		if err != nil {
+			t.Fatalf("call(%d) failed: %v", in, err)
+		}
+		if res[0] != want {
+			t.Errorf("call(%d) mismatch: have %d, want %d", in, res[0], want)
+		}
+	}
+}
+
+func TestMemoryAndImports(t *testing.T) {
+	var emitted []byte
+	imports := Imports{"env": {"emit": HostFunction{
+		Type: FuncType{Params: []ValueType{I32, I32}},
+		Call: func(inst *Instance, args []uint64) ([]uint64, error) {
+			data, err := inst.Read(uint32(args[0]), uint32(args[1]))
+			emitted = data
+			return nil, err
+		},
+	}}}
+	// (func $main (result i32)
+	//   (i32.store (i32.const 0) (i32.const 0x01020304))
+	//   (call $emit (i32.const 16) (i32.const 5))
+	//   (i32.load8_u offset=1 (i32.const 0)))
+	code := module(
+		section(sectionType, vec(
+			sig([]ValueType{I32, I32}, nil),
+			sig(nil, []ValueType{I32}),
+		)),
+		section(sectionImport, vec(concat(str("env"), str("emit"), []byte{0x00, 0x00}))),
+		section(sectionFunction, vec([]byte{0x01})),
+		section(sectionMemory, vec([]byte{0x00, 0x01})),
+		section(sectionExport, vec(exportFunc("main", 1))),
+		section(sectionCode, vec(body(noLocals,
+			0x41, 0x00, 0x41, 0x84, 0x86, 0x88, 0x08, 0x36, 0x02, 0x00,
+			0x41, 0x10, 0x41, 0x05, 0x10, 0x00,
+			0x41, 0x00, 0x2d, 0x00, 0x01, 0x0b,
+		))),
+		section(sectionData, vec(concat([]byte{0x00, 0x41, 0x10, 0x0b}, str("hello")))),
+	)
+	inst := instantiate(t, code, imports, 1000000)
+	res, err := inst.Call("main")
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if res[0] != 0x03 {
+		t.Errorf("loaded byte mismatch: have %#x, want 0x03", res[0])
+	}
+	if string(emitted) != "hello" {
+		t.Errorf("emitted data mismatch: have %q, want %q", emitted, "hello")
+	}
+}
+
+func TestTraps(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		err  error
+	}{
+		{"unreachable", []byte{0x00, 0x0b}, errUnreachable},
+		{"divzero", []byte{0x41, 0x01, 0x41, 0x00, 0x6d, 0x1a, 0x0b}, errDivideByZero},
+		{"overflow", []byte{0x41, 0x80, 0x80, 0x80, 0x80, 0x78, 0x41, 0x7f, 0x6d, 0x1a, 0x0b}, errIntOverflow},
+		{"bounds", []byte{0x41, 0xfd, 0xff, 0x03, 0x28, 0x00, 0x00, 0x1a, 0x0b}, errMemoryBounds},
+		{"underflow", []byte{0x1a, 0x0b}, errStackUnderflow},
+		{"outofgas", []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b}, ErrOutOfGas},
+		{"recursion", []byte{0x10, 0x00, 0x0b}, errCallDepth},
+	}
+	for _, test := range tests {
+		code := module(
+			section(sectionType, vec(sig(nil, nil))),
+			section(sectionFunction, vec([]byte{0x00})),
+			section(sectionMemory, vec([]byte{0x00, 0x01})),
+			section(sectionExport, vec(exportFunc("main", 0))),
+			section(sectionCode, vec(body(noLocals, test.code...))),
+		)
+		inst := instantiate(t, code, nil, 10000)
+		if _, err := inst.Call("main"); err != test.err {
+			t.Errorf("%s: error mismatch: have %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := map[string][]byte{
+		"magic":   []byte("\x00wasm\x01\x00\x00\x00"),
+		"version": concat(Magic, []byte{0x02, 0x00, 0x00, 0x00}),
+		"float": module(
+			section(sectionType, vec(sig(nil, nil))),
+			section(sectionFunction, vec([]byte{0x00})),
+			section(sectionCode, vec(body(noLocals, 0x43, 0x00, 0x00, 0x00, 0x00, 0x1a, 0x0b))),
+		),
+		"table": module(section(sectionTable, vec([]byte{0x70, 0x00, 0x01}))),
+		"start": module(
+			section(sectionType, vec(sig(nil, nil))),
+			section(sectionFunction, vec([]byte{0x00})),
+			section(sectionStart, []byte{0x00}),
+			section(sectionCode, vec(body(noLocals, 0x0b))),
+		),
+		"branch": module(
+			section(sectionType, vec(sig(nil, nil))),
+			section(sectionFunction, vec([]byte{0x00})),
+			section(sectionCode, vec(body(noLocals, 0x0c, 0x01, 0x0b))),
+		),
+		"truncated": module(section(sectionType, []byte{0x01})),
+	}
+	for name, code := range tests {
+		if _, err := Decode(code); err == nil {
+			t.Errorf("%s: invalid module accepted", name)
+		}
+	}
+}
+
+func BenchmarkLoop(b *testing.B) {
+	m, err := Decode(sumModule)
+	if err != nil {
+		b.Fatal(err)
+	}
+	inst, _ := Instantiate(m, nil, Config{MaxDepth: 1})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inst.Call("sum", 10000)
+	}
+}
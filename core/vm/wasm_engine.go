@@ -0,0 +1,343 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm/wasm"
+	"github.com/matrix/go-matrix/params"
+)
+
+// Engine is an alternative contract runtime. The EVM hands the execution of a
+// contract to the first engine that recognises its code and falls back to the
+// byte code interpreter otherwise.
+type Engine interface {
+	// CanRun reports whether the engine executes the given contract code.
+	CanRun(code []byte) bool
+
+	// Run executes the contract with the given input. If deploy is set the code
+	// is a creation payload and the returned data is stored as contract code.
+	Run(contract *Contract, input []byte, deploy bool) ([]byte, error)
+}
+
+// WASMUpgrade is the VM upgrade enabling the experimental WASM contract runtime.
+// It is meant for private test networks benchmarking WASM against the EVM and
+// should not be scheduled on production chains.
+const WASMUpgrade = "wasm"
+
+const (
+	wasmInstrGas   = 1                                     // Gas charged per executed WASM instruction
+	wasmPageGas    = params.MemoryGas * wasm.PageSize / 32 // Gas charged per 64KiB memory page
+	wasmMaxPages   = 16                                    // Memory limit of a contract instance (1MiB)
+	wasmMaxDepth   = 256                                   // Call depth limit within a contract
+	wasmCacheLimit = 64                                    // Number of decoded modules to keep around
+)
+
+var (
+	errWASMReturn    = errors.New("wasm: return")
+	errWASMTopics    = errors.New("wasm: too many log topics")
+	errWASMNoEntry   = errors.New("wasm: contract exports no main function")
+	errWASMSignature = errors.New("wasm: entry point must take no arguments and return nothing")
+)
+
+// wasmEngine runs contracts compiled to WebAssembly. A contract is a binary
+// module, recognised by the WASM magic prefix, which is stored as is on
+// deployment. Its optional "deploy" export runs once on creation, the "main"
+// export on every call. Both access the environment through the host functions
+// the "env" module provides, see hostFunctions.
+//
+// Contracts cannot call other contracts yet, message calls and creations are
+// only available to EVM code.
+type wasmEngine struct {
+	evm *EVM
+}
+
+// wasmModules caches decoded modules by code hash across all engines. Decoded
+// modules are immutable and may be instantiated concurrently.
+var wasmModules, _ = lru.New(wasmCacheLimit)
+
+func newWASMEngine(evm *EVM) *wasmEngine {
+	return &wasmEngine{evm: evm}
+}
+
+// CanRun implements Engine, accepting code with the WASM magic prefix.
+func (e *wasmEngine) CanRun(code []byte) bool {
+	return bytes.HasPrefix(code, wasm.Magic)
+}
+
+// Run implements Engine.
+func (e *wasmEngine) Run(contract *Contract, input []byte, deploy bool) (ret []byte, err error) {
+	e.evm.depth++
+	defer func() { e.evm.depth-- }()
+
+	module, err := e.module(contract)
+	if err != nil {
+		return nil, err
+	}
+	call := &wasmCall{evm: e.evm, contract: contract, input: input}
+	inst, err := wasm.Instantiate(module, call.hostFunctions(), wasm.Config{
+		MaxPages: wasmMaxPages,
+		MaxDepth: wasmMaxDepth,
+		UseGas:   contract.UseGas,
+		InstrGas: wasmInstrGas,
+		PageGas:  wasmPageGas,
+	})
+	if err == wasm.ErrOutOfGas {
+		return nil, ErrOutOfGas
+	} else if err != nil {
+		return nil, err
+	}
+	// The entry point is mandatory, the constructor is optional
+	entry := "main"
+	if err := checkEntry(module, entry); err != nil {
+		return nil, err
+	}
+	if deploy {
+		if _, ok := module.Export("deploy"); !ok {
+			return contract.Code, nil
+		}
+		entry = "deploy"
+		if err := checkEntry(module, entry); err != nil {
+			return nil, err
+		}
+	}
+	switch _, err = inst.Call(entry); err {
+	case nil, errWASMReturn:
+		if deploy {
+			return contract.Code, nil
+		}
+		return call.output, nil
+	case wasm.ErrOutOfGas:
+		return nil, ErrOutOfGas
+	default:
+		return call.output, err
+	}
+}
+
+// checkEntry verifies that the module exports the named entry point with the
+// signature expected by the engine.
+func checkEntry(module *wasm.Module, name string) error {
+	typ, ok := module.Export(name)
+	if !ok {
+		return errWASMNoEntry
+	}
+	if len(typ.Params) != 0 || len(typ.Results) != 0 {
+		return errWASMSignature
+	}
+	return nil
+}
+
+// module returns the decoded module of the contract code.
+func (e *wasmEngine) module(contract *Contract) (*wasm.Module, error) {
+	if m, ok := wasmModules.Get(contract.CodeHash); ok {
+		return m.(*wasm.Module), nil
+	}
+	m, err := wasm.Decode(contract.Code)
+	if err != nil {
+		return nil, err
+	}
+	if contract.CodeHash != (common.Hash{}) {
+		wasmModules.Add(contract.CodeHash, m)
+	}
+	return m, nil
+}
+
+// wasmCall is the environment of a single contract invocation.
+type wasmCall struct {
+	evm      *EVM
+	contract *Contract
+	input    []byte
+	output   []byte
+}
+
+// hostFunctions returns the functions contracts import from the "env" module.
+// Pointers refer to the contract's linear memory, storage keys and values as
+// well as call values are 32 byte big endian words, addresses 20 bytes.
+func (c *wasmCall) hostFunctions() wasm.Imports {
+	i32, i64 := wasm.I32, wasm.I64
+	fn := func(params, results []wasm.ValueType, call func(*wasm.Instance, []uint64) ([]uint64, error)) wasm.HostFunction {
+		return wasm.HostFunction{Type: wasm.FuncType{Params: params, Results: results}, Call: call}
+	}
+	return wasm.Imports{"env": {
+		"get_input_size": fn(nil, []wasm.ValueType{i32}, c.getInputSize),
+		"get_input":      fn([]wasm.ValueType{i32}, nil, c.getInput),
+		"storage_load":   fn([]wasm.ValueType{i32, i32}, nil, c.storageLoad),
+		"storage_store":  fn([]wasm.ValueType{i32, i32}, nil, c.storageStore),
+		"caller":         fn([]wasm.ValueType{i32}, nil, c.caller),
+		"address":        fn([]wasm.ValueType{i32}, nil, c.address),
+		"callvalue":      fn([]wasm.ValueType{i32}, nil, c.callValue),
+		"block_number":   fn(nil, []wasm.ValueType{i64}, c.blockNumber),
+		"log":            fn([]wasm.ValueType{i32, i32, i32, i32}, nil, c.log),
+		"return":         fn([]wasm.ValueType{i32, i32}, nil, c.ret),
+		"revert":         fn([]wasm.ValueType{i32, i32}, nil, c.revert),
+	}}
+}
+
+func (c *wasmCall) useGas(gas uint64) error {
+	if !c.contract.UseGas(gas) {
+		return wasm.ErrOutOfGas
+	}
+	return nil
+}
+
+// readWord reads a 32 byte word from memory.
+func readWord(inst *wasm.Instance, ptr uint64) (common.Hash, error) {
+	data, err := inst.Read(uint32(ptr), common.HashLength)
+	return common.BytesToHash(data), err
+}
+
+func (c *wasmCall) getInputSize(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return []uint64{uint64(len(c.input))}, nil
+}
+
+func (c *wasmCall) getInput(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(params.CopyGas * toWordSize(uint64(len(c.input)))); err != nil {
+		return nil, err
+	}
+	return nil, inst.Write(uint32(args[0]), c.input)
+}
+
+func (c *wasmCall) storageLoad(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(c.evm.interpreter.gasTable.SLoad); err != nil {
+		return nil, err
+	}
+	key, err := readWord(inst, args[0])
+	if err != nil {
+		return nil, err
+	}
+	val := c.evm.StateDB.GetState(c.contract.Address(), key)
+	return nil, inst.Write(uint32(args[1]), val[:])
+}
+
+func (c *wasmCall) storageStore(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if c.evm.interpreter.readOnly {
+		return nil, errWriteProtection
+	}
+	key, err := readWord(inst, args[0])
+	if err != nil {
+		return nil, err
+	}
+	val, err := readWord(inst, args[1])
+	if err != nil {
+		return nil, err
+	}
+	// Charge the same as SSTORE does for the equivalent state transition
+	current := c.evm.StateDB.GetState(c.contract.Address(), key)
+	switch {
+	case common.EmptyHash(current) && !common.EmptyHash(val):
+		err = c.useGas(params.SstoreSetGas)
+	case !common.EmptyHash(current) && common.EmptyHash(val):
+		if err = c.useGas(params.SstoreClearGas); err == nil {
+			c.evm.StateDB.AddRefund(params.SstoreRefundGas)
+		}
+	default:
+		err = c.useGas(params.SstoreResetGas)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.evm.StateDB.SetState(c.contract.Address(), key, val)
+	return nil, nil
+}
+
+func (c *wasmCall) caller(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(GasQuickStep); err != nil {
+		return nil, err
+	}
+	return nil, inst.Write(uint32(args[0]), c.contract.Caller().Bytes())
+}
+
+func (c *wasmCall) address(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(GasQuickStep); err != nil {
+		return nil, err
+	}
+	return nil, inst.Write(uint32(args[0]), c.contract.Address().Bytes())
+}
+
+func (c *wasmCall) callValue(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(GasQuickStep); err != nil {
+		return nil, err
+	}
+	value := common.BigToHash(c.contract.Value())
+	return nil, inst.Write(uint32(args[0]), value[:])
+}
+
+func (c *wasmCall) blockNumber(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := c.useGas(GasQuickStep); err != nil {
+		return nil, err
+	}
+	return []uint64{c.evm.BlockNumber.Uint64()}, nil
+}
+
+// log emits an event with the given number of topics, read as consecutive
+// words starting at the topic pointer.
+func (c *wasmCall) log(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if c.evm.interpreter.readOnly {
+		return nil, errWriteProtection
+	}
+	count, size := args[1]&0xffffffff, args[3]&0xffffffff
+	if count > 4 {
+		return nil, errWASMTopics
+	}
+	if err := c.useGas(params.LogGas + count*params.LogTopicGas + size*params.LogDataGas); err != nil {
+		return nil, err
+	}
+	topics := make([]common.Hash, count)
+	for i := range topics {
+		topic, err := readWord(inst, args[0]+uint64(i)*common.HashLength)
+		if err != nil {
+			return nil, err
+		}
+		topics[i] = topic
+	}
+	data, err := inst.Read(uint32(args[2]), uint32(size))
+	if err != nil {
+		return nil, err
+	}
+	c.evm.StateDB.AddLog(&types.Log{
+		Address:     c.contract.Address(),
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: c.evm.BlockNumber.Uint64(),
+	})
+	return nil, nil
+}
+
+// ret stops execution successfully with the given output.
+func (c *wasmCall) ret(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	output, err := inst.Read(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	c.output = output
+	return nil, errWASMReturn
+}
+
+// revert stops execution, reverting its state changes, with the given output.
+func (c *wasmCall) revert(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	output, err := inst.Read(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	c.output = output
+	return nil, errExecutionReverted
+}
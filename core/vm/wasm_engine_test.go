@@ -0,0 +1,169 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/core/vm/wasm"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// wasmSection assembles a module section, the payload must be shorter than 128
+// bytes to keep its length a single byte.
+func wasmSection(id byte, items ...[]byte) []byte {
+	payload := append([]byte{byte(len(items))}, bytes.Join(items, nil)...)
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+func wasmBody(code ...byte) []byte {
+	return append([]byte{byte(len(code))}, code...)
+}
+
+// wasmCounter is a contract storing 5 in slot zero on deployment and
+// incrementing it and returning the new value on every call.
+var wasmCounter = bytes.Join([][]byte{
+	wasm.Magic, {0x01, 0x00, 0x00, 0x00},
+	wasmSection(1, []byte{0x60, 0x02, 0x7f, 0x7f, 0x00}, []byte{0x60, 0x00, 0x00}),
+	wasmSection(2,
+		bytes.Join([][]byte{wasmName("env"), wasmName("storage_load"), {0x00, 0x00}}, nil),
+		bytes.Join([][]byte{wasmName("env"), wasmName("storage_store"), {0x00, 0x00}}, nil),
+		bytes.Join([][]byte{wasmName("env"), wasmName("return"), {0x00, 0x00}}, nil),
+	),
+	wasmSection(3, []byte{0x01}, []byte{0x01}),
+	wasmSection(5, []byte{0x00, 0x01}),
+	wasmSection(7,
+		append(wasmName("main"), 0x00, 0x03),
+		append(wasmName("deploy"), 0x00, 0x04),
+	),
+	wasmSection(10,
+		wasmBody(0x00,
+			0x41, 0x00, 0x41, 0x20, 0x10, 0x00, // storage_load(0, 32)
+			0x41, 0x3f, 0x41, 0x3f, 0x2d, 0x00, 0x00, 0x41, 0x01, 0x6a, 0x3a, 0x00, 0x00, // mem[63]++
+			0x41, 0x00, 0x41, 0x20, 0x10, 0x01, // storage_store(0, 32)
+			0x41, 0x20, 0x41, 0x20, 0x10, 0x02, // return(32, 32)
+			0x0b,
+		),
+		wasmBody(0x00,
+			0x41, 0x3f, 0x41, 0x05, 0x3a, 0x00, 0x00, // mem[63] = 5
+			0x41, 0x00, 0x41, 0x20, 0x10, 0x01, // storage_store(0, 32)
+			0x0b,
+		),
+	),
+}, nil)
+
+func newWASMTestEVM(upgrade *big.Int, number int64) *EVM {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(mandb.NewMemDatabase()))
+	config := &params.ChainConfig{
+		ChainId:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		ByzantiumBlock: big.NewInt(0),
+	}
+	if upgrade != nil {
+		config.VMUpgrades = map[string]*big.Int{WASMUpgrade: upgrade}
+	}
+	ctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(number),
+	}
+	return NewEVM(ctx, statedb, config, Config{})
+}
+
+// Tests that WASM contracts can be deployed and called once the upgrade is
+// active, and that their code is left to the EVM before.
+func TestWASMContract(t *testing.T) {
+	sender := AccountRef(common.HexToAddress("0x01"))
+
+	evm := newWASMTestEVM(big.NewInt(10), 10)
+	_, addr, _, err := evm.Create(sender, wasmCounter, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to deploy contract: %v", err)
+	}
+	if code := evm.StateDB.GetCode(addr); !bytes.Equal(code, wasmCounter) {
+		t.Fatalf("deployed code mismatch: have %x, want %x", code, wasmCounter)
+	}
+	if slot := evm.StateDB.GetState(addr, common.Hash{}); slot != common.BigToHash(big.NewInt(5)) {
+		t.Fatalf("constructor result mismatch: have %x, want 5", slot)
+	}
+	for i := int64(6); i < 8; i++ {
+		ret, _, err := evm.Call(sender, addr, nil, 1000000, new(big.Int))
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		if want := common.BigToHash(big.NewInt(i)); !bytes.Equal(ret, want[:]) {
+			t.Errorf("call result mismatch: have %x, want %x", ret, want)
+		}
+	}
+	if _, _, err := evm.StaticCall(sender, addr, nil, 1000000); err != errWriteProtection {
+		t.Errorf("static call error mismatch: have %v, want %v", err, errWriteProtection)
+	}
+	if _, _, err := evm.Call(sender, addr, nil, 1000, new(big.Int)); err != ErrOutOfGas {
+		t.Errorf("underpriced call error mismatch: have %v, want %v", err, ErrOutOfGas)
+	}
+
+	// Before the upgrade the magic prefix is plain EVM code halting on STOP
+	evm = newWASMTestEVM(big.NewInt(10), 9)
+	if _, addr, _, err = evm.Create(sender, wasmCounter, 1000000, new(big.Int)); err != nil {
+		t.Fatalf("failed to deploy contract: %v", err)
+	}
+	if code := evm.StateDB.GetCode(addr); len(code) != 0 {
+		t.Errorf("code stored before upgrade: %x", code)
+	}
+}
+
+// wasmLoop and evmLoop count down from 10000 in a loop.
+var (
+	wasmLoop = bytes.Join([][]byte{
+		wasm.Magic, {0x01, 0x00, 0x00, 0x00},
+		wasmSection(1, []byte{0x60, 0x00, 0x00}),
+		wasmSection(3, []byte{0x00}),
+		wasmSection(7, append(wasmName("main"), 0x00, 0x00)),
+		wasmSection(10, wasmBody(0x01, 0x01, 0x7f,
+			0x41, 0x90, 0xce, 0x00, 0x21, 0x00, // i = 10000
+			0x03, 0x40, 0x20, 0x00, 0x41, 0x01, 0x6b, 0x22, 0x00, 0x0d, 0x00, 0x0b, // loop while --i
+			0x0b,
+		)),
+	}, nil)
+
+	evmLoop = common.Hex2Bytes("6127105b600190038060035700")
+)
+
+func benchmarkLoop(b *testing.B, code []byte) {
+	evm := newWASMTestEVM(big.NewInt(0), 0)
+	addr := common.HexToAddress("0xc0de")
+	evm.StateDB.SetCode(addr, code)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := evm.Call(AccountRef(common.Address{}), addr, nil, 100000000, new(big.Int)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoopWASM(b *testing.B) { benchmarkLoop(b, wasmLoop) }
+func BenchmarkLoopEVM(b *testing.B)  { benchmarkLoop(b, evmLoop) }
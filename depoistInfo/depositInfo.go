@@ -64,6 +64,11 @@ func GetDepositList(tm *big.Int, getDeposit common.RoleType) ([]vm.DepositDetail
 	if err != nil {
 		return nil, err
 	}
+	return GetDepositListByState(db, getDeposit), nil
+}
+
+// GetDepositListByState returns the validator or miner deposits held in the given state.
+func GetDepositListByState(db vm.StateDB, getDeposit common.RoleType) []vm.DepositDetail {
 	contract := vm.NewContract(vm.AccountRef(common.HexToAddress("1337")), vm.AccountRef(common.BytesToAddress([]byte{10})), big.NewInt(0), 60000)
 	var depositList []vm.DepositDetail
 	switch getDeposit {
@@ -72,7 +77,7 @@ func GetDepositList(tm *big.Int, getDeposit common.RoleType) ([]vm.DepositDetail
 	case common.RoleMiner:
 		depositList = depositInfo.MatrixDeposit.GetMinerDepositList(contract, db)
 	}
-	return depositList, nil
+	return depositList
 }
 
 func GetDepositAndWithDrawList(tm *big.Int) ([]vm.DepositDetail, error) {
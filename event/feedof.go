@@ -0,0 +1,196 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package event
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// FeedOf implements one-to-many subscriptions where the carrier of events is a channel
+// of a fixed type. Values sent to a FeedOf are delivered to all subscribed channels
+// simultaneously.
+//
+// Unlike Feed, the element type is checked at compile time and delivery to subscribers
+// with free buffer space does not go through reflection. Only when some subscriber is
+// blocked does Send fall back to a reflective select over the remaining channels.
+//
+// The zero value is ready to use.
+type FeedOf[T any] struct {
+	once      sync.Once     // ensures that init only runs once
+	sendLock  chan struct{} // sendLock has a one-element buffer and is empty when held. It protects subs.
+	removeSub chan chan<- T // interrupts Send
+	subs      []chan<- T    // the active set of subscribed channels used by Send
+	cases     caseList      // select cases reused by Send while subscribers block
+
+	// The inbox holds newly subscribed channels until they are added to subs.
+	mu    sync.Mutex
+	inbox []chan<- T
+}
+
+func (f *FeedOf[T]) init() {
+	f.removeSub = make(chan chan<- T)
+	f.sendLock = make(chan struct{}, 1)
+	f.sendLock <- struct{}{}
+}
+
+// Subscribe adds a channel to the feed. Future sends will be delivered on the channel
+// until the subscription is canceled.
+//
+// The channel should have ample buffer space to avoid blocking other subscribers.
+// Slow subscribers are not dropped.
+func (f *FeedOf[T]) Subscribe(channel chan<- T) Subscription {
+	f.once.Do(f.init)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The next Send will add the channel to f.subs.
+	f.inbox = append(f.inbox, channel)
+	return &feedOfSub[T]{feed: f, channel: channel, err: make(chan error, 1)}
+}
+
+func (f *FeedOf[T]) remove(sub *feedOfSub[T]) {
+	// Delete from inbox first, which covers channels
+	// that have not been added to f.subs yet.
+	f.mu.Lock()
+	if index := indexOf(f.inbox, sub.channel); index != -1 {
+		f.inbox = append(f.inbox[:index], f.inbox[index+1:]...)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+
+	select {
+	case f.removeSub <- sub.channel:
+		// Send will remove the channel from f.subs.
+	case <-f.sendLock:
+		// No Send is in progress, delete the channel now that we have the send lock.
+		if index := indexOf(f.subs, sub.channel); index != -1 {
+			f.subs = append(f.subs[:index], f.subs[index+1:]...)
+		}
+		f.sendLock <- struct{}{}
+	}
+}
+
+// Send delivers to all subscribed channels simultaneously.
+// It returns the number of subscribers that the value was sent to.
+func (f *FeedOf[T]) Send(value T) (nsent int) {
+	f.once.Do(f.init)
+	<-f.sendLock
+
+	// Add new channels from the inbox after taking the send lock.
+	f.mu.Lock()
+	f.subs = append(f.subs, f.inbox...)
+	f.inbox = nil
+	f.mu.Unlock()
+
+	// Send until all channels have been chosen. 'pending' tracks a prefix of subs.
+	// When a send succeeds, the corresponding channel moves to the end of 'pending'
+	// and it shrinks by one element.
+	var rvalue reflect.Value
+	pending := f.subs
+	for {
+		// Fast path: try sending without blocking before falling back to a
+		// reflective select. This should usually succeed if subscribers are
+		// fast enough and have free buffer space.
+		for i := 0; i < len(pending); i++ {
+			select {
+			case pending[i] <- value:
+				nsent++
+				pending = deactivate(pending, i)
+				i--
+			default:
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		// Give the subscribers a chance to drain their channels once before
+		// parking on all of them, a select across many channels is expensive.
+		if !rvalue.IsValid() {
+			rvalue = reflect.ValueOf(value)
+			runtime.Gosched()
+			continue
+		}
+		// Select on all the receivers, waiting for them to unblock.
+		cases := append(f.cases[:0], reflect.SelectCase{Chan: reflect.ValueOf(f.removeSub), Dir: reflect.SelectRecv})
+		for _, ch := range pending {
+			cases = append(cases, reflect.SelectCase{Chan: reflect.ValueOf(ch), Dir: reflect.SelectSend, Send: rvalue})
+		}
+		f.cases = cases
+
+		chosen, recv, _ := reflect.Select(cases)
+		if chosen == 0 /* <-f.removeSub */ {
+			index := indexOf(f.subs, recv.Interface().(chan<- T))
+			if index == -1 {
+				continue
+			}
+			f.subs = append(f.subs[:index], f.subs[index+1:]...)
+			if index < len(pending) {
+				// Shrink 'pending' too because the removed channel was still active.
+				pending = f.subs[:len(pending)-1]
+			}
+		} else {
+			pending = deactivate(pending, chosen-firstSubSendCase)
+			nsent++
+		}
+	}
+
+	// Forget about the sent value and hand off the send lock.
+	for i := range f.cases {
+		f.cases[i] = reflect.SelectCase{}
+	}
+	f.sendLock <- struct{}{}
+	return nsent
+}
+
+// deactivate moves the channel at index into the non-accessible portion of the list.
+func deactivate[T any](list []chan<- T, index int) []chan<- T {
+	last := len(list) - 1
+	list[index], list[last] = list[last], list[index]
+	return list[:last]
+}
+
+// indexOf returns the index of the given channel in list, or -1 if absent.
+func indexOf[T any](list []chan<- T, channel chan<- T) int {
+	for i, ch := range list {
+		if ch == channel {
+			return i
+		}
+	}
+	return -1
+}
+
+type feedOfSub[T any] struct {
+	feed    *FeedOf[T]
+	channel chan<- T
+	errOnce sync.Once
+	err     chan error
+}
+
+func (sub *feedOfSub[T]) Unsubscribe() {
+	sub.errOnce.Do(func() {
+		sub.feed.remove(sub)
+		close(sub.err)
+	})
+}
+
+func (sub *feedOfSub[T]) Err() <-chan error {
+	return sub.err
+}
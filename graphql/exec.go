@@ -0,0 +1,491 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+)
+
+// object is a node of the result graph whose fields are resolved on demand.
+type object interface {
+	// typeName returns the schema type of the object, used for type conditions
+	// and the __typename meta field.
+	typeName() string
+
+	// resolve returns the value of one field of the object. The result is
+	// either nil, an object, a list of objects or a JSON serializable scalar.
+	resolve(ctx context.Context, name string, args arguments) (interface{}, error)
+}
+
+// errUnknownField is returned by resolvers for fields not part of the schema.
+var errUnknownField = errors.New("unknown field")
+
+// Error is a query error reported in the response.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response is the result of executing a query.
+type Response struct {
+	Data   *orderedMap `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// orderedMap is a JSON object retaining the order of its fields, as required
+// for query results.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: make(map[string]interface{})}
+}
+
+func (m *orderedMap) set(key string, val interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = val
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		val, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// executor runs a single operation of a query document.
+type executor struct {
+	doc       *document
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// execute parses and runs a query against the root object.
+func execute(ctx context.Context, root object, query string, operationName string, variables map[string]interface{}) *Response {
+	doc, err := parse(query)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(operationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if op.kind != "query" {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("%s operations are not supported", op.kind)}}}
+	}
+	e := &executor{doc: doc, variables: make(map[string]interface{})}
+	for _, def := range op.variables {
+		if val, ok := variables[def.name]; ok && val != nil {
+			e.variables[def.name] = val
+			continue
+		}
+		if def.defaults != nil {
+			val, err := e.literal(def.defaults)
+			if err != nil {
+				return &Response{Errors: []*Error{{Message: err.Error()}}}
+			}
+			e.variables[def.name] = val
+			continue
+		}
+		if def.nonNull {
+			return &Response{Errors: []*Error{{Message: fmt.Sprintf("variable $%s is required", def.name)}}}
+		}
+		e.variables[def.name] = nil
+	}
+	data := e.selectionSet(ctx, root, op.selections, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+// operation selects the operation to run from the document.
+func (doc *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, errors.New("operation name required for documents with multiple operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// fieldGroup is the set of fields sharing a response key, their sub-selections
+// are merged.
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// collectFields flattens fragments and directives of a selection set into the
+// ordered list of fields to resolve on an object of the given type.
+func (e *executor) collectFields(typ string, sels []selection, groups []*fieldGroup, visited map[string]bool) ([]*fieldGroup, error) {
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *field:
+			include, err := e.included(sel.directives)
+			if err != nil {
+				return nil, err
+			}
+			if !include {
+				continue
+			}
+			key, found := sel.responseKey(), false
+			for _, group := range groups {
+				if group.key == key {
+					if group.fields[0].name != sel.name {
+						return nil, fmt.Errorf("fields %q and %q conflict on response key %q", group.fields[0].name, sel.name, key)
+					}
+					group.fields, found = append(group.fields, sel), true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: key, fields: []*field{sel}})
+			}
+
+		case *fragmentSpread:
+			include, err := e.included(sel.directives)
+			if err != nil {
+				return nil, err
+			}
+			if !include || visited[sel.name] {
+				continue
+			}
+			frag, ok := e.doc.fragments[sel.name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.name)
+			}
+			visited[sel.name] = true
+			if frag.typeCond != typ {
+				continue
+			}
+			if groups, err = e.collectFields(typ, frag.selections, groups, visited); err != nil {
+				return nil, err
+			}
+
+		case *inlineFragment:
+			include, err := e.included(sel.directives)
+			if err != nil {
+				return nil, err
+			}
+			if !include || (sel.typeCond != "" && sel.typeCond != typ) {
+				continue
+			}
+			if groups, err = e.collectFields(typ, sel.selections, groups, visited); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return groups, nil
+}
+
+// included evaluates the @skip and @include directives of a selection.
+func (e *executor) included(dirs []*directive) (bool, error) {
+	for _, dir := range dirs {
+		if dir.name != "skip" && dir.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", dir.name)
+		}
+		args, err := e.arguments(dir.arguments)
+		if err != nil {
+			return false, err
+		}
+		cond, ok := args["if"].(bool)
+		if !ok {
+			return false, fmt.Errorf("directive @%s requires a boolean if argument", dir.name)
+		}
+		if cond == (dir.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// selectionSet resolves the selected fields of an object.
+func (e *executor) selectionSet(ctx context.Context, obj object, sels []selection, path []interface{}) *orderedMap {
+	groups, err := e.collectFields(obj.typeName(), sels, nil, make(map[string]bool))
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	result := newOrderedMap()
+	for _, group := range groups {
+		f := group.fields[0]
+		fieldPath := append(append([]interface{}{}, path...), group.key)
+
+		if f.name == "__typename" {
+			result.set(group.key, obj.typeName())
+			continue
+		}
+		args, err := e.arguments(f.arguments)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result.set(group.key, nil)
+			continue
+		}
+		val, err := obj.resolve(ctx, f.name, args)
+		if err == errUnknownField {
+			err = fmt.Errorf("unknown field %q on type %q", f.name, obj.typeName())
+		}
+		if err != nil {
+			e.fail(fieldPath, err)
+			result.set(group.key, nil)
+			continue
+		}
+		var subsels []selection
+		for _, f := range group.fields {
+			subsels = append(subsels, f.selections...)
+		}
+		result.set(group.key, e.complete(ctx, f, val, subsels, fieldPath))
+	}
+	return result
+}
+
+// complete converts a resolved field value into its result representation.
+func (e *executor) complete(ctx context.Context, f *field, val interface{}, sels []selection, path []interface{}) interface{} {
+	switch val := val.(type) {
+	case nil:
+		return nil
+
+	case object:
+		if len(sels) == 0 {
+			e.fail(path, fmt.Errorf("field %q of type %q must have a selection of subfields", f.name, val.typeName()))
+			return nil
+		}
+		return e.selectionSet(ctx, val, sels, path)
+
+	case []object:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = e.complete(ctx, f, item, sels, append(append([]interface{}{}, path...), i))
+		}
+		return list
+
+	default:
+		if len(sels) > 0 {
+			e.fail(path, fmt.Errorf("field %q is a scalar and cannot have a selection", f.name))
+			return nil
+		}
+		return val
+	}
+}
+
+// fail records a field error.
+func (e *executor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+}
+
+// arguments resolves the literal values and variables of field arguments.
+func (e *executor) arguments(vals map[string]value) (arguments, error) {
+	args := make(arguments, len(vals))
+	for name, val := range vals {
+		arg, err := e.literal(val)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = arg
+	}
+	return args, nil
+}
+
+// literal converts a value of the query document into the representation
+// used for JSON decoded variables.
+func (e *executor) literal(val value) (interface{}, error) {
+	switch val := val.(type) {
+	case variable:
+		v, ok := e.variables[string(val)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", string(val))
+		}
+		return v, nil
+	case intValue:
+		return json.Number(val), nil
+	case floatValue:
+		return json.Number(val), nil
+	case stringValue:
+		return string(val), nil
+	case enumValue:
+		return string(val), nil
+	case boolValue:
+		return bool(val), nil
+	case nullValue:
+		return nil, nil
+	case listValue:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			v, err := e.literal(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case objectValue:
+		obj := make(map[string]interface{}, len(val))
+		for name, item := range val {
+			v, err := e.literal(item)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = v
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", val)
+}
+
+// arguments are the resolved arguments of a field, with numbers represented
+// as json.Number as produced by a decoder with UseNumber.
+type arguments map[string]interface{}
+
+// long returns an optional Long argument, accepted either as a number or as a
+// decimal or hex encoded string.
+func (args arguments) long(name string) (*uint64, error) {
+	switch val := args[name].(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		n, err := strconv.ParseUint(string(val), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s argument: %v", name, err)
+		}
+		return &n, nil
+	case string:
+		var (
+			n   uint64
+			err error
+		)
+		if strings.HasPrefix(val, "0x") || strings.HasPrefix(val, "0X") {
+			n, err = hexutil.DecodeUint64(val)
+		} else {
+			n, err = strconv.ParseUint(val, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s argument: %v", name, err)
+		}
+		return &n, nil
+	}
+	return nil, fmt.Errorf("invalid %s argument: expected Long", name)
+}
+
+// int returns an optional Int argument.
+func (args arguments) int(name string) (*int, error) {
+	switch val := args[name].(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		n, err := strconv.ParseInt(string(val), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s argument: %v", name, err)
+		}
+		i := int(n)
+		return &i, nil
+	}
+	return nil, fmt.Errorf("invalid %s argument: expected Int", name)
+}
+
+// bigInt returns an optional BigInt argument, accepted either as a number or
+// as a decimal or hex encoded string.
+func (args arguments) bigInt(name string) (*big.Int, error) {
+	var text string
+	switch val := args[name].(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		text = string(val)
+	case string:
+		text = val
+	default:
+		return nil, fmt.Errorf("invalid %s argument: expected BigInt", name)
+	}
+	n, ok := new(big.Int).SetString(text, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s argument: malformed BigInt", name)
+	}
+	return n, nil
+}
+
+// hash returns an optional Bytes32 argument.
+func (args arguments) hash(name string) (*common.Hash, error) {
+	return decodeHash(name, args[name])
+}
+
+// address returns an optional Address argument.
+func (args arguments) address(name string) (*common.Address, error) {
+	return decodeAddress(name, args[name])
+}
+
+func decodeHash(name string, val interface{}) (*common.Hash, error) {
+	switch val := val.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		b, err := hexutil.Decode(val)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid %s argument: expected 32 byte hex string", name)
+		}
+		hash := common.BytesToHash(b)
+		return &hash, nil
+	}
+	return nil, fmt.Errorf("invalid %s argument: expected Bytes32", name)
+}
+
+func decodeAddress(name string, val interface{}) (*common.Address, error) {
+	switch val := val.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		b, err := hexutil.Decode(val)
+		if err != nil || len(b) != common.AddressLength {
+			return nil, fmt.Errorf("invalid %s argument: expected 20 byte hex string", name)
+		}
+		addr := common.BytesToAddress(b)
+		return &addr, nil
+	}
+	return nil, fmt.Errorf("invalid %s argument: expected Address", name)
+}
@@ -0,0 +1,733 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package graphql provides a GraphQL query interface to the chain data.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/internal/manapi"
+	"github.com/matrix/go-matrix/man/filters"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// maxBlockRange is the maximum number of blocks returned by a single blocks
+// query, larger ranges must be paginated by the client.
+const maxBlockRange = 1024
+
+// Backend is the chain access needed to resolve queries, it is implemented by
+// both the full and the light client API backends.
+type Backend interface {
+	manapi.Backend
+	filters.Backend
+}
+
+// Query is the root object of all queries.
+//
+//	block(number: Long, hash: Bytes32): Block
+//	blocks(from: Long!, to: Long): [Block!]!
+//	transaction(hash: Bytes32!): Transaction
+//	logs(filter: FilterCriteria!): [Log!]!
+//	pending: Pending!
+//	gasPrice: BigInt!
+//	protocolVersion: Int!
+type Query struct {
+	backend Backend
+}
+
+func (q *Query) typeName() string { return "Query" }
+
+func (q *Query) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	switch name {
+	case "block":
+		number, err := args.long("number")
+		if err != nil {
+			return nil, err
+		}
+		hash, err := args.hash("hash")
+		if err != nil {
+			return nil, err
+		}
+		var block *types.Block
+		switch {
+		case number != nil && hash != nil:
+			return nil, errors.New("only one of number or hash may be specified")
+		case hash != nil:
+			block, err = q.backend.GetBlock(ctx, *hash)
+		case number != nil:
+			block, err = q.backend.BlockByNumber(ctx, rpc.BlockNumber(*number))
+		default:
+			block, err = q.backend.BlockByNumber(ctx, rpc.LatestBlockNumber)
+		}
+		if block == nil || err != nil {
+			return nil, err
+		}
+		return &Block{backend: q.backend, block: block}, nil
+
+	case "blocks":
+		from, err := args.long("from")
+		if err != nil {
+			return nil, err
+		}
+		if from == nil {
+			return nil, errors.New("missing from argument")
+		}
+		to, err := args.long("to")
+		if err != nil {
+			return nil, err
+		}
+		head := q.backend.CurrentBlock().NumberU64()
+		if to == nil || *to > head {
+			to = &head
+		}
+		if *from > *to {
+			return []object{}, nil
+		}
+		if *to-*from >= maxBlockRange {
+			return nil, fmt.Errorf("block range too large, at most %d blocks may be requested", maxBlockRange)
+		}
+		blocks := make([]object, 0, *to-*from+1)
+		for n := *from; n <= *to; n++ {
+			block, err := q.backend.BlockByNumber(ctx, rpc.BlockNumber(n))
+			if err != nil {
+				return nil, err
+			}
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, &Block{backend: q.backend, block: block})
+		}
+		return blocks, nil
+
+	case "transaction":
+		hash, err := args.hash("hash")
+		if err != nil {
+			return nil, err
+		}
+		if hash == nil {
+			return nil, errors.New("missing hash argument")
+		}
+		return q.transaction(ctx, *hash)
+
+	case "logs":
+		return q.logs(ctx, args["filter"])
+
+	case "pending":
+		return &Pending{backend: q.backend}, nil
+
+	case "gasPrice":
+		price, err := q.backend.SuggestPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return (*hexutil.Big)(price), nil
+
+	case "protocolVersion":
+		return q.backend.ProtocolVersion(), nil
+	}
+	return nil, errUnknownField
+}
+
+// transaction looks up a transaction in the chain, falling back to the pool.
+func (q *Query) transaction(ctx context.Context, hash common.Hash) (interface{}, error) {
+	if tx, blockHash, _, index := rawdb.ReadTransaction(q.backend.ChainDb(), hash); tx != nil {
+		block, err := q.backend.GetBlock(ctx, blockHash)
+		if block == nil || err != nil {
+			return nil, err
+		}
+		return &Transaction{backend: q.backend, tx: tx, block: &Block{backend: q.backend, block: block}, index: index}, nil
+	}
+	if tx := q.backend.GetPoolTransaction(hash); tx != nil {
+		return &Transaction{backend: q.backend, tx: tx}, nil
+	}
+	return nil, nil
+}
+
+// logs runs a log filter over a range of blocks.
+//
+//	input FilterCriteria {
+//		fromBlock: Long
+//		toBlock: Long
+//		addresses: [Address!]
+//		topics: [[Bytes32!]!]
+//	}
+func (q *Query) logs(ctx context.Context, arg interface{}) (interface{}, error) {
+	criteria, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("missing filter argument")
+	}
+	begin, end := int64(rpc.LatestBlockNumber), int64(rpc.LatestBlockNumber)
+	if from, err := arguments(criteria).long("fromBlock"); err != nil {
+		return nil, err
+	} else if from != nil {
+		begin = int64(*from)
+	}
+	if to, err := arguments(criteria).long("toBlock"); err != nil {
+		return nil, err
+	} else if to != nil {
+		end = int64(*to)
+	}
+	addresses, topics, err := decodeLogCriteria(criteria)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := filters.New(q.backend, begin, end, addresses, topics).Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]object, len(logs))
+	for i, log := range logs {
+		result[i] = &Log{backend: q.backend, log: log}
+	}
+	return result, nil
+}
+
+// decodeLogCriteria parses the address and topic clauses of a log filter.
+func decodeLogCriteria(criteria map[string]interface{}) ([]common.Address, [][]common.Hash, error) {
+	var addresses []common.Address
+	if list, ok := criteria["addresses"].([]interface{}); ok {
+		for _, item := range list {
+			addr, err := decodeAddress("addresses", item)
+			if err != nil {
+				return nil, nil, err
+			}
+			if addr == nil {
+				return nil, nil, errors.New("invalid addresses argument: null address")
+			}
+			addresses = append(addresses, *addr)
+		}
+	} else if criteria["addresses"] != nil {
+		return nil, nil, errors.New("invalid addresses argument: expected list")
+	}
+	var topics [][]common.Hash
+	if list, ok := criteria["topics"].([]interface{}); ok {
+		for _, item := range list {
+			sublist, ok := item.([]interface{})
+			if !ok {
+				return nil, nil, errors.New("invalid topics argument: expected list of lists")
+			}
+			var clause []common.Hash
+			for _, subitem := range sublist {
+				topic, err := decodeHash("topics", subitem)
+				if err != nil {
+					return nil, nil, err
+				}
+				if topic == nil {
+					return nil, nil, errors.New("invalid topics argument: null topic")
+				}
+				clause = append(clause, *topic)
+			}
+			topics = append(topics, clause)
+		}
+	} else if criteria["topics"] != nil {
+		return nil, nil, errors.New("invalid topics argument: expected list of lists")
+	}
+	return addresses, topics, nil
+}
+
+// Pending is the view of the transaction pool and pending state.
+//
+//	transactionCount: Int!
+//	transactions: [Transaction!]!
+//	account(address: Address!): Account!
+type Pending struct {
+	backend Backend
+}
+
+func (p *Pending) typeName() string { return "Pending" }
+
+func (p *Pending) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	switch name {
+	case "transactionCount":
+		txs, err := p.backend.GetPoolTransactions()
+		if err != nil {
+			return nil, err
+		}
+		return len(txs), nil
+
+	case "transactions":
+		txs, err := p.backend.GetPoolTransactions()
+		if err != nil {
+			return nil, err
+		}
+		result := make([]object, len(txs))
+		for i, tx := range txs {
+			result[i] = &Transaction{backend: p.backend, tx: tx}
+		}
+		return result, nil
+
+	case "account":
+		addr, err := args.address("address")
+		if err != nil {
+			return nil, err
+		}
+		if addr == nil {
+			return nil, errors.New("missing address argument")
+		}
+		return &Account{backend: p.backend, address: *addr, number: rpc.PendingBlockNumber}, nil
+	}
+	return nil, errUnknownField
+}
+
+// Block is a block of the chain.
+//
+//	number: Long!
+//	hash: Bytes32!
+//	parent: Block
+//	nonce: Bytes!
+//	transactionsRoot: Bytes32!
+//	stateRoot: Bytes32!
+//	receiptsRoot: Bytes32!
+//	ommerHash: Bytes32!
+//	ommerCount: Int!
+//	miner: Account!
+//	extraData: Bytes!
+//	gasLimit: Long!
+//	gasUsed: Long!
+//	timestamp: BigInt!
+//	logsBloom: Bytes!
+//	mixHash: Bytes32!
+//	difficulty: BigInt!
+//	totalDifficulty: BigInt
+//	transactionCount: Int!
+//	transactions(skip: Int, first: Int): [Transaction!]!
+//	transactionAt(index: Int!): Transaction
+//	logs(filter: BlockFilterCriteria): [Log!]!
+//	account(address: Address!): Account!
+type Block struct {
+	backend  Backend
+	block    *types.Block
+	receipts types.Receipts // Lazily loaded receipts of the block
+}
+
+func (b *Block) typeName() string { return "Block" }
+
+func (b *Block) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	header := b.block.Header()
+	switch name {
+	case "number":
+		return b.block.NumberU64(), nil
+	case "hash":
+		return b.block.Hash(), nil
+	case "parent":
+		if b.block.NumberU64() == 0 {
+			return nil, nil
+		}
+		parent, err := b.backend.GetBlock(ctx, b.block.ParentHash())
+		if parent == nil || err != nil {
+			return nil, err
+		}
+		return &Block{backend: b.backend, block: parent}, nil
+	case "nonce":
+		return hexutil.Bytes(header.Nonce[:]), nil
+	case "transactionsRoot":
+		return header.TxHash, nil
+	case "stateRoot":
+		return header.Root, nil
+	case "receiptsRoot":
+		return header.ReceiptHash, nil
+	case "ommerHash":
+		return header.UncleHash, nil
+	case "ommerCount":
+		return len(b.block.Uncles()), nil
+	case "miner":
+		return &Account{backend: b.backend, address: header.Coinbase, number: rpc.BlockNumber(b.block.NumberU64())}, nil
+	case "extraData":
+		return hexutil.Bytes(header.Extra), nil
+	case "gasLimit":
+		return header.GasLimit, nil
+	case "gasUsed":
+		return header.GasUsed, nil
+	case "timestamp":
+		return (*hexutil.Big)(header.Time), nil
+	case "logsBloom":
+		return hexutil.Bytes(header.Bloom.Bytes()), nil
+	case "mixHash":
+		return header.MixDigest, nil
+	case "difficulty":
+		return (*hexutil.Big)(header.Difficulty), nil
+	case "totalDifficulty":
+		td := b.backend.GetTd(b.block.Hash())
+		if td == nil {
+			return nil, nil
+		}
+		return (*hexutil.Big)(td), nil
+	case "transactionCount":
+		return len(b.block.Transactions()), nil
+
+	case "transactions":
+		skip, err := args.int("skip")
+		if err != nil {
+			return nil, err
+		}
+		first, err := args.int("first")
+		if err != nil {
+			return nil, err
+		}
+		txs := b.block.Transactions()
+		start, end := 0, len(txs)
+		if skip != nil && *skip > 0 {
+			start = *skip
+		}
+		if start > end {
+			start = end
+		}
+		if first != nil && *first >= 0 && start+*first < end {
+			end = start + *first
+		}
+		result := make([]object, 0, end-start)
+		for i := start; i < end; i++ {
+			result = append(result, &Transaction{backend: b.backend, tx: txs[i], block: b, index: uint64(i)})
+		}
+		return result, nil
+
+	case "transactionAt":
+		index, err := args.int("index")
+		if err != nil {
+			return nil, err
+		}
+		if index == nil {
+			return nil, errors.New("missing index argument")
+		}
+		txs := b.block.Transactions()
+		if *index < 0 || *index >= len(txs) {
+			return nil, nil
+		}
+		return &Transaction{backend: b.backend, tx: txs[*index], block: b, index: uint64(*index)}, nil
+
+	case "logs":
+		criteria, _ := args["filter"].(map[string]interface{})
+		addresses, topics, err := decodeLogCriteria(criteria)
+		if err != nil {
+			return nil, err
+		}
+		receipts, err := b.getReceipts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var result []object
+		for i, receipt := range receipts {
+			for _, log := range receipt.Logs {
+				if matchLog(log, addresses, topics) {
+					result = append(result, &Log{backend: b.backend, log: log, tx: &Transaction{backend: b.backend, tx: b.block.Transactions()[i], block: b, index: uint64(i)}})
+				}
+			}
+		}
+		if result == nil {
+			result = []object{}
+		}
+		return result, nil
+
+	case "account":
+		addr, err := args.address("address")
+		if err != nil {
+			return nil, err
+		}
+		if addr == nil {
+			return nil, errors.New("missing address argument")
+		}
+		return &Account{backend: b.backend, address: *addr, number: rpc.BlockNumber(b.block.NumberU64())}, nil
+	}
+	return nil, errUnknownField
+}
+
+// getReceipts returns the receipts of the block, loading them on first use.
+func (b *Block) getReceipts(ctx context.Context) (types.Receipts, error) {
+	if b.receipts == nil {
+		receipts, err := b.backend.GetReceipts(ctx, b.block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if len(receipts) != len(b.block.Transactions()) {
+			return nil, fmt.Errorf("receipts of block %x unavailable", b.block.Hash())
+		}
+		b.receipts = receipts
+	}
+	return b.receipts, nil
+}
+
+// matchLog checks whether a log matches the address and topic clauses of a
+// filter, using the same semantics as the log filters.
+func matchLog(log *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		found := false
+		for _, addr := range addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, clause := range topics {
+		if len(clause) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range clause {
+			if log.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Transaction is a transaction either included in a block or pending in the
+// transaction pool.
+//
+//	hash: Bytes32!
+//	nonce: Long!
+//	index: Int
+//	from: Account!
+//	to: Account
+//	value: BigInt!
+//	gasPrice: BigInt!
+//	gas: Long!
+//	inputData: Bytes!
+//	block: Block
+//	status: Long
+//	gasUsed: Long
+//	cumulativeGasUsed: Long
+//	createdContract: Account
+//	logs: [Log!]
+type Transaction struct {
+	backend Backend
+	tx      *types.Transaction
+	block   *Block // Nil for pending transactions
+	index   uint64
+}
+
+func (t *Transaction) typeName() string { return "Transaction" }
+
+func (t *Transaction) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	switch name {
+	case "hash":
+		return t.tx.Hash(), nil
+	case "nonce":
+		return t.tx.Nonce(), nil
+	case "index":
+		if t.block == nil {
+			return nil, nil
+		}
+		return t.index, nil
+	case "from":
+		var signer types.Signer = types.FrontierSigner{}
+		if t.tx.Protected() {
+			signer = types.NewEIP155Signer(t.tx.ChainId())
+		}
+		from, err := types.Sender(signer, t.tx)
+		if err != nil {
+			return nil, err
+		}
+		return t.account(from), nil
+	case "to":
+		if t.tx.To() == nil {
+			return nil, nil
+		}
+		return t.account(*t.tx.To()), nil
+	case "value":
+		return (*hexutil.Big)(t.tx.Value()), nil
+	case "gasPrice":
+		return (*hexutil.Big)(t.tx.GasPrice()), nil
+	case "gas":
+		return t.tx.Gas(), nil
+	case "inputData":
+		return hexutil.Bytes(t.tx.Data()), nil
+	case "block":
+		if t.block == nil {
+			return nil, nil
+		}
+		return t.block, nil
+	}
+	// All remaining fields are derived from the receipt
+	switch name {
+	case "status", "gasUsed", "cumulativeGasUsed", "createdContract", "logs":
+	default:
+		return nil, errUnknownField
+	}
+	receipt, err := t.receipt(ctx)
+	if receipt == nil || err != nil {
+		return nil, err
+	}
+	switch name {
+	case "status":
+		return receipt.Status, nil
+	case "gasUsed":
+		return receipt.GasUsed, nil
+	case "cumulativeGasUsed":
+		return receipt.CumulativeGasUsed, nil
+	case "createdContract":
+		if t.tx.To() != nil {
+			return nil, nil
+		}
+		return t.account(receipt.ContractAddress), nil
+	default:
+		logs := make([]object, len(receipt.Logs))
+		for i, log := range receipt.Logs {
+			logs[i] = &Log{backend: t.backend, log: log, tx: t}
+		}
+		return logs, nil
+	}
+}
+
+// receipt returns the receipt of an included transaction, or nil if pending.
+func (t *Transaction) receipt(ctx context.Context) (*types.Receipt, error) {
+	if t.block == nil {
+		return nil, nil
+	}
+	receipts, err := t.block.getReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t.index >= uint64(len(receipts)) {
+		return nil, nil
+	}
+	return receipts[t.index], nil
+}
+
+// account returns an account resolved in the state after the transaction's
+// block, or in the pending state if the transaction is not yet included.
+func (t *Transaction) account(addr common.Address) *Account {
+	number := rpc.PendingBlockNumber
+	if t.block != nil {
+		number = rpc.BlockNumber(t.block.block.NumberU64())
+	}
+	return &Account{backend: t.backend, address: addr, number: number}
+}
+
+// Account is an account in the state of a specific block.
+//
+//	address: Address!
+//	balance: BigInt!
+//	transactionCount: Long!
+//	code: Bytes!
+//	storage(slot: Bytes32!): Bytes32!
+type Account struct {
+	backend Backend
+	address common.Address
+	number  rpc.BlockNumber
+}
+
+func (a *Account) typeName() string { return "Account" }
+
+func (a *Account) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	if name == "address" {
+		return a.address, nil
+	}
+	var slot *common.Hash
+	switch name {
+	case "balance", "transactionCount", "code":
+	case "storage":
+		var err error
+		if slot, err = args.hash("slot"); err != nil {
+			return nil, err
+		}
+		if slot == nil {
+			return nil, errors.New("missing slot argument")
+		}
+	default:
+		return nil, errUnknownField
+	}
+	statedb, err := a.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "balance":
+		return (*hexutil.Big)(statedb.GetBalance(a.address)), nil
+	case "transactionCount":
+		return statedb.GetNonce(a.address), nil
+	case "code":
+		return hexutil.Bytes(statedb.GetCode(a.address)), nil
+	default:
+		return statedb.GetState(a.address, *slot), nil
+	}
+}
+
+// state retrieves the state the account is resolved in.
+func (a *Account) state(ctx context.Context) (*state.StateDB, error) {
+	statedb, _, err := a.backend.StateAndHeaderByNumber(ctx, a.number)
+	if err != nil {
+		return nil, err
+	}
+	if statedb == nil {
+		return nil, fmt.Errorf("state of block %d unavailable", a.number)
+	}
+	return statedb, nil
+}
+
+// Log is an event emitted by a transaction.
+//
+//	index: Int!
+//	account: Account!
+//	topics: [Bytes32!]!
+//	data: Bytes!
+//	transaction: Transaction!
+type Log struct {
+	backend Backend
+	log     *types.Log
+	tx      *Transaction // Lazily resolved for logs returned by filters
+}
+
+func (l *Log) typeName() string { return "Log" }
+
+func (l *Log) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	switch name {
+	case "index":
+		return l.log.Index, nil
+	case "account":
+		return &Account{backend: l.backend, address: l.log.Address, number: rpc.BlockNumber(l.log.BlockNumber)}, nil
+	case "topics":
+		topics := l.log.Topics
+		if topics == nil {
+			topics = []common.Hash{}
+		}
+		return topics, nil
+	case "data":
+		return hexutil.Bytes(l.log.Data), nil
+	case "transaction":
+		if l.tx == nil {
+			block, err := l.backend.GetBlock(ctx, l.log.BlockHash)
+			if err != nil {
+				return nil, err
+			}
+			if block == nil || int(l.log.TxIndex) >= len(block.Transactions()) {
+				return nil, fmt.Errorf("transaction %x unavailable", l.log.TxHash)
+			}
+			l.tx = &Transaction{backend: l.backend, tx: block.Transactions()[l.log.TxIndex], block: &Block{backend: l.backend, block: block}, index: uint64(l.log.TxIndex)}
+		}
+		return l.tx, nil
+	}
+	return nil, errUnknownField
+}
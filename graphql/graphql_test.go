@@ -0,0 +1,193 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// testObject is a stub object resolving fields from a static map, with list
+// and nested fields derived from its children.
+type testObject struct {
+	name     string
+	fields   map[string]interface{}
+	children []*testObject
+}
+
+func (o *testObject) typeName() string { return o.name }
+
+func (o *testObject) resolve(ctx context.Context, name string, args arguments) (interface{}, error) {
+	switch name {
+	case "children":
+		first, err := args.int("first")
+		if err != nil {
+			return nil, err
+		}
+		var list []object
+		for i, child := range o.children {
+			if first != nil && i >= *first {
+				break
+			}
+			list = append(list, child)
+		}
+		return list, nil
+	case "child":
+		index, err := args.long("index")
+		if err != nil {
+			return nil, err
+		}
+		if index == nil || *index >= uint64(len(o.children)) {
+			return nil, nil
+		}
+		return o.children[*index], nil
+	case "fail":
+		return nil, errors.New("resolver failed")
+	}
+	if val, ok := o.fields[name]; ok {
+		return val, nil
+	}
+	return nil, errUnknownField
+}
+
+var testRoot = &testObject{
+	name:   "Query",
+	fields: map[string]interface{}{"version": 1},
+	children: []*testObject{
+		{name: "Block", fields: map[string]interface{}{"number": 0, "hash": "0x00"}},
+		{name: "Block", fields: map[string]interface{}{"number": 1, "hash": "0x01"}},
+		{name: "Block", fields: map[string]interface{}{"number": 2, "hash": "0x02"}},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		query     string
+		operation string
+		variables map[string]interface{}
+		want      string
+	}{
+		// Shorthand queries, aliases and nested lists
+		{
+			query: `{ version }`,
+			want:  `{"data":{"version":1}}`,
+		},
+		{
+			query: `{ v: version, children(first: 2) { number } }`,
+			want:  `{"data":{"v":1,"children":[{"number":0},{"number":1}]}}`,
+		},
+		{
+			query: `# comment
+				query Test($index: Long = "0x2") { child(index: $index) { __typename number } }`,
+			want: `{"data":{"child":{"__typename":"Block","number":2}}}`,
+		},
+		{
+			query:     `query Test($index: Long!) { child(index: $index) { hash } }`,
+			variables: map[string]interface{}{"index": json.Number("1")},
+			want:      `{"data":{"child":{"hash":"0x01"}}}`,
+		},
+		{
+			query: `{ child(index: 10) { hash } }`,
+			want:  `{"data":{"child":null}}`,
+		},
+		// Fragments, directives and field merging
+		{
+			query: `{ child(index: 0) { ...blockFields ... on Block { hash } ... on Account { balance } } } fragment blockFields on Block { number hash }`,
+			want:  `{"data":{"child":{"number":0,"hash":"0x00"}}}`,
+		},
+		{
+			query:     `query($skip: Boolean!) { child(index: 1) { number @skip(if: $skip) hash @include(if: false) } }`,
+			variables: map[string]interface{}{"skip": false},
+			want:      `{"data":{"child":{"number":1}}}`,
+		},
+		{
+			query: `{ child(index: 1) { number } child(index: 1) { hash } }`,
+			want:  `{"data":{"child":{"number":1,"hash":"0x01"}}}`,
+		},
+		{
+			query:     `query A { version } query B { children(first: 1) { number } }`,
+			operation: "B",
+			want:      `{"data":{"children":[{"number":0}]}}`,
+		},
+		// Field errors retain partial results
+		{
+			query: `{ version fail }`,
+			want:  `{"data":{"version":1,"fail":null},"errors":[{"message":"resolver failed","path":["fail"]}]}`,
+		},
+		{
+			query: `{ children { number missing } }`,
+			want:  `{"data":{"children":[{"number":0,"missing":null},{"number":1,"missing":null},{"number":2,"missing":null}]},"errors":[{"message":"unknown field \"missing\" on type \"Block\"","path":["children",0,"missing"]},{"message":"unknown field \"missing\" on type \"Block\"","path":["children",1,"missing"]},{"message":"unknown field \"missing\" on type \"Block\"","path":["children",2,"missing"]}]}`,
+		},
+		{
+			query: `{ child(index: 0) }`,
+			want:  `{"data":{"child":null},"errors":[{"message":"field \"child\" of type \"Block\" must have a selection of subfields","path":["child"]}]}`,
+		},
+		{
+			query: `{ version { number } }`,
+			want:  `{"data":{"version":null},"errors":[{"message":"field \"version\" is a scalar and cannot have a selection","path":["version"]}]}`,
+		},
+		{
+			query: `{ child(index: "zero") { number } }`,
+			want:  `{"data":{"child":null},"errors":[{"message":"invalid index argument: strconv.ParseUint: parsing \"zero\": invalid syntax","path":["child"]}]}`,
+		},
+		// Request errors abort execution
+		{
+			query: `{ version`,
+			want:  `{"errors":[{"message":"syntax error: unexpected end of query, want name"}]}`,
+		},
+		{
+			query: `mutation { version }`,
+			want:  `{"errors":[{"message":"mutation operations are not supported"}]}`,
+		},
+		{
+			query: `query($index: Long!) { child(index: $index) { number } }`,
+			want:  `{"errors":[{"message":"variable $index is required"}]}`,
+		},
+		{
+			query: `query A { version } query B { version }`,
+			want:  `{"errors":[{"message":"operation name required for documents with multiple operations"}]}`,
+		},
+	}
+	for i, tt := range tests {
+		res := execute(context.Background(), testRoot, tt.query, tt.operation, tt.variables)
+		blob, err := json.Marshal(res)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode response: %v", i, err)
+		}
+		if string(blob) != tt.want {
+			t.Errorf("test %d: response mismatch:\nhave %s\nwant %s", i, blob, tt.want)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	doc, err := parse(`{ f(a: -12, b: 1.5e3, c: "x\nA", d: [true, null, ENUM], e: {k: $v}) }`)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+	f := doc.operations[0].selections[0].(*field)
+	args, err := (&executor{doc: doc, variables: map[string]interface{}{"v": "var"}}).arguments(f.arguments)
+	if err != nil {
+		t.Fatalf("failed to resolve arguments: %v", err)
+	}
+	blob, _ := json.Marshal(args)
+	if want := `{"a":-12,"b":1.5e3,"c":"x\nA","d":[true,null,"ENUM"],"e":{"k":"var"}}`; string(blob) != want {
+		t.Errorf("argument mismatch:\nhave %s\nwant %s", blob, want)
+	}
+}
@@ -0,0 +1,679 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind is the lexical class of a query token.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// token is a single lexical element of a query document.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexer splits a query document into tokens, skipping whitespace, commas and
+// comments which are insignificant in GraphQL.
+type lexer struct {
+	input string
+	pos   int
+}
+
+// next returns the next token of the input.
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' && l.input[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+	c := l.input[l.pos]
+	switch {
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunct, text: string(c), pos: start}, nil
+
+	case c == '.':
+		if !strings.HasPrefix(l.input[l.pos:], "...") {
+			return token{}, fmt.Errorf("unexpected character '.' at %d", start)
+		}
+		l.pos += 3
+		return token{kind: tokenPunct, text: "...", pos: start}, nil
+
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.input) && (l.input[l.pos] == '_' || isLetter(l.input[l.pos]) || isDigit(l.input[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, text: l.input[start:l.pos], pos: start}, nil
+
+	case c == '-' || isDigit(c):
+		return l.number()
+
+	case c == '"':
+		return l.string()
+	}
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+// number lexes an integer or float literal.
+func (l *lexer) number() (token, error) {
+	start, kind := l.pos, tokenInt
+	if l.input[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return token{}, fmt.Errorf("invalid number at %d", start)
+	}
+	if l.pos < len(l.input) && l.input[l.pos] == '.' {
+		l.pos++
+		if kind = tokenFloat; digits() == 0 {
+			return token{}, fmt.Errorf("invalid number at %d", start)
+		}
+	}
+	if l.pos < len(l.input) && (l.input[l.pos] == 'e' || l.input[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.input) && (l.input[l.pos] == '+' || l.input[l.pos] == '-') {
+			l.pos++
+		}
+		if kind = tokenFloat; digits() == 0 {
+			return token{}, fmt.Errorf("invalid number at %d", start)
+		}
+	}
+	return token{kind: kind, text: l.input[start:l.pos], pos: start}, nil
+}
+
+// string lexes a quoted string literal, resolving its escape sequences. Block
+// strings are not supported.
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.input[l.pos:], `"""`) {
+		return token{}, fmt.Errorf("block strings are not supported (at %d)", start)
+	}
+	l.pos++
+
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.input) {
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		}
+		c := l.input[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokenString, text: b.String(), pos: start}, nil
+
+		case c == '\n' || c == '\r':
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+
+		case c == '\\':
+			if l.pos+1 >= len(l.input) {
+				return token{}, fmt.Errorf("unterminated string at %d", start)
+			}
+			esc := l.input[l.pos+1]
+			l.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.input) {
+					return token{}, fmt.Errorf("invalid unicode escape at %d", l.pos-2)
+				}
+				r, err := strconv.ParseUint(l.input[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return token{}, fmt.Errorf("invalid unicode escape at %d", l.pos-2)
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				return token{}, fmt.Errorf("invalid escape sequence at %d", l.pos-2)
+			}
+
+		default:
+			r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+			b.WriteRune(r)
+			l.pos += size
+		}
+	}
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// document is a parsed query document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query definition within a document.
+type operation struct {
+	kind       string // Only "query" is supported for execution
+	name       string
+	variables  []*variableDef
+	selections []selection
+}
+
+// variableDef is the declaration of a variable used by an operation.
+type variableDef struct {
+	name     string
+	nonNull  bool
+	defaults value
+}
+
+// fragment is a named, reusable selection set.
+type fragment struct {
+	name       string
+	typeCond   string
+	selections []selection
+}
+
+// selection is an entry of a selection set: a field, a fragment spread or an
+// inline fragment.
+type selection interface{}
+
+// field is a selection requesting a field of an object.
+type field struct {
+	alias      string
+	name       string
+	arguments  map[string]value
+	directives []*directive
+	selections []selection
+}
+
+// responseKey returns the key of the field in the result object.
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// fragmentSpread is a selection including a named fragment.
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+}
+
+// inlineFragment is a selection including an anonymous fragment.
+type inlineFragment struct {
+	typeCond   string
+	directives []*directive
+	selections []selection
+}
+
+// directive is an annotation on a selection, only @skip and @include are
+// supported.
+type directive struct {
+	name      string
+	arguments map[string]value
+}
+
+// value is a literal argument value in a query document.
+type value interface{}
+
+// Literal types, numbers and strings are kept in their textual form until
+// coerced by a resolver.
+type (
+	intValue    string
+	floatValue  string
+	stringValue string
+	boolValue   bool
+	nullValue   struct{}
+	enumValue   string
+	variable    string
+	listValue   []value
+	objectValue map[string]value
+)
+
+// parser builds a document from the tokens of a query.
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+// parse parses a query document.
+func parse(query string) (*document, error) {
+	p := &parser{lexer: &lexer{input: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokenEOF {
+		if p.tok.kind == tokenName && p.tok.text == "fragment" {
+			frag, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, fmt.Errorf("duplicate fragment %q", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+			continue
+		}
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.operations = append(doc.operations, op)
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("no operation in query document")
+	}
+	return doc, nil
+}
+
+// advance moves to the next token.
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lexer.next()
+	return err
+}
+
+// peek returns whether the current token is the given punctuator.
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.text == punct
+}
+
+// expect consumes the given punctuator or fails.
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected(fmt.Sprintf("%q", punct))
+	}
+	return p.advance()
+}
+
+// name consumes a name token and returns it.
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected("name")
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// unexpected returns a syntax error for the current token.
+func (p *parser) unexpected(want string) error {
+	if p.tok.kind == tokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of query, want %s", want)
+	}
+	return fmt.Errorf("syntax error: unexpected %q at %d, want %s", p.tok.text, p.tok.pos, want)
+}
+
+func (p *parser) parseOperation() (*operation, error) {
+	// Shorthand query without operation type
+	if p.peek("{") {
+		sels, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		return &operation{kind: "query", selections: sels}, nil
+	}
+	kind, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if kind != "query" && kind != "mutation" && kind != "subscription" {
+		return nil, fmt.Errorf("syntax error: unknown operation type %q", kind)
+	}
+	op := &operation{kind: kind}
+	if p.tok.kind == tokenName {
+		if op.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if op.variables, err = p.parseVariableDefs(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) parseVariableDefs() ([]*variableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*variableDef
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		nonNull, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		def := &variableDef{name: name, nonNull: nonNull}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if def.defaults, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+// parseType skips over a type reference, returning whether it is non-null.
+// Variable values are coerced by the resolvers, so the type is not retained.
+func (p *parser) parseType() (bool, error) {
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return false, err
+		}
+		if _, err := p.parseType(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.peek("!") {
+		return true, p.advance()
+	}
+	return false, nil
+}
+
+func (p *parser) parseFragment() (*fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("syntax error: invalid fragment name %q", name)
+	}
+	if p.tok.kind != tokenName || p.tok.text != "on" {
+		return nil, p.unexpected(`"on"`)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	frag := &fragment{name: name}
+	if frag.typeCond, err = p.name(); err != nil {
+		return nil, err
+	}
+	if _, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) parseSelectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.peek("}") {
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.unexpected("selection")
+	}
+	return sels, p.advance()
+}
+
+func (p *parser) parseSelection() (selection, error) {
+	if p.peek("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		// Named fragment spread
+		if p.tok.kind == tokenName && p.tok.text != "on" {
+			spread := &fragmentSpread{name: p.tok.text}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			var err error
+			if spread.directives, err = p.parseDirectives(); err != nil {
+				return nil, err
+			}
+			return spread, nil
+		}
+		// Inline fragment, optionally with a type condition
+		frag := new(inlineFragment)
+		if p.tok.kind == tokenName {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			var err error
+			if frag.typeCond, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if frag.directives, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+		if frag.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+		return frag, nil
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name}
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if f.arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if f.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if f.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) parseArguments() (map[string]value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]value)
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, fmt.Errorf("duplicate argument %q", name)
+		}
+		if args[name], err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *parser) parseDirectives() ([]*directive, error) {
+	var dirs []*directive
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		dir := &directive{name: name}
+		if p.peek("(") {
+			if dir.arguments, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// parseValue parses a literal value. Variables are not allowed in constant
+// contexts like variable defaults.
+func (p *parser) parseValue(constant bool) (value, error) {
+	tok := p.tok
+	switch {
+	case p.peek("$"):
+		if constant {
+			return nil, p.unexpected("constant value")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := listValue{}
+		for !p.peek("]") {
+			val, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		return list, p.advance()
+
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := objectValue{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.parseValue(constant); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+
+	case tok.kind == tokenInt:
+		return intValue(tok.text), p.advance()
+
+	case tok.kind == tokenFloat:
+		return floatValue(tok.text), p.advance()
+
+	case tok.kind == tokenString:
+		return stringValue(tok.text), p.advance()
+
+	case tok.kind == tokenName:
+		switch tok.text {
+		case "true", "false":
+			return boolValue(tok.text == "true"), p.advance()
+		case "null":
+			return nullValue{}, p.advance()
+		}
+		return enumValue(tok.text), p.advance()
+	}
+	return nil, p.unexpected("value")
+}
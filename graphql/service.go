@@ -0,0 +1,147 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/p2p"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// maxRequestContentLength is the maximum size of a query request body.
+const maxRequestContentLength = 1024 * 128
+
+// request is the body of a GraphQL HTTP request.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handler serves GraphQL queries over HTTP.
+type handler struct {
+	query *Query
+}
+
+// NewHandler creates an HTTP handler executing GraphQL queries against the
+// given backend. Queries are accepted either as a JSON encoded POST body or
+// through the query, operationName and variables parameters of a GET request.
+func NewHandler(backend Backend) http.Handler {
+	return &handler{query: &Query{backend: backend}}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query, req.OperationName = params.Get("query"), params.Get("operationName")
+		if vars := params.Get("variables"); vars != "" {
+			if err := decodeJSON(strings.NewReader(vars), &req.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if r.ContentLength > maxRequestContentLength {
+			http.Error(w, fmt.Sprintf("content length too large (%d>%d)", r.ContentLength, maxRequestContentLength), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := decodeJSON(io.LimitReader(r.Body, maxRequestContentLength), &req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	response := execute(r.Context(), h.query, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("content-type", "application/json")
+	if response.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Debug("Failed to write GraphQL response", "err", err)
+	}
+}
+
+// decodeJSON decodes a JSON value retaining numbers in their textual form, as
+// expected by the argument coercion of the resolvers.
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Service is a node service exposing the GraphQL endpoint on its own HTTP
+// listener alongside the JSON-RPC one.
+type Service struct {
+	endpoint string
+	cors     []string
+	vhosts   []string
+	backend  Backend
+	listener net.Listener
+}
+
+// New creates a GraphQL service listening on the given endpoint.
+func New(backend Backend, endpoint string, cors, vhosts []string) (*Service, error) {
+	return &Service{endpoint: endpoint, cors: cors, vhosts: vhosts, backend: backend}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the GraphQL service (nil as it doesn't use the devp2p overlay network).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// GraphQL service (nil as it provides the GraphQL endpoint only).
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting up the GraphQL HTTP listener.
+func (s *Service) Start(server *p2p.Server) error {
+	listener, err := net.Listen("tcp", s.endpoint)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go (&http.Server{Handler: rpc.NewHTTPHandlerStack(NewHandler(s.backend), s.cors, s.vhosts)}).Serve(listener)
+
+	log.Info("GraphQL endpoint opened", "url", fmt.Sprintf("http://%s", s.endpoint))
+	return nil
+}
+
+// Stop implements node.Service, terminating the GraphQL HTTP listener.
+func (s *Service) Stop() error {
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+		log.Info("GraphQL endpoint closed", "url", fmt.Sprintf("http://%s", s.endpoint))
+	}
+	return nil
+}
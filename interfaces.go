@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core/types"
@@ -103,6 +104,11 @@ type SyncProgress struct {
 	HighestBlock  uint64 // Highest alleged block number in the chain
 	PulledStates  uint64 // Number of state trie entries already downloaded
 	KnownStates   uint64 // Total number of state trie entries known about
+
+	PulledStateBytes uint64        // Number of state trie bytes already downloaded
+	HealedStates     uint64        // Number of state trie entries re-downloaded while healing the pivot state
+	HealingStates    uint64        // Number of state trie entries still to be healed
+	ETA              time.Duration // Estimated time until the highest block is reached (0 if unknown)
 }
 
 // ChainSyncReader wraps access to the node's current sync status. If there's no
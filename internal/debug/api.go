@@ -22,6 +22,7 @@ package debug
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/user"
@@ -48,6 +49,53 @@ type HandlerT struct {
 	cpuFile   string
 	traceW    io.WriteCloser
 	traceFile string
+
+	allowed map[string]bool // Diagnostics methods callable over RPC, nil permits all
+}
+
+// errNotAllowed is returned when a diagnostics method is not on the allowlist.
+var errNotAllowed = errors.New("debug method not allowed")
+
+// diagnostics lists the RPC names of the methods guarded by the allowlist.
+var diagnostics = []string{
+	"cpuProfile", "startCPUProfile", "goTrace", "startGoTrace",
+	"blockProfile", "writeBlockProfile", "mutexProfile", "writeMutexProfile",
+	"writeMemProfile", "memStats", "gcStats", "stacks",
+}
+
+// SetAllowlist restricts the diagnostics methods callable over RPC to the given
+// names (e.g. "cpuProfile", "stacks"), blank names are ignored. An empty list
+// denies all of them, without an allowlist every method is permitted. It is
+// meant to be called once at startup, before the RPC endpoints are opened.
+func (h *HandlerT) SetAllowlist(methods []string) error {
+	allowed := make(map[string]bool)
+	for _, method := range methods {
+		method = strings.TrimSpace(method)
+		if method == "" {
+			continue
+		}
+		known := false
+		for _, name := range diagnostics {
+			if name == method {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown debug method %q", method)
+		}
+		allowed[method] = true
+	}
+	h.allowed = allowed
+	return nil
+}
+
+// allow checks whether the given diagnostics method may be called.
+func (h *HandlerT) allow(method string) error {
+	if h.allowed != nil && !h.allowed[method] {
+		return errNotAllowed
+	}
+	return nil
 }
 
 // Verbosity sets the log verbosity ceiling. The verbosity of individual packages
@@ -56,6 +104,12 @@ func (*HandlerT) Verbosity(level int) {
 	glogger.Verbosity(log.Lvl(level))
 }
 
+// SetVerbosity is an alias of Verbosity, adjusting the log verbosity ceiling of
+// a running node.
+func (h *HandlerT) SetVerbosity(level int) {
+	h.Verbosity(level)
+}
+
 // Vmodule sets the log verbosity pattern. See package log for details on the
 // pattern syntax.
 func (*HandlerT) Vmodule(pattern string) error {
@@ -69,23 +123,32 @@ func (*HandlerT) BacktraceAt(location string) error {
 }
 
 // MemStats returns detailed runtime memory statistics.
-func (*HandlerT) MemStats() *runtime.MemStats {
+func (h *HandlerT) MemStats() (*runtime.MemStats, error) {
+	if err := h.allow("memStats"); err != nil {
+		return nil, err
+	}
 	s := new(runtime.MemStats)
 	runtime.ReadMemStats(s)
-	return s
+	return s, nil
 }
 
 // GcStats returns GC statistics.
-func (*HandlerT) GcStats() *debug.GCStats {
+func (h *HandlerT) GcStats() (*debug.GCStats, error) {
+	if err := h.allow("gcStats"); err != nil {
+		return nil, err
+	}
 	s := new(debug.GCStats)
 	debug.ReadGCStats(s)
-	return s
+	return s, nil
 }
 
 // CpuProfile turns on CPU profiling for nsec seconds and writes
 // profile data to file.
 func (h *HandlerT) CpuProfile(file string, nsec uint) error {
-	if err := h.StartCPUProfile(file); err != nil {
+	if err := h.allow("cpuProfile"); err != nil {
+		return err
+	}
+	if err := h.startCPUProfile(file); err != nil {
 		return err
 	}
 	time.Sleep(time.Duration(nsec) * time.Second)
@@ -95,6 +158,13 @@ func (h *HandlerT) CpuProfile(file string, nsec uint) error {
 
 // StartCPUProfile turns on CPU profiling, writing to the given file.
 func (h *HandlerT) StartCPUProfile(file string) error {
+	if err := h.allow("startCPUProfile"); err != nil {
+		return err
+	}
+	return h.startCPUProfile(file)
+}
+
+func (h *HandlerT) startCPUProfile(file string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if h.cpuW != nil {
@@ -132,7 +202,10 @@ func (h *HandlerT) StopCPUProfile() error {
 // GoTrace turns on tracing for nsec seconds and writes
 // trace data to file.
 func (h *HandlerT) GoTrace(file string, nsec uint) error {
-	if err := h.StartGoTrace(file); err != nil {
+	if err := h.allow("goTrace"); err != nil {
+		return err
+	}
+	if err := h.startGoTrace(file); err != nil {
 		return err
 	}
 	time.Sleep(time.Duration(nsec) * time.Second)
@@ -143,7 +216,10 @@ func (h *HandlerT) GoTrace(file string, nsec uint) error {
 // BlockProfile turns on goroutine profiling for nsec seconds and writes profile data to
 // file. It uses a profile rate of 1 for most accurate information. If a different rate is
 // desired, set the rate and write the profile manually.
-func (*HandlerT) BlockProfile(file string, nsec uint) error {
+func (h *HandlerT) BlockProfile(file string, nsec uint) error {
+	if err := h.allow("blockProfile"); err != nil {
+		return err
+	}
 	runtime.SetBlockProfileRate(1)
 	time.Sleep(time.Duration(nsec) * time.Second)
 	defer runtime.SetBlockProfileRate(0)
@@ -157,14 +233,20 @@ func (*HandlerT) SetBlockProfileRate(rate int) {
 }
 
 // WriteBlockProfile writes a goroutine blocking profile to the given file.
-func (*HandlerT) WriteBlockProfile(file string) error {
+func (h *HandlerT) WriteBlockProfile(file string) error {
+	if err := h.allow("writeBlockProfile"); err != nil {
+		return err
+	}
 	return writeProfile("block", file)
 }
 
 // MutexProfile turns on mutex profiling for nsec seconds and writes profile data to file.
 // It uses a profile rate of 1 for most accurate information. If a different rate is
 // desired, set the rate and write the profile manually.
-func (*HandlerT) MutexProfile(file string, nsec uint) error {
+func (h *HandlerT) MutexProfile(file string, nsec uint) error {
+	if err := h.allow("mutexProfile"); err != nil {
+		return err
+	}
 	runtime.SetMutexProfileFraction(1)
 	time.Sleep(time.Duration(nsec) * time.Second)
 	defer runtime.SetMutexProfileFraction(0)
@@ -177,22 +259,31 @@ func (*HandlerT) SetMutexProfileFraction(rate int) {
 }
 
 // WriteMutexProfile writes a goroutine blocking profile to the given file.
-func (*HandlerT) WriteMutexProfile(file string) error {
+func (h *HandlerT) WriteMutexProfile(file string) error {
+	if err := h.allow("writeMutexProfile"); err != nil {
+		return err
+	}
 	return writeProfile("mutex", file)
 }
 
 // WriteMemProfile writes an allocation profile to the given file.
 // Note that the profiling rate cannot be set through the API,
 // it must be set on the command line.
-func (*HandlerT) WriteMemProfile(file string) error {
+func (h *HandlerT) WriteMemProfile(file string) error {
+	if err := h.allow("writeMemProfile"); err != nil {
+		return err
+	}
 	return writeProfile("heap", file)
 }
 
 // Stacks returns a printed representation of the stacks of all goroutines.
-func (*HandlerT) Stacks() string {
+func (h *HandlerT) Stacks() (string, error) {
+	if err := h.allow("stacks"); err != nil {
+		return "", err
+	}
 	buf := make([]byte, 1024*1024)
 	buf = buf[:runtime.Stack(buf, true)]
-	return string(buf)
+	return string(buf), nil
 }
 
 // FreeOSMemory returns unused memory to the OS.
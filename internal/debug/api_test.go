@@ -0,0 +1,59 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package debug
+
+import "testing"
+
+// Tests that the diagnostics allowlist rejects methods not listed on it and
+// denies everything once it is emptied.
+func TestAllowlist(t *testing.T) {
+	h := new(HandlerT)
+	if _, err := h.GcStats(); err != nil {
+		t.Errorf("gcStats rejected without allowlist: %v", err)
+	}
+	if err := h.SetAllowlist([]string{"memStats", " stacks"}); err != nil {
+		t.Fatalf("failed to set allowlist: %v", err)
+	}
+	if _, err := h.MemStats(); err != nil {
+		t.Errorf("memStats rejected: %v", err)
+	}
+	if _, err := h.Stacks(); err != nil {
+		t.Errorf("stacks rejected: %v", err)
+	}
+	if _, err := h.GcStats(); err != errNotAllowed {
+		t.Errorf("gcStats error mismatch: have %v, want %v", err, errNotAllowed)
+	}
+	if err := h.CpuProfile("cpu.prof", 0); err != errNotAllowed {
+		t.Errorf("cpuProfile error mismatch: have %v, want %v", err, errNotAllowed)
+	}
+	if err := h.SetAllowlist([]string{"freeOSMemory"}); err == nil {
+		t.Errorf("unknown method accepted")
+	}
+	if _, err := h.MemStats(); err != nil {
+		t.Errorf("memStats rejected after failed update: %v", err)
+	}
+	for _, methods := range [][]string{nil, {""}, {" ", ""}} {
+		if err := h.SetAllowlist(methods); err != nil {
+			t.Fatalf("failed to empty allowlist with %q: %v", methods, err)
+		}
+		for _, method := range diagnostics {
+			if err := h.allow(method); err != errNotAllowed {
+				t.Errorf("%s error mismatch with %q: have %v, want %v", method, methods, err, errNotAllowed)
+			}
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/log/term"
@@ -46,6 +47,11 @@ var (
 		Usage: "Per-module verbosity: comma-separated list of <pattern>=<level> (e.g. man/*=5,p2p=4)",
 		Value: "",
 	}
+	logFormatFlag = cli.StringFlag{
+		Name:  "log.format",
+		Usage: "Log output format (terminal, logfmt, json)",
+		Value: "terminal",
+	}
 	backtraceAtFlag = cli.StringFlag{
 		Name:  "backtrace",
 		Usage: "Request a stack trace at a specific logging statement (e.g. \"block.go:271\")",
@@ -86,13 +92,18 @@ var (
 		Name:  "trace",
 		Usage: "Write execution trace to the given file",
 	}
+	allowFlag = cli.StringFlag{
+		Name:  "debug.allow",
+		Usage: "Comma separated list of diagnostics RPCs that may be called (e.g. memStats,stacks), empty denies all",
+		Value: "",
+	}
 )
 
 // Flags holds all command-line flags required for debugging.
 var Flags = []cli.Flag{
-	verbosityFlag, vmoduleFlag, backtraceAtFlag, debugFlag,
+	verbosityFlag, vmoduleFlag, logFormatFlag, backtraceAtFlag, debugFlag,
 	pprofFlag, pprofAddrFlag, pprofPortFlag,
-	memprofilerateFlag, blockprofilerateFlag, cpuprofileFlag, traceFlag,
+	memprofilerateFlag, blockprofilerateFlag, cpuprofileFlag, traceFlag, allowFlag,
 }
 
 var (
@@ -100,6 +111,20 @@ var (
 	glogger *log.GlogHandler
 )
 
+// logFormat resolves the name of a log output format. Terminal output is only
+// colored when writing to a tty.
+func logFormat(name string, usecolor bool) (log.Format, error) {
+	switch name {
+	case "", "terminal":
+		return log.TerminalFormat(usecolor), nil
+	case "logfmt":
+		return log.LogfmtFormat(), nil
+	case "json":
+		return log.JSONFormat(), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, want terminal, logfmt or json", name)
+}
+
 func init() {
 	usecolor := term.IsTty(os.Stderr.Fd()) && os.Getenv("TERM") != "dumb"
 
@@ -117,12 +142,25 @@ func init() {
 func Setup(ctx *cli.Context, logdir string) error {
 	// logging
 	log.PrintOrigins(ctx.GlobalBool(debugFlag.Name))
+	format := ctx.GlobalString(logFormatFlag.Name)
+	if format != "" && format != "terminal" {
+		// Machine readable output is never colored, write it to stderr directly
+		fmtr, err := logFormat(format, false)
+		if err != nil {
+			return err
+		}
+		ostream = log.StreamHandler(os.Stderr, fmtr)
+		glogger.SetHandler(ostream)
+	}
 	if logdir != "" {
+		fileFormat, err := logFormat(format, false)
+		if err != nil {
+			return err
+		}
 		rfh, err := log.RotatingFileHandler(
 			logdir,
 			1024*1024*1024*2, //262144,
-			/*log.JSONFormatOrderedEx(false, true),*/
-			log.TerminalFormat(false),
+			fileFormat,
 		)
 		if err != nil {
 			return err
@@ -147,6 +185,11 @@ func Setup(ctx *cli.Context, logdir string) error {
 			return err
 		}
 	}
+	if ctx.GlobalIsSet(allowFlag.Name) {
+		if err := Handler.SetAllowlist(strings.Split(ctx.GlobalString(allowFlag.Name), ",")); err != nil {
+			return err
+		}
+	}
 
 	// pprof server
 	if ctx.GlobalBool(pprofFlag.Name) {
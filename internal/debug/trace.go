@@ -28,6 +28,13 @@ import (
 
 // StartGoTrace turns on tracing, writing to the given file.
 func (h *HandlerT) StartGoTrace(file string) error {
+	if err := h.allow("startGoTrace"); err != nil {
+		return err
+	}
+	return h.startGoTrace(file)
+}
+
+func (h *HandlerT) startGoTrace(file string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if h.traceW != nil {
@@ -26,6 +26,10 @@ func (*HandlerT) StartGoTrace(string) error {
 	return errors.New("tracing is not supported on Go < 1.5")
 }
 
+func (*HandlerT) startGoTrace(string) error {
+	return errors.New("tracing is not supported on Go < 1.5")
+}
+
 func (*HandlerT) StopGoTrace() error {
 	return errors.New("tracing is not supported on Go < 1.5")
 }
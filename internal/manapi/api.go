@@ -22,14 +22,15 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/util"
 
 	"github.com/matrix/go-matrix/accounts"
+	"github.com/matrix/go-matrix/accounts/abi"
 	"github.com/matrix/go-matrix/accounts/keystore"
 	"github.com/matrix/go-matrix/ca"
 	"github.com/matrix/go-matrix/common"
@@ -38,10 +39,12 @@ import (
 	"github.com/matrix/go-matrix/consensus/manash"
 	"github.com/matrix/go-matrix/core"
 	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/core/vm"
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/mc"
 	"github.com/matrix/go-matrix/p2p"
 	"github.com/matrix/go-matrix/params"
@@ -69,6 +72,36 @@ func (s *PublicMatrixAPI) GasPrice(ctx context.Context) (*big.Int, error) {
 	return s.b.SuggestPrice(ctx)
 }
 
+type feeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory returns the gas price history of the blockCount blocks up to and
+// including lastBlock, reporting for each block its gas used ratio and the gas
+// prices paid at the given percentiles of its gas usage.
+func (s *PublicMatrixAPI) FeeHistory(ctx context.Context, blockCount hexutil.Uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryResult, error) {
+	oldest, reward, gasUsed, err := s.b.FeeHistory(ctx, uint64(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	results := &feeHistoryResult{
+		OldestBlock:  (*hexutil.Big)(oldest),
+		GasUsedRatio: gasUsed,
+	}
+	if reward != nil {
+		results.Reward = make([][]*hexutil.Big, len(reward))
+		for i, w := range reward {
+			results.Reward[i] = make([]*hexutil.Big, len(w))
+			for j, v := range w {
+				results.Reward[i][j] = (*hexutil.Big)(v)
+			}
+		}
+	}
+	return results, nil
+}
+
 // ProtocolVersion returns the current Matrix protocol version this node supports
 func (s *PublicMatrixAPI) ProtocolVersion() hexutil.Uint {
 	return hexutil.Uint(s.b.ProtocolVersion())
@@ -89,13 +122,20 @@ func (s *PublicMatrixAPI) Syncing() (interface{}, error) {
 		return false, nil
 	}
 	// Otherwise gather the block sync stats
-	return map[string]interface{}{
-		"startingBlock": hexutil.Uint64(progress.StartingBlock),
-		"currentBlock":  hexutil.Uint64(progress.CurrentBlock),
-		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
-		"pulledStates":  hexutil.Uint64(progress.PulledStates),
-		"knownStates":   hexutil.Uint64(progress.KnownStates),
-	}, nil
+	fields := map[string]interface{}{
+		"startingBlock":    hexutil.Uint64(progress.StartingBlock),
+		"currentBlock":     hexutil.Uint64(progress.CurrentBlock),
+		"highestBlock":     hexutil.Uint64(progress.HighestBlock),
+		"pulledStates":     hexutil.Uint64(progress.PulledStates),
+		"knownStates":      hexutil.Uint64(progress.KnownStates),
+		"pulledStateBytes": hexutil.Uint64(progress.PulledStateBytes),
+		"healedStates":     hexutil.Uint64(progress.HealedStates),
+		"healingStates":    hexutil.Uint64(progress.HealingStates),
+	}
+	if progress.ETA > 0 {
+		fields["eta"] = progress.ETA.Round(time.Second).String()
+	}
+	return fields, nil
 }
 
 // PublicTxPoolAPI offers and API for the transaction pool. It only operates on data that is non confidential.
@@ -120,7 +160,7 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -128,13 +168,94 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
 	return content
 }
 
+// ContentFrom returns the transactions contained within the transaction pool
+// sent by the given address.
+func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) map[string]map[string]*RPCTransaction {
+	content := make(map[string]map[string]*RPCTransaction, 2)
+	pending, queue := s.b.TxPoolContentFrom(addr)
+
+	// Build the pending transactions
+	dump := make(map[string]*RPCTransaction, len(pending))
+	for _, tx := range pending {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	content["pending"] = dump
+
+	// Build the queued transactions
+	dump = make(map[string]*RPCTransaction, len(queue))
+	for _, tx := range queue {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	content["queued"] = dump
+
+	return content
+}
+
+// RPCNonceGap is an inclusive range of nonces missing from the pool.
+type RPCNonceGap struct {
+	From hexutil.Uint64 `json:"from"`
+	To   hexutil.Uint64 `json:"to"`
+}
+
+// RPCNonceGaps reports the queued transactions of an account that can't execute
+// because of nonces missing from the pool below them.
+type RPCNonceGaps struct {
+	Next    hexutil.Uint64         `json:"next"`    // Nonce the pool expects next from the account
+	Gaps    []RPCNonceGap          `json:"gaps"`    // Ranges of missing nonces, in increasing order
+	Blocked map[string]common.Hash `json:"blocked"` // Hashes of the blocked transactions by nonce
+}
+
+// NonceGaps reports, per sender, the queued transactions blocked by nonce gaps
+// along with the missing nonces. If an address is given, only its transactions
+// are inspected, otherwise all accounts with queued transactions. Accounts with
+// no gaps are omitted.
+func (s *PublicTxPoolAPI) NonceGaps(ctx context.Context, addr *common.Address) (map[string]*RPCNonceGaps, error) {
+	queues := make(map[common.Address]types.Transactions)
+	if addr != nil {
+		_, queued := s.b.TxPoolContentFrom(*addr)
+		queues[*addr] = queued
+	} else {
+		_, queues = s.b.TxPoolContent()
+	}
+	reports := make(map[string]*RPCNonceGaps)
+	for account, queued := range queues {
+		if len(queued) == 0 {
+			continue
+		}
+		next, err := s.b.GetPoolNonce(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(types.TxByNonce(queued))
+
+		gaps := core.NonceGaps(next, queued)
+		if len(gaps) == 0 {
+			continue
+		}
+		report := &RPCNonceGaps{
+			Next:    hexutil.Uint64(next),
+			Blocked: make(map[string]common.Hash),
+		}
+		for _, gap := range gaps {
+			report.Gaps = append(report.Gaps, RPCNonceGap{From: hexutil.Uint64(gap.From), To: hexutil.Uint64(gap.To)})
+		}
+		for _, tx := range queued {
+			if tx.Nonce() > gaps[0].From {
+				report.Blocked[fmt.Sprintf("%d", tx.Nonce())] = tx.Hash()
+			}
+		}
+		reports[account.Hex()] = report
+	}
+	return reports, nil
+}
+
 // Status returns the number of pending and queued transaction in the pool.
 func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	pending, queue := s.b.Stats()
@@ -305,6 +426,50 @@ func fetchKeystore(am *accounts.Manager) *keystore.KeyStore {
 	return am.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 }
 
+// rpcTransport returns the network transport an RPC request arrived over, "http"
+// or "ws", or an empty string for the local IPC and in-process transports.
+func rpcTransport(ctx context.Context) string {
+	transport, _ := ctx.Value("transport").(string)
+	return transport
+}
+
+// rpcCaller describes the origin of an RPC request for audit purposes. Only the
+// network transports annotate requests with the remote address.
+func rpcCaller(ctx context.Context) string {
+	remote, _ := ctx.Value("remote").(string)
+	if transport := rpcTransport(ctx); transport != "" && remote != "" {
+		return transport + "://" + remote
+	}
+	return "NA"
+}
+
+// auditSign records a signing request in the audit log of the account manager,
+// if auditing is enabled.
+func auditSign(ctx context.Context, am *accounts.Manager, method string, addr common.Address, hash common.Hash, err error) {
+	audit := am.AuditLog()
+	if audit == nil {
+		return
+	}
+	var fields []interface{}
+	if hash != (common.Hash{}) {
+		fields = append(fields, "hash", hash)
+	}
+	if err != nil {
+		fields = append(fields, "err", err)
+	}
+	audit.Record(rpcCaller(ctx), method, addr, fields...)
+}
+
+// auditSignedTx records a transaction signing request, identifying it by the
+// hash of the signed transaction.
+func auditSignedTx(ctx context.Context, am *accounts.Manager, method string, addr common.Address, signed *types.Transaction, err error) {
+	var hash common.Hash
+	if signed != nil {
+		hash = signed.Hash()
+	}
+	auditSign(ctx, am, method, addr, hash, err)
+}
+
 // ImportRawKey stores the given hex encoded ECDSA key into the key directory,
 // encrypting it with the passphrase.
 func (s *PrivateAccountAPI) ImportRawKey(privkey string, password string) (common.Address, error) {
@@ -319,7 +484,11 @@ func (s *PrivateAccountAPI) ImportRawKey(privkey string, password string) (commo
 // UnlockAccount will unlock the account associated with the given address with
 // the given password for duration seconds. If duration is nil it will use a
 // default of 300 seconds. It returns an indication if the account was unlocked.
-func (s *PrivateAccountAPI) UnlockAccount(addr common.Address, password string, duration *uint64) (bool, error) {
+//
+// Indefinite unlocks (a duration of 0) are refused over HTTP and WebSocket, and
+// if the node is configured with an unlock limit, longer durations are capped to
+// it.
+func (s *PrivateAccountAPI) UnlockAccount(ctx context.Context, addr common.Address, password string, duration *uint64) (bool, error) {
 	const max = uint64(time.Duration(math.MaxInt64) / time.Second)
 	var d time.Duration
 	if duration == nil {
@@ -329,13 +498,31 @@ func (s *PrivateAccountAPI) UnlockAccount(addr common.Address, password string,
 	} else {
 		d = time.Duration(*duration) * time.Second
 	}
-	err := fetchKeystore(s.am).TimedUnlock(accounts.Account{Address: addr}, password, d)
+	ks := fetchKeystore(s.am)
+	if limit := ks.UnlockLimit(); limit > 0 && (d == 0 || d > limit) {
+		d = limit
+	}
+	if transport := rpcTransport(ctx); transport != "" && d == 0 {
+		return false, fmt.Errorf("indefinite unlock not allowed over %s", transport)
+	}
+	err := ks.TimedUnlock(accounts.Account{Address: addr}, password, d)
+	if audit := s.am.AuditLog(); audit != nil {
+		fields := []interface{}{"duration", d}
+		if err != nil {
+			fields = append(fields, "err", err)
+		}
+		audit.Record(rpcCaller(ctx), "personal_unlockAccount", addr, fields...)
+	}
 	return err == nil, err
 }
 
 // LockAccount will lock the account associated with the given address when it's unlocked.
-func (s *PrivateAccountAPI) LockAccount(addr common.Address) bool {
-	return fetchKeystore(s.am).Lock(addr) == nil
+func (s *PrivateAccountAPI) LockAccount(ctx context.Context, addr common.Address) bool {
+	err := fetchKeystore(s.am).Lock(addr)
+	if audit := s.am.AuditLog(); audit != nil {
+		audit.Record(rpcCaller(ctx), "personal_lockAccount", addr)
+	}
+	return err == nil
 }
 
 // signTransactions sets defaults and signs the given transaction
@@ -373,6 +560,7 @@ func (s *PrivateAccountAPI) SendTransaction(ctx context.Context, args SendTxArgs
 		defer s.nonceLock.UnlockAddr(args.From)
 	}
 	signed, err := s.signTransaction(ctx, args, passwd)
+	auditSignedTx(ctx, s.am, "personal_sendTransaction", args.From, signed, err)
 	if err != nil {
 		return common.Hash{}, err
 	}
@@ -396,6 +584,7 @@ func (s *PrivateAccountAPI) SignTransaction(ctx context.Context, args SendTxArgs
 		return nil, fmt.Errorf("nonce not specified")
 	}
 	signed, err := s.signTransaction(ctx, args, passwd)
+	auditSignedTx(ctx, s.am, "personal_signTransaction", args.From, signed, err)
 	if err != nil {
 		return nil, err
 	}
@@ -436,7 +625,9 @@ func (s *PrivateAccountAPI) Sign(ctx context.Context, data hexutil.Bytes, addr c
 		return nil, err
 	}
 	// Assemble sign the data with the wallet
-	signature, err := wallet.SignHashWithPassphrase(account, passwd, signHash(data))
+	sighash := signHash(data)
+	signature, err := wallet.SignHashWithPassphrase(account, passwd, sighash)
+	auditSign(ctx, s.am, "personal_sign", addr, common.BytesToHash(sighash), err)
 	if err != nil {
 		return nil, err
 	}
@@ -606,6 +797,84 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res[:], state.Error()
 }
 
+// AccountResult is the Merkle proof of an account and a set of its storage
+// slots in the state of a block.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the Merkle proof of a storage slot.
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// GetProof returns the Merkle proof of the given account and storage keys in
+// the state at the given block number, verifiable against the state root of
+// the block header.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	storageTrie := state.StorageTrie(address)
+	storageHash := types.EmptyRootHash
+	codeHash := state.GetCodeHash(address)
+	storageProof := make([]StorageResult, len(storageKeys))
+
+	// If we have a storage trie, the account exists and we must update the
+	// storage root and code hash
+	if storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	} else {
+		// No storage trie means the account does not exist, so the code hash
+		// is the hash of an empty bytearray
+		codeHash = crypto.Keccak256Hash(nil)
+	}
+	// Create the proofs for the storage keys
+	for i, key := range storageKeys {
+		if storageTrie != nil {
+			proof, err := state.GetStorageProof(address, common.HexToHash(key))
+			if err != nil {
+				return nil, err
+			}
+			storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, common.HexToHash(key)).Big()), toHexSlice(proof)}
+		} else {
+			storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
+		}
+	}
+	// Create the account proof
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// toHexSlice creates a slice of hex-strings based on []byte.
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
+
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
 	From     common.Address  `json:"from"`
@@ -616,30 +885,100 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, bool, error) {
+// OverrideAccount indicates the overriding fields of account during the execution
+// of a message call. State and StateDiff are mutually exclusive: the former
+// replaces the entire storage of the account, the latter only patches the given
+// slots on top of the existing storage.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   **hexutil.Big                `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply overrides the fields of specified accounts into the given state.
+func (diff *StateOverride) Apply(statedb *state.StateDB) error {
+	if diff == nil {
+		return nil
+	}
+	for addr, account := range *diff {
+		// Override account nonce.
+		if account.Nonce != nil {
+			statedb.SetNonce(addr, uint64(*account.Nonce))
+		}
+		// Override account(contract) code.
+		if account.Code != nil {
+			statedb.SetCode(addr, *account.Code)
+		}
+		// Override account balance.
+		if account.Balance != nil {
+			statedb.SetBalance(addr, (*big.Int)(*account.Balance))
+		}
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		// Replace entire state if caller requires.
+		if account.State != nil {
+			statedb.SetStorage(addr, *account.State)
+		}
+		// Apply state diff into specified accounts.
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				statedb.SetState(addr, key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// callSender returns the sender of a call, defaulting to the first local account
+// if none was specified.
+func (s *PublicBlockChainAPI) callSender(args CallArgs) common.Address {
+	if args.From != (common.Address{}) {
+		return args.From
+	}
+	if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+		if accounts := wallets[0].Accounts(); len(accounts) > 0 {
+			return accounts[0].Address
+		}
+	}
+	return common.Address{}
+}
+
+// callGasPrice returns the gas price of a call, defaulting to defaultGasPrice if
+// none was specified.
+func callGasPrice(args CallArgs) *big.Int {
+	if price := args.GasPrice.ToInt(); price.Sign() != 0 {
+		return price
+	}
+	return new(big.Int).SetUint64(defaultGasPrice)
+}
+
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, bool, error) {
 	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-	if state == nil || err != nil {
+	if err != nil {
 		return nil, 0, false, err
 	}
-	// Set sender address or use a default if none specified
-	addr := args.From
-	if addr == (common.Address{}) {
-		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
-			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
-				addr = accounts[0].Address
-			}
-		}
+	if state == nil {
+		return nil, 0, false, newNotFoundError("header for block %s not found", rpc.FormatBlockNumber(blockNr))
 	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, 0, false, err
+	}
+	// Set sender address or use a default if none specified
+	addr := s.callSender(args)
+
 	// Set default gas & gas price if none were set
-	gas, gasPrice := uint64(args.Gas), args.GasPrice.ToInt()
+	gas, gasPrice := uint64(args.Gas), callGasPrice(args)
 	if gas == 0 {
 		gas = math.MaxUint64 / 2
 	}
-	if gasPrice.Sign() == 0 {
-		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
-	}
 
 	// Create new call message
 	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
@@ -680,14 +1019,50 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
-	return (hexutil.Bytes)(result), err
+// The optional overrides are applied to a throwaway copy of the state before execution.
+// A revert is reported as an error carrying the revert data.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride) (hexutil.Bytes, error) {
+	result, _, failed, err := s.doCall(ctx, args, blockNr, overrides, vm.Config{}, 5*time.Second)
+	if err != nil {
+		return nil, newCallError(err)
+	}
+	if failed && len(result) > 0 {
+		return nil, newRevertError(result)
+	}
+	return (hexutil.Bytes)(result), nil
+}
+
+// accessListResult is the result of an access list generation.
+type accessListResult struct {
+	AccessList vm.AccessList  `json:"accessList"`
+	Error      string         `json:"error,omitempty"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+}
+
+// CreateAccessList executes the given transaction on the state of the given block,
+// the pending one by default, and returns the accounts and storage slots it
+// accessed along with the gas it used.
+func (s *PublicBlockChainAPI) CreateAccessList(ctx context.Context, args CallArgs, blockNr *rpc.BlockNumber) (*accessListResult, error) {
+	number := rpc.PendingBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	tracer := vm.NewAccessListTracer()
+	res, gas, failed, err := s.doCall(ctx, args, number, nil, vm.Config{Debug: true, Tracer: tracer}, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	result := &accessListResult{AccessList: tracer.AccessList(), GasUsed: hexutil.Uint64(gas)}
+	if failed {
+		result.Error = newRevertError(res).Error()
+	}
+	return result, nil
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the
-// given transaction against the current pending block.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
+// given transaction against the current pending block, with the optional state
+// overrides applied.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, overrides *StateOverride) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo  uint64 = params.TxGas - 1
@@ -704,33 +1079,64 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 		}
 		hi = block.GasLimit()
 	}
+	// Recap the highest gas limit with the sender's balance, as any allowance
+	// above it fails buying the gas rather than executing the call
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.PendingBlockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, newNotFoundError("pending state not found")
+	}
+	if err := overrides.Apply(state); err != nil {
+		return 0, err
+	}
+	allowance := new(big.Int).Div(state.GetBalance(s.callSender(args)), callGasPrice(args))
+	if allowance.IsUint64() && hi > allowance.Uint64() {
+		log.Warn("Gas estimation capped by limited funds", "original", hi, "allowance", allowance)
+		hi = allowance.Uint64()
+	}
 	cap = hi
 
-	// Create a helper to check if a gas allowance results in an executable transaction
-	executable := func(gas uint64) bool {
+	// Create a helper to check if a gas allowance results in an executable transaction.
+	// Running out of gas only flags the allowance as too low, any other error aborts.
+	executable := func(gas uint64) (bool, []byte, error) {
 		args.Gas = hexutil.Uint64(gas)
 
-		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{}, 0)
-		if err != nil || failed {
-			return false
+		res, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, overrides, vm.Config{}, 0)
+		if err != nil {
+			if err == vm.ErrOutOfGas {
+				return true, nil, nil
+			}
+			return true, nil, newCallError(err)
 		}
-		return true
+		return failed, res, nil
+	}
+	// Reject the transaction up front if it fails even at the highest allowance,
+	// reporting the revert reason if it reverted rather than ran out of gas
+	failed, res, err := executable(cap)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		if len(res) > 0 {
+			return 0, newRevertError(res)
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", cap)
 	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
 		mid := (hi + lo) / 2
-		if !executable(mid) {
+		failed, _, err := executable(mid)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
 			lo = mid
 		} else {
 			hi = mid
 		}
 	}
-	// Reject the transaction as invalid if it still fails at the highest allowance
-	if hi == cap {
-		if !executable(hi) {
-			return 0, fmt.Errorf("gas required exceeds allowance or always failing transaction")
-		}
-	}
 	return hexutil.Uint64(hi), nil
 }
 
@@ -947,8 +1353,8 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 	return result
 }
 
-// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
-func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+// NewRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
+func NewRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	return newRPCTransaction(tx, common.Hash{}, 0, 0)
 }
 
@@ -1060,7 +1466,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
-		return newRPCPendingTransaction(tx)
+		return NewRPCPendingTransaction(tx)
 	}
 	// Transaction unknown, return as such
 	return nil
@@ -1081,6 +1487,76 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 	return rlp.EncodeToBytes(tx)
 }
 
+// SenderTxCursor is the chain position to resume listing the transactions of
+// an account from.
+type SenderTxCursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Index       hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// SenderTransactions is a page of the transactions sent by an account.
+type SenderTransactions struct {
+	Transactions []*RPCTransaction `json:"transactions"`
+	Next         *SenderTxCursor   `json:"next"`        // Start of the next page, nil on the last one
+	IndexedFrom  hexutil.Uint64    `json:"indexedFrom"` // Oldest block covered by the sender index
+}
+
+const (
+	defaultSenderTxPage = 100  // Number of transactions returned if no page size is given
+	maxSenderTxPage     = 1000 // Maximum page size of transaction listings by sender
+)
+
+// GetTransactionsBySender returns the transactions sent by the given account in
+// chain order, starting at the position of the cursor if one is given. The node
+// must be indexing transactions by sender. Blocks older than IndexedFrom are not
+// covered yet, they are being indexed in the background.
+func (s *PublicTransactionPoolAPI) GetTransactionsBySender(ctx context.Context, sender common.Address, cursor *SenderTxCursor, limit *hexutil.Uint64) (*SenderTransactions, error) {
+	db := s.b.ChainDb()
+	tail := rawdb.ReadSenderTxIndexTail(db)
+	iteratee, ok := db.(mandb.Iteratee)
+	if tail == nil || !ok {
+		return nil, errors.New("transactions are not indexed by sender, enable --txindex.sender")
+	}
+	size := defaultSenderTxPage
+	if limit != nil {
+		if *limit == 0 || *limit > maxSenderTxPage {
+			return nil, fmt.Errorf("page size must be between 1 and %d", maxSenderTxPage)
+		}
+		size = int(*limit)
+	}
+	var number, index uint64
+	if cursor != nil {
+		number, index = uint64(cursor.BlockNumber), uint64(cursor.Index)
+	}
+	page := &SenderTransactions{
+		Transactions: []*RPCTransaction{},
+		IndexedFrom:  hexutil.Uint64(*tail),
+	}
+	// Entries of reorged out or rewound blocks may linger, skip over them while
+	// filling the page
+	var block *types.Block
+	for {
+		want := size + 1 - len(page.Transactions)
+		entries := rawdb.ReadSenderTxEntries(iteratee, sender, number, index, want)
+		for _, entry := range entries {
+			if block == nil || block.NumberU64() != entry.BlockNumber {
+				block = rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, entry.BlockNumber), entry.BlockNumber)
+			}
+			if block != nil && entry.Index < uint64(len(block.Transactions())) && block.Transactions()[entry.Index].Hash() == entry.Hash {
+				if len(page.Transactions) == size {
+					page.Next = &SenderTxCursor{BlockNumber: hexutil.Uint64(entry.BlockNumber), Index: hexutil.Uint64(entry.Index)}
+					return page, nil
+				}
+				page.Transactions = append(page.Transactions, newRPCTransactionFromBlockIndex(block, entry.Index))
+			}
+			number, index = entry.BlockNumber, entry.Index+1
+		}
+		if len(entries) < want {
+			return page, nil
+		}
+	}
+}
+
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(s.b.ChainDb(), hash)
@@ -1129,9 +1605,31 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
+	// Attach the revert reason and internal transfers if the node stores them
+	if extras := rawdb.ReadReceiptExtras(s.b.ChainDb(), blockHash, blockNumber); uint64(len(extras)) > index && extras[index] != nil {
+		if data := extras[index].RevertReason; len(data) > 0 {
+			fields["revertData"] = hexutil.Bytes(data)
+			if reason, err := abi.UnpackRevert(data); err == nil {
+				fields["revertReason"] = reason
+			}
+		}
+		transfers := make([]*RPCInternalTransfer, 0, len(extras[index].Transfers))
+		for _, transfer := range extras[index].Transfers {
+			transfers = append(transfers, &RPCInternalTransfer{From: transfer.From, To: transfer.To, Value: (*hexutil.Big)(transfer.Value)})
+		}
+		fields["internalTransfers"] = transfers
+	}
 	return fields, nil
 }
 
+// RPCInternalTransfer is a value transfer made by a contract while executing a
+// transaction, as reported in extended receipts.
+type RPCInternalTransfer struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+}
+
 // sign is a helper function that signs a transaction with the private key of the given address.
 func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
 	// Look up the wallet containing the requested signer
@@ -1257,7 +1755,7 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 // submitTransaction is a helper function that submits tx to txPool and logs a message.
 func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
 	if err := b.SendTx(ctx, tx); err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, newTxError(err, tx.Hash())
 	}
 	if tx.To() == nil {
 		signer := types.MakeSigner(b.ChainConfig(), b.CurrentBlock().Number())
@@ -1321,6 +1819,7 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 		chainID = config.ChainId
 	}
 	signed, err := wallet.SignTx(account, tx, chainID)
+	auditSignedTx(ctx, s.b.AccountManager(), "man_sendTransaction", args.From, signed, err)
 	if err != nil {
 		return common.Hash{}, err
 	}
@@ -1346,7 +1845,7 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 // The account associated with addr must be unlocked.
 //
 // https://github.com/matrix/wiki/wiki/JSON-RPC#man_sign
-func (s *PublicTransactionPoolAPI) Sign(addr common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+func (s *PublicTransactionPoolAPI) Sign(ctx context.Context, addr common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
 	// Look up the wallet containing the requested signer
 	account := accounts.Account{Address: addr}
 
@@ -1355,7 +1854,37 @@ func (s *PublicTransactionPoolAPI) Sign(addr common.Address, data hexutil.Bytes)
 		return nil, err
 	}
 	// Sign the requested hash with the wallet
-	signature, err := wallet.SignHash(account, signHash(data))
+	sighash := signHash(data)
+	signature, err := wallet.SignHash(account, sighash)
+	auditSign(ctx, s.b.AccountManager(), "man_sign", addr, common.BytesToHash(sighash), err)
+	if err == nil {
+		signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	}
+	return signature, err
+}
+
+// SignTypedData calculates an ECDSA signature over EIP-712 typed structured data:
+// keccak256("\x19\x01" + domainSeparator + hashStruct(message)).
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+//
+// The account associated with addr must be unlocked.
+func (s *PublicTransactionPoolAPI) SignTypedData(ctx context.Context, addr common.Address, typedData accounts.TypedData) (hexutil.Bytes, error) {
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: addr}
+
+	wallet, err := s.b.AccountManager().Find(account)
+	if err != nil {
+		return nil, err
+	}
+	sighash, _, err := accounts.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	// Sign the typed data digest with the wallet
+	signature, err := wallet.SignHash(account, sighash)
+	auditSign(ctx, s.b.AccountManager(), "man_signTypedData", addr, common.BytesToHash(sighash), err)
 	if err == nil {
 		signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
 	}
@@ -1385,6 +1914,7 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 		return nil, err
 	}
 	tx, err := s.sign(args.From, args.toTransaction())
+	auditSignedTx(ctx, s.b.AccountManager(), "man_signTransaction", args.From, tx, err)
 	if err != nil {
 		return nil, err
 	}
@@ -1411,7 +1941,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 		}
 		from, _ := types.Sender(signer, tx)
 		if _, err := s.b.AccountManager().Find(accounts.Account{Address: from}); err == nil {
-			transactions = append(transactions, newRPCPendingTransaction(tx))
+			transactions = append(transactions, NewRPCPendingTransaction(tx))
 		}
 	}
 	return transactions, nil
@@ -1448,6 +1978,7 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 				sendArgs.Gas = gasLimit
 			}
 			signedTx, err := s.sign(sendArgs.From, sendArgs.toTransaction())
+			auditSignedTx(ctx, s.b.AccountManager(), "man_resend", sendArgs.From, signedTx, err)
 			if err != nil {
 				return common.Hash{}, err
 			}
@@ -1532,17 +2063,16 @@ func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
 	return ldb.LDB().GetProperty(property)
 }
 
+// ChaindbCompact flattens the entire key-value database into a single level,
+// removing all unused slots and merging all keys.
 func (api *PrivateDebugAPI) ChaindbCompact() error {
-	ldb, ok := api.b.ChainDb().(interface {
-		LDB() *leveldb.DB
-	})
-	if !ok {
-		return fmt.Errorf("chaindbCompact does not work for memory databases")
-	}
-	for b := byte(0); b < 255; b++ {
+	for b := 0; b < 256; b++ {
+		start, limit := []byte{byte(b)}, []byte{byte(b + 1)}
+		if b == 255 {
+			limit = nil
+		}
 		log.Info("Compacting chain database", "range", fmt.Sprintf("0x%0.2X-0x%0.2X", b, b+1))
-		err := ldb.LDB().CompactRange(util.Range{Start: []byte{b}, Limit: []byte{b + 1}})
-		if err != nil {
+		if err := api.b.ChainDb().Compact(start, limit); err != nil {
 			log.Error("Database compaction failed", "err", err)
 			return err
 		}
@@ -1550,9 +2080,25 @@ func (api *PrivateDebugAPI) ChaindbCompact() error {
 	return nil
 }
 
-// SetHead rewinds the head of the blockchain to a previous block.
-func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) {
-	api.b.SetHead(uint64(number))
+// ChaindbBackup writes a consistent point-in-time copy of the chain database
+// (including any ancient blocks) into the given directory, which must be empty
+// or not exist yet. The node keeps running and importing blocks meanwhile.
+func (api *PrivateDebugAPI) ChaindbBackup(dir string) error {
+	log.Info("Backing up chain database", "dir", dir)
+	if err := rawdb.Backup(api.b.ChainDb(), dir); err != nil {
+		log.Error("Database backup failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// SetHead rewinds the head of the blockchain to a previous block, dropping the
+// indexes of the rewound blocks and returning their transactions to the pool.
+func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) error {
+	if head := api.b.CurrentBlock().NumberU64(); uint64(number) > head {
+		return fmt.Errorf("block #%d is above the current head #%d", number, head)
+	}
+	return api.b.SetHead(uint64(number))
 }
 
 // PublicNetAPI offers network related RPC methods
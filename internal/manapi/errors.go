@@ -0,0 +1,164 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package manapi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/matrix/go-matrix/accounts/abi"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core"
+)
+
+// Error codes of the API errors, alongside the standard JSON-RPC ones. Clients
+// should rely on these and on the reason in the error data rather than the
+// messages, which may change between versions.
+// See: https://github.com/ethereum/EIPs/blob/master/EIPS/eip-1474.md#error-codes
+const (
+	errCodeReverted          = 3
+	errCodeNotFound          = -32001
+	errCodeTxRejected        = -32003
+	errCodeNonceTooLow       = -32010
+	errCodeNonceTooHigh      = -32011
+	errCodeInsufficientFunds = -32012
+	errCodeUnderpriced       = -32013
+	errCodeIntrinsicGas      = -32014
+	errCodeGasLimit          = -32015
+	errCodeKnownTx           = -32016
+)
+
+// errorKind is the typed code and machine readable reason of a class of errors.
+type errorKind struct {
+	code   int
+	reason string
+}
+
+var (
+	kindNotFound               = errorKind{errCodeNotFound, "notFound"}
+	kindTxRejected             = errorKind{errCodeTxRejected, "rejected"}
+	kindNonceTooLow            = errorKind{errCodeNonceTooLow, "nonceTooLow"}
+	kindNonceTooHigh           = errorKind{errCodeNonceTooHigh, "nonceTooHigh"}
+	kindInsufficientFunds      = errorKind{errCodeInsufficientFunds, "insufficientFunds"}
+	kindUnderpriced            = errorKind{errCodeUnderpriced, "underpriced"}
+	kindReplacementUnderpriced = errorKind{errCodeUnderpriced, "replacementUnderpriced"}
+	kindIntrinsicGas           = errorKind{errCodeIntrinsicGas, "intrinsicGas"}
+	kindGasLimit               = errorKind{errCodeGasLimit, "gasLimit"}
+	kindKnownTx                = errorKind{errCodeKnownTx, "knownTransaction"}
+)
+
+// errorKinds maps the errors of the transaction pool and the state transition to
+// their typed codes.
+var errorKinds = map[error]errorKind{
+	core.ErrNonceTooLow:               kindNonceTooLow,
+	core.ErrNonceTooHigh:              kindNonceTooHigh,
+	core.ErrInsufficientFunds:         kindInsufficientFunds,
+	core.ErrInsufficientBalanceForGas: kindInsufficientFunds,
+	core.ErrUnderpriced:               kindUnderpriced,
+	core.ErrReplaceUnderpriced:        kindReplacementUnderpriced,
+	core.ErrIntrinsicGas:              kindIntrinsicGas,
+	core.ErrGasLimit:                  kindGasLimit,
+	core.ErrGasLimitReached:           kindGasLimit,
+	core.ErrKownTransaction:           kindKnownTx,
+}
+
+// apiError is an API error with a typed code, the reason and the affected
+// transaction being sent along in the data field of the RPC error.
+type apiError struct {
+	error
+	code int
+	data *apiErrorData
+}
+
+// apiErrorData is the machine readable data of an apiError.
+type apiErrorData struct {
+	Reason string       `json:"reason"`
+	TxHash *common.Hash `json:"txHash,omitempty"`
+}
+
+// ErrorCode returns the typed JSON error code.
+func (e *apiError) ErrorCode() int {
+	return e.code
+}
+
+// ErrorData returns the reason of the error and the affected transaction.
+func (e *apiError) ErrorData() interface{} {
+	return e.data
+}
+
+func newAPIError(err error, kind errorKind) *apiError {
+	return &apiError{error: err, code: kind.code, data: &apiErrorData{Reason: kind.reason}}
+}
+
+// newNotFoundError creates an error for a missing block, transaction or other
+// resource, the message being formatted from the arguments.
+func newNotFoundError(format string, args ...interface{}) *apiError {
+	return newAPIError(fmt.Errorf(format, args...), kindNotFound)
+}
+
+// newTxError assigns the typed code to an error rejecting the submission of a
+// transaction, any unknown error being a generic rejection.
+func newTxError(err error, hash common.Hash) *apiError {
+	kind, ok := errorKinds[err]
+	if !ok {
+		kind = kindTxRejected
+	}
+	e := newAPIError(err, kind)
+	e.data.TxHash = &hash
+	return e
+}
+
+// newCallError assigns the typed code to an error aborting the execution of a
+// call, leaving unknown errors as they are.
+func newCallError(err error) error {
+	if kind, ok := errorKinds[err]; ok {
+		return newAPIError(err, kind)
+	}
+	return err
+}
+
+// revertError is an API error that encompasses an EVM revert with its reason,
+// the raw revert data being sent along in the data field of the RPC error.
+type revertError struct {
+	error
+	reason string // revert reason hex encoded
+}
+
+// ErrorCode returns the JSON error code for a revertal.
+// See: https://github.com/ethereum/wiki/wiki/JSON-RPC-Error-Codes-Improvement-Proposal
+func (e *revertError) ErrorCode() int {
+	return errCodeReverted
+}
+
+// ErrorData returns the hex encoded revert reason.
+func (e *revertError) ErrorData() interface{} {
+	return e.reason
+}
+
+// newRevertError creates a revertError instance with the provided revert data,
+// decoding the Solidity reason string into the message if there is one.
+func newRevertError(res []byte) *revertError {
+	err := errors.New("execution reverted")
+	if reason, errUnpack := abi.UnpackRevert(res); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: %v", reason)
+	}
+	return &revertError{
+		error:  err,
+		reason: hexutil.Encode(res),
+	}
+}
@@ -13,29 +13,43 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Copyright 2009 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
 
-// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+package les
 
-package unix
+import (
+	"errors"
 
-func itoa(val int) string { // do it here rather than with fmt to avoid dependency
-	if val < 0 {
-		return "-" + uitoa(uint(-val))
+	"github.com/matrix/go-matrix/params"
+)
+
+var errNoCheckpoint = errors.New("no checkpoint available")
+
+// PublicLightServerAPI provides an API to access the trusted checkpoints a light
+// server generates from its local chain, to be hard-coded or supplied to light
+// clients starting from scratch.
+type PublicLightServerAPI struct {
+	server *LesServer
+}
+
+// NewPublicLightServerAPI creates a new light server API.
+func NewPublicLightServerAPI(server *LesServer) *PublicLightServerAPI {
+	return &PublicLightServerAPI{server: server}
+}
+
+// LatestCheckpoint returns the checkpoint of the most recent section with both
+// its CHT and bloom trie generated.
+func (api *PublicLightServerAPI) LatestCheckpoint() (*params.TrustedCheckpoint, error) {
+	sections := api.server.checkpointSections()
+	if sections == 0 {
+		return nil, errNoCheckpoint
 	}
-	return uitoa(uint(val))
+	return api.GetCheckpoint(sections - 1)
 }
 
-func uitoa(val uint) string {
-	var buf [32]byte // big enough for int64
-	i := len(buf) - 1
-	for val >= 10 {
-		buf[i] = byte(val%10 + '0')
-		i--
-		val /= 10
+// GetCheckpoint returns the checkpoint of the given section.
+func (api *PublicLightServerAPI) GetCheckpoint(index uint64) (*params.TrustedCheckpoint, error) {
+	if checkpoint := api.server.checkpoint(index); checkpoint != nil {
+		return checkpoint, nil
 	}
-	buf[i] = byte(val + '0')
-	return string(buf[i:])
+	return nil, errNoCheckpoint
 }
@@ -51,16 +51,21 @@ func (b *LesApiBackend) CurrentBlock() *types.Block {
 	return types.NewBlockWithHeader(b.man.BlockChain().CurrentHeader())
 }
 
-func (b *LesApiBackend) SetHead(number uint64) {
+func (b *LesApiBackend) SetHead(number uint64) error {
 	b.man.protocolManager.downloader.Cancel()
 	b.man.blockchain.SetHead(number)
+	return nil
 }
 
 func (b *LesApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
-	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
 		return b.man.blockchain.CurrentHeader(), nil
+	case rpc.SafeBlockNumber:
+		return b.man.blockchain.CurrentSafeHeader(), nil
+	case rpc.FinalizedBlockNumber:
+		return b.man.blockchain.CurrentFinalizedHeader(), nil
 	}
-
 	return b.man.blockchain.GetHeaderByNumberOdr(ctx, uint64(blockNr))
 }
 
@@ -98,6 +103,16 @@ func (b *LesApiBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*typ
 	return nil, nil
 }
 
+// GetStateDiff returns nil as light clients don't index state diffs, the state
+// of each block has to be checked in full.
+func (b *LesApiBackend) GetStateDiff(ctx context.Context, header *types.Header) (types.StateDiff, error) {
+	return nil, nil
+}
+
+func (b *LesApiBackend) StateAt(ctx context.Context, header *types.Header) (*state.StateDB, error) {
+	return light.NewState(ctx, header, b.man.odr), nil
+}
+
 func (b *LesApiBackend) GetTd(hash common.Hash) *big.Int {
 	return b.man.blockchain.GetTdByHash(hash)
 }
@@ -136,10 +151,32 @@ func (b *LesApiBackend) TxPoolContent() (map[common.Address]types.Transactions,
 	return b.man.txPool.Content()
 }
 
+func (b *LesApiBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return b.man.txPool.ContentFrom(addr)
+}
+
 func (b *LesApiBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.man.txPool.SubscribeNewTxsEvent(ch)
 }
 
+// SubscribeReplacedTxEvent returns a subscription that never fires, the light
+// pool doesn't replace transactions.
+func (b *LesApiBackend) SubscribeReplacedTxEvent(ch chan<- core.ReplacedTxEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// SubscribeTxLifecycleEvent returns a subscription that never fires, the light
+// pool doesn't track why transactions leave it.
+func (b *LesApiBackend) SubscribeTxLifecycleEvent(ch chan<- core.TxLifecycleEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return b.man.blockchain.SubscribeChainEvent(ch)
 }
@@ -152,6 +189,15 @@ func (b *LesApiBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) e
 	return b.man.blockchain.SubscribeChainSideEvent(ch)
 }
 
+// SubscribeChainReorgEvent returns a subscription that never fires, the light
+// chain only tracks headers and can't report the transactions of a reorg.
+func (b *LesApiBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return b.man.blockchain.SubscribeLogsEvent(ch)
 }
@@ -172,6 +218,10 @@ func (b *LesApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *LesApiBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+}
+
 func (b *LesApiBackend) ChainDb() mandb.Database {
 	return b.man.chainDb
 }
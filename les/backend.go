@@ -85,7 +85,7 @@ func New(ctx *node.ServiceContext, config *man.Config) (*LightMatrix, error) {
 	if err != nil {
 		return nil, err
 	}
-	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
+	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.ChainOverrides)
 	if _, isCompat := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !isCompat {
 		return nil, genesisErr
 	}
@@ -115,7 +115,7 @@ func New(ctx *node.ServiceContext, config *man.Config) (*LightMatrix, error) {
 	leth.serverPool = newServerPool(chainDb, quitSync, &leth.wg)
 	leth.retriever = newRetrieveManager(peers, leth.reqDist, leth.serverPool)
 	leth.odr = NewLesOdr(chainDb, leth.chtIndexer, leth.bloomTrieIndexer, leth.bloomIndexer, leth.retriever)
-	if leth.blockchain, err = light.NewLightChain(leth.odr, leth.chainConfig, leth.engine); err != nil {
+	if leth.blockchain, err = light.NewLightChain(leth.odr, leth.chainConfig, leth.engine, config.Checkpoint); err != nil {
 		return nil, err
 	}
 	leth.bloomIndexer.Start(leth.blockchain)
@@ -177,6 +177,7 @@ func (s *LightDummyAPI) Mining() bool {
 // APIs returns the collection of RPC services the matrix package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *LightMatrix) APIs() []rpc.API {
+	filterConfig := filters.Config{Timeout: s.config.FilterTimeout, MaxFilters: s.config.FilterLimit}
 	return append(manapi.GetAPIs(s.ApiBackend), []rpc.API{
 		{
 			Namespace: "man",
@@ -201,12 +202,12 @@ func (s *LightMatrix) APIs() []rpc.API {
 		}, {
 			Namespace: "man",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true, filterConfig),
 			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true, filterConfig),
 			Public:    true,
 		}, {
 			Namespace: "net",
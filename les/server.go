@@ -34,7 +34,9 @@ import (
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/p2p"
 	"github.com/matrix/go-matrix/p2p/discv5"
+	"github.com/matrix/go-matrix/params"
 	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/rpc"
 )
 
 type LesServer struct {
@@ -107,6 +109,50 @@ func (s *LesServer) Protocols() []p2p.Protocol {
 	return s.protocolManager.SubProtocols
 }
 
+// APIs returns the RPC services publishing the checkpoints of the server.
+func (s *LesServer) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPublicLightServerAPI(s),
+			Public:    true,
+		},
+	}
+}
+
+// checkpointSections returns the number of LES/2 sections for which both the
+// CHT and the bloom trie have been generated.
+func (s *LesServer) checkpointSections() uint64 {
+	chtSections, _, _ := s.chtIndexer.Sections()
+	chtSections /= light.CHTFrequencyClient / light.CHTFrequencyServer
+
+	bloomTrieSections, _, _ := s.bloomTrieIndexer.Sections()
+	if bloomTrieSections < chtSections {
+		return bloomTrieSections
+	}
+	return chtSections
+}
+
+// checkpoint assembles the trusted checkpoint of a LES/2 section from the
+// locally generated tries, returning nil if they are not available yet.
+func (s *LesServer) checkpoint(section uint64) *params.TrustedCheckpoint {
+	if section >= s.checkpointSections() {
+		return nil
+	}
+	head := s.chtIndexer.SectionHead((section+1)*(light.CHTFrequencyClient/light.CHTFrequencyServer) - 1)
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: section,
+		SectionHead:  head,
+		CHTRoot:      light.GetChtV2Root(s.protocolManager.chainDb, section, head),
+		BloomRoot:    light.GetBloomTrieRoot(s.protocolManager.chainDb, section, head),
+	}
+	if checkpoint.Empty() || s.bloomTrieIndexer.SectionHead(section) != head {
+		return nil
+	}
+	return checkpoint
+}
+
 // Start starts the LES server
 func (s *LesServer) Start(srvr *p2p.Server) {
 	s.protocolManager.Start(s.config.LightPeers)
@@ -55,7 +55,7 @@ func newCanonical(n int) (mandb.Database, *LightChain, error) {
 	db := mandb.NewMemDatabase()
 	gspec := core.Genesis{Config: params.TestChainConfig}
 	genesis := gspec.MustCommit(db)
-	blockchain, _ := NewLightChain(&dummyOdr{db: db}, gspec.Config, manash.NewFaker())
+	blockchain, _ := NewLightChain(&dummyOdr{db: db}, gspec.Config, manash.NewFaker(), nil)
 
 	// Create and inject the requested chain
 	if n == 0 {
@@ -75,7 +75,7 @@ func newTestLightChain() *LightChain {
 		Config:     params.TestChainConfig,
 	}
 	gspec.MustCommit(db)
-	lc, err := NewLightChain(&dummyOdr{db: db}, gspec.Config, manash.NewFullFaker())
+	lc, err := NewLightChain(&dummyOdr{db: db}, gspec.Config, manash.NewFullFaker(), nil)
 	if err != nil {
 		panic(err)
 	}
@@ -276,6 +276,51 @@ func (odr *dummyOdr) Retrieve(ctx context.Context, req OdrRequest) error {
 	return nil
 }
 
+// checkpointOdr is a dummy backend exposing the indexers a trusted checkpoint
+// is injected into.
+type checkpointOdr struct {
+	dummyOdr
+	cht, bloomTrie *core.ChainIndexer
+}
+
+func (odr *checkpointOdr) ChtIndexer() *core.ChainIndexer       { return odr.cht }
+func (odr *checkpointOdr) BloomTrieIndexer() *core.ChainIndexer { return odr.bloomTrie }
+func (odr *checkpointOdr) BloomIndexer() *core.ChainIndexer     { return nil }
+
+// Tests that a supplied trusted checkpoint is injected into the indexers so that
+// syncing can start from it.
+func TestTrustedCheckpoint(t *testing.T) {
+	db := mandb.NewMemDatabase()
+	gspec := core.Genesis{Config: params.TestChainConfig}
+	gspec.MustCommit(db)
+
+	odr := &checkpointOdr{dummyOdr: dummyOdr{db: db}, cht: NewChtIndexer(db, true), bloomTrie: NewBloomTrieIndexer(db, true)}
+	defer odr.cht.Close()
+	defer odr.bloomTrie.Close()
+
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: 3,
+		SectionHead:  common.Hash{0x01},
+		CHTRoot:      common.Hash{0x02},
+		BloomRoot:    common.Hash{0x03},
+	}
+	if _, err := NewLightChain(odr, gspec.Config, manash.NewFaker(), checkpoint); err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	if sections, _, head := odr.cht.Sections(); sections != 4 || head != checkpoint.SectionHead {
+		t.Errorf("CHT sections mismatch: have %d/%x, want %d/%x", sections, head, 4, checkpoint.SectionHead)
+	}
+	if root := GetChtRoot(db, checkpoint.SectionIndex, checkpoint.SectionHead); root != checkpoint.CHTRoot {
+		t.Errorf("CHT root mismatch: have %x, want %x", root, checkpoint.CHTRoot)
+	}
+	if sections, _, head := odr.bloomTrie.Sections(); sections != 4 || head != checkpoint.SectionHead {
+		t.Errorf("bloom trie sections mismatch: have %d/%x, want %d/%x", sections, head, 4, checkpoint.SectionHead)
+	}
+	if root := GetBloomTrieRoot(db, checkpoint.SectionIndex, checkpoint.SectionHead); root != checkpoint.BloomRoot {
+		t.Errorf("bloom trie root mismatch: have %x, want %x", root, checkpoint.BloomRoot)
+	}
+}
+
 // Tests that reorganizing a long difficult chain after a short easy one
 // overwrites the canonical numbers and links in the database.
 func TestReorgLongHeaders(t *testing.T) {
@@ -339,7 +384,7 @@ func TestReorgBadHeaderHashes(t *testing.T) {
 	defer func() { delete(core.BadHashes, headers[3].Hash()) }()
 
 	// Create a new LightChain and check that it rolled back the state.
-	ncm, err := NewLightChain(&dummyOdr{db: bc.chainDb}, params.TestChainConfig, manash.NewFaker())
+	ncm, err := NewLightChain(&dummyOdr{db: bc.chainDb}, params.TestChainConfig, manash.NewFaker(), nil)
 	if err != nil {
 		t.Fatalf("failed to create new chain manager: %v", err)
 	}
@@ -200,6 +200,13 @@ func (it *nodeIterator) Next(descend bool) bool {
 	return ok
 }
 
+func (it *nodeIterator) Seek(key []byte) error {
+	it.do(func() error {
+		return it.NodeIterator.Seek(key)
+	})
+	return it.err
+}
+
 // do runs fn and attempts to fill in missing nodes by retrieving.
 func (it *nodeIterator) do(fn func() error) {
 	var lasthash common.Hash
@@ -32,9 +32,9 @@ import (
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/core"
-	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/mc"
 
@@ -448,27 +448,58 @@ func NewPublicDebugAPI(man *Matrix) *PublicDebugAPI {
 
 // DumpBlock retrieves the entire state of the database at a given block.
 func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
+	stateDb, err := api.stateAt(blockNr)
+	if err != nil {
+		return state.Dump{}, err
+	}
+	return stateDb.RawDump(), nil
+}
+
+// AccountRangeMaxResults is the maximum number of accounts returned by a single
+// debug_accountRange call.
+const AccountRangeMaxResults = 256
+
+// AccountRange enumerates the accounts of the state at the given block, starting
+// at the given secure trie key. At most maxResults (capped to
+// AccountRangeMaxResults) accounts are returned, along with the key to resume
+// from in the next call. Code and storage can be excluded to keep responses
+// small, and incompletes controls whether accounts without a known address
+// preimage are included.
+func (api *PublicDebugAPI) AccountRange(blockNr rpc.BlockNumber, start hexutil.Bytes, maxResults int, nocode, nostorage, incompletes bool) (state.IteratorDump, error) {
+	stateDb, err := api.stateAt(blockNr)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+	if maxResults <= 0 || maxResults > AccountRangeMaxResults {
+		maxResults = AccountRangeMaxResults
+	}
+	return stateDb.IteratorDump(nocode, nostorage, !incompletes, start, maxResults), nil
+}
+
+// stateAt retrieves the state of the given block, including the pending one.
+func (api *PublicDebugAPI) stateAt(blockNr rpc.BlockNumber) (*state.StateDB, error) {
 	if blockNr == rpc.PendingBlockNumber {
 		// If we're dumping the pending state, we need to request
 		// both the pending block as well as the pending state from
 		// the miner and operate on those
 		_, stateDb := api.man.miner.Pending()
-		return stateDb.RawDump(), nil
+		return stateDb, nil
 	}
 	var block *types.Block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		block = api.man.blockchain.CurrentBlock()
-	} else {
+	case rpc.SafeBlockNumber:
+		block = api.man.blockchain.CurrentSafeBlock()
+	case rpc.FinalizedBlockNumber:
+		block = api.man.blockchain.CurrentFinalizedBlock()
+	default:
 		block = api.man.blockchain.GetBlockByNumber(uint64(blockNr))
 	}
 	if block == nil {
-		return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
-	}
-	stateDb, err := api.man.BlockChain().StateAt(block.Root())
-	if err != nil {
-		return state.Dump{}, err
+		return nil, fmt.Errorf("block #%d not found", blockNr)
 	}
-	return stateDb.RawDump(), nil
+	return api.man.BlockChain().StateAt(block.Root())
 }
 
 // PrivateDebugAPI is the collection of Matrix full node APIs exposed over
@@ -486,12 +517,63 @@ func NewPrivateDebugAPI(config *params.ChainConfig, man *Matrix) *PrivateDebugAP
 
 // Preimage is a debug API function that returns the preimage for a sha3 hash, if known.
 func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
-	if preimage := rawdb.ReadPreimage(api.man.ChainDb(), hash); preimage != nil {
+	if preimage, _ := api.man.BlockChain().StateCache().TrieDB().Preimage(hash); preimage != nil {
 		return preimage, nil
 	}
 	return nil, errors.New("unknown preimage")
 }
 
+// AccountAddress resolves a hashed key of the state trie back into the address of
+// the account it belongs to, using the recorded secure trie key preimages.
+func (api *PrivateDebugAPI) AccountAddress(ctx context.Context, key common.Hash) (common.Address, error) {
+	preimage, _ := api.man.BlockChain().StateCache().TrieDB().Preimage(key)
+	if len(preimage) != common.AddressLength {
+		return common.Address{}, fmt.Errorf("no account preimage found for key %x", key)
+	}
+	return common.BytesToAddress(preimage), nil
+}
+
+// GetBlockWitness re-executes the block with the given hash on top of its parent
+// state, recording every trie node and contract code accessed. The returned RLP
+// blob is enough for a stateless verifier to re-execute the block knowing only
+// the parent state root.
+func (api *PrivateDebugAPI) GetBlockWitness(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	blockchain := api.man.BlockChain()
+
+	block := blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	database, witness := state.NewWitnessDatabase(blockchain.StateCache(), parent.Root())
+	statedb, err := state.New(parent.Root(), database)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := blockchain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+		return nil, err
+	}
+	// Hash the post state too, pulling in the nodes needed to recompute the root
+	if root := statedb.IntermediateRoot(api.config.IsEIP158(block.Number())); root != block.Root() {
+		return nil, fmt.Errorf("state root mismatch: have %x, want %x", root, block.Root())
+	}
+	return rlp.EncodeToBytes(witness)
+}
+
+// GetBlockStats returns the import timing breakdown of a block recently
+// processed by this node: sender recovery, EVM execution, trie hashing,
+// validation, state commit and disk write.
+func (api *PrivateDebugAPI) GetBlockStats(ctx context.Context, hash common.Hash) (*core.BlockStats, error) {
+	stats := api.man.BlockChain().GetBlockStats(hash)
+	if stats == nil {
+		return nil, fmt.Errorf("no import statistics for block %x", hash)
+	}
+	return stats, nil
+}
+
 // GetBadBLocks returns a list of the last 'bad blocks' that the client has seen on the network
 // and returns them as a JSON list of block-hashes
 func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]core.BadBlockArgs, error) {
@@ -513,7 +595,7 @@ type storageEntry struct {
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
 func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
-	_, _, statedb, err := api.computeTxEnv(blockHash, txIndex, 0)
+	_, _, statedb, err := api.computeTxEnv(ctx, blockHash, txIndex, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -552,6 +634,8 @@ func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeRes
 // code hash, or storage hash.
 //
 // With one parameter, returns the list of accounts modified in the specified block.
+// Such queries are served from the state diff index if it's maintained, in which
+// case touched but otherwise unchanged accounts are included too.
 func (api *PrivateDebugAPI) GetModifiedAccountsByNumber(startNum uint64, endNum *uint64) ([]common.Address, error) {
 	var startBlock, endBlock *types.Block
 
@@ -575,6 +659,20 @@ func (api *PrivateDebugAPI) GetModifiedAccountsByNumber(startNum uint64, endNum
 	return api.getModifiedAccounts(startBlock, endBlock)
 }
 
+// GetStateDiffByNumber returns the accounts and storage slots modified by the
+// block with the given number, as recorded by the state diff index.
+func (api *PrivateDebugAPI) GetStateDiffByNumber(number uint64) (types.StateDiff, error) {
+	block := api.man.blockchain.GetBlockByNumber(number)
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	diff := api.man.blockchain.GetStateDiff(block.Hash(), number)
+	if diff == nil {
+		return nil, fmt.Errorf("block %d has no state diff, enable --statediffs", number)
+	}
+	return diff, nil
+}
+
 // GetModifiedAccountsByHash returns all accounts that have changed between the
 // two blocks specified. A change is defined as a difference in nonce, balance,
 // code hash, or storage hash.
@@ -606,6 +704,16 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	if startBlock.Number().Uint64() >= endBlock.Number().Uint64() {
 		return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startBlock.Number().Uint64(), endBlock.Number().Uint64())
 	}
+	// Serve single block queries from the state diff index if it's maintained
+	if endBlock.ParentHash() == startBlock.Hash() {
+		if diff := api.man.blockchain.GetStateDiff(endBlock.Hash(), endBlock.NumberU64()); diff != nil {
+			dirty := make([]common.Address, 0, len(diff))
+			for _, account := range diff {
+				dirty = append(dirty, account.Address)
+			}
+			return dirty, nil
+		}
+	}
 
 	oldTrie, err := trie.NewSecure(startBlock.Root(), trie.NewDatabase(api.man.chainDb), 0)
 	if err != nil {
@@ -629,3 +737,28 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	}
 	return dirty, nil
 }
+
+// PropagationStats returns the percentiles of the delays with which peers deliver
+// blocks and transactions behind their first arrival, along with the per peer
+// behaviour. Tracing has to be enabled with the propagation tracing flag.
+func (api *PrivateDebugAPI) PropagationStats() (map[string]*PropagationStats, error) {
+	tracer := api.man.protocolManager.propTracer
+	if tracer == nil {
+		return nil, errPropagationTracing
+	}
+	return tracer.stats(), nil
+}
+
+// PropagationTrace returns the peers a recent block or transaction hash arrived
+// from, ordered by their delay behind the first one.
+func (api *PrivateDebugAPI) PropagationTrace(hash common.Hash) ([]*PeerArrival, error) {
+	tracer := api.man.protocolManager.propTracer
+	if tracer == nil {
+		return nil, errPropagationTracing
+	}
+	arrivals := tracer.trace(hash)
+	if arrivals == nil {
+		return nil, fmt.Errorf("hash %x not traced", hash)
+	}
+	return arrivals, nil
+}
@@ -54,9 +54,14 @@ func (b *EthAPIBackend) CurrentBlock() *types.Block {
 	return b.man.blockchain.CurrentBlock()
 }
 
-func (b *EthAPIBackend) SetHead(number uint64) {
+func (b *EthAPIBackend) SetHead(number uint64) error {
 	b.man.protocolManager.downloader.Cancel()
-	b.man.blockchain.SetHead(number)
+	txs, err := b.man.blockchain.Rewind(number)
+	if err != nil {
+		return err
+	}
+	b.man.txPool.Rewind(txs)
+	return nil
 }
 
 func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
@@ -66,8 +71,13 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNum
 		return block.Header(), nil
 	}
 	// Otherwise resolve and return the block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		return b.man.blockchain.CurrentBlock().Header(), nil
+	case rpc.SafeBlockNumber:
+		return b.man.blockchain.CurrentSafeBlock().Header(), nil
+	case rpc.FinalizedBlockNumber:
+		return b.man.blockchain.CurrentFinalizedBlock().Header(), nil
 	}
 	return b.man.blockchain.GetHeaderByNumber(uint64(blockNr)), nil
 }
@@ -79,8 +89,13 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumb
 		return block, nil
 	}
 	// Otherwise resolve and return the block
-	if blockNr == rpc.LatestBlockNumber {
+	switch blockNr {
+	case rpc.LatestBlockNumber:
 		return b.man.blockchain.CurrentBlock(), nil
+	case rpc.SafeBlockNumber:
+		return b.man.blockchain.CurrentSafeBlock(), nil
+	case rpc.FinalizedBlockNumber:
+		return b.man.blockchain.CurrentFinalizedBlock(), nil
 	}
 	return b.man.blockchain.GetBlockByNumber(uint64(blockNr)), nil
 }
@@ -97,6 +112,12 @@ func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.
 		return nil, nil, err
 	}
 	stateDb, err := b.man.BlockChain().StateAt(header.Root)
+	if err != nil && b.man.config.StateRegenLimit > 0 {
+		// The state was pruned, try regenerating it from an older one
+		if block := b.man.blockchain.GetBlock(header.Hash(), header.Number.Uint64()); block != nil {
+			stateDb, err = b.man.stateAtBlock(ctx, block, b.man.config.StateRegenLimit)
+		}
+	}
 	return stateDb, header, err
 }
 
@@ -127,6 +148,14 @@ func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*typ
 	return logs, nil
 }
 
+func (b *EthAPIBackend) GetStateDiff(ctx context.Context, header *types.Header) (types.StateDiff, error) {
+	return b.man.blockchain.GetStateDiff(header.Hash(), header.Number.Uint64()), nil
+}
+
+func (b *EthAPIBackend) StateAt(ctx context.Context, header *types.Header) (*state.StateDB, error) {
+	return b.man.blockchain.StateAt(header.Root)
+}
+
 func (b *EthAPIBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.man.blockchain.GetTdByHash(blockHash)
 }
@@ -155,6 +184,10 @@ func (b *EthAPIBackend) SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) e
 	return b.man.BlockChain().SubscribeChainSideEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return b.man.BlockChain().SubscribeChainReorgEvent(ch)
+}
+
 func (b *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return b.man.BlockChain().SubscribeLogsEvent(ch)
 }
@@ -191,10 +224,22 @@ func (b *EthAPIBackend) TxPoolContent() (map[common.Address]types.Transactions,
 	return b.man.TxPool().Content()
 }
 
+func (b *EthAPIBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return b.man.TxPool().ContentFrom(addr)
+}
+
 func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.man.TxPool().SubscribeNewTxsEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeReplacedTxEvent(ch chan<- core.ReplacedTxEvent) event.Subscription {
+	return b.man.TxPool().SubscribeReplacedTxEvent(ch)
+}
+
+func (b *EthAPIBackend) SubscribeTxLifecycleEvent(ch chan<- core.TxLifecycleEvent) event.Subscription {
+	return b.man.TxPool().SubscribeTxLifecycleEvent(ch)
+}
+
 func (b *EthAPIBackend) Downloader() *downloader.Downloader {
 	return b.man.Downloader()
 }
@@ -207,6 +252,10 @@ func (b *EthAPIBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+}
+
 func (b *EthAPIBackend) ChainDb() mandb.Database {
 	return b.man.ChainDb()
 }
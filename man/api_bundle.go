@@ -0,0 +1,243 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+const (
+	// defaultBundleTimeout is the amount of time a whole bundle can execute by
+	// default before being forcefully aborted.
+	defaultBundleTimeout = 5 * time.Second
+
+	// maxBundleTimeout is the longest timeout a caller may request for a bundle.
+	maxBundleTimeout = 30 * time.Second
+)
+
+// CallBundleArgs represents the arguments for simulating an ordered list of
+// signed transactions on top of a parent block.
+type CallBundleArgs struct {
+	Txs         []hexutil.Bytes  `json:"txs"`         // RLP encoded signed transactions
+	BlockNumber *rpc.BlockNumber `json:"blockNumber"` // Parent block, latest if omitted
+	Coinbase    *common.Address  `json:"coinbase"`    // Beneficiary of the simulated block
+	Timestamp   *hexutil.Uint64  `json:"timestamp"`   // Simulated block time, parent + 1 if omitted
+	GasLimit    *hexutil.Uint64  `json:"gasLimit"`    // Simulated block gas limit, parent's if omitted
+	Timeout     *string          `json:"timeout"`     // Execution timeout of the whole bundle
+}
+
+// CallBundleTxResult is the outcome of a single transaction within a bundle.
+type CallBundleTxResult struct {
+	TxHash      common.Hash     `json:"txHash"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	GasUsed     hexutil.Uint64  `json:"gasUsed"`
+	Failed      bool            `json:"failed"`
+	ReturnValue hexutil.Bytes   `json:"returnValue"`
+	Logs        []*types.Log    `json:"logs"`
+}
+
+// CallBundleResult is the outcome of simulating a whole bundle.
+type CallBundleResult struct {
+	ParentHash  common.Hash           `json:"parentHash"`
+	BlockNumber hexutil.Uint64        `json:"blockNumber"`
+	StateRoot   common.Hash           `json:"stateRoot"`
+	GasUsed     hexutil.Uint64        `json:"gasUsed"`
+	Results     []*CallBundleTxResult `json:"results"`
+}
+
+// PublicBundleAPI provides an API to simulate the execution of transaction
+// bundles without mining them.
+type PublicBundleAPI struct {
+	man *Matrix
+}
+
+// NewPublicBundleAPI creates a new bundle simulation API.
+func NewPublicBundleAPI(man *Matrix) *PublicBundleAPI {
+	return &PublicBundleAPI{man: man}
+}
+
+// CallBundle executes the given transactions in order on top of the state of
+// the requested parent block, as if they were included in its child. Each
+// transaction sees the effects of the previous ones. Nothing is persisted, the
+// resulting state root is only reported. The gas limit of the simulated block is
+// capped at the configured RPC gas cap and the timeout at maxBundleTimeout.
+func (api *PublicBundleAPI) CallBundle(ctx context.Context, args CallBundleArgs) (*CallBundleResult, error) {
+	if len(args.Txs) == 0 {
+		return nil, fmt.Errorf("bundle missing transactions")
+	}
+	txs := make(types.Transactions, len(args.Txs))
+	for i, blob := range args.Txs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(blob, tx); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	// Retrieve the parent block and the state to execute on
+	number := rpc.LatestBlockNumber
+	if args.BlockNumber != nil {
+		number = *args.BlockNumber
+	}
+	var (
+		parent  *types.Block
+		statedb *state.StateDB
+		err     error
+	)
+	switch number {
+	case rpc.PendingBlockNumber:
+		parent, statedb = api.man.miner.Pending()
+	case rpc.LatestBlockNumber:
+		parent = api.man.blockchain.CurrentBlock()
+	case rpc.SafeBlockNumber:
+		parent = api.man.blockchain.CurrentSafeBlock()
+	case rpc.FinalizedBlockNumber:
+		parent = api.man.blockchain.CurrentFinalizedBlock()
+	default:
+		parent = api.man.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("block %v not found", number)
+	}
+	if statedb == nil {
+		if statedb, err = api.man.blockchain.StateAt(parent.Root()); err != nil {
+			return nil, err
+		}
+	}
+	// Assemble the header of the simulated child block
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Time:       new(big.Int).Add(parent.Time(), common.Big1),
+		Difficulty: parent.Difficulty(),
+		Coinbase:   parent.Coinbase(),
+	}
+	if args.Coinbase != nil {
+		header.Coinbase = *args.Coinbase
+	}
+	if args.Timestamp != nil {
+		header.Time = new(big.Int).SetUint64(uint64(*args.Timestamp))
+	}
+	if args.GasLimit != nil {
+		header.GasLimit = uint64(*args.GasLimit)
+	}
+	if gasCap := api.man.config.RPCGasCap; gasCap > 0 && header.GasLimit > gasCap {
+		header.GasLimit = gasCap
+	}
+	// Abort the whole bundle once the timeout expires
+	timeout, err := bundleTimeout(args.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		config = api.man.chainConfig
+		signer = types.MakeSigner(config, header.Number)
+		gp     = new(core.GasPool).AddGas(header.GasLimit)
+
+		result = &CallBundleResult{
+			ParentHash:  parent.Hash(),
+			BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+			Results:     make([]*CallBundleTxResult, 0, len(txs)),
+		}
+	)
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+
+		var (
+			ret    []byte
+			gas    uint64
+			failed bool
+		)
+		if msg.Extra().TxType == 1 {
+			// Mirror the state processor, these transactions aren't executed
+			failed = true
+		} else {
+			vmenv := vm.NewEVM(core.NewEVMContext(msg, header, api.man.blockchain, &header.Coinbase), statedb, config, vm.Config{})
+
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					vmenv.Cancel()
+				case <-done:
+				}
+			}()
+			ret, gas, failed, err = core.ApplyMessage(vmenv, msg, gp)
+			close(done)
+
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("transaction %d (%x) failed: %v", i, tx.Hash(), err)
+			}
+		}
+		if config.IsByzantium(header.Number) {
+			statedb.Finalise(true)
+		} else {
+			statedb.IntermediateRoot(config.IsEIP158(header.Number))
+		}
+		result.GasUsed += hexutil.Uint64(gas)
+		result.Results = append(result.Results, &CallBundleTxResult{
+			TxHash:      tx.Hash(),
+			From:        msg.From(),
+			To:          tx.To(),
+			GasUsed:     hexutil.Uint64(gas),
+			Failed:      failed,
+			ReturnValue: ret,
+			Logs:        statedb.GetLogs(tx.Hash()),
+		})
+	}
+	result.StateRoot = statedb.IntermediateRoot(config.IsEIP158(header.Number))
+	return result, nil
+}
+
+// bundleTimeout parses the requested execution timeout of a bundle, capping it
+// at maxBundleTimeout.
+func bundleTimeout(timeout *string) (time.Duration, error) {
+	if timeout == nil {
+		return defaultBundleTimeout, nil
+	}
+	d, err := time.ParseDuration(*timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d > maxBundleTimeout {
+		d = maxBundleTimeout
+	}
+	return d, nil
+}
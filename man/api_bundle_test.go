@@ -0,0 +1,123 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/consensus/manash"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+// Tests that the gas limit of a simulated bundle block is capped at the RPC gas
+// cap, even if the caller requests a higher one.
+func TestCallBundleGasCap(t *testing.T) {
+	var (
+		db      = mandb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gspec.MustCommit(db)
+	blockchain, _ := core.NewBlockChain(db, nil, gspec.Config, manash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	txs := make([]hexutil.Bytes, 2)
+	for i := range txs {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i)|params.NonceAddOne, common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		if txs[i], err = rlp.EncodeToBytes(tx); err != nil {
+			t.Fatalf("failed to encode transaction: %v", err)
+		}
+	}
+	gasLimit := hexutil.Uint64(10 * params.TxGas)
+	args := CallBundleArgs{Txs: txs, GasLimit: &gasLimit}
+
+	tests := []struct {
+		gasCap uint64
+		fail   bool
+	}{
+		{0, false},                // no cap, both transactions fit
+		{2 * params.TxGas, false}, // cap fits both transactions
+		{params.TxGas + 1, true},  // cap only fits the first transaction
+		{params.TxGas - 1, true},  // cap fits no transaction at all
+	}
+	for i, tt := range tests {
+		config := DefaultConfig
+		config.RPCGasCap = tt.gasCap
+		api := NewPublicBundleAPI(&Matrix{config: &config, chainConfig: gspec.Config, blockchain: blockchain, chainDb: db})
+
+		result, err := api.CallBundle(context.Background(), args)
+		if tt.fail {
+			if err == nil || !strings.Contains(err.Error(), "gas limit reached") {
+				t.Errorf("test %d: bundle error mismatch: have %v, want gas limit reached", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to call bundle: %v", i, err)
+			continue
+		}
+		if result.GasUsed != hexutil.Uint64(2*params.TxGas) {
+			t.Errorf("test %d: gas used mismatch: have %d, want %d", i, result.GasUsed, 2*params.TxGas)
+		}
+	}
+}
+
+// Tests that the requested bundle timeouts are capped at maxBundleTimeout.
+func TestBundleTimeout(t *testing.T) {
+	tests := []struct {
+		timeout *string
+		want    time.Duration
+		fail    bool
+	}{
+		{nil, defaultBundleTimeout, false},
+		{strPtr("2s"), 2 * time.Second, false},
+		{strPtr("1h"), maxBundleTimeout, false},
+		{strPtr("forever"), 0, true},
+	}
+	for i, tt := range tests {
+		timeout, err := bundleTimeout(tt.timeout)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if timeout != tt.want {
+			t.Errorf("test %d: timeout mismatch: have %v, want %v", i, timeout, tt.want)
+		}
+	}
+}
+
+func strPtr(s string) *string { return &s }
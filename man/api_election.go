@@ -0,0 +1,309 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/matrix/go-matrix/ca"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/depoistInfo"
+	"github.com/matrix/go-matrix/internal/manapi"
+	"github.com/matrix/go-matrix/mc"
+	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/params"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// ElectedNode is a single node picked by an election.
+type ElectedNode struct {
+	Account common.Address `json:"account"`
+	Stock   uint16         `json:"stock"`
+}
+
+// ElectionResult contains the nodes elected for the election period a block
+// belongs to, split by the role they were elected for.
+type ElectionResult struct {
+	Number           hexutil.Uint64 `json:"number"` // Block the elected nodes were requested for
+	Period           hexutil.Uint64 `json:"period"` // First block of the election period
+	Validators       []ElectedNode  `json:"validators"`
+	BackupValidators []ElectedNode  `json:"backupValidators"`
+	Miners           []ElectedNode  `json:"miners"`
+	BackupMiners     []ElectedNode  `json:"backupMiners"`
+}
+
+// ElectionSchedule contains the heights of the election periods around a block.
+type ElectionSchedule struct {
+	Number                hexutil.Uint64 `json:"number"`                // Block the schedule was requested for
+	Interval              hexutil.Uint64 `json:"interval"`              // Number of blocks in an election period
+	CurrentElection       hexutil.Uint64 `json:"currentElection"`       // First block of the current election period
+	NextElection          hexutil.Uint64 `json:"nextElection"`          // First block of the next election period
+	NextValidatorElection hexutil.Uint64 `json:"nextValidatorElection"` // Block announcing the validators of the next period
+	NextMinerElection     hexutil.Uint64 `json:"nextMinerElection"`     // Block announcing the miners of the next period
+}
+
+// TopologyNode is a single node of the network topology.
+type TopologyNode struct {
+	Account  common.Address `json:"account"`
+	Position uint16         `json:"position"`
+	Role     string         `json:"role"`
+	Stock    uint16         `json:"stock"`
+}
+
+// TopologyResult is the network topology in effect at a block.
+type TopologyResult struct {
+	Number hexutil.Uint64 `json:"number"`
+	Nodes  []TopologyNode `json:"nodes"`
+}
+
+// DepositResult is the deposit of a node applying for a role.
+type DepositResult struct {
+	Address        common.Address  `json:"address"`
+	NodeID         discover.NodeID `json:"nodeId"`
+	Role           string          `json:"role"`
+	Deposit        *hexutil.Big    `json:"deposit"`
+	WithdrawHeight *hexutil.Big    `json:"withdrawHeight"`
+	OnlineTime     *hexutil.Big    `json:"onlineTime"`
+}
+
+// DepositProofResult is the Merkle proof of storage slots of the deposit contract
+// in the state of a block, verifiable against the state root of its header.
+type DepositProofResult struct {
+	BlockHash common.Hash           `json:"blockHash"`
+	Number    hexutil.Uint64        `json:"number"`
+	StateRoot common.Hash           `json:"stateRoot"`
+	Contract  *manapi.AccountResult `json:"contract"`
+}
+
+// PublicElectionAPI provides access to the validator elections, the network
+// topology and the deposits backing them.
+type PublicElectionAPI struct {
+	man *Matrix
+}
+
+// NewPublicElectionAPI creates a new API definition for the election and
+// topology methods of the Matrix service.
+func NewPublicElectionAPI(man *Matrix) *PublicElectionAPI {
+	return &PublicElectionAPI{man: man}
+}
+
+// GetElection returns the nodes elected for the election period of the given
+// block. The validators and miners of a period are announced in the headers of
+// the blocks params.VerifyNetChangeUpTime and params.MinerNetChangeUpTime blocks
+// before it starts, the first period uses the ones of the genesis block.
+func (api *PublicElectionAPI) GetElection(ctx context.Context, blockNr rpc.BlockNumber) (*ElectionResult, error) {
+	header, err := api.header(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		number = header.Number.Uint64()
+		period = common.GetLastReElectionNumber(number)
+		elects []common.Elect
+	)
+	if period == 0 {
+		genesis := api.man.blockchain.Genesis()
+		elects = genesis.Header().Elect
+	} else {
+		for _, upTime := range []uint64{params.VerifyNetChangeUpTime, params.MinerNetChangeUpTime} {
+			announce := api.man.blockchain.GetHeaderByNumber(period - upTime)
+			if announce == nil {
+				return nil, fmt.Errorf("election block #%d not found", period-upTime)
+			}
+			elects = append(elects, announce.Elect...)
+		}
+	}
+	result := &ElectionResult{
+		Number:           hexutil.Uint64(number),
+		Period:           hexutil.Uint64(period),
+		Validators:       []ElectedNode{},
+		BackupValidators: []ElectedNode{},
+		Miners:           []ElectedNode{},
+		BackupMiners:     []ElectedNode{},
+	}
+	for _, elect := range elects {
+		node := ElectedNode{Account: elect.Account, Stock: elect.Stock}
+		switch elect.Type {
+		case common.ElectRoleValidator:
+			result.Validators = append(result.Validators, node)
+		case common.ElectRoleValidatorBackUp:
+			result.BackupValidators = append(result.BackupValidators, node)
+		case common.ElectRoleMiner:
+			result.Miners = append(result.Miners, node)
+		case common.ElectRoleMinerBackUp:
+			result.BackupMiners = append(result.BackupMiners, node)
+		}
+	}
+	return result, nil
+}
+
+// GetElectionSchedule returns the election period of the given block, along
+// with the heights at which the next one starts and its nodes get announced.
+func (api *PublicElectionAPI) GetElectionSchedule(ctx context.Context, blockNr rpc.BlockNumber) (*ElectionSchedule, error) {
+	header, err := api.header(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		number   = header.Number.Uint64()
+		interval = common.GetReElectionInterval()
+		current  = common.GetLastReElectionNumber(number)
+		next     = current + interval
+	)
+	return &ElectionSchedule{
+		Number:                hexutil.Uint64(number),
+		Interval:              hexutil.Uint64(interval),
+		CurrentElection:       hexutil.Uint64(current),
+		NextElection:          hexutil.Uint64(next),
+		NextValidatorElection: hexutil.Uint64(next - params.VerifyNetChangeUpTime),
+		NextMinerElection:     hexutil.Uint64(next - params.MinerNetChangeUpTime),
+	}, nil
+}
+
+// GetTopology returns the network topology the node tracked for the given
+// block, ordered by position.
+func (api *PublicElectionAPI) GetTopology(ctx context.Context, blockNr rpc.BlockNumber) (*TopologyResult, error) {
+	header, err := api.header(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := ca.GetTopologyByNumber(common.RoleAll, header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	return newTopologyResult(header.Number.Uint64(), graph), nil
+}
+
+// newTopologyResult converts the topology graph tracked for a block into its RPC
+// representation.
+func newTopologyResult(number uint64, graph *mc.TopologyGraph) *TopologyResult {
+	result := &TopologyResult{
+		Number: hexutil.Uint64(number),
+		Nodes:  make([]TopologyNode, 0, len(graph.NodeList)),
+	}
+	for _, node := range graph.NodeList {
+		result.Nodes = append(result.Nodes, TopologyNode{
+			Account:  node.Account,
+			Position: node.Position,
+			Role:     node.Type.String(),
+			Stock:    node.Stock,
+		})
+	}
+	return result
+}
+
+// GetDeposits returns the deposits of the nodes applying to become validators
+// or miners in the state of the given block.
+func (api *PublicElectionAPI) GetDeposits(ctx context.Context, blockNr rpc.BlockNumber) ([]*DepositResult, error) {
+	statedb, header, err := api.man.APIBackend.StateAndHeaderByNumber(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	if statedb == nil || header == nil {
+		return nil, fmt.Errorf("block %s not found", rpc.FormatBlockNumber(blockNr))
+	}
+	results := []*DepositResult{}
+	for _, role := range []common.RoleType{common.RoleValidator, common.RoleMiner} {
+		for _, deposit := range depoistInfo.GetDepositListByState(statedb, role) {
+			results = append(results, &DepositResult{
+				Address:        deposit.Address,
+				NodeID:         deposit.NodeID,
+				Role:           role.String(),
+				Deposit:        (*hexutil.Big)(deposit.Deposit),
+				WithdrawHeight: (*hexutil.Big)(deposit.WithdrawH),
+				OnlineTime:     (*hexutil.Big)(deposit.OnlineTime),
+			})
+		}
+	}
+	return results, nil
+}
+
+// GetDepositProof returns the Merkle proof of the deposit of the given account
+// in the state of the given block. The storage proof covers the slots returned
+// by vm.DepositSlots: the deposited amount, both halves of the node ID, the
+// withdraw height and the online time.
+func (api *PublicElectionAPI) GetDepositProof(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*DepositProofResult, error) {
+	header, err := api.sealedHeader(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return api.depositProof(ctx, header, vm.DepositSlots(address))
+}
+
+// GetDepositListProof returns the Merkle proof of the list of depositors in the
+// state of the given block, covering its length followed by every item of it as
+// returned by vm.DepositListSlots. Along with the proofs of the deposits of the
+// listed accounts, it proves the complete set of validator and miner candidates.
+func (api *PublicElectionAPI) GetDepositListProof(ctx context.Context, blockNr rpc.BlockNumber) (*DepositProofResult, error) {
+	header, err := api.sealedHeader(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.man.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	count := statedb.GetState(vm.DepositAddress, vm.DepositListSlots(0)[0]).Big().Uint64()
+	return api.depositProof(ctx, header, vm.DepositListSlots(count))
+}
+
+// depositProof proves the given slots of the deposit contract in the state of
+// the block with the given header.
+func (api *PublicElectionAPI) depositProof(ctx context.Context, header *types.Header, slots []common.Hash) (*DepositProofResult, error) {
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = slot.Hex()
+	}
+	number := header.Number.Uint64()
+	proof, err := manapi.NewPublicBlockChainAPI(api.man.APIBackend).GetProof(ctx, vm.DepositAddress, keys, rpc.BlockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	return &DepositProofResult{
+		BlockHash: header.Hash(),
+		Number:    hexutil.Uint64(number),
+		StateRoot: header.Root,
+		Contract:  proof,
+	}, nil
+}
+
+// sealedHeader is like header, but rejects the pending block as its state can't
+// be verified against a sealed header.
+func (api *PublicElectionAPI) sealedHeader(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	if blockNr == rpc.PendingBlockNumber {
+		return nil, errors.New("proofs are not available for the pending block")
+	}
+	return api.header(ctx, blockNr)
+}
+
+// header resolves a block number, including the pending and tagged ones, to the
+// header of that block.
+func (api *PublicElectionAPI) header(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	header, err := api.man.APIBackend.HeaderByNumber(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %s not found", rpc.FormatBlockNumber(blockNr))
+	}
+	return header, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/consensus/manash"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/depoistInfo"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/mc"
+	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/params"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+var (
+	testValidator       = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testBackupValidator = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	testMiner           = common.HexToAddress("0x1000000000000000000000000000000000000003")
+	testBackupMiner     = common.HexToAddress("0x1000000000000000000000000000000000000004")
+
+	testValidatorDeposit = new(big.Int).Mul(big.NewInt(100000), big.NewInt(params.Ether))
+	testMinerDeposit     = new(big.Int).Mul(big.NewInt(10000), big.NewInt(params.Ether))
+	testValidatorNode    = discover.NodeID{0: 0x01, 32: 0x02, 63: 0x03}
+)
+
+// newTestElectionAPI creates an election API on top of a generated chain whose
+// genesis elects one node for every role and holds the deposits of a validator
+// and a miner candidate.
+func newTestElectionAPI(t *testing.T, blocks int) *PublicElectionAPI {
+	var (
+		db      = mandb.NewMemDatabase()
+		list    = vm.DepositListSlots(2)
+		deposit = vm.DepositSlots(testValidator)
+		storage = map[common.Hash]common.Hash{
+			list[0]:    common.BigToHash(big.NewInt(2)),
+			list[1]:    common.BytesToHash(testValidator[:]),
+			list[2]:    common.BytesToHash(testMiner[:]),
+			deposit[0]: common.BigToHash(testValidatorDeposit),
+			deposit[1]: common.BytesToHash(testValidatorNode[:32]),
+			deposit[2]: common.BytesToHash(testValidatorNode[32:]),
+			deposit[4]: common.BigToHash(big.NewInt(5)),
+		}
+	)
+	storage[vm.DepositSlots(testMiner)[0]] = common.BigToHash(testMinerDeposit)
+
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{vm.DepositAddress: {Balance: new(big.Int), Storage: storage}},
+		Elect: []common.Elect{
+			{Account: testValidator, Stock: 1, Type: common.ElectRoleValidator},
+			{Account: testBackupValidator, Stock: 2, Type: common.ElectRoleValidatorBackUp},
+			{Account: testMiner, Stock: 3, Type: common.ElectRoleMiner},
+			{Account: testBackupMiner, Stock: 4, Type: common.ElectRoleMinerBackUp},
+		},
+	}
+	genesis := gspec.MustCommit(db)
+	chain, _ := core.GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, blocks, nil)
+
+	blockchain, _ := core.NewBlockChain(db, nil, gspec.Config, manash.NewFaker(), vm.Config{})
+	if n, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	man := &Matrix{blockchain: blockchain, chainDb: db}
+	man.APIBackend = &EthAPIBackend{man, nil}
+	depoistInfo.NewDepositInfo(man.APIBackend)
+
+	return NewPublicElectionAPI(man)
+}
+
+// Tests that the nodes elected in the genesis block are reported for the first
+// election period, split by their role.
+func TestGetElection(t *testing.T) {
+	api := newTestElectionAPI(t, 4)
+	defer api.man.blockchain.Stop()
+
+	result, err := api.GetElection(context.Background(), rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to retrieve election: %v", err)
+	}
+	if result.Number != 4 || result.Period != 0 {
+		t.Errorf("election period mismatch: have #%d in period %d, want #4 in period 0", result.Number, result.Period)
+	}
+	roles := map[string][]ElectedNode{
+		"validators":        result.Validators,
+		"backup validators": result.BackupValidators,
+		"miners":            result.Miners,
+		"backup miners":     result.BackupMiners,
+	}
+	want := map[string][]ElectedNode{
+		"validators":        {{Account: testValidator, Stock: 1}},
+		"backup validators": {{Account: testBackupValidator, Stock: 2}},
+		"miners":            {{Account: testMiner, Stock: 3}},
+		"backup miners":     {{Account: testBackupMiner, Stock: 4}},
+	}
+	for role, nodes := range want {
+		if !reflect.DeepEqual(roles[role], nodes) {
+			t.Errorf("%s mismatch: have %v, want %v", role, roles[role], nodes)
+		}
+	}
+	if _, err := api.GetElection(context.Background(), rpc.BlockNumber(100)); err == nil || err.Error() != "block 100 not found" {
+		t.Errorf("missing block error mismatch: have %v, want %q", err, "block 100 not found")
+	}
+}
+
+// Tests that the election schedule reports the periods around a block and the
+// blocks announcing the nodes of the next one.
+func TestGetElectionSchedule(t *testing.T) {
+	api := newTestElectionAPI(t, 4)
+	defer api.man.blockchain.Stop()
+
+	schedule, err := api.GetElectionSchedule(context.Background(), rpc.BlockNumber(3))
+	if err != nil {
+		t.Fatalf("failed to retrieve election schedule: %v", err)
+	}
+	interval := common.GetReElectionInterval()
+	want := &ElectionSchedule{
+		Number:                3,
+		Interval:              hexutil.Uint64(interval),
+		CurrentElection:       0,
+		NextElection:          hexutil.Uint64(interval),
+		NextValidatorElection: hexutil.Uint64(interval - params.VerifyNetChangeUpTime),
+		NextMinerElection:     hexutil.Uint64(interval - params.MinerNetChangeUpTime),
+	}
+	if !reflect.DeepEqual(schedule, want) {
+		t.Errorf("election schedule mismatch: have %+v, want %+v", schedule, want)
+	}
+}
+
+// Tests that the deposits of the validator and miner candidates are read from
+// the state of the deposit contract.
+func TestGetDeposits(t *testing.T) {
+	api := newTestElectionAPI(t, 2)
+	defer api.man.blockchain.Stop()
+
+	deposits, err := api.GetDeposits(context.Background(), rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to retrieve deposits: %v", err)
+	}
+	if len(deposits) != 2 {
+		t.Fatalf("deposit count mismatch: have %d, want 2", len(deposits))
+	}
+	validator, miner := deposits[0], deposits[1]
+	if validator.Address != testValidator || validator.Role != "validator" {
+		t.Errorf("validator mismatch: have %x as %s", validator.Address, validator.Role)
+	}
+	if validator.NodeID != testValidatorNode {
+		t.Errorf("validator node mismatch: have %v, want %v", validator.NodeID, testValidatorNode)
+	}
+	if validator.Deposit.ToInt().Cmp(testValidatorDeposit) != 0 || validator.OnlineTime.ToInt().Int64() != 5 {
+		t.Errorf("validator deposit mismatch: have %v online for %v", validator.Deposit, validator.OnlineTime)
+	}
+	if miner.Address != testMiner || miner.Role != "miner" {
+		t.Errorf("miner mismatch: have %x as %s", miner.Address, miner.Role)
+	}
+	if miner.Deposit.ToInt().Cmp(testMinerDeposit) != 0 || miner.WithdrawHeight.ToInt().Sign() != 0 {
+		t.Errorf("miner deposit mismatch: have %v withdrawn at %v", miner.Deposit, miner.WithdrawHeight)
+	}
+	if _, err := api.GetDeposits(context.Background(), rpc.BlockNumber(100)); err == nil || err.Error() != "block 100 not found" {
+		t.Errorf("missing block error mismatch: have %v, want %q", err, "block 100 not found")
+	}
+}
+
+// Tests that the nodes of a topology graph are reported with their role names.
+func TestNewTopologyResult(t *testing.T) {
+	graph := &mc.TopologyGraph{
+		Number: big.NewInt(7),
+		NodeList: []mc.TopologyNodeInfo{
+			{Account: testValidator, Position: 0, Type: common.RoleValidator, Stock: 1},
+			{Account: testMiner, Position: 1, Type: common.RoleMiner, Stock: 3},
+		},
+	}
+	want := &TopologyResult{
+		Number: 7,
+		Nodes: []TopologyNode{
+			{Account: testValidator, Position: 0, Role: "validator", Stock: 1},
+			{Account: testMiner, Position: 1, Role: "miner", Stock: 3},
+		},
+	}
+	if result := newTopologyResult(7, graph); !reflect.DeepEqual(result, want) {
+		t.Errorf("topology mismatch: have %+v, want %+v", result, want)
+	}
+}
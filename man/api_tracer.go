@@ -101,6 +101,10 @@ func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.Block
 		from = api.man.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		from = api.man.blockchain.CurrentBlock()
+	case rpc.SafeBlockNumber:
+		from = api.man.blockchain.CurrentSafeBlock()
+	case rpc.FinalizedBlockNumber:
+		from = api.man.blockchain.CurrentFinalizedBlock()
 	default:
 		from = api.man.blockchain.GetBlockByNumber(uint64(start))
 	}
@@ -109,6 +113,10 @@ func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.Block
 		to = api.man.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		to = api.man.blockchain.CurrentBlock()
+	case rpc.SafeBlockNumber:
+		to = api.man.blockchain.CurrentSafeBlock()
+	case rpc.FinalizedBlockNumber:
+		to = api.man.blockchain.CurrentFinalizedBlock()
 	default:
 		to = api.man.blockchain.GetBlockByNumber(uint64(end))
 	}
@@ -296,7 +304,7 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 				database.TrieDB().Reference(root, common.Hash{})
 			}
 			// Dereference all past tries we ourselves are done working with
-			database.TrieDB().Dereference(proot, common.Hash{})
+			database.TrieDB().Dereference(proot)
 			proot = root
 		}
 	}()
@@ -317,7 +325,7 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 			done[uint64(result.Block)] = result
 
 			// Dereference any paret tries held in memory by this task
-			database.TrieDB().Dereference(res.rootref, common.Hash{})
+			database.TrieDB().Dereference(res.rootref)
 
 			// Stream completed traces to the user, aborting on the first error
 			for result, ok := done[next]; ok; result, ok = done[next] {
@@ -343,6 +351,10 @@ func (api *PrivateDebugAPI) TraceBlockByNumber(ctx context.Context, number rpc.B
 		block = api.man.miner.PendingBlock()
 	case rpc.LatestBlockNumber:
 		block = api.man.blockchain.CurrentBlock()
+	case rpc.SafeBlockNumber:
+		block = api.man.blockchain.CurrentSafeBlock()
+	case rpc.FinalizedBlockNumber:
+		block = api.man.blockchain.CurrentFinalizedBlock()
 	default:
 		block = api.man.blockchain.GetBlockByNumber(uint64(number))
 	}
@@ -399,7 +411,7 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, err := api.computeStateDB(ctx, parent, reexec)
 	if err != nil {
 		return nil, err
 	}
@@ -467,67 +479,8 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 // computeStateDB retrieves the state database associated with a certain block.
 // If no state is locally available for the given block, a number of blocks are
 // attempted to be reexecuted to generate the desired state.
-func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, error) {
-	// If we have the state fully available, use that
-	statedb, err := api.man.blockchain.StateAt(block.Root())
-	if err == nil {
-		return statedb, nil
-	}
-	// Otherwise try to reexec blocks until we find a state or reach our limit
-	origin := block.NumberU64()
-	database := state.NewDatabase(api.man.ChainDb())
-
-	for i := uint64(0); i < reexec; i++ {
-		block = api.man.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
-		if block == nil {
-			break
-		}
-		if statedb, err = state.New(block.Root(), database); err == nil {
-			break
-		}
-	}
-	if err != nil {
-		switch err.(type) {
-		case *trie.MissingNodeError:
-			return nil, errors.New("required historical state unavailable")
-		default:
-			return nil, err
-		}
-	}
-	// State was available at historical point, regenerate
-	var (
-		start  = time.Now()
-		logged time.Time
-		proot  common.Hash
-	)
-	for block.NumberU64() < origin {
-		// Print progress logs if long enough time elapsed
-		if time.Since(logged) > 8*time.Second {
-			log.Info("Regenerating historical state", "block", block.NumberU64()+1, "target", origin, "elapsed", time.Since(start))
-			logged = time.Now()
-		}
-		// Retrieve the next block to regenerate and process it
-		if block = api.man.blockchain.GetBlockByNumber(block.NumberU64() + 1); block == nil {
-			return nil, fmt.Errorf("block #%d not found", block.NumberU64()+1)
-		}
-		_, _, _, err := api.man.blockchain.Processor().Process(block, statedb, vm.Config{})
-		if err != nil {
-			return nil, err
-		}
-		// Finalize the state so any modifications are written to the trie
-		root, err := statedb.Commit(true)
-		if err != nil {
-			return nil, err
-		}
-		if err := statedb.Reset(root); err != nil {
-			return nil, err
-		}
-		database.TrieDB().Reference(root, common.Hash{})
-		database.TrieDB().Dereference(proot, common.Hash{})
-		proot = root
-	}
-	log.Info("Historical state regenerated", "block", block.NumberU64(), "elapsed", time.Since(start), "size", database.TrieDB().Size())
-	return statedb, nil
+func (api *PrivateDebugAPI) computeStateDB(ctx context.Context, block *types.Block, reexec uint64) (*state.StateDB, error) {
+	return api.man.stateAtBlock(ctx, block, reexec)
 }
 
 // TraceTransaction returns the structured logs created during the execution of EVM
@@ -542,7 +495,7 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
 	}
-	msg, vmctx, statedb, err := api.computeTxEnv(blockHash, int(index), reexec)
+	msg, vmctx, statedb, err := api.computeTxEnv(ctx, blockHash, int(index), reexec)
 	if err != nil {
 		return nil, err
 	}
@@ -612,7 +565,7 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 }
 
 // computeTxEnv returns the execution environment of a certain transaction.
-func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
+func (api *PrivateDebugAPI) computeTxEnv(ctx context.Context, blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
 	// Create the parent state database
 	block := api.man.blockchain.GetBlockByHash(blockHash)
 	if block == nil {
@@ -622,7 +575,7 @@ func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, ree
 	if parent == nil {
 		return nil, vm.Context{}, nil, fmt.Errorf("parent %x not found", block.ParentHash())
 	}
-	statedb, err := api.computeStateDB(parent, reexec)
+	statedb, err := api.computeStateDB(ctx, parent, reexec)
 	if err != nil {
 		return nil, vm.Context{}, nil, err
 	}
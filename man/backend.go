@@ -51,6 +51,7 @@ import (
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/man/filters"
 	"github.com/matrix/go-matrix/man/gasprice"
+	"github.com/matrix/go-matrix/matrixwork"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/hd"
@@ -74,6 +75,7 @@ type LesServer interface {
 	Start(srvr *p2p.Server)
 	Stop()
 	Protocols() []p2p.Protocol
+	APIs() []rpc.API
 	SetBloomBitsIndexer(bbIndexer *core.ChainIndexer)
 }
 
@@ -103,9 +105,11 @@ type Matrix struct {
 
 	APIBackend *EthAPIBackend
 
-	miner     *miner.Miner
-	gasPrice  *big.Int
-	manbase common.Address
+	miner      *miner.Miner
+	sealer     *miner.Sealer // Block producer for proof-of-authority chains, nil otherwise
+	gasPrice   *big.Int
+	manbase    common.Address
+	txOrdering matrixwork.OrderingPolicy
 
 	networkId     uint64
 	netRPCService *manapi.PublicNetAPI
@@ -126,6 +130,8 @@ type Matrix struct {
 	leaderServer *verifier.LeaderIdentity
 
 	lock sync.RWMutex // Protects the variadic fields (e.g. gas price and manbase)
+
+	stateRegens chan struct{} // Semaphore limiting concurrent historical state regenerations
 }
 
 func (s *Matrix) AddLesServer(ls LesServer) {
@@ -142,17 +148,26 @@ func New(ctx *node.ServiceContext, config *Config) (*Matrix, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	txOrdering := matrixwork.PriceNonceOrdering
+	if config.TxOrdering != "" {
+		policy, err := matrixwork.LookupOrdering(config.TxOrdering)
+		if err != nil {
+			return nil, err
+		}
+		txOrdering = policy
+	}
 	chainDb, err := CreateDB(ctx, config, "chaindata")
 	if err != nil {
 		return nil, err
 	}
-	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
+	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.ChainOverrides)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
 	man := &Matrix{
+		stateRegens:    make(chan struct{}, maxStateRegens),
 		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
@@ -168,26 +183,26 @@ func New(ctx *node.ServiceContext, config *Config) (*Matrix, error) {
 		networkId:     config.NetworkId,
 		gasPrice:      config.GasPrice,
 		manbase:     config.Etherbase,
+		txOrdering:    txOrdering,
 		bloomRequests: make(chan chan *bloombits.Retrieval),
 		bloomIndexer:  NewBloomIndexer(chainDb, params.BloomBitsBlocks),
 	}
 	log.Info("Initialising Matrix protocol", "versions", ProtocolVersions, "network", config.NetworkId)
 
 	if !config.SkipBcVersionCheck {
-		bcVersion := rawdb.ReadDatabaseVersion(chainDb)
-		if bcVersion != core.BlockChainVersion && bcVersion != 0 {
-			return nil, fmt.Errorf("Blockchain DB version mismatch (%d / %d). Run gman upgradedb.\n", bcVersion, core.BlockChainVersion)
+		if err := core.UpgradeDatabase(chainDb); err != nil {
+			return nil, fmt.Errorf("Blockchain DB upgrade failed: %v", err)
 		}
-		rawdb.WriteDatabaseVersion(chainDb, core.BlockChainVersion)
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, NoPreimages: config.NoPreimages, NoPrefetch: config.NoPrefetch, Snapshot: config.Snapshot, StateDiffs: config.StateDiffs, SenderTxIndex: config.SenderTxIndex, ReceiptExtras: config.ReceiptExtras, TxLookupLimit: config.TxLookupLimit, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
 	)
 	man.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, man.chainConfig, man.engine, vmConfig)
 	if err != nil {
 		return nil, err
 	}
+	man.blockchain.SetSlowBlockThreshold(config.SlowBlockThreshold)
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
@@ -204,6 +219,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Matrix, error) {
 	if man.protocolManager, err = NewProtocolManager(man.chainConfig, config.SyncMode, config.NetworkId, man.eventMux, man.txPool, man.engine, man.blockchain, chainDb, ctx.MsgCenter); err != nil {
 		return nil, err
 	}
+	if config.PropagationTrace {
+		man.protocolManager.propTracer = newPropagationTracer()
+	}
 	//man.protocolManager.Msgcenter = ctx.MsgCenter
 	MsgCenter = ctx.MsgCenter
 	man.miner, err = miner.New(man.blockchain, man.chainConfig, man.EventMux(), man.engine, man.blockchain.DPOSEngine(), man.hd, man.CA())
@@ -211,6 +229,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Matrix, error) {
 		return nil, err
 	}
 	man.miner.SetExtra(makeExtraData(config.ExtraData))
+	if man.chainConfig.Clique != nil {
+		man.sealer = miner.NewSealer(man.chainConfig, man.engine, man.blockchain, man.txPool, man.EventMux(), config.GasLimit)
+	}
 
 	//algorithm
 	dbDir := ctx.GetConfig().DataDir
@@ -276,6 +297,9 @@ func makeExtraData(extra []byte) []byte {
 
 // CreateDB creates the chain database.
 func CreateDB(ctx *node.ServiceContext, config *Config, name string) (mandb.Database, error) {
+	if config.Freezer {
+		return ctx.OpenDatabaseWithFreezer(name, config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "man/db/"+name+"/", config.FreezerThreshold)
+	}
 	db, err := ctx.OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
 	if err != nil {
 		return nil, err
@@ -325,6 +349,13 @@ func (s *Matrix) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	filterConfig := filters.Config{Timeout: s.config.FilterTimeout, MaxFilters: s.config.FilterLimit}
+
+	// Append the checkpoint APIs if serving light clients
+	if s.lesServer != nil {
+		apis = append(apis, s.lesServer.APIs()...)
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -365,12 +396,22 @@ func (s *Matrix) APIs() []rpc.API {
 		}, {
 			Namespace: "man",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.APIBackend, false),
+			Service:   filters.NewPublicFilterAPI(s.APIBackend, false, filterConfig),
 			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.APIBackend, false),
+			Service:   filters.NewPublicFilterAPI(s.APIBackend, false, filterConfig),
+			Public:    true,
+		}, {
+			Namespace: "man",
+			Version:   "1.0",
+			Service:   NewPublicBundleAPI(s),
+			Public:    true,
+		}, {
+			Namespace: "matrix",
+			Version:   "1.0",
+			Service:   NewPublicElectionAPI(s),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -451,12 +492,28 @@ func (s *Matrix) StartMining(local bool) error {
 		// will ensure that private networks work in single miner mode too.
 		atomic.StoreUint32(&s.protocolManager.acceptTxs, 1)
 	}
+	if s.sealer != nil {
+		s.sealer.Start()
+		return nil
+	}
 	go s.miner.Start(eb)
 	return nil
 }
 
-func (s *Matrix) StopMining()         { s.miner.Stop() }
-func (s *Matrix) IsMining() bool      { return s.miner.Mining() }
+func (s *Matrix) StopMining() {
+	if s.sealer != nil {
+		s.sealer.Stop()
+	}
+	s.miner.Stop()
+}
+
+func (s *Matrix) IsMining() bool {
+	if s.sealer != nil {
+		return s.sealer.Sealing()
+	}
+	return s.miner.Mining()
+}
+
 func (s *Matrix) Miner() *miner.Miner { return s.miner }
 
 func (s *Matrix) AccountManager() *accounts.Manager  { return s.accountManager }
@@ -475,8 +532,11 @@ func (s *Matrix) MsgCenter() *mc.Center              { return s.msgcenter }
 func (s *Matrix) SignHelper() *signhelper.SignHelper { return s.signHelper }
 func (s *Matrix) ReElection() *reelection.ReElection { return s.reelection }
 func (s *Matrix) HD() *hd.HD                         { return s.hd }
+func (s *Matrix) MinerGasLimit() uint64              { return s.config.GasLimit }
 func (s *Matrix) TopNode() *topnode.TopNodeService   { return s.topNode }
 
+func (s *Matrix) MinerTxOrdering() matrixwork.OrderingPolicy { return s.txOrdering }
+
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *Matrix) Protocols() []p2p.Protocol {
@@ -533,6 +593,9 @@ func (s *Matrix) Stop() error {
 		s.lesServer.Stop()
 	}
 	s.txPool.Stop()
+	if s.sealer != nil {
+		s.sealer.Stop()
+	}
 	s.miner.Stop()
 	s.eventMux.Stop()
 
@@ -28,6 +28,7 @@ import (
 	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/consensus/manash"
 	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/man/gasprice"
 	"github.com/matrix/go-matrix/params"
@@ -43,12 +44,14 @@ var DefaultConfig = Config{
 		DatasetsInMem:  1,
 		DatasetsOnDisk: 2,
 	},
-	NetworkId:     1,
-	LightPeers:    100,
-	DatabaseCache: 768,
-	TrieCache:     256,
-	TrieTimeout:   5 * time.Minute,
-	GasPrice:      big.NewInt(18 * params.Shannon),
+	NetworkId:        1,
+	LightPeers:       100,
+	DatabaseCache:    768,
+	FreezerThreshold: rawdb.DefaultFreezerThreshold,
+	TrieCache:        256,
+	TrieTimeout:      5 * time.Minute,
+	GasPrice:         big.NewInt(18 * params.Shannon),
+	RPCGasCap:        50000000,
 
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
@@ -78,19 +81,54 @@ type Config struct {
 	// If nil, the Matrix main net block is used.
 	Genesis *core.Genesis `toml:",omitempty"`
 
+	// Fork activation blocks overlaid on the stored or genesis chain config
+	ChainOverrides *core.ChainOverrides `toml:"-"`
+
 	// Protocol options
-	NetworkId uint64 // Network ID to use for selecting peers to connect to
-	SyncMode  downloader.SyncMode
-	NoPruning bool
+	NetworkId   uint64 // Network ID to use for selecting peers to connect to
+	SyncMode    downloader.SyncMode
+	NoPruning   bool
+	NoPreimages bool
+	NoPrefetch  bool // Whether to disable prefetching and only load state on demand
+	Snapshot    bool // Whether to maintain a flat state snapshot
+	StateDiffs  bool // Whether to index the accounts and slots modified by each block
+
+	SenderTxIndex bool `toml:",omitempty"` // Whether to index the transactions of each block by sender
+	ReceiptExtras bool `toml:",omitempty"` // Whether to store the revert reason and internal transfers of each transaction
+
+	// Import time above which a block's timing breakdown is logged (0 = disabled)
+	SlowBlockThreshold time.Duration `toml:",omitempty"`
+
+	// Whether to trace the delays with which peers propagate blocks and transactions
+	PropagationTrace bool `toml:",omitempty"`
+
+	// Number of recent blocks to keep transaction lookup entries for (0 = all)
+	TxLookupLimit uint64 `toml:",omitempty"`
+
+	// Filter API options
+	FilterTimeout time.Duration `toml:",omitempty"` // Time after which installed filters not polled are removed
+	FilterLimit   int           `toml:",omitempty"` // Maximum number of filters installed by a single client IP
+
+	// Maximum number of blocks re-executed to regenerate pruned state for RPC calls (0 = disabled)
+	StateRegenLimit uint64 `toml:",omitempty"`
+
+	// Maximum gas limit of the blocks simulated for RPC calls (0 = no cap)
+	RPCGasCap uint64 `toml:",omitempty"`
 
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
+	// Trusted checkpoint to start light syncing from, overriding the built-in one
+	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
+
 	// Database options
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseFreezer    string `toml:",omitempty"` // Ancient store location, defaults to inside the chain database
+	Freezer            bool   `toml:",omitempty"` // Whether ancient blocks are moved into the freezer
+	FreezerThreshold   uint64 // Number of recent blocks kept in the key-value store
 	TrieCache          int
 	TrieTimeout        time.Duration
 
@@ -99,6 +137,8 @@ type Config struct {
 	MinerThreads int            `toml:",omitempty"`
 	ExtraData    []byte         `toml:",omitempty"`
 	GasPrice     *big.Int
+	GasLimit     uint64 `toml:",omitempty"` // Gas limit mined blocks move towards, zero follows the parent's usage
+	TxOrdering   string `toml:",omitempty"` // Name of the policy ordering the packed transactions, price by default
 
 	// Ethash options
 	Ethash manash.Config
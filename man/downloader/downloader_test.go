@@ -30,6 +30,7 @@ import (
 	"github.com/matrix/go-matrix/core"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/params"
@@ -662,8 +663,10 @@ func assertOwnForkedChain(t *testing.T, tester *downloadTester, common int, leng
 func TestCanonicalSynchronisation62(t *testing.T)      { testCanonicalSynchronisation(t, 62, FullSync) }
 func TestCanonicalSynchronisation63Full(t *testing.T)  { testCanonicalSynchronisation(t, 63, FullSync) }
 func TestCanonicalSynchronisation63Fast(t *testing.T)  { testCanonicalSynchronisation(t, 63, FastSync) }
+func TestCanonicalSynchronisation63Snap(t *testing.T)  { testCanonicalSynchronisation(t, 63, SnapSync) }
 func TestCanonicalSynchronisation64Full(t *testing.T)  { testCanonicalSynchronisation(t, 64, FullSync) }
 func TestCanonicalSynchronisation64Fast(t *testing.T)  { testCanonicalSynchronisation(t, 64, FastSync) }
+func TestCanonicalSynchronisation64Snap(t *testing.T)  { testCanonicalSynchronisation(t, 64, SnapSync) }
 func TestCanonicalSynchronisation64Light(t *testing.T) { testCanonicalSynchronisation(t, 64, LightSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
@@ -1422,6 +1425,8 @@ func testSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	// Check final progress after successful sync
 	if progress := tester.downloader.Progress(); progress.StartingBlock != uint64(targetBlocks/2+1) || progress.CurrentBlock != uint64(targetBlocks) || progress.HighestBlock != uint64(targetBlocks) {
 		t.Fatalf("Final progress mismatch: have %v/%v/%v, want %v/%v/%v", progress.StartingBlock, progress.CurrentBlock, progress.HighestBlock, targetBlocks/2+1, targetBlocks, targetBlocks)
+	} else if progress.ETA != 0 {
+		t.Fatalf("Final progress ETA mismatch: have %v, want 0", progress.ETA)
 	}
 }
 
@@ -1753,3 +1758,47 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		tester.downloader.peers.peers["peer"].peer.(*floodingTestPeer).pend.Wait()
 	}
 }
+
+// reputationTestPeer is a peer tracking the faults reported by the downloader.
+type reputationTestPeer struct {
+	Peer
+	demoted bool
+	faults  []Fault
+}
+
+func (p *reputationTestPeer) Demoted() bool        { return p.demoted }
+func (p *reputationTestPeer) Penalize(fault Fault) { p.faults = append(p.faults, fault) }
+
+// Tests that demoted peers are only handed out after all peers in good standing,
+// regardless of their measured throughput.
+func TestDemotedPeerOrdering(t *testing.T) {
+	peers := newPeerSet()
+	for i, spec := range []struct {
+		demoted    bool
+		throughput float64
+	}{
+		{true, 1000}, {false, 10}, {false, 100}, {true, 500},
+	} {
+		id := fmt.Sprintf("peer #%d", i)
+		p := newPeerConnection(id, 63, &reputationTestPeer{demoted: spec.demoted}, log.New("peer", id))
+		if err := peers.Register(p); err != nil {
+			t.Fatalf("failed to register peer: %v", err)
+		}
+		p.headerThroughput = spec.throughput
+	}
+	idle, total := peers.HeaderIdlePeers()
+	if total != 4 || len(idle) != 4 {
+		t.Fatalf("idle peer count mismatch: have %d/%d, want 4/4", len(idle), total)
+	}
+	want := []string{"peer #2", "peer #1", "peer #0", "peer #3"}
+	for i, p := range idle {
+		if p.id != want[i] {
+			t.Errorf("peer %d: have %s, want %s", i, p.id, want[i])
+		}
+	}
+	// Faults must be forwarded to peers tracking their reputation
+	idle[0].penalize(FaultTimeout)
+	if faults := idle[0].peer.(*reputationTestPeer).faults; len(faults) != 1 || faults[0] != FaultTimeout {
+		t.Errorf("fault mismatch: have %v, want [%v]", faults, FaultTimeout)
+	}
+}
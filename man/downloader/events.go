@@ -16,6 +16,10 @@
 
 package downloader
 
-type DoneEvent struct{}
+import "github.com/matrix/go-matrix/core/types"
+
+// DoneEvent is posted when a sync cycle completes, carrying the head the remote
+// peer advertised when it started.
+type DoneEvent struct{ Latest *types.Header }
 type StartEvent struct{}
 type FailedEvent struct{ Err error }
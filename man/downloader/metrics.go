@@ -40,4 +40,5 @@ var (
 
 	stateInMeter   = metrics.NewRegisteredMeter("man/downloader/states/in", nil)
 	stateDropMeter = metrics.NewRegisteredMeter("man/downloader/states/drop", nil)
+	stateHealMeter = metrics.NewRegisteredMeter("man/downloader/states/heal", nil)
 )
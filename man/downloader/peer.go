@@ -90,6 +90,37 @@ type Peer interface {
 	RequestNodeData([]common.Hash) error
 }
 
+// Fault classifies a misbehaviour of a remote peer observed while downloading.
+type Fault int
+
+const (
+	FaultTimeout Fault = iota // A data retrieval request expired
+	FaultUseless              // A response was empty or arrived for a request no longer pending
+	FaultInvalid              // A response failed validation
+)
+
+// String implements fmt.Stringer.
+func (f Fault) String() string {
+	switch f {
+	case FaultTimeout:
+		return "timeout"
+	case FaultUseless:
+		return "useless"
+	case FaultInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// Reputation is an optional interface of a Peer tracking the quality of the
+// data it serves. The downloader reports the faults it observes and assigns
+// requests to demoted peers only if no other peer is idle.
+type Reputation interface {
+	Demoted() bool        // Whether the peer should only be used as a last resort
+	Penalize(fault Fault) // Reports a misbehaviour of the peer
+}
+
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
 type lightPeerWrapper struct {
 	peer LightPeer
@@ -125,6 +156,21 @@ func newPeerConnection(id string, version int, peer Peer, logger log.Logger) *pe
 	}
 }
 
+// demoted reports whether the remote peer is in bad standing.
+func (p *peerConnection) demoted() bool {
+	if rep, ok := p.peer.(Reputation); ok {
+		return rep.Demoted()
+	}
+	return false
+}
+
+// penalize reports a fault to the remote peer if it tracks its reputation.
+func (p *peerConnection) penalize(fault Fault) {
+	if rep, ok := p.peer.(Reputation); ok {
+		rep.Penalize(fault)
+	}
+}
+
 // Reset clears the internal state of a peer entity.
 func (p *peerConnection) Reset() {
 	p.lock.Lock()
@@ -545,6 +591,10 @@ func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerC
 			}
 		}
 	}
+	// Move demoted peers behind all others, keeping the throughput order
+	sort.SliceStable(idle, func(i, j int) bool {
+		return !idle[i].demoted() && idle[j].demoted()
+	})
 	return idle, total
 }
 
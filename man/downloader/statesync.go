@@ -28,6 +28,7 @@ import (
 	"github.com/matrix/go-matrix/crypto/sha3"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/man/snap"
 	"github.com/matrix/go-matrix/trie"
 )
 
@@ -55,11 +56,60 @@ type stateSyncStats struct {
 	duplicate  uint64 // Number of state entries downloaded twice
 	unexpected uint64 // Number of non-requested state entries received
 	pending    uint64 // Number of still pending state entries
+	bytes      uint64 // Number of state bytes downloaded since start
+
+	healed      uint64 // Number of state entries re-downloaded while healing
+	healPending uint64 // Number of state entries still pending to be healed
 }
 
-// syncState starts downloading state with the given root hash.
+// syncState starts downloading state with the given root hash. In snap sync
+// mode, the state is first retrieved in ranges from snap peers, and the trie
+// node sync only fills in the remaining gaps.
 func (d *Downloader) syncState(root common.Hash) *stateSync {
-	s := newStateSync(d, root)
+	s := newStateSync(d, state.NewStateSync(root, d.stateDB))
+	if d.mode == SnapSync {
+		s.root, s.snapSyncer = root, d.SnapSyncer
+	}
+	return d.startStateSync(s)
+}
+
+// healState verifies that the state with the given root hash is complete in
+// the local database, re-downloading any missing or corrupted entries. This is
+// run on the pivot state before committing it, to catch any gaps left by earlier
+// interrupted or restarted syncs.
+func (d *Downloader) healState(root common.Hash) error {
+	db := state.NewDatabase(d.stateDB)
+	damaged := state.CheckConsistency(db, root)
+	for round := 1; len(damaged) > 0; round++ {
+		if round > fsHealRounds {
+			log.Error("Failed to heal fast sync state", "root", root, "damaged", len(damaged))
+			return errStateHealFailed
+		}
+		log.Warn("Healing incomplete fast sync state", "root", root, "damaged", len(damaged), "round", round)
+		stateHealMeter.Mark(int64(len(damaged)))
+
+		// Corrupted entries must be dropped, otherwise the scheduler skips them
+		for _, item := range damaged {
+			if _, missing := item.Err.(*trie.MissingNodeError); !missing {
+				d.stateDB.Delete(item.Hash[:])
+			}
+		}
+		heal := newStateSync(d, state.NewHealSync(damaged, d.stateDB))
+		heal.healing = true
+		if err := d.startStateSync(heal).Wait(); err != nil {
+			return err
+		}
+		// Only the healed entries need checking again, the rest of the state
+		// was already found complete
+		if damaged = state.CheckDamaged(db, damaged); len(damaged) == 0 {
+			log.Info("Healed fast sync state", "root", root, "rounds", round)
+		}
+	}
+	return nil
+}
+
+// startStateSync hands a state download over to the state fetcher.
+func (d *Downloader) startStateSync(s *stateSync) *stateSync {
 	select {
 	case d.stateSyncStart <- s:
 	case <-d.quitCh:
@@ -215,9 +265,13 @@ type stateSync struct {
 	d *Downloader // Downloader instance to access and manage current peerset
 
 	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
+	root   common.Hash                // State root being synced (snap sync only)
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
 	tasks  map[common.Hash]*stateTask // Set of tasks currently queued for retrieval
 
+	snapSyncer *snap.Syncer // Range syncer to run before the trie sync, if any
+	healing    bool         // Whether the sync re-downloads damaged entries of a pivot state
+
 	numUncommitted   int
 	bytesUncommitted int
 
@@ -236,10 +290,10 @@ type stateTask struct {
 
 // newStateSync creates a new state trie download scheduler. This method does not
 // yet start the sync. The user needs to call run to initiate.
-func newStateSync(d *Downloader, root common.Hash) *stateSync {
+func newStateSync(d *Downloader, sched *trie.TrieSync) *stateSync {
 	return &stateSync{
 		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB),
+		sched:   sched,
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
 		deliver: make(chan *stateReq),
@@ -252,6 +306,13 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
+	if s.snapSyncer != nil {
+		if err := s.snapSyncer.Sync(s.root, s.cancel); err != nil {
+			s.err = err
+			close(s.done)
+			return
+		}
+	}
 	s.err = s.loop()
 	close(s.done)
 }
@@ -335,7 +396,7 @@ func (s *stateSync) commit(force bool) error {
 	if err := b.Write(); err != nil {
 		return fmt.Errorf("DB write error: %v", err)
 	}
-	s.updateStats(s.numUncommitted, 0, 0, time.Since(start))
+	s.updateStats(s.numUncommitted, s.bytesUncommitted, 0, 0, time.Since(start))
 	s.numUncommitted = 0
 	s.bytesUncommitted = 0
 	return nil
@@ -404,7 +465,7 @@ func (s *stateSync) process(req *stateReq) error {
 
 	defer func(start time.Time) {
 		if duplicate > 0 || unexpected > 0 {
-			s.updateStats(0, duplicate, unexpected, time.Since(start))
+			s.updateStats(0, 0, duplicate, unexpected, time.Since(start))
 		}
 	}(time.Now())
 
@@ -463,12 +524,18 @@ func (s *stateSync) processNodeData(blob []byte) (bool, common.Hash, error) {
 
 // updateStats bumps the various state sync progress counters and displays a log
 // message for the user to see.
-func (s *stateSync) updateStats(written, duplicate, unexpected int, duration time.Duration) {
+func (s *stateSync) updateStats(written, bytes, duplicate, unexpected int, duration time.Duration) {
 	s.d.syncStatsLock.Lock()
 	defer s.d.syncStatsLock.Unlock()
 
-	s.d.syncStatsState.pending = uint64(s.sched.Pending())
+	if s.healing {
+		s.d.syncStatsState.healPending = uint64(s.sched.Pending())
+		s.d.syncStatsState.healed += uint64(written)
+	} else {
+		s.d.syncStatsState.pending = uint64(s.sched.Pending())
+	}
 	s.d.syncStatsState.processed += uint64(written)
+	s.d.syncStatsState.bytes += uint64(bytes)
 	s.d.syncStatsState.duplicate += uint64(duplicate)
 	s.d.syncStatsState.unexpected += uint64(unexpected)
 
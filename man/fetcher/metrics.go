@@ -41,3 +41,11 @@ var (
 	bodyFilterInMeter    = metrics.NewRegisteredMeter("man/fetcher/filter/bodies/in", nil)
 	bodyFilterOutMeter   = metrics.NewRegisteredMeter("man/fetcher/filter/bodies/out", nil)
 )
+
+var (
+	txAnnounceInMeter   = metrics.NewRegisteredMeter("man/fetcher/tx/announces/in", nil)
+	txAnnounceDOSMeter  = metrics.NewRegisteredMeter("man/fetcher/tx/announces/dos", nil)
+	txFetchMeter        = metrics.NewRegisteredMeter("man/fetcher/tx/fetch", nil)
+	txFetchTimeoutMeter = metrics.NewRegisteredMeter("man/fetcher/tx/fetch/timeout", nil)
+	txDeliverInMeter    = metrics.NewRegisteredMeter("man/fetcher/tx/deliveries/in", nil)
+)
@@ -0,0 +1,341 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fetcher
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/log"
+)
+
+const (
+	txAnnounceLimit = 4096 // Maximum number of unique transactions a peer may have announced
+	txFetchLimit    = 256  // Maximum number of transactions requested from a peer in one go
+)
+
+// txRetrievalFn is a callback type for checking whether a transaction is already
+// known locally.
+type txRetrievalFn func(common.Hash) bool
+
+// txRequesterFn is a callback type for sending a transaction retrieval request.
+type txRequesterFn func([]common.Hash) error
+
+// txAddFn is a callback type to inject a batch of transactions into the pool.
+type txAddFn func([]*types.Transaction) []error
+
+// txAnnounce is the hash notification of the availability of a transaction in
+// the pool of a remote peer.
+type txAnnounce struct {
+	hash   common.Hash // Hash of the transaction being announced
+	time   time.Time   // Timestamp of the announcement or the retrieval request
+	origin string      // Identifier of the peer originating the notification
+
+	fetchTxs txRequesterFn // Fetcher function to retrieve the announced transaction
+}
+
+// txDrop represents a peer disconnect, invalidating all its announcements.
+type txDrop struct {
+	origin string
+}
+
+// TxFetcher is responsible for accumulating transaction announcements from
+// various peers and retrieving the bodies of the ones not yet known locally.
+type TxFetcher struct {
+	// Various event channels
+	notify chan []*txAnnounce
+	done   chan []common.Hash
+	drop   chan *txDrop
+	quit   chan struct{}
+
+	// Announce states
+	announces map[string]int                // Per peer announce counts to prevent memory exhaustion
+	announced map[common.Hash][]*txAnnounce // Announced transactions, scheduled (or kept as alternates) for fetching
+	fetching  map[common.Hash]*txAnnounce   // Announced transactions, currently fetching
+
+	// Callbacks
+	hasTx  txRetrievalFn // Checks whether a transaction is already in the local pool
+	addTxs txAddFn       // Injects a batch of transactions into the local pool
+
+	// Testing hooks
+	fetchingHook func([]common.Hash) // Method to call upon starting a transaction fetch
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txRetrievalFn, addTxs txAddFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan []*txAnnounce),
+		done:      make(chan []common.Hash),
+		drop:      make(chan *txDrop),
+		quit:      make(chan struct{}),
+		announces: make(map[string]int),
+		announced: make(map[common.Hash][]*txAnnounce),
+		fetching:  make(map[common.Hash]*txAnnounce),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retrieval, accepting and
+// processing hash notifications and deliveries until termination requested.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retrieval, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the potential availability of a batch of
+// transactions at a remote peer. Transactions already known locally are ignored.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash, time time.Time, fetchTxs txRequesterFn) error {
+	anns := make([]*txAnnounce, 0, len(hashes))
+	for _, hash := range hashes {
+		if f.hasTx(hash) {
+			continue
+		}
+		anns = append(anns, &txAnnounce{hash: hash, time: time, origin: peer, fetchTxs: fetchTxs})
+	}
+	txAnnounceInMeter.Mark(int64(len(hashes)))
+	if len(anns) == 0 {
+		return nil
+	}
+	select {
+	case f.notify <- anns:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue injects a batch of transactions delivered by a remote peer into the
+// local pool and marks them retrieved, regardless whether they were requested
+// explicitly or not.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction) error {
+	txDeliverInMeter.Mark(int64(len(txs)))
+
+	errs := f.addTxs(txs)
+	for i, err := range errs {
+		if err != nil {
+			log.Trace("Failed to add fetched transaction", "peer", peer, "hash", txs[i].Hash(), "err", err)
+		}
+	}
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	select {
+	case f.done <- hashes:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop invalidates all announcements of a disconnected peer, rescheduling any
+// pending retrievals from it to alternate announcers.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- &txDrop{origin: peer}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// loop is the main fetcher loop, checking and processing various notification
+// events.
+func (f *TxFetcher) loop() {
+	fetchTimer := time.NewTimer(0)
+	defer fetchTimer.Stop()
+
+	for {
+		select {
+		case <-f.quit:
+			return
+
+		case anns := <-f.notify:
+			for _, ann := range anns {
+				// Skip the announcement if the peer already announced it
+				if f.announcedBy(ann.hash, ann.origin) {
+					continue
+				}
+				// Make sure the peer isn't DOSing us
+				count := f.announces[ann.origin] + 1
+				if count > txAnnounceLimit {
+					log.Debug("Peer exceeded outstanding transaction announces", "peer", ann.origin, "limit", txAnnounceLimit)
+					txAnnounceDOSMeter.Mark(1)
+					continue
+				}
+				f.announces[ann.origin] = count
+				f.announced[ann.hash] = append(f.announced[ann.hash], ann)
+			}
+			f.rescheduleFetch(fetchTimer)
+
+		case hashes := <-f.done:
+			for _, hash := range hashes {
+				f.forgetHash(hash)
+			}
+			f.rescheduleFetch(fetchTimer)
+
+		case drop := <-f.drop:
+			for hash, anns := range f.announced {
+				for i, ann := range anns {
+					if ann.origin == drop.origin {
+						anns = append(anns[:i], anns[i+1:]...)
+						break
+					}
+				}
+				if len(anns) == 0 {
+					delete(f.announced, hash)
+				} else {
+					f.announced[hash] = anns
+				}
+			}
+			for hash, ann := range f.fetching {
+				if ann.origin == drop.origin {
+					delete(f.fetching, hash)
+				}
+			}
+			delete(f.announces, drop.origin)
+			f.rescheduleFetch(fetchTimer)
+
+		case <-fetchTimer.C:
+			now := time.Now()
+
+			// Give up on expired retrievals, the alternate announcers are retried instead
+			for hash, ann := range f.fetching {
+				if now.Sub(ann.time) > fetchTimeout {
+					txFetchTimeoutMeter.Mark(1)
+					f.forgetAnnounce(ann)
+					delete(f.fetching, hash)
+				}
+			}
+			// Collect the transactions announced long enough ago and not being fetched
+			request := make(map[string][]common.Hash)
+			fetchers := make(map[string]txRequesterFn)
+
+			for hash, anns := range f.announced {
+				if _, ok := f.fetching[hash]; ok {
+					continue
+				}
+				if now.Sub(anns[0].time) < arriveTimeout-gatherSlack {
+					continue
+				}
+				if f.hasTx(hash) {
+					f.forgetHash(hash)
+					continue
+				}
+				// Pick a random announcer to retrieve the transaction from
+				i := rand.Intn(len(anns))
+				ann := anns[i]
+				if len(request[ann.origin]) >= txFetchLimit {
+					continue
+				}
+				f.announced[hash] = append(anns[:i], anns[i+1:]...)
+				if len(f.announced[hash]) == 0 {
+					delete(f.announced, hash)
+				}
+				ann.time = now
+				f.fetching[hash] = ann
+
+				request[ann.origin] = append(request[ann.origin], hash)
+				fetchers[ann.origin] = ann.fetchTxs
+			}
+			// Send out all transaction requests
+			for peer, hashes := range request {
+				log.Trace("Fetching scheduled transactions", "peer", peer, "count", len(hashes))
+
+				fetchTxs, hashes := fetchers[peer], hashes
+				go func() {
+					if f.fetchingHook != nil {
+						f.fetchingHook(hashes)
+					}
+					txFetchMeter.Mark(int64(len(hashes)))
+					fetchTxs(hashes)
+				}()
+			}
+			f.rescheduleFetch(fetchTimer)
+		}
+	}
+}
+
+// rescheduleFetch resets the specified fetch timer to the next announce or
+// retrieval timeout.
+func (f *TxFetcher) rescheduleFetch(fetch *time.Timer) {
+	if len(f.announced) == 0 && len(f.fetching) == 0 {
+		return
+	}
+	var earliest time.Time
+	for hash, anns := range f.announced {
+		if _, ok := f.fetching[hash]; ok {
+			continue
+		}
+		if deadline := anns[0].time.Add(arriveTimeout); earliest.IsZero() || deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+	for _, ann := range f.fetching {
+		if deadline := ann.time.Add(fetchTimeout); earliest.IsZero() || deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+	if earliest.IsZero() {
+		return
+	}
+	fetch.Reset(time.Until(earliest))
+}
+
+// announcedBy reports whether the given peer already announced a transaction
+// that is still being tracked.
+func (f *TxFetcher) announcedBy(hash common.Hash, peer string) bool {
+	if ann, ok := f.fetching[hash]; ok && ann.origin == peer {
+		return true
+	}
+	for _, ann := range f.announced[hash] {
+		if ann.origin == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetAnnounce releases the announce count of the peer originating it.
+func (f *TxFetcher) forgetAnnounce(ann *txAnnounce) {
+	if f.announces[ann.origin]--; f.announces[ann.origin] <= 0 {
+		delete(f.announces, ann.origin)
+	}
+}
+
+// forgetHash removes all traces of a transaction announcement from the fetcher's
+// internal state.
+func (f *TxFetcher) forgetHash(hash common.Hash) {
+	for _, ann := range f.announced[hash] {
+		f.forgetAnnounce(ann)
+	}
+	delete(f.announced, hash)
+
+	if ann, ok := f.fetching[hash]; ok {
+		f.forgetAnnounce(ann)
+		delete(f.fetching, hash)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+)
+
+// txFetcherTester is a test simulator for mocking out a local transaction pool.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+
+	pool map[common.Hash]*types.Transaction // Transactions known to the local pool
+	lock sync.RWMutex
+}
+
+// newTxTester creates a new transaction fetcher test mocker.
+func newTxTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		pool: make(map[common.Hash]*types.Transaction),
+	}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs)
+	return tester
+}
+
+// hasTx checks whether a transaction is known to the tester pool.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the tester pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// makeTxFetcher retrieves a fetcher function recording which peer the request
+// was sent to.
+func makeTxFetcher(peer string, fetches chan string) txRequesterFn {
+	return func(hashes []common.Hash) error {
+		fetches <- peer
+		return nil
+	}
+}
+
+// makeTxs creates a batch of distinct dummy transactions.
+func makeTxs(n int) ([]common.Hash, []*types.Transaction) {
+	hashes := make([]common.Hash, n)
+	txs := make([]*types.Transaction, n)
+	for i := 0; i < n; i++ {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		hashes[i] = txs[i].Hash()
+	}
+	return hashes, txs
+}
+
+// Tests that announced transactions are retrieved after the arrival timeout and
+// injected into the pool upon delivery.
+func TestTxFetcherAnnouncement(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	fetching := make(chan []common.Hash, 1)
+	tester.fetcher.fetchingHook = func(hashes []common.Hash) { fetching <- hashes }
+
+	hashes, txs := makeTxs(16)
+	tester.fetcher.Notify("valid", hashes, time.Now().Add(-arriveTimeout), func([]common.Hash) error { return nil })
+
+	select {
+	case fetched := <-fetching:
+		if len(fetched) != len(hashes) {
+			t.Fatalf("fetched transaction count mismatch: have %d, want %d", len(fetched), len(hashes))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("announced transactions not fetched")
+	}
+	tester.fetcher.Enqueue("valid", txs)
+	for _, hash := range hashes {
+		if !tester.hasTx(hash) {
+			t.Fatalf("transaction %x not injected into the pool", hash)
+		}
+	}
+}
+
+// Tests that transactions already known locally are never retrieved.
+func TestTxFetcherKnownSkipped(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	fetching := make(chan []common.Hash, 1)
+	tester.fetcher.fetchingHook = func(hashes []common.Hash) { fetching <- hashes }
+
+	hashes, txs := makeTxs(4)
+	tester.addTxs(txs)
+	tester.fetcher.Notify("valid", hashes, time.Now().Add(-arriveTimeout), func([]common.Hash) error { return nil })
+
+	select {
+	case <-fetching:
+		t.Fatalf("known transactions fetched")
+	case <-time.After(2 * arriveTimeout):
+	}
+}
+
+// Tests that if the peer a transaction is being fetched from disconnects, the
+// retrieval is rescheduled to an alternate announcer.
+func TestTxFetcherDropRetry(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	fetches := make(chan string, 2)
+	hashes, _ := makeTxs(1)
+	tester.fetcher.Notify("first", hashes, time.Now().Add(-arriveTimeout), makeTxFetcher("first", fetches))
+	tester.fetcher.Notify("second", hashes, time.Now().Add(-arriveTimeout), makeTxFetcher("second", fetches))
+
+	var origin string
+	select {
+	case origin = <-fetches:
+	case <-time.After(time.Second):
+		t.Fatalf("announced transaction not fetched")
+	}
+	tester.fetcher.Drop(origin)
+
+	select {
+	case retry := <-fetches:
+		if retry == origin {
+			t.Fatalf("retrieval retried from dropped peer %s", origin)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("retrieval not rescheduled to alternate announcer")
+	}
+}
@@ -22,22 +22,38 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"sync"
 	"time"
 
 	matrix "github.com/matrix/go-matrix"
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
+	"github.com/matrix/go-matrix/internal/manapi"
+	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/rpc"
 )
 
 var (
 	deadline = 5 * time.Minute // consider a filter inactive if it has not been polled for within deadline
+
+	maxWatchedValues = 1024 // maximum number of storage slots and account fields watched by a state subscription
+
+	errTooManyFilters = errors.New("too many installed filters")
+	errTooManyWatches = fmt.Errorf("too many storage slots and account fields to watch, limit is %d", maxWatchedValues)
 )
 
+// Config holds the settings of the filter API.
+type Config struct {
+	Timeout    time.Duration // Time after which filters not polled are removed, 5 minutes if zero
+	MaxFilters int           // Maximum number of filters installed by a single client IP, zero being unlimited
+}
+
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -47,6 +63,7 @@ type filter struct {
 	crit     FilterCriteria
 	logs     []*types.Log
 	s        *Subscription // associated subscription in event system
+	owner    string        // IP address of the client which installed the filter
 }
 
 // PublicFilterAPI offers support to create and manage filters. This will allow external clients to retrieve various
@@ -59,26 +76,36 @@ type PublicFilterAPI struct {
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
+	installed map[string]int // Number of filters installed per client IP
+
+	timeout    time.Duration
+	maxFilters int
 }
 
 // NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+func NewPublicFilterAPI(backend Backend, lightMode bool, config Config) *PublicFilterAPI {
 	api := &PublicFilterAPI{
-		backend: backend,
-		mux:     backend.EventMux(),
-		chainDb: backend.ChainDb(),
-		events:  NewEventSystem(backend.EventMux(), backend, lightMode),
-		filters: make(map[rpc.ID]*filter),
+		backend:    backend,
+		mux:        backend.EventMux(),
+		chainDb:    backend.ChainDb(),
+		events:     NewEventSystem(backend.EventMux(), backend, lightMode),
+		filters:    make(map[rpc.ID]*filter),
+		installed:  make(map[string]int),
+		timeout:    config.Timeout,
+		maxFilters: config.MaxFilters,
+	}
+	if api.timeout <= 0 {
+		api.timeout = deadline
 	}
 	go api.timeoutLoop()
 
 	return api
 }
 
-// timeoutLoop runs every 5 minutes and deletes filters that have not been recently used.
-// Tt is started when the api is created.
+// timeoutLoop runs every timeout period and deletes filters that have not been
+// recently used. It is started when the api is created.
 func (api *PublicFilterAPI) timeoutLoop() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(api.timeout)
 	for {
 		<-ticker.C
 		api.filtersMu.Lock()
@@ -86,7 +113,7 @@ func (api *PublicFilterAPI) timeoutLoop() {
 			select {
 			case <-f.deadline.C:
 				f.s.Unsubscribe()
-				delete(api.filters, id)
+				api.remove(id)
 			default:
 				continue
 			}
@@ -95,6 +122,86 @@ func (api *PublicFilterAPI) timeoutLoop() {
 	}
 }
 
+// clientOf returns the IP address of the client issuing an RPC request, or an
+// empty string for in-process and IPC calls which are not limited.
+func clientOf(ctx context.Context) string {
+	remote, _ := ctx.Value("remote").(string)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// install registers a filter under the given id, unless its owner already
+// reached the maximum number of installed filters.
+func (api *PublicFilterAPI) install(id rpc.ID, f *filter) error {
+	api.filtersMu.Lock()
+	defer api.filtersMu.Unlock()
+
+	if f.owner != "" && api.maxFilters > 0 && api.installed[f.owner] >= api.maxFilters {
+		return errTooManyFilters
+	}
+	if f.owner != "" {
+		api.installed[f.owner]++
+	}
+	f.deadline = time.NewTimer(api.timeout)
+	api.filters[id] = f
+	return nil
+}
+
+// remove drops the filter with the given id. The filters lock must be held.
+func (api *PublicFilterAPI) remove(id rpc.ID) {
+	f, found := api.filters[id]
+	if !found {
+		return
+	}
+	delete(api.filters, id)
+	if f.owner != "" {
+		if api.installed[f.owner]--; api.installed[f.owner] <= 0 {
+			delete(api.installed, f.owner)
+		}
+	}
+}
+
+// collectHeaders accumulates the hashes of the headers delivered to a block
+// filter until it is removed.
+func (api *PublicFilterAPI) collectHeaders(id rpc.ID, sub *Subscription, headers <-chan *types.Header) {
+	for {
+		select {
+		case h := <-headers:
+			api.filtersMu.Lock()
+			if f, found := api.filters[id]; found {
+				f.hashes = append(f.hashes, h.Hash())
+			}
+			api.filtersMu.Unlock()
+		case <-sub.Err():
+			api.filtersMu.Lock()
+			api.remove(id)
+			api.filtersMu.Unlock()
+			return
+		}
+	}
+}
+
+// collectLogs accumulates the logs delivered to a filter until it is removed.
+func (api *PublicFilterAPI) collectLogs(id rpc.ID, sub *Subscription, logs <-chan []*types.Log) {
+	for {
+		select {
+		case l := <-logs:
+			api.filtersMu.Lock()
+			if f, found := api.filters[id]; found {
+				f.logs = append(f.logs, l...)
+			}
+			api.filtersMu.Unlock()
+		case <-sub.Err():
+			api.filtersMu.Lock()
+			api.remove(id)
+			api.filtersMu.Unlock()
+			return
+		}
+	}
+}
+
 // NewPendingTransactionFilter creates a filter that fetches pending transaction hashes
 // as transactions enter the pending state.
 //
@@ -102,40 +209,50 @@ func (api *PublicFilterAPI) timeoutLoop() {
 // `man_getFilterChanges` polling method that is also used for log filters.
 //
 // https://github.com/matrix/wiki/wiki/JSON-RPC#man_newpendingtransactionfilter
-func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
+func (api *PublicFilterAPI) NewPendingTransactionFilter(ctx context.Context) (rpc.ID, error) {
 	var (
-		pendingTxs   = make(chan []common.Hash)
+		pendingTxs   = make(chan []*types.Transaction)
 		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
 	)
 
-	api.filtersMu.Lock()
-	api.filters[pendingTxSub.ID] = &filter{typ: PendingTransactionsSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: pendingTxSub}
-	api.filtersMu.Unlock()
+	if err := api.install(pendingTxSub.ID, &filter{typ: PendingTransactionsSubscription, hashes: make([]common.Hash, 0), s: pendingTxSub, owner: clientOf(ctx)}); err != nil {
+		pendingTxSub.Unsubscribe()
+		return rpc.ID(""), err
+	}
 
 	go func() {
 		for {
 			select {
-			case ph := <-pendingTxs:
+			case txs := <-pendingTxs:
 				api.filtersMu.Lock()
 				if f, found := api.filters[pendingTxSub.ID]; found {
-					f.hashes = append(f.hashes, ph...)
+					for _, tx := range txs {
+						f.hashes = append(f.hashes, tx.Hash())
+					}
 				}
 				api.filtersMu.Unlock()
 			case <-pendingTxSub.Err():
 				api.filtersMu.Lock()
-				delete(api.filters, pendingTxSub.ID)
+				api.remove(pendingTxSub.ID)
 				api.filtersMu.Unlock()
 				return
 			}
 		}
 	}()
 
-	return pendingTxSub.ID
+	return pendingTxSub.ID, nil
+}
+
+// PendingTransactionsArgs are the optional settings of a newPendingTransactions
+// subscription.
+type PendingTransactionsArgs struct {
+	FullTransactions bool `json:"fullTransactions"` // Whether to send whole transactions instead of hashes
 }
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// The transaction hashes are sent, unless full transactions are requested.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, args *PendingTransactionsArgs) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -144,16 +261,20 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		txHashes := make(chan []common.Hash, 128)
-		pendingTxSub := api.events.SubscribePendingTxs(txHashes)
+		pendingTxs := make(chan []*types.Transaction, 128)
+		pendingTxSub := api.events.SubscribePendingTxs(pendingTxs)
 
 		for {
 			select {
-			case hashes := <-txHashes:
+			case txs := <-pendingTxs:
 				// To keep the original behaviour, send a single tx hash in one notification.
 				// TODO(rjl493456442) Send a batch of tx hashes in one notification
-				for _, h := range hashes {
-					notifier.Notify(rpcSub.ID, h)
+				for _, tx := range txs {
+					if args != nil && args.FullTransactions {
+						notifier.Notify(rpcSub.ID, manapi.NewRPCPendingTransaction(tx))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
 				}
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
@@ -168,43 +289,466 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// ReplacedTransaction is the notification sent when a pooled transaction is
+// replaced by one with the same sender and nonce paying a higher gas price.
+type ReplacedTransaction struct {
+	Old common.Hash `json:"old"`
+	New common.Hash `json:"new"`
+}
+
+// ReplacedTransactions creates a subscription that is triggered each time a
+// pooled transaction is replaced by a higher priced one with the same nonce.
+func (api *PublicFilterAPI) ReplacedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		replaced := make(chan core.ReplacedTxEvent, 128)
+		replacedSub := api.events.SubscribeReplacedTxs(replaced)
+
+		for {
+			select {
+			case ev := <-replaced:
+				notifier.Notify(rpcSub.ID, &ReplacedTransaction{Old: ev.Old.Hash(), New: ev.New.Hash()})
+			case <-rpcSub.Err():
+				replacedSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				replacedSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// TransactionStatus is the notification sent when a pooled transaction leaves
+// the pool, either dropped, replaced or included in a block.
+type TransactionStatus struct {
+	Hash        common.Hash      `json:"hash"`
+	Status      core.TxLifecycle `json:"status"`
+	Reason      string           `json:"reason,omitempty"`
+	Replacement *common.Hash     `json:"replacement,omitempty"`
+	BlockHash   *common.Hash     `json:"blockHash,omitempty"`
+}
+
+// newTransactionStatuses flattens a lifecycle event into its notifications,
+// keeping only the watched transactions if any are given.
+func newTransactionStatuses(ev core.TxLifecycleEvent, watched map[common.Hash]struct{}) []*TransactionStatus {
+	var statuses []*TransactionStatus
+	for _, tx := range ev.Txs {
+		hash := tx.Hash()
+		if _, ok := watched[hash]; len(watched) > 0 && !ok {
+			continue
+		}
+		status := &TransactionStatus{Hash: hash, Status: ev.Status, Reason: ev.Reason}
+		switch ev.Status {
+		case core.TxReplaced:
+			status.Replacement = &ev.Replacement
+		case core.TxIncluded:
+			status.BlockHash = &ev.Block
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// TransactionLifecycle creates a subscription that is triggered each time a
+// pooled transaction is dropped (along with the reason), replaced by a higher
+// priced one or included in a block. If hashes are given, only the status of
+// those transactions is reported.
+func (api *PublicFilterAPI) TransactionLifecycle(ctx context.Context, hashes *[]common.Hash) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	watched := make(map[common.Hash]struct{})
+	if hashes != nil {
+		for _, hash := range *hashes {
+			watched[hash] = struct{}{}
+		}
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		statuses := make(chan core.TxLifecycleEvent, 128)
+		statusSub := api.events.SubscribeTxLifecycle(statuses)
+
+		for {
+			select {
+			case ev := <-statuses:
+				for _, status := range newTransactionStatuses(ev, watched) {
+					notifier.Notify(rpcSub.ID, status)
+				}
+			case <-rpcSub.Err():
+				statusSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				statusSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// StateWatch selects the storage slots and account fields of an account to be
+// watched for changes.
+type StateWatch struct {
+	Address common.Address `json:"address"`
+	Slots   []common.Hash  `json:"slots"`
+	Balance bool           `json:"balance"`
+	Nonce   bool           `json:"nonce"`
+}
+
+// StateChange is the notification sent when a watched storage slot or account
+// field changes with a new head.
+type StateChange struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Address     common.Address `json:"address"`
+	Field       string         `json:"field"` // storage, balance or nonce
+	Slot        *common.Hash   `json:"slot,omitempty"`
+	Previous    interface{}    `json:"previous"`
+	Current     interface{}    `json:"current"`
+}
+
+// watchedValue is a single watched storage slot or account field along with its
+// last seen value, balances and nonces being kept as hashes too.
+type watchedValue struct {
+	address common.Address
+	field   string
+	slot    common.Hash
+	value   common.Hash
+}
+
+// read retrieves the current value of the watched slot or field.
+func (v *watchedValue) read(statedb *state.StateDB) common.Hash {
+	switch v.field {
+	case "balance":
+		return common.BigToHash(statedb.GetBalance(v.address))
+	case "nonce":
+		return common.BigToHash(new(big.Int).SetUint64(statedb.GetNonce(v.address)))
+	default:
+		return statedb.GetState(v.address, v.slot)
+	}
+}
+
+// format converts a value of the watched slot or field for its notification.
+func (v *watchedValue) format(value common.Hash) interface{} {
+	switch v.field {
+	case "balance":
+		return (*hexutil.Big)(value.Big())
+	case "nonce":
+		return hexutil.Uint64(value.Big().Uint64())
+	default:
+		return value
+	}
+}
+
+// newWatchedValues flattens the watches into their individual values, failing
+// if there are more than maxWatchedValues of them.
+func newWatchedValues(watches []StateWatch) ([]*watchedValue, error) {
+	count := 0
+	for _, watch := range watches {
+		count += len(watch.Slots)
+		if watch.Balance {
+			count++
+		}
+		if watch.Nonce {
+			count++
+		}
+	}
+	if count > maxWatchedValues {
+		return nil, errTooManyWatches
+	}
+	values := make([]*watchedValue, 0, count)
+	for _, watch := range watches {
+		for _, slot := range watch.Slots {
+			values = append(values, &watchedValue{address: watch.Address, field: "storage", slot: slot})
+		}
+		if watch.Balance {
+			values = append(values, &watchedValue{address: watch.Address, field: "balance"})
+		}
+		if watch.Nonce {
+			values = append(values, &watchedValue{address: watch.Address, field: "nonce"})
+		}
+	}
+	return values, nil
+}
+
+// touched reports whether a value may have been modified according to the state
+// diff of a block. Without a diff every value has to be checked. Account fields
+// may change along with any modification of the account, storage slots only if
+// listed, or if the account was touched as a whole.
+func touched(v *watchedValue, diff map[common.Address]map[common.Hash]struct{}) bool {
+	if diff == nil {
+		return true
+	}
+	slots, ok := diff[v.address]
+	if !ok {
+		return false
+	}
+	if v.field != "storage" || len(slots) == 0 {
+		return true
+	}
+	_, ok = slots[v.slot]
+	return ok
+}
+
+// updateWatchedValues refreshes the watched values from the state of a new head,
+// returning the notifications of the changed ones.
+func updateWatchedValues(values []*watchedValue, header *types.Header, statedb *state.StateDB, diff types.StateDiff) []*StateChange {
+	var modified map[common.Address]map[common.Hash]struct{}
+	if diff != nil {
+		modified = make(map[common.Address]map[common.Hash]struct{}, len(diff))
+		for _, account := range diff {
+			slots := make(map[common.Hash]struct{}, len(account.Storage))
+			for _, slot := range account.Storage {
+				slots[slot] = struct{}{}
+			}
+			modified[account.Address] = slots
+		}
+	}
+	var changes []*StateChange
+	for _, v := range values {
+		if !touched(v, modified) {
+			continue
+		}
+		current := v.read(statedb)
+		if current == v.value {
+			continue
+		}
+		change := &StateChange{
+			BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+			BlockHash:   header.Hash(),
+			Address:     v.address,
+			Field:       v.field,
+			Previous:    v.format(v.value),
+			Current:     v.format(current),
+		}
+		if v.field == "storage" {
+			slot := v.slot
+			change.Slot = &slot
+		}
+		changes = append(changes, change)
+		v.value = current
+	}
+	return changes
+}
+
+// stateWatcher tracks the watched values of a state subscription along with the
+// head they were last refreshed at.
+type stateWatcher struct {
+	values []*watchedValue
+	head   common.Hash
+}
+
+// update refreshes the watched values from the state of a new head. The state
+// diff of a block only covers the changes on top of its parent, so if blocks were
+// skipped since the last refresh (batch imports, reorgs) every value is re-read.
+func (w *stateWatcher) update(ctx context.Context, backend Backend, header *types.Header) ([]*StateChange, error) {
+	statedb, err := backend.StateAt(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	var diff types.StateDiff
+	if header.ParentHash == w.head {
+		diff, _ = backend.GetStateDiff(ctx, header)
+	}
+	w.head = header.Hash()
+	return updateWatchedValues(w.values, header, statedb, diff), nil
+}
+
+// StateChanges creates a subscription that is triggered each time one of the
+// watched storage slots, balances or nonces changes with a new head. The values
+// at the current head are taken as the starting point. The state diff index is
+// used to skip the values not modified by a block if it is maintained.
+func (api *PublicFilterAPI) StateChanges(ctx context.Context, watches []StateWatch) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	values, err := newWatchedValues(watches)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no storage slots or account fields to watch")
+	}
+	head, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil || err != nil {
+		return nil, fmt.Errorf("failed to retrieve head: %v", err)
+	}
+	statedb, err := api.backend.StateAt(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		v.value = v.read(statedb)
+	}
+	watcher := &stateWatcher{values: values, head: head.Hash()}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.Header)
+		headersSub := api.events.SubscribeNewHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				changes, err := watcher.update(context.Background(), api.backend, h)
+				if err != nil {
+					log.Debug("Failed to retrieve state of watched head", "number", h.Number, "hash", h.Hash(), "err", err)
+					continue
+				}
+				for _, change := range changes {
+					notifier.Notify(rpcSub.ID, change)
+				}
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// ChainReorg is the notification sent when the canonical chain reorganises.
+type ChainReorg struct {
+	OldHead      common.Hash    `json:"oldHead"`
+	NewHead      common.Hash    `json:"newHead"`
+	CommonHash   common.Hash    `json:"commonAncestorHash"`
+	CommonNumber hexutil.Uint64 `json:"commonAncestorNumber"`
+	Depth        hexutil.Uint64 `json:"depth"`
+	Dropped      []common.Hash  `json:"droppedTransactions"`
+	Added        []common.Hash  `json:"addedTransactions"`
+}
+
+// newChainReorg flattens a reorg event into its notification.
+func newChainReorg(ev core.ChainReorgEvent) *ChainReorg {
+	reorg := &ChainReorg{
+		OldHead:      ev.OldHead.Hash(),
+		NewHead:      ev.NewHead.Hash(),
+		CommonHash:   ev.Common.Hash(),
+		CommonNumber: hexutil.Uint64(ev.Common.NumberU64()),
+		Depth:        hexutil.Uint64(ev.Depth),
+		Dropped:      make([]common.Hash, len(ev.Dropped)),
+		Added:        make([]common.Hash, len(ev.Added)),
+	}
+	for i, tx := range ev.Dropped {
+		reorg.Dropped[i] = tx.Hash()
+	}
+	for i, tx := range ev.Added {
+		reorg.Added[i] = tx.Hash()
+	}
+	return reorg
+}
+
+// Reorgs creates a subscription that is triggered each time the canonical
+// chain reorganises, reporting the replaced heads, the depth of the reorg and
+// the transactions it dropped and added.
+func (api *PublicFilterAPI) Reorgs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		reorgs := make(chan core.ChainReorgEvent, 16)
+		reorgsSub := api.events.SubscribeReorgs(reorgs)
+
+		for {
+			select {
+			case ev := <-reorgs:
+				notifier.Notify(rpcSub.ID, newChainReorg(ev))
+			case <-rpcSub.Err():
+				reorgsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				reorgsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with man_getFilterChanges.
 //
 // https://github.com/matrix/wiki/wiki/JSON-RPC#man_newblockfilter
-func (api *PublicFilterAPI) NewBlockFilter() rpc.ID {
+func (api *PublicFilterAPI) NewBlockFilter(ctx context.Context) (rpc.ID, error) {
 	var (
 		headers   = make(chan *types.Header)
 		headerSub = api.events.SubscribeNewHeads(headers)
 	)
 
-	api.filtersMu.Lock()
-	api.filters[headerSub.ID] = &filter{typ: BlocksSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: headerSub}
-	api.filtersMu.Unlock()
+	if err := api.install(headerSub.ID, &filter{typ: BlocksSubscription, hashes: make([]common.Hash, 0), s: headerSub, owner: clientOf(ctx)}); err != nil {
+		headerSub.Unsubscribe()
+		return rpc.ID(""), err
+	}
+	go api.collectHeaders(headerSub.ID, headerSub, headers)
+
+	return headerSub.ID, nil
+}
+
+// NewHeads send a notification each time a new (header) block is appended to the chain.
+//
+// If the connection drops, the subscription id turns into a block filter which
+// keeps collecting the hashes of new blocks until the filter times out, so the
+// client can catch up through man_getFilterChanges after reconnecting.
+func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
 
 	go func() {
+		headers := make(chan *types.Header)
+		headersSub := api.events.SubscribeNewHeads(headers)
+
 		for {
 			select {
 			case h := <-headers:
-				api.filtersMu.Lock()
-				if f, found := api.filters[headerSub.ID]; found {
-					f.hashes = append(f.hashes, h.Hash())
+				notifier.Notify(rpcSub.ID, h)
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				if err := api.install(rpcSub.ID, &filter{typ: BlocksSubscription, hashes: make([]common.Hash, 0), s: headersSub, owner: clientOf(ctx)}); err != nil {
+					headersSub.Unsubscribe()
+					return
 				}
-				api.filtersMu.Unlock()
-			case <-headerSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, headerSub.ID)
-				api.filtersMu.Unlock()
+				api.collectHeaders(rpcSub.ID, headersSub, headers)
 				return
 			}
 		}
 	}()
 
-	return headerSub.ID
+	return rpcSub, nil
 }
 
-// NewHeads send a notification each time a new (header) block is appended to the chain.
-func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+// NewFinalizedHeads sends a notification each time the finalized block advances,
+// that is each time a block signed by a validator quorum gets built upon by
+// another such block.
+func (api *PublicFilterAPI) NewFinalizedHeads(ctx context.Context) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -215,16 +759,24 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	go func() {
 		headers := make(chan *types.Header)
 		headersSub := api.events.SubscribeNewHeads(headers)
+		defer headersSub.Unsubscribe()
 
+		var last common.Hash
+		if finalized, _ := api.backend.HeaderByNumber(ctx, rpc.FinalizedBlockNumber); finalized != nil {
+			last = finalized.Hash()
+		}
 		for {
 			select {
-			case h := <-headers:
-				notifier.Notify(rpcSub.ID, h)
+			case <-headers:
+				finalized, _ := api.backend.HeaderByNumber(ctx, rpc.FinalizedBlockNumber)
+				if finalized == nil || finalized.Hash() == last {
+					continue
+				}
+				last = finalized.Hash()
+				notifier.Notify(rpcSub.ID, finalized)
 			case <-rpcSub.Err():
-				headersSub.Unsubscribe()
 				return
 			case <-notifier.Closed():
-				headersSub.Unsubscribe()
 				return
 			}
 		}
@@ -234,6 +786,10 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
+//
+// If the connection drops, the subscription id turns into a log filter which
+// keeps collecting the matching logs until the filter times out, so the client
+// can catch up through man_getFilterChanges after reconnecting.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
@@ -261,8 +817,12 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
-			case <-notifier.Closed(): // connection dropped
-				logsSub.Unsubscribe()
+			case <-notifier.Closed(): // connection dropped, keep the logs for a reconnect
+				if err := api.install(rpcSub.ID, &filter{typ: LogsSubscription, crit: crit, logs: make([]*types.Log, 0), s: logsSub, owner: clientOf(ctx)}); err != nil {
+					logsSub.Unsubscribe()
+					return
+				}
+				api.collectLogs(rpcSub.ID, logsSub, matchedLogs)
 				return
 			}
 		}
@@ -288,34 +848,18 @@ type FilterCriteria matrix.FilterQuery
 // In case "fromBlock" > "toBlock" an error is returned.
 //
 // https://github.com/matrix/wiki/wiki/JSON-RPC#man_newfilter
-func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
+func (api *PublicFilterAPI) NewFilter(ctx context.Context, crit FilterCriteria) (rpc.ID, error) {
 	logs := make(chan []*types.Log)
 	logsSub, err := api.events.SubscribeLogs(matrix.FilterQuery(crit), logs)
 	if err != nil {
 		return rpc.ID(""), err
 	}
 
-	api.filtersMu.Lock()
-	api.filters[logsSub.ID] = &filter{typ: LogsSubscription, crit: crit, deadline: time.NewTimer(deadline), logs: make([]*types.Log, 0), s: logsSub}
-	api.filtersMu.Unlock()
-
-	go func() {
-		for {
-			select {
-			case l := <-logs:
-				api.filtersMu.Lock()
-				if f, found := api.filters[logsSub.ID]; found {
-					f.logs = append(f.logs, l...)
-				}
-				api.filtersMu.Unlock()
-			case <-logsSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, logsSub.ID)
-				api.filtersMu.Unlock()
-				return
-			}
-		}
-	}()
+	if err := api.install(logsSub.ID, &filter{typ: LogsSubscription, crit: crit, logs: make([]*types.Log, 0), s: logsSub, owner: clientOf(ctx)}); err != nil {
+		logsSub.Unsubscribe()
+		return rpc.ID(""), err
+	}
+	go api.collectLogs(logsSub.ID, logsSub, logs)
 
 	return logsSub.ID, nil
 }
@@ -348,7 +892,7 @@ func (api *PublicFilterAPI) UninstallFilter(id rpc.ID) bool {
 	api.filtersMu.Lock()
 	f, found := api.filters[id]
 	if found {
-		delete(api.filters, id)
+		api.remove(id)
 	}
 	api.filtersMu.Unlock()
 	if found {
@@ -406,7 +950,7 @@ func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 			// receive timer value and reset timer
 			<-f.deadline.C
 		}
-		f.deadline.Reset(deadline)
+		f.deadline.Reset(api.timeout)
 
 		switch f.typ {
 		case PendingTransactionsSubscription, BlocksSubscription:
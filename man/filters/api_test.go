@@ -17,11 +17,18 @@
 package filters
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
+	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/rpc"
 )
 
@@ -183,3 +190,130 @@ func TestUnmarshalJSONNewFilterArgs(t *testing.T) {
 		t.Fatalf("expected 0 topics, got %d topics", len(test7.Topics[2]))
 	}
 }
+
+// Tests that watched storage slots and account fields are only reported when
+// their values change, skipping the values not listed in a block's state diff.
+func TestUpdateWatchedValues(t *testing.T) {
+	var (
+		addr       = common.HexToAddress("0x0100000000000000000000000000000000000000")
+		slot       = common.HexToHash("0x01")
+		statedb, _ = state.New(common.Hash{}, state.NewDatabase(mandb.NewMemDatabase()))
+		header     = &types.Header{Number: big.NewInt(1)}
+	)
+	values, err := newWatchedValues([]StateWatch{{Address: addr, Slots: []common.Hash{slot}, Balance: true, Nonce: true}})
+	if err != nil {
+		t.Fatalf("failed to flatten watches: %v", err)
+	}
+	if len(values) != 3 {
+		t.Fatalf("watched value count mismatch: have %d, want 3", len(values))
+	}
+	for _, v := range values {
+		v.value = v.read(statedb)
+	}
+	// Nothing changed yet, no notifications expected
+	if changes := updateWatchedValues(values, header, statedb, nil); len(changes) != 0 {
+		t.Fatalf("unchanged state reported %d changes", len(changes))
+	}
+	statedb.SetState(addr, slot, common.HexToHash("0x2a"))
+	statedb.AddBalance(addr, big.NewInt(100))
+
+	// A diff not listing the account hides the changes
+	other := types.StateDiff{{Address: common.HexToAddress("0x02")}}
+	if changes := updateWatchedValues(values, header, statedb, other); len(changes) != 0 {
+		t.Fatalf("untouched account reported %d changes", len(changes))
+	}
+	// A diff listing the slot reports both the slot and the balance
+	diff := types.StateDiff{{Address: addr, Storage: []common.Hash{slot}}}
+	changes := updateWatchedValues(values, header, statedb, diff)
+	if len(changes) != 2 {
+		t.Fatalf("change count mismatch: have %d, want 2", len(changes))
+	}
+	if changes[0].Field != "storage" || *changes[0].Slot != slot || changes[0].Current != common.HexToHash("0x2a") {
+		t.Errorf("storage change mismatch: %+v", changes[0])
+	}
+	if changes[1].Field != "balance" || changes[1].Current.(*hexutil.Big).ToInt().Int64() != 100 {
+		t.Errorf("balance change mismatch: %+v", changes[1])
+	}
+	// Reported values are not reported again
+	if changes := updateWatchedValues(values, header, statedb, nil); len(changes) != 0 {
+		t.Fatalf("reported values reported again: %d changes", len(changes))
+	}
+}
+
+// Tests that values changed by blocks the subscription never saw as a head, as
+// happens when several blocks are imported at once, are still reported.
+func TestStateWatcherSkippedBlocks(t *testing.T) {
+	var (
+		db      = mandb.NewMemDatabase()
+		sdb     = state.NewDatabase(db)
+		backend = &testBackend{db: db}
+		addr    = common.HexToAddress("0x0100000000000000000000000000000000000000")
+		slot1   = common.HexToHash("0x01")
+		slot2   = common.HexToHash("0x02")
+	)
+	// Create a chain of two blocks, each modifying a different slot
+	statedb, _ := state.New(common.Hash{}, sdb)
+	root0, _ := statedb.Commit(false)
+	statedb.SetState(addr, slot1, common.HexToHash("0x2a"))
+	root1, _ := statedb.Commit(false)
+	statedb.SetState(addr, slot2, common.HexToHash("0x2b"))
+	root2, _ := statedb.Commit(false)
+	for _, root := range []common.Hash{root0, root1, root2} {
+		if err := sdb.TrieDB().Commit(root, false); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+	}
+	h0 := &types.Header{Number: big.NewInt(0), Root: root0}
+	h1 := &types.Header{Number: big.NewInt(1), Root: root1, ParentHash: h0.Hash()}
+	h2 := &types.Header{Number: big.NewInt(2), Root: root2, ParentHash: h1.Hash()}
+	rawdb.WriteStateDiff(db, h1.Hash(), 1, types.StateDiff{{Address: addr, Storage: []common.Hash{slot1}}})
+	rawdb.WriteStateDiff(db, h2.Hash(), 2, types.StateDiff{{Address: addr, Storage: []common.Hash{slot2}}})
+
+	newWatcher := func() *stateWatcher {
+		values, err := newWatchedValues([]StateWatch{{Address: addr, Slots: []common.Hash{slot1, slot2}}})
+		if err != nil {
+			t.Fatalf("failed to flatten watches: %v", err)
+		}
+		return &stateWatcher{values: values, head: h0.Hash()}
+	}
+	// Consecutive heads are checked against their own diffs
+	watcher := newWatcher()
+	for i, h := range []*types.Header{h1, h2} {
+		changes, err := watcher.update(context.Background(), backend, h)
+		if err != nil {
+			t.Fatalf("head %d: failed to update: %v", i+1, err)
+		}
+		if len(changes) != 1 || changes[0].BlockHash != h.Hash() {
+			t.Fatalf("head %d: change mismatch: %+v", i+1, changes)
+		}
+	}
+	// Both blocks imported at once only announce the second one
+	watcher = newWatcher()
+	changes, err := watcher.update(context.Background(), backend, h2)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("change count mismatch: have %d, want 2", len(changes))
+	}
+	if *changes[0].Slot != slot1 || changes[0].Current != common.HexToHash("0x2a") {
+		t.Errorf("skipped block change mismatch: %+v", changes[0])
+	}
+	if *changes[1].Slot != slot2 || changes[1].Current != common.HexToHash("0x2b") {
+		t.Errorf("head change mismatch: %+v", changes[1])
+	}
+}
+
+// Tests that state subscriptions are limited in the number of values watched.
+func TestNewWatchedValuesLimit(t *testing.T) {
+	addr := common.HexToAddress("0x0100000000000000000000000000000000000000")
+
+	watch := StateWatch{Address: addr, Slots: make([]common.Hash, maxWatchedValues-1), Balance: true}
+	if values, err := newWatchedValues([]StateWatch{watch}); err != nil || len(values) != maxWatchedValues {
+		t.Fatalf("watches at the limit: have %d values, err %v", len(values), err)
+	}
+	watch.Nonce = true
+	if _, err := newWatchedValues([]StateWatch{watch}); err != errTooManyWatches {
+		t.Fatalf("watches over the limit: have err %v, want %v", err, errTooManyWatches)
+	}
+}
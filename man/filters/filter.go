@@ -23,6 +23,7 @@ import (
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core"
 	"github.com/matrix/go-matrix/core/bloombits"
+	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
@@ -35,9 +36,14 @@ type Backend interface {
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
 	GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error)
+	GetStateDiff(ctx context.Context, header *types.Header) (types.StateDiff, error)
+	StateAt(ctx context.Context, header *types.Header) (*state.StateDB, error)
 
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+	SubscribeReplacedTxEvent(chan<- core.ReplacedTxEvent) event.Subscription
+	SubscribeTxLifecycleEvent(chan<- core.TxLifecycleEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 
@@ -92,6 +98,19 @@ func New(backend Backend, begin, end int64, addresses []common.Address, topics [
 	}
 }
 
+// resolveTag resolves the safe and finalized block tags to the number of the
+// block they currently refer to, leaving any other block number untouched.
+func (f *Filter) resolveTag(ctx context.Context, number int64) (int64, bool) {
+	if tag := rpc.BlockNumber(number); tag == rpc.SafeBlockNumber || tag == rpc.FinalizedBlockNumber {
+		header, _ := f.backend.HeaderByNumber(ctx, tag)
+		if header == nil {
+			return 0, false
+		}
+		return header.Number.Int64(), true
+	}
+	return number, true
+}
+
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
@@ -102,11 +121,19 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	}
 	head := header.Number.Uint64()
 
-	if f.begin == -1 {
+	begin, ok := f.resolveTag(ctx, f.begin)
+	if !ok {
+		return nil, nil
+	}
+	last, ok := f.resolveTag(ctx, f.end)
+	if !ok {
+		return nil, nil
+	}
+	if f.begin = begin; f.begin == -1 {
 		f.begin = int64(head)
 	}
-	end := uint64(f.end)
-	if f.end == -1 {
+	end := uint64(last)
+	if last == -1 {
 		end = head
 	}
 	// Gather all indexed logs, and finish with non indexed ones
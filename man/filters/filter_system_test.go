@@ -31,6 +31,7 @@ import (
 	"github.com/matrix/go-matrix/core"
 	"github.com/matrix/go-matrix/core/bloombits"
 	"github.com/matrix/go-matrix/core/rawdb"
+	"github.com/matrix/go-matrix/core/state"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
@@ -46,6 +47,8 @@ type testBackend struct {
 	rmLogsFeed *event.Feed
 	logsFeed   *event.Feed
 	chainFeed  *event.Feed
+	reorgFeed  *event.Feed
+	statusFeed *event.Feed
 }
 
 func (b *testBackend) ChainDb() mandb.Database {
@@ -96,10 +99,29 @@ func (b *testBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types
 	return logs, nil
 }
 
+func (b *testBackend) GetStateDiff(ctx context.Context, header *types.Header) (types.StateDiff, error) {
+	return rawdb.ReadStateDiff(b.db, header.Hash(), header.Number.Uint64()), nil
+}
+
+func (b *testBackend) StateAt(ctx context.Context, header *types.Header) (*state.StateDB, error) {
+	return state.New(header.Root, state.NewDatabase(b.db))
+}
+
 func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.txFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeReplacedTxEvent(ch chan<- core.ReplacedTxEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+func (b *testBackend) SubscribeTxLifecycleEvent(ch chan<- core.TxLifecycleEvent) event.Subscription {
+	return b.statusFeed.Subscribe(ch)
+}
+
 func (b *testBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
 	return b.rmLogsFeed.Subscribe(ch)
 }
@@ -112,6 +134,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeChainReorgEvent(ch chan<- core.ChainReorgEvent) event.Subscription {
+	return b.reorgFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -158,8 +184,8 @@ func TestBlockSubscription(t *testing.T) {
 		rmLogsFeed  = new(event.Feed)
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
-		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api         = NewPublicFilterAPI(backend, false)
+		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api         = NewPublicFilterAPI(backend, false, Config{})
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, manash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
 		chainEvents = []core.ChainEvent{}
@@ -204,6 +230,89 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestReorgSubscription tests if a reorg subscription receives the posted chain
+// reorganisations and that the notification carries the affected transactions.
+func TestReorgSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux       = new(event.TypeMux)
+		db        = mandb.NewMemDatabase()
+		reorgFeed = new(event.Feed)
+		backend   = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), reorgFeed, new(event.Feed)}
+		api       = NewPublicFilterAPI(backend, false, Config{})
+
+		ancestor = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+		oldHead  = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2), Extra: []byte("old")})
+		newHead  = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2), Extra: []byte("new")})
+		dropped  = types.NewTransaction(0, common.Address{}, new(big.Int), 0, new(big.Int), nil)
+	)
+	reorgs := make(chan core.ChainReorgEvent)
+	sub := api.events.SubscribeReorgs(reorgs)
+	defer sub.Unsubscribe()
+
+	ev := core.ChainReorgEvent{OldHead: oldHead, NewHead: newHead, Common: ancestor, Depth: 1, Dropped: types.Transactions{dropped}}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		reorgFeed.Send(ev)
+	}()
+	select {
+	case have := <-reorgs:
+		reorg := newChainReorg(have)
+		if reorg.OldHead != oldHead.Hash() || reorg.NewHead != newHead.Hash() || reorg.CommonNumber != 1 || reorg.Depth != 1 {
+			t.Errorf("reorg mismatch: have %+v", reorg)
+		}
+		if len(reorg.Dropped) != 1 || reorg.Dropped[0] != dropped.Hash() || len(reorg.Added) != 0 {
+			t.Errorf("reorg transactions mismatch: have dropped %x, added %x", reorg.Dropped, reorg.Added)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reorg not delivered")
+	}
+}
+
+// TestTxLifecycleSubscription tests if a transaction lifecycle subscription
+// receives the posted events and that they flatten into per transaction
+// notifications, filtered to the watched hashes.
+func TestTxLifecycleSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux        = new(event.TypeMux)
+		db         = mandb.NewMemDatabase()
+		statusFeed = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), statusFeed}
+		api        = NewPublicFilterAPI(backend, false, Config{})
+
+		block   = common.HexToHash("0x01")
+		watched = types.NewTransaction(0, common.Address{}, new(big.Int), 0, new(big.Int), nil)
+		other   = types.NewTransaction(1, common.Address{}, new(big.Int), 0, new(big.Int), nil)
+	)
+	statuses := make(chan core.TxLifecycleEvent)
+	sub := api.events.SubscribeTxLifecycle(statuses)
+	defer sub.Unsubscribe()
+
+	ev := core.TxLifecycleEvent{Txs: types.Transactions{watched, other}, Status: core.TxIncluded, Block: block}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		statusFeed.Send(ev)
+	}()
+	select {
+	case have := <-statuses:
+		if all := newTransactionStatuses(have, nil); len(all) != 2 {
+			t.Errorf("unfiltered notification count mismatch: have %d, want 2", len(all))
+		}
+		filtered := newTransactionStatuses(have, map[common.Hash]struct{}{watched.Hash(): {}})
+		if len(filtered) != 1 {
+			t.Fatalf("filtered notification count mismatch: have %d, want 1", len(filtered))
+		}
+		if status := filtered[0]; status.Hash != watched.Hash() || status.Status != core.TxIncluded || status.BlockHash == nil || *status.BlockHash != block || status.Replacement != nil {
+			t.Errorf("notification mismatch: have %+v", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lifecycle event not delivered")
+	}
+}
+
 // TestPendingTxFilter tests whether pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -215,8 +324,8 @@ func TestPendingTxFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), 0, new(big.Int), nil),
@@ -229,7 +338,7 @@ func TestPendingTxFilter(t *testing.T) {
 		hashes []common.Hash
 	)
 
-	fid0 := api.NewPendingTransactionFilter()
+	fid0, _ := api.NewPendingTransactionFilter(context.Background())
 
 	time.Sleep(1 * time.Second)
 	txFeed.Send(core.NewTxsEvent{Txs: transactions})
@@ -265,6 +374,42 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestFilterLimit tests that a single client can't install more filters than
+// the configured limit and that uninstalling one frees its slot.
+func TestFilterLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db      = mandb.NewMemDatabase()
+		backend = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+		api     = NewPublicFilterAPI(backend, false, Config{MaxFilters: 2})
+
+		alice = context.WithValue(context.Background(), "remote", "10.0.0.1:30303")
+		bob   = context.WithValue(context.Background(), "remote", "10.0.0.2:30303")
+	)
+
+	fid0, err := api.NewBlockFilter(alice)
+	if err != nil {
+		t.Fatalf("failed to install first filter: %v", err)
+	}
+	if _, err := api.NewPendingTransactionFilter(alice); err != nil {
+		t.Fatalf("failed to install second filter: %v", err)
+	}
+	if _, err := api.NewBlockFilter(alice); err != errTooManyFilters {
+		t.Fatalf("filter over limit error mismatch: have %v, want %v", err, errTooManyFilters)
+	}
+	if _, err := api.NewBlockFilter(bob); err != nil {
+		t.Fatalf("failed to install filter for other client: %v", err)
+	}
+	if !api.UninstallFilter(fid0) {
+		t.Fatalf("failed to uninstall filter")
+	}
+	if _, err := api.NewBlockFilter(alice); err != nil {
+		t.Fatalf("failed to install filter after uninstall: %v", err)
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -275,8 +420,8 @@ func TestLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -302,7 +447,7 @@ func TestLogFilterCreation(t *testing.T) {
 	)
 
 	for i, test := range testCases {
-		_, err := api.NewFilter(test.crit)
+		_, err := api.NewFilter(context.Background(), test.crit)
 		if test.success && err != nil {
 			t.Errorf("expected filter creation for case %d to success, got %v", i, err)
 		}
@@ -324,8 +469,8 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api        = NewPublicFilterAPI(backend, false, Config{})
 	)
 
 	// different situations where log filter creation should fail.
@@ -337,7 +482,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 	}
 
 	for i, test := range testCases {
-		if _, err := api.NewFilter(test); err == nil {
+		if _, err := api.NewFilter(context.Background(), test); err == nil {
 			t.Errorf("Expected NewFilter for case #%d to fail", i)
 		}
 	}
@@ -354,8 +499,8 @@ func TestLogFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -413,7 +558,7 @@ func TestLogFilter(t *testing.T) {
 
 	// create all filters
 	for i := range testCases {
-		testCases[i].id, _ = api.NewFilter(testCases[i].crit)
+		testCases[i].id, _ = api.NewFilter(context.Background(), testCases[i].crit)
 	}
 
 	// raise events
@@ -473,8 +618,8 @@ func TestPendingLogsSubscription(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), new(event.Feed)}
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -0,0 +1,161 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// maxFeeHistory is the maximum number of blocks a single fee history query
+// may cover, larger requests are truncated.
+const maxFeeHistory = 1024
+
+var (
+	errInvalidPercentile = errors.New("invalid reward percentile")
+	errBlockNotFound     = errors.New("block not found")
+)
+
+// txGasAndPrice is a transaction's gas usage and price, used to weight the
+// percentiles of a block by the amount of gas spent at each price.
+type txGasAndPrice struct {
+	gasUsed uint64
+	price   *big.Int
+}
+
+type txsByGasPrice []txGasAndPrice
+
+func (t txsByGasPrice) Len() int           { return len(t) }
+func (t txsByGasPrice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t txsByGasPrice) Less(i, j int) bool { return t[i].price.Cmp(t[j].price) < 0 }
+
+// FeeHistory returns the gas price history of up to blocks consecutive blocks
+// ending with lastBlock. For every block it reports the ratio of gas used to
+// the gas limit and, for each of the requested percentiles, the gas price
+// paid at that percentile of the block's gas usage. The pending block is
+// treated as the latest one, as its receipts aren't available yet.
+//
+// The number of the oldest block covered is returned alongside the history.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks uint64, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	if blocks < 1 {
+		return common.Big0, nil, nil, nil
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	for i, p := range rewardPercentiles {
+		if p < 0 || p > 100 {
+			return common.Big0, nil, nil, fmt.Errorf("%v: %f", errInvalidPercentile, p)
+		}
+		if i > 0 && p < rewardPercentiles[i-1] {
+			return common.Big0, nil, nil, fmt.Errorf("%v: #%d:%f > #%d:%f", errInvalidPercentile, i-1, rewardPercentiles[i-1], i, p)
+		}
+	}
+	if lastBlock == rpc.PendingBlockNumber {
+		lastBlock = rpc.LatestBlockNumber
+	}
+	head, err := gpo.backend.HeaderByNumber(ctx, lastBlock)
+	if err != nil {
+		return common.Big0, nil, nil, err
+	}
+	if head == nil {
+		return common.Big0, nil, nil, errBlockNotFound
+	}
+	last := head.Number.Uint64()
+	if blocks > last+1 {
+		blocks = last + 1
+	}
+	oldest := last + 1 - blocks
+
+	var (
+		reward       = make([][]*big.Int, 0, blocks)
+		gasUsedRatio = make([]float64, 0, blocks)
+	)
+	for number := oldest; number <= last; number++ {
+		block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return common.Big0, nil, nil, err
+		}
+		if block == nil {
+			return common.Big0, nil, nil, errBlockNotFound
+		}
+		ratio := float64(0)
+		if block.GasLimit() > 0 {
+			ratio = float64(block.GasUsed()) / float64(block.GasLimit())
+		}
+		gasUsedRatio = append(gasUsedRatio, ratio)
+
+		if len(rewardPercentiles) > 0 {
+			rewards, err := gpo.blockRewards(ctx, block, rewardPercentiles)
+			if err != nil {
+				return common.Big0, nil, nil, err
+			}
+			reward = append(reward, rewards)
+		}
+	}
+	if len(rewardPercentiles) == 0 {
+		reward = nil
+	}
+	return new(big.Int).SetUint64(oldest), reward, gasUsedRatio, nil
+}
+
+// blockRewards calculates the gas prices paid at the given percentiles of the
+// gas used by a block. Empty blocks report zero for every percentile.
+func (gpo *Oracle) blockRewards(ctx context.Context, block *types.Block, percentiles []float64) ([]*big.Int, error) {
+	rewards := make([]*big.Int, len(percentiles))
+
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards, nil
+	}
+	receipts, err := gpo.backend.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch for block #%d: have %d, want %d", block.NumberU64(), len(receipts), len(txs))
+	}
+	sorted := make([]txGasAndPrice, len(txs))
+	for i, tx := range txs {
+		sorted[i] = txGasAndPrice{gasUsed: receipts[i].GasUsed, price: tx.GasPrice()}
+	}
+	sort.Sort(txsByGasPrice(sorted))
+
+	var (
+		index   int
+		sumUsed = sorted[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(block.GasUsed()) * p / 100)
+		for sumUsed < threshold && index < len(sorted)-1 {
+			index++
+			sumUsed += sorted[index].gasUsed
+		}
+		rewards[i] = sorted[index].price
+	}
+	return rewards, nil
+}
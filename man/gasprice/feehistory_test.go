@@ -0,0 +1,168 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gasprice
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/consensus/manash"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/internal/manapi"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+	"github.com/matrix/go-matrix/rpc"
+)
+
+// testBackend serves the blocks and receipts of a generated chain, the rest of
+// the backend is left unimplemented.
+type testBackend struct {
+	manapi.Backend
+
+	blocks   []*types.Block
+	receipts map[common.Hash]types.Receipts
+}
+
+// newTestBackend generates a chain of the given length. The first block holds
+// two transactions paying a gas price of 1 and 2 wei, the others are empty.
+func newTestBackend(t *testing.T, length int) *testBackend {
+	var (
+		db      = mandb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, length, func(i int, block *core.BlockGen) {
+		if i != 0 {
+			return
+		}
+		for price := int64(2); price > 0; price-- {
+			tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(price), nil), signer, key)
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	backend := &testBackend{
+		blocks:   append([]*types.Block{genesis}, blocks...),
+		receipts: make(map[common.Hash]types.Receipts),
+	}
+	for i, block := range blocks {
+		backend.receipts[block.Hash()] = receipts[i]
+	}
+	return backend
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	block, err := b.BlockByNumber(ctx, number)
+	if block == nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.blocks[len(b.blocks)-1], nil
+	}
+	if number < 0 || int64(number) >= int64(len(b.blocks)) {
+		return nil, nil
+	}
+	return b.blocks[number], nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.receipts[hash], nil
+}
+
+// Tests that the fee history covers the requested blocks, clamping the count to
+// the available ones, and reports the percentiles of the paid gas prices.
+func TestFeeHistory(t *testing.T) {
+	oracle := NewOracle(newTestBackend(t, 4), Config{Blocks: 20, Percentile: 60})
+
+	tests := []struct {
+		count       uint64
+		last        rpc.BlockNumber
+		percentiles []float64
+		oldest      uint64
+		blocks      int
+		reward      [][]*big.Int
+		fail        bool
+	}{
+		{count: 0, last: rpc.LatestBlockNumber, blocks: 0},
+		{count: 2, last: rpc.LatestBlockNumber, oldest: 3, blocks: 2},
+		{count: 2, last: rpc.PendingBlockNumber, oldest: 3, blocks: 2},
+		{count: 10, last: 2, oldest: 0, blocks: 3},
+		{count: math.MaxInt64 + 1, last: rpc.LatestBlockNumber, oldest: 0, blocks: 5},
+		{count: math.MaxUint64, last: rpc.LatestBlockNumber, oldest: 0, blocks: 5},
+		{count: 1, last: 1, percentiles: []float64{0, 50, 100}, oldest: 1, blocks: 1, reward: [][]*big.Int{{big.NewInt(1), big.NewInt(1), big.NewInt(2)}}},
+		{count: 1, last: 2, percentiles: []float64{25}, oldest: 2, blocks: 1, reward: [][]*big.Int{{new(big.Int)}}},
+		{count: 1, last: rpc.LatestBlockNumber, percentiles: []float64{50, 25}, fail: true},
+		{count: 1, last: rpc.LatestBlockNumber, percentiles: []float64{101}, fail: true},
+		{count: 1, last: 10, fail: true},
+	}
+	for i, tt := range tests {
+		oldest, reward, ratios, err := oracle.FeeHistory(context.Background(), tt.count, tt.last, tt.percentiles)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: invalid query accepted", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to retrieve fee history: %v", i, err)
+			continue
+		}
+		if len(ratios) != tt.blocks {
+			t.Errorf("test %d: block count mismatch: have %d, want %d", i, len(ratios), tt.blocks)
+		}
+		if tt.blocks > 0 && oldest.Uint64() != tt.oldest {
+			t.Errorf("test %d: oldest block mismatch: have %d, want %d", i, oldest, tt.oldest)
+		}
+		if !reflect.DeepEqual(reward, tt.reward) {
+			t.Errorf("test %d: reward mismatch: have %v, want %v", i, reward, tt.reward)
+		}
+	}
+}
+
+// Tests that a fee history query never covers more than maxFeeHistory blocks.
+func TestFeeHistoryLimit(t *testing.T) {
+	oracle := NewOracle(newTestBackend(t, maxFeeHistory+10), Config{Blocks: 20, Percentile: 60})
+
+	oldest, _, ratios, err := oracle.FeeHistory(context.Background(), math.MaxUint64, rpc.LatestBlockNumber, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if len(ratios) != maxFeeHistory {
+		t.Errorf("block count mismatch: have %d, want %d", len(ratios), maxFeeHistory)
+	}
+	if want := uint64(11); oldest.Uint64() != want {
+		t.Errorf("oldest block mismatch: have %d, want %d", oldest, want)
+	}
+}
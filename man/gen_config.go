@@ -19,6 +19,7 @@ package man
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/common/hexutil"
@@ -26,24 +27,48 @@ import (
 	"github.com/matrix/go-matrix/core"
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/man/gasprice"
+	"github.com/matrix/go-matrix/params"
 )
 
 var _ = (*configMarshaling)(nil)
 
 func (c Config) MarshalTOML() (interface{}, error) {
 	type Config struct {
-		Genesis                 *core.Genesis `toml:",omitempty"`
+		Genesis                 *core.Genesis        `toml:",omitempty"`
+		ChainOverrides          *core.ChainOverrides `toml:"-"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		NoPruning               bool
+		NoPreimages             bool
+		NoPrefetch              bool
+		Snapshot                bool
+		StateDiffs              bool
+		SenderTxIndex           bool                      `toml:",omitempty"`
+		ReceiptExtras           bool                      `toml:",omitempty"`
+		SlowBlockThreshold      time.Duration             `toml:",omitempty"`
+		PropagationTrace        bool                      `toml:",omitempty"`
+		TxLookupLimit           uint64                    `toml:",omitempty"`
+		FilterTimeout           time.Duration             `toml:",omitempty"`
+		FilterLimit             int                       `toml:",omitempty"`
+		StateRegenLimit         uint64                    `toml:",omitempty"`
+		RPCGasCap               uint64                    `toml:",omitempty"`
+		LightServ               int                       `toml:",omitempty"`
+		LightPeers              int                       `toml:",omitempty"`
+		Checkpoint              *params.TrustedCheckpoint `toml:",omitempty"`
+		SkipBcVersionCheck      bool                      `toml:"-"`
+		DatabaseHandles         int                       `toml:"-"`
 		DatabaseCache           int
+		DatabaseFreezer         string `toml:",omitempty"`
+		Freezer                 bool   `toml:",omitempty"`
+		FreezerThreshold        uint64
+		TrieCache               int
+		TrieTimeout             time.Duration
 		Etherbase               common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
+		GasLimit                uint64 `toml:",omitempty"`
+		TxOrdering              string `toml:",omitempty"`
 		Ethash                  manash.Config
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
@@ -52,17 +77,40 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	}
 	var enc Config
 	enc.Genesis = c.Genesis
+	enc.ChainOverrides = c.ChainOverrides
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.NoPruning = c.NoPruning
+	enc.NoPreimages = c.NoPreimages
+	enc.NoPrefetch = c.NoPrefetch
+	enc.Snapshot = c.Snapshot
+	enc.StateDiffs = c.StateDiffs
+	enc.SenderTxIndex = c.SenderTxIndex
+	enc.ReceiptExtras = c.ReceiptExtras
+	enc.SlowBlockThreshold = c.SlowBlockThreshold
+	enc.PropagationTrace = c.PropagationTrace
+	enc.TxLookupLimit = c.TxLookupLimit
+	enc.FilterTimeout = c.FilterTimeout
+	enc.FilterLimit = c.FilterLimit
+	enc.StateRegenLimit = c.StateRegenLimit
+	enc.RPCGasCap = c.RPCGasCap
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
+	enc.Checkpoint = c.Checkpoint
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.DatabaseFreezer = c.DatabaseFreezer
+	enc.Freezer = c.Freezer
+	enc.FreezerThreshold = c.FreezerThreshold
+	enc.TrieCache = c.TrieCache
+	enc.TrieTimeout = c.TrieTimeout
 	enc.Etherbase = c.Etherbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
 	enc.GasPrice = c.GasPrice
+	enc.GasLimit = c.GasLimit
+	enc.TxOrdering = c.TxOrdering
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
@@ -73,18 +121,41 @@ func (c Config) MarshalTOML() (interface{}, error) {
 
 func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	type Config struct {
-		Genesis                 *core.Genesis `toml:",omitempty"`
+		Genesis                 *core.Genesis        `toml:",omitempty"`
+		ChainOverrides          *core.ChainOverrides `toml:"-"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		NoPruning               *bool
+		NoPreimages             *bool
+		NoPrefetch              *bool
+		Snapshot                *bool
+		StateDiffs              *bool
+		SenderTxIndex           *bool                     `toml:",omitempty"`
+		ReceiptExtras           *bool                     `toml:",omitempty"`
+		SlowBlockThreshold      *time.Duration            `toml:",omitempty"`
+		PropagationTrace        *bool                     `toml:",omitempty"`
+		TxLookupLimit           *uint64                   `toml:",omitempty"`
+		FilterTimeout           *time.Duration            `toml:",omitempty"`
+		FilterLimit             *int                      `toml:",omitempty"`
+		StateRegenLimit         *uint64                   `toml:",omitempty"`
+		RPCGasCap               *uint64                   `toml:",omitempty"`
+		LightServ               *int                      `toml:",omitempty"`
+		LightPeers              *int                      `toml:",omitempty"`
+		Checkpoint              *params.TrustedCheckpoint `toml:",omitempty"`
+		SkipBcVersionCheck      *bool                     `toml:"-"`
+		DatabaseHandles         *int                      `toml:"-"`
 		DatabaseCache           *int
+		DatabaseFreezer         *string `toml:",omitempty"`
+		Freezer                 *bool   `toml:",omitempty"`
+		FreezerThreshold        *uint64
+		TrieCache               *int
+		TrieTimeout             *time.Duration
 		Etherbase               *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               *hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
+		GasLimit                *uint64 `toml:",omitempty"`
+		TxOrdering              *string `toml:",omitempty"`
 		Ethash                  *manash.Config
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
@@ -98,18 +169,66 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.Genesis != nil {
 		c.Genesis = dec.Genesis
 	}
+	if dec.ChainOverrides != nil {
+		c.ChainOverrides = dec.ChainOverrides
+	}
 	if dec.NetworkId != nil {
 		c.NetworkId = *dec.NetworkId
 	}
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.NoPruning != nil {
+		c.NoPruning = *dec.NoPruning
+	}
+	if dec.NoPreimages != nil {
+		c.NoPreimages = *dec.NoPreimages
+	}
+	if dec.NoPrefetch != nil {
+		c.NoPrefetch = *dec.NoPrefetch
+	}
+	if dec.Snapshot != nil {
+		c.Snapshot = *dec.Snapshot
+	}
+	if dec.StateDiffs != nil {
+		c.StateDiffs = *dec.StateDiffs
+	}
+	if dec.SenderTxIndex != nil {
+		c.SenderTxIndex = *dec.SenderTxIndex
+	}
+	if dec.ReceiptExtras != nil {
+		c.ReceiptExtras = *dec.ReceiptExtras
+	}
+	if dec.SlowBlockThreshold != nil {
+		c.SlowBlockThreshold = *dec.SlowBlockThreshold
+	}
+	if dec.PropagationTrace != nil {
+		c.PropagationTrace = *dec.PropagationTrace
+	}
+	if dec.TxLookupLimit != nil {
+		c.TxLookupLimit = *dec.TxLookupLimit
+	}
+	if dec.FilterTimeout != nil {
+		c.FilterTimeout = *dec.FilterTimeout
+	}
+	if dec.FilterLimit != nil {
+		c.FilterLimit = *dec.FilterLimit
+	}
+	if dec.StateRegenLimit != nil {
+		c.StateRegenLimit = *dec.StateRegenLimit
+	}
+	if dec.RPCGasCap != nil {
+		c.RPCGasCap = *dec.RPCGasCap
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
 	if dec.LightPeers != nil {
 		c.LightPeers = *dec.LightPeers
 	}
+	if dec.Checkpoint != nil {
+		c.Checkpoint = dec.Checkpoint
+	}
 	if dec.SkipBcVersionCheck != nil {
 		c.SkipBcVersionCheck = *dec.SkipBcVersionCheck
 	}
@@ -119,6 +238,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.DatabaseFreezer != nil {
+		c.DatabaseFreezer = *dec.DatabaseFreezer
+	}
+	if dec.Freezer != nil {
+		c.Freezer = *dec.Freezer
+	}
+	if dec.FreezerThreshold != nil {
+		c.FreezerThreshold = *dec.FreezerThreshold
+	}
+	if dec.TrieCache != nil {
+		c.TrieCache = *dec.TrieCache
+	}
+	if dec.TrieTimeout != nil {
+		c.TrieTimeout = *dec.TrieTimeout
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
@@ -131,6 +265,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GasPrice != nil {
 		c.GasPrice = dec.GasPrice
 	}
+	if dec.GasLimit != nil {
+		c.GasLimit = *dec.GasLimit
+	}
+	if dec.TxOrdering != nil {
+		c.TxOrdering = *dec.TxOrdering
+	}
 	if dec.Ethash != nil {
 		c.Ethash = *dec.Ethash
 	}
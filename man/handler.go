@@ -34,6 +34,7 @@ import (
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/man/fetcher"
+	"github.com/matrix/go-matrix/man/snap"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/hd"
@@ -74,6 +75,7 @@ type ProtocolManager struct {
 	networkId uint64
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether fast sync should retrieve the state via snap peers
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
@@ -83,6 +85,8 @@ type ProtocolManager struct {
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	txFetcher  *fetcher.TxFetcher
+	propTracer *propagationTracer // Block and transaction propagation tracer, nil if disabled
 	//	peers      *peerSet
 	Peers        *peerSet
 	SubProtocols []p2p.Protocol
@@ -92,9 +96,8 @@ type ProtocolManager struct {
 	txsSub        event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
 
-	// channels for fetcher, syncer, txsyncLoop
+	// channels for fetcher, syncer
 	newPeerCh   chan *peer
-	txsyncCh    chan *txsync
 	quitSync    chan struct{}
 	noMorePeers chan struct{}
 
@@ -118,23 +121,25 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		Peers:       newPeerSet(),
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
-		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
 		Msgcenter:   MsgCenter,
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if (mode == downloader.FastSync || mode == downloader.SnapSync) && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
 		mode = downloader.FullSync
 	}
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.SnapSync {
 		manager.fastSync = uint32(1)
 	}
+	if mode == downloader.SnapSync {
+		manager.snapSync = uint32(1)
+	}
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < man63 {
+		if (mode == downloader.FastSync || mode == downloader.SnapSync) && version < man63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -172,6 +177,9 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
 
+	// Serve state ranges to snap syncing peers and sync from them if requested
+	manager.SubProtocols = append(manager.SubProtocols, snap.MakeProtocols(blockchain, manager.downloader.SnapSyncer)...)
+
 	validator := func(header *types.Header) error {
 		if header.IsBroadcastHeader() || header.IsReElectionHeader() {
 			return engine.VerifyHeader(blockchain, header, false)
@@ -193,6 +201,11 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
 
+	hasTx := func(hash common.Hash) bool {
+		return txpool.Get(hash) != nil
+	}
+	manager.txFetcher = fetcher.NewTxFetcher(hasTx, txpool.AddRemotes)
+
 	return manager, nil
 }
 
@@ -207,6 +220,8 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 	// Unregister the peer from the downloader and Matrix peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.txFetcher.Drop(id)
+	pm.propTracer.drop(id)
 	//	if err := pm.peers.Unregister(id); err != nil {
 	if err := pm.Peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
@@ -250,6 +265,7 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.txsCh = make(chan core.NewTxsEvent, txChanSize)
 	pm.txsSub = pm.txpool.SubscribeNewTxsEvent(pm.txsCh)
 	go pm.txBroadcastLoop()
+	pm.txFetcher.Start()
 
 	// broadcast mined blocks
 	pm.minedBlockSub = pm.eventMux.Subscribe(core.NewMinedBlockEvent{})
@@ -258,7 +274,6 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	// start sync handlers
 	//go pm.MySend()
 	go pm.syncer()
-	go pm.txsyncLoop()
 	//	MyPm = pm
 }
 
@@ -272,8 +287,9 @@ func (pm *ProtocolManager) Stop() {
 	// After this send has completed, no new peers will be accepted.
 	pm.noMorePeers <- struct{}{}
 
-	// Quit fetcher, txsyncLoop.
+	// Quit fetcher.
 	close(pm.quitSync)
+	pm.txFetcher.Stop()
 
 	// Disconnect existing sessions.
 	// This also closes the gate for any new registrations on the peer set.
@@ -332,9 +348,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	if err := pm.downloader.RegisterPeer(p.id, p.version, p); err != nil {
 		return err
 	}
-	// Propagate existing transactions. new transactions appearing
-	// after this will be sent via broadcasts.
-	//pm.syncTransactions(p) //YY 2018-08-29 新节点连接时不去要其他的交易
+	// Existing transactions are not propagated to new peers, only the ones
+	// appearing after this are sent via broadcasts.
 
 	// If we're DAO hard-fork aware, validate any remote peer with regard to the hard-fork
 	if daoBlock := pm.chainconfig.DAOForkBlock; daoBlock != nil {
@@ -660,9 +675,13 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&announces); err != nil {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
+		if !p.allowAnnounces(len(announces)) {
+			break
+		}
 		// Mark the hashes as present at the remote node
 		for _, block := range announces {
 			p.MarkBlock(block.Hash)
+			pm.propTracer.markBlocks(p.id, block.Hash)
 		}
 		// Schedule all the unknown hashes for retrieval
 		unknown := make(newBlockHashesData, 0, len(announces))
@@ -681,11 +700,15 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&request); err != nil {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
+		if !p.allowAnnounces(1) {
+			break
+		}
 		request.Block.ReceivedAt = msg.ReceivedAt
 		request.Block.ReceivedFrom = p
 
 		// Mark the peer as owning the block and schedule it for import
 		p.MarkBlock(request.Block.Hash())
+		pm.propTracer.markBlocks(p.id, request.Block.Hash())
 		pm.fetcher.Enqueue(p.id, request.Block)
 
 		// Assuming the block is importable by the peer, but possibly not yet done so,
@@ -725,6 +748,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				return errResp(ErrDecode, "transaction %d is nil", i)
 			}
 			p.MarkTransaction(tx.Hash())
+			pm.propTracer.markTxs(p.id, tx.Hash())
 			//YY ====begin======
 			if nc := tx.Nonce(); nc < params.NonceAddOne {
 				nc = nc | params.NonceAddOne
@@ -733,6 +757,66 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			//=========end======
 		}
 		pm.txpool.AddRemotes(txs)
+
+	case p.version >= man64 && msg.Code == NewPooledTransactionHashesMsg:
+		// Transactions announced, schedule the unknown ones for retrieval
+		if ca.GetRole() == common.RoleBroadcast {
+			break
+		}
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+		}
+		pm.propTracer.markTxs(p.id, hashes...)
+		pm.txFetcher.Notify(p.id, hashes, time.Now(), p.RequestTxs)
+
+	case p.version >= man64 && msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash  common.Hash
+			bytes common.StorageSize
+			txs   types.Transactions
+		)
+		for bytes < softResponseLimit {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping if unknown to us
+			if tx := pm.txpool.Get(hash); tx != nil {
+				txs = append(txs, tx)
+				bytes += tx.Size()
+			}
+		}
+		return p.SendPooledTransactions(txs)
+
+	case p.version >= man64 && msg.Code == PooledTransactionsMsg:
+		// A batch of requested transactions arrived, deliver them to the fetcher
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, tx := range txs {
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+			if nc := tx.Nonce(); nc < params.NonceAddOne {
+				tx.SetNonce(nc | params.NonceAddOne)
+			}
+		}
+		pm.txFetcher.Enqueue(p.id, txs)
+
 	case msg.Code == common.NetworkMsg:
 		var m []*core.MsgStruct
 		log.Info("====xiangzi====NetworkMsg")
@@ -830,26 +914,38 @@ func (pm *ProtocolManager) BroadcastBlockHeader(block *types.Block, propagate bo
 	}
 }
 
-// BroadcastTxs will propagate a batch of transactions to all peers which are not known to
-// already have the given transaction.
+// BroadcastTxs will propagate a batch of transactions to a square root subset of
+// the peers which are not known to already have the given transaction, and only
+// announce their hashes to the rest, which fetch them if needed.
 func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
-	var txset = make(map[*peer]types.Transactions)
-
+	var (
+		txset  = make(map[*peer]types.Transactions)
+		annset = make(map[*peer][]common.Hash)
+	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
 		//		peers := pm.peers.PeersWithoutTx(tx.Hash())
 		peers := pm.Peers.PeersWithoutTx(tx.Hash())
-		for _, peer := range peers {
-			txset[peer] = append(txset[peer], tx)
+		direct := int(math.Sqrt(float64(len(peers))))
+		for i, peer := range peers {
+			// Peers without announcement support always get the full transaction
+			if i < direct || peer.version < man64 {
+				txset[peer] = append(txset[peer], tx)
+			} else {
+				annset[peer] = append(annset[peer], tx.Hash())
+			}
 		}
-		log.Trace("Broadcast transaction", "hash", tx.Hash(), "recipients", len(peers))
+		log.Trace("Broadcast transaction", "hash", tx.Hash(), "recipients", direct, "announced", len(peers)-direct)
 	}
-	// udp send
+	// Hand the full batch to up to two validators out of band, they need the bodies
+	// to pack blocks and aren't necessarily among the direct peers
 	SendUdpTransactions(txs)
-	// FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
 	for peer, txs := range txset {
 		peer.AsyncSendTransactions(txs)
 	}
+	for peer, hashes := range annset {
+		peer.AsyncSendPooledTransactionHashes(hashes)
+	}
 }
 
 // Mined broadcast loop
@@ -26,6 +26,14 @@ var (
 	propTxnInTrafficMeter     = metrics.NewRegisteredMeter("man/prop/txns/in/traffic", nil)
 	propTxnOutPacketsMeter    = metrics.NewRegisteredMeter("man/prop/txns/out/packets", nil)
 	propTxnOutTrafficMeter    = metrics.NewRegisteredMeter("man/prop/txns/out/traffic", nil)
+	propTxnAnnInPacketsMeter  = metrics.NewRegisteredMeter("man/prop/txnanns/in/packets", nil)
+	propTxnAnnInTrafficMeter  = metrics.NewRegisteredMeter("man/prop/txnanns/in/traffic", nil)
+	propTxnAnnOutPacketsMeter = metrics.NewRegisteredMeter("man/prop/txnanns/out/packets", nil)
+	propTxnAnnOutTrafficMeter = metrics.NewRegisteredMeter("man/prop/txnanns/out/traffic", nil)
+	reqTxnInPacketsMeter      = metrics.NewRegisteredMeter("man/req/txns/in/packets", nil)
+	reqTxnInTrafficMeter      = metrics.NewRegisteredMeter("man/req/txns/in/traffic", nil)
+	reqTxnOutPacketsMeter     = metrics.NewRegisteredMeter("man/req/txns/out/packets", nil)
+	reqTxnOutTrafficMeter     = metrics.NewRegisteredMeter("man/req/txns/out/traffic", nil)
 	propHashInPacketsMeter    = metrics.NewRegisteredMeter("man/prop/hashes/in/packets", nil)
 	propHashInTrafficMeter    = metrics.NewRegisteredMeter("man/prop/hashes/in/traffic", nil)
 	propHashOutPacketsMeter   = metrics.NewRegisteredMeter("man/prop/hashes/out/packets", nil)
@@ -34,6 +42,8 @@ var (
 	propBlockInTrafficMeter   = metrics.NewRegisteredMeter("man/prop/blocks/in/traffic", nil)
 	propBlockOutPacketsMeter  = metrics.NewRegisteredMeter("man/prop/blocks/out/packets", nil)
 	propBlockOutTrafficMeter  = metrics.NewRegisteredMeter("man/prop/blocks/out/traffic", nil)
+	propBlockLatencyTimer     = metrics.NewRegisteredTimer("man/prop/blocks/latency", nil)
+	propTxnLatencyTimer       = metrics.NewRegisteredTimer("man/prop/txns/latency", nil)
 	reqHeaderInPacketsMeter   = metrics.NewRegisteredMeter("man/req/headers/in/packets", nil)
 	reqHeaderInTrafficMeter   = metrics.NewRegisteredMeter("man/req/headers/in/traffic", nil)
 	reqHeaderOutPacketsMeter  = metrics.NewRegisteredMeter("man/req/headers/out/packets", nil)
@@ -54,6 +64,9 @@ var (
 	miscInTrafficMeter        = metrics.NewRegisteredMeter("man/misc/in/traffic", nil)
 	miscOutPacketsMeter       = metrics.NewRegisteredMeter("man/misc/out/packets", nil)
 	miscOutTrafficMeter       = metrics.NewRegisteredMeter("man/misc/out/traffic", nil)
+
+	peerPenaltyMeter = metrics.NewRegisteredMeter("man/peers/penalties", nil)
+	peerDropMeter    = metrics.NewRegisteredMeter("man/peers/dropped", nil)
 )
 
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
@@ -96,6 +109,10 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 		packets, traffic = reqStateInPacketsMeter, reqStateInTrafficMeter
 	case rw.version >= man63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptInPacketsMeter, reqReceiptInTrafficMeter
+	case rw.version >= man64 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnAnnInPacketsMeter, propTxnAnnInTrafficMeter
+	case rw.version >= man64 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnInPacketsMeter, reqTxnInTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashInPacketsMeter, propHashInTrafficMeter
@@ -123,6 +140,10 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 		packets, traffic = reqStateOutPacketsMeter, reqStateOutTrafficMeter
 	case rw.version >= man63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptOutPacketsMeter, reqReceiptOutTrafficMeter
+	case rw.version >= man64 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnAnnOutPacketsMeter, propTxnAnnOutTrafficMeter
+	case rw.version >= man64 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnOutPacketsMeter, reqTxnOutTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashOutPacketsMeter, propHashOutTrafficMeter
@@ -23,9 +23,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hashicorp/golang-lru"
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/core/types"
 	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/man/downloader"
 	"github.com/matrix/go-matrix/mc"
 	"github.com/matrix/go-matrix/p2p"
 	"github.com/matrix/go-matrix/params"
@@ -48,6 +50,11 @@ const (
 	// contain a single transaction, or thousands.
 	maxQueuedTxs = 128
 
+	// maxQueuedTxAnns is the maximum number of transaction announcement lists to
+	// queue up before dropping broadcasts. Announcements are cheap, so more of them
+	// are allowed than full transaction lists.
+	maxQueuedTxAnns = 512
+
 	// maxQueuedProps is the maximum number of block propagations to queue up before
 	// dropping broadcasts. There's not much point in queueing stale blocks, so a few
 	// that might cover uncles should be enough.
@@ -67,6 +74,7 @@ type PeerInfo struct {
 	Version    int      `json:"version"`    // Matrix protocol version negotiated
 	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
 	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
+	Score      int      `json:"score"`      // Reputation score of the peer
 }
 
 // propEvent is a block propagation, waiting for its turn in the broadcast queue.
@@ -92,10 +100,13 @@ type peer struct {
 	knownTxs    *set.Set                  // Set of transaction hashes known to be known by this peer
 	knownBlocks *set.Set                  // Set of block hashes known to be known by this peer
 	queuedTxs   chan []*types.Transaction // Queue of transactions to broadcast to the peer
+	queuedTxAnn chan []common.Hash        // Queue of transaction hashes to announce to the peer
 	queuedProps chan *propEvent           // Queue of blocks to broadcast to the peer
 	queuedAnns  chan *types.Block         // Queue of blocks to announce to the peer
 	term        chan struct{}             // Termination channel to stop the broadcaster
 	Msgcenter   *mc.Center
+
+	rep *reputation // Standing of the peer, lowered by faults and announcement spam
 }
 
 func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -108,9 +119,11 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		knownTxs:    set.New(),
 		knownBlocks: set.New(),
 		queuedTxs:   make(chan []*types.Transaction, maxQueuedTxs),
+		queuedTxAnn: make(chan []common.Hash, maxQueuedTxAnns),
 		queuedProps: make(chan *propEvent, maxQueuedProps),
 		queuedAnns:  make(chan *types.Block, maxQueuedAnns),
 		term:        make(chan struct{}),
+		rep:         newReputation(),
 	}
 }
 
@@ -126,6 +139,12 @@ func (p *peer) broadcast() {
 			}
 			p.Log().Trace("Broadcast transactions", "count", len(txs))
 
+		case hashes := <-p.queuedTxAnn:
+			if err := p.SendPooledTransactionHashes(hashes); err != nil {
+				return
+			}
+			p.Log().Trace("Announced transactions", "count", len(hashes))
+
 		case prop := <-p.queuedProps:
 			if err := p.SendNewBlock(prop.block, prop.td); err != nil {
 				return
@@ -157,7 +176,44 @@ func (p *peer) Info() *PeerInfo {
 		Version:    p.version,
 		Difficulty: td,
 		Head:       hash.Hex(),
+		Score:      p.rep.score(),
+	}
+}
+
+// Demoted reports whether the peer is in bad standing and should only be used
+// for requests if no better peer is available.
+func (p *peer) Demoted() bool {
+	return p.rep.score() < scoreDemoted
+}
+
+// Penalize lowers the score of the peer for a fault observed by the downloader,
+// disconnecting it if the score is depleted.
+func (p *peer) Penalize(fault downloader.Fault) {
+	p.penalize(faultPenalties[fault], fault.String())
+}
+
+// penalize deducts points from the score of the peer, disconnecting it if the
+// score is depleted.
+func (p *peer) penalize(points int, reason string) {
+	score := p.rep.penalize(points)
+	peerPenaltyMeter.Mark(1)
+	p.Log().Trace("Penalized peer", "reason", reason, "score", score)
+
+	if score <= scoreDrop {
+		p.Log().Debug("Dropping peer with depleted score", "reason", reason)
+		peerDropMeter.Mark(1)
+		p.Disconnect(p2p.DiscUselessPeer)
+	}
+}
+
+// allowAnnounces reports whether n more block announcements of the peer may be
+// processed, penalizing the peer if it exceeds the announcement limit.
+func (p *peer) allowAnnounces(n int) bool {
+	if p.rep.announce(n) {
+		return true
 	}
+	p.penalize(announceSpamPenalty, "announce spam")
+	return false
 }
 
 // Head retrieves a copy of the current head hash and total difficulty of the
@@ -202,9 +258,18 @@ func (p *peer) MarkTransaction(hash common.Hash) {
 // SendTransactions sends transactions to the peer and includes the hashes
 // in its transaction hash set for future reference.
 func (p *peer) SendTransactions(txs types.Transactions) error {
-	tmptxs := make(types.Transactions, 0)
 	for _, tx := range txs {
 		p.knownTxs.Add(tx.Hash())
+	}
+	log.Info("====hezi==SendTransactions")
+	return p2p.Send(p.rw, TxMsg, wireTransactions(txs))
+}
+
+// wireTransactions copies transactions into their network form, with the pool
+// nonce marker stripped.
+func wireTransactions(txs types.Transactions) types.Transactions {
+	tmptxs := make(types.Transactions, 0, len(txs))
+	for _, tx := range txs {
 		//YY ====begin======
 		tmpts := *tx
 		if nc := tmpts.Nonce(); nc >= params.NonceAddOne {
@@ -213,11 +278,40 @@ func (p *peer) SendTransactions(txs types.Transactions) error {
 		}
 		tmptxs = append(tmptxs, &tmpts)
 		//=========end======
-		//log.Info("========YY=============1","SendTransactions():sendTx_nonce",tmpts.Nonce())
-		//log.Info("========YY=============2","SendTransactions():sendTx_nonce",tx.Nonce())
 	}
-	log.Info("====hezi==SendTransactions")
-	return p2p.Send(p.rw, TxMsg, tmptxs)
+	return tmptxs
+}
+
+// SendPooledTransactionHashes announces the availability of a batch of
+// transactions through a hash notification.
+func (p *peer) SendPooledTransactionHashes(hashes []common.Hash) error {
+	for _, hash := range hashes {
+		p.knownTxs.Add(hash)
+	}
+	return p2p.Send(p.rw, NewPooledTransactionHashesMsg, hashes)
+}
+
+// AsyncSendPooledTransactionHashes queues a batch of transaction hashes for
+// announcement to a remote peer. If the peer's announcement queue is full, the
+// event is silently dropped.
+func (p *peer) AsyncSendPooledTransactionHashes(hashes []common.Hash) {
+	select {
+	case p.queuedTxAnn <- hashes:
+		for _, hash := range hashes {
+			p.knownTxs.Add(hash)
+		}
+	default:
+		p.Log().Debug("Dropping transaction announcement", "count", len(hashes))
+	}
+}
+
+// SendPooledTransactions sends a batch of explicitly requested transactions to
+// the remote peer.
+func (p *peer) SendPooledTransactions(txs types.Transactions) error {
+	for _, tx := range txs {
+		p.knownTxs.Add(tx.Hash())
+	}
+	return p2p.Send(p.rw, PooledTransactionsMsg, wireTransactions(txs))
 }
 
 // SendUdpTransactions
@@ -365,6 +459,13 @@ func (p *peer) RequestNodeData(hashes []common.Hash) error {
 	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
 }
 
+// RequestTxs fetches a batch of transactions from a remote node's pool,
+// corresponding to the announced hashes.
+func (p *peer) RequestTxs(hashes []common.Hash) error {
+	p.Log().Debug("Fetching batch of transactions", "count", len(hashes))
+	return p2p.Send(p.rw, GetPooledTransactionsMsg, hashes)
+}
+
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
@@ -444,14 +545,17 @@ func (p *peer) String() string {
 // the Matrix sub-protocol.
 type peerSet struct {
 	peers  map[string]*peer
+	scores *lru.Cache // Scores of recently disconnected peers below the maximum
 	lock   sync.RWMutex
 	closed bool
 }
 
 // newPeerSet creates a new peer set to track the active participants.
 func newPeerSet() *peerSet {
+	scores, _ := lru.New(maxRememberedScores)
 	return &peerSet{
-		peers: make(map[string]*peer),
+		peers:  make(map[string]*peer),
+		scores: scores,
 	}
 }
 
@@ -468,6 +572,9 @@ func (ps *peerSet) Register(p *peer) error {
 	if _, ok := ps.peers[p.id]; ok {
 		return errAlreadyRegistered
 	}
+	if score, ok := ps.scores.Get(p.id); ok {
+		p.rep.restore(score.(int))
+	}
 	ps.peers[p.id] = p
 	go p.broadcast()
 
@@ -487,6 +594,12 @@ func (ps *peerSet) Unregister(id string) error {
 	delete(ps.peers, id)
 	p.close()
 
+	if score := p.rep.score(); score < scoreMax {
+		ps.scores.Add(id, score)
+	} else {
+		ps.scores.Remove(id)
+	}
+
 	return nil
 }
 
@@ -541,13 +654,21 @@ func (ps *peerSet) BestPeer() *peer {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
 
+	// Prefer peers in good standing, falling back to demoted ones only if no
+	// other peer is available
 	var (
-		bestPeer *peer
-		bestTd   *big.Int
+		bestPeer    *peer
+		bestTd      *big.Int
+		bestDemoted bool
 	)
 	for _, p := range ps.peers {
-		if _, td := p.Head(); bestPeer == nil || td.Cmp(bestTd) > 0 {
-			bestPeer, bestTd = p, td
+		_, td := p.Head()
+		demoted := p.Demoted()
+		switch {
+		case bestPeer == nil, bestDemoted && !demoted:
+			bestPeer, bestTd, bestDemoted = p, td, demoted
+		case demoted == bestDemoted && td.Cmp(bestTd) > 0:
+			bestPeer, bestTd, bestDemoted = p, td, demoted
 		}
 	}
 	return bestPeer
@@ -0,0 +1,254 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/metrics"
+)
+
+const (
+	propBlockTraces   = 1024  // Number of recent block hashes to keep arrival traces for
+	propTxTraces      = 32768 // Number of recent transaction hashes to keep arrival traces for
+	propTracePeers    = 64    // Maximum number of peer arrivals kept per traced hash
+	propLatencySample = 4096  // Number of recent propagation delays kept for the percentiles
+)
+
+// errPropagationTracing is returned by the propagation APIs if tracing is disabled.
+var errPropagationTracing = errors.New("propagation tracing disabled")
+
+// propagationTracer records when block and transaction hashes are first seen from
+// each peer, measuring how far behind the first announcer every other peer lags.
+// A nil tracer is valid and records nothing.
+type propagationTracer struct {
+	blocks *propagationSet
+	txs    *propagationSet
+}
+
+// newPropagationTracer creates a tracer for block and transaction propagation.
+func newPropagationTracer() *propagationTracer {
+	return &propagationTracer{
+		blocks: newPropagationSet(propBlockTraces, propBlockLatencyTimer),
+		txs:    newPropagationSet(propTxTraces, propTxnLatencyTimer),
+	}
+}
+
+// markBlocks records the arrival of some block hashes from a peer.
+func (t *propagationTracer) markBlocks(peer string, hashes ...common.Hash) {
+	if t != nil {
+		t.blocks.mark(peer, time.Now(), hashes)
+	}
+}
+
+// markTxs records the arrival of some transaction hashes from a peer.
+func (t *propagationTracer) markTxs(peer string, hashes ...common.Hash) {
+	if t != nil {
+		t.txs.mark(peer, time.Now(), hashes)
+	}
+}
+
+// drop removes the aggregates of a disconnected peer.
+func (t *propagationTracer) drop(peer string) {
+	if t != nil {
+		t.blocks.drop(peer)
+		t.txs.drop(peer)
+	}
+}
+
+// stats returns the aggregate propagation delays of blocks and transactions.
+func (t *propagationTracer) stats() map[string]*PropagationStats {
+	return map[string]*PropagationStats{
+		"blocks":       t.blocks.stats(),
+		"transactions": t.txs.stats(),
+	}
+}
+
+// trace returns the per peer arrivals of a block or transaction hash.
+func (t *propagationTracer) trace(hash common.Hash) []*PeerArrival {
+	if arrivals := t.blocks.trace(hash); arrivals != nil {
+		return arrivals
+	}
+	return t.txs.trace(hash)
+}
+
+// propagationTrace is the arrival history of a single hash.
+type propagationTrace struct {
+	first    time.Time
+	arrivals map[string]time.Duration // Delay of each peer behind the first arrival
+}
+
+// propagationPeer is the aggregate propagation behaviour of a single peer.
+type propagationPeer struct {
+	first uint64        // Number of hashes this peer delivered before anyone else
+	seen  uint64        // Number of hashes this peer delivered altogether
+	delay time.Duration // Total delay of this peer behind the first arrivals
+}
+
+// propagationSet traces the propagation of one kind of hash.
+type propagationSet struct {
+	traces *lru.Cache    // Recent hashes mapped to their arrival traces
+	timer  metrics.Timer // Metrics timer the propagation delays are reported to
+
+	peers   map[string]*propagationPeer // Per peer aggregates, dropped on disconnect
+	samples []int64                     // Ring of recent propagation delays in nanoseconds
+	next    int                         // Index in the ring to overwrite next
+	count   int64                       // Number of delays sampled altogether
+
+	lock sync.Mutex
+}
+
+func newPropagationSet(size int, timer metrics.Timer) *propagationSet {
+	traces, _ := lru.New(size)
+	return &propagationSet{
+		traces:  traces,
+		timer:   timer,
+		peers:   make(map[string]*propagationPeer),
+		samples: make([]int64, 0, propLatencySample),
+	}
+}
+
+// mark records the arrival of a batch of hashes from a peer. The first arrival
+// of a hash only starts its trace, later ones from other peers are sampled as
+// propagation delays.
+func (s *propagationSet) mark(peer string, now time.Time, hashes []common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := s.peers[peer]
+	if stats == nil {
+		stats = new(propagationPeer)
+		s.peers[peer] = stats
+	}
+	for _, hash := range hashes {
+		cached, ok := s.traces.Get(hash)
+		if !ok {
+			s.traces.Add(hash, &propagationTrace{first: now, arrivals: map[string]time.Duration{peer: 0}})
+			stats.first++
+			stats.seen++
+			continue
+		}
+		trace := cached.(*propagationTrace)
+		if _, ok := trace.arrivals[peer]; ok || len(trace.arrivals) >= propTracePeers {
+			continue
+		}
+		delay := now.Sub(trace.first)
+		trace.arrivals[peer] = delay
+
+		stats.seen++
+		stats.delay += delay
+		s.timer.Update(delay)
+
+		if len(s.samples) < propLatencySample {
+			s.samples = append(s.samples, int64(delay))
+		} else {
+			s.samples[s.next] = int64(delay)
+		}
+		s.next = (s.next + 1) % propLatencySample
+		s.count++
+	}
+}
+
+// drop removes the aggregates of a disconnected peer.
+func (s *propagationSet) drop(peer string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.peers, peer)
+}
+
+// stats aggregates the recent propagation delays and the per peer behaviour.
+func (s *propagationSet) stats() *PropagationStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	samples := make([]int64, len(s.samples))
+	copy(samples, s.samples)
+	ps := metrics.NewSampleSnapshot(s.count, samples).Percentiles([]float64{0.5, 0.9, 0.99})
+
+	stats := &PropagationStats{
+		Count: uint64(s.count),
+		P50:   toMillis(ps[0]),
+		P90:   toMillis(ps[1]),
+		P99:   toMillis(ps[2]),
+		Peers: make(map[string]*PeerPropagation, len(s.peers)),
+	}
+	if len(samples) > 0 {
+		stats.Max = toMillis(float64(metrics.SampleMax(samples)))
+	}
+	for id, peer := range s.peers {
+		stats.Peers[id] = &PeerPropagation{First: peer.first, Seen: peer.seen}
+		if late := peer.seen - peer.first; late > 0 {
+			stats.Peers[id].MeanDelay = toMillis(float64(peer.delay) / float64(late))
+		}
+	}
+	return stats
+}
+
+// trace returns the arrival delays of a hash, ordered from the first peer on.
+func (s *propagationSet) trace(hash common.Hash) []*PeerArrival {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cached, ok := s.traces.Peek(hash)
+	if !ok {
+		return nil
+	}
+	trace := cached.(*propagationTrace)
+
+	arrivals := make([]*PeerArrival, 0, len(trace.arrivals))
+	for peer, delay := range trace.arrivals {
+		arrivals = append(arrivals, &PeerArrival{Peer: peer, Time: trace.first.Add(delay), Delay: toMillis(float64(delay))})
+	}
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Delay < arrivals[j].Delay })
+	return arrivals
+}
+
+// PropagationStats are the aggregate propagation delays of blocks or
+// transactions, in milliseconds behind their first arrival.
+type PropagationStats struct {
+	Count uint64                      `json:"count"`
+	P50   float64                     `json:"p50"`
+	P90   float64                     `json:"p90"`
+	P99   float64                     `json:"p99"`
+	Max   float64                     `json:"max"`
+	Peers map[string]*PeerPropagation `json:"peers"`
+}
+
+// PeerPropagation is the propagation behaviour of a single peer.
+type PeerPropagation struct {
+	First     uint64  `json:"first"`     // Number of hashes first delivered by the peer
+	Seen      uint64  `json:"seen"`      // Number of hashes delivered by the peer
+	MeanDelay float64 `json:"meanDelay"` // Mean delay in milliseconds of the late deliveries
+}
+
+// PeerArrival is the arrival of a single hash from a peer.
+type PeerArrival struct {
+	Peer  string    `json:"peer"`
+	Time  time.Time `json:"time"`
+	Delay float64   `json:"delay"` // Milliseconds behind the first arrival
+}
+
+// toMillis converts a nanosecond duration into fractional milliseconds.
+func toMillis(ns float64) float64 {
+	return ns / float64(time.Millisecond)
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/metrics"
+)
+
+// Tests that the first arrival of a hash starts its trace and the later ones
+// from other peers are aggregated as propagation delays.
+func TestPropagationSetMark(t *testing.T) {
+	var (
+		set    = newPropagationSet(propBlockTraces, metrics.NilTimer{})
+		start  = time.Now()
+		first  = common.Hash{0x01}
+		second = common.Hash{0x02}
+	)
+	set.mark("a", start, []common.Hash{first, second})
+	set.mark("b", start.Add(10*time.Millisecond), []common.Hash{first})
+	set.mark("c", start.Add(30*time.Millisecond), []common.Hash{first, second})
+	set.mark("a", start.Add(50*time.Millisecond), []common.Hash{first}) // duplicate, ignored
+
+	stats := set.stats()
+	if stats.Count != 3 {
+		t.Errorf("sample count mismatch: have %d, want 3", stats.Count)
+	}
+	if stats.P50 != 30 || stats.Max != 30 {
+		t.Errorf("percentiles mismatch: have p50 %v max %v, want 30 and 30", stats.P50, stats.Max)
+	}
+	peers := map[string]PeerPropagation{
+		"a": {First: 2, Seen: 2},
+		"b": {Seen: 1, MeanDelay: 10},
+		"c": {Seen: 2, MeanDelay: 30},
+	}
+	for id, want := range peers {
+		if have := stats.Peers[id]; have == nil || *have != want {
+			t.Errorf("peer %s mismatch: have %+v, want %+v", id, have, want)
+		}
+	}
+	arrivals := set.trace(first)
+	order := []struct {
+		peer  string
+		delay float64
+	}{{"a", 0}, {"b", 10}, {"c", 30}}
+	if len(arrivals) != len(order) {
+		t.Fatalf("arrival count mismatch: have %d, want %d", len(arrivals), len(order))
+	}
+	for i, want := range order {
+		if arrivals[i].Peer != want.peer || arrivals[i].Delay != want.delay {
+			t.Errorf("arrival %d mismatch: have %s after %vms, want %s after %vms", i, arrivals[i].Peer, arrivals[i].Delay, want.peer, want.delay)
+		}
+		if !arrivals[i].Time.Equal(start.Add(time.Duration(want.delay) * time.Millisecond)) {
+			t.Errorf("arrival %d time mismatch: have %v", i, arrivals[i].Time)
+		}
+	}
+	if arrivals := set.trace(common.Hash{0xff}); arrivals != nil {
+		t.Errorf("untracked hash traced: %v", arrivals)
+	}
+	set.drop("b")
+	if _, ok := set.stats().Peers["b"]; ok {
+		t.Errorf("dropped peer still reported")
+	}
+}
+
+// Tests that the arrivals of a single hash are capped at propTracePeers.
+func TestPropagationSetPeerCap(t *testing.T) {
+	var (
+		set   = newPropagationSet(propBlockTraces, metrics.NilTimer{})
+		start = time.Now()
+		hash  = common.Hash{0x01}
+	)
+	for i := 0; i < propTracePeers+10; i++ {
+		set.mark(string(rune('A'+i)), start.Add(time.Duration(i)*time.Millisecond), []common.Hash{hash})
+	}
+	if arrivals := set.trace(hash); len(arrivals) != propTracePeers {
+		t.Errorf("arrival count mismatch: have %d, want %d", len(arrivals), propTracePeers)
+	}
+	if stats := set.stats(); stats.Count != propTracePeers-1 {
+		t.Errorf("sample count mismatch: have %d, want %d", stats.Count, propTracePeers-1)
+	}
+}
+
+// Tests that the ring of recent delays wraps around, overwriting the oldest
+// samples while still counting every sampled delay.
+func TestPropagationSetSampleWrap(t *testing.T) {
+	var (
+		set    = newPropagationSet(propTxTraces, metrics.NilTimer{})
+		start  = time.Now()
+		extra  = 100
+		hashes = make([]common.Hash, propLatencySample+extra)
+	)
+	for i := range hashes {
+		hashes[i] = common.BigToHash(big.NewInt(int64(i)))
+	}
+	set.mark("first", start, hashes)
+	set.mark("late", start.Add(time.Millisecond), hashes[:propLatencySample])
+	set.mark("later", start.Add(5*time.Millisecond), hashes[propLatencySample:])
+
+	if len(set.samples) != propLatencySample {
+		t.Fatalf("sample ring size mismatch: have %d, want %d", len(set.samples), propLatencySample)
+	}
+	if set.next != extra {
+		t.Errorf("ring position mismatch: have %d, want %d", set.next, extra)
+	}
+	for i := 0; i < extra; i++ {
+		if set.samples[i] != int64(5*time.Millisecond) {
+			t.Fatalf("sample %d not overwritten: have %d", i, set.samples[i])
+		}
+	}
+	stats := set.stats()
+	if stats.Count != uint64(len(hashes)) {
+		t.Errorf("sample count mismatch: have %d, want %d", stats.Count, len(hashes))
+	}
+	if stats.P50 != 1 || stats.P99 != 5 || stats.Max != 5 {
+		t.Errorf("percentiles mismatch: have p50 %v p99 %v max %v, want 1, 5 and 5", stats.P50, stats.P99, stats.Max)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"sync"
+	"time"
+
+	"github.com/matrix/go-matrix/man/downloader"
+)
+
+const (
+	scoreMax      = 100              // Score of a fresh peer and upper bound of recovery
+	scoreDemoted  = 50               // Peers below are only selected if no better peer is available
+	scoreDrop     = 0                // Peers at or below are disconnected
+	scoreRecovery = 30 * time.Second // Time needed to regain a single point
+
+	// announceWindow and maxAnnounces throttle block announcements. Anything
+	// beyond the limit within a window is dropped and counted as spam.
+	announceWindow = 10 * time.Second
+	maxAnnounces   = 256
+
+	announceSpamPenalty = 5 // Penalty for each announcement message beyond the limit
+
+	// maxRememberedScores is the number of disconnected peers whose score is
+	// kept, so that misbehaving peers don't start afresh by reconnecting.
+	maxRememberedScores = 1024
+)
+
+// faultPenalties are the score deductions of the faults reported by the
+// downloader.
+var faultPenalties = map[downloader.Fault]int{
+	downloader.FaultTimeout: 10,
+	downloader.FaultUseless: 2,
+	downloader.FaultInvalid: 25,
+}
+
+// reputation tracks the standing of a remote peer. Every fault lowers the
+// score, which slowly recovers over time while the peer behaves.
+type reputation struct {
+	value   int       // Score at the time of the last update
+	updated time.Time // Time of the last score update
+
+	announces int       // Number of announcements within the current window
+	window    time.Time // Start of the current announcement window
+
+	now  func() time.Time // Time source, replaceable in tests
+	lock sync.Mutex
+}
+
+// newReputation creates the reputation of a fresh peer.
+func newReputation() *reputation {
+	return &reputation{value: scoreMax, updated: time.Now(), now: time.Now}
+}
+
+// recover credits the points earned since the last update. The lock must be
+// held by the caller.
+func (r *reputation) recover() {
+	now := r.now()
+	if points := int(now.Sub(r.updated) / scoreRecovery); points > 0 {
+		r.value += points
+		if r.value > scoreMax {
+			r.value = scoreMax
+		}
+		r.updated = r.updated.Add(time.Duration(points) * scoreRecovery)
+	}
+	if r.value >= scoreMax {
+		r.updated = now
+	}
+}
+
+// score returns the current score of the peer.
+func (r *reputation) score() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.recover()
+	return r.value
+}
+
+// penalize deducts the given points and returns the remaining score.
+func (r *reputation) penalize(points int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.recover()
+	r.value -= points
+	return r.value
+}
+
+// restore sets the score remembered from a previous connection of the peer.
+func (r *reputation) restore(score int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.value, r.updated = score, r.now()
+}
+
+// announce counts n announcements against the throttling window and reports
+// whether they may be processed.
+func (r *reputation) announce(n int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if now := r.now(); now.Sub(r.window) >= announceWindow {
+		r.window, r.announces = now, 0
+	}
+	r.announces += n
+	return r.announces <= maxAnnounces
+}
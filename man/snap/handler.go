@@ -0,0 +1,270 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/p2p"
+	"github.com/matrix/go-matrix/trie"
+)
+
+const (
+	// softResponseLimit is the target maximum size of replies to data retrievals.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of bytecodes to serve. This number is
+	// there to limit the number of disk lookups.
+	maxCodeLookups = 1024
+)
+
+// Backend defines the data retrieval methods to serve remote requests.
+type Backend interface {
+	// StateCache returns the caching database of the local state.
+	StateCache() state.Database
+}
+
+// MakeProtocols constructs the P2P protocol definitions for `snap`. Remote
+// peers are served state from the given backend and are registered with the
+// syncer as data sources.
+func MakeProtocols(backend Backend, syncer *Syncer) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				peer := newPeer(version, p, rw)
+				if err := syncer.Register(peer); err != nil {
+					return err
+				}
+				defer syncer.Unregister(peer.id)
+
+				for {
+					if err := handleMessage(backend.StateCache().TrieDB(), syncer, peer); err != nil {
+						peer.Log().Debug("Message handling failed in `snap`", "err", err)
+						return err
+					}
+				}
+			},
+		}
+	}
+	return protocols
+}
+
+// handleMessage is invoked whenever an inbound message is received from a
+// remote peer on the `snap` protocol. The remote connection is torn down upon
+// returning any error.
+func handleMessage(triedb *trie.Database, syncer *Syncer, peer *Peer) error {
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return fmt.Errorf("%v: %v > %v", errMsgTooLarge, msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req GetAccountRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(peer.rw, AccountRangeMsg, serviceAccountRange(triedb, &req))
+
+	case AccountRangeMsg:
+		res := new(AccountRangePacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		hashes, accounts := res.Unpack()
+		return syncer.OnAccounts(peer, res.ID, hashes, accounts, res.Proof)
+
+	case GetStorageRangeMsg:
+		var req GetStorageRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(peer.rw, StorageRangeMsg, serviceStorageRange(triedb, &req))
+
+	case StorageRangeMsg:
+		res := new(StorageRangePacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		hashes, slots := res.Unpack()
+		return syncer.OnStorage(peer, res.ID, hashes, slots, res.Proof)
+
+	case GetByteCodesMsg:
+		var req GetByteCodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(peer.rw, ByteCodesMsg, serviceByteCodes(triedb, &req))
+
+	case ByteCodesMsg:
+		res := new(ByteCodesPacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("%v: message %v: %v", errDecode, msg, err)
+		}
+		return syncer.OnByteCodes(peer, res.ID, res.Codes)
+
+	default:
+		return fmt.Errorf("%v: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// responseLimit caps the soft limit requested by a remote peer.
+func responseLimit(bytes uint64) uint64 {
+	if bytes > softResponseLimit {
+		return softResponseLimit
+	}
+	return bytes
+}
+
+// serviceAccountRange assembles the response to an account range query. If the
+// requested state is not available, an empty response without proofs is sent.
+func serviceAccountRange(triedb *trie.Database, req *GetAccountRangePacket) *AccountRangePacket {
+	res := &AccountRangePacket{ID: req.ID}
+
+	tr, err := trie.New(req.Root, triedb)
+	if err != nil {
+		log.Debug("Requested account range unavailable", "root", req.Root, "err", err)
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+		it    = trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	)
+	for it.Next() {
+		res.Accounts = append(res.Accounts, &AccountData{
+			Hash: common.BytesToHash(it.Key),
+			Body: common.CopyBytes(it.Value),
+		})
+		// Stop at the limit, but include the first account past it to prove
+		// the limit itself to be covered
+		size += uint64(common.HashLength + len(it.Value))
+		if bytes.Compare(it.Key, req.Limit[:]) >= 0 || size >= limit {
+			break
+		}
+	}
+	if it.Err != nil {
+		log.Debug("Failed to iterate account range", "root", req.Root, "err", it.Err)
+		return &AccountRangePacket{ID: req.ID}
+	}
+	var last []byte
+	if n := len(res.Accounts); n > 0 {
+		last = res.Accounts[n-1].Hash[:]
+	}
+	res.Proof = proveRange(tr, req.Origin[:], last)
+	return res
+}
+
+// serviceStorageRange assembles the response to a storage range query. If the
+// requested storage trie is not available, an empty response without proofs is
+// sent.
+func serviceStorageRange(triedb *trie.Database, req *GetStorageRangePacket) *StorageRangePacket {
+	res := &StorageRangePacket{ID: req.ID}
+
+	tr, err := trie.New(req.Root, triedb)
+	if err != nil {
+		log.Debug("Requested storage range unavailable", "root", req.Root, "err", err)
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+		it    = trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	)
+	for it.Next() {
+		res.Slots = append(res.Slots, &StorageData{
+			Hash: common.BytesToHash(it.Key),
+			Body: common.CopyBytes(it.Value),
+		})
+		if size += uint64(common.HashLength + len(it.Value)); size >= limit {
+			break
+		}
+	}
+	if it.Err != nil {
+		log.Debug("Failed to iterate storage range", "root", req.Root, "err", it.Err)
+		return &StorageRangePacket{ID: req.ID}
+	}
+	var last []byte
+	if n := len(res.Slots); n > 0 {
+		last = res.Slots[n-1].Hash[:]
+	}
+	res.Proof = proveRange(tr, req.Origin[:], last)
+	return res
+}
+
+// proveRange collects the merkle proofs of the origin and (if any was served)
+// the last key of a range.
+func proveRange(tr *trie.Trie, origin []byte, last []byte) [][]byte {
+	proof := mandb.NewMemDatabase()
+	if err := tr.Prove(origin, 0, proof); err != nil {
+		log.Debug("Failed to prove range origin", "origin", origin, "err", err)
+		return nil
+	}
+	if last != nil {
+		if err := tr.Prove(last, 0, proof); err != nil {
+			log.Debug("Failed to prove range end", "last", last, "err", err)
+			return nil
+		}
+	}
+	nodes := make([][]byte, 0, proof.Len())
+	for _, key := range proof.Keys() {
+		node, _ := proof.Get(key)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// serviceByteCodes assembles the response to a bytecode query, skipping any
+// unknown codes.
+func serviceByteCodes(triedb *trie.Database, req *GetByteCodesPacket) *ByteCodesPacket {
+	var (
+		res   = &ByteCodesPacket{ID: req.ID}
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, hash := range req.Hashes {
+		if i >= maxCodeLookups || size >= limit {
+			break
+		}
+		if hash == emptyCode {
+			res.Codes = append(res.Codes, []byte{})
+			continue
+		}
+		code, err := triedb.Node(hash)
+		if err != nil || len(code) == 0 || crypto.Keccak256Hash(code) != hash {
+			continue
+		}
+		res.Codes = append(res.Codes, code)
+		size += uint64(len(code))
+	}
+	return res
+}
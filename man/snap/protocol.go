@@ -0,0 +1,136 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snap
+
+import (
+	"errors"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// ProtocolName is the official short name of the protocol used during capability negotiation.
+var ProtocolName = "snap"
+
+// ProtocolVersions are the supported versions of the snap protocol (first is primary).
+var ProtocolVersions = []uint{snap1}
+
+// ProtocolLengths are the number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{6}
+
+const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg = 0x00
+	AccountRangeMsg    = 0x01
+	GetStorageRangeMsg = 0x02
+	StorageRangeMsg    = 0x03
+	GetByteCodesMsg    = 0x04
+	ByteCodesMsg       = 0x05
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+)
+
+// GetAccountRangePacket represents an account range query.
+type GetAccountRangePacket struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// AccountRangePacket represents an account range query response. Beside the
+// accounts, it contains the merkle proofs of the origin and the last account,
+// proving the range to be complete.
+type AccountRangePacket struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*AccountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// AccountData represents a single account in a query response.
+type AccountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // Account body as stored in the state trie
+}
+
+// Unpack splits the accounts of the response into hash and body lists.
+func (p *AccountRangePacket) Unpack() ([][]byte, [][]byte) {
+	hashes := make([][]byte, len(p.Accounts))
+	bodies := make([][]byte, len(p.Accounts))
+	for i, account := range p.Accounts {
+		hashes[i], bodies[i] = common.CopyBytes(account.Hash[:]), account.Body
+	}
+	return hashes, bodies
+}
+
+// GetStorageRangePacket represents a storage slot range query. Storage tries are
+// addressed by their root hash, so identical tries are only ever synced once.
+type GetStorageRangePacket struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the storage trie to serve
+	Origin common.Hash // Hash of the first storage slot to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// StorageRangePacket represents a storage slot range query response, carrying
+// the merkle proofs of the origin and the last slot.
+type StorageRangePacket struct {
+	ID    uint64         // ID of the request this is a response for
+	Slots []*StorageData // List of consecutive slots from the trie
+	Proof [][]byte       // List of trie nodes proving the slot range
+}
+
+// StorageData represents a single storage slot in a query response.
+type StorageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // Slot value as stored in the storage trie
+}
+
+// Unpack splits the slots of the response into hash and value lists.
+func (p *StorageRangePacket) Unpack() ([][]byte, [][]byte) {
+	hashes := make([][]byte, len(p.Slots))
+	values := make([][]byte, len(p.Slots))
+	for i, slot := range p.Slots {
+		hashes[i], values[i] = common.CopyBytes(slot.Hash[:]), slot.Body
+	}
+	return hashes, values
+}
+
+// GetByteCodesPacket represents a contract bytecode query.
+type GetByteCodesPacket struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// ByteCodesPacket represents a contract bytecode query response.
+type ByteCodesPacket struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract bytecodes
+}
@@ -0,0 +1,664 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+	"github.com/matrix/go-matrix/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+const (
+	// accountChunks is the number of chunks the account trie is split into, each
+	// synced concurrently and rebuilt by its own stack trie.
+	accountChunks = 16
+
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in
+	// a single query.
+	maxCodeRequestCount = 64
+
+	// requestTimeout is the maximum time a peer is allowed to spend on serving
+	// a single network request.
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	errCancelled         = errors.New("sync cancelled")
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+// SyncPeer abstracts out the methods required for a peer to be synced against
+// with the goal of allowing the construction of mock peers without the full
+// blown networking.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific
+	// account trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRange fetches a batch of storage slots belonging to the
+	// storage trie with the given root, starting with the origin.
+	RequestStorageRange(id uint64, root, origin common.Hash, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of bytecodes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+}
+
+// accountTask represents the sync task for a chunk of the account trie.
+type accountTask struct {
+	next  common.Hash     // Next account to sync in this chunk
+	last  common.Hash     // Last account covered by this chunk
+	stack *trie.StackTrie // Stack trie rebuilding the chunk's trie nodes
+	busy  bool            // Whether a request is in flight for the chunk
+	done  bool            // Whether the chunk is fully synced
+}
+
+// storageTask represents the sync task for a single storage trie.
+type storageTask struct {
+	root  common.Hash     // Root hash of the storage trie
+	next  common.Hash     // Next slot to sync in the storage trie
+	stack *trie.StackTrie // Stack trie rebuilding the storage trie nodes
+	busy  bool            // Whether a request is in flight for the trie
+}
+
+// request tracks a pending network request to a remote peer.
+type request struct {
+	id    uint64        // Request ID to match up responses with
+	peer  string        // Peer to which this request is assigned
+	timer *time.Timer   // Timer to track delivery timeout
+	stale chan struct{} // Channel to signal the request was dropped
+
+	account *accountTask  // Account chunk requested (account range requests)
+	storage *storageTask  // Storage trie requested (storage range requests)
+	codes   []common.Hash // Bytecode hashes requested (bytecode requests)
+
+	delivered bool // Whether a response arrived (protected by the syncer lock)
+}
+
+// response is a delivered reply to a network request.
+type response struct {
+	req   *request
+	keys  [][]byte // Account or slot hashes of a range response
+	vals  [][]byte // Account bodies or slot values of a range response
+	proof [][]byte // Edge proofs of a range response
+	codes [][]byte // Bytecodes of a bytecode response
+}
+
+// Syncer is a state synchroniser that retrieves the accounts, storage slots and
+// bytecodes of a state trie in contiguous ranges from remote `snap` peers,
+// verifying each range by its boundary proofs and rebuilding the trie nodes
+// locally via stack tries.
+//
+// Nodes along the range boundaries can't be rebuilt locally and the state root
+// might move while syncing, so the result needs to be healed with a regular
+// trie sync afterwards. Any node written by the syncer is the root of a fully
+// synced subtrie, which the trie sync relies on.
+type Syncer struct {
+	db mandb.Database // Database to store the synced state into
+
+	root     common.Hash              // Current state trie root being synced
+	accounts []*accountTask           // Account chunks being synced, kept across roots
+	storage  []*storageTask           // Storage tries waiting to be synced
+	known    map[common.Hash]struct{} // Storage roots already scheduled
+	codes    map[common.Hash]struct{} // Bytecodes waiting to be synced
+	batch    mandb.Batch              // Batch accumulating the synced data
+
+	peers     map[string]SyncPeer // Currently connected peers to sync from
+	stateless map[string]struct{} // Peers unable to serve the current sync
+	active    map[string]*request // Requests in flight, by assigned peer
+	nextID    uint64              // Next request ID to use
+	update    chan struct{}       // Notification channel for peer set changes
+	deliver   chan *response      // Delivery channel for peer responses
+	timeout   chan *request       // Notification channel for timed out requests
+	lock      sync.Mutex          // Lock protecting the peer set and requests
+
+	accountSynced, slotSynced, codeSynced uint64 // Sync statistics
+	logged                                time.Time
+}
+
+// NewSyncer creates a new snap syncer to download the state into the given
+// database.
+func NewSyncer(db mandb.Database) *Syncer {
+	return &Syncer{
+		db:      db,
+		known:   make(map[common.Hash]struct{}),
+		codes:   make(map[common.Hash]struct{}),
+		batch:   db.NewBatch(),
+		peers:   make(map[string]SyncPeer),
+		active:  make(map[string]*request),
+		update:  make(chan struct{}, 1),
+		deliver: make(chan *response),
+		timeout: make(chan *request),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer SyncPeer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := peer.ID()
+	if _, ok := s.peers[id]; ok {
+		return errAlreadyRegistered
+	}
+	s.peers[id] = peer
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(s.peers, id)
+	s.notify()
+	return nil
+}
+
+// notify wakes up the sync loop to reassign tasks after a peer set change.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// Sync downloads the state trie with the given root hash. Progress is retained
+// across calls, so if the root changes (e.g. the pivot block moves), syncing
+// continues where it left off and the result is healed afterwards.
+//
+// Sync returns successfully as soon as the state is downloaded or no remote
+// peer is able to serve the remaining data, leaving the rest to the trie sync.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	s.lock.Lock()
+	s.root = root
+	s.stateless = make(map[string]struct{})
+	if s.accounts == nil {
+		s.accounts = newAccountTasks(s.batch)
+	}
+	s.lock.Unlock()
+
+	defer s.revertRequests()
+	log.Debug("Starting snap sync cycle", "root", root)
+
+	for {
+		if s.complete() {
+			log.Info("Snap sync complete", "root", root, "accounts", s.accountSynced, "slots", s.slotSynced, "codes", s.codeSynced)
+			return nil
+		}
+		if !s.assignTasks() {
+			log.Warn("No snap peers able to serve state, deferring to trie sync", "root", root)
+			return nil
+		}
+		s.report()
+
+		select {
+		case <-s.update:
+			s.revertDropped()
+
+		case res := <-s.deliver:
+			if err := s.process(res); err != nil {
+				return err
+			}
+
+		case req := <-s.timeout:
+			s.expire(req)
+
+		case <-cancel:
+			return errCancelled
+		}
+	}
+}
+
+// newAccountTasks splits the account hash space into evenly sized chunks.
+func newAccountTasks(db mandb.Putter) []*accountTask {
+	tasks := make([]*accountTask, accountChunks)
+	for i := range tasks {
+		task := &accountTask{stack: trie.NewStackTrie(db)}
+		task.next[0] = byte(i * 256 / accountChunks)
+		for j := range task.last {
+			task.last[j] = 0xff
+		}
+		task.last[0] = byte((i+1)*256/accountChunks - 1)
+		tasks[i] = task
+	}
+	return tasks
+}
+
+// complete returns whether all the synced data has been retrieved.
+func (s *Syncer) complete() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, task := range s.accounts {
+		if !task.done {
+			return false
+		}
+	}
+	return len(s.storage) == 0 && len(s.codes) == 0 && len(s.active) == 0
+}
+
+// assignTasks hands out pending account, storage and bytecode tasks to idle
+// peers. It returns whether any peer is still able to serve the sync.
+func (s *Syncer) assignTasks() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, peer := range s.peers {
+		if _, ok := s.stateless[id]; ok {
+			continue
+		}
+		if _, ok := s.active[id]; ok {
+			continue
+		}
+		req := &request{peer: id, stale: make(chan struct{})}
+		if req.account = s.nextAccountTask(); req.account == nil {
+			if req.storage = s.nextStorageTask(); req.storage == nil {
+				if req.codes = s.nextCodes(); req.codes == nil {
+					break // Nothing left to assign
+				}
+			}
+		}
+		s.nextID++
+		req.id = s.nextID
+
+		var err error
+		switch {
+		case req.account != nil:
+			req.account.busy = true
+			err = peer.RequestAccountRange(req.id, s.root, req.account.next, req.account.last, maxRequestSize)
+		case req.storage != nil:
+			req.storage.busy = true
+			err = peer.RequestStorageRange(req.id, req.storage.root, req.storage.next, maxRequestSize)
+		default:
+			err = peer.RequestByteCodes(req.id, req.codes, maxRequestSize)
+		}
+		s.active[id] = req
+		if err != nil {
+			log.Debug("Failed to send snap request", "peer", id, "err", err)
+			s.revert(req)
+			s.stateless[id] = struct{}{}
+			continue
+		}
+		req.timer = time.AfterFunc(requestTimeout, func() {
+			select {
+			case s.timeout <- req:
+			case <-req.stale:
+			}
+		})
+	}
+	if len(s.active) > 0 {
+		return true
+	}
+	for id := range s.peers {
+		if _, ok := s.stateless[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Syncer) nextAccountTask() *accountTask {
+	for _, task := range s.accounts {
+		if !task.done && !task.busy {
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) nextStorageTask() *storageTask {
+	for _, task := range s.storage {
+		if !task.busy {
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) nextCodes() []common.Hash {
+	var hashes []common.Hash
+	for hash := range s.codes {
+		delete(s.codes, hash)
+		if hashes = append(hashes, hash); len(hashes) >= maxCodeRequestCount {
+			break
+		}
+	}
+	return hashes
+}
+
+// revert drops a pending request, returning its task into the queue. The
+// syncer lock must be held.
+func (s *Syncer) revert(req *request) {
+	if s.active[req.peer] != req {
+		return
+	}
+	delete(s.active, req.peer)
+	close(req.stale)
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	switch {
+	case req.account != nil:
+		req.account.busy = false
+	case req.storage != nil:
+		req.storage.busy = false
+	default:
+		for _, hash := range req.codes {
+			s.codes[hash] = struct{}{}
+		}
+	}
+}
+
+// revertRequests drops all pending requests when a sync cycle terminates.
+func (s *Syncer) revertRequests() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, req := range s.active {
+		s.revert(req)
+	}
+}
+
+// revertDropped drops the pending requests of disconnected peers.
+func (s *Syncer) revertDropped() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, req := range s.active {
+		if _, ok := s.peers[id]; !ok {
+			s.revert(req)
+		}
+	}
+}
+
+// expire drops a timed out request, excluding the peer from the current sync.
+func (s *Syncer) expire(req *request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.active[req.peer] != req || req.delivered {
+		return // Request already finished, or response arrived simultaneously
+	}
+	log.Debug("Snap request timed out", "peer", req.peer, "reqid", req.id)
+	s.revert(req)
+	s.stateless[req.peer] = struct{}{}
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes [][]byte, accounts [][]byte, proof [][]byte) error {
+	return s.onResponse(peer, id, &response{keys: hashes, vals: accounts, proof: proof}, func(req *request) bool {
+		return req.account != nil
+	})
+}
+
+// OnStorage is a callback method to invoke when a range of storage slots are
+// received from a remote peer.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]byte, slots [][]byte, proof [][]byte) error {
+	return s.onResponse(peer, id, &response{keys: hashes, vals: slots, proof: proof}, func(req *request) bool {
+		return req.storage != nil
+	})
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract bytecodes
+// are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, codes [][]byte) error {
+	return s.onResponse(peer, id, &response{codes: codes}, func(req *request) bool {
+		return req.codes != nil
+	})
+}
+
+// onResponse matches up a response with its pending request and hands it over
+// to the sync loop. Unrequested responses are silently dropped.
+func (s *Syncer) onResponse(peer SyncPeer, id uint64, res *response, match func(*request) bool) error {
+	s.lock.Lock()
+	req := s.active[peer.ID()]
+	if req == nil || req.id != id || req.delivered || !match(req) {
+		s.lock.Unlock()
+		log.Debug("Unrequested snap response", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	req.delivered = true
+	req.timer.Stop()
+	s.lock.Unlock()
+
+	res.req = req
+	select {
+	case s.deliver <- res:
+	case <-req.stale:
+	}
+	return nil
+}
+
+// process integrates a delivered response into the sync tasks.
+func (s *Syncer) process(res *response) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req := res.req
+	if s.active[req.peer] != req {
+		return nil // Request reverted in the meantime
+	}
+	delete(s.active, req.peer)
+	close(req.stale)
+
+	var err error
+	switch {
+	case req.account != nil:
+		req.account.busy = false
+		err = s.processAccounts(req.account, res)
+	case req.storage != nil:
+		req.storage.busy = false
+		err = s.processStorage(req.storage, res)
+	default:
+		s.processCodes(req.codes, res.codes)
+	}
+	if err != nil {
+		log.Debug("Invalid snap response", "peer", req.peer, "reqid", req.id, "err", err)
+		s.stateless[req.peer] = struct{}{}
+	}
+	if err := s.batch.Write(); err != nil {
+		return err
+	}
+	s.batch.Reset()
+	return nil
+}
+
+// verifyRange checks the range proof of a response, returning whether there are
+// more entries in the trie.
+func verifyRange(root common.Hash, origin common.Hash, res *response) (bool, error) {
+	if len(res.keys) == 0 && len(res.proof) == 0 {
+		return false, errors.New("state unavailable")
+	}
+	proof := mandb.NewMemDatabase()
+	for _, node := range res.proof {
+		proof.Put(crypto.Keccak256(node), node)
+	}
+	last := origin[:]
+	if len(res.keys) > 0 {
+		last = res.keys[len(res.keys)-1]
+	}
+	return trie.VerifyRangeProof(root, origin[:], last, res.keys, res.vals, proof)
+}
+
+// processAccounts verifies a range of accounts and feeds them into the chunk's
+// stack trie, scheduling their storage tries and bytecodes for retrieval.
+func (s *Syncer) processAccounts(task *accountTask, res *response) error {
+	more, err := verifyRange(s.root, task.next, res)
+	if err != nil {
+		return err
+	}
+	for i, key := range res.keys {
+		// Accounts past the chunk belong to the next one, stop there
+		if bytes.Compare(key, task.last[:]) > 0 {
+			more = false
+			break
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(res.vals[i], &account); err != nil {
+			return err
+		}
+		if err := task.stack.TryUpdate(key, res.vals[i]); err != nil {
+			return err
+		}
+		if account.Root != emptyRoot {
+			if _, ok := s.known[account.Root]; !ok {
+				if ok, _ := s.db.Has(account.Root[:]); !ok {
+					s.known[account.Root] = struct{}{}
+					s.storage = append(s.storage, &storageTask{root: account.Root, stack: trie.NewStackTrie(s.batch)})
+				}
+			}
+		}
+		if hash := common.BytesToHash(account.CodeHash); hash != emptyCode {
+			if ok, _ := s.db.Has(hash[:]); !ok {
+				s.codes[hash] = struct{}{}
+			}
+		}
+		s.accountSynced++
+
+		task.next = incHash(common.BytesToHash(key))
+		if task.next == (common.Hash{}) {
+			more = false // Reached the end of the hash space
+		}
+	}
+	if !more {
+		task.done = true
+		task.stack.Commit()
+	}
+	return nil
+}
+
+// processStorage verifies a range of storage slots and feeds them into the
+// storage trie's stack trie.
+func (s *Syncer) processStorage(task *storageTask, res *response) error {
+	// Storage tries of past roots might be gone from remote peers, leave them
+	// to the trie sync instead of failing the peer
+	if len(res.keys) == 0 && len(res.proof) == 0 {
+		log.Debug("Snap synced storage unavailable", "root", task.root)
+		s.dropStorage(task)
+		return nil
+	}
+	more, err := verifyRange(task.root, task.next, res)
+	if err != nil {
+		return err
+	}
+	for i, key := range res.keys {
+		if err := task.stack.TryUpdate(key, res.vals[i]); err != nil {
+			return err
+		}
+		s.slotSynced++
+		task.next = incHash(common.BytesToHash(key))
+	}
+	if !more {
+		if root := task.stack.Commit(); root != task.root {
+			log.Warn("Snap synced storage root mismatch", "want", task.root, "have", root)
+		}
+		s.dropStorage(task)
+	}
+	return nil
+}
+
+// dropStorage removes a storage task from the queue.
+func (s *Syncer) dropStorage(task *storageTask) {
+	for i, t := range s.storage {
+		if t == task {
+			s.storage = append(s.storage[:i], s.storage[i+1:]...)
+			break
+		}
+	}
+}
+
+// processCodes stores the delivered bytecodes, rescheduling any that weren't.
+func (s *Syncer) processCodes(hashes []common.Hash, codes [][]byte) {
+	requested := make(map[common.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		requested[hash] = struct{}{}
+	}
+	for _, code := range codes {
+		hash := crypto.Keccak256Hash(code)
+		if _, ok := requested[hash]; !ok {
+			continue
+		}
+		delete(requested, hash)
+		if hash != emptyCode {
+			s.batch.Put(hash[:], code)
+		}
+		s.codeSynced++
+	}
+	for hash := range requested {
+		s.codes[hash] = struct{}{}
+	}
+}
+
+// report periodically prints the sync progress.
+func (s *Syncer) report() {
+	if time.Since(s.logged) < 8*time.Second {
+		return
+	}
+	s.logged = time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var chunks int
+	for _, task := range s.accounts {
+		if task.done {
+			chunks++
+		}
+	}
+	log.Info("Snap syncing state", "chunks", chunks, "total", len(s.accounts), "accounts", s.accountSynced,
+		"slots", s.slotSynced, "codes", s.codeSynced, "pending", len(s.storage)+len(s.codes))
+}
+
+// incHash returns the hash following the given one, wrapping around at the end
+// of the hash space.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i]++; h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
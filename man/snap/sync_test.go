@@ -0,0 +1,180 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package snap
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/state"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/trie"
+)
+
+// testPeer is a mock sync peer serving state from a local trie database.
+type testPeer struct {
+	id     string
+	triedb *trie.Database
+	syncer *Syncer
+}
+
+func (p *testPeer) ID() string { return p.id }
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	go func() {
+		res := serviceAccountRange(p.triedb, &GetAccountRangePacket{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+		hashes, accounts := res.Unpack()
+		p.syncer.OnAccounts(p, res.ID, hashes, accounts, res.Proof)
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestStorageRange(id uint64, root, origin common.Hash, bytes uint64) error {
+	go func() {
+		res := serviceStorageRange(p.triedb, &GetStorageRangePacket{ID: id, Root: root, Origin: origin, Bytes: bytes})
+		hashes, slots := res.Unpack()
+		p.syncer.OnStorage(p, res.ID, hashes, slots, res.Proof)
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	go func() {
+		res := serviceByteCodes(p.triedb, &GetByteCodesPacket{ID: id, Hashes: hashes, Bytes: bytes})
+		p.syncer.OnByteCodes(p, res.ID, res.Codes)
+	}()
+	return nil
+}
+
+// makeTestState creates a state with a mix of plain accounts, contracts and
+// storage tries (some of them shared between accounts).
+func makeTestState() (state.Database, common.Hash) {
+	db := state.NewDatabase(mandb.NewMemDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+
+	for i := 0; i < 2000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%3 == 0 {
+			statedb.SetCode(addr, []byte{byte(i), byte(i >> 8), 0x60, 0x00})
+		}
+		if i%4 == 0 {
+			for j := 0; j < 200; j++ {
+				key := common.BigToHash(big.NewInt(int64(j)))
+				statedb.SetState(addr, key, common.BigToHash(big.NewInt(int64(i%16*1000+j+1))))
+			}
+		}
+	}
+	root, _ := statedb.Commit(false)
+	return db, root
+}
+
+// healState runs a regular trie sync from the source database on top of the
+// snap synced state, returning the number of trie nodes that were missing.
+func healState(t *testing.T, src state.Database, dst mandb.Database, root common.Hash) int {
+	var (
+		sched  = state.NewStateSync(root, dst)
+		healed int
+	)
+	for queue := sched.Missing(256); len(queue) > 0; queue = sched.Missing(256) {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := src.TrieDB().Node(hash)
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x", hash)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dst); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		healed += len(queue)
+	}
+	return healed
+}
+
+// Tests that a state can be snap synced from multiple peers, leaving only the
+// range boundaries to be healed.
+func TestSync(t *testing.T) {
+	src, root := makeTestState()
+
+	dst := mandb.NewMemDatabase()
+	syncer := NewSyncer(dst)
+	for _, id := range []string{"alice", "bob", "carol"} {
+		syncer.Register(&testPeer{id: id, triedb: src.TrieDB(), syncer: syncer})
+	}
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to snap sync state: %v", err)
+	}
+	if syncer.accountSynced != 2000 {
+		t.Errorf("synced account count mismatch: have %d, want %d", syncer.accountSynced, 2000)
+	}
+	if syncer.codeSynced != 667 {
+		t.Errorf("synced code count mismatch: have %d, want %d", syncer.codeSynced, 667)
+	}
+	// Only the boundary nodes of the account chunks may be missing
+	total := len(src.TrieDB().Nodes())
+	if healed := healState(t, src, dst, root); healed == 0 || healed > total/10 {
+		t.Errorf("healed node count out of bounds: have %d, total %d", healed, total)
+	}
+	if damaged := state.CheckConsistency(state.NewDatabase(dst), root); len(damaged) != 0 {
+		t.Fatalf("synced state incomplete: %d damaged entries, first %v", len(damaged), damaged[0].Err)
+	}
+}
+
+// Tests that sync terminates early if none of the peers has the state, leaving
+// it to the trie sync.
+func TestSyncUnavailable(t *testing.T) {
+	_, root := makeTestState()
+
+	syncer := NewSyncer(mandb.NewMemDatabase())
+	syncer.Register(&testPeer{id: "empty", triedb: trie.NewDatabase(mandb.NewMemDatabase()), syncer: syncer})
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to terminate sync: %v", err)
+	}
+	if syncer.accountSynced != 0 {
+		t.Errorf("synced account count mismatch: have %d, want 0", syncer.accountSynced)
+	}
+	// Without any peers, sync must terminate right away too
+	if err := NewSyncer(mandb.NewMemDatabase()).Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("failed to terminate peerless sync: %v", err)
+	}
+}
+
+// Tests that the bytecode of contracts is verified before it's stored.
+func TestSyncByteCodes(t *testing.T) {
+	code := []byte{0x60, 0x00}
+	hash := crypto.Keccak256Hash(code)
+
+	syncer := NewSyncer(mandb.NewMemDatabase())
+	syncer.processCodes([]common.Hash{hash, {0x01}}, [][]byte{code, {0x02}})
+	syncer.batch.Write()
+
+	if blob, _ := syncer.db.Get(hash[:]); string(blob) != string(code) {
+		t.Errorf("stored code mismatch: have %x, want %x", blob, code)
+	}
+	if _, ok := syncer.codes[common.Hash{0x01}]; !ok || len(syncer.codes) != 1 {
+		t.Errorf("undelivered code not rescheduled: %v", syncer.codes)
+	}
+}
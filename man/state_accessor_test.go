@@ -0,0 +1,112 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package man
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/consensus/manash"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// Tests that a pruned state is regenerated by re-executing the blocks on top of
+// the closest available ancestor state, also when requested concurrently, and
+// that requests waiting for a regeneration slot can be cancelled.
+func TestStateAtBlockRegenerate(t *testing.T) {
+	var (
+		db      = mandb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+		archive = &core.CacheConfig{Disabled: true}
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, manash.NewFaker(), db, 4, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := core.NewBlockChain(db, archive, gspec.Config, manash.NewFaker(), vm.Config{})
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	blockchain.Stop()
+
+	// Prune the state of a block below the head and reopen the chain to drop
+	// any cached trie nodes
+	target := blocks[2]
+	db.Delete(target.Root().Bytes())
+
+	blockchain, _ = core.NewBlockChain(db, archive, gspec.Config, manash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	if _, err := blockchain.StateAt(target.Root()); err == nil {
+		t.Fatalf("state of block #%d not pruned", target.NumberU64())
+	}
+	man := &Matrix{blockchain: blockchain, chainDb: db, stateRegens: make(chan struct{}, maxStateRegens)}
+	if _, err := man.stateAtBlock(context.Background(), target, 0); err != errStateUnavailable {
+		t.Fatalf("regeneration without reexec: have %v, want %v", err, errStateUnavailable)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2*maxStateRegens+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			statedb, err := man.stateAtBlock(context.Background(), target, 1)
+			if err != nil {
+				t.Errorf("failed to regenerate state: %v", err)
+				return
+			}
+			if root := statedb.IntermediateRoot(false); root != target.Root() {
+				t.Errorf("regenerated root mismatch: have %x, want %x", root, target.Root())
+			}
+			if nonce, want := statedb.GetNonce(address), blocks[3].Transactions()[0].Nonce(); nonce != want {
+				t.Errorf("regenerated nonce mismatch: have %d, want %d", nonce, want)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(man.stateRegens); n != 0 {
+		t.Errorf("regeneration slots not released: %d taken", n)
+	}
+	// Requests waiting for a slot give up once their context is done
+	for i := 0; i < maxStateRegens; i++ {
+		man.stateRegens <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := man.stateAtBlock(ctx, target, 1); err != context.DeadlineExceeded {
+		t.Fatalf("regeneration with all slots taken: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
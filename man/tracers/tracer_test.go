@@ -138,3 +138,41 @@ func TestHaltBetweenSteps(t *testing.T) {
 		t.Errorf("Expected timeout error, got %v", err)
 	}
 }
+
+// Tests that isPrecompiled reports the precompiles active in the traced block,
+// including those installed by VM upgrades.
+func TestIsPrecompiled(t *testing.T) {
+	upgraded := common.BytesToAddress([]byte{0x01, 0x00})
+	vm.RegisterPrecompile("test-tracer-precompile", upgraded, vm.PrecompiledContractsByzantium[common.BytesToAddress([]byte{2})])
+
+	config := *params.TestChainConfig
+	config.VMUpgrades = map[string]*big.Int{"test-tracer-precompile": big.NewInt(2)}
+
+	code := `{step: function() {}, fault: function() {}, result: function() {
+		return [isPrecompiled(toAddress("0x0000000000000000000000000000000000000002")),
+			isPrecompiled(toAddress("0x0000000000000000000000000000000000000100"))];
+	}}`
+	for i, tt := range []struct {
+		number *big.Int
+		want   string
+	}{
+		{big.NewInt(1), "[true,false]"},
+		{big.NewInt(2), "[true,true]"},
+	} {
+		tracer, err := New(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := vm.NewEVM(vm.Context{BlockNumber: tt.number}, nil, &config, vm.Config{Debug: true, Tracer: tracer})
+		contract := vm.NewContract(&account{}, &account{}, big.NewInt(0), 0)
+		tracer.CaptureState(env, 0, 0, 0, 0, nil, nil, contract, 0, nil)
+
+		ret, err := tracer.GetResult()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if string(ret) != tt.want {
+			t.Errorf("test %d: result mismatch: have %s, want %s", i, ret, tt.want)
+		}
+	}
+}
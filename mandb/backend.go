@@ -0,0 +1,90 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mandb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEngine is the name of the key-value store used if none is configured.
+// LevelDB is always built in and Pebble on the platforms it supports, any other
+// store (e.g. Badger) has to be added through Register.
+const DefaultEngine = "leveldb"
+
+// Opener opens (or creates if missing) a persistent database at the given path,
+// using cache megabytes of memory and at most handles open files. A read-only
+// database must already exist and has to reject all writes.
+type Opener func(file string, cache int, handles int, readonly bool) (Database, error)
+
+var (
+	enginesLock sync.RWMutex
+	engines     = make(map[string]Opener)
+)
+
+func init() {
+	Register(DefaultEngine, func(file string, cache int, handles int, readonly bool) (Database, error) {
+		if readonly {
+			return NewReadOnlyLDBDatabase(file, cache, handles)
+		}
+		return NewLDBDatabase(file, cache, handles)
+	})
+}
+
+// Register makes a database engine available under the given name. Backends
+// wrapping other key-value stores are expected to call it from their init.
+// Registering the same name twice panics.
+func Register(name string, open Opener) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("mandb: database engine %q registered twice", name))
+	}
+	engines[name] = open
+}
+
+// Engines returns the sorted names of all the registered database engines.
+func Engines() []string {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the database at file with the given engine. An empty engine name
+// selects DefaultEngine.
+func Open(engine string, file string, cache int, handles int, readonly bool) (Database, error) {
+	if engine == "" {
+		engine = DefaultEngine
+	}
+	enginesLock.RLock()
+	open, ok := engines[engine]
+	enginesLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown database engine %q (available: %s)", engine, strings.Join(Engines(), ", "))
+	}
+	return open(file, cache, handles, readonly)
+}
@@ -13,41 +13,52 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Copyright 2016 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
 
-// +build openbsd
-// +build 386 amd64 arm
-
-package unix
+package mandb
 
 import (
-	"syscall"
-	"unsafe"
-)
+	"time"
 
-const (
-	SYS_PLEDGE = 108
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
 )
 
-// Pledge implements the pledge syscall. For more information see pledge(2).
-func Pledge(promises string, paths []string) error {
-	promisesPtr, err := syscall.BytePtrFromString(promises)
-	if err != nil {
-		return err
-	}
-	promisesUnsafe, pathsUnsafe := unsafe.Pointer(promisesPtr), unsafe.Pointer(nil)
-	if paths != nil {
-		var pathsPtr []*byte
-		if pathsPtr, err = syscall.SlicePtrFromStrings(paths); err != nil {
-			return err
+// Backup copies every item of a snapshot into the destination database in
+// batches, returning the number of items and bytes written. The snapshot is
+// not released.
+func Backup(snap Snapshot, dst Database) (uint64, common.StorageSize, error) {
+	var (
+		items  uint64
+		size   common.StorageSize
+		batch  = dst.NewBatch()
+		it     = snap.NewIterator()
+		logged = time.Now()
+	)
+	defer it.Release()
+
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return items, size, err
 		}
-		pathsUnsafe = unsafe.Pointer(&pathsPtr[0])
+		items++
+		size += common.StorageSize(len(it.Key()) + len(it.Value()))
+
+		if batch.ValueSize() >= IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return items, size, err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Backing up database", "items", items, "size", size)
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return items, size, err
 	}
-	_, _, e := syscall.Syscall(SYS_PLEDGE, uintptr(promisesUnsafe), uintptr(pathsUnsafe), 0)
-	if e != 0 {
-		return e
+	if err := batch.Write(); err != nil {
+		return items, size, err
 	}
-	return nil
+	return items, size, nil
 }
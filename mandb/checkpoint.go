@@ -0,0 +1,150 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mandb
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointAttempts is the number of times a checkpoint of a database in use
+// is retried if the writer rotates its manifest or compacts tables away while
+// the files are being gathered.
+const checkpointAttempts = 5
+
+// errCheckpointRace is returned if the live database kept changing its manifest
+// during all the checkpoint attempts.
+var errCheckpointRace = errors.New("database changed while creating checkpoint")
+
+// checkpointLDB creates a private copy of the LevelDB database at file that can
+// be opened while another process holds the database open for writing. Tables
+// are immutable and get hard linked where possible, only the journals and the
+// manifest are copied. The returned directory must be removed by the caller.
+//
+// The journals are gathered first, then the manifest, then the tables, so any
+// data flushed out of a copied journal is either still recorded in it or in a
+// table referenced by the copied manifest. The checkpoint is only accepted if
+// the manifest did not change while the tables were linked, as compactions
+// never delete tables before recording that in the manifest.
+func checkpointLDB(file string) (string, error) {
+	// Keep the checkpoint next to the database so tables can be hard linked
+	dir, err := ioutil.TempDir(filepath.Dir(file), filepath.Base(file)+".checkpoint-")
+	if err != nil {
+		if dir, err = ioutil.TempDir("", filepath.Base(file)+".checkpoint-"); err != nil {
+			return "", err
+		}
+	}
+	for i := 0; i < checkpointAttempts; i++ {
+		if err = gatherLDB(file, dir); err == nil {
+			return dir, nil
+		}
+		// Start each attempt from an empty directory
+		os.RemoveAll(dir)
+		if err = os.Mkdir(dir, 0700); err != nil {
+			break
+		}
+	}
+	os.RemoveAll(dir)
+	return "", err
+}
+
+// gatherLDB makes a single attempt at copying the files of the LevelDB database
+// at src needed to open it into dst.
+func gatherLDB(src string, dst string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, info := range files {
+		if strings.HasSuffix(info.Name(), ".log") {
+			if err := copyFile(filepath.Join(src, info.Name()), filepath.Join(dst, info.Name()), -1); err != nil {
+				return err
+			}
+		}
+	}
+	current, size, err := readManifestHead(src)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(src, current), filepath.Join(dst, current), size); err != nil {
+		return err
+	}
+	if files, err = ioutil.ReadDir(src); err != nil {
+		return err
+	}
+	for _, info := range files {
+		if name := info.Name(); strings.HasSuffix(name, ".ldb") || strings.HasSuffix(name, ".sst") {
+			if err := os.Link(filepath.Join(src, name), filepath.Join(dst, name)); err != nil {
+				if err := copyFile(filepath.Join(src, name), filepath.Join(dst, name), -1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if again, resize, err := readManifestHead(src); err != nil || again != current || resize != size {
+		return errCheckpointRace
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, "CURRENT"), []byte(current+"\n"), 0644); err != nil {
+		return err
+	}
+	// Read-only LevelDB instances expect the lock file to exist
+	return ioutil.WriteFile(filepath.Join(dst, "LOCK"), nil, 0644)
+}
+
+// readManifestHead returns the name of the current manifest of the LevelDB
+// database at dir, along with its size.
+func readManifestHead(dir string) (string, int64, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return "", 0, err
+	}
+	name := strings.TrimSpace(string(blob))
+	info, err := os.Stat(filepath.Join(dir, name))
+	if err != nil {
+		return "", 0, err
+	}
+	return name, info.Size(), nil
+}
+
+// copyFile copies the first size bytes of src into dst, or all of it if size
+// is negative.
+func copyFile(src string, dst string, size int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		_, err = io.Copy(out, in)
+	} else {
+		_, err = io.CopyN(out, in, size)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
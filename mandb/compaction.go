@@ -0,0 +1,89 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mandb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+)
+
+// CompactionScheduler accumulates the amount of data deleted from a database and
+// compacts the entire key space in the background whenever it exceeds a threshold.
+// LevelDB only reclaims the space of deleted entries when a compaction happens to
+// touch them, so without this large deletions (e.g. pruning old chain data) may
+// leave the database bloated for a long time.
+type CompactionScheduler struct {
+	db        Compacter
+	threshold uint64 // Amount of deleted data triggering a compaction
+
+	deleted uint64         // Amount of data deleted since the last compaction
+	running bool           // Whether a compaction is currently in progress
+	wg      sync.WaitGroup // Wait group tracking the background compaction
+	lock    sync.Mutex
+}
+
+// NewCompactionScheduler creates a scheduler compacting db after threshold bytes
+// worth of data was reported deleted.
+func NewCompactionScheduler(db Compacter, threshold uint64) *CompactionScheduler {
+	return &CompactionScheduler{
+		db:        db,
+		threshold: threshold,
+	}
+}
+
+// Deleted reports that size bytes of data were deleted from the database. If the
+// accumulated deletions reach the threshold and no compaction is running yet, a
+// new one is started in the background. Deletions reported while a compaction is
+// running are accounted towards the next one.
+func (s *CompactionScheduler) Deleted(size uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.deleted += size
+	if s.deleted < s.threshold || s.running {
+		return
+	}
+	deleted := s.deleted
+	s.deleted, s.running = 0, true
+
+	s.wg.Add(1)
+	go s.compact(deleted)
+}
+
+// compact flattens the entire database, resetting the running flag when done.
+func (s *CompactionScheduler) compact(deleted uint64) {
+	defer s.wg.Done()
+
+	log.Info("Compacting database", "deleted", common.StorageSize(deleted))
+	start := time.Now()
+	if err := s.db.Compact(nil, nil); err != nil {
+		log.Error("Database compaction failed", "err", err)
+	} else {
+		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	s.lock.Lock()
+	s.running = false
+	s.lock.Unlock()
+}
+
+// Wait blocks until any running background compaction finishes.
+func (s *CompactionScheduler) Wait() {
+	s.wg.Wait()
+}
@@ -18,6 +18,8 @@ package mandb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -45,6 +47,8 @@ type LDBDatabase struct {
 	fn string      // filename for reporting
 	db *leveldb.DB // LevelDB instance
 
+	checkpoint string // Private copy of a database in use opened read-only, removed on close
+
 	compTimeMeter    metrics.Meter // Meter for measuring the total time spent in database compaction
 	compReadMeter    metrics.Meter // Meter for measuring the data read during compaction
 	compWriteMeter   metrics.Meter // Meter for measuring the data written during compaction
@@ -61,6 +65,19 @@ type LDBDatabase struct {
 
 // NewLDBDatabase returns a LevelDB wrapped object.
 func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, false)
+}
+
+// NewReadOnlyLDBDatabase returns a LevelDB wrapped object that rejects all
+// writes. The database must already exist and only a shared lock is taken on
+// it, so any number of read-only instances may be open on the same directory.
+// If another process holds the database open for writing, a private checkpoint
+// of it is opened instead, which does not see any later writes.
+func NewReadOnlyLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return newLDBDatabase(file, cache, handles, true)
+}
+
+func newLDBDatabase(file string, cache int, handles int, readonly bool) (*LDBDatabase, error) {
 	logger := log.New("database", file)
 
 	// Ensure we have some minimal caching and file guarantees
@@ -70,26 +87,44 @@ func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
 	if handles < 16 {
 		handles = 16
 	}
-	logger.Info("Allocated cache and file handles", "cache", cache, "handles", handles)
+	logger.Info("Allocated cache and file handles", "cache", cache, "handles", handles, "readonly", readonly)
 
-	// Open the db and recover any potential corruptions
-	db, err := leveldb.OpenFile(file, &opt.Options{
+	// Open the db and recover any potential corruptions (recovery rewrites the
+	// manifest, so it's not attempted in read-only mode)
+	options := &opt.Options{
 		OpenFilesCacheCapacity: handles,
 		BlockCacheCapacity:     cache / 2 * opt.MiB,
 		WriteBuffer:            cache / 4 * opt.MiB, // Two of these are used internally
 		Filter:                 filter.NewBloomFilter(10),
-	})
-	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
+		ReadOnly:               readonly,
+		ErrorIfMissing:         readonly,
+	}
+	db, err := leveldb.OpenFile(file, options)
+	if _, corrupted := err.(*errors.ErrCorrupted); corrupted && !readonly {
 		db, err = leveldb.RecoverFile(file, nil)
 	}
+	// A read-only open of an existing database fails if a writer holds its lock,
+	// attach to a checkpoint of it instead
+	var checkpoint string
+	if _, corrupted := err.(*errors.ErrCorrupted); err != nil && !corrupted && readonly {
+		if _, serr := os.Stat(filepath.Join(file, "CURRENT")); serr == nil {
+			logger.Info("Database in use, opening a checkpoint", "err", err)
+			if checkpoint, err = checkpointLDB(file); err == nil {
+				if db, err = leveldb.OpenFile(checkpoint, options); err != nil {
+					os.RemoveAll(checkpoint)
+				}
+			}
+		}
+	}
 	// (Re)check for errors and abort if opening of the db failed
 	if err != nil {
 		return nil, err
 	}
 	return &LDBDatabase{
-		fn:  file,
-		db:  db,
-		log: logger,
+		fn:         file,
+		db:         db,
+		checkpoint: checkpoint,
+		log:        logger,
 	}, nil
 }
 
@@ -121,6 +156,43 @@ func (db *LDBDatabase) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
+// Compact flattens the underlying data store for the given key range. A nil
+// start and limit denote the beginning and the end of the key space.
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
+// Snapshot returns a consistent read view of the database, unaffected by any
+// writes done after its creation.
+func (db *LDBDatabase) Snapshot() (Snapshot, error) {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &ldbSnapshot{snap: snap}, nil
+}
+
+// ldbSnapshot wraps a LevelDB snapshot to implement the Snapshot interface.
+type ldbSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *ldbSnapshot) Get(key []byte) ([]byte, error) {
+	return s.snap.Get(key, nil)
+}
+
+func (s *ldbSnapshot) Has(key []byte) (bool, error) {
+	return s.snap.Has(key, nil)
+}
+
+func (s *ldbSnapshot) NewIterator() iterator.Iterator {
+	return s.snap.NewIterator(nil, nil)
+}
+
+func (s *ldbSnapshot) Release() {
+	s.snap.Release()
+}
+
 func (db *LDBDatabase) NewIterator() iterator.Iterator {
 	return db.db.NewIterator(nil, nil)
 }
@@ -148,6 +220,11 @@ func (db *LDBDatabase) Close() {
 	} else {
 		db.log.Error("Failed to close database", "err", err)
 	}
+	if db.checkpoint != "" {
+		if err := os.RemoveAll(db.checkpoint); err != nil {
+			db.log.Error("Failed to remove database checkpoint", "path", db.checkpoint, "err", err)
+		}
+	}
 }
 
 func (db *LDBDatabase) LDB() *leveldb.DB {
@@ -382,6 +459,12 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size++
+	return nil
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -395,6 +478,42 @@ func (b *ldbBatch) Reset() {
 	b.size = 0
 }
 
+func (b *ldbBatch) Replay(w Putter) error {
+	replayer := &ldbReplayer{writer: w}
+	if err := b.b.Replay(replayer); err != nil {
+		return err
+	}
+	return replayer.failure
+}
+
+// ldbReplayer is a small wrapper to implement the correct replay methods.
+type ldbReplayer struct {
+	writer  Putter
+	failure error
+}
+
+// Put inserts the given value into the key-value data store.
+func (r *ldbReplayer) Put(key, value []byte) {
+	// If the replay already failed, stop executing ops
+	if r.failure != nil {
+		return
+	}
+	r.failure = r.writer.Put(key, value)
+}
+
+// Delete removes the key from the key-value data store.
+func (r *ldbReplayer) Delete(key []byte) {
+	// If the replay already failed, stop executing ops
+	if r.failure != nil {
+		return
+	}
+	if deleter, ok := r.writer.(Deleter); ok {
+		r.failure = deleter.Delete(key)
+	} else {
+		r.failure = errReplayDelete
+	}
+}
+
 type table struct {
 	db     Database
 	prefix string
@@ -425,6 +544,31 @@ func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+// Compact flattens the given key range of the table. A nil start and limit are
+// mapped to the first and last keys carrying the table prefix.
+func (dt *table) Compact(start []byte, limit []byte) error {
+	start = append([]byte(dt.prefix), start...)
+
+	// If no limit was specified, use the first key not matching the prefix
+	if limit != nil {
+		limit = append([]byte(dt.prefix), limit...)
+	} else if len(dt.prefix) > 0 {
+		limit = []byte(dt.prefix)
+		for i := len(limit) - 1; i >= 0; i-- {
+			// Bump the current character, stopping if it doesn't overflow
+			limit[i]++
+			if limit[i] > 0 {
+				break
+			}
+			// Character overflown, proceed to the next or nil if the last
+			if i == 0 {
+				limit = nil
+			}
+		}
+	}
+	return dt.db.Compact(start, limit)
+}
+
 func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
@@ -447,6 +591,10 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -458,3 +606,27 @@ func (tb *tableBatch) ValueSize() int {
 func (tb *tableBatch) Reset() {
 	tb.batch.Reset()
 }
+
+func (tb *tableBatch) Replay(w Putter) error {
+	return tb.batch.Replay(&tableReplayer{w: w, prefix: tb.prefix})
+}
+
+// tableReplayer is a wrapper around a batch replayer which truncates
+// the added prefix.
+type tableReplayer struct {
+	w      Putter
+	prefix string
+}
+
+// Put implements the interface Putter.
+func (r *tableReplayer) Put(key []byte, value []byte) error {
+	return r.w.Put(key[len(r.prefix):], value)
+}
+
+// Delete implements the interface Deleter.
+func (r *tableReplayer) Delete(key []byte) error {
+	if deleter, ok := r.w.(Deleter); ok {
+		return deleter.Delete(key[len(r.prefix):])
+	}
+	return errReplayDelete
+}
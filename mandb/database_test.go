@@ -21,9 +21,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/matrix/go-matrix/mandb"
 )
@@ -188,3 +191,350 @@ func testParallelPutGet(db mandb.Database, t *testing.T) {
 	}
 	pending.Wait()
 }
+
+func TestLDB_Compact(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testCompact(db, t)
+}
+
+func TestMemoryDB_Compact(t *testing.T) {
+	testCompact(mandb.NewMemDatabase(), t)
+}
+
+func TestTable_Compact(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testCompact(mandb.NewTable(db, "t"), t)
+	testCompact(mandb.NewTable(db, "\xff\xff"), t)
+}
+
+func testCompact(db mandb.Database, t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		if err := db.Put(key, key); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+		if i%2 == 0 {
+			if err := db.Delete(key); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+		}
+	}
+	if err := db.Compact([]byte("key-0100"), []byte("key-0200")); err != nil {
+		t.Fatalf("range compaction failed: %v", err)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Fatalf("full compaction failed: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		data, err := db.Get(key)
+		if i%2 == 0 {
+			if err == nil {
+				t.Fatalf("key %s: deleted value returned after compaction", key)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(data, key) {
+			t.Fatalf("key %s: value mismatch after compaction: have %q, want %q (err %v)", key, data, key, err)
+		}
+	}
+}
+
+// testCompacter is a Compacter counting the number of compactions run.
+type testCompacter struct {
+	compactions int32
+	release     chan struct{}
+}
+
+func (c *testCompacter) Compact(start []byte, limit []byte) error {
+	atomic.AddInt32(&c.compactions, 1)
+	<-c.release
+	return nil
+}
+
+func TestCompactionScheduler(t *testing.T) {
+	compacter := &testCompacter{release: make(chan struct{})}
+	scheduler := mandb.NewCompactionScheduler(compacter, 100)
+
+	// Deletions below the threshold must not trigger a compaction
+	scheduler.Deleted(60)
+	if n := atomic.LoadInt32(&compacter.compactions); n != 0 {
+		t.Fatalf("compactions mismatch below threshold: have %d, want 0", n)
+	}
+	// Reaching the threshold starts one, further deletions are deferred
+	scheduler.Deleted(40)
+	for atomic.LoadInt32(&compacter.compactions) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	scheduler.Deleted(150)
+	close(compacter.release)
+	scheduler.Wait()
+
+	if n := atomic.LoadInt32(&compacter.compactions); n != 1 {
+		t.Fatalf("compactions mismatch while running: have %d, want 1", n)
+	}
+	// The deferred deletions should trigger the next compaction
+	scheduler.Deleted(0)
+	scheduler.Wait()
+	if n := atomic.LoadInt32(&compacter.compactions); n != 2 {
+		t.Fatalf("compactions mismatch after deferral: have %d, want 2", n)
+	}
+}
+
+func TestLDB_BatchReplay(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testBatchReplay(db, t)
+}
+
+func TestMemoryDB_BatchReplay(t *testing.T) {
+	testBatchReplay(mandb.NewMemDatabase(), t)
+}
+
+func TestTable_BatchReplay(t *testing.T) {
+	testBatchReplay(mandb.NewTable(mandb.NewMemDatabase(), "t-"), t)
+}
+
+func testBatchReplay(db mandb.Database, t *testing.T) {
+	batch := db.NewBatch()
+	size := 0
+	for _, v := range test_values {
+		if err := batch.Put([]byte("key"+v), []byte(v)); err != nil {
+			t.Fatalf("batch put failed: %v", err)
+		}
+		size += len(v)
+	}
+	if batch.ValueSize() != size {
+		t.Fatalf("batch size mismatch: have %d, want %d", batch.ValueSize(), size)
+	}
+	// Replay the batch into a secondary store and check the contents
+	replica := mandb.NewMemDatabase()
+	if err := batch.Replay(replica); err != nil {
+		t.Fatalf("batch replay failed: %v", err)
+	}
+	if replica.Len() != len(test_values) {
+		t.Fatalf("replayed item count mismatch: have %d, want %d", replica.Len(), len(test_values))
+	}
+	for _, v := range test_values {
+		data, err := replica.Get([]byte("key" + v))
+		if err != nil || !bytes.Equal(data, []byte(v)) {
+			t.Fatalf("replayed value mismatch for %q: have %q (err %v)", v, data, err)
+		}
+		// Replaying must not have written into the batch's own database
+		if has, _ := db.Has([]byte("key" + v)); has {
+			t.Fatalf("replay wrote %q into the source database", v)
+		}
+	}
+	// Reset batches must replay nothing
+	batch.Reset()
+	if batch.ValueSize() != 0 {
+		t.Fatalf("batch size mismatch after reset: have %d, want 0", batch.ValueSize())
+	}
+	replica = mandb.NewMemDatabase()
+	if err := batch.Replay(replica); err != nil {
+		t.Fatalf("batch replay failed: %v", err)
+	}
+	if replica.Len() != 0 {
+		t.Fatalf("reset batch replayed %d items", replica.Len())
+	}
+}
+
+func TestLDB_Snapshot(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testSnapshot(db, t)
+}
+
+func TestMemoryDB_Snapshot(t *testing.T) {
+	testSnapshot(mandb.NewMemDatabase(), t)
+}
+
+func testSnapshot(db mandb.Database, t *testing.T) {
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	snap, err := db.(mandb.Snapshotter).Snapshot()
+	if err != nil {
+		t.Fatalf("failed to take snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	// Modifications after the snapshot must not be visible through it
+	db.Put([]byte("key-000"), []byte("changed"))
+	db.Put([]byte("key-new"), []byte("new"))
+	db.Delete([]byte("key-001"))
+
+	if data, err := snap.Get([]byte("key-000")); err != nil || string(data) != "value-0" {
+		t.Errorf("snapshot item mismatch: have %q, %v, want %q", data, err, "value-0")
+	}
+	if has, _ := snap.Has([]byte("key-001")); !has {
+		t.Errorf("deleted item missing from snapshot")
+	}
+	if has, _ := snap.Has([]byte("key-new")); has {
+		t.Errorf("new item present in snapshot")
+	}
+	// Backing up the snapshot must copy exactly its content
+	backup := mandb.NewMemDatabase()
+	items, _, err := mandb.Backup(snap, backup)
+	if err != nil {
+		t.Fatalf("failed to back up snapshot: %v", err)
+	}
+	if items != 100 || backup.Len() != 100 {
+		t.Fatalf("backup item count mismatch: have %d/%d, want 100", items, backup.Len())
+	}
+	for i := 0; i < 100; i++ {
+		want := fmt.Sprintf("value-%d", i)
+		if data, err := backup.Get([]byte(fmt.Sprintf("key-%03d", i))); err != nil || string(data) != want {
+			t.Errorf("backup item %d mismatch: have %q, %v, want %q", i, data, err, want)
+		}
+	}
+}
+
+func TestLDB_ReadOnly(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	// Opening a missing database read-only must not create it
+	if _, err := mandb.NewReadOnlyLDBDatabase(dirname, 0, 0); err == nil {
+		t.Fatalf("missing database opened read-only")
+	}
+	db, err := mandb.NewLDBDatabase(dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	db.Close()
+
+	// Any number of read-only instances may share the database
+	first, err := mandb.Open(mandb.DefaultEngine, dirname, 0, 0, true)
+	if err != nil {
+		t.Fatalf("failed to open database read-only: %v", err)
+	}
+	defer first.Close()
+
+	second, err := mandb.NewReadOnlyLDBDatabase(dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database read-only twice: %v", err)
+	}
+	defer second.Close()
+
+	for i, db := range []mandb.Database{first, second} {
+		if data, err := db.Get([]byte("key")); err != nil || string(data) != "value" {
+			t.Errorf("instance %d: read mismatch: have %q, %v, want %q", i, data, err, "value")
+		}
+		if err := db.Put([]byte("key"), []byte("other")); err == nil {
+			t.Errorf("instance %d: write succeeded on read-only database", i)
+		}
+		batch := db.NewBatch()
+		batch.Put([]byte("key"), []byte("other"))
+		if err := batch.Write(); err == nil {
+			t.Errorf("instance %d: batch write succeeded on read-only database", i)
+		}
+	}
+	// Writers must not be able to open a database held read-only
+	if _, err := mandb.NewLDBDatabase(dirname, 0, 0); err == nil {
+		t.Errorf("database opened for writing while held read-only")
+	}
+}
+
+// Tests that a database held open for writing by another instance can still be
+// opened read-only, through a checkpoint that is removed on close.
+func TestLDB_ReadOnlyInUse(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	path := filepath.Join(dirname, "chaindata")
+	writer, err := mandb.NewLDBDatabase(path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer writer.Close()
+
+	// Flush some of the data into tables and leave the rest in the journal
+	if err := writer.Put([]byte("table"), []byte("flushed")); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	if err := writer.Compact(nil, nil); err != nil {
+		t.Fatalf("failed to compact database: %v", err)
+	}
+	if err := writer.Put([]byte("journal"), []byte("pending")); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	reader, err := mandb.Open(mandb.DefaultEngine, path, 0, 0, true)
+	if err != nil {
+		t.Fatalf("failed to open locked database read-only: %v", err)
+	}
+	for key, want := range map[string]string{"table": "flushed", "journal": "pending"} {
+		if data, err := reader.Get([]byte(key)); err != nil || string(data) != want {
+			t.Errorf("key %q: read mismatch: have %q, %v, want %q", key, data, err, want)
+		}
+	}
+	if err := reader.Put([]byte("table"), []byte("other")); err == nil {
+		t.Errorf("write succeeded on read-only database")
+	}
+	// The writer must keep working and the checkpoint must not see its new data
+	if err := writer.Put([]byte("later"), []byte("value")); err != nil {
+		t.Errorf("failed to write to the live database: %v", err)
+	}
+	if ok, _ := reader.Has([]byte("later")); ok {
+		t.Errorf("checkpoint sees writes done after its creation")
+	}
+	reader.Close()
+
+	files, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		t.Fatalf("failed to list data directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("checkpoint left behind: have %d entries in data directory, want 1", len(files))
+	}
+}
+
+func TestOpenEngine(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	// The default engine must be available under both its name and empty string
+	for _, engine := range []string{"", mandb.DefaultEngine} {
+		db, err := mandb.Open(engine, dirname, 0, 0, false)
+		if err != nil {
+			t.Fatalf("engine %q: failed to open database: %v", engine, err)
+		}
+		if _, ok := db.(*mandb.LDBDatabase); !ok {
+			t.Errorf("engine %q: database type mismatch: have %T, want *mandb.LDBDatabase", engine, db)
+		}
+		db.Close()
+	}
+	if _, err := mandb.Open("nonexistent", dirname, 0, 0, false); err == nil {
+		t.Errorf("unknown engine opened successfully")
+	}
+	// Custom engines should be usable once registered
+	mandb.Register("test-memory", func(string, int, int, bool) (mandb.Database, error) {
+		return mandb.NewMemDatabase(), nil
+	})
+	if db, err := mandb.Open("test-memory", dirname, 0, 0, false); err != nil {
+		t.Errorf("failed to open registered engine: %v", err)
+	} else if _, ok := db.(*mandb.MemDatabase); !ok {
+		t.Errorf("registered engine type mismatch: have %T, want *mandb.MemDatabase", db)
+	}
+	found := false
+	for _, name := range mandb.Engines() {
+		found = found || name == "test-memory"
+	}
+	if !found {
+		t.Errorf("registered engine missing from %v", mandb.Engines())
+	}
+}
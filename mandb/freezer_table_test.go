@@ -0,0 +1,276 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mandb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/matrix/go-matrix/metrics"
+)
+
+// getChunk returns a chunk of data of the given size, filled with the given byte.
+func getChunk(size int, b int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(b)
+	}
+	return data
+}
+
+func newTestTable(t *testing.T, dir string, maxFileSize uint32, noCompression bool) *freezerTable {
+	table, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), maxFileSize, noCompression, false)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	return table
+}
+
+// Tests that data written into a freezer table can be read back, both before and
+// after reopening the table, across multiple data files.
+func TestFreezerTableBasics(t *testing.T) {
+	for _, noCompression := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "freezer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		// Write 15 bytes 255 times, results in 85 files
+		table := newTestTable(t, dir, 50, noCompression)
+		for i := 0; i < 255; i++ {
+			if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+				t.Fatalf("failed to append item %d: %v", i, err)
+			}
+		}
+		if err := table.Append(300, getChunk(15, 0)); err == nil {
+			t.Fatalf("out of order append succeeded")
+		}
+		for reopen := 0; reopen < 2; reopen++ {
+			for i := 0; i < 255; i++ {
+				blob, err := table.Retrieve(uint64(i))
+				if err != nil {
+					t.Fatalf("compression %v, reopen %d: failed to retrieve item %d: %v", !noCompression, reopen, i, err)
+				}
+				if want := getChunk(15, i); !bytes.Equal(blob, want) {
+					t.Fatalf("compression %v, reopen %d: item %d mismatch: have %x, want %x", !noCompression, reopen, i, blob, want)
+				}
+			}
+			if _, err := table.Retrieve(255); err != errOutOfBounds {
+				t.Fatalf("out of bounds read error mismatch: have %v, want %v", err, errOutOfBounds)
+			}
+			table.Close()
+			table = newTestTable(t, dir, 50, noCompression)
+		}
+		table.Close()
+	}
+}
+
+// Tests that a table with a head file missing some data repairs itself by
+// dropping the indexes pointing to it.
+func TestFreezerTableRepairDanglingHead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table := newTestTable(t, dir, 50, true)
+	for i := 0; i < 255; i++ {
+		table.Append(uint64(i), getChunk(15, i))
+	}
+	table.Close()
+
+	// Chop off a few bytes of the head data file
+	fname := fmt.Sprintf("%s/test.%04d.rdat", dir, 254/3)
+	stat, err := os.Stat(fname)
+	if err != nil {
+		t.Fatalf("failed to stat head file: %v", err)
+	}
+	if err := os.Truncate(fname, stat.Size()-4); err != nil {
+		t.Fatalf("failed to truncate head file: %v", err)
+	}
+	table = newTestTable(t, dir, 50, true)
+	defer table.Close()
+
+	if table.items != 254 {
+		t.Fatalf("item count mismatch after repair: have %d, want %d", table.items, 254)
+	}
+	if _, err := table.Retrieve(253); err != nil {
+		t.Fatalf("failed to retrieve last intact item: %v", err)
+	}
+	// The table must be writable again after the repair
+	if err := table.Append(254, getChunk(15, 254)); err != nil {
+		t.Fatalf("failed to append after repair: %v", err)
+	}
+}
+
+// Tests that truncating a table drops all data above the limit, including any
+// data files, and that new items can be appended afterwards.
+func TestFreezerTableTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table := newTestTable(t, dir, 50, false)
+	defer table.Close()
+
+	for i := 0; i < 30; i++ {
+		table.Append(uint64(i), getChunk(15, i))
+	}
+	if err := table.truncate(10); err != nil {
+		t.Fatalf("failed to truncate table: %v", err)
+	}
+	if _, err := table.Retrieve(10); err != errOutOfBounds {
+		t.Fatalf("truncated item still available: %v", err)
+	}
+	for i := 10; i < 20; i++ {
+		if err := table.Append(uint64(i), getChunk(15, 0xff-i)); err != nil {
+			t.Fatalf("failed to append item %d after truncation: %v", i, err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		want := getChunk(15, i)
+		if i >= 10 {
+			want = getChunk(15, 0xff-i)
+		}
+		if blob, err := table.Retrieve(uint64(i)); err != nil || !bytes.Equal(blob, want) {
+			t.Fatalf("item %d mismatch: have %x, want %x (err %v)", i, blob, want, err)
+		}
+	}
+}
+
+// Tests that the freezer keeps all its tables in sync, rejecting incomplete and
+// out of order items and truncating every table together.
+func TestFreezer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tables := map[string]bool{"a": false, "b": true}
+	freezer, err := NewFreezer(dir, "", tables, false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := freezer.AppendAncient(uint64(i), map[string][]byte{"a": getChunk(10, i), "b": getChunk(5, i)}); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	if err := freezer.AppendAncient(10, map[string][]byte{"a": getChunk(10, 10)}); err == nil {
+		t.Fatalf("incomplete item accepted")
+	}
+	if err := freezer.AppendAncient(11, map[string][]byte{"a": getChunk(10, 11), "b": getChunk(5, 11)}); err == nil {
+		t.Fatalf("out of order item accepted")
+	}
+	if frozen, _ := freezer.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want 10", frozen)
+	}
+	if has, _ := freezer.HasAncient("a", 9); !has {
+		t.Fatalf("frozen item missing")
+	}
+	if has, _ := freezer.HasAncient("c", 0); has {
+		t.Fatalf("unknown table reported item")
+	}
+	if err := freezer.TruncateAncients(5); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	freezer.Close()
+
+	// Reopen the freezer and check the truncation persisted
+	if freezer, err = NewFreezer(dir, "", tables, false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer freezer.Close()
+
+	if frozen, _ := freezer.Ancients(); frozen != 5 {
+		t.Fatalf("frozen count mismatch after reopen: have %d, want 5", frozen)
+	}
+	for i := 0; i < 5; i++ {
+		if blob, err := freezer.Ancient("b", uint64(i)); err != nil || !bytes.Equal(blob, getChunk(5, i)) {
+			t.Fatalf("item %d mismatch: have %x, want %x (err %v)", i, blob, getChunk(5, i), err)
+		}
+	}
+	if _, err := freezer.Ancient("c", 0); err != errUnknownTable {
+		t.Fatalf("unknown table error mismatch: have %v, want %v", err, errUnknownTable)
+	}
+}
+
+// Tests that a read-only freezer serves existing data, ignores half written items
+// instead of repairing them and rejects all modifications.
+func TestFreezerReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tables := map[string]bool{"a": false, "b": true}
+	if _, err := NewFreezer(dir, "", tables, true); err == nil {
+		t.Fatalf("missing freezer opened read-only")
+	}
+	freezer, err := NewFreezer(dir, "", tables, false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := freezer.AppendAncient(uint64(i), map[string][]byte{"a": getChunk(10, i), "b": getChunk(5, i)}); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	// Simulate an in-progress append: one table ahead, one with dangling data
+	if err := freezer.tables["a"].Append(10, getChunk(10, 10)); err != nil {
+		t.Fatalf("failed to append dangling item: %v", err)
+	}
+	if _, err := freezer.tables["b"].head.Write(getChunk(5, 10)); err != nil {
+		t.Fatalf("failed to write dangling data: %v", err)
+	}
+	freezer.Sync()
+
+	readonly, err := NewFreezer(dir, "", tables, true)
+	if err != nil {
+		t.Fatalf("failed to open freezer read-only: %v", err)
+	}
+	if frozen, _ := readonly.Ancients(); frozen != 10 {
+		t.Fatalf("frozen count mismatch: have %d, want 10", frozen)
+	}
+	for i := 0; i < 10; i++ {
+		if blob, err := readonly.Ancient("b", uint64(i)); err != nil || !bytes.Equal(blob, getChunk(5, i)) {
+			t.Fatalf("item %d mismatch: have %x, want %x (err %v)", i, blob, getChunk(5, i), err)
+		}
+	}
+	if err := readonly.AppendAncient(10, map[string][]byte{"a": getChunk(10, 10), "b": getChunk(5, 10)}); err != errReadOnly {
+		t.Fatalf("append error mismatch: have %v, want %v", err, errReadOnly)
+	}
+	if err := readonly.TruncateAncients(5); err != errReadOnly {
+		t.Fatalf("truncate error mismatch: have %v, want %v", err, errReadOnly)
+	}
+	readonly.Close()
+
+	// The writer must still see its own data
+	if blob, err := freezer.tables["a"].Retrieve(10); err != nil || !bytes.Equal(blob, getChunk(10, 10)) {
+		t.Fatalf("dangling item lost: have %x, want %x (err %v)", blob, getChunk(10, 10), err)
+	}
+	freezer.Close()
+}
@@ -16,6 +16,12 @@
 
 package mandb
 
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
 // Code using batches should try to add this much data to the batch.
 // The value was determined empirically.
 const IdealBatchSize = 100 * 1024
@@ -25,22 +31,112 @@ type Putter interface {
 	Put(key []byte, value []byte) error
 }
 
+// Deleter wraps the database delete operation supported by both batches and regular databases.
+type Deleter interface {
+	Delete(key []byte) error
+}
+
+// Iteratee wraps the NewIteratorWithPrefix method of a backing data store.
+type Iteratee interface {
+	// NewIteratorWithPrefix creates an iterator over the subset of the database
+	// content with the given key prefix, in ascending key order.
+	NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+}
+
+// Compacter wraps the Compact method of a backing data store.
+type Compacter interface {
+	// Compact flattens the underlying data store for the given key range. In essence,
+	// deleted and overwritten versions are discarded, and the data is rearranged to
+	// reduce the cost of operations needed to access them.
+	//
+	// A nil start is treated as a key before all keys in the data store; a nil limit
+	// is treated as a key after all keys in the data store. If both are nil then the
+	// entire data store is compacted.
+	Compact(start []byte, limit []byte) error
+}
+
 // Database wraps all database operations. All methods are safe for concurrent use.
 type Database interface {
 	Putter
+	Deleter
+	Compacter
 	Get(key []byte) ([]byte, error)
 	Has(key []byte) (bool, error)
-	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
 }
 
+// Snapshot is a frozen, read-only view of a database at a given point in time.
+// Writes to the database after the snapshot was taken are not visible through
+// it. A snapshot must be released once it's no longer needed.
+type Snapshot interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+
+	// NewIterator creates an iterator over the entire key space of the snapshot,
+	// in ascending key order.
+	NewIterator() iterator.Iterator
+
+	// Release releases all the resources held by the snapshot.
+	Release()
+}
+
+// Snapshotter wraps the Snapshot method of a backing data store.
+type Snapshotter interface {
+	// Snapshot returns a consistent, point-in-time read view of the data store.
+	Snapshot() (Snapshot, error)
+}
+
+// AncientReader contains the methods required to read from immutable ancient data.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the
+	// ancient store.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the ancient item numbers in the ancient store.
+	Ancients() (uint64, error)
+
+	// AncientSize returns the ancient size of the specified category.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter contains the methods required to write to immutable ancient data.
+type AncientWriter interface {
+	// AppendAncient injects all binary blobs belong to block at the end of the
+	// append-only immutable table files. Every table must be given a blob.
+	AppendAncient(number uint64, items map[string][]byte) error
+
+	// TruncateAncients discards all but the first n ancient data from the ancient store.
+	TruncateAncients(n uint64) error
+
+	// Sync flushes all in-memory ancient store data to disk.
+	Sync() error
+}
+
+// AncientStore contains all the methods required to allow handling different
+// ancient data stores backing immutable chain data store.
+type AncientStore interface {
+	AncientReader
+	AncientWriter
+}
+
 // Batch is a write-only database that commits changes to its host database
 // when Write is called. Batch cannot be used concurrently.
 type Batch interface {
 	Putter
+	Deleter
 	ValueSize() int // amount of data in the batch
 	Write() error
 	// Reset resets the batch for reuse
 	Reset()
+	// Replay replays the batch contents into the given writer. Deletions can
+	// only be replayed if the writer is also a Deleter.
+	Replay(w Putter) error
 }
+
+// errReplayDelete is returned if a batch containing deletions is replayed into
+// a writer not able to delete.
+var errReplayDelete = errors.New("batch replay target can't delete")
@@ -18,9 +18,13 @@ package mandb
 
 import (
 	"errors"
+	"strings"
 	"sync"
 
 	"github.com/matrix/go-matrix/common"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
 )
 
 /*
@@ -88,15 +92,74 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// Compact is a no-op for the memory database, there's nothing to flatten.
+func (db *MemDatabase) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
 func (db *MemDatabase) Close() {}
 
+// Snapshot returns a read view of the database by copying its current content.
+func (db *MemDatabase) Snapshot() (Snapshot, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	snap := memdb.New(comparer.DefaultComparer, 0)
+	for key, value := range db.db {
+		snap.Put([]byte(key), value)
+	}
+	return &memSnapshot{db: snap}, nil
+}
+
+// memSnapshot is a sorted, immutable copy of a memory database.
+type memSnapshot struct {
+	db *memdb.DB
+}
+
+func (s *memSnapshot) Get(key []byte) ([]byte, error) {
+	if value, err := s.db.Get(key); err == nil {
+		return common.CopyBytes(value), nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (s *memSnapshot) Has(key []byte) (bool, error) {
+	return s.db.Contains(key), nil
+}
+
+func (s *memSnapshot) NewIterator() iterator.Iterator {
+	return s.db.NewIterator(nil)
+}
+
+func (s *memSnapshot) Release() {
+	s.db.Reset()
+}
+
+// NewIteratorWithPrefix returns an iterator over a sorted copy of the database
+// items with a particular key prefix.
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	items := memdb.New(comparer.DefaultComparer, 0)
+	for key, value := range db.db {
+		if strings.HasPrefix(key, string(prefix)) {
+			items.Put([]byte(key), value)
+		}
+	}
+	return items.NewIterator(nil)
+}
+
 func (db *MemDatabase) NewBatch() Batch {
 	return &memBatch{db: db}
 }
 
 func (db *MemDatabase) Len() int { return len(db.db) }
 
-type kv struct{ k, v []byte }
+type kv struct {
+	k, v []byte
+	del  bool
+}
 
 type memBatch struct {
 	db     *MemDatabase
@@ -105,16 +168,26 @@ type memBatch struct {
 }
 
 func (b *memBatch) Put(key, value []byte) error {
-	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value)})
+	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value), false})
 	b.size += len(value)
 	return nil
 }
 
+func (b *memBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), nil, true})
+	b.size++
+	return nil
+}
+
 func (b *memBatch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
 	for _, kv := range b.writes {
+		if kv.del {
+			delete(b.db.db, string(kv.k))
+			continue
+		}
 		b.db.db[string(kv.k)] = kv.v
 	}
 	return nil
@@ -128,3 +201,22 @@ func (b *memBatch) Reset() {
 	b.writes = b.writes[:0]
 	b.size = 0
 }
+
+func (b *memBatch) Replay(w Putter) error {
+	for _, kv := range b.writes {
+		if kv.del {
+			deleter, ok := w.(Deleter)
+			if !ok {
+				return errReplayDelete
+			}
+			if err := deleter.Delete(kv.k); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.k, kv.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build (amd64 || arm64) && go1.20
+// +build amd64 arm64
+// +build go1.20
+
+package mandb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// PebbleEngine is the name the Pebble backed database is registered under.
+// Pebble only supports 64-bit platforms and needs Go 1.20 or newer to build.
+const PebbleEngine = "pebble"
+
+func init() {
+	Register(PebbleEngine, func(file string, cache int, handles int, readonly bool) (Database, error) {
+		return NewPebbleDatabase(file, cache, handles, readonly)
+	})
+}
+
+type PebbleDatabase struct {
+	fn string     // filename for reporting
+	db *pebble.DB // Pebble instance
+
+	log log.Logger // Contextual logger tracking the database path
+}
+
+// NewPebbleDatabase returns a Pebble wrapped object. A read-only database must
+// already exist and rejects all writes.
+func NewPebbleDatabase(file string, cache int, handles int, readonly bool) (*PebbleDatabase, error) {
+	logger := log.New("database", file)
+
+	// Ensure we have some minimal caching and file guarantees
+	if cache < 16 {
+		cache = 16
+	}
+	if handles < 16 {
+		handles = 16
+	}
+	logger.Info("Allocated cache and file handles", "cache", cache, "handles", handles, "readonly", readonly)
+
+	blocks := pebble.NewCache(int64(cache/2) * 1024 * 1024)
+	defer blocks.Unref()
+
+	options := &pebble.Options{
+		Cache:        blocks,
+		MaxOpenFiles: handles,
+		// Two memory tables are kept around, one being flushed while the other
+		// is filled, matching the LevelDB write buffer split
+		MemTableSize:                uint64(cache/4) * 1024 * 1024,
+		MemTableStopWritesThreshold: 2,
+		Levels:                      []pebble.LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+		Logger:                      pebbleLogger{logger},
+		ReadOnly:                    readonly,
+		ErrorIfNotExists:            readonly,
+	}
+	db, err := pebble.Open(file, options)
+	if err != nil {
+		return nil, err
+	}
+	return &PebbleDatabase{
+		fn:  file,
+		db:  db,
+		log: logger,
+	}, nil
+}
+
+// Path returns the path to the database directory.
+func (db *PebbleDatabase) Path() string {
+	return db.fn
+}
+
+// Put puts the given key / value to the queue
+func (db *PebbleDatabase) Put(key []byte, value []byte) error {
+	return db.db.Set(key, value, pebble.NoSync)
+}
+
+func (db *PebbleDatabase) Has(key []byte) (bool, error) {
+	_, closer, err := db.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+// Get returns the given key if it's present. Missing keys are reported with the
+// same error as LevelDB uses, so callers don't depend on the engine.
+func (db *PebbleDatabase) Get(key []byte) ([]byte, error) {
+	dat, closer, err := db.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, leveldb.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return common.CopyBytes(dat), nil
+}
+
+// Delete deletes the key from the queue and database
+func (db *PebbleDatabase) Delete(key []byte) error {
+	return db.db.Delete(key, pebble.NoSync)
+}
+
+// Compact flattens the underlying data store for the given key range. A nil
+// start and limit denote the beginning and the end of the key space.
+func (db *PebbleDatabase) Compact(start []byte, limit []byte) error {
+	// Pebble has no way to express an open ended range, use a key above all the
+	// 32 byte hashes and their prefixed versions instead
+	if limit == nil {
+		limit = bytes.Repeat([]byte{0xff}, 64)
+	}
+	return db.db.Compact(start, limit, true)
+}
+
+// Snapshot returns a consistent read view of the database, unaffected by any
+// writes done after its creation.
+func (db *PebbleDatabase) Snapshot() (Snapshot, error) {
+	return &pebbleSnapshot{snap: db.db.NewSnapshot()}, nil
+}
+
+// pebbleSnapshot wraps a Pebble snapshot to implement the Snapshot interface.
+type pebbleSnapshot struct {
+	snap *pebble.Snapshot
+}
+
+func (s *pebbleSnapshot) Get(key []byte) ([]byte, error) {
+	dat, closer, err := s.snap.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, leveldb.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return common.CopyBytes(dat), nil
+}
+
+func (s *pebbleSnapshot) Has(key []byte) (bool, error) {
+	_, closer, err := s.snap.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+func (s *pebbleSnapshot) NewIterator() iterator.Iterator {
+	return newPebbleIterator(s.snap.NewIter(nil))
+}
+
+func (s *pebbleSnapshot) Release() {
+	s.snap.Close()
+}
+
+func (db *PebbleDatabase) NewIterator() iterator.Iterator {
+	return newPebbleIterator(db.db.NewIter(nil))
+}
+
+// NewIteratorWithPrefix returns a iterator to iterate over subset of database content with a particular prefix.
+func (db *PebbleDatabase) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	bounds := util.BytesPrefix(prefix)
+	return newPebbleIterator(db.db.NewIter(&pebble.IterOptions{
+		LowerBound: bounds.Start,
+		UpperBound: bounds.Limit,
+	}))
+}
+
+func (db *PebbleDatabase) Close() {
+	if err := db.db.Close(); err == nil {
+		db.log.Info("Database closed")
+	} else {
+		db.log.Error("Failed to close database", "err", err)
+	}
+}
+
+func (db *PebbleDatabase) NewBatch() Batch {
+	return &pebbleBatch{b: db.db.NewBatch()}
+}
+
+type pebbleBatch struct {
+	b    *pebble.Batch
+	size int
+}
+
+func (b *pebbleBatch) Put(key, value []byte) error {
+	b.b.Set(key, value, nil)
+	b.size += len(value)
+	return nil
+}
+
+func (b *pebbleBatch) Delete(key []byte) error {
+	b.b.Delete(key, nil)
+	b.size++
+	return nil
+}
+
+func (b *pebbleBatch) Write() error {
+	return b.b.Commit(pebble.NoSync)
+}
+
+func (b *pebbleBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *pebbleBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+func (b *pebbleBatch) Replay(w Putter) error {
+	reader := b.b.Reader()
+	for {
+		kind, key, value, ok, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		switch kind {
+		case pebble.InternalKeyKindSet:
+			err = w.Put(key, value)
+		case pebble.InternalKeyKindDelete:
+			if deleter, ok := w.(Deleter); ok {
+				err = deleter.Delete(key)
+			} else {
+				err = errReplayDelete
+			}
+		default:
+			err = fmt.Errorf("unexpected batch operation %v", kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pebbleIterator adapts a Pebble iterator to the LevelDB iterator interface the
+// rest of the codebase is written against. Unlike Pebble, LevelDB iterators
+// start out unpositioned and move to the first (or last) entry on the first
+// Next (or Prev).
+type pebbleIterator struct {
+	iter     *pebble.Iterator
+	err      error // Creation failure, the iterator is empty if set
+	started  bool  // Whether the iterator was positioned already
+	released bool
+	releaser util.Releaser
+}
+
+func newPebbleIterator(iter *pebble.Iterator, err error) *pebbleIterator {
+	return &pebbleIterator{iter: iter, err: err}
+}
+
+func (it *pebbleIterator) First() bool {
+	if it.err != nil || it.released {
+		return false
+	}
+	it.started = true
+	return it.iter.First()
+}
+
+func (it *pebbleIterator) Last() bool {
+	if it.err != nil || it.released {
+		return false
+	}
+	it.started = true
+	return it.iter.Last()
+}
+
+func (it *pebbleIterator) Seek(key []byte) bool {
+	if it.err != nil || it.released {
+		return false
+	}
+	it.started = true
+	return it.iter.SeekGE(key)
+}
+
+func (it *pebbleIterator) Next() bool {
+	if !it.started {
+		return it.First()
+	}
+	if it.err != nil || it.released || !it.iter.Valid() {
+		return false
+	}
+	return it.iter.Next()
+}
+
+func (it *pebbleIterator) Prev() bool {
+	if !it.started {
+		return it.Last()
+	}
+	if it.err != nil || it.released || !it.iter.Valid() {
+		return false
+	}
+	return it.iter.Prev()
+}
+
+func (it *pebbleIterator) Valid() bool {
+	return it.err == nil && !it.released && it.iter.Valid()
+}
+
+func (it *pebbleIterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.iter.Key()
+}
+
+func (it *pebbleIterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.iter.Value()
+}
+
+func (it *pebbleIterator) Error() error {
+	if it.err != nil || it.released {
+		return it.err
+	}
+	return it.iter.Error()
+}
+
+func (it *pebbleIterator) Release() {
+	if it.released {
+		return
+	}
+	it.released = true
+	if it.iter != nil {
+		it.iter.Close()
+	}
+	if it.releaser != nil {
+		it.releaser.Release()
+		it.releaser = nil
+	}
+}
+
+func (it *pebbleIterator) SetReleaser(releaser util.Releaser) {
+	it.releaser = releaser
+}
+
+// pebbleLogger routes the internal Pebble messages into the database logger.
+type pebbleLogger struct {
+	log log.Logger
+}
+
+func (l pebbleLogger) Infof(format string, args ...interface{}) {
+	l.log.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l pebbleLogger) Fatalf(format string, args ...interface{}) {
+	l.log.Crit(fmt.Sprintf(format, args...))
+}
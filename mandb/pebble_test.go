@@ -0,0 +1,138 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build (amd64 || arm64) && go1.20
+// +build amd64 arm64
+// +build go1.20
+
+package mandb_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/matrix/go-matrix/mandb"
+)
+
+func newTestPebble() (*mandb.PebbleDatabase, func()) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		panic("failed to create test file: " + err.Error())
+	}
+	db, err := mandb.NewPebbleDatabase(dirname, 0, 0, false)
+	if err != nil {
+		panic("failed to create test database: " + err.Error())
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dirname)
+	}
+}
+
+func TestPebble_PutGet(t *testing.T) {
+	db, remove := newTestPebble()
+	defer remove()
+	testPutGet(db, t)
+}
+
+func TestPebble_BatchReplay(t *testing.T) {
+	db, remove := newTestPebble()
+	defer remove()
+	testBatchReplay(db, t)
+}
+
+func TestPebble_Snapshot(t *testing.T) {
+	db, remove := newTestPebble()
+	defer remove()
+	testSnapshot(db, t)
+}
+
+// Tests that a Pebble database opened through the engine registry persists its
+// content and iterates over it the same way LevelDB does.
+func TestPebble_OpenPutIterate(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	db, err := mandb.Open(mandb.PebbleEngine, dirname, 0, 0, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, ok := db.(*mandb.PebbleDatabase); !ok {
+		t.Fatalf("database type mismatch: have %T, want *mandb.PebbleDatabase", db)
+	}
+	batch := db.NewBatch()
+	for i := 9; i >= 0; i-- {
+		batch.Put([]byte(fmt.Sprintf("a-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		batch.Put([]byte(fmt.Sprintf("b-%d", i)), []byte("other"))
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	db.Put([]byte("a-10"), []byte("value-10"))
+	db.Delete([]byte("a-5"))
+	db.Close()
+
+	// Reopen the database read-only and iterate over a single prefix
+	if db, err = mandb.Open(mandb.PebbleEngine, dirname, 0, 0, true); err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	want := []string{"a-0", "a-1", "a-10", "a-2", "a-3", "a-4", "a-6", "a-7", "a-8", "a-9"}
+
+	it := db.(mandb.Iteratee).NewIteratorWithPrefix([]byte("a-"))
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+		if want := "value-" + string(it.Key())[2:]; string(it.Value()) != want {
+			t.Errorf("value mismatch for %q: have %q, want %q", it.Key(), it.Value(), want)
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	it.Release()
+
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("iterated keys mismatch: have %v, want %v", keys, want)
+	}
+	// A fresh iterator must step to the last item when moving backwards
+	it = db.(mandb.Iteratee).NewIteratorWithPrefix([]byte("a-"))
+	defer it.Release()
+	if !it.Prev() || string(it.Key()) != "a-9" {
+		t.Fatalf("reverse iteration start mismatch: have %q, want %q", it.Key(), "a-9")
+	}
+	if err := db.Put([]byte("a-11"), nil); err == nil {
+		t.Errorf("write succeeded on read-only database")
+	}
+}
+
+func TestPebble_ReadOnlyMissing(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "mandb_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	if _, err := mandb.NewPebbleDatabase(dirname, 0, 0, true); err == nil {
+		t.Fatalf("missing database opened read-only")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package matrixwork
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+)
+
+// TxOrdering is the set of pending transactions handed to the block packer. It
+// yields transactions one by one while honouring per-account nonce order.
+type TxOrdering interface {
+	// Peek returns the next transaction to pack, or nil if none are left.
+	Peek() *types.Transaction
+
+	// Shift replaces the current head with the next transaction of the same account.
+	Shift()
+
+	// Pop drops the current head together with all remaining transactions of
+	// the same account.
+	Pop()
+}
+
+// OrderingPolicy builds a TxOrdering from the nonce-sorted pending transactions
+// of every account. The pending map is reowned by the policy.
+type OrderingPolicy func(signer types.Signer, pending map[common.Address]types.Transactions) TxOrdering
+
+// PriceNonceOrdering packs the highest priced transactions first.
+func PriceNonceOrdering(signer types.Signer, pending map[common.Address]types.Transactions) TxOrdering {
+	return types.NewTransactionsByPriceAndNonce(signer, pending)
+}
+
+// ArrivalOrdering packs transactions in the order they were numbered by the
+// transaction pool, i.e. first come first served.
+func ArrivalOrdering(signer types.Signer, pending map[common.Address]types.Transactions) TxOrdering {
+	return newTransactionsByArrival(pending)
+}
+
+var (
+	orderingsLock sync.RWMutex
+	orderings     = map[string]OrderingPolicy{
+		"price":   PriceNonceOrdering,
+		"arrival": ArrivalOrdering,
+	}
+)
+
+// RegisterOrdering makes an ordering policy available under the given name.
+func RegisterOrdering(name string, policy OrderingPolicy) error {
+	orderingsLock.Lock()
+	defer orderingsLock.Unlock()
+
+	if _, ok := orderings[name]; ok {
+		return fmt.Errorf("transaction ordering %q already registered", name)
+	}
+	orderings[name] = policy
+	return nil
+}
+
+// LookupOrdering returns the ordering policy registered under the given name.
+func LookupOrdering(name string) (OrderingPolicy, error) {
+	orderingsLock.RLock()
+	defer orderingsLock.RUnlock()
+
+	policy, ok := orderings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction ordering %q", name)
+	}
+	return policy, nil
+}
+
+// txNumber returns the pool assigned sequence number of a transaction, with
+// unnumbered transactions sorting last.
+func txNumber(tx *types.Transaction) uint32 {
+	if len(tx.N) == 0 {
+		return ^uint32(0)
+	}
+	return tx.N[0]
+}
+
+// txsByNumber implements a heap of transactions sorted by arrival number.
+type txsByNumber types.Transactions
+
+func (s txsByNumber) Len() int           { return len(s) }
+func (s txsByNumber) Less(i, j int) bool { return txNumber(s[i]) < txNumber(s[j]) }
+func (s txsByNumber) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *txsByNumber) Push(x interface{}) {
+	*s = append(*s, x.(*types.Transaction))
+}
+
+func (s *txsByNumber) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[0 : n-1]
+	return x
+}
+
+// transactionsByArrival returns the account heads in arrival order.
+type transactionsByArrival struct {
+	txs   []types.Transactions       // Per account nonce-sorted list of remaining transactions
+	heads txsByNumber                // Next transaction for each unique account (arrival heap)
+	index map[*types.Transaction]int // Account slot of every head transaction
+}
+
+func newTransactionsByArrival(pending map[common.Address]types.Transactions) *transactionsByArrival {
+	t := &transactionsByArrival{
+		txs:   make([]types.Transactions, 0, len(pending)),
+		heads: make(txsByNumber, 0, len(pending)),
+		index: make(map[*types.Transaction]int, len(pending)),
+	}
+	for _, accTxs := range pending {
+		if len(accTxs) == 0 {
+			continue
+		}
+		t.index[accTxs[0]] = len(t.txs)
+		t.heads = append(t.heads, accTxs[0])
+		t.txs = append(t.txs, accTxs[1:])
+	}
+	heap.Init(&t.heads)
+	return t
+}
+
+func (t *transactionsByArrival) Peek() *types.Transaction {
+	if len(t.heads) == 0 {
+		return nil
+	}
+	return t.heads[0]
+}
+
+func (t *transactionsByArrival) Shift() {
+	head := t.heads[0]
+	slot := t.index[head]
+	delete(t.index, head)
+
+	if txs := t.txs[slot]; len(txs) > 0 {
+		t.heads[0], t.txs[slot] = txs[0], txs[1:]
+		t.index[txs[0]] = slot
+		heap.Fix(&t.heads, 0)
+		return
+	}
+	heap.Pop(&t.heads)
+}
+
+func (t *transactionsByArrival) Pop() {
+	delete(t.index, heap.Pop(&t.heads).(*types.Transaction))
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package matrixwork
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/core/types"
+)
+
+func TestArrivalOrdering(t *testing.T) {
+	newTx := func(nonce uint64, number uint32) *types.Transaction {
+		tx := types.NewTransaction(nonce, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		tx.N = []uint32{number}
+		return tx
+	}
+	var (
+		a = []*types.Transaction{newTx(0, 1), newTx(1, 4)}
+		b = []*types.Transaction{newTx(0, 3), newTx(1, 2)}
+		c = []*types.Transaction{newTx(0, 5)}
+	)
+	pending := map[common.Address]types.Transactions{
+		common.BytesToAddress([]byte{1}): a,
+		common.BytesToAddress([]byte{2}): b,
+		common.BytesToAddress([]byte{3}): c,
+	}
+	txs := ArrivalOrdering(nil, pending)
+
+	// b1 arrived before b0 but must still follow it
+	for i, want := range []*types.Transaction{a[0], b[0], b[1], a[1]} {
+		if have := txs.Peek(); have != want {
+			t.Fatalf("tx %d: order mismatch: have number %v, want %v", i, have.N, want.N)
+		}
+		txs.Shift()
+	}
+	if have := txs.Peek(); have != c[0] {
+		t.Fatalf("last tx mismatch: have %v, want %v", have, c[0])
+	}
+	txs.Pop()
+	if tx := txs.Peek(); tx != nil {
+		t.Fatalf("unexpected tx after pop: %v", tx)
+	}
+}
+
+func TestLookupOrdering(t *testing.T) {
+	if _, err := LookupOrdering("price"); err != nil {
+		t.Fatalf("price ordering not found: %v", err)
+	}
+	if _, err := LookupOrdering("bogus"); err == nil {
+		t.Fatal("unknown ordering found")
+	}
+	if err := RegisterOrdering("arrival", ArrivalOrdering); err == nil {
+		t.Fatal("duplicate ordering registered")
+	}
+}
@@ -47,8 +47,9 @@ type Work struct {
 	//ancestors *set.Set       // ancestor set (used for checking uncle parent validity)
 	//family    *set.Set       // family set (used for checking uncle invalidity)
 	//uncles    *set.Set       // uncle set
-	tcount  int           // tx count in cycle
-	gasPool *core.GasPool // available gas used to pack transactions
+	tcount   int            // tx count in cycle
+	gasPool  *core.GasPool  // available gas used to pack transactions
+	ordering OrderingPolicy // order to pack pending transactions in
 
 	Block *types.Block // the new block
 
@@ -77,7 +78,13 @@ func NewWork(config *params.ChainConfig, bc *core.BlockChain, gasPool *core.GasP
 	return Work, nil
 }
 
-func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsByPriceAndNonce, bc *core.BlockChain, coinbase common.Address) (listN []uint32, retTxs []*types.Transaction) {
+// SetOrdering replaces the policy deciding the order pending transactions are
+// packed in, PriceNonceOrdering by default.
+func (env *Work) SetOrdering(policy OrderingPolicy) {
+	env.ordering = policy
+}
+
+func (env *Work) commitTransactions(mux *event.TypeMux, txs TxOrdering, bc *core.BlockChain, coinbase common.Address) (listN []uint32, retTxs []*types.Transaction) {
 	if env.gasPool == nil {
 		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
 	}
@@ -232,7 +239,11 @@ func (self *Work) ProcessTransactions(mux *event.TypeMux, tp *core.TxPool, bc *c
 		return nil,nil
 	}
 	log.INFO("===========", "ProcessTransactions:pending:", len(pending))
-	txs := types.NewTransactionsByPriceAndNonce(self.signer, pending)
+	ordering := self.ordering
+	if ordering == nil {
+		ordering = PriceNonceOrdering
+	}
+	txs := ordering(self.signer, pending)
 	//log.INFO("===========", "ProcessTransactions:txs:", txs)
 	return self.commitTransactions(mux, txs, bc, common.Address{})
 }
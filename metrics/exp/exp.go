@@ -23,7 +23,9 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/metrics"
+	"github.com/matrix/go-matrix/metrics/prometheus"
 )
 
 type exp struct {
@@ -65,6 +67,21 @@ func ExpHandler(r metrics.Registry) http.Handler {
 	return http.HandlerFunc(e.expHandler)
 }
 
+// Setup starts a dedicated metrics server at the given address, serving the
+// default registry on "/debug/metrics" in expvar and on
+// "/debug/metrics/prometheus" in Prometheus format.
+func Setup(address string) {
+	m := http.NewServeMux()
+	m.Handle("/debug/metrics", ExpHandler(metrics.DefaultRegistry))
+	m.Handle("/debug/metrics/prometheus", prometheus.Handler(metrics.DefaultRegistry))
+	log.Info("Starting metrics server", "addr", fmt.Sprintf("http://%s/debug/metrics", address))
+	go func() {
+		if err := http.ListenAndServe(address, m); err != nil {
+			log.Error("Failure in running metrics server", "err", err)
+		}
+	}()
+}
+
 func (exp *exp) getInt(name string) *expvar.Int {
 	var v *expvar.Int
 	exp.expvarLock.Lock()
@@ -13,25 +13,43 @@
 //FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
 //WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
 //OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
-// Copyright 2014 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
 
-// +build darwin dragonfly freebsd linux netbsd openbsd
+package prometheus
 
-package unix
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
 
-import "unsafe"
+	"github.com/matrix/go-matrix/metrics"
+)
 
-// fcntl64Syscall is usually SYS_FCNTL, but is overridden on 32-bit Linux
-// systems by flock_linux_32bit.go to be SYS_FCNTL64.
-var fcntl64Syscall uintptr = SYS_FCNTL
+// Tests that the registered metrics are exported in the Prometheus text format.
+func TestHandler(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
 
-// FcntlFlock performs a fcntl syscall for the F_GETLK, F_SETLK or F_SETLKW command.
-func FcntlFlock(fd uintptr, cmd int, lk *Flock_t) error {
-	_, _, errno := Syscall(fcntl64Syscall, fd, uintptr(cmd), uintptr(unsafe.Pointer(lk)))
-	if errno == 0 {
-		return nil
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("p2p/peers", reg).Inc(3)
+	metrics.NewRegisteredGauge("txpool/pending", reg).Update(42)
+	metrics.NewRegisteredTimer("chain/inserts", reg).Update(time.Second)
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/metrics/prometheus", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		"# TYPE p2p_peers gauge\np2p_peers 3\n",
+		"# TYPE txpool_pending gauge\ntxpool_pending 42\n",
+		"# TYPE chain_inserts_count counter\nchain_inserts_count 1\n",
+		"# TYPE chain_inserts summary\n",
+		"chain_inserts {quantile=\"0.5\"} 1e+09\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
 	}
-	return errno
 }
@@ -0,0 +1,229 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package miner
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/consensus"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/event"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/matrixwork"
+	"github.com/matrix/go-matrix/params"
+)
+
+const (
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	txChanSize = 4096
+)
+
+// Sealer produces blocks on its own for engines that sign their blocks locally,
+// such as proof-of-authority. Private networks running such an engine have no
+// leader election, so the sealer builds, seals and imports a block on top of
+// every new chain head instead of waiting for mining requests.
+type Sealer struct {
+	config *params.ChainConfig
+	engine consensus.Engine
+	chain  *core.BlockChain
+	txPool *core.TxPool
+	mux    *event.TypeMux
+
+	gasLimit uint64 // Gas limit the sealed blocks hone in on, zero to follow the parent's usage
+
+	sealMu  sync.Mutex    // Serialises block assembly between aborted and fresh attempts
+	lock    sync.Mutex    // Protects the quit channel
+	quit    chan struct{} // Closed to stop the running sealing loop
+	sealing int32
+}
+
+// NewSealer creates a block sealer on top of the given chain and transaction pool,
+// moving the gas limit of its blocks towards gasLimit if it is set.
+func NewSealer(config *params.ChainConfig, engine consensus.Engine, chain *core.BlockChain, txPool *core.TxPool, mux *event.TypeMux, gasLimit uint64) *Sealer {
+	return &Sealer{
+		config:   config,
+		engine:   engine,
+		chain:    chain,
+		txPool:   txPool,
+		mux:      mux,
+		gasLimit: gasLimit,
+	}
+}
+
+// Start begins sealing blocks until Stop is called.
+func (s *Sealer) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.quit != nil {
+		return
+	}
+	s.quit = make(chan struct{})
+	atomic.StoreInt32(&s.sealing, 1)
+	go s.loop(s.quit)
+}
+
+// Stop aborts any pending seal and terminates the sealing loop.
+func (s *Sealer) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.quit == nil {
+		return
+	}
+	close(s.quit)
+	s.quit = nil
+	atomic.StoreInt32(&s.sealing, 0)
+}
+
+// Sealing reports whether the sealer is currently producing blocks.
+func (s *Sealer) Sealing() bool {
+	return atomic.LoadInt32(&s.sealing) == 1
+}
+
+// instant reports whether blocks are only sealed on demand, when there are
+// transactions to include.
+func (s *Sealer) instant() bool {
+	return s.config.Clique != nil && s.config.Clique.Period == 0
+}
+
+// loop restarts the sealing attempt whenever the chain head changes, or for
+// instant chains, whenever new transactions arrive.
+func (s *Sealer) loop(quit chan struct{}) {
+	headCh := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	headSub := s.chain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	txsCh := make(chan core.NewTxsEvent, txChanSize)
+	txsSub := s.txPool.SubscribeNewTxsEvent(txsCh)
+	defer txsSub.Unsubscribe()
+
+	var abort chan struct{}
+	commit := func() {
+		if abort != nil {
+			close(abort)
+		}
+		abort = make(chan struct{})
+		go s.seal(abort)
+	}
+	defer func() {
+		if abort != nil {
+			close(abort)
+		}
+	}()
+	commit()
+
+	for {
+		select {
+		case <-headCh:
+			commit()
+
+		case <-txsCh:
+			if s.instant() {
+				commit()
+			}
+
+		case <-quit:
+			return
+		case <-headSub.Err():
+			return
+		case <-txsSub.Err():
+			return
+		}
+	}
+}
+
+// calcGasLimit computes the gas limit of the block to seal on top of parent,
+// honing in on the configured target if the operator set one.
+func (s *Sealer) calcGasLimit(parent *types.Block) uint64 {
+	if s.gasLimit > 0 {
+		return core.CalcGasLimitTarget(parent, s.gasLimit)
+	}
+	return core.CalcGasLimit(parent)
+}
+
+// seal assembles a block on top of the current head, waits for the engine to
+// sign it and imports it into the local chain.
+func (s *Sealer) seal(abort chan struct{}) {
+	s.sealMu.Lock()
+	defer s.sealMu.Unlock()
+
+	select {
+	case <-abort:
+		return
+	default:
+	}
+	parent := s.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   s.calcGasLimit(parent),
+		Time:       big.NewInt(time.Now().Unix()),
+	}
+	if err := s.engine.Prepare(s.chain, header); err != nil {
+		log.Error("Failed to prepare header for sealing", "err", err)
+		return
+	}
+	work, err := matrixwork.NewWork(s.config, s.chain, nil, header)
+	if err != nil {
+		log.Error("Failed to create sealing context", "err", err)
+		return
+	}
+	_, txs := work.ProcessTransactions(s.mux, s.txPool, s.chain)
+	if len(txs) == 0 && s.instant() {
+		return
+	}
+	block, err := s.engine.Finalize(s.chain, header, work.State, txs, nil, work.Receipts)
+	if err != nil {
+		log.Error("Failed to finalize block for sealing", "err", err)
+		return
+	}
+	header = block.Header()
+	if err := s.engine.Seal(s.chain, header, abort, nil, nil, false); err != nil {
+		log.Warn("Block sealing failed", "number", header.Number, "err", err)
+		return
+	}
+	// The engine returns without signing if the attempt was aborted
+	select {
+	case <-abort:
+		return
+	default:
+	}
+	block = block.WithSeal(header)
+
+	stat, err := s.chain.WriteBlockWithState(block, work.Receipts, work.State)
+	if err != nil {
+		log.Error("Failed writing block to chain", "err", err)
+		return
+	}
+	log.Info("Successfully sealed new block", "number", block.Number(), "hash", block.Hash(), "txs", len(txs))
+
+	// Broadcast the block and announce chain insertion event
+	s.mux.Post(core.NewMinedBlockEvent{Block: block})
+
+	logs := work.State.Logs()
+	events := []interface{}{core.ChainEvent{Block: block, Hash: block.Hash(), Logs: logs}}
+	if stat == core.CanonStatTy {
+		events = append(events, core.ChainHeadEvent{Block: block})
+	}
+	s.chain.PostChainEvents(events, logs)
+}
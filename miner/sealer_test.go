@@ -0,0 +1,106 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package miner
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matrix/go-matrix/accounts"
+	"github.com/matrix/go-matrix/consensus/clique"
+	"github.com/matrix/go-matrix/core"
+	"github.com/matrix/go-matrix/core/types"
+	"github.com/matrix/go-matrix/core/vm"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/event"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/params"
+)
+
+// newTestSealer creates a sealer on top of a proof-of-authority chain signed by
+// a single local signer, along with the directory holding its pool database.
+func newTestSealer(t *testing.T, gasLimit uint64) (*Sealer, *core.BlockChain, string) {
+	var (
+		db     = mandb.NewMemDatabase()
+		key, _ = crypto.GenerateKey()
+		signer = crypto.PubkeyToAddress(key.PublicKey)
+		config = *params.AllCliqueProtocolChanges
+	)
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000}
+
+	extra := make([]byte, 32+len(signer)+65)
+	copy(extra[32:], signer[:])
+	gspec := &core.Genesis{Config: &config, ExtraData: extra, GasLimit: 4712388}
+	gspec.MustCommit(db)
+
+	engine := clique.New(config.Clique, db)
+	engine.Authorize(signer, func(account accounts.Account, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	})
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "sealer")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	txconfig := core.DefaultTxPoolConfig
+	txconfig.Journal = ""
+	pool := core.NewTxPool(txconfig, &config, chain, dir+"/")
+
+	return NewSealer(&config, engine, chain, pool, new(event.TypeMux), gasLimit), chain, dir
+}
+
+// Tests that sealed blocks move their gas limit towards the configured target
+// instead of following the usage of their parent.
+func TestSealerGasLimitTarget(t *testing.T) {
+	tests := []struct {
+		target uint64
+		want   func(parent *types.Block) uint64
+	}{
+		{0, core.CalcGasLimit},
+		{8000000, func(parent *types.Block) uint64 { return core.CalcGasLimitTarget(parent, 8000000) }},
+		{params.MinGasLimit, func(parent *types.Block) uint64 { return core.CalcGasLimitTarget(parent, params.MinGasLimit) }},
+	}
+	for i, tt := range tests {
+		sealer, chain, dir := newTestSealer(t, tt.target)
+		defer os.RemoveAll(dir)
+
+		heads := make(chan core.ChainHeadEvent, 1)
+		sub := chain.SubscribeChainHeadEvent(heads)
+
+		sealer.Start()
+		select {
+		case head := <-heads:
+			parent := chain.Genesis()
+			if have, want := head.Block.GasLimit(), tt.want(parent); have != want {
+				t.Errorf("test %d: gas limit mismatch: have %d, want %d", i, have, want)
+			}
+			if tt.target > 0 && head.Block.GasLimit() == core.CalcGasLimit(parent) {
+				t.Errorf("test %d: gas limit follows parent usage instead of target %d", i, tt.target)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("test %d: no block sealed", i)
+		}
+		sealer.Stop()
+		sub.Unsubscribe()
+		chain.Stop()
+	}
+}
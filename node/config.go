@@ -18,21 +18,28 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/matrix/go-matrix/accounts"
+	"github.com/matrix/go-matrix/accounts/external"
 	"github.com/matrix/go-matrix/accounts/keystore"
 	"github.com/matrix/go-matrix/accounts/usbwallet"
 	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/common/hexutil"
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/p2p"
 	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/rpc"
 )
 
 const (
@@ -41,6 +48,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the authenticated RPC secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -66,6 +74,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value store backing the databases opened by the node and
+	// its services. It must be registered in mandb, an empty value selects the
+	// default LevelDB backend.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -82,9 +95,39 @@ type Config struct {
 	// scrypt KDF at the expense of security.
 	UseLightweightKDF bool `toml:",omitempty"`
 
+	// KeyStoreKDF selects the key derivation function used to encrypt new key
+	// files, either "scrypt" (default) or "argon2id". Existing key files of both
+	// kinds are always readable.
+	KeyStoreKDF string `toml:",omitempty"`
+
+	// KeyStoreScryptN and KeyStoreScryptP override the scrypt cost parameters
+	// otherwise picked based on UseLightweightKDF.
+	KeyStoreScryptN int `toml:",omitempty"`
+	KeyStoreScryptP int `toml:",omitempty"`
+
+	// KeyStoreArgon2Time, KeyStoreArgon2Memory (in KiB) and KeyStoreArgon2Threads
+	// override the Argon2id cost parameters otherwise picked based on
+	// UseLightweightKDF.
+	KeyStoreArgon2Time    uint32 `toml:",omitempty"`
+	KeyStoreArgon2Memory  uint32 `toml:",omitempty"`
+	KeyStoreArgon2Threads uint8  `toml:",omitempty"`
+
 	// NoUSB disables hardware wallet monitoring and connectivity.
 	NoUSB bool `toml:",omitempty"`
 
+	// UnlockMaxDuration caps the duration accounts can be unlocked for through
+	// the RPC APIs. Accounts are locked again automatically once it passes.
+	UnlockMaxDuration time.Duration `toml:",omitempty"`
+
+	// SignAuditLog is the file that account unlocks and signing requests made
+	// through the RPC APIs are recorded in. Relative paths are resolved inside
+	// the data directory.
+	SignAuditLog string `toml:",omitempty"`
+
+	// ExternalSigner is the IPC path or HTTP URL of an external signer (such as
+	// clef) that transaction signing requests are delegated to.
+	ExternalSigner string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -145,6 +188,56 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// AuthHost is the host interface on which to start the JWT authenticated HTTP
+	// RPC server, serving every API including the private ones. If this field is
+	// empty, no authenticated endpoint will be started.
+	AuthHost string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on incoming
+	// requests to the authenticated RPC server.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded 32 byte secret the tokens of the
+	// authenticated RPC server are signed with. If empty, a secret is generated
+	// and stored in the instance directory.
+	JWTSecret string `toml:",omitempty"`
+
+	// RPCAccessList is the path to a file listing the namespaces ("man_*") and
+	// methods ("admin_peers") callable over the HTTP and websocket RPC interfaces,
+	// one per line. If empty, all methods of the exposed modules may be called.
+	// Subscriptions are allowed by "man_subscribe" or by their name, such as
+	// "man_newHeads".
+	RPCAccessList string `toml:",omitempty"`
+
+	// BatchRequestLimit is the maximum number of requests in a JSON-RPC batch,
+	// zero meaning unlimited. Requests beyond the limit are answered with an error.
+	BatchRequestLimit int `toml:",omitempty"`
+
+	// BatchResponseMaxSize is the maximum number of response bytes a JSON-RPC
+	// batch may produce, zero meaning unlimited. Once exceeded, the remaining
+	// requests of the batch are answered with an error.
+	BatchResponseMaxSize int `toml:",omitempty"`
+
+	// RPCRateLimit is the number of requests per second, or websocket messages,
+	// each client IP may issue to the HTTP and websocket RPC servers. Zero means
+	// unlimited.
+	RPCRateLimit float64 `toml:",omitempty"`
+
+	// RPCRateBurst is the number of requests a client IP may issue in excess of
+	// RPCRateLimit after being idle.
+	RPCRateBurst int `toml:",omitempty"`
+
+	// RPCMaxConnsPerIP is the maximum number of concurrent HTTP requests or open
+	// websocket connections of a single client IP, zero meaning unlimited.
+	RPCMaxConnsPerIP int `toml:",omitempty"`
+
+	// RPCResponseMaxSize is the maximum number of bytes of a single response of the
+	// HTTP and websocket RPC servers, zero meaning unlimited.
+	RPCResponseMaxSize int `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 }
@@ -218,6 +311,25 @@ func (c *Config) WSEndpoint() string {
 	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
+// AuthEndpoint resolves the authenticated RPC endpoint based on the configured
+// host interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthHost, c.AuthPort)
+}
+
+// RPCLimits returns the per client IP limits of the HTTP and websocket RPC servers.
+func (c *Config) RPCLimits() rpc.Limits {
+	return rpc.Limits{
+		RequestsPerSecond: c.RPCRateLimit,
+		Burst:             c.RPCRateBurst,
+		MaxConnections:    c.RPCMaxConnsPerIP,
+		ResponseMaxSize:   c.RPCResponseMaxSize,
+	}
+}
+
 // DefaultWSEndpoint returns the websocket endpoint used by default.
 func DefaultWSEndpoint() string {
 	config := &Config{WSHost: DefaultWSHost, WSPort: DefaultWSPort}
@@ -330,6 +442,43 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// JWTSecretKey retrieves the secret authenticating requests to the RPC endpoint
+// secured by JWT, loading it from the configured file or the data folder. If no
+// secret can be found, a new one is generated and persisted.
+func (c *Config) JWTSecretKey() ([]byte, error) {
+	file := c.JWTSecret
+	if file == "" {
+		file = c.resolvePath(datadirJWTSecret)
+	}
+	if file != "" {
+		if data, err := ioutil.ReadFile(file); err == nil {
+			secret := common.FromHex(strings.TrimSpace(string(data)))
+			if len(secret) != 32 {
+				return nil, fmt.Errorf("invalid JWT secret in %s, want 32 hex encoded bytes", file)
+			}
+			return secret, nil
+		} else if c.JWTSecret != "" {
+			return nil, err
+		}
+	}
+	// No persistent secret found, generate and store a new one.
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return secret, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Generated JWT secret", "path", file)
+	return secret, nil
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*discover.Node {
 	return c.parsePersistentNodes(c.resolvePath(datadirStaticNodes))
@@ -372,6 +521,68 @@ func (c *Config) parsePersistentNodes(path string) []*discover.Node {
 	return nodes
 }
 
+// persistentNodesLock serializes runtime updates of the static and trusted
+// node lists.
+var persistentNodesLock sync.Mutex
+
+// AddStaticNode stores the node in the static node list of the data directory,
+// so it is dialed again after a restart.
+func (c *Config) AddStaticNode(node *discover.Node) error {
+	return c.updatePersistentNodes(c.resolvePath(datadirStaticNodes), node, true)
+}
+
+// RemoveStaticNode drops the node from the static node list of the data directory.
+func (c *Config) RemoveStaticNode(node *discover.Node) error {
+	return c.updatePersistentNodes(c.resolvePath(datadirStaticNodes), node, false)
+}
+
+// AddTrustedNode stores the node in the trusted node list of the data directory.
+func (c *Config) AddTrustedNode(node *discover.Node) error {
+	return c.updatePersistentNodes(c.resolvePath(datadirTrustedNodes), node, true)
+}
+
+// RemoveTrustedNode drops the node from the trusted node list of the data directory.
+func (c *Config) RemoveTrustedNode(node *discover.Node) error {
+	return c.updatePersistentNodes(c.resolvePath(datadirTrustedNodes), node, false)
+}
+
+// updatePersistentNodes adds or removes a node in a .json node list within the
+// data directory. Entries are matched by node ID, so re-adding a node with a
+// changed endpoint replaces the old entry.
+func (c *Config) updatePersistentNodes(path string, node *discover.Node, add bool) error {
+	// Ephemeral nodes have nowhere to persist to
+	if c.DataDir == "" {
+		return nil
+	}
+	persistentNodesLock.Lock()
+	defer persistentNodesLock.Unlock()
+
+	var nodelist []string
+	if _, err := os.Stat(path); err == nil {
+		if err := common.LoadJSON(path, &nodelist); err != nil {
+			return fmt.Errorf("can't load node file %s: %v", path, err)
+		}
+	}
+	updated := make([]string, 0, len(nodelist)+1)
+	for _, url := range nodelist {
+		if n, err := discover.ParseNode(url); err == nil && n.ID == node.ID {
+			continue
+		}
+		updated = append(updated, url)
+	}
+	if add {
+		updated = append(updated, node.String())
+	}
+	blob, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, blob, 0644)
+}
+
 // AccountConfig determines the settings for scrypt and keydirectory
 func (c *Config) AccountConfig() (int, int, string, error) {
 	scryptN := keystore.StandardScryptN
@@ -380,6 +591,12 @@ func (c *Config) AccountConfig() (int, int, string, error) {
 		scryptN = keystore.LightScryptN
 		scryptP = keystore.LightScryptP
 	}
+	if c.KeyStoreScryptN != 0 {
+		scryptN = c.KeyStoreScryptN
+	}
+	if c.KeyStoreScryptP != 0 {
+		scryptP = c.KeyStoreScryptP
+	}
 
 	var (
 		keydir string
@@ -400,8 +617,44 @@ func (c *Config) AccountConfig() (int, int, string, error) {
 	return scryptN, scryptP, keydir, err
 }
 
+// KDFConfig determines the key derivation settings for new key files.
+func (c *Config) KDFConfig() (keystore.KDFConfig, error) {
+	scryptN, scryptP, _, _ := c.AccountConfig()
+
+	var kdf keystore.KDFConfig
+	switch c.KeyStoreKDF {
+	case "", keystore.KDFScrypt:
+		kdf = keystore.ScryptConfig(scryptN, scryptP)
+
+	case keystore.KDFArgon2id:
+		kdf = keystore.Argon2idConfig(keystore.StandardArgon2Time, keystore.StandardArgon2Memory, keystore.StandardArgon2Threads)
+		if c.UseLightweightKDF {
+			kdf = keystore.Argon2idConfig(keystore.LightArgon2Time, keystore.LightArgon2Memory, keystore.LightArgon2Threads)
+		}
+		if c.KeyStoreArgon2Time != 0 {
+			kdf.Argon2Time = c.KeyStoreArgon2Time
+		}
+		if c.KeyStoreArgon2Memory != 0 {
+			kdf.Argon2Memory = c.KeyStoreArgon2Memory
+		}
+		if c.KeyStoreArgon2Threads != 0 {
+			kdf.Argon2Threads = c.KeyStoreArgon2Threads
+		}
+	default:
+		return keystore.KDFConfig{}, fmt.Errorf("unsupported keystore KDF %q (scrypt|argon2id)", c.KeyStoreKDF)
+	}
+	if err := kdf.Validate(); err != nil {
+		return keystore.KDFConfig{}, fmt.Errorf("invalid keystore KDF settings: %v", err)
+	}
+	return kdf, nil
+}
+
 func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
-	scryptN, scryptP, keydir, err := conf.AccountConfig()
+	_, _, keydir, err := conf.AccountConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	kdf, err := conf.KDFConfig()
 	var ephemeral string
 	if keydir == "" {
 		// There is no datadir.
@@ -416,9 +669,10 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		return nil, "", err
 	}
 	// Assemble the account manager and supported backends
-	backends := []accounts.Backend{
-		keystore.NewKeyStore(keydir, scryptN, scryptP),
-	}
+	ks := keystore.NewKeyStoreWithConfig(keydir, kdf)
+	ks.SetUnlockLimit(conf.UnlockMaxDuration)
+
+	backends := []accounts.Backend{ks}
 	if !conf.NoUSB {
 		// Start a USB hub for Ledger hardware wallets
 		if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
@@ -433,5 +687,30 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 			backends = append(backends, trezorhub)
 		}
 	}
-	return accounts.NewManager(backends...), ephemeral, nil
+	if conf.ExternalSigner != "" {
+		// Wallets are ordered by URL and extapi:// sorts before keystore://, so
+		// an account held both locally and by the external signer is signed
+		// for by the external signer
+		extapi, err := external.NewExternalBackend(conf.ExternalSigner)
+		if err != nil {
+			return nil, "", fmt.Errorf("error connecting to external signer: %v", err)
+		}
+		backends = append(backends, extapi)
+		log.Info("Using external signer", "endpoint", conf.ExternalSigner)
+	}
+	am := accounts.NewManager(backends...)
+	if conf.SignAuditLog != "" {
+		path := conf.resolvePath(conf.SignAuditLog)
+		if path == "" {
+			path = conf.SignAuditLog
+		}
+		audit, err := accounts.NewAuditLog(path)
+		if err != nil {
+			am.Close()
+			return nil, "", fmt.Errorf("error opening signing audit log: %v", err)
+		}
+		am.SetAuditLog(audit)
+		log.Info("Recording signing requests", "auditlog", path)
+	}
+	return am, ephemeral, nil
 }
@@ -26,6 +26,7 @@ import (
 
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/p2p"
+	"github.com/matrix/go-matrix/p2p/discover"
 )
 
 // Tests that datadirs can be successfully created, be them manually configured
@@ -148,3 +149,42 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that static nodes added and removed at runtime are persisted into the
+// data directory and loaded back on the next startup.
+func TestStaticNodePersistency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		config = &Config{Name: "unit-test", DataDir: dir}
+		first  = discover.NewNode(discover.PubkeyID(&crypto.ToECDSAUnsafe(bytes.Repeat([]byte{1}, 32)).PublicKey), []byte{127, 0, 0, 1}, 30303, 30303)
+		second = discover.NewNode(discover.PubkeyID(&crypto.ToECDSAUnsafe(bytes.Repeat([]byte{2}, 32)).PublicKey), []byte{127, 0, 0, 1}, 30304, 30304)
+	)
+	if err := config.AddStaticNode(first); err != nil {
+		t.Fatalf("failed to add static node: %v", err)
+	}
+	if err := config.AddStaticNode(second); err != nil {
+		t.Fatalf("failed to add static node: %v", err)
+	}
+	// Re-adding a node must replace its entry instead of duplicating it
+	if err := config.AddStaticNode(first); err != nil {
+		t.Fatalf("failed to re-add static node: %v", err)
+	}
+	if nodes := config.StaticNodes(); len(nodes) != 2 {
+		t.Fatalf("static node count mismatch: have %d, want 2", len(nodes))
+	}
+	if err := config.RemoveStaticNode(first); err != nil {
+		t.Fatalf("failed to remove static node: %v", err)
+	}
+	nodes := (&Config{Name: "unit-test", DataDir: dir}).StaticNodes()
+	if len(nodes) != 1 || nodes[0].ID != second.ID {
+		t.Fatalf("static nodes mismatch: have %v, want [%v]", nodes, second)
+	}
+	if trusted := config.TrustedNodes(); len(trusted) != 0 {
+		t.Fatalf("trusted nodes modified: have %v", trusted)
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/matrix/go-matrix/accounts"
 	"github.com/matrix/go-matrix/accounts/signhelper"
 	"github.com/matrix/go-matrix/ca"
+	"github.com/matrix/go-matrix/core/rawdb"
 	"github.com/matrix/go-matrix/mandb"
 	"github.com/matrix/go-matrix/event"
 	"github.com/matrix/go-matrix/hd"
@@ -56,8 +57,9 @@ type Node struct {
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
 
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	rpcAPIs       []rpc.API       // List of APIs currently provided by the node
+	rpcACL        *rpc.AccessList // Allowlist of the methods callable over HTTP and websocket, nil if unrestricted
+	inprocHandler *rpc.Server     // In-process RPC request handler to process the API requests
 
 	ipcEndpoint string       // IPC endpoint to listen at (empty = IPC disabled)
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
@@ -72,6 +74,10 @@ type Node struct {
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
+	authEndpoint string       // Authenticated HTTP endpoint (interface + port) to listen at (empty = disabled)
+	authListener net.Listener // Authenticated HTTP RPC listener socket to serve API requests
+	authHandler  *rpc.Server  // Authenticated HTTP RPC request handler to process the API requests
+
 	MsgCenter  *mc.Center
 	hd         *hd.HD
 	signHelper *signhelper.SignHelper
@@ -130,6 +136,7 @@ func New(conf *Config) (*Node, error) {
 		ipcEndpoint:       conf.IPCEndpoint(),
 		httpEndpoint:      conf.HTTPEndpoint(),
 		wsEndpoint:        conf.WSEndpoint(),
+		authEndpoint:      conf.AuthEndpoint(),
 		eventmux:          new(event.TypeMux),
 		log:               conf.Logger,
 		hd:                hd,
@@ -282,6 +289,14 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Load the allowlist restricting the public endpoints, if any
+	var acl *rpc.AccessList
+	if n.config.RPCAccessList != "" {
+		var err error
+		if acl, err = rpc.LoadAccessList(n.config.RPCAccessList); err != nil {
+			return err
+		}
+	}
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -290,12 +305,19 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
-	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts); err != nil {
+	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, acl); err != nil {
 		n.stopIPC()
 		n.stopInProc()
 		return err
 	}
-	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
+	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll, acl); err != nil {
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
+	if err := n.startAuth(n.authEndpoint, apis, n.config.AuthVirtualHosts); err != nil {
+		n.stopWS()
 		n.stopHTTP()
 		n.stopIPC()
 		n.stopInProc()
@@ -303,6 +325,7 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	}
 	// All API endpoints started successfully
 	n.rpcAPIs = apis
+	n.rpcACL = acl
 	return nil
 }
 
@@ -316,6 +339,7 @@ func (n *Node) startInProc(apis []rpc.API) error {
 		}
 		n.log.Debug("InProc registered", "service", api.Service, "namespace", api.Namespace)
 	}
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
 	n.inprocHandler = handler
 	return nil
 }
@@ -337,6 +361,7 @@ func (n *Node) startIPC(apis []rpc.API) error {
 	if err != nil {
 		return err
 	}
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
 	n.ipcListener = listener
 	n.ipcHandler = handler
 	n.log.Info("IPC endpoint opened", "url", n.ipcEndpoint)
@@ -358,15 +383,17 @@ func (n *Node) stopIPC() {
 }
 
 // startHTTP initializes and starts the HTTP RPC endpoint.
-func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string) error {
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, acl *rpc.AccessList) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts)
+	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, acl)
 	if err != nil {
 		return err
 	}
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
+	handler.SetLimits(n.config.RPCLimits())
 	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
@@ -391,15 +418,17 @@ func (n *Node) stopHTTP() {
 }
 
 // startWS initializes and starts the websocket RPC endpoint.
-func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
+func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool, acl *rpc.AccessList) error {
 	// Short circuit if the WS endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll, acl)
 	if err != nil {
 		return err
 	}
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
+	handler.SetLimits(n.config.RPCLimits())
 	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
 	// All listeners booted successfully
 	n.wsEndpoint = endpoint
@@ -423,6 +452,44 @@ func (n *Node) stopWS() {
 	}
 }
 
+// startAuth initializes and starts the JWT authenticated HTTP RPC endpoint.
+func (n *Node) startAuth(endpoint string, apis []rpc.API, vhosts []string) error {
+	// Short circuit if the authenticated endpoint isn't being exposed
+	if endpoint == "" {
+		return nil
+	}
+	secret, err := n.config.JWTSecretKey()
+	if err != nil {
+		return err
+	}
+	listener, handler, err := rpc.StartAuthHTTPEndpoint(endpoint, apis, vhosts, secret)
+	if err != nil {
+		return err
+	}
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
+	n.log.Info("Authenticated HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "vhosts", strings.Join(vhosts, ","))
+	// All listeners booted successfully
+	n.authEndpoint = endpoint
+	n.authListener = listener
+	n.authHandler = handler
+
+	return nil
+}
+
+// stopAuth terminates the authenticated HTTP RPC endpoint.
+func (n *Node) stopAuth() {
+	if n.authListener != nil {
+		n.authListener.Close()
+		n.authListener = nil
+
+		n.log.Info("Authenticated HTTP endpoint closed", "url", fmt.Sprintf("http://%s", n.authEndpoint))
+	}
+	if n.authHandler != nil {
+		n.authHandler.Stop()
+		n.authHandler = nil
+	}
+}
+
 // Stop terminates a running node along with all it's services. In the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
@@ -435,6 +502,7 @@ func (n *Node) Stop() error {
 	}
 
 	// Terminate the API, services and the p2p server.
+	n.stopAuth()
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
@@ -598,11 +666,52 @@ func (n *Node) EventMux() *event.TypeMux {
 // OpenDatabase opens an existing database with the given name (or creates one if no
 // previous can be found) from within the node's instance directory. If the node is
 // ephemeral, a memory database is returned.
-func (n *Node) OpenDatabase(name string, cache, handles int) (mandb.Database, error) {
+//
+// A read-only database must already exist and rejects all writes, allowing tools
+// to inspect a data directory without any risk of modifying it.
+func (n *Node) OpenDatabase(name string, cache, handles int, readonly bool) (mandb.Database, error) {
 	if n.config.DataDir == "" {
 		return mandb.NewMemDatabase(), nil
 	}
-	return mandb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
+	return mandb.Open(n.config.DBEngine, n.config.resolvePath(name), cache, handles, readonly)
+}
+
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves ancient chain data from the
+// database to immutable append-only files. If the node is an ephemeral one, a
+// memory database is returned. In read-only mode no blocks are moved.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string, threshold uint64, readonly bool) (mandb.Database, error) {
+	return openDatabaseWithFreezer(n.config, name, cache, handles, freezer, namespace, threshold, readonly)
+}
+
+// openDatabaseWithFreezer opens the named key-value database of a node with a
+// chain freezer attached. A relative freezer path is resolved within the data
+// directory, an empty one defaults to the "ancient" folder inside the database.
+func openDatabaseWithFreezer(config *Config, name string, cache, handles int, freezer, namespace string, threshold uint64, readonly bool) (mandb.Database, error) {
+	if config.DataDir == "" {
+		return mandb.NewMemDatabase(), nil
+	}
+	root := config.resolvePath(name)
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = config.resolvePath(freezer)
+	}
+	kvdb, err := mandb.Open(config.DBEngine, root, cache, handles, readonly)
+	if err != nil {
+		return nil, err
+	}
+	if ldb, ok := kvdb.(*mandb.LDBDatabase); ok && namespace != "" {
+		ldb.Meter(namespace)
+	}
+	db, err := rawdb.NewDatabaseWithFreezer(kvdb, freezer, namespace, threshold, readonly)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
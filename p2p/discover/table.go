@@ -238,6 +238,29 @@ func (tab *Table) setFallbackNodes(nodes []*Node) error {
 	return nil
 }
 
+// AddFallbackNodes extends the initial points of contact with nodes found after
+// the table was created, bonding with them in the background so that they enter
+// the table without waiting for the next refresh.
+func (tab *Table) AddFallbackNodes(nodes []*Node) error {
+	for _, n := range nodes {
+		if err := n.validateComplete(); err != nil {
+			return fmt.Errorf("bad bootstrap/fallback node %q (%v)", n, err)
+		}
+	}
+	added := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		cpy := *n
+		cpy.sha = crypto.Keccak256Hash(n.ID[:])
+		added = append(added, &cpy)
+	}
+	tab.mutex.Lock()
+	tab.nursery = append(tab.nursery, added...)
+	tab.mutex.Unlock()
+
+	go tab.bondall(added)
+	return nil
+}
+
 // isInitDone returns whether the table's initial seeding procedure has completed.
 func (tab *Table) isInitDone() bool {
 	select {
@@ -449,7 +472,9 @@ func (tab *Table) doRefresh(done chan struct{}) {
 
 func (tab *Table) loadSeedNodes(bond bool) {
 	seeds := tab.db.querySeeds(seedCount, seedMaxAge)
+	tab.mutex.Lock()
 	seeds = append(seeds, tab.nursery...)
+	tab.mutex.Unlock()
 	if bond {
 		seeds = tab.bondall(seeds)
 	}
@@ -0,0 +1,239 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/p2p/discover"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	// maxLinkDepth bounds how far links between trees are followed.
+	maxLinkDepth = 4
+
+	// maxTreeEntries and maxTreeDepth bound the size of a single tree, so that
+	// a hostile or broken tree can't make a sync go on forever.
+	maxTreeEntries = 10000
+	maxTreeDepth   = 8
+)
+
+// Resolver is a DNS resolver that can query TXT records.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// Config holds the settings of a DNS discovery client.
+type Config struct {
+	Timeout  time.Duration // timeout used for DNS lookups (default 5s)
+	Resolver Resolver      // the DNS resolver to use (defaults to system DNS)
+	Logger   log.Logger    // destination of client log messages
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Root()
+	}
+	return cfg
+}
+
+// Client discovers nodes by querying DNS servers.
+type Client struct {
+	cfg Config
+}
+
+// NewClient creates a client.
+func NewClient(cfg Config) *Client {
+	return &Client{cfg: cfg.withDefaults()}
+}
+
+// SyncTree downloads the entire node tree at the given URL. Links to other
+// trees are not followed.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	le, err := parseLink(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	return c.syncTree(le)
+}
+
+// SyncNodes resolves the nodes of all given trees, following the links between
+// trees. Unreachable trees are logged and skipped, so a failing list doesn't
+// prevent bootstrapping from the others.
+func (c *Client) SyncNodes(urls ...string) []*discover.Node {
+	var nodes []*discover.Node
+	c.SyncNodesFunc(func(synced []*discover.Node) {
+		nodes = append(nodes, synced...)
+	}, urls...)
+	return nodes
+}
+
+// SyncNodesFunc is like SyncNodes, but hands the nodes of each tree to fn as
+// soon as the tree is synced instead of returning them all at the end. Nodes
+// already seen in an earlier tree are not passed again.
+func (c *Client) SyncNodesFunc(fn func([]*discover.Node), urls ...string) {
+	var (
+		seen    = make(map[discover.NodeID]bool)
+		visited = make(map[string]bool)
+	)
+	var sync func(url string, depth int)
+	sync = func(url string, depth int) {
+		if visited[url] || depth > maxLinkDepth {
+			return
+		}
+		visited[url] = true
+
+		t, err := c.SyncTree(url)
+		if err != nil {
+			c.cfg.Logger.Warn("Failed to sync DNS node list", "url", url, "err", err)
+			return
+		}
+		var nodes []*discover.Node
+		for _, n := range t.Nodes() {
+			if !seen[n.ID] {
+				seen[n.ID] = true
+				nodes = append(nodes, n)
+			}
+		}
+		c.cfg.Logger.Debug("Synced DNS node list", "url", url, "seq", t.Seq(), "nodes", len(t.Nodes()))
+		if len(nodes) > 0 {
+			fn(nodes)
+		}
+		for _, link := range t.Links() {
+			sync(link, depth+1)
+		}
+	}
+	for _, url := range urls {
+		sync(url, 0)
+	}
+}
+
+func (c *Client) syncTree(le *linkEntry) (*Tree, error) {
+	root, err := c.resolveRoot(le)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{root: root, entries: make(map[string]entry)}
+	if err := c.syncAll(t, le.domain, root.eroot, false, 0); err != nil {
+		return nil, err
+	}
+	if err := c.syncAll(t, le.domain, root.lroot, true, 0); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// syncAll downloads the subtree below hash into t. The ENR subtree may only
+// contain node records and the link subtree only links.
+func (c *Client) syncAll(t *Tree, domain, hash string, links bool, depth int) error {
+	if _, ok := t.entries[hash]; ok {
+		return nil
+	}
+	if depth > maxTreeDepth {
+		return errTreeTooDeep
+	}
+	if len(t.entries) >= maxTreeEntries {
+		return errTreeTooLarge
+	}
+	e, err := c.resolveEntry(domain, hash)
+	if err != nil {
+		return err
+	}
+	switch e.(type) {
+	case *linkEntry:
+		if !links {
+			return errLinkInENRTree
+		}
+	case *enrEntry:
+		if links {
+			return errENRInLinkTree
+		}
+	}
+	t.entries[hash] = e
+	if branch, ok := e.(*branchEntry); ok {
+		for _, child := range branch.children {
+			if err := c.syncAll(t, domain, child, links, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRoot retrieves the root entry of a tree and verifies its signature.
+func (c *Client) resolveRoot(le *linkEntry) (*rootEntry, error) {
+	txts, err := c.lookupTXT(le.domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, rootPrefix) {
+			root, err := parseRoot(txt)
+			if err != nil {
+				return nil, err
+			}
+			if !root.verifySignature(le.pubkey) {
+				return nil, fmt.Errorf("invalid signature on root of %s", le.domain)
+			}
+			return root, nil
+		}
+	}
+	return nil, fmt.Errorf("no root found at %s", le.domain)
+}
+
+// resolveEntry retrieves an entry and checks that its content matches the hash
+// it is published under.
+func (c *Client) resolveEntry(domain, hash string) (entry, error) {
+	name := hash + "." + domain
+	txts, err := c.lookupTXT(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt)
+		if err == errUnknownEntry {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if subdomain(e) != hash {
+			return nil, fmt.Errorf("%s: hash mismatch", name)
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("no entry found at %s", name)
+}
+
+func (c *Client) lookupTXT(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	return c.cfg.Resolver.LookupTXT(ctx, name)
+}
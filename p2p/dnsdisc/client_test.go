@@ -0,0 +1,293 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/p2p/enr"
+)
+
+// mapResolver serves TXT records from memory.
+type mapResolver map[string]string
+
+func (mr mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if record, ok := mr[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, fmt.Errorf("not found: %s", name)
+}
+
+func (mr mapResolver) add(m map[string]string) {
+	for k, v := range m {
+		mr[k] = v
+	}
+}
+
+func testKey(seed byte) *ecdsa.PrivateKey {
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte{seed}))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func testNodes(t *testing.T, seed byte, n int) ([]*enr.Record, []*discover.Node) {
+	var (
+		records []*enr.Record
+		nodes   []*discover.Node
+	)
+	for i := 0; i < n; i++ {
+		key := testKey(seed + byte(i))
+		var r enr.Record
+		r.Set(enr.IP(net.IP{127, 0, 0, byte(i + 1)}))
+		r.Set(enr.TCP(30303 + i))
+		r.Set(enr.UDP(30303 + i))
+		if err := enr.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, &r)
+		nodes = append(nodes, discover.NewNode(discover.PubkeyID(&key.PublicKey), net.IP{127, 0, 0, byte(i + 1)}, uint16(30303+i), uint16(30303+i)))
+	}
+	return records, nodes
+}
+
+func sortNodes(nodes []*discover.Node) []*discover.Node {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].String() < nodes[j].String() })
+	return nodes
+}
+
+// Tests that a published tree is fully resolved, including trees that need
+// several levels of branches.
+func TestClientSyncTree(t *testing.T) {
+	records, nodes := testNodes(t, 1, 40)
+	tree, err := MakeTree(3, records, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(testKey(100), "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := make(mapResolver)
+	resolver.add(tree.ToTXT("nodes.example.org"))
+
+	synced, err := NewClient(Config{Resolver: resolver}).SyncTree(url)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if synced.Seq() != 3 {
+		t.Errorf("sequence mismatch: have %d, want 3", synced.Seq())
+	}
+	if have, want := sortNodes(synced.Nodes()), sortNodes(nodes); !reflect.DeepEqual(have, want) {
+		t.Errorf("node mismatch:\nhave %v\nwant %v", have, want)
+	}
+}
+
+// Tests that trees signed by an unexpected key or containing tampered entries
+// are rejected.
+func TestClientSyncTreeInvalid(t *testing.T) {
+	records, _ := testNodes(t, 1, 3)
+	tree, err := MakeTree(1, records, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Sign(testKey(100), "nodes.example.org"); err != nil {
+		t.Fatal(err)
+	}
+	resolver := make(mapResolver)
+	resolver.add(tree.ToTXT("nodes.example.org"))
+	client := NewClient(Config{Resolver: resolver})
+
+	// Wrong signing key in the URL
+	wrong := (&linkEntry{domain: "nodes.example.org", pubkey: &testKey(101).PublicKey}).String()
+	if _, err := client.SyncTree(wrong); err == nil {
+		t.Errorf("tree with wrong key accepted")
+	}
+	// Entry replaced by a different node record
+	other, _ := testNodes(t, 50, 1)
+	for name, txt := range resolver {
+		if strings.HasPrefix(txt, enrPrefix) {
+			resolver[name] = (&enrEntry{other[0]}).String()
+			break
+		}
+	}
+	right := (&linkEntry{domain: "nodes.example.org", pubkey: &testKey(100).PublicKey}).String()
+	if _, err := client.SyncTree(right); err == nil {
+		t.Errorf("tampered tree accepted")
+	}
+}
+
+// Tests that trees with too many or too deeply nested entries are rejected.
+func TestClientSyncTreeLimits(t *testing.T) {
+	resolver := make(mapResolver)
+	client := NewClient(Config{Resolver: resolver})
+
+	// Tree with more links than entries allowed
+	links := make([]string, maxTreeEntries+1)
+	for i := range links {
+		links[i] = (&linkEntry{domain: fmt.Sprintf("n%d.example.org", i), pubkey: &testKey(101).PublicKey}).String()
+	}
+	large, err := MakeTree(1, nil, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, _ := large.Sign(testKey(100), "large.example.org")
+	resolver.add(large.ToTXT("large.example.org"))
+	if _, err := client.SyncTree(url); err != errTreeTooLarge {
+		t.Errorf("large tree: have error %v, want %v", err, errTreeTooLarge)
+	}
+	// Tree with a chain of single child branches deeper than allowed
+	records, _ := testNodes(t, 1, 1)
+	deep := &Tree{entries: make(map[string]entry)}
+	var node entry = &enrEntry{records[0]}
+	for i := 0; i <= maxTreeDepth; i++ {
+		deep.entries[subdomain(node)] = node
+		node = &branchEntry{[]string{subdomain(node)}}
+	}
+	empty := &branchEntry{}
+	deep.entries[subdomain(node)] = node
+	deep.entries[subdomain(empty)] = empty
+	deep.root = &rootEntry{seq: 1, eroot: subdomain(node), lroot: subdomain(empty)}
+	url, _ = deep.Sign(testKey(100), "deep.example.org")
+	resolver.add(deep.ToTXT("deep.example.org"))
+	if _, err := client.SyncTree(url); err != errTreeTooDeep {
+		t.Errorf("deep tree: have error %v, want %v", err, errTreeTooDeep)
+	}
+}
+
+// Tests that links are only accepted in the link subtree of a tree and node
+// records only in the ENR subtree.
+func TestClientSyncTreeMisplacedEntries(t *testing.T) {
+	records, _ := testNodes(t, 1, 3)
+	link := (&linkEntry{domain: "b.example.org", pubkey: &testKey(101).PublicKey}).String()
+
+	tree, err := MakeTree(1, records, []string{link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.root.eroot, tree.root.lroot = tree.root.lroot, tree.root.eroot
+	url, _ := tree.Sign(testKey(100), "a.example.org")
+
+	resolver := make(mapResolver)
+	resolver.add(tree.ToTXT("a.example.org"))
+	if _, err := NewClient(Config{Resolver: resolver}).SyncTree(url); err != errLinkInENRTree {
+		t.Errorf("swapped subtrees: have error %v, want %v", err, errLinkInENRTree)
+	}
+	other, _ := testNodes(t, 50, 1)
+	record := &enrEntry{other[0]}
+	branch := &branchEntry{[]string{subdomain(record)}}
+	tree.entries[subdomain(record)] = record
+	tree.entries[subdomain(branch)] = branch
+	tree.root.eroot, tree.root.lroot = tree.root.lroot, subdomain(branch)
+	url, _ = tree.Sign(testKey(100), "a.example.org")
+	resolver.add(tree.ToTXT("a.example.org"))
+	if _, err := NewClient(Config{Resolver: resolver}).SyncTree(url); err != errENRInLinkTree {
+		t.Errorf("records in link subtree: have error %v, want %v", err, errENRInLinkTree)
+	}
+}
+
+// Tests that links between trees are followed and duplicate nodes merged.
+func TestClientSyncNodesLinks(t *testing.T) {
+	records, nodes := testNodes(t, 1, 6)
+	resolver := make(mapResolver)
+
+	leaf, _ := MakeTree(1, records[3:], nil)
+	leafURL, _ := leaf.Sign(testKey(101), "b.example.org")
+	resolver.add(leaf.ToTXT("b.example.org"))
+
+	root, _ := MakeTree(1, records[:4], []string{leafURL})
+	rootURL, _ := root.Sign(testKey(100), "a.example.org")
+	resolver.add(root.ToTXT("a.example.org"))
+
+	synced := NewClient(Config{Resolver: resolver}).SyncNodes(rootURL, "enrtree://invalid@c.example.org")
+	if have, want := sortNodes(synced), sortNodes(nodes); !reflect.DeepEqual(have, want) {
+		t.Errorf("node mismatch:\nhave %v\nwant %v", have, want)
+	}
+}
+
+// Tests that the nodes of each tree are handed out as soon as it is synced,
+// without repeating nodes shared with an earlier tree.
+func TestClientSyncNodesFunc(t *testing.T) {
+	records, nodes := testNodes(t, 1, 6)
+	resolver := make(mapResolver)
+
+	leaf, _ := MakeTree(1, records[3:], nil)
+	leafURL, _ := leaf.Sign(testKey(101), "b.example.org")
+	resolver.add(leaf.ToTXT("b.example.org"))
+
+	root, _ := MakeTree(1, records[:4], []string{leafURL})
+	rootURL, _ := root.Sign(testKey(100), "a.example.org")
+	resolver.add(root.ToTXT("a.example.org"))
+
+	var batches [][]*discover.Node
+	NewClient(Config{Resolver: resolver}).SyncNodesFunc(func(synced []*discover.Node) {
+		batches = append(batches, synced)
+	}, rootURL)
+
+	if len(batches) != 2 {
+		t.Fatalf("batch count mismatch: have %d, want 2", len(batches))
+	}
+	if have, want := sortNodes(batches[0]), sortNodes(nodes[:4]); !reflect.DeepEqual(have, want) {
+		t.Errorf("root tree node mismatch:\nhave %v\nwant %v", have, want)
+	}
+	if have, want := sortNodes(batches[1]), sortNodes(nodes[4:]); !reflect.DeepEqual(have, want) {
+		t.Errorf("linked tree node mismatch:\nhave %v\nwant %v", have, want)
+	}
+}
+
+func TestParseRoundtrip(t *testing.T) {
+	records, _ := testNodes(t, 1, 1)
+	link := (&linkEntry{domain: "nodes.example.org", pubkey: &testKey(100).PublicKey}).String()
+	for _, e := range []entry{
+		&branchEntry{},
+		&branchEntry{[]string{"2XS2367YHAXJFGLZHVAWLQD4ZY", "H4FHT4B454P6UXFD7JCYQ5PWDY"}},
+		&enrEntry{records[0]},
+		mustParseLink(t, link),
+	} {
+		parsed, err := parseEntry(e.String())
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", e.String(), err)
+		}
+		if parsed.String() != e.String() {
+			t.Errorf("roundtrip mismatch: have %q, want %q", parsed.String(), e.String())
+		}
+	}
+	if _, err := parseEntry("enrtree-branch:invalid!"); err == nil {
+		t.Errorf("invalid branch accepted")
+	}
+	if _, err := parseEntry("v=spf1 -all"); err != errUnknownEntry {
+		t.Errorf("wrong error for unknown entry: %v", err)
+	}
+}
+
+func mustParseLink(t *testing.T, url string) *linkEntry {
+	le, err := parseLink(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return le
+}
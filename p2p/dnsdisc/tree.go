@@ -0,0 +1,422 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package dnsdisc implements node discovery via DNS (EIP-1459). A DNS node list
+// is a merkle tree of TXT records whose signed root is published at a domain.
+// Leaves hold node records or links to the node lists of other domains.
+package dnsdisc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/p2p/enr"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+const (
+	rootPrefix   = "enrtree-root:v1"
+	linkPrefix   = "enrtree://"
+	branchPrefix = "enrtree-branch:"
+	enrPrefix    = "enr:"
+
+	// maxChildren is the maximum number of hashes in a branch entry. The limit
+	// keeps each entry within a single 255 byte TXT string.
+	maxChildren = 13
+
+	// hashAbbrev is the number of hash bytes used to name subdomains.
+	hashAbbrev = 16
+)
+
+var (
+	b32format = base32.StdEncoding.WithPadding(base32.NoPadding)
+	b64format = base64.RawURLEncoding
+)
+
+var (
+	errUnknownEntry = errors.New("unknown entry type")
+	errNoPubkey     = errors.New("missing public key")
+	errBadPubkey    = errors.New("invalid public key")
+	errInvalidENR   = errors.New("invalid node record")
+	errInvalidChild = errors.New("invalid child hash")
+	errInvalidSig   = errors.New("invalid base64 signature")
+	errSyntax       = errors.New("invalid syntax")
+
+	errLinkInENRTree = errors.New("link entry in ENR subtree")
+	errENRInLinkTree = errors.New("ENR entry in link subtree")
+	errTreeTooLarge  = errors.New("tree has too many entries")
+	errTreeTooDeep   = errors.New("tree is nested too deeply")
+)
+
+// Tree is a merkle tree of node records.
+type Tree struct {
+	root    *rootEntry
+	entries map[string]entry
+}
+
+// MakeTree creates a tree containing the given nodes and links. The tree has
+// to be signed before it can be published.
+func MakeTree(seq uint, nodes []*enr.Record, links []string) (*Tree, error) {
+	// Sort records by their encoding so the tree is independent of input order
+	records := make([]*enrEntry, len(nodes))
+	for i, r := range nodes {
+		records[i] = &enrEntry{r}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].encoded(), records[j].encoded()) < 0
+	})
+	linkEntries := make([]entry, len(links))
+	sortedLinks := append([]string{}, links...)
+	sort.Strings(sortedLinks)
+	for i, url := range sortedLinks {
+		le, err := parseLink(url)
+		if err != nil {
+			return nil, err
+		}
+		linkEntries[i] = le
+	}
+	enrEntries := make([]entry, len(records))
+	for i, e := range records {
+		enrEntries[i] = e
+	}
+	t := &Tree{entries: make(map[string]entry)}
+	eroot := t.build(enrEntries)
+	t.entries[subdomain(eroot)] = eroot
+	lroot := t.build(linkEntries)
+	t.entries[subdomain(lroot)] = lroot
+	t.root = &rootEntry{seq: seq, eroot: subdomain(eroot), lroot: subdomain(lroot)}
+	return t, nil
+}
+
+// build creates the subtree of the given leaves, registers all its entries and
+// returns the subtree root.
+func (t *Tree) build(leaves []entry) entry {
+	if len(leaves) == 0 {
+		return &branchEntry{}
+	}
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	if len(leaves) <= maxChildren {
+		hashes := make([]string, len(leaves))
+		for i, e := range leaves {
+			hashes[i] = subdomain(e)
+			t.entries[hashes[i]] = e
+		}
+		return &branchEntry{hashes}
+	}
+	var children []entry
+	for len(leaves) > 0 {
+		n := maxChildren
+		if len(leaves) < n {
+			n = len(leaves)
+		}
+		sub := t.build(leaves[:n])
+		leaves = leaves[n:]
+		children = append(children, sub)
+		t.entries[subdomain(sub)] = sub
+	}
+	return t.build(children)
+}
+
+// Sign signs the tree root with the given key and returns the URL of the tree
+// when published at domain.
+func (t *Tree) Sign(key *ecdsa.PrivateKey, domain string) (string, error) {
+	sig, err := crypto.Sign(t.root.sigHash(), key)
+	if err != nil {
+		return "", err
+	}
+	t.root.sig = sig
+	return (&linkEntry{domain: domain, pubkey: &key.PublicKey}).String(), nil
+}
+
+// Seq returns the sequence number of the tree.
+func (t *Tree) Seq() uint {
+	return t.root.seq
+}
+
+// Records returns all node records contained in the ENR subtree of the tree.
+func (t *Tree) Records() []*enr.Record {
+	var records []*enr.Record
+	for _, e := range t.leaves(t.root.eroot) {
+		if ee, ok := e.(*enrEntry); ok {
+			records = append(records, ee.node)
+		}
+	}
+	return records
+}
+
+// Nodes returns the dialable nodes contained in the tree. Records without an
+// endpoint are skipped.
+func (t *Tree) Nodes() []*discover.Node {
+	var nodes []*discover.Node
+	for _, r := range t.Records() {
+		if n, err := recordToNode(r); err == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// Links returns the URLs of the other trees linked from the link subtree of
+// the tree.
+func (t *Tree) Links() []string {
+	var links []string
+	for _, e := range t.leaves(t.root.lroot) {
+		if le, ok := e.(*linkEntry); ok {
+			links = append(links, le.String())
+		}
+	}
+	return links
+}
+
+// leaves returns the non-branch entries reachable from the entry at hash.
+func (t *Tree) leaves(hash string) []entry {
+	var (
+		leaves  []entry
+		visited = make(map[string]bool)
+	)
+	var walk func(hash string)
+	walk = func(hash string) {
+		if visited[hash] {
+			return
+		}
+		visited[hash] = true
+
+		switch e := t.entries[hash].(type) {
+		case nil:
+			// Entry not part of the tree
+		case *branchEntry:
+			for _, child := range e.children {
+				walk(child)
+			}
+		default:
+			leaves = append(leaves, e)
+		}
+	}
+	walk(hash)
+	return leaves
+}
+
+// ToTXT returns all DNS TXT records needed to publish the tree at domain.
+func (t *Tree) ToTXT(domain string) map[string]string {
+	records := map[string]string{domain: t.root.String()}
+	for hash, e := range t.entries {
+		sd := hash
+		if domain != "" {
+			sd = hash + "." + domain
+		}
+		records[sd] = e.String()
+	}
+	return records
+}
+
+// entry is a single TXT record of a tree.
+type entry interface {
+	fmt.Stringer
+}
+
+type (
+	rootEntry struct {
+		eroot string
+		lroot string
+		seq   uint
+		sig   []byte
+	}
+	branchEntry struct {
+		children []string
+	}
+	enrEntry struct {
+		node *enr.Record
+	}
+	linkEntry struct {
+		domain string
+		pubkey *ecdsa.PublicKey
+	}
+)
+
+func (e *rootEntry) sigHash() []byte {
+	return crypto.Keccak256([]byte(fmt.Sprintf("%s e=%s l=%s seq=%d", rootPrefix, e.eroot, e.lroot, e.seq)))
+}
+
+func (e *rootEntry) verifySignature(pubkey *ecdsa.PublicKey) bool {
+	if len(e.sig) != 65 {
+		return false
+	}
+	return crypto.VerifySignature(crypto.FromECDSAPub(pubkey), e.sigHash(), e.sig[:64])
+}
+
+func (e *rootEntry) String() string {
+	return fmt.Sprintf("%s e=%s l=%s seq=%d sig=%s", rootPrefix, e.eroot, e.lroot, e.seq, b64format.EncodeToString(e.sig))
+}
+
+func (e *branchEntry) String() string {
+	return branchPrefix + strings.Join(e.children, ",")
+}
+
+func (e *enrEntry) encoded() []byte {
+	enc, _ := rlp.EncodeToBytes(e.node)
+	return enc
+}
+
+func (e *enrEntry) String() string {
+	return enrPrefix + b64format.EncodeToString(e.encoded())
+}
+
+func (e *linkEntry) String() string {
+	return linkPrefix + b32format.EncodeToString(crypto.CompressPubkey(e.pubkey)) + "@" + e.domain
+}
+
+// subdomain returns the name of the subdomain an entry is published at.
+func subdomain(e entry) string {
+	h := crypto.Keccak256([]byte(e.String()))
+	return b32format.EncodeToString(h[:hashAbbrev])
+}
+
+// parseRoot parses the root entry of a tree.
+func parseRoot(e string) (*rootEntry, error) {
+	var (
+		eroot, lroot, sig string
+		seq               uint
+	)
+	if _, err := fmt.Sscanf(e, rootPrefix+" e=%s l=%s seq=%d sig=%s", &eroot, &lroot, &seq, &sig); err != nil {
+		return nil, entryError{"root", errSyntax}
+	}
+	if !isValidHash(eroot) || !isValidHash(lroot) {
+		return nil, entryError{"root", errInvalidChild}
+	}
+	sigb, err := b64format.DecodeString(sig)
+	if err != nil || len(sigb) != 65 {
+		return nil, entryError{"root", errInvalidSig}
+	}
+	return &rootEntry{eroot: eroot, lroot: lroot, seq: seq, sig: sigb}, nil
+}
+
+// parseEntry parses any non-root entry of a tree.
+func parseEntry(e string) (entry, error) {
+	switch {
+	case strings.HasPrefix(e, linkPrefix):
+		return parseLink(e)
+	case strings.HasPrefix(e, branchPrefix):
+		return parseBranch(e[len(branchPrefix):])
+	case strings.HasPrefix(e, enrPrefix):
+		return parseENR(e[len(enrPrefix):])
+	default:
+		return nil, errUnknownEntry
+	}
+}
+
+// parseLink parses a tree URL of the form enrtree://<key>@<domain>.
+func parseLink(e string) (*linkEntry, error) {
+	if !strings.HasPrefix(e, linkPrefix) {
+		return nil, fmt.Errorf("wrong/missing scheme 'enrtree' in URL")
+	}
+	e = e[len(linkPrefix):]
+	pos := strings.IndexByte(e, '@')
+	if pos == -1 {
+		return nil, entryError{"link", errNoPubkey}
+	}
+	keystring, domain := e[:pos], e[pos+1:]
+	keybytes, err := b32format.DecodeString(keystring)
+	if err != nil {
+		return nil, entryError{"link", errBadPubkey}
+	}
+	key, err := crypto.DecompressPubkey(keybytes)
+	if err != nil {
+		return nil, entryError{"link", errBadPubkey}
+	}
+	return &linkEntry{domain: domain, pubkey: key}, nil
+}
+
+func parseBranch(e string) (entry, error) {
+	e = strings.TrimSuffix(e, ",")
+	if e == "" {
+		return &branchEntry{}, nil // empty entry is OK
+	}
+	hashes := strings.Split(e, ",")
+	for _, c := range hashes {
+		if !isValidHash(c) {
+			return nil, entryError{"branch", errInvalidChild}
+		}
+	}
+	return &branchEntry{hashes}, nil
+}
+
+func parseENR(e string) (entry, error) {
+	enc, err := b64format.DecodeString(e)
+	if err != nil {
+		return nil, entryError{"enr", errInvalidENR}
+	}
+	var rec enr.Record
+	if err := rlp.DecodeBytes(enc, &rec); err != nil {
+		return nil, entryError{"enr", err}
+	}
+	return &enrEntry{&rec}, nil
+}
+
+func isValidHash(s string) bool {
+	dlen := b32format.DecodedLen(len(s))
+	if dlen < 12 || dlen > 32 {
+		return false
+	}
+	buf := make([]byte, 32)
+	_, err := b32format.Decode(buf, []byte(s))
+	return err == nil
+}
+
+// recordToNode converts a v4 node record into a dialable discovery node.
+func recordToNode(r *enr.Record) (*discover.Node, error) {
+	var (
+		pubkey enr.Secp256k1
+		ip     enr.IP
+		tcp    enr.TCP
+		udp    enr.UDP
+	)
+	if err := r.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&ip); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&tcp); err != nil {
+		return nil, err
+	}
+	// A missing UDP port means the node uses the same port for discovery
+	if err := r.Load(&udp); err != nil {
+		udp = enr.UDP(tcp)
+	}
+	id := discover.PubkeyID((*ecdsa.PublicKey)(&pubkey))
+	return discover.NewNode(id, net.IP(ip), uint16(udp), uint16(tcp)), nil
+}
+
+// entryError wraps errors that occur while parsing an entry.
+type entryError struct {
+	typ string
+	err error
+}
+
+func (err entryError) Error() string {
+	return fmt.Sprintf("invalid %s entry: %v", err.typ, err.err)
+}
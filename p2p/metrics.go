@@ -19,11 +19,22 @@
 package p2p
 
 import (
+	"fmt"
 	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/matrix/go-matrix/metrics"
 )
 
+const (
+	// ingressMeterName and egressMeterName are the prefixes of the per message
+	// type meters, followed by the protocol name, version and message code.
+	ingressMeterName = "p2p/ingress"
+	egressMeterName  = "p2p/egress"
+)
+
 var (
 	ingressConnectMeter = metrics.NewRegisteredMeter("p2p/InboundConnects", nil)
 	ingressTrafficMeter = metrics.NewRegisteredMeter("p2p/InboundTraffic", nil)
@@ -31,41 +42,130 @@ var (
 	egressTrafficMeter  = metrics.NewRegisteredMeter("p2p/OutboundTraffic", nil)
 )
 
-// meteredConn is a wrapper around a network TCP connection that meters both the
-// inbound and outbound network traffic.
+// meteredConn is a wrapper around a network connection that counts both the
+// inbound and outbound encrypted traffic, also bumping the global traffic
+// meters if the metrics system is enabled.
 type meteredConn struct {
-	*net.TCPConn // Network connection to wrap with metering
+	net.Conn // Network connection to wrap with metering
+
+	ingress uint64 // Number of bytes read from the connection (atomic)
+	egress  uint64 // Number of bytes written to the connection (atomic)
 }
 
 // newMeteredConn creates a new metered connection, also bumping the ingress or
-// egress connection meter. If the metrics system is disabled, this function
-// returns the original object.
+// egress connection meter if the metrics system is enabled.
 func newMeteredConn(conn net.Conn, ingress bool) net.Conn {
-	// Short circuit if metrics are disabled
-	if !metrics.Enabled {
-		return conn
-	}
-	// Otherwise bump the connection counters and wrap the connection
-	if ingress {
-		ingressConnectMeter.Mark(1)
-	} else {
-		egressConnectMeter.Mark(1)
+	if metrics.Enabled {
+		if ingress {
+			ingressConnectMeter.Mark(1)
+		} else {
+			egressConnectMeter.Mark(1)
+		}
 	}
-	return &meteredConn{conn.(*net.TCPConn)}
+	return &meteredConn{Conn: conn}
 }
 
 // Read delegates a network read to the underlying connection, bumping the ingress
 // traffic meter along the way.
 func (c *meteredConn) Read(b []byte) (n int, err error) {
-	n, err = c.TCPConn.Read(b)
-	ingressTrafficMeter.Mark(int64(n))
+	n, err = c.Conn.Read(b)
+	atomic.AddUint64(&c.ingress, uint64(n))
+	if metrics.Enabled {
+		ingressTrafficMeter.Mark(int64(n))
+	}
 	return
 }
 
 // Write delegates a network write to the underlying connection, bumping the
 // egress traffic meter along the way.
 func (c *meteredConn) Write(b []byte) (n int, err error) {
-	n, err = c.TCPConn.Write(b)
-	egressTrafficMeter.Mark(int64(n))
+	n, err = c.Conn.Write(b)
+	atomic.AddUint64(&c.egress, uint64(n))
+	if metrics.Enabled {
+		egressTrafficMeter.Mark(int64(n))
+	}
 	return
 }
+
+// connTraffic returns the number of encrypted bytes received and sent over a
+// connection, or zeroes if the connection is not metered.
+func connTraffic(conn net.Conn) (ingress, egress uint64) {
+	if c, ok := conn.(*meteredConn); ok {
+		return atomic.LoadUint64(&c.ingress), atomic.LoadUint64(&c.egress)
+	}
+	return 0, 0
+}
+
+// MsgTraffic is the bandwidth used by a single message type of a sub-protocol.
+type MsgTraffic struct {
+	Protocol   string `json:"protocol"`   // Name and version of the sub-protocol
+	Code       uint64 `json:"code"`       // Message code within the sub-protocol
+	InPackets  uint64 `json:"inPackets"`  // Number of messages received
+	InBytes    uint64 `json:"inBytes"`    // Payload bytes received
+	OutPackets uint64 `json:"outPackets"` // Number of messages sent
+	OutBytes   uint64 `json:"outBytes"`   // Payload bytes sent
+}
+
+// msgKey identifies a message type of a sub-protocol.
+type msgKey struct {
+	proto string
+	code  uint64
+}
+
+// peerTraffic accounts the bandwidth of a peer per message type.
+type peerTraffic struct {
+	msgs map[msgKey]*MsgTraffic
+	lock sync.Mutex
+}
+
+func newPeerTraffic() *peerTraffic {
+	return &peerTraffic{msgs: make(map[msgKey]*MsgTraffic)}
+}
+
+// mark accounts a message of the given protocol and code, also bumping the
+// per message type meters if the metrics system is enabled.
+func (t *peerTraffic) mark(proto *Protocol, code uint64, size uint32, ingress bool) {
+	name := fmt.Sprintf("%s/%d", proto.Name, proto.Version)
+
+	t.lock.Lock()
+	stats := t.msgs[msgKey{name, code}]
+	if stats == nil {
+		stats = &MsgTraffic{Protocol: name, Code: code}
+		t.msgs[msgKey{name, code}] = stats
+	}
+	prefix := egressMeterName
+	if ingress {
+		stats.InPackets++
+		stats.InBytes += uint64(size)
+		prefix = ingressMeterName
+	} else {
+		stats.OutPackets++
+		stats.OutBytes += uint64(size)
+	}
+	t.lock.Unlock()
+
+	if metrics.Enabled {
+		meter := fmt.Sprintf("%s/%s/%d", prefix, name, code)
+		metrics.GetOrRegisterMeter(meter+"/packets", nil).Mark(1)
+		metrics.GetOrRegisterMeter(meter+"/traffic", nil).Mark(int64(size))
+	}
+}
+
+// stats returns a snapshot of the per message type traffic, ordered by
+// protocol and message code.
+func (t *peerTraffic) stats() []MsgTraffic {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := make([]MsgTraffic, 0, len(t.msgs))
+	for _, s := range t.msgs {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Protocol != stats[j].Protocol {
+			return stats[i].Protocol < stats[j].Protocol
+		}
+		return stats[i].Code < stats[j].Code
+	})
+	return stats
+}
@@ -93,11 +93,24 @@ func Parse(spec string) (Interface, error) {
 const (
 	mapTimeout        = 20 * time.Minute
 	mapUpdateInterval = 15 * time.Minute
+
+	// mapRetryInterval is the delay before a failed mapping is retried. Routers
+	// dropping their mappings (e.g. after a reboot) are thus recovered from
+	// quickly instead of at the next regular refresh.
+	mapRetryInterval = time.Minute
 )
 
+// rediscoverInterval is the minimum time between two auto-discovery runs of a
+// mechanism whose router got lost.
+var rediscoverInterval = 5 * time.Minute
+
 // Map adds a port mapping on m and keeps it alive until c is closed.
 // This function is typically invoked in its own goroutine.
 func Map(m Interface, c chan struct{}, protocol string, extport, intport int, name string) {
+	// Static external addresses have nothing to map
+	if _, ok := m.(extIP); ok {
+		return
+	}
 	log := log.New("proto", protocol, "extport", extport, "intport", intport, "interface", m)
 	refresh := time.NewTimer(mapUpdateInterval)
 	defer func() {
@@ -105,11 +118,27 @@ func Map(m Interface, c chan struct{}, protocol string, extport, intport int, na
 		log.Debug("Deleting port mapping")
 		m.DeleteMapping(protocol, extport, intport)
 	}()
-	if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
-		log.Debug("Couldn't add port mapping", "err", err)
-	} else {
-		log.Info("Mapped network port")
+	mapped := false
+	update := func() {
+		if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
+			if mapped {
+				log.Warn("Lost port mapping", "err", err)
+			} else {
+				log.Debug("Couldn't add port mapping", "err", err)
+			}
+			mapped = false
+			refresh.Reset(mapRetryInterval)
+			return
+		}
+		if !mapped {
+			log.Info("Mapped network port")
+		} else {
+			log.Trace("Refreshed port mapping")
+		}
+		mapped = true
+		refresh.Reset(mapUpdateInterval)
 	}
+	update()
 	for {
 		select {
 		case _, ok := <-c:
@@ -118,10 +147,7 @@ func Map(m Interface, c chan struct{}, protocol string, extport, intport int, na
 			}
 		case <-refresh.C:
 			log.Trace("Refreshing port mapping")
-			if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
-				log.Debug("Couldn't add port mapping", "err", err)
-			}
-			refresh.Reset(mapUpdateInterval)
+			update()
 		}
 	}
 }
@@ -136,6 +162,15 @@ func ExtIP(ip net.IP) Interface {
 	return extIP(ip)
 }
 
+// StaticIP returns the external address of a mechanism created by ExtIP,
+// or nil if the address has to be requested from a router.
+func StaticIP(m Interface) net.IP {
+	if ip, ok := m.(extIP); ok {
+		return net.IP(ip)
+	}
+	return nil
+}
+
 type extIP net.IP
 
 func (n extIP) ExternalIP() (net.IP, error) { return net.IP(n), nil }
@@ -186,39 +221,49 @@ func PMP(gateway net.IP) Interface {
 //
 // This type is useful because discovery can take a while but we
 // want return an Interface value from UPnP, PMP and Auto immediately.
+// If no router is found or the found one stops accepting mappings,
+// discovery is rerun after rediscoverInterval.
 type autodisc struct {
 	what string // type of interface being autodiscovered
-	once sync.Once
 	doit func() Interface
 
+	disc  sync.Mutex // serializes discovery runs
+	tried time.Time  // time of the last discovery run
+
 	mu    sync.Mutex
 	found Interface
 }
 
 func startautodisc(what string, doit func() Interface) Interface {
-	// TODO: monitor network configuration and rerun doit when it changes.
 	return &autodisc{what: what, doit: doit}
 }
 
 func (n *autodisc) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) error {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
+		return err
+	}
+	if err := found.AddMapping(protocol, extport, intport, name, lifetime); err != nil {
+		n.lost()
 		return err
 	}
-	return n.found.AddMapping(protocol, extport, intport, name, lifetime)
+	return nil
 }
 
 func (n *autodisc) DeleteMapping(protocol string, extport, intport int) error {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
 		return err
 	}
-	return n.found.DeleteMapping(protocol, extport, intport)
+	return found.DeleteMapping(protocol, extport, intport)
 }
 
 func (n *autodisc) ExternalIP() (net.IP, error) {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
 		return nil, err
 	}
-	return n.found.ExternalIP()
+	return found.ExternalIP()
 }
 
 func (n *autodisc) String() string {
@@ -231,15 +276,39 @@ func (n *autodisc) String() string {
 	}
 }
 
-// wait blocks until auto-discovery has been performed.
-func (n *autodisc) wait() error {
-	n.once.Do(func() {
+// wait blocks until auto-discovery has been performed and returns the
+// discovered mechanism. Discovery is rerun if no router was found previously
+// and rediscoverInterval has passed since.
+func (n *autodisc) wait() (Interface, error) {
+	n.disc.Lock()
+	defer n.disc.Unlock()
+
+	n.mu.Lock()
+	found := n.found
+	n.mu.Unlock()
+
+	if found == nil && (n.tried.IsZero() || time.Since(n.tried) >= rediscoverInterval) {
+		n.tried = time.Now()
+		found = n.doit()
+
 		n.mu.Lock()
-		n.found = n.doit()
+		n.found = found
 		n.mu.Unlock()
-	})
-	if n.found == nil {
-		return fmt.Errorf("no %s router discovered", n.what)
 	}
-	return nil
+	if found == nil {
+		return nil, fmt.Errorf("no %s router discovered", n.what)
+	}
+	return found, nil
+}
+
+// lost drops a discovered mechanism that failed to create a mapping, so the
+// router is searched for again on the next call.
+func (n *autodisc) lost() {
+	n.disc.Lock()
+	defer n.disc.Unlock()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.found, n.tried = nil, time.Time{}
 }
@@ -17,6 +17,7 @@
 package nat
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -61,3 +62,55 @@ func TestAutoDiscRace(t *testing.T) {
 		}
 	}
 }
+
+// failingMapper is a port mapper whose router rejects all mappings.
+type failingMapper struct{ extIP }
+
+func (failingMapper) AddMapping(string, int, int, string, time.Duration) error {
+	return errors.New("mapping rejected")
+}
+
+// This test checks that autodisc searches for the router again if none was
+// found or the found one stopped accepting mappings.
+func TestAutoDiscRediscovery(t *testing.T) {
+	defer func(old time.Duration) { rediscoverInterval = old }(rediscoverInterval)
+	rediscoverInterval = 50 * time.Millisecond
+
+	var (
+		runs  int
+		found Interface
+	)
+	ad := startautodisc("thing", func() Interface {
+		runs++
+		return found
+	})
+	// No router available, discovery must not be rerun before the interval
+	if _, err := ad.ExternalIP(); err == nil {
+		t.Fatal("expected error without router")
+	}
+	ad.ExternalIP()
+	if runs != 1 {
+		t.Fatalf("discovery runs mismatch: have %d, want 1", runs)
+	}
+	// Router appeared, it must be found after the interval
+	found = failingMapper{extIP{33, 44, 55, 66}}
+	time.Sleep(2 * rediscoverInterval)
+	if _, err := ad.ExternalIP(); err != nil {
+		t.Fatalf("router not rediscovered: %v", err)
+	}
+	if runs != 2 {
+		t.Fatalf("discovery runs mismatch: have %d, want 2", runs)
+	}
+	// A rejected mapping must trigger an immediate rediscovery
+	if err := ad.AddMapping("tcp", 30303, 30303, "test", time.Minute); err == nil {
+		t.Fatal("expected mapping error")
+	}
+	found = extIP{11, 22, 33, 44}
+	ip, err := ad.ExternalIP()
+	if err != nil || !ip.Equal(net.IP{11, 22, 33, 44}) {
+		t.Fatalf("external IP mismatch: have %v (%v), want 11.22.33.44", ip, err)
+	}
+	if runs != 3 {
+		t.Fatalf("discovery runs mismatch: have %d, want 3", runs)
+	}
+}
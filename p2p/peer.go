@@ -109,6 +109,8 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	traffic *peerTraffic // bandwidth accounting per message type
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -162,7 +164,7 @@ func (p *Peer) String() string {
 
 // Inbound returns true if the peer is an inbound connection
 func (p *Peer) Inbound() bool {
-	return p.rw.flags&inboundConn != 0
+	return p.rw.is(inboundConn)
 }
 
 // MsgReadWriter return ReadWriter between peers.
@@ -179,7 +181,8 @@ func newPeer(conn *conn, protocols []Protocol) *Peer {
 		disc:     make(chan DiscReason),
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
-		log:      log.New("id", conn.id, "conn", conn.flags),
+		log:      log.New("id", conn.id, "conn", conn.connFlags()),
+		traffic:  newPeerTraffic(),
 	}
 	return p
 }
@@ -292,6 +295,7 @@ func (p *Peer) handle(msg Msg) error {
 		if err != nil {
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		p.traffic.mark(&proto.Protocol, msg.Code-proto.offset, msg.Size, true)
 		select {
 		case proto.in <- msg:
 			return nil
@@ -346,6 +350,7 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = p.traffic
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name)
@@ -385,16 +390,22 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *peerTraffic // bandwidth accounting of the owning peer
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	if msg.Code >= rw.Length {
 		return newPeerError(errInvalidMsgCode, "not handled")
 	}
+	code := msg.Code
 	msg.Code += rw.offset
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil && rw.traffic != nil {
+			rw.traffic.mark(&rw.Protocol, code, msg.Size, false)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -430,7 +441,26 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
-	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+	Negotiated []NegotiatedProtocol   `json:"negotiated"` // Sub-protocols agreed on during the handshake
+	Traffic    PeerTraffic            `json:"traffic"`    // Bandwidth used by the peer
+	Protocols  map[string]interface{} `json:"protocols"`  // Sub-protocol specific metadata fields
+}
+
+// PeerTraffic is the bandwidth used by a peer, both in total over the encrypted
+// connection and per sub-protocol message type.
+type PeerTraffic struct {
+	Ingress  uint64       `json:"ingress"`  // Encrypted bytes received from the peer
+	Egress   uint64       `json:"egress"`   // Encrypted bytes sent to the peer
+	Messages []MsgTraffic `json:"messages"` // Payload traffic per message type
+}
+
+// NegotiatedProtocol describes a sub-protocol matched during the protocol
+// handshake, along with the message code range assigned to it.
+type NegotiatedProtocol struct {
+	Name    string `json:"name"`    // Name of the sub-protocol
+	Version uint   `json:"version"` // Version of the sub-protocol both sides agreed on
+	Offset  uint64 `json:"offset"`  // First message code reserved for the sub-protocol
+	Length  uint64 `json:"length"`  // Number of message codes used by the sub-protocol
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -453,6 +483,22 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
 
+	// Gather the bandwidth used by the peer
+	info.Traffic.Ingress, info.Traffic.Egress = connTraffic(p.rw.fd)
+	info.Traffic.Messages = p.traffic.stats()
+
+	// Gather the negotiated protocols in message code order
+	for _, proto := range p.running {
+		info.Negotiated = append(info.Negotiated, NegotiatedProtocol{
+			Name:    proto.Name,
+			Version: proto.Version,
+			Offset:  proto.offset,
+			Length:  proto.Length,
+		})
+	}
+	sort.Slice(info.Negotiated, func(i, j int) bool {
+		return info.Negotiated[i].Offset < info.Negotiated[j].Offset
+	})
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
 		protoInfo := interface{}("unknown")
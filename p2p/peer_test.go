@@ -98,6 +98,46 @@ func TestPeerProtoReadMsg(t *testing.T) {
 	}
 }
 
+func TestPeerTrafficAccounting(t *testing.T) {
+	proto := Protocol{
+		Name:    "a",
+		Version: 2,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := ExpectMsg(rw, 2, []uint{2}); err != nil {
+				t.Error(err)
+			}
+			return SendItems(rw, 4, "foo")
+		},
+	}
+	closer, rw, peer, errc := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+2, []uint{1})
+	Send(rw, baseProtocolLength+2, []uint{2})
+	if err := ExpectMsg(rw, baseProtocolLength+4, []string{"foo"}); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-errc:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("protocol did not return")
+	}
+	stats := peer.Info().Traffic.Messages
+	if len(stats) != 2 {
+		t.Fatalf("message type count mismatch: have %d, want 2", len(stats))
+	}
+	if s := stats[0]; s.Protocol != "a/2" || s.Code != 2 || s.InPackets != 2 || s.InBytes != 4 || s.OutPackets != 0 {
+		t.Errorf("ingress stats mismatch: %+v", s)
+	}
+	if s := stats[1]; s.Protocol != "a/2" || s.Code != 4 || s.OutPackets != 1 || s.OutBytes != 5 || s.InPackets != 0 {
+		t.Errorf("egress stats mismatch: %+v", s)
+	}
+}
+
 func TestPeerProtoEncodeMsg(t *testing.T) {
 	proto := Protocol{
 		Name:   "a",
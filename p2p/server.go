@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/matrix/go-matrix/common"
@@ -31,6 +32,7 @@ import (
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/p2p/discover"
 	"github.com/matrix/go-matrix/p2p/discv5"
+	"github.com/matrix/go-matrix/p2p/dnsdisc"
 	"github.com/matrix/go-matrix/p2p/nat"
 	"github.com/matrix/go-matrix/p2p/netutil"
 )
@@ -93,6 +95,11 @@ type Config struct {
 	// protocol.
 	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
 
+	// DNSDiscovery is a list of enrtree:// URLs of DNS node lists (EIP-1459).
+	// The nodes in the lists are resolved on startup and used as additional
+	// bootstrap nodes of both discovery protocols.
+	DNSDiscovery []string `toml:",omitempty"`
+
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
 	StaticNodes []*discover.Node
@@ -169,6 +176,8 @@ type Server struct {
 	quit          chan struct{}
 	addstatic     chan *discover.Node
 	removestatic  chan *discover.Node
+	addtrusted    chan *discover.Node
+	removetrusted chan *discover.Node
 	posthandshake chan *conn
 	addpeer       chan *conn
 	delpeer       chan peerDrop
@@ -187,7 +196,7 @@ type peerDrop struct {
 	requested bool // true if signaled by the peer
 }
 
-type connFlag int
+type connFlag int32
 
 const (
 	dynDialedConn connFlag = 1 << iota
@@ -223,7 +232,7 @@ type transport interface {
 }
 
 func (c *conn) String() string {
-	s := c.flags.String()
+	s := c.connFlags().String()
 	if (c.id != discover.NodeID{}) {
 		s += " " + c.id.String()
 	}
@@ -252,7 +261,30 @@ func (f connFlag) String() string {
 }
 
 func (c *conn) is(f connFlag) bool {
-	return c.flags&f != 0
+	flags := connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+	return flags&f != 0
+}
+
+// connFlags returns a snapshot of the connection flags.
+func (c *conn) connFlags() connFlag {
+	return connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+}
+
+// set sets or clears the given flag. The flags of a connection change after
+// the handshake when a peer is marked or unmarked as trusted at runtime.
+func (c *conn) set(f connFlag, val bool) {
+	for {
+		oldFlags := connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+		flags := oldFlags
+		if val {
+			flags |= f
+		} else {
+			flags &= ^f
+		}
+		if atomic.CompareAndSwapInt32((*int32)(&c.flags), int32(oldFlags), int32(flags)) {
+			return
+		}
+	}
 }
 
 // Peers returns all connected peers.
@@ -302,6 +334,23 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// AddTrustedPeer adds the given node to a reserved whitelist which allows the
+// node to always connect, even if the slots are full.
+func (srv *Server) AddTrustedPeer(node *discover.Node) {
+	select {
+	case srv.addtrusted <- node:
+	case <-srv.quit:
+	}
+}
+
+// RemoveTrustedPeer removes the given node from the trusted peer set.
+func (srv *Server) RemoveTrustedPeer(node *discover.Node) {
+	select {
+	case srv.removetrusted <- node:
+	case <-srv.quit:
+	}
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -326,11 +375,16 @@ func (srv *Server) makeSelf(listener net.Listener, ntab discoverTable) *discover
 		if listener == nil {
 			return &discover.Node{IP: net.ParseIP("0.0.0.0"), ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
 		}
-		// Otherwise inject the listener address too
+		// Otherwise inject the listener address too, honouring a configured
+		// static external IP
 		addr := listener.Addr().(*net.TCPAddr)
+		ip := addr.IP
+		if ext := nat.StaticIP(srv.NAT); ext != nil {
+			ip = ext
+		}
 		return &discover.Node{
 			ID:  discover.PubkeyID(&srv.PrivateKey.PublicKey),
-			IP:  addr.IP,
+			IP:  ip,
 			TCP: uint16(addr.Port),
 		}
 	}
@@ -413,6 +467,8 @@ func (srv *Server) Start() (err error) {
 	srv.posthandshake = make(chan *conn)
 	srv.addstatic = make(chan *discover.Node)
 	srv.removestatic = make(chan *discover.Node)
+	srv.addtrusted = make(chan *discover.Node)
+	srv.removetrusted = make(chan *discover.Node)
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
 
@@ -440,30 +496,35 @@ func (srv *Server) Start() (err error) {
 			// TODO: react to external IP changes over time.
 			if ext, err := srv.NAT.ExternalIP(); err == nil {
 				realaddr = &net.UDPAddr{IP: ext, Port: realaddr.Port}
+			} else {
+				srv.log.Warn("Failed to resolve external IP, announcing local address", "nat", srv.NAT, "err", err)
 			}
 		}
 	}
 
+	bootnodes, bootnodesV5 := srv.BootstrapNodes, srv.BootstrapNodesV5
+
 	if !srv.NoDiscovery && srv.DiscoveryV5 {
 		unhandled = make(chan discover.ReadPacket, 100)
 		sconn = &sharedUDPConn{conn, unhandled}
 	}
 
 	// node table
+	var ntabV4 *discover.Table
 	if !srv.NoDiscovery {
 		cfg := discover.Config{
 			PrivateKey:   srv.PrivateKey,
 			AnnounceAddr: realaddr,
 			NodeDBPath:   srv.NodeDatabase,
 			NetRestrict:  srv.NetRestrict,
-			Bootnodes:    srv.BootstrapNodes,
+			Bootnodes:    bootnodes,
 			Unhandled:    unhandled,
 		}
 		ntab, err := discover.ListenUDP(conn, cfg)
 		if err != nil {
 			return err
 		}
-		srv.ntab = ntab
+		srv.ntab, ntabV4 = ntab, ntab
 	}
 
 	if srv.DiscoveryV5 {
@@ -479,14 +540,14 @@ func (srv *Server) Start() (err error) {
 		if err != nil {
 			return err
 		}
-		if err := ntab.SetFallbackNodes(srv.BootstrapNodesV5); err != nil {
+		if err := ntab.SetFallbackNodes(bootnodesV5); err != nil {
 			return err
 		}
 		srv.DiscV5 = ntab
 	}
 
 	dynPeers := srv.maxDialedConns()
-	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer := newDialState(srv.StaticNodes, bootnodes, srv.ntab, dynPeers, srv.NetRestrict)
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -510,6 +571,10 @@ func (srv *Server) Start() (err error) {
 	//add by zw
 	go srv.run(dialer)
 
+	if len(srv.DNSDiscovery) > 0 && (ntabV4 != nil || srv.DiscV5 != nil) {
+		go srv.dnsBootstrap(ntabV4, srv.DiscV5)
+	}
+
 	Custsrv = srv
 	srv.running = true
 
@@ -520,6 +585,38 @@ func (srv *Server) Start() (err error) {
 	return nil
 }
 
+// dnsBootstrap resolves the configured DNS node lists in the background, adding
+// the nodes of each list to the discovery tables as soon as it is synced, so a
+// slow or unreachable DNS server doesn't hold up the startup.
+func (srv *Server) dnsBootstrap(ntab *discover.Table, ntabV5 *discv5.Network) {
+	var (
+		total       int
+		bootnodesV5 = append([]*discv5.Node{}, srv.BootstrapNodesV5...)
+	)
+	dnsdisc.NewClient(dnsdisc.Config{Logger: srv.log}).SyncNodesFunc(func(nodes []*discover.Node) {
+		select {
+		case <-srv.quit:
+			return
+		default:
+		}
+		total += len(nodes)
+		if ntab != nil {
+			if err := ntab.AddFallbackNodes(nodes); err != nil {
+				srv.log.Warn("Failed to add DNS bootstrap nodes", "err", err)
+			}
+		}
+		if ntabV5 != nil {
+			for _, n := range nodes {
+				bootnodesV5 = append(bootnodesV5, discv5.NewNode(discv5.NodeID(n.ID), n.IP, n.UDP, n.TCP))
+			}
+			if err := ntabV5.SetFallbackNodes(bootnodesV5); err != nil {
+				srv.log.Warn("Failed to add DNS bootstrap nodes", "err", err)
+			}
+		}
+	}, srv.DNSDiscovery...)
+	srv.log.Info("Resolved DNS node lists", "lists", len(srv.DNSDiscovery), "nodes", total)
+}
+
 func (srv *Server) startListening() error {
 	// Launch the TCP listener.
 	listener, err := net.Listen("tcp", srv.ListenAddr)
@@ -560,8 +657,7 @@ func (srv *Server) run(dialstate dialer) {
 		queuedTasks  []task // tasks that can't run yet
 	)
 	// Put trusted nodes into a map to speed up checks.
-	// Trusted peers are loaded on startup and cannot be
-	// modified while the server is running.
+	// Trusted peers are loaded on startup or added via AddTrustedPeer RPC.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID] = true
 	}
@@ -619,6 +715,24 @@ running:
 			if p, ok := peers[n.ID]; ok {
 				p.Disconnect(DiscRequested)
 			}
+		case n := <-srv.addtrusted:
+			// This channel is used by AddTrustedPeer to add an enode
+			// to the trusted node set.
+			srv.log.Debug("Adding trusted node", "node", n)
+			trusted[n.ID] = true
+			// Mark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, true)
+			}
+		case n := <-srv.removetrusted:
+			// This channel is used by RemoveTrustedPeer to remove an enode
+			// from the trusted node set.
+			srv.log.Debug("Removing trusted node", "node", n)
+			delete(trusted, n.ID)
+			// Unmark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, false)
+			}
 		case op := <-srv.peerOp:
 			// This channel is used by Peers and PeerCount.
 			op(peers)
@@ -635,7 +749,7 @@ running:
 			// the remote identity is known (but hasn't been verified yet).
 			if trusted[c.id] {
 				// Ensure that the trusted flag is set before checking against MaxPeers.
-				c.flags |= trustedConn
+				c.set(trustedConn, true)
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
 			select {
@@ -834,10 +948,10 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *discover.Node) e
 	// Run the encryption handshake.
 	var err error
 	if c.id, err = c.doEncHandshake(srv.PrivateKey, dialDest); err != nil {
-		srv.log.Trace("Failed RLPx handshake", "addr", c.fd.RemoteAddr(), "conn", c.flags, "err", err)
+		srv.log.Trace("Failed RLPx handshake", "addr", c.fd.RemoteAddr(), "conn", c.connFlags(), "err", err)
 		return err
 	}
-	clog := srv.log.New("id", c.id, "addr", c.fd.RemoteAddr(), "conn", c.flags)
+	clog := srv.log.New("id", c.id, "addr", c.fd.RemoteAddr(), "conn", c.connFlags())
 	// For dialed connections, check that the remote public key matches.
 	if dialDest != nil && c.id != dialDest.ID {
 		clog.Trace("Dialed identity mismatch", "want", c, dialDest.ID)
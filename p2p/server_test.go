@@ -29,6 +29,7 @@ import (
 	"github.com/matrix/go-matrix/crypto/sha3"
 	"github.com/matrix/go-matrix/log"
 	"github.com/matrix/go-matrix/p2p/discover"
+	"github.com/matrix/go-matrix/p2p/nat"
 )
 
 func init() {
@@ -319,6 +320,31 @@ func (t *testTask) Do(srv *Server) {
 	t.called = true
 }
 
+// This test checks that a static external IP is announced as the node
+// address even if discovery is disabled.
+func TestServerSelfExtIP(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			NAT:         nat.ExtIP(net.IP{33, 44, 55, 66}),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	self := srv.Self()
+	if !self.IP.Equal(net.IP{33, 44, 55, 66}) {
+		t.Errorf("announced IP mismatch: have %v, want 33.44.55.66", self.IP)
+	}
+	if want := srv.listener.Addr().(*net.TCPAddr).Port; int(self.TCP) != want {
+		t.Errorf("announced TCP port mismatch: have %d, want %d", self.TCP, want)
+	}
+}
+
 // This test checks that connections are disconnected
 // just after the encryption handshake when the server is
 // at capacity. Trusted connections should still be accepted.
@@ -364,6 +390,23 @@ func TestServerAtCap(t *testing.T) {
 		t.Error("Server did not set trusted flag")
 	}
 
+	// Remove from trusted set and try again
+	srv.RemoveTrustedPeer(&discover.Node{ID: trustedID})
+	c = newconn(trustedID)
+	if err := srv.checkpoint(c, srv.posthandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for insert:", err)
+	}
+
+	// Add anotherID to trusted set and try again
+	anotherID := randomID()
+	srv.AddTrustedPeer(&discover.Node{ID: anotherID})
+	c = newconn(anotherID)
+	if err := srv.checkpoint(c, srv.posthandshake); err != nil {
+		t.Error("unexpected error for trusted conn @posthandshake:", err)
+	}
+	if !c.is(trustedConn) {
+		t.Error("Server did not set trusted flag")
+	}
 }
 
 func TestServerSetupConn(t *testing.T) {
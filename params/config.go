@@ -19,6 +19,7 @@ package params
 import (
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/matrix/go-matrix/common"
 )
@@ -28,6 +29,47 @@ var (
 	TestnetGenesisHash = common.HexToHash("0x41941023680923e0fe4d74a34bdac8141f2540e3ae90623718e47d66d1ca4a2d") // Testnet genesis hash to enforce below configs on
 )
 
+// TrustedCheckpoint represents a set of post-processed trie roots (CHT and BloomTrie)
+// associated with the appropriate section index and head hash. It is used to start
+// light syncing from this checkpoint and avoid downloading the entire header chain
+// while still being able to securely access old headers/logs.
+type TrustedCheckpoint struct {
+	SectionIndex uint64      `json:"sectionIndex"`
+	SectionHead  common.Hash `json:"sectionHead"`
+	CHTRoot      common.Hash `json:"chtRoot"`
+	BloomRoot    common.Hash `json:"bloomRoot"`
+}
+
+// Empty returns whether the checkpoint lacks any of its roots.
+func (c *TrustedCheckpoint) Empty() bool {
+	return c.SectionHead == (common.Hash{}) || c.CHTRoot == (common.Hash{}) || c.BloomRoot == (common.Hash{})
+}
+
+var (
+	// MainnetTrustedCheckpoint contains the light client trusted checkpoint for the main network.
+	MainnetTrustedCheckpoint = &TrustedCheckpoint{
+		SectionIndex: 170,
+		SectionHead:  common.HexToHash("3bb2c28bcce463d57968f14f56cdb3fbf35349ab7a701f44c1afb57349c9a356"),
+		CHTRoot:      common.HexToHash("d92b6d0853455f8439086292338e87f69781921680dd7aa072fb71547b87415e"),
+		BloomRoot:    common.HexToHash("e4e8250a2fefddead7ae42daecd848cbf9b66d748a8270f8bbd4370b764bb9e9"),
+	}
+
+	// TestnetTrustedCheckpoint contains the light client trusted checkpoint for the test network.
+	TestnetTrustedCheckpoint = &TrustedCheckpoint{
+		SectionIndex: 97,
+		SectionHead:  common.HexToHash("719448c67c01eb5b9f27833a36a4e34612f66801316d7ff37daf9e77fb4cd095"),
+		CHTRoot:      common.HexToHash("a7857afc15930ca6e583b6c3d563a025144011655843d52d28e2fdaadd417bea"),
+		BloomRoot:    common.HexToHash("9c71d4b50cbec86dfeaa8e08992de8a4667b81d13c54d6522b17ce2fc5d36416"),
+	}
+
+	// TrustedCheckpoints associates each known checkpoint with the genesis hash of
+	// the chain it belongs to.
+	TrustedCheckpoints = map[common.Hash]*TrustedCheckpoint{
+		MainnetGenesisHash: MainnetTrustedCheckpoint,
+		TestnetGenesisHash: TestnetTrustedCheckpoint,
+	}
+)
+
 //TODO: 其它难度pow和插链验证不过，暂时改成1
 //var Difficultlist = []uint64{1, 2, 10, 50}
 var Difficultlist = []uint64{1}
@@ -85,16 +127,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, new(EthashConfig), nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Matrix core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, new(EthashConfig), nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -121,6 +163,11 @@ type ChainConfig struct {
 	ByzantiumBlock      *big.Int `json:"byzantiumBlock,omitempty"`      // Byzantium switch block (nil = no fork, 0 = already on byzantium)
 	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
 
+	// VMUpgrades schedules named EVM instruction set and gas table upgrades,
+	// mapping each upgrade to its activation block. The upgrades themselves are
+	// registered by the vm package.
+	VMUpgrades map[string]*big.Int `json:"vmUpgrades,omitempty"`
+
 	// Various consensus engines
 	Ethash *EthashConfig `json:"manash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
@@ -200,6 +247,29 @@ func (c *ChainConfig) IsConstantinople(num *big.Int) bool {
 	return isForked(c.ConstantinopleBlock, num)
 }
 
+// IsVMUpgrade returns whether the named EVM upgrade is active at num.
+func (c *ChainConfig) IsVMUpgrade(name string, num *big.Int) bool {
+	return isForked(c.VMUpgrades[name], num)
+}
+
+// ActiveVMUpgrades returns the names of the EVM upgrades active at num, in the
+// order they have to be applied: by activation block, then by name.
+func (c *ChainConfig) ActiveVMUpgrades(num *big.Int) []string {
+	var names []string
+	for name, block := range c.VMUpgrades {
+		if isForked(block, num) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if cmp := c.VMUpgrades[names[i]].Cmp(c.VMUpgrades[names[j]]); cmp != 0 {
+			return cmp < 0
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -263,9 +333,31 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.ConstantinopleBlock, newcfg.ConstantinopleBlock, head) {
 		return newCompatError("Constantinople fork block", c.ConstantinopleBlock, newcfg.ConstantinopleBlock)
 	}
+	for _, name := range vmUpgradeNames(c, newcfg) {
+		if isForkIncompatible(c.VMUpgrades[name], newcfg.VMUpgrades[name], head) {
+			return newCompatError(fmt.Sprintf("VM upgrade %q block", name), c.VMUpgrades[name], newcfg.VMUpgrades[name])
+		}
+	}
 	return nil
 }
 
+// vmUpgradeNames returns the sorted union of the EVM upgrades scheduled by the
+// given configurations.
+func vmUpgradeNames(configs ...*ChainConfig) []string {
+	seen := make(map[string]struct{})
+	for _, config := range configs {
+		for name := range config.VMUpgrades {
+			seen[name] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
@@ -70,6 +70,23 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored:  &ChainConfig{VMUpgrades: map[string]*big.Int{"reprice": big.NewInt(10)}},
+			new:     &ChainConfig{VMUpgrades: map[string]*big.Int{"reprice": big.NewInt(20)}},
+			head:    9,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{VMUpgrades: map[string]*big.Int{"reprice": big.NewInt(10)}},
+			new:    &ChainConfig{},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         `VM upgrade "reprice" block`,
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
 	}
 
 	for _, test := range tests {
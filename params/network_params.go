@@ -23,4 +23,9 @@ const (
 	// BloomBitsBlocks is the number of blocks a single bloom bit section vector
 	// contains.
 	BloomBitsBlocks uint64 = 4096
+
+	// FinalityScanDepth is the number of blocks below the head searched for
+	// blocks signed by a validator quorum when resolving the "safe" and
+	// "finalized" block tags.
+	FinalityScanDepth uint64 = 128
 )
@@ -768,6 +768,31 @@ func ExampleStream() {
 	// [102 111 111 98 97 114] <nil>
 }
 
+// FuzzDecode checks that arbitrary inputs are either rejected or decoded into
+// values re-encoding to the exact same canonical bytes.
+func FuzzDecode(f *testing.F) {
+	for _, test := range decodeTests {
+		f.Add(unhex(test.input))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		var v interface{}
+		if err := DecodeBytes(input, &v); err != nil {
+			return
+		}
+		enc, err := EncodeToBytes(v)
+		if err != nil {
+			t.Fatalf("failed to encode decoded value %v: %v", v, err)
+		}
+		if !bytes.Equal(enc, input) {
+			t.Fatalf("re-encoding mismatch: have %x, want %x", enc, input)
+		}
+		// Exercise the typed decoders too, they must not crash either
+		for _, ptr := range []interface{}{new(simplestruct), new(recstruct), new(tailRaw), new([]uint), new(*big.Int), new([][]byte)} {
+			DecodeBytes(input, ptr)
+		}
+	})
+}
+
 func BenchmarkDecode(b *testing.B) {
 	enc := encodeTestSlice(90000)
 	b.SetBytes(int64(len(enc)))
@@ -0,0 +1,84 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rpc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AccessList is an allowlist of the methods an RPC endpoint serves. Each rule is
+// either a whole namespace ("man_*") or a single method ("admin_peers").
+// Subscriptions are allowed by a rule for "<namespace>_subscribe" or for the
+// subscription name ("man_newHeads"), unsubscribing is always allowed.
+type AccessList struct {
+	namespaces map[string]bool
+	methods    map[string]bool
+}
+
+// NewAccessList creates an allowlist out of the given rules.
+func NewAccessList(rules []string) (*AccessList, error) {
+	acl := &AccessList{
+		namespaces: make(map[string]bool),
+		methods:    make(map[string]bool),
+	}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		elems := strings.SplitN(rule, serviceMethodSeparator, 2)
+		if len(elems) != 2 || elems[0] == "" || elems[1] == "" {
+			return nil, fmt.Errorf("invalid access rule %q, want <namespace>_<method> or <namespace>_*", rule)
+		}
+		if elems[1] == "*" {
+			acl.namespaces[elems[0]] = true
+		} else {
+			acl.methods[rule] = true
+		}
+	}
+	return acl, nil
+}
+
+// LoadAccessList reads an allowlist from a file holding one rule per line. Empty
+// lines and lines starting with # are ignored.
+func LoadAccessList(file string) (*AccessList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewAccessList(rules)
+}
+
+// Allowed checks whether the given method of a namespace may be called.
+func (acl *AccessList) Allowed(namespace, method string) bool {
+	if acl.namespaces[namespace] {
+		return true
+	}
+	return acl.methods[namespace+serviceMethodSeparator+method]
+}
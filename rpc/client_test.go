@@ -419,6 +419,35 @@ func TestClientHTTP(t *testing.T) {
 	}
 }
 
+// Tests that the handlers are told which network transport a request came over.
+func TestClientTransport(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	defer server.Stop()
+
+	for _, transport := range []string{"http", "ws"} {
+		client, hs := httpTestClient(server, transport, nil)
+
+		var have string
+		if err := client.Call(&have, "service_transport"); err != nil {
+			t.Errorf("%s: call failed: %v", transport, err)
+		} else if have != transport {
+			t.Errorf("%s: transport mismatch: have %q", transport, have)
+		}
+		client.Close()
+		hs.Close()
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	var have string
+	if err := client.Call(&have, "service_transport"); err != nil {
+		t.Fatalf("inproc: call failed: %v", err)
+	}
+	if have != "" {
+		t.Errorf("inproc: transport mismatch: have %q, want none", have)
+	}
+}
+
 func TestClientReconnect(t *testing.T) {
 	startServer := func(addr string) (*Server, net.Listener) {
 		srv := newTestServer("service", new(Service))
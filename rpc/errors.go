@@ -58,6 +58,13 @@ func (e *callbackError) ErrorCode() int { return -32000 }
 
 func (e *callbackError) Error() string { return e.message }
 
+// issued for responses or batch elements exceeding the response size limits
+type responseTooLargeError struct{}
+
+func (e *responseTooLargeError) ErrorCode() int { return -32003 }
+
+func (e *responseTooLargeError) Error() string { return "response too large" }
+
 // issued when a request is received after the server is issued to stop.
 type shutdownError struct{}
 
@@ -21,6 +21,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 func TestHTTPErrorResponseWithDelete(t *testing.T) {
@@ -52,3 +55,39 @@ func testHTTPErrorResponse(t *testing.T, method, contentType, body string, expec
 		t.Fatalf("response code should be %d not %d", expected, code)
 	}
 }
+
+func TestJWTHandler(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	handler := NewJWTHandler(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	sign := func(key []byte, issued time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{IssuedAt: issued.Unix()})
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return "Bearer " + signed
+	}
+	tests := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{sign(secret, time.Now()), http.StatusOK},
+		{sign(secret, time.Now().Add(-30*time.Second)), http.StatusOK},
+		{sign(secret, time.Now().Add(-2*jwtExpiryTimeout)), http.StatusUnauthorized},
+		{sign(secret, time.Now().Add(2*jwtExpiryTimeout)), http.StatusUnauthorized},
+		{sign([]byte("wrong secret"), time.Now()), http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		request := httptest.NewRequest(http.MethodPost, "http://url.com", nil)
+		if tt.auth != "" {
+			request.Header.Set("Authorization", tt.auth)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != tt.code {
+			t.Errorf("test %d: response code mismatch: have %d, want %d", i, recorder.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// jwtExpiryTimeout is the maximum clock drift tolerated between the issued-at
+// claim of a token and the local time.
+const jwtExpiryTimeout = 60 * time.Second
+
+var (
+	errMissingToken    = errors.New("missing token")
+	errTokenStale      = errors.New("stale token")
+	errTokenFromFuture = errors.New("future token")
+)
+
+// jwtHandler rejects HTTP requests not carrying a bearer token signed with the
+// shared secret, passing the authenticated ones on to the wrapped handler.
+type jwtHandler struct {
+	keyFunc func(token *jwt.Token) (interface{}, error)
+	next    http.Handler
+}
+
+// NewJWTHandler wraps an HTTP handler, only letting through requests which are
+// authenticated with an HS256 token signed by the given secret and issued within
+// a minute of the local time.
+func NewJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{
+		keyFunc: func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		},
+		next: next,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (handler *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := handler.authenticate(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	handler.next.ServeHTTP(w, r)
+}
+
+// authenticate validates the bearer token of the request.
+func (handler *jwtHandler) authenticate(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return errMissingToken
+	}
+	parser := &jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodHS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+	claims := new(jwt.StandardClaims)
+	if _, err := parser.ParseWithClaims(strings.TrimPrefix(auth, "Bearer "), claims, handler.keyFunc); err != nil {
+		return err
+	}
+	issued := time.Unix(claims.IssuedAt, 0)
+	switch {
+	case time.Since(issued) > jwtExpiryTimeout:
+		return errTokenStale
+	case time.Until(issued) > jwtExpiryTimeout:
+		return errTokenFromFuture
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rpc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// maxTrackedClients is the number of client networks tracked by a limiter above
+// which the least recently seen ones are forgotten.
+const maxTrackedClients = 4096
+
+// Request rates are metered per network rather than per address, so that a
+// client holding a whole IPv4 /24 or IPv6 /64 can't evade the limit by rotating
+// through its addresses.
+var (
+	ipv4RateMask = net.CIDRMask(24, 32)
+	ipv6RateMask = net.CIDRMask(64, 128)
+)
+
+var (
+	errRateLimited        = errors.New("rate limit exceeded")
+	errTooManyConnections = errors.New("too many concurrent connections")
+)
+
+// Limits bounds the resources a single client IP may use on the HTTP and
+// websocket transports of a server. The request rate is shared by all clients
+// of the same IPv4 /24 or IPv6 /64 network. Zero values disable the respective
+// limit.
+type Limits struct {
+	RequestsPerSecond float64 // HTTP requests or websocket messages served per second
+	Burst             int     // Requests permitted in excess of the rate after idling
+	MaxConnections    int     // Concurrent HTTP requests or open websocket connections
+	ResponseMaxSize   int     // Maximum size in bytes of a single response
+}
+
+// bucket is the token bucket metering the requests of a single client.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// ipLimiter enforces the request rate and connection limits per client IP.
+type ipLimiter struct {
+	limits Limits
+
+	lock    sync.Mutex
+	buckets *simplelru.LRU // Token buckets of the most recently seen client networks
+	conns   map[string]int
+}
+
+func newIPLimiter(limits Limits) *ipLimiter {
+	buckets, _ := simplelru.NewLRU(maxTrackedClients, nil)
+	return &ipLimiter{
+		limits:  limits,
+		buckets: buckets,
+		conns:   make(map[string]int),
+	}
+}
+
+// capacity returns the number of requests a client may issue at once.
+func (l *ipLimiter) capacity() float64 {
+	if l.limits.Burst > 0 {
+		return float64(l.limits.Burst)
+	}
+	return 1
+}
+
+// refill returns the bucket of the client's network, topped up with the tokens
+// accrued since its last use. Once maxTrackedClients are tracked, the bucket of
+// the least recently seen network is dropped to make room for a new one. The
+// lock must be held.
+func (l *ipLimiter) refill(ip string, now time.Time) *bucket {
+	var (
+		b   *bucket
+		key = rateKey(ip)
+	)
+	if cached, ok := l.buckets.Get(key); ok {
+		b = cached.(*bucket)
+	} else {
+		b = &bucket{tokens: l.capacity(), updated: now}
+		l.buckets.Add(key, b)
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * l.limits.RequestsPerSecond
+	if capacity := l.capacity(); b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.updated = now
+	return b
+}
+
+// allow reports whether the client may issue a request right now, taking a
+// token from its bucket if so.
+func (l *ipLimiter) allow(ip string) bool {
+	if l.limits.RequestsPerSecond <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b := l.refill(ip, time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token from the bucket of the client even if it is empty,
+// returning how long the request has to be delayed to conform to the rate.
+func (l *ipLimiter) reserve(ip string) time.Duration {
+	if l.limits.RequestsPerSecond <= 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b := l.refill(ip, time.Now())
+	if b.tokens--; b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.limits.RequestsPerSecond * float64(time.Second))
+}
+
+// acquire registers a new connection of the client if it is below its limit.
+func (l *ipLimiter) acquire(ip string) bool {
+	if l.limits.MaxConnections <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.conns[ip] >= l.limits.MaxConnections {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// release unregisters a connection of the client.
+func (l *ipLimiter) release(ip string) {
+	if l.limits.MaxConnections <= 0 {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// rateKey returns the network the request rate of a client is metered by.
+// Addresses that can't be parsed are metered on their own.
+func rateKey(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	mask := ipv6RateMask
+	if v4 := addr.To4(); v4 != nil {
+		addr, mask = v4, ipv4RateMask
+	}
+	return (&net.IPNet{IP: addr.Mask(mask), Mask: mask}).String()
+}
+
+// clientIP extracts the address of the client issuing an HTTP request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
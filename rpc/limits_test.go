@@ -0,0 +1,159 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that the token buckets of clients are metered independently and refill
+// at the configured rate.
+func TestIPLimiterRate(t *testing.T) {
+	limiter := newIPLimiter(Limits{RequestsPerSecond: 10, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("1.2.3.4") {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	if limiter.allow("1.2.3.4") {
+		t.Fatalf("request beyond burst allowed")
+	}
+	if !limiter.allow("5.6.7.8") {
+		t.Fatalf("request of other client rejected")
+	}
+	if delay := limiter.reserve("1.2.3.4"); delay <= 0 || delay > 100*time.Millisecond {
+		t.Fatalf("reservation delay mismatch: have %v, want (0, 100ms]", delay)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if !limiter.allow("1.2.3.4") {
+		t.Fatalf("request after refill rejected")
+	}
+}
+
+// Tests that the number of tracked clients is capped by dropping the least
+// recently seen one.
+func TestIPLimiterEviction(t *testing.T) {
+	limiter := newIPLimiter(Limits{RequestsPerSecond: 1})
+
+	// Drain the bucket of the first client, then fill up the tracked clients
+	if !limiter.allow("0.0.0.0") {
+		t.Fatalf("first request rejected")
+	}
+	for i := 1; i < maxTrackedClients; i++ {
+		limiter.allow(fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+	}
+	// Touch the first client so that the second one becomes the oldest
+	if limiter.allow("0.0.0.0") {
+		t.Fatalf("request beyond rate allowed")
+	}
+	limiter.allow("192.168.0.1")
+
+	if have := limiter.buckets.Len(); have != maxTrackedClients {
+		t.Fatalf("tracked clients mismatch: have %d, want %d", have, maxTrackedClients)
+	}
+	if limiter.buckets.Contains(rateKey("10.0.1.1")) {
+		t.Errorf("least recently seen client not evicted")
+	}
+	if !limiter.buckets.Contains(rateKey("0.0.0.0")) {
+		t.Errorf("recently seen client evicted")
+	}
+	if limiter.allow("0.0.0.0") {
+		t.Errorf("drained client allowed after eviction of others")
+	}
+}
+
+// Tests that clients of the same network share a bucket, so rotating through
+// addresses neither evades the rate limit nor evicts the drained bucket.
+func TestIPLimiterNetworks(t *testing.T) {
+	limiter := newIPLimiter(Limits{RequestsPerSecond: 1})
+
+	if !limiter.allow("10.1.2.3") {
+		t.Fatalf("first request rejected")
+	}
+	for i := 0; i < 256; i++ {
+		if limiter.allow(fmt.Sprintf("10.1.2.%d", i)) {
+			t.Fatalf("request from rotated IPv4 address %d allowed", i)
+		}
+	}
+	if !limiter.allow("10.1.3.1") {
+		t.Fatalf("request from neighbouring IPv4 network rejected")
+	}
+	if !limiter.allow("2001:db8::1") {
+		t.Fatalf("first IPv6 request rejected")
+	}
+	for i := 0; i < maxTrackedClients+1; i++ {
+		if limiter.allow(fmt.Sprintf("2001:db8::%x:%x", i>>16, i&0xffff)) {
+			t.Fatalf("request from rotated IPv6 address %d allowed", i)
+		}
+	}
+	if !limiter.allow("2001:db8:0:1::1") {
+		t.Fatalf("request from neighbouring IPv6 network rejected")
+	}
+	if have := limiter.buckets.Len(); have != 4 {
+		t.Errorf("tracked networks mismatch: have %d, want 4", have)
+	}
+}
+
+// Tests that the concurrent connections of a client are capped.
+func TestIPLimiterConnections(t *testing.T) {
+	limiter := newIPLimiter(Limits{MaxConnections: 1})
+
+	if !limiter.acquire("1.2.3.4") {
+		t.Fatalf("first connection rejected")
+	}
+	if limiter.acquire("1.2.3.4") {
+		t.Fatalf("connection beyond limit accepted")
+	}
+	limiter.release("1.2.3.4")
+	if !limiter.acquire("1.2.3.4") {
+		t.Fatalf("connection after release rejected")
+	}
+}
+
+// Tests that HTTP requests beyond the rate limit are rejected and responses
+// beyond the size cap are replaced by an error.
+func TestHTTPLimits(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	server.SetLimits(Limits{RequestsPerSecond: 1, ResponseMaxSize: 64})
+
+	call := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "http://url.com", strings.NewReader(body))
+		request.Header.Set("content-type", contentType)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+	resp := call(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["` + strings.Repeat("x", 64) + `",1,{"S":""}]}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("response code mismatch: have %d, want %d", resp.Code, http.StatusOK)
+	}
+	if !strings.Contains(resp.Body.String(), "response too large") {
+		t.Errorf("oversized response delivered: %s", resp.Body.String())
+	}
+	if resp := call(`{"jsonrpc":"2.0","id":2,"method":"test_rets"}`); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("response code mismatch: have %d, want %d", resp.Code, http.StatusTooManyRequests)
+	}
+}
@@ -18,6 +18,7 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -73,6 +74,34 @@ func (s *RPCService) Modules() map[string]string {
 	return modules
 }
 
+// SetBatchLimits sets the maximum number of requests in a batch and the maximum
+// total size in bytes of a batch response, zero disabling the limit. Batch
+// elements beyond either limit are not executed and are answered with an error
+// while the preceding elements still return their results.
+func (s *Server) SetBatchLimits(itemLimit, maxResponseSize int) {
+	atomic.StoreInt64(&s.batchItemLimit, int64(itemLimit))
+	atomic.StoreInt64(&s.batchResponseLimit, int64(maxResponseSize))
+}
+
+// SetLimits bounds the request rate, the concurrent connections and the response
+// size allowed to each client IP of the HTTP and websocket transports.
+func (s *Server) SetLimits(limits Limits) {
+	s.limiter.Store(newIPLimiter(limits))
+}
+
+// rateLimiter returns the per client limits of the server, or nil if unset.
+func (s *Server) rateLimiter() *ipLimiter {
+	limiter, _ := s.limiter.Load().(*ipLimiter)
+	return limiter
+}
+
+// SetAccessList restricts the methods callable on the server to the given
+// allowlist. The rpc metadata namespace is always served. It must be called
+// before the server starts serving requests.
+func (s *Server) SetAccessList(acl *AccessList) {
+	s.acl = acl
+}
+
 // RegisterName will create a service for the given rcvr type under the given name. When no methods on the given rcvr
 // match the criteria to be either a RPC method or a subscription an error is returned. Otherwise a new service is
 // created and added to the service collection this server instance serves.
@@ -317,8 +346,16 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	if req.callb.errPos >= 0 { // test if method returned an error
 		if !reply[req.callb.errPos].IsNil() {
 			e := reply[req.callb.errPos].Interface().(error)
-			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
-			return res, nil
+
+			// Keep the code of errors that define one, and pass along any data
+			var rpcErr Error = &callbackError{e.Error()}
+			if ec, ok := e.(Error); ok {
+				rpcErr = ec
+			}
+			if de, ok := e.(DataError); ok {
+				return codec.CreateErrorResponseWithInfo(&req.id, rpcErr, de.ErrorData()), nil
+			}
+			return codec.CreateErrorResponse(&req.id, rpcErr), nil
 		}
 	}
 	return codec.CreateResponse(req.id, reply[0].Interface()), nil
@@ -333,6 +370,16 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 	} else {
 		response, callback = s.handle(ctx, codec, req)
 	}
+	// Replace oversized responses, subscription ids are tiny and must be delivered
+	if limiter := s.rateLimiter(); limiter != nil && limiter.limits.ResponseMaxSize > 0 && callback == nil {
+		if blob, err := json.Marshal(response); err == nil {
+			if len(blob) > limiter.limits.ResponseMaxSize {
+				response = codec.CreateErrorResponse(&req.id, &responseTooLargeError{})
+			} else {
+				response = json.RawMessage(blob)
+			}
+		}
+	}
 
 	if err := codec.Write(response); err != nil {
 		log.Error(fmt.Sprintf("%v\n", err))
@@ -348,15 +395,42 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 // execBatch executes the given requests and writes the result back using the codec.
 // It will only write the response back when the last request is processed.
 func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*serverRequest) {
+	var (
+		itemLimit = atomic.LoadInt64(&s.batchItemLimit)
+		sizeLimit = atomic.LoadInt64(&s.batchResponseLimit)
+		size      int64
+	)
 	responses := make([]interface{}, len(requests))
 	var callbacks []func()
 	for i, req := range requests {
+		// Reject the remaining elements once a batch limit is reached
+		if itemLimit > 0 && int64(i) >= itemLimit {
+			responses[i] = codec.CreateErrorResponse(&req.id, &invalidRequestError{fmt.Sprintf("batch too large, at most %d requests allowed", itemLimit)})
+			continue
+		}
+		if sizeLimit > 0 && size >= sizeLimit {
+			responses[i] = codec.CreateErrorResponse(&req.id, &responseTooLargeError{})
+			continue
+		}
 		if req.err != nil {
 			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
 		} else {
 			var callback func()
 			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
 				callbacks = append(callbacks, callback)
+				continue // subscription ids are tiny and must be delivered
+			}
+		}
+		// Account for the response size, keeping the encoding to avoid redoing it
+		if sizeLimit > 0 {
+			blob, err := json.Marshal(responses[i])
+			if err != nil {
+				continue
+			}
+			if size += int64(len(blob)); size > sizeLimit {
+				responses[i] = codec.CreateErrorResponse(&req.id, &responseTooLargeError{})
+			} else {
+				responses[i] = json.RawMessage(blob)
 			}
 		}
 	}
@@ -404,6 +478,14 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		// Subscriptions carry their name in r.method (e.g. "newHeads"), they are
+		// allowed by a rule for either the name or "<namespace>_subscribe"
+		if s.acl != nil && r.service != MetadataApi && !s.acl.Allowed(r.service, r.method) &&
+			!(r.isPubSub && s.acl.Allowed(r.service, strings.TrimPrefix(subscribeMethodSuffix, serviceMethodSeparator))) {
+			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
+			continue
+		}
+
 		if svc, ok = s.services[r.service]; !ok { // rpc method isn't available
 			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
 			continue
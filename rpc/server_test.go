@@ -48,6 +48,11 @@ func (s *Service) EchoWithCtx(ctx context.Context, str string, i int, args *Args
 	return Result{str, i, args}
 }
 
+func (s *Service) Transport(ctx context.Context) string {
+	transport, _ := ctx.Value("transport").(string)
+	return transport
+}
+
 func (s *Service) Sleep(ctx context.Context, duration time.Duration) {
 	select {
 	case <-time.After(duration):
@@ -92,8 +97,8 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	if len(svc.callbacks) != 5 {
-		t.Errorf("Expected 5 callbacks for service 'calc', got %d", len(svc.callbacks))
+	if len(svc.callbacks) != 6 {
+		t.Errorf("Expected 6 callbacks for service 'calc', got %d", len(svc.callbacks))
 	}
 
 	if len(svc.subscriptions) != 1 {
@@ -160,3 +165,151 @@ func TestServerMethodExecution(t *testing.T) {
 func TestServerMethodWithCtx(t *testing.T) {
 	testServerMethodExecution(t, "echoWithCtx")
 }
+
+func TestServerBatchLimits(t *testing.T) {
+	tests := []struct {
+		itemLimit, sizeLimit int
+		want                 []int // error code per element, 0 for a result
+	}{
+		{0, 0, []int{0, 0, 0, 0}},
+		{3, 0, []int{0, 0, 0, -32600}},
+		{0, 150, []int{0, -32003, -32003, -32003}},
+		{1, 1000, []int{0, -32600, -32600, -32600}},
+	}
+	for i, tt := range tests {
+		server := NewServer()
+		if err := server.RegisterName("test", new(Service)); err != nil {
+			t.Fatalf("%v", err)
+		}
+		server.SetBatchLimits(tt.itemLimit, tt.sizeLimit)
+
+		batch := make([]map[string]interface{}, len(tt.want))
+		for j := range batch {
+			batch[j] = map[string]interface{}{
+				"id":      j,
+				"method":  "test_echo",
+				"version": "2.0",
+				"params":  []interface{}{"a string argument long enough to matter", j, &Args{"abcde"}},
+			}
+		}
+		clientConn, serverConn := net.Pipe()
+		go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+		if err := json.NewEncoder(clientConn).Encode(batch); err != nil {
+			t.Fatal(err)
+		}
+		var responses []struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *jsonError      `json:"error"`
+		}
+		if err := json.NewDecoder(clientConn).Decode(&responses); err != nil {
+			t.Fatal(err)
+		}
+		clientConn.Close()
+
+		if len(responses) != len(tt.want) {
+			t.Fatalf("test %d: response count mismatch: have %d, want %d", i, len(responses), len(tt.want))
+		}
+		for j, res := range responses {
+			code := 0
+			if res.Error != nil {
+				code = res.Error.Code
+			}
+			if res.ID != j || code != tt.want[j] {
+				t.Errorf("test %d, element %d: have id %d code %d, want id %d code %d", i, j, res.ID, code, j, tt.want[j])
+			}
+		}
+	}
+}
+
+type dataError struct{}
+
+func (e *dataError) Error() string          { return "data error" }
+func (e *dataError) ErrorCode() int         { return 3 }
+func (e *dataError) ErrorData() interface{} { return "0xdeadbeef" }
+
+type DataErrorService struct{}
+
+func (s *DataErrorService) Fail() error { return new(dataError) }
+
+func TestServerErrorData(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(DataErrorService)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	err := client.Call(nil, "test_fail")
+	if err == nil {
+		t.Fatal("expected call to fail")
+	}
+	if ec, ok := err.(Error); !ok || ec.ErrorCode() != 3 {
+		t.Errorf("error code mismatch: have %v, want 3", err)
+	}
+	if de, ok := err.(DataError); !ok || de.ErrorData() != "0xdeadbeef" {
+		t.Errorf("error data mismatch: have %v, want 0xdeadbeef", err)
+	}
+}
+
+func TestServerAccessList(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := server.RegisterName("calc", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	acl, err := NewAccessList([]string{"test_*", "calc_rets"})
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	server.SetAccessList(acl)
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	for _, method := range []string{"test_rets", "test_noArgsRets", "calc_rets", "rpc_modules"} {
+		if err := client.Call(nil, method); err != nil {
+			t.Errorf("allowed method %s rejected: %v", method, err)
+		}
+	}
+	if err := client.Call(nil, "calc_noArgsRets"); err == nil {
+		t.Errorf("method outside the access list served")
+	}
+	if _, err := NewAccessList([]string{"calc"}); err == nil {
+		t.Errorf("rule without method accepted")
+	}
+}
+
+// Tests that subscriptions are allowed by a rule for either the subscribe method
+// of their namespace or their own name.
+func TestServerAccessListSubscriptions(t *testing.T) {
+	server := NewServer()
+	for _, namespace := range []string{"nftest", "named", "denied"} {
+		if err := server.RegisterName(namespace, new(NotificationTestService)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	acl, err := NewAccessList([]string{"nftest_subscribe", "named_someSubscription"})
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	server.SetAccessList(acl)
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	for _, namespace := range []string{"nftest", "named"} {
+		sub, err := client.Subscribe(context.Background(), namespace, make(chan int), "someSubscription", 1, 1)
+		if err != nil {
+			t.Errorf("allowed %s subscription rejected: %v", namespace, err)
+			continue
+		}
+		sub.Unsubscribe()
+	}
+	if _, err := client.Subscribe(context.Background(), "denied", make(chan int), "someSubscription", 1, 1); err == nil {
+		t.Errorf("subscription outside the access list served")
+	}
+}
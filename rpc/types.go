@@ -20,8 +20,10 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/matrix/go-matrix/common/hexutil"
 	"gopkg.in/fatih/set.v0"
@@ -69,11 +71,19 @@ type subscriptions map[string]*callback  // collection of subscription callbacks
 
 // Server represents a RPC server
 type Server struct {
+	// 64-bit fields accessed atomically must stay first to keep them
+	// 8-byte aligned on 32-bit platforms.
+	batchItemLimit     int64 // Maximum number of requests in a batch, accessed atomically
+	batchResponseLimit int64 // Maximum size in bytes of a batch response, accessed atomically
+
 	services serviceRegistry
 
 	run      int32
 	codecsMu sync.Mutex
 	codecs   *set.Set
+
+	acl     *AccessList  // Allowlist of the methods callable, nil if all may be called
+	limiter atomic.Value // Per client IP limits of the HTTP and websocket transports, *ipLimiter
 }
 
 // rpcRequest represents a raw incoming RPC request
@@ -92,6 +102,13 @@ type Error interface {
 	ErrorCode() int // returns the code
 }
 
+// A DataError contains some data in addition to the error message, which is
+// sent to the client in the data field of the JSON-RPC error object.
+type DataError interface {
+	Error() string          // returns the message
+	ErrorData() interface{} // returns the error data
+}
+
 // ServerCodec implements reading, parsing and writing RPC messages for the server side of
 // a RPC session. Implementations must be go-routine safe since the codec can be called in
 // multiple go-routines concurrently.
@@ -119,13 +136,15 @@ type ServerCodec interface {
 type BlockNumber int64
 
 const (
-	PendingBlockNumber  = BlockNumber(-2)
-	LatestBlockNumber   = BlockNumber(-1)
-	EarliestBlockNumber = BlockNumber(0)
+	SafeBlockNumber      = BlockNumber(-4)
+	FinalizedBlockNumber = BlockNumber(-3)
+	PendingBlockNumber   = BlockNumber(-2)
+	LatestBlockNumber    = BlockNumber(-1)
+	EarliestBlockNumber  = BlockNumber(0)
 )
 
 // UnmarshalJSON parses the given JSON fragment into a BlockNumber. It supports:
-// - "latest", "earliest" or "pending" as string arguments
+// - "latest", "earliest", "pending", "safe" or "finalized" as string arguments
 // - the block number
 // Returned errors:
 // - an invalid block number error when the given argument isn't a known strings
@@ -146,6 +165,12 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	case "pending":
 		*bn = PendingBlockNumber
 		return nil
+	case "safe":
+		*bn = SafeBlockNumber
+		return nil
+	case "finalized":
+		*bn = FinalizedBlockNumber
+		return nil
 	}
 
 	blckNum, err := hexutil.DecodeUint64(input)
@@ -160,6 +185,22 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// FormatBlockNumber returns the tag of the special block numbers and the decimal
+// number of any other block, as used in error messages.
+func FormatBlockNumber(bn BlockNumber) string {
+	switch bn {
+	case LatestBlockNumber:
+		return "latest"
+	case PendingBlockNumber:
+		return "pending"
+	case SafeBlockNumber:
+		return "safe"
+	case FinalizedBlockNumber:
+		return "finalized"
+	}
+	return strconv.FormatInt(int64(bn), 10)
+}
+
 func (bn BlockNumber) Int64() int64 {
 	return (int64)(bn)
 }
@@ -46,6 +46,8 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		14: {`someString`, true, BlockNumber(0)},
 		15: {`""`, true, BlockNumber(0)},
 		16: {``, true, BlockNumber(0)},
+		17: {`"safe"`, false, SafeBlockNumber},
+		18: {`"finalized"`, false, FinalizedBlockNumber},
 	}
 
 	for i, test := range tests {
@@ -64,3 +66,22 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatBlockNumber(t *testing.T) {
+	tests := []struct {
+		number   BlockNumber
+		expected string
+	}{
+		{EarliestBlockNumber, "0"},
+		{BlockNumber(100), "100"},
+		{LatestBlockNumber, "latest"},
+		{PendingBlockNumber, "pending"},
+		{SafeBlockNumber, "safe"},
+		{FinalizedBlockNumber, "finalized"},
+	}
+	for i, test := range tests {
+		if have := FormatBlockNumber(test.number); have != test.expected {
+			t.Errorf("test %d: have %q, want %q", i, have, test.expected)
+		}
+	}
+}
@@ -56,7 +56,7 @@ var websocketJSONCodec = websocket.Codec{
 // allowedOrigins should be a comma-separated list of allowed origin URLs.
 // To allow connections with any origin, pass "*".
 func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
-	return websocket.Server{
+	handler := websocket.Server{
 		Handshake: wsHandshakeValidator(allowedOrigins),
 		Handler: func(conn *websocket.Conn) {
 			// Create a custom encode/decode pair to enforce payload size and number encoding
@@ -66,11 +66,37 @@ func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 				return websocketJSONCodec.Send(conn, v)
 			}
 			decoder := func(v interface{}) error {
-				return websocketJSONCodec.Receive(conn, v)
+				err := websocketJSONCodec.Receive(conn, v)
+				if limiter := srv.rateLimiter(); err == nil && limiter != nil {
+					// Throttle the reads of clients exceeding their request rate
+					time.Sleep(limiter.reserve(clientIP(conn.Request())))
+				}
+				return err
 			}
-			srv.ServeCodec(NewCodec(conn, encoder, decoder), OptionMethodInvocation|OptionSubscriptions)
+			// Expose the client address to the handlers, same as for HTTP requests
+			ctx := context.WithValue(context.Background(), "remote", conn.Request().RemoteAddr)
+			ctx = context.WithValue(ctx, "transport", "ws")
+
+			codec := NewCodec(conn, encoder, decoder)
+			defer codec.Close()
+			srv.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limiter := srv.rateLimiter(); limiter != nil {
+			ip := clientIP(r)
+			if !limiter.allow(ip) {
+				http.Error(w, errRateLimited.Error(), http.StatusTooManyRequests)
+				return
+			}
+			if !limiter.acquire(ip) {
+				http.Error(w, errTooManyConnections.Error(), http.StatusTooManyRequests)
+				return
+			}
+			defer limiter.release(ip)
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
 
 // NewWSServer creates a new websocket RPC server around an API provider.
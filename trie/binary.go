@@ -0,0 +1,490 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// The binary trie is a sparse Merkle tree over the Keccak256 hashes of the keys.
+// Every branch has exactly two children addressed by the next bit of the hashed
+// key and every leaf sits at the shallowest depth where it is alone in its
+// subtree, so the shape (and root hash) only depends on the stored key set.
+//
+// Nodes are stored in the trie database keyed by the hash of their encoding:
+//
+//	leaf:   0x00 || keccak256(key) || value
+//	branch: 0x01 || hash(left) || hash(right)
+//
+// The hash of an empty subtrie is the zero hash.
+const (
+	binaryLeafPrefix   = 0x00
+	binaryBranchPrefix = 0x01
+)
+
+var errInvalidBinaryNode = errors.New("invalid binary trie node")
+
+// binaryNode is a node of the binary trie. It's one of *binaryBranch, *binaryLeaf,
+// binaryHashNode (not yet resolved from the database) or nil (empty subtrie).
+type binaryNode interface{}
+
+type binaryBranch struct {
+	children [2]binaryNode
+	hash     *common.Hash // Cached hash of the node, nil if modified
+	dirty    bool         // Whether the node needs to be written to the database
+}
+
+type binaryLeaf struct {
+	key   common.Hash // Hash of the key the leaf is stored at
+	value []byte
+	hash  *common.Hash // Cached hash of the node
+	dirty bool         // Whether the node needs to be written to the database
+}
+
+type binaryHashNode common.Hash
+
+// BinaryTrie is a Merkle Patricia alternative storing the data in a binary layout,
+// providing much smaller proofs at the cost of deeper paths. It's safe to use the
+// zero hash as root to create an empty trie. BinaryTrie is not safe for concurrent
+// use.
+type BinaryTrie struct {
+	db   *Database
+	root binaryNode
+}
+
+// NewBinary creates a binary trie with an existing root node from db.
+//
+// If root is the zero hash, the trie is initially empty. Otherwise, NewBinary will
+// panic if db is nil and returns a MissingNodeError if root does not exist in the
+// database. Accessing the trie loads nodes from db on demand.
+func NewBinary(root common.Hash, db *Database) (*BinaryTrie, error) {
+	if db == nil {
+		panic("trie.NewBinary called without a database")
+	}
+	trie := &BinaryTrie{db: db}
+	if root != (common.Hash{}) {
+		rootnode, err := trie.resolve(root)
+		if err != nil {
+			return nil, err
+		}
+		trie.root = rootnode
+	}
+	return trie, nil
+}
+
+// Get returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+func (t *BinaryTrie) Get(key []byte) []byte {
+	res, err := t.TryGet(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+	return res
+}
+
+// TryGet returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryTrie) TryGet(key []byte) ([]byte, error) {
+	hkey := crypto.Keccak256Hash(key)
+
+	n := t.root
+	for depth := 0; ; depth++ {
+		switch node := n.(type) {
+		case nil:
+			return nil, nil
+		case *binaryLeaf:
+			if node.key != hkey {
+				return nil, nil
+			}
+			return node.value, nil
+		case *binaryBranch:
+			child, err := t.child(node, binaryKeyBit(hkey, depth))
+			if err != nil {
+				return nil, err
+			}
+			n = child
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+}
+
+// Update associates key with value in the trie. Subsequent calls to Get will
+// return value. If value has length zero, any existing value is deleted from
+// the trie.
+//
+// The value bytes must not be modified by the caller while they are stored in
+// the trie.
+func (t *BinaryTrie) Update(key, value []byte) {
+	if err := t.TryUpdate(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate associates key with value in the trie. If value has length zero, any
+// existing value is deleted from the trie.
+//
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return t.TryDelete(key)
+	}
+	leaf := &binaryLeaf{key: crypto.Keccak256Hash(key), value: value, dirty: true}
+	root, err := t.insert(t.root, leaf, 0)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Delete removes any existing value for key from the trie.
+func (t *BinaryTrie) Delete(key []byte) {
+	if err := t.TryDelete(key); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryDelete removes any existing value for key from the trie.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryTrie) TryDelete(key []byte) error {
+	root, _, err := t.delete(t.root, crypto.Keccak256Hash(key), 0)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+func (t *BinaryTrie) insert(n binaryNode, leaf *binaryLeaf, depth int) (binaryNode, error) {
+	switch n := n.(type) {
+	case nil:
+		return leaf, nil
+
+	case *binaryLeaf:
+		if n.key == leaf.key {
+			return leaf, nil
+		}
+		return binarySplit(n, leaf, depth), nil
+
+	case *binaryBranch:
+		bit := binaryKeyBit(leaf.key, depth)
+		child, err := t.child(n, bit)
+		if err != nil {
+			return nil, err
+		}
+		if child, err = t.insert(child, leaf, depth+1); err != nil {
+			return nil, err
+		}
+		n.children[bit], n.hash, n.dirty = child, nil, true
+		return n, nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// binarySplit creates the branches needed to hold two leaves whose hashed keys
+// share the first depth bits.
+func binarySplit(a, b *binaryLeaf, depth int) binaryNode {
+	branch := &binaryBranch{dirty: true}
+	abit, bbit := binaryKeyBit(a.key, depth), binaryKeyBit(b.key, depth)
+	if abit != bbit {
+		branch.children[abit], branch.children[bbit] = a, b
+	} else {
+		branch.children[abit] = binarySplit(a, b, depth+1)
+	}
+	return branch
+}
+
+// delete returns the new root of the trie with key deleted, and whether anything
+// changed. Branches left with a single leaf below them are collapsed into it.
+func (t *BinaryTrie) delete(n binaryNode, key common.Hash, depth int) (binaryNode, bool, error) {
+	switch n := n.(type) {
+	case nil:
+		return nil, false, nil
+
+	case *binaryLeaf:
+		if n.key != key {
+			return n, false, nil
+		}
+		return nil, true, nil
+
+	case *binaryBranch:
+		bit := binaryKeyBit(key, depth)
+		child, err := t.child(n, bit)
+		if err != nil {
+			return nil, false, err
+		}
+		child, changed, err := t.delete(child, key, depth+1)
+		if !changed || err != nil {
+			return n, false, err
+		}
+		n.children[bit], n.hash, n.dirty = child, nil, true
+
+		// If the remaining sibling is empty or a lone leaf, collapse the branch
+		sibling, err := t.child(n, 1-bit)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case child == nil && sibling == nil:
+			return nil, true, nil
+		case child == nil:
+			if leaf, ok := sibling.(*binaryLeaf); ok {
+				return leaf, true, nil
+			}
+		case sibling == nil:
+			if leaf, ok := child.(*binaryLeaf); ok {
+				return leaf, true, nil
+			}
+		}
+		return n, true, nil
+
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// child returns the given child of a branch, resolving it from the database and
+// caching it in the branch if needed.
+func (t *BinaryTrie) child(n *binaryBranch, i int) (binaryNode, error) {
+	if hash, ok := n.children[i].(binaryHashNode); ok {
+		child, err := t.resolve(common.Hash(hash))
+		if err != nil {
+			return nil, err
+		}
+		n.children[i] = child
+	}
+	return n.children[i], nil
+}
+
+func (t *BinaryTrie) resolve(hash common.Hash) (binaryNode, error) {
+	blob, err := t.db.Node(hash)
+	if err != nil || blob == nil {
+		return nil, &MissingNodeError{NodeHash: hash}
+	}
+	return decodeBinaryNode(hash, blob)
+}
+
+// Hash returns the root hash of the trie. It does not write to the database and
+// can be used even if the trie doesn't have one.
+func (t *BinaryTrie) Hash() common.Hash {
+	return binaryHash(t.root)
+}
+
+// Commit writes all modified nodes to the trie's memory database, tracking the
+// internal references between them so they can be garbage collected together.
+func (t *BinaryTrie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
+	root = t.Hash()
+
+	var leaves []*binaryLeaf
+	t.db.lock.Lock()
+	t.commit(t.root, &leaves)
+	t.db.lock.Unlock()
+
+	// Track external references from the leaves outside of the database lock
+	if onleaf != nil {
+		for _, leaf := range leaves {
+			if err := onleaf(leaf.value, *leaf.hash); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+	return root, nil
+}
+
+// commit is the recursive database write of Commit. The children are inserted
+// before their parents to keep the database flush-list ordered.
+//
+// Note, this method assumes that the database's lock is held and that all the
+// hashes have already been calculated!
+func (t *BinaryTrie) commit(n binaryNode, leaves *[]*binaryLeaf) {
+	switch n := n.(type) {
+	case *binaryLeaf:
+		if n.dirty {
+			t.db.insert(*n.hash, n.encode())
+			*leaves = append(*leaves, n)
+			n.dirty = false
+		}
+	case *binaryBranch:
+		if n.dirty {
+			for _, child := range n.children {
+				t.commit(child, leaves)
+			}
+			t.db.insert(*n.hash, n.encode())
+			for _, child := range n.children {
+				if hash := binaryHash(child); hash != (common.Hash{}) {
+					t.db.reference(hash, *n.hash)
+				}
+			}
+			n.dirty = false
+		}
+	}
+}
+
+// Prove constructs a merkle proof for key. The result contains all encoded nodes
+// on the path to the value at key. The value itself is also included in the last
+// node and can be retrieved by verifying the proof.
+//
+// If the trie does not contain a value for key, the returned proof contains all
+// nodes on the path towards the key, ending with either an empty subtrie or a leaf
+// holding a different key, which proves the absence of the key.
+func (t *BinaryTrie) Prove(key []byte, fromLevel uint, proofDb mandb.Putter) error {
+	hkey := crypto.Keccak256Hash(key)
+
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if fromLevel > 0 {
+			fromLevel--
+		} else {
+			var enc []byte
+			switch node := n.(type) {
+			case *binaryLeaf:
+				enc = node.encode()
+			case *binaryBranch:
+				enc = node.encode()
+			}
+			if err := proofDb.Put(binaryHash(n).Bytes(), enc); err != nil {
+				return err
+			}
+		}
+		branch, ok := n.(*binaryBranch)
+		if !ok {
+			break
+		}
+		child, err := t.child(branch, binaryKeyBit(hkey, depth))
+		if err != nil {
+			log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+			return err
+		}
+		n = child
+	}
+	return nil
+}
+
+// VerifyBinaryProof checks merkle proofs of a binary trie. The given proof must
+// contain the value for key in a trie with the given root hash. VerifyBinaryProof
+// returns an error if the proof contains invalid trie nodes or the wrong value.
+func VerifyBinaryProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (value []byte, nodes int, err error) {
+	hkey := crypto.Keccak256Hash(key)
+
+	wantHash := rootHash
+	for i := 0; ; i++ {
+		if wantHash == (common.Hash{}) {
+			// Empty subtrie, the trie doesn't contain the key.
+			return nil, i, nil
+		}
+		buf, _ := proofDb.Get(wantHash[:])
+		if buf == nil {
+			return nil, i, fmt.Errorf("proof node %d (hash %064x) missing", i, wantHash)
+		}
+		if hash := crypto.Keccak256Hash(buf); hash != wantHash {
+			return nil, i, fmt.Errorf("bad proof node %d: hash mismatch", i)
+		}
+		n, err := decodeBinaryNode(wantHash, buf)
+		if err != nil {
+			return nil, i, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		switch n := n.(type) {
+		case *binaryLeaf:
+			if n.key != hkey {
+				// The trie doesn't contain the key.
+				return nil, i + 1, nil
+			}
+			return n.value, i + 1, nil
+		case *binaryBranch:
+			wantHash = binaryHash(n.children[binaryKeyBit(hkey, i)])
+		}
+	}
+}
+
+// binaryKeyBit returns the bit of the hashed key selecting the child at depth.
+func binaryKeyBit(key common.Hash, depth int) int {
+	return int(key[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+// binaryHash returns the hash of a node, calculating and caching it if needed.
+func binaryHash(n binaryNode) common.Hash {
+	switch n := n.(type) {
+	case nil:
+		return common.Hash{}
+	case binaryHashNode:
+		return common.Hash(n)
+	case *binaryLeaf:
+		if n.hash == nil {
+			hash := crypto.Keccak256Hash(n.encode())
+			n.hash = &hash
+		}
+		return *n.hash
+	case *binaryBranch:
+		if n.hash == nil {
+			hash := crypto.Keccak256Hash(n.encode())
+			n.hash = &hash
+		}
+		return *n.hash
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+func (n *binaryLeaf) encode() []byte {
+	enc := make([]byte, 0, 1+common.HashLength+len(n.value))
+	enc = append(enc, binaryLeafPrefix)
+	enc = append(enc, n.key[:]...)
+	return append(enc, n.value...)
+}
+
+func (n *binaryBranch) encode() []byte {
+	enc := make([]byte, 0, 1+2*common.HashLength)
+	enc = append(enc, binaryBranchPrefix)
+	for _, child := range n.children {
+		hash := binaryHash(child)
+		enc = append(enc, hash[:]...)
+	}
+	return enc
+}
+
+// decodeBinaryNode parses the database encoding of a binary trie node.
+func decodeBinaryNode(hash common.Hash, buf []byte) (binaryNode, error) {
+	switch {
+	case len(buf) > 1+common.HashLength && buf[0] == binaryLeafPrefix:
+		return &binaryLeaf{
+			key:   common.BytesToHash(buf[1 : 1+common.HashLength]),
+			value: common.CopyBytes(buf[1+common.HashLength:]),
+			hash:  &hash,
+		}, nil
+
+	case len(buf) == 1+2*common.HashLength && buf[0] == binaryBranchPrefix:
+		branch := &binaryBranch{hash: &hash}
+		for i := range branch.children {
+			child := common.BytesToHash(buf[1+i*common.HashLength : 1+(i+1)*common.HashLength])
+			if child != (common.Hash{}) {
+				branch.children[i] = binaryHashNode(child)
+			}
+		}
+		return branch, nil
+	}
+	return nil, errInvalidBinaryNode
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+func makeBinaryTestData(n int) map[string][]byte {
+	vals := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		vals[fmt.Sprintf("key-%d", i)] = []byte(fmt.Sprintf("value-%d", i))
+	}
+	return vals
+}
+
+func TestBinaryTrieEmpty(t *testing.T) {
+	trie, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	if hash := trie.Hash(); hash != (common.Hash{}) {
+		t.Errorf("empty trie root mismatch: have %x, want zero hash", hash)
+	}
+	if _, err := NewBinary(common.HexToHash("0xdeadbeef"), NewDatabase(mandb.NewMemDatabase())); err == nil {
+		t.Errorf("missing root accepted")
+	} else if _, ok := err.(*MissingNodeError); !ok {
+		t.Errorf("error type mismatch: have %T, want *MissingNodeError", err)
+	}
+}
+
+func TestBinaryTrieOrderIndependence(t *testing.T) {
+	vals := makeBinaryTestData(200)
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	var root common.Hash
+	for i := 0; i < 5; i++ {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+		trie, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+		for _, k := range keys {
+			trie.Update([]byte(k), vals[k])
+		}
+		if i == 0 {
+			root = trie.Hash()
+		} else if hash := trie.Hash(); hash != root {
+			t.Fatalf("run %d: root mismatch: have %x, want %x", i, hash, root)
+		}
+	}
+}
+
+func TestBinaryTrieGetUpdateDelete(t *testing.T) {
+	trie, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	vals := makeBinaryTestData(100)
+	for k, v := range vals {
+		trie.Update([]byte(k), v)
+	}
+	for k, v := range vals {
+		if have := trie.Get([]byte(k)); !bytes.Equal(have, v) {
+			t.Errorf("key %s: value mismatch: have %x, want %x", k, have, v)
+		}
+	}
+	if have := trie.Get([]byte("missing")); have != nil {
+		t.Errorf("missing key: have %x, want nil", have)
+	}
+	// Overwrite a value and make sure the root follows
+	before := trie.Hash()
+	trie.Update([]byte("key-1"), []byte("changed"))
+	if trie.Hash() == before {
+		t.Errorf("root unchanged after update")
+	}
+	trie.Update([]byte("key-1"), vals["key-1"])
+	if hash := trie.Hash(); hash != before {
+		t.Errorf("root mismatch after revert: have %x, want %x", hash, before)
+	}
+	// Deleting everything but one key must yield the single-leaf trie
+	for k := range vals {
+		if k != "key-42" {
+			trie.Delete([]byte(k))
+		}
+	}
+	single, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	single.Update([]byte("key-42"), vals["key-42"])
+	if have, want := trie.Hash(), single.Hash(); have != want {
+		t.Errorf("root mismatch after deletions: have %x, want %x", have, want)
+	}
+	trie.Update([]byte("key-42"), nil)
+	if hash := trie.Hash(); hash != (common.Hash{}) {
+		t.Errorf("root mismatch after deleting all: have %x, want zero hash", hash)
+	}
+}
+
+func TestBinaryTrieCommit(t *testing.T) {
+	diskdb := mandb.NewMemDatabase()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := NewBinary(common.Hash{}, triedb)
+	vals := makeBinaryTestData(100)
+	for k, v := range vals {
+		trie.Update([]byte(k), v)
+	}
+	var leaves int
+	root, err := trie.Commit(func(leaf []byte, parent common.Hash) error {
+		leaves++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if leaves != len(vals) {
+		t.Errorf("leaf callback count mismatch: have %d, want %d", leaves, len(vals))
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to flush trie: %v", err)
+	}
+	// Reload the trie from a clean database and modify it
+	trie, err = NewBinary(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("failed to reopen trie: %v", err)
+	}
+	for k, v := range vals {
+		if have := trie.Get([]byte(k)); !bytes.Equal(have, v) {
+			t.Errorf("key %s: value mismatch: have %x, want %x", k, have, v)
+		}
+	}
+	trie.Delete([]byte("key-7"))
+
+	fresh, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	for k, v := range vals {
+		if k != "key-7" {
+			fresh.Update([]byte(k), v)
+		}
+	}
+	if have, want := trie.Hash(), fresh.Hash(); have != want {
+		t.Errorf("root mismatch after reload: have %x, want %x", have, want)
+	}
+}
+
+func TestBinaryTrieProof(t *testing.T) {
+	trie, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	vals := makeBinaryTestData(500)
+	for k, v := range vals {
+		trie.Update([]byte(k), v)
+	}
+	root := trie.Hash()
+	for k, v := range vals {
+		proofs := mandb.NewMemDatabase()
+		if err := trie.Prove([]byte(k), 0, proofs); err != nil {
+			t.Fatalf("key %s: failed to create proof: %v", k, err)
+		}
+		val, _, err := VerifyBinaryProof(root, []byte(k), proofs)
+		if err != nil {
+			t.Fatalf("key %s: failed to verify proof: %v", k, err)
+		}
+		if !bytes.Equal(val, v) {
+			t.Fatalf("key %s: verified value mismatch: have %x, want %x", k, val, v)
+		}
+	}
+	// Proofs of absence must verify to a nil value
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("missing-%d", i))
+		proofs := mandb.NewMemDatabase()
+		if err := trie.Prove(key, 0, proofs); err != nil {
+			t.Fatalf("key %s: failed to create proof: %v", key, err)
+		}
+		val, _, err := VerifyBinaryProof(root, key, proofs)
+		if err != nil {
+			t.Fatalf("key %s: failed to verify proof: %v", key, err)
+		}
+		if val != nil {
+			t.Fatalf("key %s: absent key verified to %x", key, val)
+		}
+	}
+}
+
+func TestBinaryTrieBadProof(t *testing.T) {
+	trie, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	for k, v := range makeBinaryTestData(100) {
+		trie.Update([]byte(k), v)
+	}
+	root := trie.Hash()
+
+	proofs := mandb.NewMemDatabase()
+	trie.Prove([]byte("key-3"), 0, proofs)
+	for _, key := range proofs.Keys() {
+		val, _ := proofs.Get(key)
+		proofs.Put(key, append(val, 0x00))
+	}
+	if _, _, err := VerifyBinaryProof(root, []byte("key-3"), proofs); err == nil {
+		t.Fatalf("expected proof to fail for tampered nodes")
+	}
+}
+
+// Tests that binary proofs are smaller than their hexary counterparts.
+func TestBinaryTrieProofSize(t *testing.T) {
+	binary, _ := NewBinary(common.Hash{}, NewDatabase(mandb.NewMemDatabase()))
+	hexary := new(Trie)
+
+	vals := makeBinaryTestData(5000)
+	for k, v := range vals {
+		binary.Update([]byte(k), v)
+		hexary.Update([]byte(k), v)
+	}
+	binary.Hash()
+	hexary.Hash()
+
+	proofSize := func(prove func(key []byte, proofDb mandb.Putter) error, key []byte) int {
+		proofs := mandb.NewMemDatabase()
+		if err := prove(key, proofs); err != nil {
+			t.Fatalf("failed to create proof: %v", err)
+		}
+		size := 0
+		for _, key := range proofs.Keys() {
+			val, _ := proofs.Get(key)
+			size += len(val)
+		}
+		return size
+	}
+	var binsize, hexsize int
+	for k := range vals {
+		binsize += proofSize(func(key []byte, db mandb.Putter) error { return binary.Prove(key, 0, db) }, []byte(k))
+		hexsize += proofSize(func(key []byte, db mandb.Putter) error { return hexary.Prove(key, 0, db) }, []byte(k))
+	}
+	if binsize >= hexsize {
+		t.Errorf("binary proofs not smaller: binary %d bytes, hexary %d bytes", binsize, hexsize)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+)
+
+// ConsistencyError describes a single damaged entry found while checking the
+// consistency of a trie.
+type ConsistencyError struct {
+	Hash common.Hash // Hash of the damaged node (or of the closest hashed ancestor)
+	Path []byte      // Hex-encoded path to the damaged node
+	Err  error       // Reason the node was deemed damaged
+}
+
+func (err *ConsistencyError) Error() string {
+	return fmt.Sprintf("trie node %x (path %x): %v", err.Hash, err.Path, err.Err)
+}
+
+// CheckConsistency walks the entire trie rooted at root, verifying that every
+// referenced node is present in the database, that its content hashes to its key
+// and that it can be decoded. The walk does not stop at the first failure; all
+// damaged nodes are reported, with the subtries below them skipped.
+//
+// If onleaf is set, it is invoked for every leaf reached so callers can extend
+// the check into tries referenced from the leaves. Any error returned by the
+// callback is reported at the leaf's position.
+func CheckConsistency(db *Database, root common.Hash, onleaf LeafCallback) []*ConsistencyError {
+	if root == (common.Hash{}) || root == emptyRoot {
+		return nil
+	}
+	c := &consistencyChecker{db: db, onleaf: onleaf}
+	c.checkHash(root, nil)
+	return c.errs
+}
+
+// consistencyChecker accumulates the failures found during a consistency walk.
+type consistencyChecker struct {
+	db     *Database
+	onleaf LeafCallback
+	errs   []*ConsistencyError
+}
+
+// checkHash retrieves the node referenced by hash, validates it and descends
+// into its children.
+func (c *consistencyChecker) checkHash(hash common.Hash, path []byte) {
+	blob, err := c.db.Node(hash)
+	if err != nil || len(blob) == 0 {
+		c.fail(hash, path, &MissingNodeError{NodeHash: hash, Path: path})
+		return
+	}
+	if have := crypto.Keccak256Hash(blob); have != hash {
+		c.fail(hash, path, fmt.Errorf("content hash mismatch: have %x", have))
+		return
+	}
+	n, err := decodeNode(hash[:], blob, 0)
+	if err != nil {
+		c.fail(hash, path, err)
+		return
+	}
+	c.checkNode(hash, n, path)
+}
+
+// checkNode descends into an already resolved node, parent being the hash of the
+// closest ancestor stored standalone in the database.
+func (c *consistencyChecker) checkNode(parent common.Hash, n node, path []byte) {
+	switch n := n.(type) {
+	case *shortNode:
+		c.checkNode(parent, n.Val, concat(path, n.Key...))
+	case *fullNode:
+		for i, child := range &n.Children {
+			if child != nil {
+				c.checkNode(parent, child, concat(path, byte(i)))
+			}
+		}
+	case hashNode:
+		c.checkHash(common.BytesToHash(n), path)
+	case valueNode:
+		if c.onleaf != nil {
+			if err := c.onleaf(n, parent); err != nil {
+				c.fail(parent, path, err)
+			}
+		}
+	}
+}
+
+// fail records a damaged node, copying the path as it may be reused by the walk.
+func (c *consistencyChecker) fail(hash common.Hash, path []byte, err error) {
+	c.errs = append(c.errs, &ConsistencyError{Hash: hash, Path: common.CopyBytes(path), Err: err})
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// makeConsistencyTestTrie creates a trie persisted into a memory database.
+func makeConsistencyTestTrie() (*mandb.MemDatabase, common.Hash) {
+	diskdb := mandb.NewMemDatabase()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(common.Hash{}, triedb)
+	for i := 0; i < 256; i++ {
+		trie.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+	triedb.Commit(root, false)
+	return diskdb, root
+}
+
+func TestCheckConsistencyIntact(t *testing.T) {
+	diskdb, root := makeConsistencyTestTrie()
+
+	leaves := 0
+	damaged := CheckConsistency(NewDatabase(diskdb), root, func(leaf []byte, parent common.Hash) error {
+		leaves++
+		return nil
+	})
+	if len(damaged) != 0 {
+		t.Fatalf("intact trie reported damaged: %v", damaged)
+	}
+	if leaves != 256 {
+		t.Fatalf("leaf count mismatch: have %d, want %d", leaves, 256)
+	}
+	if damaged := CheckConsistency(NewDatabase(diskdb), emptyRoot, nil); len(damaged) != 0 {
+		t.Fatalf("empty trie reported damaged: %v", damaged)
+	}
+}
+
+func TestCheckConsistencyMissing(t *testing.T) {
+	diskdb, root := makeConsistencyTestTrie()
+
+	for _, key := range diskdb.Keys() {
+		hash := common.BytesToHash(key)
+		if hash == root {
+			continue
+		}
+		blob, _ := diskdb.Get(key)
+		diskdb.Delete(key)
+
+		damaged := CheckConsistency(NewDatabase(diskdb), root, nil)
+		if len(damaged) != 1 {
+			t.Fatalf("node %x: damaged count mismatch: have %d, want 1", hash, len(damaged))
+		}
+		if _, ok := damaged[0].Err.(*MissingNodeError); !ok || damaged[0].Hash != hash {
+			t.Fatalf("node %x: unexpected report: %v", hash, damaged[0])
+		}
+		diskdb.Put(key, blob)
+	}
+}
+
+func TestCheckConsistencyCorrupt(t *testing.T) {
+	diskdb, root := makeConsistencyTestTrie()
+
+	for _, key := range diskdb.Keys() {
+		hash := common.BytesToHash(key)
+		blob, _ := diskdb.Get(key)
+		diskdb.Put(key, append(common.CopyBytes(blob), 0x00))
+
+		damaged := CheckConsistency(NewDatabase(diskdb), root, nil)
+		if len(damaged) != 1 || damaged[0].Hash != hash {
+			t.Fatalf("node %x: unexpected report: %v", hash, damaged)
+		}
+		diskdb.Put(key, blob)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// makeTestTrieRoots creates a number of tries sharing most of their content and
+// commits them into the given memory database, returning the roots.
+func makeTestTrieRoots(triedb *Database, n int) []common.Hash {
+	trie, _ := New(common.Hash{}, triedb)
+	roots := make([]common.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < 32; j++ {
+			trie.Update([]byte(fmt.Sprintf("key-%d-%d", i, j)), []byte(fmt.Sprintf("value-%d-%d", i, j)))
+		}
+		root, err := trie.Commit(nil)
+		if err != nil {
+			panic(err)
+		}
+		triedb.Reference(root, common.Hash{})
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// Tests that dereferencing all roots tracked by the memory database garbage
+// collects every cached node.
+func TestDatabaseDereference(t *testing.T) {
+	triedb := NewDatabase(mandb.NewMemDatabase())
+	roots := makeTestTrieRoots(triedb, 8)
+
+	if len(triedb.Nodes()) == 0 {
+		t.Fatalf("no nodes cached after trie commits")
+	}
+	for i, root := range roots {
+		triedb.Dereference(root)
+
+		// All later roots must still be fully resolvable
+		for _, live := range roots[i+1:] {
+			if _, err := New(live, triedb); err != nil {
+				t.Fatalf("root %x unavailable after dereferencing %x: %v", live, root, err)
+			}
+		}
+	}
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("dangling nodes after full dereference: have %d, want 0", len(nodes))
+	}
+	if size := triedb.Size(); size != 0 {
+		t.Fatalf("dangling storage after full dereference: have %v, want 0", size)
+	}
+}
+
+// Tests that capping the memory database flushes the oldest nodes to disk while
+// keeping every referenced trie accessible.
+func TestDatabaseCap(t *testing.T) {
+	diskdb := mandb.NewMemDatabase()
+	triedb := NewDatabase(diskdb)
+	roots := makeTestTrieRoots(triedb, 8)
+
+	size := triedb.Size()
+	if err := triedb.Cap(size / 2); err != nil {
+		t.Fatalf("failed to cap memory database: %v", err)
+	}
+	if have := triedb.Size(); have > size/2 {
+		t.Fatalf("memory database not capped: have %v, want <= %v", have, size/2)
+	}
+	if diskdb.Len() == 0 {
+		t.Fatalf("no nodes flushed to disk")
+	}
+	for _, root := range roots {
+		trie, err := New(root, triedb)
+		if err != nil {
+			t.Fatalf("root %x unavailable after cap: %v", root, err)
+		}
+		it := trie.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if it.Error() != nil {
+			t.Fatalf("root %x not fully resolvable after cap: %v", root, it.Error())
+		}
+	}
+	// Dereferencing after a partial flush must not corrupt the flush-list
+	for _, root := range roots {
+		triedb.Dereference(root)
+	}
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("dangling nodes after full dereference: have %d, want 0", len(nodes))
+	}
+}
+
+// Tests that secure trie key preimages are only recorded if enabled, and that
+// they remain retrievable after being flushed to disk.
+func TestDatabasePreimages(t *testing.T) {
+	for _, record := range []bool{true, false} {
+		diskdb := mandb.NewMemDatabase()
+		triedb := NewDatabaseWithConfig(diskdb, &Config{Preimages: record})
+
+		trie, _ := NewSecure(common.Hash{}, triedb, 0)
+		trie.Update([]byte("foo"), []byte("bar"))
+		root, _ := trie.Commit(nil)
+
+		hash := common.BytesToHash(trie.hashKey([]byte("foo")))
+		if preimage, _ := triedb.Preimage(hash); record != (string(preimage) == "foo") {
+			t.Errorf("record %v: cached preimage mismatch: have %q", record, preimage)
+		}
+		if err := triedb.Commit(root, false); err != nil {
+			t.Fatalf("record %v: failed to commit trie: %v", record, err)
+		}
+		if preimage, _ := triedb.Preimage(hash); record != (string(preimage) == "foo") {
+			t.Errorf("record %v: persisted preimage mismatch: have %q", record, preimage)
+		}
+	}
+}
+
+// Tests that a read-only database resolves tries already on disk and keeps new
+// nodes in memory, but never writes anything to the disk database.
+func TestDatabaseReadOnly(t *testing.T) {
+	diskdb := mandb.NewMemDatabase()
+	writer := NewDatabase(diskdb)
+	roots := makeTestTrieRoots(writer, 1)
+	if err := writer.Commit(roots[0], false); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	stored := diskdb.Len()
+
+	triedb := NewDatabaseWithConfig(diskdb, &Config{Preimages: true, ReadOnly: true})
+	trie, err := New(roots[0], triedb)
+	if err != nil {
+		t.Fatalf("failed to open persisted trie: %v", err)
+	}
+	trie.Update([]byte("key-new"), []byte("value-new"))
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie into memory: %v", err)
+	}
+	if _, err := New(root, triedb); err != nil {
+		t.Fatalf("in-memory trie unavailable: %v", err)
+	}
+	if err := triedb.Cap(0); err != ErrReadOnly {
+		t.Errorf("cap error mismatch: have %v, want %v", err, ErrReadOnly)
+	}
+	if err := triedb.Commit(root, false); err != ErrReadOnly {
+		t.Errorf("commit error mismatch: have %v, want %v", err, ErrReadOnly)
+	}
+	if diskdb.Len() != stored {
+		t.Errorf("disk database modified: have %d items, want %d", diskdb.Len(), stored)
+	}
+}
@@ -17,11 +17,16 @@
 package trie
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/matrix/go-matrix/common"
 )
 
+// ErrReadOnly is returned if a read-only trie database is asked to flush its
+// content to disk.
+var ErrReadOnly = errors.New("trie database is read-only")
+
 // MissingNodeError is returned by the trie functions (TryGet, TryUpdate, TryDelete)
 // in the case where a trie node is not present in the local database. It contains
 // information necessary for retrieving the missing node.
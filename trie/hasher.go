@@ -29,6 +29,7 @@ import (
 type hasher struct {
 	tmp        *bytes.Buffer
 	sha        hash.Hash
+	enc        []byte // encoding of the node last passed to store, valid until the next call
 	cachegen   uint16
 	cachelimit uint16
 	onleaf     LeafCallback
@@ -48,6 +49,7 @@ func newHasher(cachegen, cachelimit uint16, onleaf LeafCallback) *hasher {
 }
 
 func returnHasherToPool(h *hasher) {
+	h.enc, h.onleaf = nil, nil
 	hasherPool.Put(h)
 }
 
@@ -81,15 +83,21 @@ func (h *hasher) hash(n node, db *Database, force bool) (node, node, error) {
 	// Cache the hash of the node for later reuse and remove
 	// the dirty flag in commit mode. It's fine to assign these values directly
 	// without copying the node first because hashChildren copies it.
+	//
+	// When only hashing, the encoding is retained too so that a subsequent
+	// commit doesn't need to encode the node again. Once the node is stored
+	// the database holds the blob and the cached copy is dropped.
 	cachedHash, _ := hashed.(hashNode)
 	switch cn := cached.(type) {
 	case *shortNode:
 		cn.flags.hash = cachedHash
+		cn.flags.enc = h.cacheEncoding(cn.flags.enc, cachedHash, db)
 		if db != nil {
 			cn.flags.dirty = false
 		}
 	case *fullNode:
 		cn.flags.hash = cachedHash
+		cn.flags.enc = h.cacheEncoding(cn.flags.enc, cachedHash, db)
 		if db != nil {
 			cn.flags.dirty = false
 		}
@@ -97,6 +105,19 @@ func (h *hasher) hash(n node, db *Database, force bool) (node, node, error) {
 	return hashed, cached, nil
 }
 
+// cacheEncoding returns the encoding a hashed node should retain, given the one
+// it already had: nothing in commit mode or for embedded nodes, otherwise a copy
+// of the encoding produced by the last store, unless the node already had it.
+func (h *hasher) cacheEncoding(enc []byte, hash hashNode, db *Database) []byte {
+	if db != nil || hash == nil {
+		return nil
+	}
+	if enc == nil {
+		enc = common.CopyBytes(h.enc)
+	}
+	return enc
+}
+
 // hashChildren replaces the children of a node with their hashes if the encoded
 // size of the child is larger than a hash, returning the collapsed node as well
 // as a replacement for the original node with the child hashes cached in.
@@ -153,21 +174,28 @@ func (h *hasher) hashChildren(original node, db *Database) (node, node, error) {
 func (h *hasher) store(n node, db *Database, force bool) (node, error) {
 	// Don't store hashes or empty nodes.
 	if _, isHash := n.(hashNode); n == nil || isHash {
+		h.enc = nil
 		return n, nil
 	}
-	// Generate the RLP encoding of the node
-	h.tmp.Reset()
-	if err := rlp.Encode(h.tmp, n); err != nil {
-		panic("encode error: " + err.Error())
+	// Generate the RLP encoding of the node, unless it was retained when the
+	// node was last hashed
+	h.enc = cachedEncoding(n)
+	retained := h.enc != nil
+	if !retained {
+		h.tmp.Reset()
+		if err := rlp.Encode(h.tmp, n); err != nil {
+			panic("encode error: " + err.Error())
+		}
+		h.enc = h.tmp.Bytes()
 	}
-	if h.tmp.Len() < 32 && !force {
+	if len(h.enc) < 32 && !force {
 		return n, nil // Nodes smaller than 32 bytes are stored inside their parent
 	}
 	// Larger nodes are replaced by their hash and stored in the database.
 	hash, _ := n.cache()
 	if hash == nil {
 		h.sha.Reset()
-		h.sha.Write(h.tmp.Bytes())
+		h.sha.Write(h.enc)
 		hash = hashNode(h.sha.Sum(nil))
 	}
 	if db != nil {
@@ -175,7 +203,11 @@ func (h *hasher) store(n node, db *Database, force bool) (node, error) {
 		db.lock.Lock()
 
 		hash := common.BytesToHash(hash)
-		db.insert(hash, h.tmp.Bytes())
+		if retained {
+			db.adopt(hash, h.enc) // Retained encodings are never modified, no need to copy
+		} else {
+			db.insert(hash, h.enc)
+		}
 
 		// Track all direct parent->child node references
 		switch n := n.(type) {
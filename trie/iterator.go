@@ -22,7 +22,6 @@ import (
 	"errors"
 
 	"github.com/matrix/go-matrix/common"
-	"github.com/matrix/go-matrix/rlp"
 )
 
 // Iterator is a key-value trie iterator that traverses a Trie.
@@ -100,6 +99,34 @@ type NodeIterator interface {
 	// iterator is not positioned at a leaf. Callers must not retain references
 	// to the value after calling Next.
 	LeafProof() [][]byte
+
+	// Seek repositions the iterator so that the next call to Next returns the
+	// first node whose path is equal to or greater than the given key.
+	Seek(key []byte) error
+}
+
+// errInvalidPosition is returned when a serialized iterator position cannot be
+// decoded back into a trie path.
+var errInvalidPosition = errors.New("invalid iterator position")
+
+// IteratorPosition returns a serialized checkpoint of the node the iterator is
+// currently positioned on. The checkpoint can be persisted and later passed to
+// NodeIteratorAt to resume the iteration right after this node.
+func IteratorPosition(it NodeIterator) []byte {
+	return hexToCompact(it.Path())
+}
+
+// decodeIteratorPosition converts a serialized iterator checkpoint back into
+// the hex-encoded path of the node it was taken at.
+func decodeIteratorPosition(pos []byte) ([]byte, error) {
+	if len(pos) == 0 {
+		return nil, errInvalidPosition
+	}
+	flag, odd := pos[0]>>4, pos[0]>>4&1 == 1
+	if flag > 3 || (!odd && pos[0]&0x0f != 0) {
+		return nil, errInvalidPosition
+	}
+	return compactToHex(pos), nil
 }
 
 // nodeIteratorState represents the iteration state at one particular node of the
@@ -124,8 +151,9 @@ var errIteratorEnd = errors.New("end of iteration")
 
 // seekError is stored in nodeIterator.err if the initial seek has failed.
 type seekError struct {
-	key []byte
-	err error
+	path  []byte // Hex-encoded path being sought
+	after bool   // Whether to stop after the node at path instead of before it
+	err   error
 }
 
 func (e seekError) Error() string {
@@ -141,6 +169,19 @@ func newNodeIterator(trie *Trie, start []byte) NodeIterator {
 	return it
 }
 
+func newNodeIteratorAt(trie *Trie, pos []byte) (NodeIterator, error) {
+	path, err := decodeIteratorPosition(pos)
+	if err != nil {
+		return nil, err
+	}
+	if trie.Hash() == emptyState {
+		return new(nodeIterator), nil
+	}
+	it := &nodeIterator{trie: trie}
+	it.err = it.seekPath(path, true)
+	return it, nil
+}
+
 func (it *nodeIterator) Hash() common.Hash {
 	if len(it.stack) == 0 {
 		return common.Hash{}
@@ -181,6 +222,7 @@ func (it *nodeIterator) LeafProof() [][]byte {
 	if len(it.stack) > 0 {
 		if _, ok := it.stack[len(it.stack)-1].node.(valueNode); ok {
 			hasher := newHasher(0, 0, nil)
+			defer returnHasherToPool(hasher)
 			proofs := make([][]byte, 0, len(it.stack))
 
 			for i, item := range it.stack[:len(it.stack)-1] {
@@ -188,8 +230,7 @@ func (it *nodeIterator) LeafProof() [][]byte {
 				node, _, _ := hasher.hashChildren(item.node, nil)
 				hashed, _ := hasher.store(node, nil, false)
 				if _, ok := hashed.(hashNode); ok || i == 0 {
-					enc, _ := rlp.EncodeToBytes(node)
-					proofs = append(proofs, enc)
+					proofs = append(proofs, common.CopyBytes(hasher.enc))
 				}
 			}
 			return proofs
@@ -221,7 +262,7 @@ func (it *nodeIterator) Next(descend bool) bool {
 		return false
 	}
 	if seek, ok := it.err.(seekError); ok {
-		if it.err = it.seek(seek.key); it.err != nil {
+		if it.err = it.seekPath(seek.path, seek.after); it.err != nil {
 			return false
 		}
 	}
@@ -235,18 +276,37 @@ func (it *nodeIterator) Next(descend bool) bool {
 	return true
 }
 
+// Seek discards the current iteration state and moves the iterator just before
+// the closest match to key, so the next call to Next returns it.
+func (it *nodeIterator) Seek(key []byte) error {
+	if it.trie == nil {
+		// Iterators over empty tries have nothing to seek to
+		return it.Error()
+	}
+	it.stack, it.path = nil, nil
+	it.err = it.seek(key)
+	return it.Error()
+}
+
 func (it *nodeIterator) seek(prefix []byte) error {
 	// The path we're looking for is the hex encoded key without terminator.
 	key := keybytesToHex(prefix)
 	key = key[:len(key)-1]
-	// Move forward until we're just before the closest match to key.
+	return it.seekPath(key, false)
+}
+
+// seekPath moves the iterator forward until it's just before the closest match
+// to the hex-encoded path. If after is set, the node at path itself is consumed
+// too, so iteration continues with whatever follows it.
+func (it *nodeIterator) seekPath(key []byte, after bool) error {
 	for {
 		state, parentIndex, path, err := it.peek(bytes.HasPrefix(key, it.path))
 		if err == errIteratorEnd {
 			return errIteratorEnd
 		} else if err != nil {
-			return seekError{prefix, err}
-		} else if bytes.Compare(path, key) >= 0 {
+			return seekError{key, after, err}
+		}
+		if cmp := bytes.Compare(path, key); cmp > 0 || (cmp == 0 && !after) {
 			return nil
 		}
 		it.push(state, parentIndex, path)
@@ -460,6 +520,19 @@ func (it *differenceIterator) Next(bool) bool {
 	}
 }
 
+// Seek repositions both underlying iterators at key, restoring the invariant
+// that a is always one step ahead of b.
+func (it *differenceIterator) Seek(key []byte) error {
+	if err := it.a.Seek(key); err != nil {
+		return err
+	}
+	if err := it.b.Seek(key); err != nil {
+		return err
+	}
+	it.eof = !it.a.Next(true)
+	return nil
+}
+
 func (it *differenceIterator) Error() error {
 	if err := it.a.Error(); err != nil {
 		return err
@@ -481,6 +554,7 @@ func (h *nodeIteratorHeap) Pop() interface{} {
 }
 
 type unionIterator struct {
+	iters []NodeIterator    // Source iterators, retained to allow seeking
 	items *nodeIteratorHeap // Nodes returned are the union of the ones in these iterators
 	count int               // Number of nodes scanned across all tries
 }
@@ -493,7 +567,7 @@ func NewUnionIterator(iters []NodeIterator) (NodeIterator, *int) {
 	copy(h, iters)
 	heap.Init(&h)
 
-	ui := &unionIterator{items: &h}
+	ui := &unionIterator{iters: iters, items: &h}
 	return ui, &ui.count
 }
 
@@ -565,6 +639,21 @@ func (it *unionIterator) Next(descend bool) bool {
 	return len(*it.items) > 0
 }
 
+// Seek repositions every source iterator at key and rebuilds the heap, which
+// also brings back any iterators that were exhausted before the seek.
+func (it *unionIterator) Seek(key []byte) error {
+	h := make(nodeIteratorHeap, 0, len(it.iters))
+	for _, sub := range it.iters {
+		if err := sub.Seek(key); err != nil {
+			return err
+		}
+		h = append(h, sub)
+	}
+	heap.Init(&h)
+	it.items = &h
+	return nil
+}
+
 func (it *unionIterator) Error() error {
 	for i := 0; i < len(*it.items); i++ {
 		if err := (*it.items)[i].Error(); err != nil {
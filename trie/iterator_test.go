@@ -175,6 +175,70 @@ func TestIteratorSeek(t *testing.T) {
 	if err := checkIteratorOrder(nil, it); err != nil {
 		t.Fatal(err)
 	}
+
+	// Reposition an already advanced iterator.
+	nodeIt := trie.NodeIterator(nil)
+	for i := 0; i < 5; i++ {
+		nodeIt.Next(true)
+	}
+	if err := nodeIt.Seek([]byte("fab")); err != nil {
+		t.Fatalf("failed to seek iterator: %v", err)
+	}
+	if err := checkIteratorOrder(testdata1[4:], NewIterator(nodeIt)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIteratorResume(t *testing.T) {
+	triedb := NewDatabase(mandb.NewMemDatabase())
+	tr, _ := New(common.Hash{}, triedb)
+	for i := 0; i < 500; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, _ := tr.Commit(nil)
+	tr, _ = New(root, triedb)
+
+	// Collect the full iteration order for reference
+	var paths [][]byte
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		paths = append(paths, common.CopyBytes(it.Path()))
+	}
+	// Checkpoint the iteration at various nodes and resume from a fresh trie
+	for i := 0; i < len(paths); i += 37 {
+		it := tr.NodeIterator(nil)
+		for j := 0; j <= i; j++ {
+			it.Next(true)
+		}
+		pos := IteratorPosition(it)
+
+		fresh, _ := New(root, triedb)
+		resumed, err := fresh.NodeIteratorAt(pos)
+		if err != nil {
+			t.Fatalf("node %d: failed to resume iterator: %v", i, err)
+		}
+		j := i + 1
+		for ; resumed.Next(true); j++ {
+			if j >= len(paths) {
+				t.Fatalf("node %d: resumed iterator returned extra node %x", i, resumed.Path())
+			}
+			if !bytes.Equal(resumed.Path(), paths[j]) {
+				t.Fatalf("node %d: resumed path mismatch at %d: have %x, want %x", i, j, resumed.Path(), paths[j])
+			}
+		}
+		if resumed.Error() != nil {
+			t.Fatalf("node %d: resumed iterator failed: %v", i, resumed.Error())
+		}
+		if j != len(paths) {
+			t.Fatalf("node %d: resumed iterator ended early at %d, want %d", i, j, len(paths))
+		}
+	}
+	// Corrupt positions must be rejected
+	if _, err := tr.NodeIteratorAt(nil); err == nil {
+		t.Fatalf("empty position accepted")
+	}
+	if _, err := tr.NodeIteratorAt([]byte{0x45}); err == nil {
+		t.Fatalf("invalid position flag accepted")
+	}
 }
 
 func checkIteratorOrder(want []kvs, it *Iterator) error {
@@ -276,6 +340,54 @@ func TestUnionIterator(t *testing.T) {
 	}
 }
 
+func TestDifferenceIteratorSeek(t *testing.T) {
+	triea, trieb := newEmpty(), newEmpty()
+	for _, val := range testdata1 {
+		triea.Update([]byte(val.k), []byte(val.v))
+	}
+	for _, val := range testdata2 {
+		trieb.Update([]byte(val.k), []byte(val.v))
+	}
+	triea.Commit(nil)
+	trieb.Commit(nil)
+
+	// Exhaust the iterator first to ensure seeking fully resets it
+	di, _ := NewDifferenceIterator(triea.NodeIterator(nil), trieb.NodeIterator(nil))
+	for di.Next(true) {
+	}
+	if err := di.Seek([]byte("bar")); err != nil {
+		t.Fatalf("failed to seek difference iterator: %v", err)
+	}
+	want := []kvs{{"barb", "bd"}, {"bars", "be"}, {"jars", "d"}}
+	if err := checkIteratorOrder(want, NewIterator(di)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnionIteratorSeek(t *testing.T) {
+	triea, trieb := newEmpty(), newEmpty()
+	for _, val := range testdata1 {
+		triea.Update([]byte(val.k), []byte(val.v))
+	}
+	for _, val := range testdata2 {
+		trieb.Update([]byte(val.k), []byte(val.v))
+	}
+	triea.Commit(nil)
+	trieb.Commit(nil)
+
+	// Exhaust the iterator first to ensure seeking brings back all sources
+	ui, _ := NewUnionIterator([]NodeIterator{triea.NodeIterator(nil), trieb.NodeIterator(nil)})
+	for ui.Next(true) {
+	}
+	if err := ui.Seek([]byte("f")); err != nil {
+		t.Fatalf("failed to seek union iterator: %v", err)
+	}
+	want := []kvs{{"fab", "z"}, {"food", "ab"}, {"foos", "aa"}, {"foo", "a"}, {"jars", "d"}}
+	if err := checkIteratorOrder(want, NewIterator(ui)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestIteratorNoDups(t *testing.T) {
 	var tr Trie
 	for _, val := range testdata1 {
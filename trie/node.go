@@ -58,6 +58,7 @@ func (n *shortNode) copy() *shortNode { copy := *n; return &copy }
 // nodeFlag contains caching-related metadata about a node.
 type nodeFlag struct {
 	hash  hashNode // cached hash of the node (may be nil)
+	enc   []byte   // cached encoding of the collapsed node, valid as long as hash is (may be nil)
 	gen   uint16   // cache generation counter
 	dirty bool     // whether the node has changes that must be written to the database
 }
@@ -77,6 +78,18 @@ func (n *shortNode) cache() (hashNode, bool) { return n.flags.hash, n.flags.dirt
 func (n hashNode) cache() (hashNode, bool)   { return nil, true }
 func (n valueNode) cache() (hashNode, bool)  { return nil, true }
 
+// cachedEncoding returns the encoding of the collapsed node retained from the
+// last time it was hashed, or nil if there is none.
+func cachedEncoding(n node) []byte {
+	switch n := n.(type) {
+	case *fullNode:
+		return n.flags.enc
+	case *shortNode:
+		return n.flags.enc
+	}
+	return nil
+}
+
 // Pretty printing.
 func (n *fullNode) String() string  { return n.fstring("") }
 func (n *shortNode) String() string { return n.fstring("") }
@@ -16,7 +16,11 @@
 
 package trie
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/matrix/go-matrix/mandb"
+)
 
 func TestCanUnload(t *testing.T) {
 	tests := []struct {
@@ -56,3 +60,23 @@ func TestCanUnload(t *testing.T) {
 		}
 	}
 }
+
+// FuzzDecodeNode checks that arbitrary node encodings, as delivered in proofs by
+// a malicious peer, are rejected with an error instead of crashing the decoder.
+func FuzzDecodeNode(f *testing.F) {
+	trie, vals := randomTrie(0)
+	for _, entry := range sortedEntries(vals)[:4] {
+		proof := mandb.NewMemDatabase()
+		trie.Prove(entry.k, 0, proof)
+		for _, key := range proof.Keys() {
+			node, _ := proof.Get(key)
+			f.Add(node)
+		}
+	}
+	f.Add([]byte{0xc2, 0x80, 0x80}) // short node with an empty key
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		if n, err := decodeNode(nil, buf, 0); err == nil && n == nil {
+			t.Fatalf("decoded nil node without error")
+		}
+	})
+}
@@ -20,12 +20,14 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/matrix/go-matrix/common"
 	"github.com/matrix/go-matrix/crypto"
 	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
 )
 
 func init() {
@@ -216,3 +218,252 @@ func randBytes(n int) []byte {
 	crand.Read(r)
 	return r
 }
+
+// sortedEntries returns the entries of a random trie in ascending key order.
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+// rangeProof creates the edge proofs for a range of a trie.
+func rangeProof(trie *Trie, first, last []byte) *mandb.MemDatabase {
+	proof := mandb.NewMemDatabase()
+	trie.Prove(first, 0, proof)
+	trie.Prove(last, 0, proof)
+	return proof
+}
+
+// increaseKey returns the key following the given one.
+func increaseKey(key []byte) []byte {
+	key = common.CopyBytes(key)
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i]++; key[i] != 0x00 {
+			break
+		}
+	}
+	return key
+}
+
+// decreaseKey returns the key preceding the given one.
+func decreaseKey(key []byte) []byte {
+	key = common.CopyBytes(key)
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i]--; key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}
+
+// Tests that random ranges with existent edge proofs are verified correctly.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(2048)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys, values = append(keys, entry.k), append(values, entry.v)
+		}
+		proof := rangeProof(trie, keys[0], keys[len(keys)-1])
+		more, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, values, proof)
+		if err != nil {
+			t.Fatalf("range [%d, %d): failed to verify proof: %v", start, end, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("range [%d, %d): more entries mismatch: have %v, want %v", start, end, more, end < len(entries))
+		}
+	}
+}
+
+// Tests that random ranges with absence proofs for the edges are verified
+// correctly.
+func TestRangeProofWithAbsentEdges(t *testing.T) {
+	trie, vals := randomTrie(2048)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 1 + mrand.Intn(len(entries)-start)
+
+		first, last := decreaseKey(entries[start].k), increaseKey(entries[end-1].k)
+		if start != 0 && bytes.Equal(first, entries[start-1].k) {
+			continue
+		}
+		if end != len(entries) && bytes.Equal(last, entries[end].k) {
+			continue
+		}
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys, values = append(keys, entry.k), append(values, entry.v)
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, rangeProof(trie, first, last)); err != nil {
+			t.Fatalf("range [%d, %d): failed to verify proof: %v", start, end, err)
+		}
+	}
+}
+
+// Tests that ranges with missing, modified or moved leaves are rejected.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(2048)
+	entries := sortedEntries(vals)
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + 3 + mrand.Intn(len(entries)-start)
+		if end > len(entries) {
+			continue
+		}
+		var keys, values [][]byte
+		for _, entry := range entries[start:end] {
+			keys, values = append(keys, entry.k), append(values, common.CopyBytes(entry.v))
+		}
+		first, last := keys[0], keys[len(keys)-1]
+
+		index := 1 + mrand.Intn(len(keys)-2)
+		switch i % 3 {
+		case 0: // Drop an inner leaf
+			keys = append(keys[:index:index], keys[index+1:]...)
+			values = append(values[:index:index], values[index+1:]...)
+		case 1: // Modify a leaf value
+			values[index] = append(values[index], 0x01)
+		case 2: // Move a leaf key
+			keys[index] = increaseKey(keys[index])
+			if bytes.Compare(keys[index], keys[index+1]) >= 0 {
+				continue
+			}
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, rangeProof(trie, first, last)); err == nil {
+			t.Fatalf("range [%d, %d), case %d: expected proof to fail", start, end, i%3)
+		}
+	}
+}
+
+// Tests the special cases of proofs covering the entire trie and proofs
+// covering no leaves at all.
+func TestRangeProofSpecialCases(t *testing.T) {
+	trie, vals := randomTrie(1024)
+	entries := sortedEntries(vals)
+
+	var keys, values [][]byte
+	for _, entry := range entries {
+		keys, values = append(keys, entry.k), append(values, entry.v)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys, values, nil); err != nil {
+		t.Fatalf("failed to verify full range without proof: %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatalf("expected partial range without proof to fail")
+	}
+	// Proving absence past the last entry must succeed, before it must fail
+	last := increaseKey(entries[len(entries)-1].k)
+	if _, err := VerifyRangeProof(trie.Hash(), last, nil, nil, nil, rangeProof(trie, last, last)); err != nil {
+		t.Fatalf("failed to verify empty trailing range: %v", err)
+	}
+	first := decreaseKey(entries[len(entries)/2].k)
+	if _, err := VerifyRangeProof(trie.Hash(), first, nil, nil, nil, rangeProof(trie, first, first)); err == nil {
+		t.Fatalf("expected empty range with entries remaining to fail")
+	}
+	// Single element ranges must report the remaining entries
+	proof := rangeProof(trie, keys[0], keys[0])
+	more, err := VerifyRangeProof(trie.Hash(), keys[0], keys[0], keys[:1], values[:1], proof)
+	if err != nil {
+		t.Fatalf("failed to verify single element range: %v", err)
+	}
+	if !more {
+		t.Fatalf("single element range reported no more entries")
+	}
+}
+
+// encodeProof flattens a proof into the concatenated nodes consumed by the proof
+// fuzzers, starting with the root node.
+func encodeProof(root common.Hash, proof *mandb.MemDatabase) []byte {
+	blob, _ := proof.Get(root[:])
+	for _, key := range proof.Keys() {
+		if !bytes.Equal(key, root[:]) {
+			node, _ := proof.Get(key)
+			blob = append(blob, node...)
+		}
+	}
+	return blob
+}
+
+// decodeProof splits a fuzzer input into proof nodes, returning the hash of the
+// first one as the root. Trailing garbage is ignored.
+func decodeProof(blob []byte) (common.Hash, *mandb.MemDatabase) {
+	var (
+		root  common.Hash
+		proof = mandb.NewMemDatabase()
+	)
+	for len(blob) > 0 {
+		_, _, rest, err := rlp.Split(blob)
+		if err != nil {
+			break
+		}
+		node := blob[:len(blob)-len(rest)]
+		hash := crypto.Keccak256(node)
+		if proof.Len() == 0 {
+			root = common.BytesToHash(hash)
+		}
+		proof.Put(hash, node)
+		blob = rest
+	}
+	return root, proof
+}
+
+// FuzzVerifyProof checks that arbitrary proofs, as delivered by a malicious peer,
+// are rejected with an error instead of crashing the verifier.
+func FuzzVerifyProof(f *testing.F) {
+	trie, vals := randomTrie(0)
+	for _, entry := range sortedEntries(vals)[:16] {
+		proof := mandb.NewMemDatabase()
+		trie.Prove(entry.k, 0, proof)
+		f.Add(encodeProof(trie.Hash(), proof), entry.k)
+	}
+	f.Fuzz(func(t *testing.T, blob []byte, key []byte) {
+		root, proof := decodeProof(blob)
+		value, _, err := VerifyProof(root, key, proof)
+		if err != nil && value != nil {
+			t.Fatalf("failed proof returned value %x", value)
+		}
+	})
+}
+
+// FuzzVerifyRangeProof checks that arbitrary range proofs and leaves are rejected
+// with an error instead of crashing the verifier. The leaves are encoded as an RLP
+// list of key-value pairs.
+func FuzzVerifyRangeProof(f *testing.F) {
+	trie, vals := randomTrie(0)
+	entries := sortedEntries(vals)
+	for _, span := range [][2]int{{0, 1}, {3, 9}, {40, 41}, {60, 100}} {
+		var leaves [][][]byte
+		for _, entry := range entries[span[0]:span[1]] {
+			leaves = append(leaves, [][]byte{entry.k, entry.v})
+		}
+		enc, _ := rlp.EncodeToBytes(leaves)
+		proof := rangeProof(trie, entries[span[0]].k, entries[span[1]-1].k)
+		f.Add(encodeProof(trie.Hash(), proof), enc)
+	}
+	f.Fuzz(func(t *testing.T, blob []byte, enc []byte) {
+		var leaves [][][]byte
+		if err := rlp.DecodeBytes(enc, &leaves); err != nil || len(leaves) == 0 {
+			return
+		}
+		var keys, values [][]byte
+		for _, leaf := range leaves {
+			if len(leaf) != 2 {
+				return
+			}
+			keys, values = append(keys, leaf[0]), append(values, leaf[1])
+		}
+		root, proof := decodeProof(blob)
+		VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, values, proof)
+	})
+}
@@ -131,7 +131,7 @@ func (t *SecureTrie) GetKey(shaKey []byte) []byte {
 	if key, ok := t.getSecKeyCache()[string(shaKey)]; ok {
 		return key
 	}
-	key, _ := t.trie.db.preimage(common.BytesToHash(shaKey))
+	key, _ := t.trie.db.Preimage(common.BytesToHash(shaKey))
 	return key
 }
 
@@ -179,6 +179,12 @@ func (t *SecureTrie) NodeIterator(start []byte) NodeIterator {
 	return t.trie.NodeIterator(start)
 }
 
+// NodeIteratorAt returns an iterator that resumes a previous iteration of the
+// underlying trie right after the node the position was taken at.
+func (t *SecureTrie) NodeIteratorAt(pos []byte) (NodeIterator, error) {
+	return t.trie.NodeIteratorAt(pos)
+}
+
 // hashKey returns the hash of key as an ephemeral buffer.
 // The caller must not hold onto the return value because it will become
 // invalid on the next call to hashKey or secKey.
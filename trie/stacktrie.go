@@ -0,0 +1,294 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/crypto"
+	"github.com/matrix/go-matrix/log"
+	"github.com/matrix/go-matrix/mandb"
+	"github.com/matrix/go-matrix/rlp"
+)
+
+var (
+	errStackTrieOrder  = errors.New("stack trie keys must be inserted in ascending order")
+	errStackTrieDelete = errors.New("stack trie doesn't support deletion")
+	errStackTrieHashed = errors.New("stack trie already hashed")
+)
+
+// Node types of a stack trie, the hashed one being the folded form of any of
+// the others once no more keys can be inserted below it.
+const (
+	emptyStackNode = iota
+	branchStackNode
+	extStackNode
+	leafStackNode
+	hashedStackNode
+)
+
+// StackTrie is a trie implementation that expects keys to be inserted in
+// ascending order. Once a key is inserted, all subtries on its left side are
+// final and get hashed (and optionally written to the database) right away,
+// so only the rightmost path of the trie is ever kept in memory.
+//
+// All inserted keys must be of the same length, which holds for the secure
+// tries used by the state.
+type StackTrie struct {
+	nodeType  uint8
+	key       []byte         // Key nibbles covered by this node (ext and leaf)
+	val       []byte         // Leaf value, or the hash/inline blob once hashed
+	children  [16]*StackTrie // Child nodes (the first one for extensions)
+	keyOffset int            // Offset of the node's key within the full key
+
+	db   mandb.Putter // Optional database to write the hashed nodes into
+	last []byte       // Last key inserted, used to enforce the ordering
+}
+
+// NewStackTrie creates a new, empty stack trie. If the database is non-nil, all
+// trie nodes are written into it as soon as they are folded.
+func NewStackTrie(db mandb.Putter) *StackTrie {
+	return &StackTrie{nodeType: emptyStackNode, db: db}
+}
+
+func newStackLeaf(offset int, key, value []byte, db mandb.Putter) *StackTrie {
+	return &StackTrie{
+		nodeType:  leafStackNode,
+		key:       common.CopyBytes(key[offset:]),
+		val:       value,
+		keyOffset: offset,
+		db:        db,
+	}
+}
+
+// TryUpdate inserts the given key into the trie. Keys must be inserted in
+// strictly ascending order and values must be non-empty.
+func (st *StackTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return errStackTrieDelete
+	}
+	if st.nodeType == hashedStackNode {
+		return errStackTrieHashed
+	}
+	if st.last != nil && bytes.Compare(key, st.last) <= 0 {
+		return errStackTrieOrder
+	}
+	st.last = common.CopyBytes(key)
+
+	hex := keybytesToHex(key)
+	st.insert(hex[:len(hex)-1], common.CopyBytes(value))
+	return nil
+}
+
+// Update inserts the given key into the trie, logging any error.
+func (st *StackTrie) Update(key, value []byte) {
+	if err := st.TryUpdate(key, value); err != nil {
+		log.Error("Unhandled stack trie error", "err", err)
+	}
+}
+
+// diffIndex returns the index of the first nibble where the node's key and the
+// given full key differ.
+func (st *StackTrie) diffIndex(key []byte) int {
+	i := 0
+	for ; i < len(st.key) && st.key[i] == key[st.keyOffset+i]; i++ {
+	}
+	return i
+}
+
+// insert adds the key (in nibbles, without terminator) below this node.
+func (st *StackTrie) insert(key, value []byte) {
+	switch st.nodeType {
+	case emptyStackNode:
+		st.nodeType = leafStackNode
+		st.key = common.CopyBytes(key[st.keyOffset:])
+		st.val = value
+
+	case branchStackNode:
+		idx := int(key[st.keyOffset])
+
+		// Every sibling left of the insertion point is final, fold it
+		for i := idx - 1; i >= 0; i-- {
+			if st.children[i] != nil {
+				st.children[i].hash()
+				break
+			}
+		}
+		if st.children[idx] == nil {
+			st.children[idx] = newStackLeaf(st.keyOffset+1, key, value, st.db)
+			return
+		}
+		st.children[idx].insert(key, value)
+
+	case extStackNode:
+		diff := st.diffIndex(key)
+		if diff == len(st.key) {
+			st.children[0].insert(key, value)
+			return
+		}
+		// The key diverges within the extension. The original child is final,
+		// so move it below a new branch (behind a shorter extension if needed)
+		// and fold it.
+		orig := st.children[0]
+		if diff < len(st.key)-1 {
+			orig = &StackTrie{
+				nodeType:  extStackNode,
+				key:       common.CopyBytes(st.key[diff+1:]),
+				keyOffset: st.keyOffset + diff + 1,
+				db:        st.db,
+			}
+			orig.children[0] = st.children[0]
+		}
+		orig.hash()
+
+		branch := st.split(diff)
+		branch.children[st.key[diff]] = orig
+		branch.children[key[st.keyOffset+diff]] = newStackLeaf(branch.keyOffset+1, key, value, st.db)
+		st.key = st.key[:diff]
+
+	case leafStackNode:
+		diff := st.diffIndex(key)
+		if diff >= len(st.key) {
+			panic("stack trie key inserted twice")
+		}
+		// The original leaf is final, move it below a new branch and fold it
+		orig := &StackTrie{
+			nodeType:  leafStackNode,
+			key:       common.CopyBytes(st.key[diff+1:]),
+			val:       st.val,
+			keyOffset: st.keyOffset + diff + 1,
+			db:        st.db,
+		}
+		orig.hash()
+
+		branch := st.split(diff)
+		branch.children[st.key[diff]] = orig
+		branch.children[key[st.keyOffset+diff]] = newStackLeaf(branch.keyOffset+1, key, value, st.db)
+		st.key, st.val = st.key[:diff], nil
+
+	case hashedStackNode:
+		panic("stack trie insertion into folded node")
+	}
+}
+
+// split converts the node into a branch at the given key index, or into an
+// extension pointing to a fresh branch if the index is past the first nibble,
+// returning the branch.
+func (st *StackTrie) split(diff int) *StackTrie {
+	if diff == 0 {
+		st.nodeType = branchStackNode
+		st.children[0] = nil
+		return st
+	}
+	branch := &StackTrie{nodeType: branchStackNode, keyOffset: st.keyOffset + diff, db: st.db}
+	st.nodeType = extStackNode
+	st.children[0] = branch
+	return branch
+}
+
+// ref returns the value a parent node embeds to reference this folded node:
+// the node itself if it is smaller than a hash, or its hash otherwise.
+func (st *StackTrie) ref() interface{} {
+	if len(st.val) < 32 {
+		return rlp.RawValue(st.val)
+	}
+	return st.val
+}
+
+// hash folds the node and all its children, replacing the node's content with
+// its encoding (if shorter than 32 bytes) or with its hash.
+func (st *StackTrie) hash() {
+	var (
+		blob []byte
+		err  error
+	)
+	switch st.nodeType {
+	case hashedStackNode:
+		return
+
+	case emptyStackNode:
+		st.nodeType, st.val = hashedStackNode, emptyRoot.Bytes()
+		return
+
+	case branchStackNode:
+		var nodes [17]interface{}
+		for i, child := range st.children {
+			if child == nil {
+				nodes[i] = []byte{}
+				continue
+			}
+			child.hash()
+			nodes[i] = child.ref()
+			st.children[i] = nil
+		}
+		nodes[16] = []byte{}
+		blob, err = rlp.EncodeToBytes(nodes)
+
+	case extStackNode:
+		st.children[0].hash()
+		blob, err = rlp.EncodeToBytes([]interface{}{hexToCompact(st.key), st.children[0].ref()})
+		st.children[0] = nil
+
+	case leafStackNode:
+		key := append(common.CopyBytes(st.key), 16)
+		blob, err = rlp.EncodeToBytes([]interface{}{hexToCompact(key), st.val})
+	}
+	if err != nil {
+		panic("encode error: " + err.Error())
+	}
+	st.nodeType, st.key = hashedStackNode, nil
+	if len(blob) < 32 {
+		st.val = blob
+		return
+	}
+	st.val = crypto.Keccak256(blob)
+	st.store(st.val, blob)
+}
+
+func (st *StackTrie) store(hash, blob []byte) {
+	if st.db == nil {
+		return
+	}
+	if err := st.db.Put(hash, blob); err != nil {
+		log.Crit("Failed to store stack trie node", "err", err)
+	}
+}
+
+// Hash folds the entire trie and returns its root hash. No more keys can be
+// inserted afterwards.
+func (st *StackTrie) Hash() common.Hash {
+	st.hash()
+	if len(st.val) != 32 {
+		// Tiny tries aren't referenced by hash, but the root always is
+		return crypto.Keccak256Hash(st.val)
+	}
+	return common.BytesToHash(st.val)
+}
+
+// Commit folds the entire trie like Hash, also writing the root node into the
+// database even if it's small enough to be embedded.
+func (st *StackTrie) Commit() common.Hash {
+	st.hash()
+	if len(st.val) != 32 {
+		hash := crypto.Keccak256(st.val)
+		st.store(hash, st.val)
+		return common.BytesToHash(hash)
+	}
+	return common.BytesToHash(st.val)
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The MATRIX Authors as well as Copyright 2014-2017 The go-ethereum Authors
+// This file is consisted of the MATRIX library and part of the go-ethereum library.
+//
+// The MATRIX-ethereum library is free software: you can redistribute it and/or modify it under the terms of the MIT License.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, 
+//and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject tothe following conditions:
+//
+//The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, 
+//WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISINGFROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+//OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package trie
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/matrix/go-matrix/common"
+	"github.com/matrix/go-matrix/mandb"
+)
+
+// sortedKeys returns n random 32 byte keys (plus a few with shared prefixes)
+// in ascending order.
+func sortedKeys(n int) [][]byte {
+	keys := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		key := randBytes(32)
+		if i%3 == 1 {
+			copy(key, keys[i-1][:i%32])
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// Tests that the stack trie produces the same root hashes as the regular trie.
+func TestStackTrieHash(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 16, 17, 100, 1000} {
+		var (
+			stack = NewStackTrie(nil)
+			trie  = new(Trie)
+		)
+		for _, key := range sortedKeys(n) {
+			value := randBytes(1 + int(key[0])%40)
+			if err := stack.TryUpdate(key, value); err != nil {
+				t.Fatalf("n %d: failed to insert key %x: %v", n, key, err)
+			}
+			trie.Update(key, value)
+		}
+		if have, want := stack.Hash(), trie.Hash(); have != want {
+			t.Errorf("n %d: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
+
+// Tests that the nodes committed by a stack trie form a complete regular trie.
+func TestStackTrieCommit(t *testing.T) {
+	for _, n := range []int{1, 2, 500} {
+		var (
+			db    = mandb.NewMemDatabase()
+			stack = NewStackTrie(db)
+			vals  = make(map[string][]byte)
+		)
+		for _, key := range sortedKeys(n) {
+			vals[string(key)] = randBytes(20)
+			stack.Update(key, vals[string(key)])
+		}
+		trie, err := New(stack.Commit(), NewDatabase(db))
+		if err != nil {
+			t.Fatalf("n %d: failed to open committed trie: %v", n, err)
+		}
+		for key, val := range vals {
+			if have := trie.Get([]byte(key)); !bytes.Equal(have, val) {
+				t.Errorf("n %d: value mismatch for %x: have %x, want %x", n, key, have, val)
+			}
+		}
+	}
+}
+
+// Tests that misordered, duplicate and empty insertions are rejected.
+func TestStackTrieInvalidInsert(t *testing.T) {
+	stack := NewStackTrie(nil)
+	if err := stack.TryUpdate(common.Hash{2}.Bytes(), []byte{1}); err != nil {
+		t.Fatalf("failed to insert first key: %v", err)
+	}
+	if err := stack.TryUpdate(common.Hash{2}.Bytes(), []byte{1}); err != errStackTrieOrder {
+		t.Errorf("duplicate key error mismatch: have %v, want %v", err, errStackTrieOrder)
+	}
+	if err := stack.TryUpdate(common.Hash{1}.Bytes(), []byte{1}); err != errStackTrieOrder {
+		t.Errorf("misordered key error mismatch: have %v, want %v", err, errStackTrieOrder)
+	}
+	if err := stack.TryUpdate(common.Hash{3}.Bytes(), nil); err != errStackTrieDelete {
+		t.Errorf("deletion error mismatch: have %v, want %v", err, errStackTrieDelete)
+	}
+	stack.Hash()
+	if err := stack.TryUpdate(common.Hash{4}.Bytes(), []byte{1}); err != errStackTrieHashed {
+		t.Errorf("post-hash insert error mismatch: have %v, want %v", err, errStackTrieHashed)
+	}
+}
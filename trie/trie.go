@@ -117,6 +117,13 @@ func (t *Trie) NodeIterator(start []byte) NodeIterator {
 	return newNodeIterator(t, start)
 }
 
+// NodeIteratorAt returns an iterator that resumes a previous iteration of the trie
+// right after the node the position was taken at (see IteratorPosition). An error
+// is returned if the position cannot be decoded.
+func (t *Trie) NodeIteratorAt(pos []byte) (NodeIterator, error) {
+	return newNodeIteratorAt(t, pos)
+}
+
 // Get returns the value for key stored in the trie.
 // The value bytes must not be modified by the caller.
 func (t *Trie) Get(key []byte) []byte {
@@ -326,6 +326,42 @@ func (db *countingDB) Get(key []byte) ([]byte, error) {
 	return db.Database.Get(key)
 }
 
+// TestCommitAfterHash checks that committing a hashed trie, which reuses the
+// node encodings cached while hashing, stores the same nodes as committing it
+// straight away.
+func TestCommitAfterHash(t *testing.T) {
+	hashed, direct := makeAccountTrie(1000), makeAccountTrie(1000)
+
+	// Hash one of the tries, then modify it so some cached encodings go stale
+	hashed.Hash()
+	for i := byte(0); i < 10; i++ {
+		key := crypto.Keccak256([]byte{i})
+		hashed.Update(key, key)
+		direct.Update(key, key)
+	}
+	hashed.Hash()
+
+	hashedRoot, _ := hashed.Commit(nil)
+	directRoot, _ := direct.Commit(nil)
+	if hashedRoot != directRoot {
+		t.Fatalf("root mismatch: have %x, want %x", hashedRoot, directRoot)
+	}
+	nodes := direct.db.Nodes()
+	if have := len(hashed.db.Nodes()); have != len(nodes) {
+		t.Fatalf("node count mismatch: have %d, want %d", have, len(nodes))
+	}
+	for _, hash := range nodes {
+		want, _ := direct.db.Node(hash)
+		have, err := hashed.db.Node(hash)
+		if err != nil {
+			t.Fatalf("node %x missing: %v", hash, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("node %x mismatch: have %x, want %x", hash, have, want)
+		}
+	}
+}
+
 // TestCacheUnload checks that decoded nodes are unloaded after a
 // certain number of commit operations.
 func TestCacheUnload(t *testing.T) {
@@ -560,11 +596,36 @@ func benchUpdate(b *testing.B, e binary.ByteOrder) *Trie {
 // the first one will be NOOP. As such, we'll use b.N as the number of account to
 // insert into the trie before measuring the hashing.
 func BenchmarkHash(b *testing.B) {
+	trie := makeAccountTrie(b.N)
+	b.ResetTimer()
+	b.ReportAllocs()
+	trie.Hash()
+}
+
+// Benchmarks committing a trie that was already hashed, as done at the end of
+// block import, reusing the node encodings cached while hashing.
+func BenchmarkHashCommit(b *testing.B) {
+	trie := makeAccountTrie(b.N)
+	b.ResetTimer()
+	b.ReportAllocs()
+	trie.Hash()
+	trie.Commit(nil)
+}
+
+// Benchmarks committing a trie which was never hashed before.
+func BenchmarkCommit(b *testing.B) {
+	trie := makeAccountTrie(b.N)
+	b.ResetTimer()
+	b.ReportAllocs()
+	trie.Commit(nil)
+}
+
+// makeAccountTrie creates a realistic account trie with n random accounts.
+func makeAccountTrie(n int) *Trie {
 	// Make the random benchmark deterministic
 	random := rand.New(rand.NewSource(0))
 
-	// Create a realistic account trie to hash
-	addresses := make([][20]byte, b.N)
+	addresses := make([][20]byte, n)
 	for i := 0; i < len(addresses); i++ {
 		for j := 0; j < len(addresses[i]); j++ {
 			addresses[i][j] = byte(random.Intn(256))
@@ -580,14 +641,11 @@ func BenchmarkHash(b *testing.B) {
 		)
 		accounts[i], _ = rlp.EncodeToBytes([]interface{}{nonce, balance, root, code})
 	}
-	// Insert the accounts into the trie and hash it
 	trie := newEmpty()
 	for i := 0; i < len(addresses); i++ {
 		trie.Update(crypto.Keccak256(addresses[i][:]), accounts[i])
 	}
-	b.ResetTimer()
-	b.ReportAllocs()
-	trie.Hash()
+	return trie
 }
 
 func tempDB() (string, *Database) {